@@ -0,0 +1,1166 @@
+// gRPC surface of llm-queue-proxy. Messages mirror the JSON bodies of the HTTP
+// API; upstream request and response bodies are passed through as raw bytes.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: llmqueueproxy/v1/proxy.proto
+
+package llmqueueproxyv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubmitRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Session the request is counted against; empty for untracked requests.
+	SessionId string `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// Upstream method and path, e.g. POST /v1/chat/completions.
+	Method  string            `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	Path    string            `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"`
+	Headers map[string]string `protobuf:"bytes,4,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Body    []byte            `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+	// Latest time the request may wait in the queue, like X-Queue-Deadline.
+	Deadline      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=deadline,proto3" json:"deadline,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitRequest) Reset() {
+	*x = SubmitRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitRequest) ProtoMessage() {}
+
+func (x *SubmitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitRequest.ProtoReflect.Descriptor instead.
+func (*SubmitRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubmitRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SubmitRequest) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *SubmitRequest) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *SubmitRequest) GetDeadline() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Deadline
+	}
+	return nil
+}
+
+type SubmitResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	StatusCode int32                  `protobuf:"varint,1,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Headers    map[string]string      `protobuf:"bytes,2,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Body       []byte                 `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	// Whether the response was served from the response cache.
+	Cached            bool  `protobuf:"varint,4,opt,name=cached,proto3" json:"cached,omitempty"`
+	QueueWaitMs       int64 `protobuf:"varint,5,opt,name=queue_wait_ms,json=queueWaitMs,proto3" json:"queue_wait_ms,omitempty"`
+	UpstreamLatencyMs int64 `protobuf:"varint,6,opt,name=upstream_latency_ms,json=upstreamLatencyMs,proto3" json:"upstream_latency_ms,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *SubmitResponse) Reset() {
+	*x = SubmitResponse{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitResponse) ProtoMessage() {}
+
+func (x *SubmitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitResponse.ProtoReflect.Descriptor instead.
+func (*SubmitResponse) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *SubmitResponse) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *SubmitResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *SubmitResponse) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *SubmitResponse) GetQueueWaitMs() int64 {
+	if x != nil {
+		return x.QueueWaitMs
+	}
+	return 0
+}
+
+func (x *SubmitResponse) GetUpstreamLatencyMs() int64 {
+	if x != nil {
+		return x.UpstreamLatencyMs
+	}
+	return 0
+}
+
+type StreamEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*StreamEvent_Queued
+	//	*StreamEvent_Data
+	//	*StreamEvent_Error
+	Event         isStreamEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEvent) Reset() {
+	*x = StreamEvent{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEvent) ProtoMessage() {}
+
+func (x *StreamEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEvent.ProtoReflect.Descriptor instead.
+func (*StreamEvent) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StreamEvent) GetEvent() isStreamEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *StreamEvent) GetQueued() *QueueEstimate {
+	if x != nil {
+		if x, ok := x.Event.(*StreamEvent_Queued); ok {
+			return x.Queued
+		}
+	}
+	return nil
+}
+
+func (x *StreamEvent) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Event.(*StreamEvent_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+func (x *StreamEvent) GetError() []byte {
+	if x != nil {
+		if x, ok := x.Event.(*StreamEvent_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isStreamEvent_Event interface {
+	isStreamEvent_Event()
+}
+
+type StreamEvent_Queued struct {
+	// Place the request took in the queue, sent before its first data event.
+	// Omitted for requests that never entered the queue, such as cache hits.
+	Queued *QueueEstimate `protobuf:"bytes,1,opt,name=queued,proto3,oneof"`
+}
+
+type StreamEvent_Data struct {
+	// Data of one upstream server-sent event.
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+type StreamEvent_Error struct {
+	// Error envelope of an upstream or proxy error.
+	Error []byte `protobuf:"bytes,3,opt,name=error,proto3,oneof"`
+}
+
+func (*StreamEvent_Queued) isStreamEvent_Event() {}
+
+func (*StreamEvent_Data) isStreamEvent_Event() {}
+
+func (*StreamEvent_Error) isStreamEvent_Event() {}
+
+type QueueEstimate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Position      int32                  `protobuf:"varint,1,opt,name=position,proto3" json:"position,omitempty"`
+	DispatchAt    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=dispatch_at,json=dispatchAt,proto3" json:"dispatch_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueueEstimate) Reset() {
+	*x = QueueEstimate{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueueEstimate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueueEstimate) ProtoMessage() {}
+
+func (x *QueueEstimate) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueueEstimate.ProtoReflect.Descriptor instead.
+func (*QueueEstimate) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *QueueEstimate) GetPosition() int32 {
+	if x != nil {
+		return x.Position
+	}
+	return 0
+}
+
+func (x *QueueEstimate) GetDispatchAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DispatchAt
+	}
+	return nil
+}
+
+type GetSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionRequest) Reset() {
+	*x = GetSessionRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionRequest) ProtoMessage() {}
+
+func (x *GetSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionRequest.ProtoReflect.Descriptor instead.
+func (*GetSessionRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetSessionRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+type Session struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	SessionId             string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	TotalPromptTokens     int64                  `protobuf:"varint,2,opt,name=total_prompt_tokens,json=totalPromptTokens,proto3" json:"total_prompt_tokens,omitempty"`
+	TotalCompletionTokens int64                  `protobuf:"varint,3,opt,name=total_completion_tokens,json=totalCompletionTokens,proto3" json:"total_completion_tokens,omitempty"`
+	TotalTokens           int64                  `protobuf:"varint,4,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	RequestCount          int64                  `protobuf:"varint,5,opt,name=request_count,json=requestCount,proto3" json:"request_count,omitempty"`
+	EstimatedTokens       int64                  `protobuf:"varint,6,opt,name=estimated_tokens,json=estimatedTokens,proto3" json:"estimated_tokens,omitempty"`
+	Responses_2Xx         int64                  `protobuf:"varint,7,opt,name=responses_2xx,json=responses2xx,proto3" json:"responses_2xx,omitempty"`
+	Responses_4Xx         int64                  `protobuf:"varint,8,opt,name=responses_4xx,json=responses4xx,proto3" json:"responses_4xx,omitempty"`
+	Responses_5Xx         int64                  `protobuf:"varint,9,opt,name=responses_5xx,json=responses5xx,proto3" json:"responses_5xx,omitempty"`
+	LastError             string                 `protobuf:"bytes,10,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	LastErrorAt           *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=last_error_at,json=lastErrorAt,proto3" json:"last_error_at,omitempty"`
+	Metadata              map[string]string      `protobuf:"bytes,12,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Session) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *Session) GetTotalPromptTokens() int64 {
+	if x != nil {
+		return x.TotalPromptTokens
+	}
+	return 0
+}
+
+func (x *Session) GetTotalCompletionTokens() int64 {
+	if x != nil {
+		return x.TotalCompletionTokens
+	}
+	return 0
+}
+
+func (x *Session) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+func (x *Session) GetRequestCount() int64 {
+	if x != nil {
+		return x.RequestCount
+	}
+	return 0
+}
+
+func (x *Session) GetEstimatedTokens() int64 {
+	if x != nil {
+		return x.EstimatedTokens
+	}
+	return 0
+}
+
+func (x *Session) GetResponses_2Xx() int64 {
+	if x != nil {
+		return x.Responses_2Xx
+	}
+	return 0
+}
+
+func (x *Session) GetResponses_4Xx() int64 {
+	if x != nil {
+		return x.Responses_4Xx
+	}
+	return 0
+}
+
+func (x *Session) GetResponses_5Xx() int64 {
+	if x != nil {
+		return x.Responses_5Xx
+	}
+	return 0
+}
+
+func (x *Session) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *Session) GetLastErrorAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastErrorAt
+	}
+	return nil
+}
+
+func (x *Session) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type ListSessionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsRequest) Reset() {
+	*x = ListSessionsRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsRequest) ProtoMessage() {}
+
+func (x *ListSessionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsRequest.ProtoReflect.Descriptor instead.
+func (*ListSessionsRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{6}
+}
+
+type ListSessionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sessions      []*Session             `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsResponse) Reset() {
+	*x = ListSessionsResponse{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsResponse) ProtoMessage() {}
+
+func (x *ListSessionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsResponse.ProtoReflect.Descriptor instead.
+func (*ListSessionsResponse) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListSessionsResponse) GetSessions() []*Session {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+type IssueKeyRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	TenantId string                 `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Name     string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Also issue a secret for HMAC request signing.
+	Signing       bool `protobuf:"varint,3,opt,name=signing,proto3" json:"signing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IssueKeyRequest) Reset() {
+	*x = IssueKeyRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IssueKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueKeyRequest) ProtoMessage() {}
+
+func (x *IssueKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueKeyRequest.ProtoReflect.Descriptor instead.
+func (*IssueKeyRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *IssueKeyRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *IssueKeyRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *IssueKeyRequest) GetSigning() bool {
+	if x != nil {
+		return x.Signing
+	}
+	return false
+}
+
+type VirtualKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	TenantId      string                 `protobuf:"bytes,2,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VirtualKey) Reset() {
+	*x = VirtualKey{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VirtualKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VirtualKey) ProtoMessage() {}
+
+func (x *VirtualKey) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VirtualKey.ProtoReflect.Descriptor instead.
+func (*VirtualKey) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *VirtualKey) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *VirtualKey) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *VirtualKey) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *VirtualKey) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+// IssuedKey carries the plaintext key and signing secret, returned only once.
+type IssuedKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           *VirtualKey            `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	PlaintextKey  string                 `protobuf:"bytes,2,opt,name=plaintext_key,json=plaintextKey,proto3" json:"plaintext_key,omitempty"`
+	SigningSecret string                 `protobuf:"bytes,3,opt,name=signing_secret,json=signingSecret,proto3" json:"signing_secret,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IssuedKey) Reset() {
+	*x = IssuedKey{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IssuedKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssuedKey) ProtoMessage() {}
+
+func (x *IssuedKey) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssuedKey.ProtoReflect.Descriptor instead.
+func (*IssuedKey) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IssuedKey) GetKey() *VirtualKey {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *IssuedKey) GetPlaintextKey() string {
+	if x != nil {
+		return x.PlaintextKey
+	}
+	return ""
+}
+
+func (x *IssuedKey) GetSigningSecret() string {
+	if x != nil {
+		return x.SigningSecret
+	}
+	return ""
+}
+
+type ListKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TenantId      string                 `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeysRequest) Reset() {
+	*x = ListKeysRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeysRequest) ProtoMessage() {}
+
+func (x *ListKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeysRequest.ProtoReflect.Descriptor instead.
+func (*ListKeysRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListKeysRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+type ListKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []*VirtualKey          `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListKeysResponse) Reset() {
+	*x = ListKeysResponse{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListKeysResponse) ProtoMessage() {}
+
+func (x *ListKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListKeysResponse.ProtoReflect.Descriptor instead.
+func (*ListKeysResponse) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListKeysResponse) GetKeys() []*VirtualKey {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type DeleteKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TenantId      string                 `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteKeyRequest) Reset() {
+	*x = DeleteKeyRequest{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteKeyRequest) ProtoMessage() {}
+
+func (x *DeleteKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteKeyRequest.ProtoReflect.Descriptor instead.
+func (*DeleteKeyRequest) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeleteKeyRequest) GetTenantId() string {
+	if x != nil {
+		return x.TenantId
+	}
+	return ""
+}
+
+func (x *DeleteKeyRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteKeyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteKeyResponse) Reset() {
+	*x = DeleteKeyResponse{}
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteKeyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteKeyResponse) ProtoMessage() {}
+
+func (x *DeleteKeyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_llmqueueproxy_v1_proxy_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteKeyResponse.ProtoReflect.Descriptor instead.
+func (*DeleteKeyResponse) Descriptor() ([]byte, []int) {
+	return file_llmqueueproxy_v1_proxy_proto_rawDescGZIP(), []int{14}
+}
+
+var File_llmqueueproxy_v1_proxy_proto protoreflect.FileDescriptor
+
+const file_llmqueueproxy_v1_proxy_proto_rawDesc = "" +
+	"\n" +
+	"\x1cllmqueueproxy/v1/proxy.proto\x12\x10llmqueueproxy.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xaa\x02\n" +
+	"\rSubmitRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\tR\x04path\x12F\n" +
+	"\aheaders\x18\x04 \x03(\v2,.llmqueueproxy.v1.SubmitRequest.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04body\x18\x05 \x01(\fR\x04body\x126\n" +
+	"\bdeadline\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\bdeadline\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb6\x02\n" +
+	"\x0eSubmitResponse\x12\x1f\n" +
+	"\vstatus_code\x18\x01 \x01(\x05R\n" +
+	"statusCode\x12G\n" +
+	"\aheaders\x18\x02 \x03(\v2-.llmqueueproxy.v1.SubmitResponse.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04body\x18\x03 \x01(\fR\x04body\x12\x16\n" +
+	"\x06cached\x18\x04 \x01(\bR\x06cached\x12\"\n" +
+	"\rqueue_wait_ms\x18\x05 \x01(\x03R\vqueueWaitMs\x12.\n" +
+	"\x13upstream_latency_ms\x18\x06 \x01(\x03R\x11upstreamLatencyMs\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x7f\n" +
+	"\vStreamEvent\x129\n" +
+	"\x06queued\x18\x01 \x01(\v2\x1f.llmqueueproxy.v1.QueueEstimateH\x00R\x06queued\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04data\x12\x16\n" +
+	"\x05error\x18\x03 \x01(\fH\x00R\x05errorB\a\n" +
+	"\x05event\"h\n" +
+	"\rQueueEstimate\x12\x1a\n" +
+	"\bposition\x18\x01 \x01(\x05R\bposition\x12;\n" +
+	"\vdispatch_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"dispatchAt\"2\n" +
+	"\x11GetSessionRequest\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\"\xd3\x04\n" +
+	"\aSession\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12.\n" +
+	"\x13total_prompt_tokens\x18\x02 \x01(\x03R\x11totalPromptTokens\x126\n" +
+	"\x17total_completion_tokens\x18\x03 \x01(\x03R\x15totalCompletionTokens\x12!\n" +
+	"\ftotal_tokens\x18\x04 \x01(\x03R\vtotalTokens\x12#\n" +
+	"\rrequest_count\x18\x05 \x01(\x03R\frequestCount\x12)\n" +
+	"\x10estimated_tokens\x18\x06 \x01(\x03R\x0festimatedTokens\x12#\n" +
+	"\rresponses_2xx\x18\a \x01(\x03R\fresponses2xx\x12#\n" +
+	"\rresponses_4xx\x18\b \x01(\x03R\fresponses4xx\x12#\n" +
+	"\rresponses_5xx\x18\t \x01(\x03R\fresponses5xx\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\n" +
+	" \x01(\tR\tlastError\x12>\n" +
+	"\rlast_error_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\vlastErrorAt\x12C\n" +
+	"\bmetadata\x18\f \x03(\v2'.llmqueueproxy.v1.Session.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x15\n" +
+	"\x13ListSessionsRequest\"M\n" +
+	"\x14ListSessionsResponse\x125\n" +
+	"\bsessions\x18\x01 \x03(\v2\x19.llmqueueproxy.v1.SessionR\bsessions\"\\\n" +
+	"\x0fIssueKeyRequest\x12\x1b\n" +
+	"\ttenant_id\x18\x01 \x01(\tR\btenantId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x18\n" +
+	"\asigning\x18\x03 \x01(\bR\asigning\"\x88\x01\n" +
+	"\n" +
+	"VirtualKey\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\ttenant_id\x18\x02 \x01(\tR\btenantId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\"\x87\x01\n" +
+	"\tIssuedKey\x12.\n" +
+	"\x03key\x18\x01 \x01(\v2\x1c.llmqueueproxy.v1.VirtualKeyR\x03key\x12#\n" +
+	"\rplaintext_key\x18\x02 \x01(\tR\fplaintextKey\x12%\n" +
+	"\x0esigning_secret\x18\x03 \x01(\tR\rsigningSecret\".\n" +
+	"\x0fListKeysRequest\x12\x1b\n" +
+	"\ttenant_id\x18\x01 \x01(\tR\btenantId\"D\n" +
+	"\x10ListKeysResponse\x120\n" +
+	"\x04keys\x18\x01 \x03(\v2\x1c.llmqueueproxy.v1.VirtualKeyR\x04keys\"?\n" +
+	"\x10DeleteKeyRequest\x12\x1b\n" +
+	"\ttenant_id\x18\x01 \x01(\tR\btenantId\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\"\x13\n" +
+	"\x11DeleteKeyResponse2\xda\x02\n" +
+	"\fProxyService\x12K\n" +
+	"\x06Submit\x12\x1f.llmqueueproxy.v1.SubmitRequest\x1a .llmqueueproxy.v1.SubmitResponse\x12P\n" +
+	"\fSubmitStream\x12\x1f.llmqueueproxy.v1.SubmitRequest\x1a\x1d.llmqueueproxy.v1.StreamEvent0\x01\x12L\n" +
+	"\n" +
+	"GetSession\x12#.llmqueueproxy.v1.GetSessionRequest\x1a\x19.llmqueueproxy.v1.Session\x12]\n" +
+	"\fListSessions\x12%.llmqueueproxy.v1.ListSessionsRequest\x1a&.llmqueueproxy.v1.ListSessionsResponse2\x81\x02\n" +
+	"\n" +
+	"KeyService\x12J\n" +
+	"\bIssueKey\x12!.llmqueueproxy.v1.IssueKeyRequest\x1a\x1b.llmqueueproxy.v1.IssuedKey\x12Q\n" +
+	"\bListKeys\x12!.llmqueueproxy.v1.ListKeysRequest\x1a\".llmqueueproxy.v1.ListKeysResponse\x12T\n" +
+	"\tDeleteKey\x12\".llmqueueproxy.v1.DeleteKeyRequest\x1a#.llmqueueproxy.v1.DeleteKeyResponseBSZQgithub.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1;llmqueueproxyv1b\x06proto3"
+
+var (
+	file_llmqueueproxy_v1_proxy_proto_rawDescOnce sync.Once
+	file_llmqueueproxy_v1_proxy_proto_rawDescData []byte
+)
+
+func file_llmqueueproxy_v1_proxy_proto_rawDescGZIP() []byte {
+	file_llmqueueproxy_v1_proxy_proto_rawDescOnce.Do(func() {
+		file_llmqueueproxy_v1_proxy_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_llmqueueproxy_v1_proxy_proto_rawDesc), len(file_llmqueueproxy_v1_proxy_proto_rawDesc)))
+	})
+	return file_llmqueueproxy_v1_proxy_proto_rawDescData
+}
+
+var file_llmqueueproxy_v1_proxy_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_llmqueueproxy_v1_proxy_proto_goTypes = []any{
+	(*SubmitRequest)(nil),         // 0: llmqueueproxy.v1.SubmitRequest
+	(*SubmitResponse)(nil),        // 1: llmqueueproxy.v1.SubmitResponse
+	(*StreamEvent)(nil),           // 2: llmqueueproxy.v1.StreamEvent
+	(*QueueEstimate)(nil),         // 3: llmqueueproxy.v1.QueueEstimate
+	(*GetSessionRequest)(nil),     // 4: llmqueueproxy.v1.GetSessionRequest
+	(*Session)(nil),               // 5: llmqueueproxy.v1.Session
+	(*ListSessionsRequest)(nil),   // 6: llmqueueproxy.v1.ListSessionsRequest
+	(*ListSessionsResponse)(nil),  // 7: llmqueueproxy.v1.ListSessionsResponse
+	(*IssueKeyRequest)(nil),       // 8: llmqueueproxy.v1.IssueKeyRequest
+	(*VirtualKey)(nil),            // 9: llmqueueproxy.v1.VirtualKey
+	(*IssuedKey)(nil),             // 10: llmqueueproxy.v1.IssuedKey
+	(*ListKeysRequest)(nil),       // 11: llmqueueproxy.v1.ListKeysRequest
+	(*ListKeysResponse)(nil),      // 12: llmqueueproxy.v1.ListKeysResponse
+	(*DeleteKeyRequest)(nil),      // 13: llmqueueproxy.v1.DeleteKeyRequest
+	(*DeleteKeyResponse)(nil),     // 14: llmqueueproxy.v1.DeleteKeyResponse
+	nil,                           // 15: llmqueueproxy.v1.SubmitRequest.HeadersEntry
+	nil,                           // 16: llmqueueproxy.v1.SubmitResponse.HeadersEntry
+	nil,                           // 17: llmqueueproxy.v1.Session.MetadataEntry
+	(*timestamppb.Timestamp)(nil), // 18: google.protobuf.Timestamp
+}
+var file_llmqueueproxy_v1_proxy_proto_depIdxs = []int32{
+	15, // 0: llmqueueproxy.v1.SubmitRequest.headers:type_name -> llmqueueproxy.v1.SubmitRequest.HeadersEntry
+	18, // 1: llmqueueproxy.v1.SubmitRequest.deadline:type_name -> google.protobuf.Timestamp
+	16, // 2: llmqueueproxy.v1.SubmitResponse.headers:type_name -> llmqueueproxy.v1.SubmitResponse.HeadersEntry
+	3,  // 3: llmqueueproxy.v1.StreamEvent.queued:type_name -> llmqueueproxy.v1.QueueEstimate
+	18, // 4: llmqueueproxy.v1.QueueEstimate.dispatch_at:type_name -> google.protobuf.Timestamp
+	18, // 5: llmqueueproxy.v1.Session.last_error_at:type_name -> google.protobuf.Timestamp
+	17, // 6: llmqueueproxy.v1.Session.metadata:type_name -> llmqueueproxy.v1.Session.MetadataEntry
+	5,  // 7: llmqueueproxy.v1.ListSessionsResponse.sessions:type_name -> llmqueueproxy.v1.Session
+	18, // 8: llmqueueproxy.v1.VirtualKey.created_at:type_name -> google.protobuf.Timestamp
+	9,  // 9: llmqueueproxy.v1.IssuedKey.key:type_name -> llmqueueproxy.v1.VirtualKey
+	9,  // 10: llmqueueproxy.v1.ListKeysResponse.keys:type_name -> llmqueueproxy.v1.VirtualKey
+	0,  // 11: llmqueueproxy.v1.ProxyService.Submit:input_type -> llmqueueproxy.v1.SubmitRequest
+	0,  // 12: llmqueueproxy.v1.ProxyService.SubmitStream:input_type -> llmqueueproxy.v1.SubmitRequest
+	4,  // 13: llmqueueproxy.v1.ProxyService.GetSession:input_type -> llmqueueproxy.v1.GetSessionRequest
+	6,  // 14: llmqueueproxy.v1.ProxyService.ListSessions:input_type -> llmqueueproxy.v1.ListSessionsRequest
+	8,  // 15: llmqueueproxy.v1.KeyService.IssueKey:input_type -> llmqueueproxy.v1.IssueKeyRequest
+	11, // 16: llmqueueproxy.v1.KeyService.ListKeys:input_type -> llmqueueproxy.v1.ListKeysRequest
+	13, // 17: llmqueueproxy.v1.KeyService.DeleteKey:input_type -> llmqueueproxy.v1.DeleteKeyRequest
+	1,  // 18: llmqueueproxy.v1.ProxyService.Submit:output_type -> llmqueueproxy.v1.SubmitResponse
+	2,  // 19: llmqueueproxy.v1.ProxyService.SubmitStream:output_type -> llmqueueproxy.v1.StreamEvent
+	5,  // 20: llmqueueproxy.v1.ProxyService.GetSession:output_type -> llmqueueproxy.v1.Session
+	7,  // 21: llmqueueproxy.v1.ProxyService.ListSessions:output_type -> llmqueueproxy.v1.ListSessionsResponse
+	10, // 22: llmqueueproxy.v1.KeyService.IssueKey:output_type -> llmqueueproxy.v1.IssuedKey
+	12, // 23: llmqueueproxy.v1.KeyService.ListKeys:output_type -> llmqueueproxy.v1.ListKeysResponse
+	14, // 24: llmqueueproxy.v1.KeyService.DeleteKey:output_type -> llmqueueproxy.v1.DeleteKeyResponse
+	18, // [18:25] is the sub-list for method output_type
+	11, // [11:18] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_llmqueueproxy_v1_proxy_proto_init() }
+func file_llmqueueproxy_v1_proxy_proto_init() {
+	if File_llmqueueproxy_v1_proxy_proto != nil {
+		return
+	}
+	file_llmqueueproxy_v1_proxy_proto_msgTypes[2].OneofWrappers = []any{
+		(*StreamEvent_Queued)(nil),
+		(*StreamEvent_Data)(nil),
+		(*StreamEvent_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_llmqueueproxy_v1_proxy_proto_rawDesc), len(file_llmqueueproxy_v1_proxy_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_llmqueueproxy_v1_proxy_proto_goTypes,
+		DependencyIndexes: file_llmqueueproxy_v1_proxy_proto_depIdxs,
+		MessageInfos:      file_llmqueueproxy_v1_proxy_proto_msgTypes,
+	}.Build()
+	File_llmqueueproxy_v1_proxy_proto = out.File
+	file_llmqueueproxy_v1_proxy_proto_goTypes = nil
+	file_llmqueueproxy_v1_proxy_proto_depIdxs = nil
+}
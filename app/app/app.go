@@ -1,72 +1,1066 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/nats-io/nats.go"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	llmqueueproxyv1 "github.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/affinity"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/alert"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/assistants"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/authz"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/billing"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/budget"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/cache"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/chaos"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/dedup"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/experiment"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/fallback"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/finetune"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/fixture"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/grpcapi"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/guard"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/handlers"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/history"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/hook"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/jetstream"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/jobs"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/kafka"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/lease"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/maintenance"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/models"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/moderation"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/pricing"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/probe"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/ratelimit"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/redact"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/retention"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/secrets"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/session"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/shadow"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/throttle"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tlsconfig"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tokenizer"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/transcript"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/upstreamerr"
 )
 
 // App holds all application dependencies
 type App struct {
 	Config         *config.Config
+	BuildInfo      entities.BuildInfo
 	Repository     repository.Repository
 	SessionManager *session.SessionManager
-	Queue          *queue.Queue
+	// Queue is the default queue of the QUEUE_BACKEND implementation
+	Queue   entities.RequestQueue
+	Metrics *metrics.Metrics
+	// EmbeddingCache is nil unless EMBEDDING_CACHE_ENABLED is set
+	EmbeddingCache *cache.EmbeddingCache
+	// ProxyQueue is Queue wrapped in the router and configured decorators (shadow, deduplication, cache, A/B routing)
+	ProxyQueue handlers.Queue
+	// NamedQueues are the additional queues requests are routed to by QUEUE_ROUTES
+	NamedQueues map[string]entities.RequestQueue
+	// ShadowQueue is nil unless SHADOW_PERCENT is set
+	ShadowQueue *queue.Queue
+	// NATS is nil unless QUEUE_BACKEND is jetstream
+	NATS *nats.Conn
+	// ModelSplitter is nil unless MODEL_SPLITS is set
+	ModelSplitter *experiment.Splitter
+	// FaultInjector is nil unless CHAOS_ENABLED is set
+	FaultInjector *chaos.Injector
+	// RequestHistory is nil unless REQUEST_HISTORY_ENABLED is set
+	RequestHistory repository.HistoryRepository
+	// Replayer re-sends recorded requests; nil unless REQUEST_HISTORY_ENABLED is set
+	Replayer *history.Replayer
+	// CapturePurger is nil unless HISTORY_CAPTURE and HISTORY_CAPTURE_RETENTION are set
+	CapturePurger *history.Purger
+	// ShadowResults is nil unless SHADOW_STORE_RESULTS is set
+	ShadowResults repository.ShadowRepository
+	JobRunner     *jobs.Runner
+	// Redactor is nil unless REDACTION_ENABLED is set
+	Redactor *redact.Redactor
+	// RequestFilters are applied to request bodies before they are enqueued
+	RequestFilters []handlers.RequestFilter
+	// ResponseFilters are applied to buffered responses before they are returned
+	ResponseFilters []handlers.ResponseFilter
+	// Alerts is nil unless a session budget, ALERT_ERROR_RATE or ALERT_QUEUE_DEPTH is set
+	Alerts *alert.Dispatcher
+	// QueueDepthMonitor is nil unless ALERT_QUEUE_DEPTH is set
+	QueueDepthMonitor *alert.QueueDepthMonitor
+	// AnomalyDetector is nil unless ALERT_ANOMALY_INTERVAL is set
+	AnomalyDetector *alert.AnomalyDetector
+	// Budgets is nil unless a session budget is set
+	Budgets *budget.Ledger
+	// BudgetEnforcer is nil unless BUDGET_OVERDRAFT and a session budget are set
+	BudgetEnforcer *budget.Enforcer
+	// Maintenance rejects new proxy requests while it is switched on
+	Maintenance *maintenance.Mode
+	// QueueHistory is nil when QUEUE_HISTORY_MINUTES is 0
+	QueueHistory *queue.History
+	// Prober is nil unless UPSTREAM_PROBE_INTERVAL is set
+	Prober *probe.Prober
+	// UsageReporter is nil unless STRIPE_API_KEY is set
+	UsageReporter *billing.Reporter
+	// KeyWatcher is nil unless the API key is read from a file or secrets
+	// provider and SECRETS_REFRESH_INTERVAL is set
+	KeyWatcher *secrets.Watcher
+	// IPRules restrict the client addresses of both listeners
+	IPRules entities.IPRules
+	// IPLimiter is nil unless IP_RATE_LIMIT_PER_MIN is set
+	IPLimiter *ratelimit.Limiter
+	// Threads attributes Assistants API runs to the sessions of their threads
+	Threads *assistants.Tracker
+	// Pricing prices session usage from PRICING
+	Pricing *pricing.Table
+	// FineTunes polls fine-tuning jobs created through sessions for their trained tokens
+	FineTunes *finetune.Tracker
+	// Pruner is nil unless HISTORY_RETENTION, JOB_RETENTION or SESSION_RETENTION is set
+	Pruner *retention.Pruner
+	// Leader is nil unless LEADER_ELECTION is set
+	Leader *lease.Elector
+	// KafkaConsumer is nil unless KAFKA_REST_URL is set
+	KafkaConsumer *kafka.Consumer
+	// ThreadSessions stores the thread mappings learned or set on the admin API
+	ThreadSessions repository.ThreadRepository
+	// Summaries aggregates session statistics for /sessions/summary
+	Summaries repository.SummaryRepository
+	// Transcripts is nil unless TRANSCRIPT_ENABLED is set
+	Transcripts repository.TranscriptRepository
+	// TenantResolver and Tenants are nil unless TENANT_MODE is set
+	TenantResolver *tenant.Resolver
+	Tenants        *tenant.Service
+	// Affinity is nil unless STICKY_SESSIONS or REPLICA_FORWARDING is set
+	Affinity *affinity.Router
+	// Authorizer is nil unless AUTHZ_URL is set
+	Authorizer *authz.Authorizer
 }
 
-// NewApp creates and initializes all application dependencies
-func NewApp() (*App, error) {
-	// Load configuration
-	cfg := config.GetConfig()
-
+// NewApp creates and initializes all application dependencies from the given configuration
+func NewApp(cfg *config.Config) (*App, error) {
 	// Create repository based on configuration
-	var repo repository.Repository
-	var err error
+	storage, err := NewStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewAppWithStorage(cfg, storage)
+}
+
+// NewAppWithStorage creates the application dependencies around an
+// initialized storage, e.g. one provided by a service embedding the proxy.
+// The repository settings of cfg are ignored.
+func NewAppWithStorage(cfg *config.Config, storage repository.Storage) (*App, error) {
+	// Resolve the API key from a file or secrets provider before anything uses it
+	keySource, err := newKeySource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if keySource != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Secrets.Timeout)
+		apiKey, err := keySource.Fetch(ctx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the OpenAI API key: %w", err)
+		}
+		resolved := *cfg
+		resolved.OpenAI.APIKey = apiKey
+		cfg = &resolved
+	}
+	// Everything using the OpenAI API key receives rotated keys
+	var keyConsumers []secrets.KeyConsumer
+	useKey := func(consumer secrets.KeyConsumer) {
+		keyConsumers = append(keyConsumers, consumer)
+	}
+
+	ipRules, err := newIPRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var ipLimiter *ratelimit.Limiter
+	if cfg.HTTP.IPRateLimitPerMin > 0 {
+		ipLimiter = ratelimit.NewLimiter()
+	}
+	affinityRouter, err := newAffinityRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Background tasks run on one instance when replicas share the repository
+	var leader *lease.Elector
+	if cfg.Coordination.LeaderElection {
+		leader = lease.NewElector(storage, "background-tasks", instanceID(cfg), cfg.Coordination.LeaseTTL)
+		leader.Start()
+	}
+
+	// Create the local token estimator used when upstream omits usage
+	var estimator session.TokenEstimator
+	if cfg.Tokens.EstimationEnabled {
+		estimator = tokenizer.NewEstimator()
+	}
+
+	// Alerts fire on budget, upstream error rate and queue depth thresholds,
+	// and on sessions consuming tokens far above their baseline
+	alertsCfg := cfg.Alerts
+	budgets := entities.SessionBudgets{Default: cfg.Tokens.DefaultBudget, Sessions: cfg.Tokens.SessionBudgets}
+	budgetsEnabled := budgets.Default > 0 || len(budgets.Sessions) > 0
+	var alerts *alert.Dispatcher
+	if budgetsEnabled || alertsCfg.ErrorRate > 0 || alertsCfg.QueueDepth > 0 || alertsCfg.AnomalyInterval > 0 {
+		alerts = newAlertDispatcher(cfg)
+	}
+
+	// Create session manager with repository dependency; budgets include
+	// the transfers made on /budgets/transfers
+	var sessionRepo session.Repository = storage
+	var budgetLedger *budget.Ledger
+	if budgetsEnabled {
+		budgetLedger = budget.NewLedger(budgets, storage)
+		sessionRepo = alert.NewBudgetMonitor(storage, budgetLedger, alertsCfg.BudgetThresholds, alerts)
+	}
+	sessionManager := session.NewSessionManager(sessionRepo, estimator)
+
+	// Create the default queue and any named queues with config dependency
+	metricsRegistry := metrics.NewMetrics()
+	upstreamTLS, err := tlsconfig.Client(cfg.OpenAI.ClientCertFile, cfg.OpenAI.ClientKeyFile, cfg.OpenAI.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	var upstreamClient *http.Client
+	if upstreamTLS != nil {
+		upstreamClient = tlsconfig.HTTPClient(upstreamTLS)
+	}
+	var natsConn *nats.Conn
+	if cfg.Queue.Backend == entities.QueueBackendJetStream {
+		natsConn, err = newNATSConn(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to NATS at %s: %w", cfg.NATS.URL, err)
+		}
+		log.Printf("Sharing queues through JetStream stream %s at %s", cfg.NATS.Stream, cfg.NATS.URL)
+	}
+	// Hedges and content filter fallbacks draw on one retry budget
+	var retryBudget *queue.RetryBudget
+	if cfg.RetryBudget.Percent > 0 {
+		retryBudget = queue.NewRetryBudget(cfg.RetryBudget.Percent, cfg.RetryBudget.MinPerMinute, metricsRegistry)
+	}
+	// Hedges skip the upstreams the prober finds unreachable
+	var prober *probe.Prober
+	var upstreamHealth queue.UpstreamHealth
+	if cfg.Probe.Interval > 0 {
+		prober = newProber(cfg, upstreamClient, metricsRegistry)
+		useKey(prober)
+		prober.Start()
+		upstreamHealth = prober
+	}
+	// Requests in the JetStream stream carry no upstream keys; the replica
+	// consuming them looks up their tenants' keys
+	var streamKeys jetstream.KeySetter
+	if cfg.Tenants.Mode != "" {
+		streamKeys = tenant.NewUpstreamKeys(nil, storage)
+	}
+	queueInstance, namedQueues, routes, err := newQueues(cfg, metricsRegistry, upstreamClient, useKey, natsConn, streamKeys, retryBudget, upstreamHealth)
+	if err != nil {
+		if natsConn != nil {
+			natsConn.Close()
+		}
+		return nil, err
+	}
+
+	// The history observes each queue's own responses, below the router
+	var queueHistory *queue.History
+	var defaultTarget queue.Pusher = queueInstance
+	targets := make(map[string]queue.Pusher, len(namedQueues))
+	for name, q := range namedQueues {
+		targets[name] = q
+	}
+	if cfg.Queue.HistoryMinutes > 0 {
+		sources := map[string]queue.StatsSource{"default": queueInstance}
+		for name, q := range namedQueues {
+			sources[name] = q
+		}
+		queueHistory = queue.NewHistory(sources, cfg.Queue.HistoryMinutes, 5*time.Second)
+		queueHistory.Start()
+		defaultTarget = queueHistory.Observe("default", queueInstance)
+		for name, q := range targets {
+			targets[name] = queueHistory.Observe(name, q)
+		}
+	}
+
+	// Wrap the queues in the router and the configured decorators: cache hits
+	// short-circuit before identical in-flight requests are coalesced
+	var proxyQueue handlers.Queue = defaultTarget
+	if len(routes) > 0 {
+		router, err := queue.NewRouter(defaultTarget, targets, routes)
+		if err != nil {
+			return nil, err
+		}
+		proxyQueue = router
+	} else if len(namedQueues) > 0 {
+		log.Printf("Warning: QUEUES defines named queues but QUEUE_ROUTES is empty, all requests use the default queue")
+	}
+	// Fixtures stand in for the upstream, so everything above them behaves as in production
+	switch cfg.Fixtures.Mode {
+	case entities.FixtureModeRecord:
+		log.Printf("Recording upstream responses as fixtures in %s", cfg.Fixtures.Dir)
+		proxyQueue = fixture.NewRecorder(proxyQueue, fixture.NewDirStore(cfg.Fixtures.Dir))
+	case entities.FixtureModeReplay:
+		log.Printf("Replaying fixtures from %s instead of calling the upstream", cfg.Fixtures.Dir)
+		proxyQueue = fixture.NewPlayer(fixture.NewDirStore(cfg.Fixtures.Dir))
+	}
+	// Tenants are resolved before anything else sees the request; their
+	// upstream keys are applied just before it is sent
+	var tenantResolver *tenant.Resolver
+	var tenants *tenant.Service
+	if cfg.Tenants.Mode != "" {
+		if cfg.Repository.Type != "sqlite" {
+			log.Printf("Warning: with the %s repository, tenants and their keys are lost on restart", cfg.Repository.Type)
+		}
+		tenantResolver = tenant.NewResolver(storage, entities.TenantSettings{
+			Mode:             cfg.Tenants.Mode,
+			Header:           cfg.Tenants.Header,
+			SignatureMaxSkew: cfg.Tenants.SignatureMaxSkew,
+			MaxBodyBytes:     signedBodyLimit(cfg.HTTP.MaxBodyBytes, cfg.HTTP.MaxUploadBytes),
+		}).WithResidency(cfg.Tenants.UpstreamRegions["primary"])
+		tenants = tenant.NewService(storage)
+		proxyQueue = tenant.NewUpstreamKeys(proxyQueue, storage)
+	}
+	// Sessions are throttled just before their requests are queued, so cache
+	// hits and coalesced duplicates cost them nothing
+	if len(cfg.Throttle.Tiers) > 0 {
+		tiers, err := throttle.ParseTiers(cfg.Throttle.Tiers)
+		if err != nil {
+			return nil, err
+		}
+		proxyQueue = throttle.NewSessionThrottle(proxyQueue, tiers, metricsRegistry)
+	}
+	// Sessions blocked for their budget are rejected before they are throttled
+	var budgetEnforcer *budget.Enforcer
+	if budgetLedger != nil && len(cfg.Tokens.BudgetOverdrafts) > 0 {
+		overdrafts, err := budget.ParseOverdrafts(cfg.Tokens.BudgetOverdrafts)
+		if err != nil {
+			return nil, err
+		}
+		budgetEnforcer = budget.NewEnforcer(proxyQueue, budgetLedger, sessionManager, overdrafts, metricsRegistry)
+		proxyQueue = budgetEnforcer
+	}
+	// Throttled requests count as queued for the session's cap
+	if cfg.Queue.MaxPerSession > 0 {
+		proxyQueue = queue.NewSessionCap(proxyQueue, cfg.Queue.MaxPerSession, metricsRegistry)
+	}
+	// Only upstream responses count towards the error rate, not cache hits or shadow traffic
+	if alertsCfg.ErrorRate > 0 {
+		proxyQueue = alert.NewErrorRateMonitor(proxyQueue, alerts, alertsCfg.ErrorRate, alertsCfg.ErrorRateWindow, alertsCfg.ErrorRateMinRequests)
+	}
+	var queueDepthMonitor *alert.QueueDepthMonitor
+	if alertsCfg.QueueDepth > 0 {
+		depths := map[string]alert.DepthReporter{"default": queueInstance}
+		for name, q := range namedQueues {
+			depths[name] = q
+		}
+		queueDepthMonitor = alert.NewQueueDepthMonitor(depths, alerts, alertsCfg.QueueDepth, alertsCfg.QueueDepthDuration, time.Second)
+		queueDepthMonitor.Start()
+	}
+	var anomalyDetector *alert.AnomalyDetector
+	if alertsCfg.AnomalyInterval > 0 {
+		anomalyDetector = alert.NewAnomalyDetector(storage, alerts, entities.AnomalySettings{
+			ZScore:     alertsCfg.AnomalyZScore,
+			MinTokens:  alertsCfg.AnomalyMinTokens,
+			MinSamples: alertsCfg.AnomalyMinSamples,
+			Alpha:      alertsCfg.AnomalyAlpha,
+		}, alertsCfg.AnomalyInterval)
+		if leader != nil {
+			anomalyDetector.SetLeader(leader)
+		}
+		anomalyDetector.Start()
+	}
+	var shadowQueue *queue.Queue
+	var shadowResults repository.ShadowRepository
+	if cfg.Shadow.Percent > 0 {
+		shadowQueue = newShadowQueue(cfg, metricsRegistry)
+		// A shadow upstream of its own is not sent the client certificate
+		if upstreamClient != nil && cfg.Shadow.BaseURL == "" {
+			shadowQueue.SetHTTPClient(upstreamClient)
+		}
+		if cfg.Shadow.APIKey == "" {
+			useKey(shadowQueue)
+		}
+		var store shadow.Store
+		if cfg.Shadow.StoreResults {
+			shadowResults = storage
+			store = storage
+		}
+		proxyQueue = shadow.NewMirror(proxyQueue, shadowQueue, store, entities.ShadowSettings{
+			Percent: cfg.Shadow.Percent,
+			Model:   cfg.Shadow.Model,
+			Paths:   cfg.Shadow.Paths,
+			Region:  upstreamRegion(cfg, "shadow", cfg.Shadow.BaseURL),
+		})
+	}
+	if cfg.Cache.DedupEnabled {
+		proxyQueue = dedup.NewDeduplicator(proxyQueue)
+	}
+	var embeddingCache *cache.EmbeddingCache
+	if cfg.Cache.EmbeddingsEnabled {
+		embeddingCache = cache.NewEmbeddingCache(proxyQueue, storage)
+		proxyQueue = embeddingCache
+	}
+	// Model lists are merged across the upstreams requests may be sent to
+	prices := pricing.NewTable(cfg.Pricing.Prices)
+	// With fixtures, the model list is recorded and replayed like any other response
+	if upstreams := modelUpstreams(cfg, upstreamClient); len(upstreams) > 1 && cfg.Models.CacheTTL > 0 && cfg.Fixtures.Mode == "" {
+		aggregator := models.NewAggregator(proxyQueue, upstreams, cfg.OpenAI.APIKey, prices, cfg.Models.CacheTTL, cfg.Models.Timeout)
+		useKey(aggregator)
+		proxyQueue = aggregator
+	}
+
+	// Errors are classified before the content filter fallback inspects them
+	proxyQueue = upstreamerr.NewClassifier(proxyQueue, metricsRegistry, cfg.UpstreamErrors.Normalize)
+
+	// Retries are recorded with the response the client receives
+	if fallbackCfg := cfg.ContentFallback; fallbackCfg.Model != "" || fallbackCfg.SystemPrompt != "" {
+		retrier := fallback.NewContentRetrier(proxyQueue, entities.ContentFallbackSettings{
+			Model:        fallbackCfg.Model,
+			SystemPrompt: fallbackCfg.SystemPrompt,
+			Codes:        fallbackCfg.Codes,
+		})
+		if retryBudget != nil {
+			retrier.WithRetryBudget(retryBudget)
+		}
+		proxyQueue = retrier
+	}
+
+	// Requests are recorded with the model chosen by A/B routing
+	var requestHistory repository.HistoryRepository
+	var capturePurger *history.Purger
+	var capturer *history.Capturer
+	if cfg.History.Enabled {
+		requestHistory = storage
+		recorder := history.NewRecorder(proxyQueue, requestHistory)
+		if cfg.History.Capture != "" {
+			capturer = history.NewCapturer(entities.CaptureSettings{
+				Mode:         cfg.History.Capture,
+				MaxBytes:     cfg.History.CaptureMaxBytes,
+				PreviewBytes: cfg.History.CapturePreviewBytes,
+				Tenants:      cfg.History.CaptureTenants,
+				RedactFields: cfg.History.CaptureRedactFields,
+			})
+			recorder.SetCapturer(capturer)
+			if cfg.History.CaptureRetention > 0 {
+				capturePurger = history.NewPurger(storage, cfg.History.CaptureRetention)
+				if leader != nil {
+					capturePurger.SetLeader(leader)
+				}
+				capturePurger.Start()
+			}
+		}
+		proxyQueue = recorder
+	}
+
+	// Transcripts hold the prompts as scrubbed by the request filters
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var transcripts repository.TranscriptRepository
+	if cfg.Transcript.Enabled {
+		transcripts = storage
+		recorder := transcript.NewRecorder(proxyQueue, transcripts, storage, entities.TranscriptSettings{
+			SessionTags:  cfg.Transcript.SessionTags,
+			RedactFields: cfg.Transcript.RedactFields,
+		})
+		if redactor != nil {
+			recorder.WithScrubber(redactor)
+		}
+		proxyQueue = recorder
+	}
+
+	// A/B routing is applied first so caching and routing see the variant's model
+	var modelSplitter *experiment.Splitter
+	if len(cfg.Experiments.ModelSplits) > 0 {
+		splits, err := experiment.ParseSplits(cfg.Experiments.ModelSplits)
+		if err != nil {
+			return nil, err
+		}
+		modelSplitter = experiment.NewSplitter(proxyQueue, sessionManager, splits)
+		proxyQueue = modelSplitter
+	}
+	// Residency is enforced before any decorator can send a request upstream,
+	// and sets the residency the shadow mirror and hedges are checked against
+	if cfg.Tenants.Mode != "" {
+		proxyQueue = tenant.NewResidency(proxyQueue, storage, cfg.Tenants.UpstreamRegions["primary"])
+	}
+	// Faults are injected outside every other decorator, so the client gets
+	// them exactly as configured
+	var faultInjector *chaos.Injector
+	if cfg.Chaos.Enabled {
+		log.Printf("Warning: fault injection is enabled, the admin API can make requests fail")
+		faultInjector = chaos.NewInjector(proxyQueue, metricsRegistry)
+		proxyQueue = faultInjector
+	}
+
+	transformHook := newTransformHook(cfg)
+	requestFilters, err := newRequestFilters(cfg, redactor, requestHistory, useKey, transformHook, queueInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	var usageReporter *billing.Reporter
+	if billingCfg := cfg.Billing; billingCfg.StripeAPIKey != "" {
+		if cfg.Repository.Type != "sqlite" {
+			log.Printf("Warning: with the %s repository, usage not yet reported to Stripe is lost on restart", cfg.Repository.Type)
+		}
+		meter := billing.NewStripeMeter(billingCfg.StripeBaseURL, billingCfg.StripeAPIKey, &http.Client{Timeout: billingCfg.Timeout})
+		usageReporter = billing.NewReporter(storage, meter, entities.MeteringSettings{
+			EventName:           billingCfg.MeterEventName,
+			CustomerMetadataKey: billingCfg.CustomerMetadataKey,
+		}, billingCfg.ReportInterval, billingCfg.Timeout)
+		if leader != nil {
+			usageReporter.SetLeader(leader)
+		}
+		usageReporter.Start()
+	}
+
+	var keyWatcher *secrets.Watcher
+	if keySource != nil && cfg.Secrets.RefreshInterval > 0 {
+		keyWatcher = secrets.NewWatcher(keySource, cfg.OpenAI.APIKey, cfg.Secrets.RefreshInterval, cfg.Secrets.Timeout, keyConsumers...)
+		keyWatcher.Start()
+	}
+
+	maintenanceMode := maintenance.NewMode()
+	// Jobs not yet in the queue, including Kafka records, wait out maintenance
+	jobRunner := jobs.NewRunner(storage, proxyQueue, sessionManager).WithMaintenance(maintenanceMode)
+	// Replicas sharing the repository recover only the jobs they submitted, so a
+	// restarting replica leaves its live peers' jobs alone
+	if cfg.Coordination.LeaderElection {
+		jobRunner.WithOwner(instanceID(cfg))
+	}
+	threads := assistants.NewTracker(storage, cfg.Assistants.ThreadSessions)
+	if err := recoverJobs(jobRunner, cfg); err != nil {
+		return nil, fmt.Errorf("failed to recover pending jobs: %w", err)
+	}
+	var kafkaConsumer *kafka.Consumer
+	if cfg.Kafka.RESTURL != "" {
+		kafkaConsumer = kafka.NewConsumer(entities.KafkaSettings{
+			RESTURL:     cfg.Kafka.RESTURL,
+			Username:    cfg.Kafka.Username,
+			Password:    cfg.Kafka.Password,
+			Group:       cfg.Kafka.Group,
+			InputTopic:  cfg.Kafka.InputTopic,
+			OutputTopic: cfg.Kafka.OutputTopic,
+			Concurrency: cfg.Kafka.Concurrency,
+			PollTimeout: cfg.Kafka.PollTimeout,
+		}, jobRunner, metricsRegistry, http.DefaultClient)
+		// Records get the tenant resolution and request filters of HTTP requests
+		if tenantResolver != nil {
+			kafkaConsumer.WithTenants(tenantResolver)
+		}
+		kafkaFilters := make([]kafka.RequestFilter, len(requestFilters))
+		for i, filter := range requestFilters {
+			kafkaFilters[i] = filter
+		}
+		kafkaConsumer.WithFilters(kafkaFilters...)
+		kafkaConsumer.Start()
+	}
+	fineTunes := finetune.NewTracker(storage, proxyQueue, sessionManager, prices, cfg.FineTuning.PollInterval)
+	if leader != nil {
+		fineTunes.SetLeader(leader)
+	}
+	fineTunes.Start()
+
+	// Replays through the proxy are recorded by its history recorder; those
+	// sent straight to the shadow upstream get a recorder of their own
+	var replayer *history.Replayer
+	if requestHistory != nil {
+		targets := map[string]history.Queue{history.PrimaryUpstream: proxyQueue}
+		if shadowQueue != nil {
+			shadowRecorder := history.NewRecorder(shadowQueue, requestHistory)
+			if capturer != nil {
+				shadowRecorder.SetCapturer(capturer)
+			}
+			targets["shadow"] = shadowRecorder
+		}
+		replayer = history.NewReplayer(requestHistory, targets)
+	}
+
+	var pruner *retention.Pruner
+	retentionPolicy := entities.RetentionPolicy{
+		RequestHistory: cfg.Retention.History,
+		Jobs:           cfg.Retention.Jobs,
+		Sessions:       cfg.Retention.Sessions,
+	}
+	if retentionPolicy.Enabled() {
+		pruner = retention.NewPruner(storage, retentionPolicy, metricsRegistry, cfg.Retention.PruneInterval)
+		if leader != nil {
+			pruner.SetLeader(leader)
+		}
+		pruner.Start()
+	}
+
+	return &App{
+		Config:            cfg,
+		BuildInfo:         buildinfo.Get(),
+		Repository:        storage,
+		SessionManager:    sessionManager,
+		Queue:             queueInstance,
+		NamedQueues:       namedQueues,
+		NATS:              natsConn,
+		ShadowQueue:       shadowQueue,
+		ModelSplitter:     modelSplitter,
+		FaultInjector:     faultInjector,
+		ShadowResults:     shadowResults,
+		RequestHistory:    requestHistory,
+		Replayer:          replayer,
+		CapturePurger:     capturePurger,
+		Metrics:           metricsRegistry,
+		EmbeddingCache:    embeddingCache,
+		ProxyQueue:        proxyQueue,
+		JobRunner:         jobRunner,
+		Redactor:          redactor,
+		RequestFilters:    requestFilters,
+		ResponseFilters:   newResponseFilters(cfg, transformHook, budgetLedger, sessionManager),
+		UsageReporter:     usageReporter,
+		KeyWatcher:        keyWatcher,
+		Alerts:            alerts,
+		QueueDepthMonitor: queueDepthMonitor,
+		AnomalyDetector:   anomalyDetector,
+		Budgets:           budgetLedger,
+		BudgetEnforcer:    budgetEnforcer,
+		Maintenance:       maintenanceMode,
+		QueueHistory:      queueHistory,
+		Prober:            prober,
+		IPRules:           ipRules,
+		IPLimiter:         ipLimiter,
+		Threads:           threads,
+		ThreadSessions:    storage,
+		Summaries:         storage,
+		Transcripts:       transcripts,
+		Pricing:           prices,
+		FineTunes:         fineTunes,
+		Pruner:            pruner,
+		Leader:            leader,
+		KafkaConsumer:     kafkaConsumer,
+		TenantResolver:    tenantResolver,
+		Affinity:          affinityRouter,
+		Tenants:           tenants,
+		Authorizer:        newAuthorizer(cfg),
+	}, nil
+}
+
+// newAlertDispatcher creates the dispatcher sending alerts to the webhooks from
+// ALERT_WEBHOOK_URLS and ALERT_SLACK_WEBHOOK_URLS. Without webhooks alerts are only logged.
+func newAlertDispatcher(cfg *config.Config) *alert.Dispatcher {
+	client := &http.Client{Timeout: cfg.Alerts.Timeout}
+	var notifiers []alert.Notifier
+	for _, url := range cfg.Alerts.WebhookURLs {
+		notifiers = append(notifiers, alert.NewWebhookNotifier(url, alert.FormatJSON, client))
+	}
+	for _, url := range cfg.Alerts.SlackWebhookURLs {
+		notifiers = append(notifiers, alert.NewWebhookNotifier(url, alert.FormatSlack, client))
+	}
+	if len(notifiers) == 0 {
+		log.Printf("Warning: alerts are enabled but no ALERT_WEBHOOK_URLS or ALERT_SLACK_WEBHOOK_URLS are set, alerts are only logged")
+	}
+	return alert.NewDispatcher(notifiers, cfg.Alerts.Cooldown, cfg.Alerts.Timeout)
+}
+
+// newIPRules parses the client IP allowlists and denylists
+func newIPRules(cfg *config.Config) (entities.IPRules, error) {
+	var rules entities.IPRules
+	for _, list := range []struct {
+		values []string
+		dst    *[]netip.Prefix
+	}{
+		{cfg.HTTP.AllowedCIDRs, &rules.Allowed},
+		{cfg.Admin.AllowedCIDRs, &rules.AdminAllowed},
+		{cfg.HTTP.DeniedCIDRs, &rules.Denied},
+		{cfg.HTTP.TrustedProxyCIDRs, &rules.TrustedProxies},
+	} {
+		prefixes, err := middleware.ParsePrefixes(list.values)
+		if err != nil {
+			return entities.IPRules{}, err
+		}
+		*list.dst = prefixes
+	}
+	return rules, nil
+}
+
+// newKeySource returns where the OpenAI API key is read from when it is not
+// set directly: SECRETS_PROVIDER takes precedence over OPENAI_API_KEY_FILE.
+// It returns nil if the key comes from OPENAI_API_KEY.
+func newKeySource(cfg *config.Config) (secrets.Source, error) {
+	secretsCfg := cfg.Secrets
+	client := &http.Client{Timeout: secretsCfg.Timeout}
+	switch secretsCfg.Provider {
+	case "vault":
+		log.Printf("Reading the OpenAI API key from Vault at %s", secretsCfg.VaultAddr)
+		return secrets.NewVaultSource(secretsCfg.VaultAddr, secretsCfg.VaultToken, secretsCfg.VaultPath, secretsCfg.Field, client), nil
+	case "aws":
+		log.Printf("Reading the OpenAI API key from AWS Secrets Manager secret %s", secretsCfg.AWSSecretID)
+		return secrets.NewAWSSource(secretsCfg.AWSRegion, secretsCfg.AWSEndpoint, secretsCfg.AWSSecretID, secretsCfg.Field, entities.AWSCredentials{
+			AccessKeyID:     secretsCfg.AWSAccessKeyID,
+			SecretAccessKey: secretsCfg.AWSSecretAccessKey,
+			SessionToken:    secretsCfg.AWSSessionToken,
+		}, client), nil
+	case "":
+		if cfg.OpenAI.APIKeyFile != "" {
+			return secrets.NewFileSource(cfg.OpenAI.APIKeyFile), nil
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q", secretsCfg.Provider)
+	}
+}
+
+// NewStorage creates the repository backend selected by REPOSITORY_TYPE and
+// initializes it, creating or upgrading its schema.
+func NewStorage(cfg *config.Config) (repository.Storage, error) {
+	var storage repository.Storage
 
 	log.Printf("Initializing session repository with type: %s", cfg.Repository.Type)
 
 	switch cfg.Repository.Type {
 	case "sqlite":
-		repo, err = repository.NewSQLiteRepository(cfg.Repository.SQLiteDSN)
+		sqliteRepo, err := repository.NewSQLiteRepository(cfg.Repository.SQLiteDSN)
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize SQLite repository: %w", err)
 		}
+		storage = sqliteRepo
 	case "memory":
 		fallthrough
 	default:
-		repo = repository.NewMemoryRepository()
+		storage = repository.NewMemoryRepository()
 	}
 
-	// Initialize repository
-	if err := repo.Init(); err != nil {
+	if err := storage.Init(); err != nil {
 		return nil, fmt.Errorf("failed to initialize repository: %w", err)
 	}
+	return storage, nil
+}
 
-	// Create session manager with repository dependency
-	sessionManager := session.NewSessionManager(repo)
+// newAffinityRouter creates the router pinning sessions to replicas, or nil
+// unless STICKY_SESSIONS or REPLICA_FORWARDING is set
+func newAffinityRouter(cfg *config.Config) (*affinity.Router, error) {
+	affinityCfg := cfg.Affinity
+	if !affinityCfg.StickySessions && !affinityCfg.Forwarding {
+		return nil, nil
+	}
+	replicas, err := affinity.ParseReplicas(affinityCfg.Replicas)
+	if err != nil {
+		return nil, err
+	}
+	return affinity.NewRouter(entities.AffinitySettings{
+		Header:   affinityCfg.Header,
+		Cookie:   affinityCfg.Cookie,
+		Replicas: replicas,
+		Self:     affinityCfg.Self,
+		Forward:  affinityCfg.Forwarding,
+		Secret:   affinityCfg.Secret,
+	}, http.DefaultTransport), nil
+}
 
-	// Create queue with config dependency
-	queueInstance := queue.NewQueue(cfg.OpenAI.RateLimitPerMin, cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey)
+// instanceID names this instance in leases and on the jobs it runs:
+// INSTANCE_ID, or the hostname and process ID, which differ between replicas
+// on one host
+func instanceID(cfg *config.Config) string {
+	if cfg.Coordination.InstanceID != "" {
+		return cfg.Coordination.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
 
-	return &App{
-		Config:         cfg,
-		Repository:     repo,
-		SessionManager: sessionManager,
-		Queue:          queueInstance,
-	}, nil
+// newQueues creates the default queue, the named queues from QUEUES and one
+// queue per RATE_LIMIT_OVERRIDES endpoint, along with the routes between them.
+// Explicit QUEUE_ROUTES take precedence over endpoint overrides.
+func newQueues(cfg *config.Config, metricsRegistry *metrics.Metrics, client *http.Client, useKey func(secrets.KeyConsumer),
+	natsConn *nats.Conn, streamKeys jetstream.KeySetter, retries *queue.RetryBudget, upstreams queue.UpstreamHealth) (entities.RequestQueue, map[string]entities.RequestQueue, []entities.QueueRoute, error) {
+	queueConfigs, err := queue.ParseQueueConfigs(cfg.Queue.Named)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	routes, err := queue.ParseRoutes(cfg.Queue.Routes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	endpointConfigs, endpointRoutes := queue.EndpointQueues(cfg.OpenAI.RateLimitOverrides)
+	queueConfigs = append(queueConfigs, endpointConfigs...)
+	routes = append(routes, endpointRoutes...)
+	streams := queue.NewStreamLimiter(routes)
+	// Validate has checked the time zone
+	location, _ := time.LoadLocation(cfg.Queue.ScheduleTimezone)
+	schedules, err := queue.ParseSchedules(cfg.Queue.Schedules, location)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	hedge := entities.HedgeConfig{
+		After:   cfg.Hedge.After,
+		BaseURL: cfg.Hedge.BaseURL,
+		APIKey:  cfg.Hedge.APIKey,
+		Paths:   cfg.Hedge.Paths,
+		Region:  upstreamRegion(cfg, "hedge", cfg.Hedge.BaseURL),
+	}
+	priority := entities.PriorityPolicy{Boost: cfg.Queue.PriorityBoost, SmallPromptTokens: cfg.Queue.PrioritySmallTokens}
+	exempt := entities.RateLimitExemptions{Sessions: cfg.Queue.ExemptSessions, VirtualKeys: cfg.Queue.ExemptVirtualKeys}
+	for i := range queueConfigs {
+		queueConfigs[i].Hedge = hedge
+		queueConfigs[i].Priority = priority
+		queueConfigs[i].Exempt = exempt
+		queueConfigs[i].Schedule = schedules[queueConfigs[i].Name]
+	}
+
+	defaultConfig := entities.QueueConfig{Name: "default", RequestsPerMinute: cfg.OpenAI.RateLimitPerMin, Hedge: hedge, Priority: priority,
+		Schedule: schedules["default"], Exempt: exempt}
+	for name := range schedules {
+		if name != defaultConfig.Name && !slices.ContainsFunc(queueConfigs, func(qc entities.QueueConfig) bool { return qc.Name == name }) {
+			return nil, nil, nil, fmt.Errorf("queue schedule references unknown queue %q", name)
+		}
+	}
+	// Token estimates serve the TPM limits and the ranking of small prompts
+	countsTokens := priority.Boost > 0
+	for _, qc := range queueConfigs {
+		if qc.Name == defaultConfig.Name {
+			defaultConfig = qc
+		}
+		countsTokens = countsTokens || qc.TokensPerMinute > 0
+	}
+	for _, windows := range schedules {
+		for _, window := range windows {
+			countsTokens = countsTokens || window.TokensPerMinute > 0
+		}
+	}
+	var counter queue.TokenCounter
+	if countsTokens {
+		counter = tokenizer.NewEstimator()
+	}
+
+	namedQueues := make(map[string]entities.RequestQueue)
+	for _, qc := range queueConfigs {
+		if qc.Name == defaultConfig.Name {
+			continue
+		}
+		log.Printf("Creating queue %s: %d RPM, %d TPM, %d workers, %d scheduled windows", qc.Name, qc.RequestsPerMinute, qc.TokensPerMinute, qc.Workers, len(qc.Schedule))
+		namedQueue, err := newQueueBackend(cfg, qc, counter, streams, retries, upstreams, metricsRegistry, client, useKey, natsConn, streamKeys)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		namedQueues[qc.Name] = namedQueue
+	}
+	defaultQueue, err := newQueueBackend(cfg, defaultConfig, counter, streams, retries, upstreams, metricsRegistry, client, useKey, natsConn, streamKeys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return defaultQueue, namedQueues, routes, nil
+}
+
+// newQueueBackend creates a queue of the QUEUE_BACKEND implementation. Other
+// backends implement entities.RequestQueue and are created here.
+func newQueueBackend(cfg *config.Config, qc entities.QueueConfig, counter queue.TokenCounter, streams *queue.StreamLimiter,
+	retries *queue.RetryBudget, upstreams queue.UpstreamHealth, metricsRegistry *metrics.Metrics,
+	client *http.Client, useKey func(secrets.KeyConsumer), natsConn *nats.Conn, streamKeys jetstream.KeySetter) (entities.RequestQueue, error) {
+	newLocal := func(qc entities.QueueConfig) *queue.Queue {
+		q := queue.NewNamedQueue(qc, cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey, cfg.Queue.MaxAge, counter, metricsRegistry)
+		if client != nil {
+			q.SetHTTPClient(client)
+		}
+		q.SetStreamLimiter(streams)
+		q.SetRetryBudget(retries)
+		q.SetUpstreamHealth(upstreams)
+		useKey(q)
+		return q
+	}
+	switch cfg.Queue.Backend {
+	case entities.QueueBackendMemory, entities.QueueBackendDurable:
+		// Both dispatch from memory; durability is the recovery of async jobs
+		return newLocal(qc), nil
+	case entities.QueueBackendJetStream:
+		q, err := jetstream.NewQueue(natsConn, qc, newLocal(jetstream.LocalConfig(qc)), entities.JetStreamSettings{
+			Stream:       cfg.NATS.Stream,
+			Subject:      cfg.NATS.Subject,
+			AckWait:      cfg.NATS.AckWait,
+			ReplyTimeout: cfg.NATS.ReplyTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if streamKeys != nil {
+			q.WithUpstreamKeys(streamKeys)
+		}
+		if err := q.Start(); err != nil {
+			q.Close()
+			return nil, fmt.Errorf("failed to start JetStream queue %s: %w", qc.Name, err)
+		}
+		return q, nil
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Queue.Backend)
+	}
+}
+
+// newNATSConn connects to the NATS server of the jetstream queue backend,
+// reconnecting for as long as the proxy runs
+func newNATSConn(cfg *config.Config) (*nats.Conn, error) {
+	opts := []nats.Option{nats.Name("llm-queue-proxy"), nats.MaxReconnects(-1)}
+	if cfg.NATS.Token != "" {
+		opts = append(opts, nats.Token(cfg.NATS.Token))
+	}
+	if cfg.NATS.User != "" {
+		opts = append(opts, nats.UserInfo(cfg.NATS.User, cfg.NATS.Password))
+	}
+	return nats.Connect(cfg.NATS.URL, opts...)
+}
+
+// modelUpstreams returns the upstreams whose models can be requested: the
+// primary one and a hedge target of its own
+func modelUpstreams(cfg *config.Config, upstreamClient *http.Client) []entities.UpstreamTarget {
+	upstreams := []entities.UpstreamTarget{{Name: "primary", BaseURL: cfg.OpenAI.BaseURL, Client: upstreamClient}}
+	if cfg.Hedge.After > 0 && cfg.Hedge.BaseURL != "" && cfg.Hedge.BaseURL != cfg.OpenAI.BaseURL {
+		upstreams = append(upstreams, entities.UpstreamTarget{Name: "hedge", BaseURL: cfg.Hedge.BaseURL, APIKey: cfg.Hedge.APIKey})
+	}
+	return upstreams
+}
+
+// upstreamRegion returns the region of an upstream from UPSTREAM_REGIONS. An
+// upstream without a base URL of its own is the primary one.
+func upstreamRegion(cfg *config.Config, name, baseURL string) string {
+	if baseURL == "" || baseURL == cfg.OpenAI.BaseURL {
+		name = "primary"
+	}
+	return cfg.Tenants.UpstreamRegions[name]
+}
+
+// newProber creates the health prober of the primary upstream and, when they
+// have base URLs of their own, the hedge and shadow targets
+func newProber(cfg *config.Config, upstreamClient *http.Client, metricsRegistry *metrics.Metrics) *probe.Prober {
+	targets := []entities.UpstreamTarget{{Name: "primary", BaseURL: cfg.OpenAI.BaseURL, Client: upstreamClient}}
+	if cfg.Hedge.After > 0 && cfg.Hedge.BaseURL != "" {
+		targets = append(targets, entities.UpstreamTarget{Name: "hedge", BaseURL: cfg.Hedge.BaseURL, APIKey: cfg.Hedge.APIKey})
+	}
+	if cfg.Shadow.Percent > 0 && cfg.Shadow.BaseURL != "" {
+		targets = append(targets, entities.UpstreamTarget{Name: "shadow", BaseURL: cfg.Shadow.BaseURL, APIKey: cfg.Shadow.APIKey})
+	}
+	return probe.NewProber(targets, cfg.OpenAI.APIKey, cfg.Probe.Path, cfg.Probe.Interval, cfg.Probe.Timeout, cfg.Probe.Failures, metricsRegistry)
+}
+
+// newShadowQueue creates the queue mirrored requests are sent through, so
+// shadow traffic has its own rate limit and never delays production requests
+func newShadowQueue(cfg *config.Config, metricsRegistry *metrics.Metrics) *queue.Queue {
+	baseURL, apiKey := cfg.Shadow.BaseURL, cfg.Shadow.APIKey
+	if baseURL == "" {
+		baseURL = cfg.OpenAI.BaseURL
+	}
+	if apiKey == "" {
+		apiKey = cfg.OpenAI.APIKey
+	}
+	log.Printf("Mirroring %.1f%% of requests to %s", cfg.Shadow.Percent, baseURL)
+	return queue.NewNamedQueue(entities.QueueConfig{Name: "shadow", RequestsPerMinute: cfg.Shadow.RateLimitPerMin},
+		baseURL, apiKey, cfg.Shadow.MaxAge, nil, metricsRegistry)
+}
+
+// recoverJobs handles async jobs left pending by a previous process of this
+// instance: with a durable queue they are re-dispatched, otherwise they are
+// marked as failed.
+func recoverJobs(runner *jobs.Runner, cfg *config.Config) error {
+	if cfg.Queue.Durable || cfg.Queue.Backend == entities.QueueBackendDurable {
+		if cfg.Repository.Type != "sqlite" {
+			log.Printf("Warning: the durable queue has no effect with the %s repository", cfg.Repository.Type)
+		}
+		resumed, err := runner.Resume()
+		if err != nil {
+			return err
+		}
+		if resumed > 0 {
+			log.Printf("Re-dispatched %d pending jobs", resumed)
+		}
+		return nil
+	}
+
+	failed, err := runner.FailPending("interrupted by proxy restart")
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		log.Printf("Marked %d interrupted jobs as failed (set QUEUE_BACKEND=durable to re-dispatch them)", failed)
+	}
+	return nil
 }
 
 // Close cleans up all dependencies
 func (a *App) Close() error {
+	if a.KeyWatcher != nil {
+		a.KeyWatcher.Close()
+	}
+	// Stopped before the queues its records are sent through
+	if a.KafkaConsumer != nil {
+		a.KafkaConsumer.Close()
+	}
+	if a.QueueDepthMonitor != nil {
+		a.QueueDepthMonitor.Close()
+	}
+	if a.AnomalyDetector != nil {
+		a.AnomalyDetector.Close()
+	}
+	if a.QueueHistory != nil {
+		a.QueueHistory.Close()
+	}
+	if a.Prober != nil {
+		a.Prober.Close()
+	}
+	if a.UsageReporter != nil {
+		a.UsageReporter.Close()
+	}
+	if a.FineTunes != nil {
+		a.FineTunes.Close()
+	}
+	if a.Pruner != nil {
+		a.Pruner.Close()
+	}
+	if a.CapturePurger != nil {
+		a.CapturePurger.Close()
+	}
+	// Released after the tasks it gates have stopped
+	if a.Leader != nil {
+		a.Leader.Close()
+	}
+	if a.Alerts != nil {
+		a.Alerts.Close()
+	}
 	if a.Queue != nil {
 		a.Queue.Close()
 	}
+	for _, q := range a.NamedQueues {
+		q.Close()
+	}
+	if a.ShadowQueue != nil {
+		a.ShadowQueue.Close()
+	}
+	// Closed after the queues, which reply and acknowledge through it
+	if a.NATS != nil {
+		a.NATS.Close()
+	}
 	if a.SessionManager != nil {
 		if err := a.SessionManager.Close(); err != nil {
 			return fmt.Errorf("failed to close session manager: %w", err)
@@ -78,18 +1072,567 @@ func (a *App) Close() error {
 // Run starts the HTTP server and registers handlers.
 // The App instance `a` should be fully initialized before calling Run.
 func (a *App) Run() error {
-	// Create handler with injected dependencies
-	proxyHandler := handlers.NewProxyHandler(a.SessionManager, a.Queue)
-	sessionStatusHandler := handlers.NewSessionStatusHandler(a.SessionManager)
+	log.Printf("llm-queue-proxy %s (commit %s, built %s, %s)",
+		a.BuildInfo.Version, a.BuildInfo.Commit, a.BuildInfo.BuildDate, a.BuildInfo.GoVersion)
 
-	// Setup routes
-	http.HandleFunc("/v1/session/", proxyHandler.Handle)
-	http.HandleFunc("/sessions/status", sessionStatusHandler.HandleSingle)
+	if a.Config.Admin.Port != 0 {
+		if a.Config.Admin.Port == a.Config.HTTP.Port {
+			return fmt.Errorf("ADMIN_PORT must differ from PORT (%d)", a.Config.HTTP.Port)
+		}
+		adminServer := a.NewAdminServer()
+		if a.Config.Admin.Token == "" {
+			log.Printf("Warning: ADMIN_TOKEN is not set, admin endpoints on %s are unauthenticated", adminServer.Addr)
+		}
+		go func() {
+			log.Printf("Starting admin server on %s", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Admin server failed: %v", err)
+			}
+		}()
+	}
+
+	if a.Config.GRPC.Port != 0 {
+		grpcServer, err := a.NewGRPCServer()
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", a.Config.GRPC.Port))
+		if err != nil {
+			return fmt.Errorf("failed to listen on GRPC_PORT: %w", err)
+		}
+		if a.Tenants != nil && a.Config.Admin.Token == "" {
+			log.Printf("Warning: ADMIN_TOKEN is not set, the gRPC KeyService on %s is unauthenticated", listener.Addr())
+		}
+		go func() {
+			log.Printf("Starting gRPC server on %s", listener.Addr())
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Printf("gRPC server failed: %v", err)
+			}
+		}()
+	}
 
-	addr := fmt.Sprintf(":%d", a.Config.HTTP.Port)
-	log.Printf("Starting server on %s", addr)
+	server := a.NewServer()
+	log.Printf("Starting server on %s", server.Addr)
 	log.Printf("Available endpoints:")
 	log.Printf("  - Proxy (session): /v1/session/{sessionID}/...")
+	log.Printf("  - Proxy (passthrough): /v1/...")
 	log.Printf("  - Session stats: /sessions/status")
-	return http.ListenAndServe(addr, nil)
+	log.Printf("  - Build info: /version")
+	return a.listenAndServe(server)
+}
+
+// listenAndServe starts the server with TLS termination when configured:
+// either from certificate files or from Let's Encrypt via autocert.
+func (a *App) listenAndServe(server *http.Server) error {
+	tlsCfg := a.Config.TLS
+	hasCertFiles := tlsCfg.CertFile != "" || tlsCfg.KeyFile != ""
+
+	switch {
+	case hasCertFiles && len(tlsCfg.AutocertHosts) > 0:
+		return errors.New("TLS_CERT_FILE/TLS_KEY_FILE and TLS_AUTOCERT_HOSTS are mutually exclusive")
+	case hasCertFiles:
+		if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+			return errors.New("both TLS_CERT_FILE and TLS_KEY_FILE must be set")
+		}
+		if err := a.requireClientCerts(server); err != nil {
+			return err
+		}
+		log.Printf("TLS enabled with certificate %s", tlsCfg.CertFile)
+		return server.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+	case len(tlsCfg.AutocertHosts) > 0:
+		// Certificates are obtained via the TLS-ALPN-01 challenge, so the
+		// listener must be reachable on port 443 for the configured hosts.
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsCfg.AutocertHosts...),
+			Cache:      autocert.DirCache(tlsCfg.AutocertCacheDir),
+			Email:      tlsCfg.AutocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		if err := a.requireClientCerts(server); err != nil {
+			return err
+		}
+		log.Printf("TLS enabled with autocert for hosts: %v", tlsCfg.AutocertHosts)
+		return server.ListenAndServeTLS("", "")
+	default:
+		return server.ListenAndServe()
+	}
+}
+
+// requireClientCerts enables mutual TLS on a server when TLS_CLIENT_CA_FILE is set
+func (a *App) requireClientCerts(server *http.Server) error {
+	tlsCfg := a.Config.TLS
+	if tlsCfg.ClientCAFile == "" {
+		return nil
+	}
+	if server.TLSConfig == nil {
+		server.TLSConfig = &tls.Config{}
+	}
+	if err := tlsconfig.RequireClientCerts(server.TLSConfig, tlsCfg.ClientCAFile, tlsCfg.ClientAuth == "optional"); err != nil {
+		return err
+	}
+	log.Printf("Mutual TLS enabled (%s) with client CAs from %s", tlsCfg.ClientAuth, tlsCfg.ClientCAFile)
+	return nil
+}
+
+// NewServer creates the public HTTP server with its own mux and configured timeouts.
+// The public mux only exposes proxy and status routes; administrative endpoints
+// live on the separate admin server.
+func (a *App) NewServer() *http.Server {
+	return a.newHTTPServer(fmt.Sprintf(":%d", a.Config.HTTP.Port), a.Handler())
+}
+
+// Handler returns the public routes wrapped in the public middlewares, for
+// serving them from NewServer or from a service embedding the proxy
+func (a *App) Handler() http.Handler {
+	// Create handler with injected dependencies
+	proxyHandler := handlers.NewProxyHandler(a.SessionManager, a.ProxyQueue, entities.ProxySettings{
+		MaxBodyBytes:        a.Config.HTTP.MaxBodyBytes,
+		MaxUploadBytes:      a.Config.HTTP.MaxUploadBytes,
+		HeartbeatInterval:   a.Config.HTTP.SSEHeartbeatInterval,
+		StreamResponseBytes: a.Config.HTTP.StreamResponseBytes,
+		MaxDecodedBytes:     a.Config.HTTP.MaxDecodedBytes,
+		// Responses may echo the prompt the redactor scrubbed
+		OmitResponseBodyLogs: a.Redactor != nil,
+	}, a.RequestFilters...).WithThreads(a.Threads).WithFineTuning(a.FineTunes).WithSessionGroups(a.Repository).
+		WithResponseFilters(a.ResponseFilters...).WithMaintenance(a.Maintenance)
+	// Without prices every request would report a cost of zero
+	if len(a.Config.Pricing.Prices) > 0 {
+		proxyHandler.WithPricing(a.Pricing)
+	}
+	sessionStatusHandler := handlers.NewSessionStatusHandler(a.SessionManager).WithSessionFinder(a.Summaries)
+	if a.Budgets != nil {
+		sessionStatusHandler.WithBudgets(a.Budgets)
+	}
+	if a.BudgetEnforcer != nil {
+		sessionStatusHandler.WithBudgetBlocker(a.BudgetEnforcer)
+	}
+	if a.Transcripts != nil {
+		sessionStatusHandler.WithTranscripts(a.Transcripts)
+	}
+	jobsHandler := handlers.NewJobsHandler(a.JobRunner, entities.ProxySettings{
+		MaxBodyBytes: a.Config.HTTP.MaxBodyBytes,
+	}, a.RequestFilters...).WithMaintenance(a.Maintenance)
+	versionHandler := handlers.NewVersionHandler(a.BuildInfo)
+	estimateHandler := handlers.NewEstimateHandler(tokenizer.NewEstimator(), a.Pricing, a.Config.HTTP.MaxBodyBytes)
+
+	// Setup routes
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/session/", proxyHandler.Handle)
+	mux.HandleFunc("/v1/session/{sessionID}/status", sessionStatusHandler.HandleSingle)
+	mux.HandleFunc("/v1/session/{sessionID}/usage", sessionStatusHandler.HandleUsage)
+	mux.HandleFunc("/v1/session/{sessionID}/budget", sessionStatusHandler.HandleBudget)
+	mux.HandleFunc("/v1/session/{sessionID}/transcript", sessionStatusHandler.HandleTranscript)
+	mux.HandleFunc("/v1/", proxyHandler.Handle) // passthrough without session tracking
+	mux.HandleFunc("/v1/jobs", jobsHandler.HandleSubmit)
+	mux.HandleFunc("/v1/jobs/", jobsHandler.HandleGet)
+	mux.HandleFunc("/v1/estimate", estimateHandler.Handle)
+	mux.HandleFunc("/sessions/status", sessionStatusHandler.HandleSingle)
+	mux.HandleFunc("/version", versionHandler.Handle)
+
+	return middleware.Chain(mux, a.publicMiddlewares()...)
+}
+
+// NewGRPCServer creates the gRPC server with the ProxyService and, in tenant
+// mode, the KeyService. ProxyService calls are served by the public routes
+// with their middlewares; the KeyService requires the admin token. With
+// TLS_CERT_FILE and TLS_KEY_FILE the server uses TLS, and mutual TLS with
+// TLS_CLIENT_CA_FILE, like the public listener.
+func (a *App) NewGRPCServer() (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if tlsCfg := a.Config.TLS; tlsCfg.CertFile != "" && tlsCfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the gRPC server certificate: %w", err)
+		}
+		serverTLS := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if tlsCfg.ClientCAFile != "" {
+			if err := tlsconfig.RequireClientCerts(serverTLS, tlsCfg.ClientCAFile, tlsCfg.ClientAuth == "optional"); err != nil {
+				return nil, err
+			}
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	server := grpc.NewServer(opts...)
+	llmqueueproxyv1.RegisterProxyServiceServer(server, grpcapi.NewProxyServer(a.Handler()))
+	if a.Tenants != nil {
+		llmqueueproxyv1.RegisterKeyServiceServer(server, grpcapi.NewKeyServer(a.Tenants, a.Config.Admin.Token))
+	}
+	return server, nil
+}
+
+// newRequestFilters creates the filters applied to request bodies before they
+// are enqueued. Redaction runs before moderation so the classifier never sees
+// sensitive data, both run before prompt injection so configured prompts are left
+// alone, the transformation hook sees the body as it would be sent, and prompt
+// limits run last so they see the final body. Filters using the OpenAI API key
+// are passed to useKey so they receive rotated keys.
+func newRequestFilters(cfg *config.Config, redactor *redact.Redactor, requestHistory repository.HistoryRepository, useKey func(secrets.KeyConsumer), transformHook *hook.Client,
+	summaryQueue guard.Queue) ([]handlers.RequestFilter, error) {
+	var filters []handlers.RequestFilter
+
+	if cfg.Policies.ParameterPolicies != "" {
+		policies, err := guard.ParseParameterPolicies(cfg.Policies.ParameterPolicies)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, guard.NewParameterPolicyGuard(policies))
+	}
+
+	if redactor != nil {
+		filters = append(filters, redactor)
+	}
+
+	if cfg.Moderation.Enabled {
+		moderationFilter, err := newModerationFilter(cfg, requestHistory, useKey)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, moderationFilter)
+	}
+
+	if cfg.Policies.SystemPrompts != "" {
+		templates, err := guard.ParsePromptTemplates(cfg.Policies.SystemPrompts)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, guard.NewPromptInjector(templates))
+	}
+
+	if transformHook != nil && slices.Contains(cfg.Hooks.Stages, hook.StageRequest) {
+		filters = append(filters, transformHook)
+	}
+
+	tokensCfg := cfg.Tokens
+	if tokensCfg.MaxPromptTokens > 0 || len(tokensCfg.SessionMaxPromptTokens) > 0 || tokensCfg.MaxCompletionTokens > 0 {
+		filters = append(filters, guard.NewPromptGuard(tokenizer.NewEstimator(), entities.PromptLimits{
+			MaxPromptTokens:        tokensCfg.MaxPromptTokens,
+			SessionMaxPromptTokens: tokensCfg.SessionMaxPromptTokens,
+			MaxCompletionTokens:    tokensCfg.MaxCompletionTokens,
+			Policy:                 tokensCfg.LimitPolicy,
+		}))
+	}
+
+	// Checked last, against the prompt as it will be sent
+	if cfg.Policies.ModelCapabilities != "" {
+		capabilities, err := guard.ParseModelCapabilities(cfg.Policies.ModelCapabilities)
+		if err != nil {
+			return nil, err
+		}
+		capabilityGuard := guard.NewCapabilityGuard(tokenizer.NewEstimator(), capabilities)
+		// Summaries are requested from the default queue, past the request policies
+		var summarizer guard.Summarizer
+		if cfg.Policies.ContextOverflow == entities.LimitPolicySummarize {
+			summarizer = guard.NewQueueSummarizer(summaryQueue, cfg.Policies.SummaryModel)
+		}
+		filters = append(filters, capabilityGuard.WithOverflow(cfg.Policies.ContextOverflow, summarizer, cfg.Policies.SummaryMaxTokens))
+	}
+
+	return filters, nil
+}
+
+// newTransformHook creates the client of TRANSFORM_HOOK_URL, or returns nil
+// when no hook is configured
+func newTransformHook(cfg *config.Config) *hook.Client {
+	if cfg.Hooks.URL == "" {
+		return nil
+	}
+	log.Printf("Sending %s to the transformation hook at %s", strings.Join(cfg.Hooks.Stages, " and "), cfg.Hooks.URL)
+	return hook.NewClient(cfg.Hooks.URL, cfg.Hooks.Token, &http.Client{Timeout: cfg.Hooks.Timeout}, cfg.Hooks.FailClosed)
+}
+
+// newAuthorizer creates the client of the authorization service at AUTHZ_URL,
+// or returns nil when none is configured
+func newAuthorizer(cfg *config.Config) *authz.Authorizer {
+	if cfg.Authz.URL == "" {
+		return nil
+	}
+	log.Printf("Authorizing public requests with %s", cfg.Authz.URL)
+	return authz.NewAuthorizer(cfg.Authz.URL, cfg.Authz.Token, &http.Client{Timeout: cfg.Authz.Timeout}, cfg.Authz.FailOpen)
+}
+
+// newResponseFilters creates the filters applied to buffered responses
+// before they are returned. Budget warnings come last, so the transform hook
+// cannot drop them; budgetLedger is nil when no budget is configured.
+func newResponseFilters(cfg *config.Config, transformHook *hook.Client, budgetLedger *budget.Ledger, sessions budget.Sessions) []handlers.ResponseFilter {
+	var filters []handlers.ResponseFilter
+	if transformHook != nil && slices.Contains(cfg.Hooks.Stages, hook.StageResponse) {
+		filters = append(filters, transformHook)
+	}
+	if budgetLedger != nil && cfg.Tokens.BudgetWarningPercent > 0 {
+		filters = append(filters, budget.NewWarner(budgetLedger, sessions, entities.BudgetWarningSettings{
+			Percent: cfg.Tokens.BudgetWarningPercent,
+			Body:    cfg.Tokens.BudgetWarningBody,
+		}))
+	}
+	return filters
+}
+
+// newModerationFilter creates the moderation pre-check with the configured
+// classifier; blocked requests are recorded in requestHistory, which may be nil
+func newModerationFilter(cfg *config.Config, requestHistory repository.HistoryRepository, useKey func(secrets.KeyConsumer)) (*moderation.Filter, error) {
+	moderationCfg := cfg.Moderation
+
+	var classifier moderation.Classifier
+	switch moderationCfg.Provider {
+	case "keywords":
+		keywords, err := moderation.ParseKeywords(moderationCfg.Keywords)
+		if err != nil {
+			return nil, err
+		}
+		keywordClassifier, err := moderation.NewKeywordClassifier(keywords)
+		if err != nil {
+			return nil, err
+		}
+		classifier = keywordClassifier
+	case "openai":
+		baseURL, apiKey := moderationCfg.BaseURL, moderationCfg.APIKey
+		sharesKey := baseURL == ""
+		if sharesKey {
+			baseURL, apiKey = cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey
+		}
+		openAIClassifier := moderation.NewOpenAIClassifier(baseURL, apiKey, moderationCfg.Model, &http.Client{Timeout: moderationCfg.Timeout})
+		if sharesKey {
+			useKey(openAIClassifier)
+		}
+		classifier = openAIClassifier
+	default:
+		return nil, fmt.Errorf("unknown MODERATION_PROVIDER %q", moderationCfg.Provider)
+	}
+
+	// A nil interface keeps the filter from recording when history is disabled
+	var store moderation.Store
+	if requestHistory != nil {
+		store = requestHistory
+	}
+	return moderation.NewFilter(classifier, tokenizer.NewEstimator(), store, entities.ModerationSettings{
+		Action:           moderationCfg.Action,
+		Thresholds:       moderationCfg.Thresholds,
+		DefaultThreshold: moderationCfg.DefaultThreshold,
+	}, moderationCfg.FailClosed), nil
+}
+
+// newRedactor creates the redaction stage from the built-in patterns, custom
+// patterns and dictionary terms, or returns nil if redaction is disabled
+func newRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	redactionCfg := cfg.Redaction
+	if !redactionCfg.Enabled {
+		return nil, nil
+	}
+
+	var scrubbers []redact.Scrubber
+	for _, name := range redactionCfg.Builtins {
+		scrubber, err := redact.NewBuiltinScrubber(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		scrubbers = append(scrubbers, scrubber)
+	}
+	if redactionCfg.Patterns != "" {
+		patterns, err := redact.ParsePatterns(redactionCfg.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		scrubbers = append(scrubbers, patterns...)
+	}
+	if len(redactionCfg.Terms) > 0 {
+		scrubber, err := redact.NewDictionaryScrubber("term", redactionCfg.Terms)
+		if err != nil {
+			return nil, err
+		}
+		scrubbers = append(scrubbers, scrubber)
+	}
+
+	return redact.NewRedactor(scrubbers...), nil
+}
+
+// publicMiddlewares returns the middleware chain applied around the public routes
+func (a *App) publicMiddlewares() []middleware.Middleware {
+	rules := a.IPRules
+	middlewares := []middleware.Middleware{
+		middleware.Logging(),
+		// Outside Recovery, so recovered panics are counted as 5xx
+		middleware.Metrics(a.Metrics),
+		middleware.Recovery(a.Metrics),
+		middleware.Forwarded(rules.TrustedProxies, a.Config.HTTP.ForwardClientIP),
+	}
+	if len(rules.Allowed) > 0 || len(rules.Denied) > 0 {
+		middlewares = append(middlewares, middleware.IPFilter(rules.Allowed, rules.Denied, rules.TrustedProxies))
+	}
+	if a.IPLimiter != nil {
+		perMin, burst := a.Config.HTTP.IPRateLimitPerMin, a.Config.HTTP.IPRateLimitBurst
+		if burst == 0 {
+			burst = perMin
+		}
+		middlewares = append(middlewares, middleware.IPRateLimit(a.IPLimiter, perMin, burst, rules.TrustedProxies))
+	}
+	if len(a.Config.HTTP.CORSAllowedOrigins) > 0 {
+		middlewares = append(middlewares, middleware.CORS(a.Config.HTTP.CORSAllowedOrigins))
+	}
+	// Forwarded requests carry the credentials and path the tenant resolver
+	// strips, so they are kept before it runs
+	if a.Affinity != nil {
+		middlewares = append(middlewares, a.Affinity.Capture)
+	}
+	// Tenants are resolved after CORS so that preflight requests need no credentials
+	if a.TenantResolver != nil {
+		middlewares = append(middlewares, a.TenantResolver.Middleware)
+	}
+	// The authorization service sees the tenant, and decides before requests
+	// are forwarded to the replica owning their session
+	if a.Authorizer != nil {
+		middlewares = append(middlewares, a.Authorizer.Middleware)
+	}
+	// Sessions are hashed with their tenant, so affinity follows tenant resolution
+	if a.Affinity != nil {
+		middlewares = append(middlewares, a.Affinity.Middleware)
+	}
+	return middlewares
+}
+
+// NewAdminServer creates the admin HTTP server and registers administrative routes
+func (a *App) NewAdminServer() *http.Server {
+	return a.newHTTPServer(fmt.Sprintf("%s:%d", a.Config.Admin.Host, a.Config.Admin.Port), a.AdminHandler())
+}
+
+// AdminHandler returns the administrative routes behind the admin token
+func (a *App) AdminHandler() http.Handler {
+	adminHandler := handlers.NewAdminHandler(a.Config.Admin.Token)
+	metricsHandler := handlers.NewMetricsHandler(a.Metrics)
+	sessionMetadataHandler := handlers.NewSessionMetadataHandler(a.Repository)
+	threadsHandler := handlers.NewThreadsHandler(a.ThreadSessions)
+	queueStatsHandler := handlers.NewQueueStatsHandler(a.queueStatsSources()...)
+	sessionSummaryHandler := handlers.NewSessionSummaryHandler(a.Summaries)
+	dashboardHandler := handlers.NewDashboardHandler()
+
+	adminHandler.Handle("/dashboard", http.HandlerFunc(dashboardHandler.Handle))
+	adminHandler.Handle("/queues", http.HandlerFunc(queueStatsHandler.Handle))
+	if a.Prober != nil {
+		upstreamsHandler := handlers.NewUpstreamsHandler(a.Prober)
+		adminHandler.Handle("/upstreams", http.HandlerFunc(upstreamsHandler.Handle))
+	}
+	if a.QueueHistory != nil {
+		queueHistoryHandler := handlers.NewQueueHistoryHandler(a.QueueHistory)
+		adminHandler.Handle("/queues/history", http.HandlerFunc(queueHistoryHandler.Handle))
+	}
+	adminHandler.Handle("/sessions/summary", http.HandlerFunc(sessionSummaryHandler.Handle))
+	userUsageHandler := handlers.NewSessionGroupHandler(a.Summaries, entities.UserIDMetadataKey)
+	projectUsageHandler := handlers.NewSessionGroupHandler(a.Summaries, entities.ProjectIDMetadataKey)
+	adminHandler.Handle("/users/{id}/usage", http.HandlerFunc(userUsageHandler.HandleUsage))
+	adminHandler.Handle("/projects/{id}/usage", http.HandlerFunc(projectUsageHandler.HandleUsage))
+	if store, ok := a.Repository.(handlers.SessionMigrationStore); ok {
+		sessionMigrationHandler := handlers.NewSessionMigrationHandler(store)
+		if a.Budgets != nil {
+			sessionMigrationHandler.WithBudgets(a.Budgets)
+		}
+		adminHandler.Handle("/sessions/clone", http.HandlerFunc(sessionMigrationHandler.HandleClone))
+		adminHandler.Handle("/sessions/merge", http.HandlerFunc(sessionMigrationHandler.HandleMerge))
+	}
+	if store, ok := a.Repository.(handlers.SessionExportStore); ok {
+		sessionExportHandler := handlers.NewSessionExportHandler(store)
+		adminHandler.Handle("/sessions/export", http.HandlerFunc(sessionExportHandler.HandleExport))
+		adminHandler.Handle("/sessions/import", http.HandlerFunc(sessionExportHandler.HandleImport))
+	}
+	if a.Budgets != nil {
+		budgetsHandler := handlers.NewBudgetsHandler(a.Budgets)
+		adminHandler.Handle("/budgets", http.HandlerFunc(budgetsHandler.HandleBudgets))
+		adminHandler.Handle("/budgets/transfers", http.HandlerFunc(budgetsHandler.HandleTransfers))
+	}
+	if a.AnomalyDetector != nil {
+		sessionAnomaliesHandler := handlers.NewSessionAnomaliesHandler(a.AnomalyDetector)
+		adminHandler.Handle("/sessions/anomalies", http.HandlerFunc(sessionAnomaliesHandler.Handle))
+	}
+	adminHandler.Handle("/metrics", http.HandlerFunc(metricsHandler.Handle))
+	adminHandler.Handle("/sessions/metadata", http.HandlerFunc(sessionMetadataHandler.Handle))
+	adminHandler.Handle("/threads", http.HandlerFunc(threadsHandler.Handle))
+	if a.Tenants != nil {
+		tenantsHandler := handlers.NewTenantsHandler(a.Tenants)
+		adminHandler.Handle("/tenants", http.HandlerFunc(tenantsHandler.Handle))
+		adminHandler.Handle("/tenants/", http.HandlerFunc(tenantsHandler.Handle))
+	}
+	if a.EmbeddingCache != nil {
+		cacheStatsHandler := handlers.NewCacheStatsHandler(a.EmbeddingCache)
+		adminHandler.Handle("/cache/stats", http.HandlerFunc(cacheStatsHandler.Handle))
+	}
+	maintenanceHandler := handlers.NewMaintenanceHandler(a.Maintenance)
+	adminHandler.Handle("/maintenance", http.HandlerFunc(maintenanceHandler.Handle))
+	if a.FaultInjector != nil {
+		faultInjectionHandler := handlers.NewFaultInjectionHandler(a.FaultInjector)
+		adminHandler.Handle("/chaos", http.HandlerFunc(faultInjectionHandler.Handle))
+	}
+	if a.ModelSplitter != nil {
+		variantUsageHandler := handlers.NewVariantUsageHandler(a.ModelSplitter)
+		adminHandler.Handle("/experiments/usage", http.HandlerFunc(variantUsageHandler.Handle))
+	}
+	if a.Redactor != nil {
+		redactionStatsHandler := handlers.NewRedactionStatsHandler(a.Redactor)
+		adminHandler.Handle("/redactions/stats", http.HandlerFunc(redactionStatsHandler.Handle))
+	}
+	if a.RequestHistory != nil {
+		requestHistoryHandler := handlers.NewRequestHistoryHandler(a.RequestHistory)
+		adminHandler.Handle("/history", http.HandlerFunc(requestHistoryHandler.Handle))
+		latencyReportHandler := handlers.NewLatencyReportHandler(history.NewReporter(a.RequestHistory))
+		adminHandler.Handle("/history/latency", http.HandlerFunc(latencyReportHandler.Handle))
+		requestReplayHandler := handlers.NewRequestReplayHandler(a.Replayer)
+		adminHandler.Handle("/history/{id}/replay", http.HandlerFunc(requestReplayHandler.Handle))
+	}
+	if backups, ok := a.Repository.(handlers.BackupStore); ok {
+		backupHandler := handlers.NewBackupHandler(backups)
+		adminHandler.Handle("/backup", http.HandlerFunc(backupHandler.Handle))
+	}
+	if a.Pruner != nil {
+		pruneHandler := handlers.NewPruneHandler(a.Pruner)
+		adminHandler.Handle("/prune", http.HandlerFunc(pruneHandler.Handle))
+	}
+	if a.ShadowResults != nil {
+		shadowResultsHandler := handlers.NewShadowResultsHandler(a.ShadowResults)
+		adminHandler.Handle("/shadow/results", http.HandlerFunc(shadowResultsHandler.Handle))
+	}
+
+	// Profiling
+	adminHandler.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	adminHandler.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	adminHandler.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	adminHandler.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	adminHandler.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+
+	middlewares := []middleware.Middleware{middleware.Logging(), middleware.Recovery(a.Metrics)}
+	if rules := a.IPRules; len(rules.AdminAllowed) > 0 || len(rules.Denied) > 0 {
+		// Addresses are checked before the admin token is
+		middlewares = append(middlewares, middleware.IPFilter(rules.AdminAllowed, rules.Denied, rules.TrustedProxies))
+	}
+	return middleware.Chain(adminHandler, middlewares...)
+}
+
+// queueStatsSources returns the queues reported on /queues: the default
+// queue, the named queues and the shadow queue when configured
+func (a *App) queueStatsSources() []handlers.QueueStatsSource {
+	sources := []handlers.QueueStatsSource{a.Queue}
+	for _, q := range a.NamedQueues {
+		sources = append(sources, q)
+	}
+	if a.ShadowQueue != nil {
+		sources = append(sources, a.ShadowQueue)
+	}
+	return sources
+}
+
+// newHTTPServer wraps a handler in an http.Server using the configured timeouts
+func (a *App) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  a.Config.HTTP.ReadTimeout,
+		WriteTimeout: a.Config.HTTP.WriteTimeout,
+		IdleTimeout:  a.Config.HTTP.IdleTimeout,
+	}
+}
+
+// signedBodyLimit returns the largest body buffered to verify a signed
+// request: the larger of the JSON and upload limits, 0 if either is unlimited
+func signedBodyLimit(maxBodyBytes, maxUploadBytes int64) int64 {
+	if maxBodyBytes == 0 || maxUploadBytes == 0 {
+		return 0
+	}
+	return max(maxBodyBytes, maxUploadBytes)
 }
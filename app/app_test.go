@@ -1,20 +1,38 @@
 package app_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/marketconnect/llm-queue-proxy/app/app"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
 
+// newTestConfig returns a default configuration using the memory repository
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("OPENAI_API_KEY", "test_api_key")
+	t.Setenv("REPOSITORY_TYPE", "memory")
+	cfg, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() error = %v", err)
+	}
+	return cfg
+}
+
 func TestNewApp_DefaultConfig(t *testing.T) {
-	// Ensure critical env vars are set for default run
-	os.Setenv("OPENAI_API_KEY", "test_api_key")
-	// Default is memory repository, so DSN is not strictly needed unless type is sqlite
-	os.Setenv("REPOSITORY_TYPE", "memory")
+	cfg := newTestConfig(t)
 
-	a, err := app.NewApp()
+	a, err := app.NewApp(cfg)
 	if err != nil {
 		t.Fatalf("NewApp() failed: %v", err)
 	}
@@ -38,13 +56,15 @@ func TestNewApp_DefaultConfig(t *testing.T) {
 	if a.Queue == nil {
 		t.Error("App.Queue is nil")
 	}
+	if a.ProxyQueue == nil {
+		t.Error("App.ProxyQueue is nil")
+	}
 }
 
 func TestApp_Close(t *testing.T) {
-	os.Setenv("OPENAI_API_KEY", "test_api_key_close")
-	os.Setenv("REPOSITORY_TYPE", "memory")
+	cfg := newTestConfig(t)
 
-	a, err := app.NewApp()
+	a, err := app.NewApp(cfg)
 	if err != nil {
 		t.Fatalf("NewApp() failed: %v", err)
 	}
@@ -61,6 +81,398 @@ func TestApp_Close(t *testing.T) {
 	}
 }
 
-// Note: Testing NewApp with SQLite repository type is tricky due to config singleton.
-// It's better to test SQLiteRepository independently.
-// Run() is not unit tested here as it starts an HTTP server. Integration tests would cover it.
+func TestApp_NewServer(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	server := a.NewServer()
+	if server.Handler == nil || server.Handler == http.Handler(http.DefaultServeMux) {
+		t.Fatal("NewServer() should use a dedicated mux")
+	}
+	if server.ReadTimeout != a.Config.HTTP.ReadTimeout || server.WriteTimeout != a.Config.HTTP.WriteTimeout || server.IdleTimeout != a.Config.HTTP.IdleTimeout {
+		t.Errorf("NewServer() timeouts = (%v, %v, %v), want config values", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	rr := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/sessions/status", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /sessions/status status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /version status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+
+	// Admin routes must not leak onto the public server
+	rr = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("GET /debug/pprof/ on public server status code = %v, want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestApp_PassthroughRoute(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	var upstreamPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"response":"ok"}`))
+	}))
+	defer upstream.Close()
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+	a.Queue.Close()
+	a.Queue = queue.NewQueue(6000, upstream.URL, "test-key", 0)
+	a.ProxyQueue = a.Queue
+
+	rr := httptest.NewRecorder()
+	a.NewServer().Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("POST /v1/chat/completions status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+	if upstreamPath != "/v1/chat/completions" {
+		t.Errorf("upstream path = %q, want /v1/chat/completions", upstreamPath)
+	}
+}
+
+func TestApp_SessionInfoRoutes(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Tokens.DefaultBudget = 100
+
+	upstreamCalled := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+	a.Queue.Close()
+	a.Queue = queue.NewQueue(6000, upstream.URL, "test-key", 0)
+	a.ProxyQueue = a.Queue
+	if _, err := a.SessionManager.CreateSession("s1"); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	handler := a.NewServer().Handler
+	for _, path := range []string{"/v1/session/s1/status", "/v1/session/s1/usage", "/v1/session/s1/budget"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s status code = %v, want %v", path, rr.Code, http.StatusOK)
+		}
+	}
+	if upstreamCalled {
+		t.Error("session information requests were forwarded upstream")
+	}
+}
+
+func TestApp_AggregateRoutesAdminOnly(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Admin.Token = "secret"
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	// Aggregates list session IDs, which are the credential of the session routes
+	paths := []string{"/sessions/summary", "/users/u1/usage", "/projects/p1/usage"}
+	public := a.NewServer().Handler
+	for _, path := range paths {
+		rr := httptest.NewRecorder()
+		public.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound || strings.Contains(rr.Header().Get("Content-Type"), "json") {
+			t.Errorf("public GET %s = %v %q, want the mux 404", path, rr.Code, rr.Header().Get("Content-Type"))
+		}
+	}
+
+	admin := a.NewAdminServer().Handler
+	for _, path := range paths {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, req)
+		// Groups without sessions answer 404 from the handler, in JSON
+		if !strings.Contains(rr.Header().Get("Content-Type"), "json") {
+			t.Errorf("admin GET %s = %v %q, want a JSON response", path, rr.Code, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestApp_Dashboard(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Admin.Token = "secret"
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	handler := a.NewAdminServer().Handler
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("GET /dashboard without credentials status code = %v, want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// The dashboard and the endpoints it polls are served to browsers with Basic credentials
+	for _, path := range []string{"/dashboard", "/queues", "/sessions/summary", "/metrics"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.SetBasicAuth("admin", "secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s status code = %v, want %v", path, rr.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestNewApp_SQLiteConfig(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Repository.Type = "sqlite"
+	cfg.Repository.SQLiteDSN = filepath.Join(t.TempDir(), "sessions.db")
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	if _, ok := a.Repository.(*repository.SQLiteRepository); !ok {
+		t.Errorf("Expected Repository to be *SQLiteRepository, got %T", a.Repository)
+	}
+
+	// A second app with its own configuration is independent of the first
+	other, err := app.NewApp(newTestConfig(t))
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer other.Close()
+	if _, ok := other.Repository.(*repository.MemoryRepository); !ok {
+		t.Errorf("Expected second Repository to be *MemoryRepository, got %T", other.Repository)
+	}
+}
+
+func TestNewApp_LeaderElection(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "sessions.db")
+	newReplica := func(id string) *app.App {
+		cfg := newTestConfig(t)
+		cfg.Repository.Type = "sqlite"
+		cfg.Repository.SQLiteDSN = dsn
+		cfg.Coordination.LeaderElection = true
+		cfg.Coordination.InstanceID = id
+		a, err := app.NewApp(cfg)
+		if err != nil {
+			t.Fatalf("NewApp(%s) failed: %v", id, err)
+		}
+		return a
+	}
+
+	first := newReplica("replica-a")
+	second := newReplica("replica-b")
+	defer second.Close()
+	if !first.Leader.IsLeader() || second.Leader.IsLeader() {
+		t.Fatalf("IsLeader() = %v, %v, want only the first replica to lead", first.Leader.IsLeader(), second.Leader.IsLeader())
+	}
+
+	// Closing the leader hands the lease over without waiting for it to expire
+	first.Close()
+	if !second.Leader.Renew() {
+		t.Error("Renew() of the second replica after the leader closed = false, want true")
+	}
+}
+
+// Run() is not unit tested here as it starts an HTTP server; NewServer covers the routing.
+
+func TestNewApp_APIKeyFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "openai_api_key")
+	if err := os.WriteFile(keyFile, []byte("sk-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := newTestConfig(t)
+	cfg.OpenAI.APIKeyFile = keyFile
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	if a.Config.OpenAI.APIKey != "sk-from-file" {
+		t.Errorf("App.Config.OpenAI.APIKey = %q, want the key from the file", a.Config.OpenAI.APIKey)
+	}
+	if cfg.OpenAI.APIKey != "test_api_key" {
+		t.Errorf("NewApp() modified the passed config: APIKey = %q", cfg.OpenAI.APIKey)
+	}
+	if a.KeyWatcher == nil {
+		t.Error("App.KeyWatcher is nil, want the key file to be watched")
+	}
+
+	cfg.OpenAI.APIKeyFile = filepath.Join(t.TempDir(), "missing")
+	if _, err := app.NewApp(cfg); err == nil {
+		t.Error("NewApp() error = nil, want an error for a missing key file")
+	}
+}
+
+func TestNewApp_Alerts(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Tokens.DefaultBudget = 1000
+	cfg.Alerts.QueueDepth = 100
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	if a.Alerts == nil || a.QueueDepthMonitor == nil {
+		t.Errorf("App.Alerts = %v, App.QueueDepthMonitor = %v, want both set", a.Alerts, a.QueueDepthMonitor)
+	}
+}
+
+func TestApp_Tenants(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Tenants.Mode = entities.TenantModeKey
+
+	var upstreamAuth string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"usage":{"prompt_tokens":2,"completion_tokens":1,"total_tokens":3}}`))
+	}))
+	defer upstream.Close()
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+	if a.Tenants == nil || a.TenantResolver == nil {
+		t.Fatal("App.Tenants and App.TenantResolver should be set in multi-tenant mode")
+	}
+	a.Queue.Close()
+	a.Queue = queue.NewQueue(6000, upstream.URL, "proxy-key", 0)
+	a.ProxyQueue = tenant.NewUpstreamKeys(a.Queue, a.Tenants)
+
+	if _, err := a.Tenants.CreateTenant(entities.Tenant{ID: "acme", UpstreamAPIKey: "sk-acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	issued, err := a.Tenants.IssueKey("acme", entities.VirtualKeyRequest{})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+
+	server := a.NewServer()
+	rr := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("request without a virtual key status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer "+issued.Key)
+	rr = httptest.NewRecorder()
+	server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || upstreamAuth != "Bearer sk-acme" {
+		t.Errorf("tenant request status = %d, upstream Authorization = %q, want 200 and the tenant's key", rr.Code, upstreamAuth)
+	}
+	if _, err := a.SessionManager.GetSession("acme/s1"); err != nil {
+		t.Errorf("GetSession(acme/s1) error = %v, want the tenant's session", err)
+	}
+
+	rr = httptest.NewRecorder()
+	a.NewAdminServer().Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/tenants/acme/usage", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /tenants/acme/usage status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestApp_NewGRPCServer(t *testing.T) {
+	cfg := newTestConfig(t)
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+	server, err := a.NewGRPCServer()
+	if err != nil {
+		t.Fatalf("NewGRPCServer() error = %v", err)
+	}
+	services := server.GetServiceInfo()
+	if _, ok := services["llmqueueproxy.v1.ProxyService"]; !ok || len(services) != 1 {
+		t.Errorf("NewGRPCServer() services = %v, want only the ProxyService without tenants", services)
+	}
+
+	cfg = newTestConfig(t)
+	cfg.Tenants.Mode = entities.TenantModeKey
+	a, err = app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+	server, err = a.NewGRPCServer()
+	if err != nil {
+		t.Fatalf("NewGRPCServer() error = %v", err)
+	}
+	if _, ok := server.GetServiceInfo()["llmqueueproxy.v1.KeyService"]; !ok {
+		t.Error("NewGRPCServer() should serve the KeyService in tenant mode")
+	}
+}
+
+func TestApp_IPRules(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.HTTP.AllowedCIDRs = []string{"192.0.2.0/24"}
+	cfg.HTTP.DeniedCIDRs = []string{"192.0.2.99"}
+	cfg.Admin.AllowedCIDRs = []string{"127.0.0.1"}
+
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name       string
+		server     *http.Server
+		path       string
+		remoteAddr string
+		want       int
+	}{
+		{"allowed client", a.NewServer(), "/version", "192.0.2.1:5000", http.StatusOK},
+		{"denied client", a.NewServer(), "/version", "192.0.2.99:5000", http.StatusForbidden},
+		{"client outside the allowlist", a.NewServer(), "/version", "198.51.100.1:5000", http.StatusForbidden},
+		{"admin from the allowlist", a.NewAdminServer(), "/metrics", "127.0.0.1:5000", http.StatusOK},
+		{"admin from the proxy allowlist", a.NewAdminServer(), "/metrics", "192.0.2.1:5000", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			tt.server.Handler.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("GET %s from %s status = %d, want %d", tt.path, tt.remoteAddr, rr.Code, tt.want)
+			}
+		})
+	}
+}
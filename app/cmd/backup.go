@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+// snapshotter is implemented by repositories that can be backed up and restored
+type snapshotter interface {
+	Backup(path string) error
+	Restore(path string) error
+}
+
+// backup writes a snapshot of the configured repository to the file named by -out
+func backup(args []string, stdout io.Writer) error {
+	flags := newFlagSet("backup")
+	output := flags.String("out", "", "file to write the snapshot to")
+	if err := flags.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if *output == "" {
+		return usageError("expected: backup -out file")
+	}
+	return withSnapshotter(func(storage snapshotter) error {
+		if err := storage.Backup(*output); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Backed up to %s\n", *output)
+		return nil
+	})
+}
+
+// restore replaces the contents of the configured repository with the
+// snapshot named by -in; the proxy should be stopped first
+func restore(args []string, stdout io.Writer) error {
+	flags := newFlagSet("restore")
+	input := flags.String("in", "", "snapshot file to restore")
+	if err := flags.Parse(args); err != nil {
+		return usageError("%v", err)
+	}
+	if *input == "" {
+		return usageError("expected: restore -in file")
+	}
+	return withSnapshotter(func(storage snapshotter) error {
+		if err := storage.Restore(*input); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Restored from %s\n", *input)
+		return nil
+	})
+}
+
+// withSnapshotter opens the configured repository for the duration of fn
+func withSnapshotter(fn func(storage snapshotter) error) error {
+	return withStorage(func(storage repository.Storage) error {
+		snapshots, ok := storage.(snapshotter)
+		if !ok {
+			return fmt.Errorf("the repository does not support backups")
+		}
+		return fn(snapshots)
+	})
+}
@@ -1,27 +1,169 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	_ "time/tzdata" // Time zones of queue schedules on hosts without zoneinfo
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 
 	"github.com/marketconnect/llm-queue-proxy/app/app"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
 )
 
+const usage = `Usage: llm-queue-proxy [command]
+
+Commands:
+  serve                        Run the proxy (default)
+  migrate                      Apply pending schema migrations
+  sessions list                List sessions and their usage
+  sessions export [-o file]    Export sessions as JSONL for /sessions/import
+  sessions delete <id>...      Delete sessions
+  backup -out file             Write a snapshot of the SQLite database
+  restore -in file             Replace the SQLite database with a snapshot
+  config validate [-file path] Validate the configuration
+  version                      Print the version
+
+Configuration is read from the environment and the file named by CONFIG_FILE.
+`
+
 func main() {
-	a, err := app.NewApp()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command named by args and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = serve()
+	case "migrate":
+		err = migrate(stdout)
+	case "sessions":
+		err = sessions(args, stdout)
+	case "backup":
+		err = backup(args, stdout)
+	case "restore":
+		err = restore(args, stdout)
+	case "config":
+		err = configCommand(args, stdout)
+	case "version":
+		info := buildinfo.Get()
+		fmt.Fprintf(stdout, "llm-queue-proxy %s\ncommit: %s\nbuilt: %s\ngo: %s\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+	default:
+		err = usageError("unknown command %q", command)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		var lineErr commandLineError
+		if errors.As(err, &lineErr) {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// commandLineError reports a malformed command line
+type commandLineError string
+
+func (e commandLineError) Error() string {
+	return string(e)
+}
+
+func usageError(format string, args ...any) error {
+	return commandLineError(fmt.Sprintf(format, args...))
+}
+
+// newFlagSet creates a flag set that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+// serve runs the proxy until the server stops
+func serve() error {
+	a, err := app.NewApp(config.GetConfig())
 	if err != nil {
-		log.Printf("Application failed: %v", err)
-		os.Exit(1)
+		return err
 	}
 	defer func() {
 		if err := a.Close(); err != nil {
 			log.Printf("Error closing application: %v", err)
 		}
 	}()
-	if err := a.Run(); err != nil {
-		log.Printf("Application failed: %v", err)
-		os.Exit(1)
+	return a.Run()
+}
+
+// migrate applies pending schema migrations; serve applies them on startup as well
+func migrate(stdout io.Writer) error {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Repository.Type != "sqlite" {
+		fmt.Fprintf(stdout, "The %s repository has no schema to migrate\n", cfg.Repository.Type)
+		return nil
+	}
+	storage, err := app.NewStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	versioned, ok := storage.(schemaVersioner)
+	if !ok {
+		fmt.Fprintf(stdout, "Migrated %s\n", cfg.Repository.SQLiteDSN)
+		return nil
+	}
+	version, err := versioned.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Migrated %s to schema version %d\n", cfg.Repository.SQLiteDSN, version)
+	return nil
+}
+
+// schemaVersioner is implemented by repositories with versioned migrations
+type schemaVersioner interface {
+	SchemaVersion() (int, error)
+}
+
+// configCommand runs the config subcommands
+func configCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return usageError("expected: config validate [-file path]")
+	}
+	flags := newFlagSet("config validate")
+	path := flags.String("file", os.Getenv(config.ConfigFileEnv), "config file to validate")
+	if err := flags.Parse(args[1:]); err != nil {
+		return usageError("%v", err)
+	}
+
+	var err error
+	if *path != "" {
+		_, err = config.NewConfigFromFile(*path)
+	} else {
+		_, err = config.NewConfigFromEnv()
+	}
+	if err != nil {
+		return err
 	}
+	fmt.Fprintln(stdout, "Configuration is valid")
+	return nil
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+// setupSQLite points the configuration at a new SQLite database with two sessions
+func setupSQLite(t *testing.T) string {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "sessions.db")
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("REPOSITORY_TYPE", "sqlite")
+	t.Setenv("SQLITE_DSN", dsn)
+
+	repo, err := repository.NewSQLiteRepository(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository() error = %v", err)
+	}
+	defer repo.Close()
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	repo.UpdateSessionTokens("agent-1", entities.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	repo.UpdateSessionTokens("agent-2", entities.TokenUsage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2})
+	return dsn
+}
+
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_SessionsList(t *testing.T) {
+	setupSQLite(t)
+
+	code, out, errOut := runCommand("sessions", "list")
+	if code != 0 {
+		t.Fatalf("sessions list exit code = %d, stderr %q", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "agent-1") || !strings.HasPrefix(lines[2], "agent-2") {
+		t.Errorf("sessions list output = %q, want a header and two sorted sessions", out)
+	}
+}
+
+func TestRun_SessionsExport(t *testing.T) {
+	setupSQLite(t)
+
+	code, out, errOut := runCommand("sessions", "export")
+	if code != 0 {
+		t.Fatalf("sessions export exit code = %d, stderr %q", code, errOut)
+	}
+	var exported []entities.SessionExport
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var export entities.SessionExport
+		if err := json.Unmarshal([]byte(line), &export); err != nil {
+			t.Fatalf("export line %q is not JSON: %v", line, err)
+		}
+		exported = append(exported, export)
+	}
+	if len(exported) != 2 || exported[0].Session.SessionID != "agent-1" || exported[0].Session.TotalTokens != 15 || exported[1].Session.SessionID != "agent-2" {
+		t.Errorf("exported = %+v, want both sessions sorted by ID", exported)
+	}
+	if exported[0].SchemaVersion != entities.SessionExportVersion {
+		t.Errorf("export schema version = %d, want %d", exported[0].SchemaVersion, entities.SessionExportVersion)
+	}
+
+	output := filepath.Join(t.TempDir(), "sessions.jsonl")
+	if code, _, errOut := runCommand("sessions", "export", "-o", output); code != 0 {
+		t.Fatalf("sessions export -o exit code = %d, stderr %q", code, errOut)
+	}
+	written, err := os.ReadFile(output)
+	if err != nil || string(written) != out {
+		t.Errorf("export file = %q (%v), want the same JSONL as stdout", written, err)
+	}
+}
+
+func TestRun_SessionsDelete(t *testing.T) {
+	dsn := setupSQLite(t)
+
+	code, _, errOut := runCommand("sessions", "delete", "agent-1", "missing")
+	if code != 1 || !strings.Contains(errOut, "missing") {
+		t.Errorf("sessions delete exit code = %d, stderr %q, want 1 reporting the missing session", code, errOut)
+	}
+
+	repo, err := repository.NewSQLiteRepository(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository() error = %v", err)
+	}
+	defer repo.Close()
+	sessions, err := repo.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if _, ok := sessions["agent-1"]; ok || len(sessions) != 1 {
+		t.Errorf("sessions after delete = %v, want only agent-2", sessions)
+	}
+}
+
+func TestRun_SessionsRequiresPersistentRepository(t *testing.T) {
+	setupSQLite(t)
+	t.Setenv("REPOSITORY_TYPE", "memory")
+
+	if code, _, _ := runCommand("sessions", "list"); code != 1 {
+		t.Errorf("sessions list with memory repository exit code = %d, want 1", code)
+	}
+}
+
+func TestRun_BackupAndRestore(t *testing.T) {
+	dsn := setupSQLite(t)
+	backupPath := filepath.Join(t.TempDir(), "backup.db")
+
+	if code, out, errOut := runCommand("backup", "-out", backupPath); code != 0 || !strings.Contains(out, "Backed up") {
+		t.Fatalf("backup = (%d, %q, %q), want success", code, out, errOut)
+	}
+	if code, _, errOut := runCommand("sessions", "delete", "agent-1", "agent-2"); code != 0 {
+		t.Fatalf("sessions delete exit code = %d, stderr %q", code, errOut)
+	}
+	if code, out, errOut := runCommand("restore", "--in", backupPath); code != 0 || !strings.Contains(out, "Restored") {
+		t.Fatalf("restore = (%d, %q, %q), want success", code, out, errOut)
+	}
+
+	repo, err := repository.NewSQLiteRepository(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository() error = %v", err)
+	}
+	defer repo.Close()
+	sessions, err := repo.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("sessions after restore = %v, want both backed up sessions", sessions)
+	}
+}
+
+func TestRun_Migrate(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("REPOSITORY_TYPE", "sqlite")
+	t.Setenv("SQLITE_DSN", filepath.Join(t.TempDir(), "new.db"))
+
+	if code, out, errOut := runCommand("migrate"); code != 0 || !strings.Contains(out, "schema version") {
+		t.Errorf("migrate = (%d, %q, %q), want success", code, out, errOut)
+	}
+}
+
+func TestRun_ConfigValidate(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+
+	if code, out, _ := runCommand("config", "validate"); code != 0 || !strings.Contains(out, "valid") {
+		t.Errorf("config validate = (%d, %q), want success", code, out)
+	}
+
+	t.Setenv("TOKEN_LIMIT_POLICY", "drop")
+	t.Setenv("SHADOW_PERCENT", "150")
+	code, _, errOut := runCommand("config", "validate")
+	if code != 1 || !strings.Contains(errOut, "TOKEN_LIMIT_POLICY") || !strings.Contains(errOut, "SHADOW_PERCENT") {
+		t.Errorf("config validate = (%d, %q), want both invalid fields reported", code, errOut)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	for _, args := range [][]string{{"unknown"}, {"sessions"}, {"sessions", "delete"}, {"config"}, {"backup"}, {"restore"}} {
+		if code, _, errOut := runCommand(args...); code != 2 || !strings.Contains(errOut, "Usage:") {
+			t.Errorf("run(%v) = (%d, %q), want exit code 2 with usage", args, code, errOut)
+		}
+	}
+}
+
+func TestRun_Version(t *testing.T) {
+	if code, out, _ := runCommand("version"); code != 0 || !strings.HasPrefix(out, "llm-queue-proxy dev\n") {
+		t.Errorf("version = (%d, %q), want llm-queue-proxy dev", code, out)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/marketconnect/llm-queue-proxy/app/app"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+// sessions runs the sessions subcommands against the configured repository
+func sessions(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageError("expected: sessions list|export|delete")
+	}
+	subcommand, args := args[0], args[1:]
+
+	switch subcommand {
+	case "list":
+		return withStorage(func(storage repository.Storage) error {
+			return listSessions(storage, stdout)
+		})
+	case "export":
+		flags := newFlagSet("sessions export")
+		output := flags.String("o", "", "write to this file instead of stdout")
+		if err := flags.Parse(args); err != nil {
+			return usageError("%v", err)
+		}
+		return withStorage(func(storage repository.Storage) error {
+			if *output == "" {
+				return exportSessions(storage, stdout)
+			}
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			if err := exportSessions(storage, f); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	case "delete":
+		if len(args) == 0 {
+			return usageError("expected: sessions delete <id>...")
+		}
+		return withStorage(func(storage repository.Storage) error {
+			return deleteSessions(storage, args, stdout)
+		})
+	default:
+		return usageError("unknown sessions command %q", subcommand)
+	}
+}
+
+// withStorage opens the configured persistent repository for the duration of fn
+func withStorage(fn func(storage repository.Storage) error) error {
+	cfg, err := config.NewConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Repository.Type != "sqlite" {
+		return fmt.Errorf("the %s repository does not persist sessions; set REPOSITORY_TYPE=sqlite", cfg.Repository.Type)
+	}
+	storage, err := app.NewStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	return fn(storage)
+}
+
+// sortedSessions returns all sessions ordered by ID
+func sortedSessions(repo repository.Repository) ([]*entities.SessionData, error) {
+	sessionsByID, err := repo.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*entities.SessionData, 0, len(sessionsByID))
+	for _, sess := range sessionsByID {
+		list = append(list, sess)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].SessionID < list[j].SessionID })
+	return list, nil
+}
+
+// listSessions prints a table of sessions and their usage
+func listSessions(repo repository.Repository, w io.Writer) error {
+	list, err := sortedSessions(repo)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL\t4XX\t5XX")
+	for _, sess := range list {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", sess.SessionID, sess.RequestCount,
+			sess.TotalPromptTokens, sess.TotalCompletionTokens, sess.TotalTokens, sess.Responses4xx, sess.Responses5xx)
+	}
+	return tw.Flush()
+}
+
+// exportSessions writes all sessions as the JSONL export of the admin API's
+// /sessions/export, which /sessions/import reads
+func exportSessions(repo repository.Repository, w io.Writer) error {
+	sessions, err := repo.ListSessions()
+	if err != nil {
+		return err
+	}
+	return entities.WriteSessionExport(w, sessions)
+}
+
+// deleteSessions deletes the given sessions, continuing past missing ones
+func deleteSessions(repo repository.Repository, ids []string, w io.Writer) error {
+	var missing []string
+	for _, id := range ids {
+		err := repo.DeleteSession(id)
+		switch {
+		case errors.Is(err, entities.ErrSessionNotFound):
+			missing = append(missing, id)
+		case err != nil:
+			return err
+		default:
+			fmt.Fprintf(w, "Deleted session %s\n", id)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("sessions not found: %v", missing)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package entities
+
+import "net/url"
+
+// Replica is an instance of the proxy that sessions can be pinned to
+type Replica struct {
+	Name string
+	URL  *url.URL
+}
+
+// AffinitySettings configure the session affinity hints of responses and the
+// forwarding of session requests between replicas
+type AffinitySettings struct {
+	// Header names the response header carrying the hint
+	Header string
+	// Cookie names a cookie also carrying the hint; empty sets none
+	Cookie string
+	// Replicas own sessions by consistent hashing; without replicas the hint
+	// is a hash of the session ID
+	Replicas []Replica
+	// Self is the name of this instance among Replicas
+	Self string
+	// Forward proxies requests of sessions owned by another replica to it
+	Forward bool
+	// Secret is shared by the replicas to authenticate forwarded requests
+	Secret string
+}
@@ -0,0 +1,95 @@
+package entities
+
+import "time"
+
+const (
+	// AlertSessionBudget fires when a session's token usage crosses a percentage of its budget
+	AlertSessionBudget = "session_budget"
+	// AlertUpstreamErrorRate fires when the share of failed upstream responses exceeds a threshold
+	AlertUpstreamErrorRate = "upstream_error_rate"
+	// AlertQueueDepth fires when a queue stays deeper than a limit for too long
+	AlertQueueDepth = "queue_depth"
+	// AlertSessionAnomaly fires when a session consumes far more tokens than its baseline
+	AlertSessionAnomaly = "session_anomaly"
+)
+
+// Alert is an operational event sent to the configured webhooks
+type Alert struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	// SessionID is set for session budget and anomaly alerts
+	SessionID string `json:"session_id,omitempty"`
+	// Queue is set for queue depth alerts
+	Queue string `json:"queue,omitempty"`
+	// Value is the observed value and Threshold the configured limit it crossed
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	At        time.Time `json:"at"`
+}
+
+// SessionBudgets are the token budgets of sessions
+type SessionBudgets struct {
+	// Default applies to sessions without an explicit budget; 0 means unlimited
+	Default int
+	// Sessions are budgets keyed by session ID or session tag; the session ID wins
+	Sessions map[string]int
+}
+
+// BudgetFor returns the token budget of a session, or 0 if it has none
+func (b SessionBudgets) BudgetFor(sessionID string) int {
+	if budget, ok := b.Sessions[sessionID]; ok {
+		return budget
+	}
+	if tag := SessionTag(sessionID); tag != "" {
+		if budget, ok := b.Sessions[tag]; ok {
+			return budget
+		}
+	}
+	return b.Default
+}
+
+// AlertSettings configures when alerts fire
+type AlertSettings struct {
+	// BudgetThresholds are percentages of a session budget that fire an alert when crossed
+	BudgetThresholds []int
+	// ErrorRate is the percentage of failed upstream responses that fires an alert; 0 disables
+	ErrorRate float64
+	// ErrorRateWindow is the sliding window the error rate is computed over
+	ErrorRateWindow time.Duration
+	// ErrorRateMinRequests is the number of responses in the window needed before the rate is evaluated
+	ErrorRateMinRequests int
+	// QueueDepth is the number of pending requests a queue must stay above to fire an alert; 0 disables
+	QueueDepth int
+	// QueueDepthDuration is how long the depth must stay above QueueDepth
+	QueueDepthDuration time.Duration
+	// Cooldown is the minimum time between two alerts of the same kind and subject
+	Cooldown time.Duration
+}
+
+// AnomalySettings configures the detection of sessions consuming tokens far
+// above their baseline
+type AnomalySettings struct {
+	// ZScore is how many standard deviations above its baseline a session's
+	// consumption over an interval must be to be flagged
+	ZScore float64
+	// MinTokens is the consumption below which an interval is never flagged
+	MinTokens int
+	// MinSamples is the number of intervals a baseline needs before it is used
+	MinSamples int
+	// Alpha is the weight of the latest interval in the moving baseline, in (0, 1]
+	Alpha float64
+}
+
+// SessionAnomaly is an interval in which a session consumed far more tokens
+// than its baseline
+type SessionAnomaly struct {
+	SessionID string `json:"session_id"`
+	// Tokens were consumed over the interval ending at DetectedAt
+	Tokens int `json:"tokens"`
+	// Baseline and StdDev are the session's moving average consumption per
+	// interval and its deviation
+	Baseline   float64   `json:"baseline"`
+	StdDev     float64   `json:"std_dev"`
+	ZScore     float64   `json:"z_score"`
+	DetectedAt time.Time `json:"detected_at"`
+}
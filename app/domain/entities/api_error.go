@@ -0,0 +1,28 @@
+package entities
+
+// APIError describes an error in the OpenAI error envelope format
+type APIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// ErrorResponse is the top-level OpenAI error envelope: {"error": {...}}
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// NewErrorResponse builds an error envelope. An empty code is encoded as null.
+func NewErrorResponse(message, errType, code string) ErrorResponse {
+	resp := ErrorResponse{
+		Error: APIError{
+			Message: message,
+			Type:    errType,
+		},
+	}
+	if code != "" {
+		resp.Error.Code = &code
+	}
+	return resp
+}
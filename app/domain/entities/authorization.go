@@ -0,0 +1,18 @@
+package entities
+
+import "context"
+
+type annotationsContextKey struct{}
+
+// ContextWithAnnotations returns a copy of ctx carrying the session metadata
+// the authorization service attached to a request
+func ContextWithAnnotations(ctx context.Context, annotations map[string]string) context.Context {
+	return context.WithValue(ctx, annotationsContextKey{}, annotations)
+}
+
+// AnnotationsFromContext returns the session metadata attached to a request,
+// or nil if it has none
+func AnnotationsFromContext(ctx context.Context) map[string]string {
+	annotations, _ := ctx.Value(annotationsContextKey{}).(map[string]string)
+	return annotations
+}
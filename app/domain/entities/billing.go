@@ -0,0 +1,21 @@
+package entities
+
+import "time"
+
+// MeterEvent is a usage report for a billing customer
+type MeterEvent struct {
+	// EventName identifies the meter the usage is recorded on
+	EventName  string
+	CustomerID string
+	Value      int
+	// Identifier makes retries of the same report idempotent
+	Identifier string
+	Timestamp  time.Time
+}
+
+// MeteringSettings configures how session usage is reported for billing
+type MeteringSettings struct {
+	EventName string
+	// CustomerMetadataKey is the session metadata key holding the billing customer ID
+	CustomerMetadataKey string
+}
@@ -0,0 +1,53 @@
+package entities
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidBudgetTransfer is returned for transfers the budgets cannot cover
+var ErrInvalidBudgetTransfer = errors.New("invalid budget transfer")
+
+// BudgetTransfer moves token budget from one budget key to another. Keys are
+// session IDs or session tags, like those of SESSION_TOKEN_BUDGETS. The
+// transfers are kept as the audit log of budget changes. A transfer without
+// a source sets the budget of a cloned session; its Tokens may be negative.
+type BudgetTransfer struct {
+	ID     int64  `json:"id"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to"`
+	Tokens int    `json:"tokens"`
+	// Reason is a note of the operator who made the transfer
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BudgetAllocation is the token budget of a key after transfers
+type BudgetAllocation struct {
+	Key string `json:"key"`
+	// Configured is the budget the key has without its own transfers,
+	// configured or inherited from its tag or the default
+	Configured  int `json:"configured"`
+	Transferred int `json:"transferred"`
+	Budget      int `json:"budget"`
+}
+
+// BudgetWarningSettings configures the warnings added to the responses of
+// sessions running low on budget
+type BudgetWarningSettings struct {
+	// Percent is the share of its budget a session must have used
+	Percent int
+	// Body also adds the warning to the JSON body of chat completions
+	Body bool
+}
+
+// BudgetOverdraft lets the sessions of a tier keep sending requests once
+// their budget is used up, so agents are not cut off mid-conversation. With
+// both an allowance and a grace period, the first to run out ends the
+// overdraft; with neither, sessions are blocked at their budget.
+type BudgetOverdraft struct {
+	// Tokens is how far past its budget a session may go; 0 sets no allowance
+	Tokens int
+	// Grace is how long a session may keep going once past its budget; 0 sets no period
+	Grace time.Duration
+}
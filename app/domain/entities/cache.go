@@ -0,0 +1,22 @@
+package entities
+
+import "time"
+
+// CacheEntry is a stored upstream response that can be replayed for identical requests
+type CacheEntry struct {
+	Key             string
+	Body            []byte
+	ContentType     string
+	ContentEncoding string
+	// PromptTokens is the usage the original upstream call was billed for
+	PromptTokens int
+	CreatedAt    time.Time
+}
+
+// CacheStats summarises cache effectiveness since startup
+type CacheStats struct {
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRate     float64 `json:"hit_rate"`
+	TokensSaved int64   `json:"tokens_saved"`
+}
@@ -0,0 +1,20 @@
+package entities
+
+// FaultRule injects faults into the requests of a session tag or virtual
+// key, so clients can test their retry logic against the proxy
+type FaultRule struct {
+	// SessionTag and VirtualKeyID scope the rule; at least one is set, and a
+	// request must match both when both are
+	SessionTag   string `json:"session_tag,omitempty"`
+	VirtualKeyID string `json:"virtual_key_id,omitempty"`
+	// ErrorPercent of the requests are answered with ErrorStatus, 429 if
+	// unset, without reaching the upstream
+	ErrorPercent float64 `json:"error_percent,omitempty"`
+	ErrorStatus  int     `json:"error_status,omitempty"`
+	// LatencyMs is added to every request before it is forwarded
+	LatencyMs int64 `json:"latency_ms,omitempty"`
+	// DropStreamPercent of the event stream responses are cut off after
+	// DropAfterBytes, or halfway through shorter streams
+	DropStreamPercent float64 `json:"drop_stream_percent,omitempty"`
+	DropAfterBytes    int64   `json:"drop_after_bytes,omitempty"`
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "context"
+
+type clientIPContextKey struct{}
+
+// ContextWithClientIP returns a copy of ctx carrying the address of the client
+// that sent a request
+func ContextWithClientIP(ctx context.Context, clientIP string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, clientIP)
+}
+
+// ClientIPFromContext returns the client address of a request, or an empty
+// string if it was not resolved
+func ClientIPFromContext(ctx context.Context) string {
+	clientIP, _ := ctx.Value(clientIPContextKey{}).(string)
+	return clientIP
+}
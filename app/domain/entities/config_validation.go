@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes an invalid configuration value
+type FieldError struct {
+	// Field is the path of the field in the config file, e.g. tokens.limit_policy
+	Field string
+	// Env is the environment variable that sets the field
+	Env     string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Field, e.Env, e.Message)
+}
+
+// ValidationError lists every invalid field of a configuration
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		problems[i] = field.Error()
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
@@ -0,0 +1,75 @@
+package entities
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultMaxDecodedBytes caps how large a compressed response body may grow
+// when it is decompressed for inspection
+const DefaultMaxDecodedBytes = 64 << 20
+
+// ErrUnsupportedEncoding is returned for response bodies in a content encoding
+// the proxy cannot decompress
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ErrDecodedBodyTooLarge is returned when a decompressed body exceeds its limit
+var ErrDecodedBodyTooLarge = errors.New("decompressed body exceeds the size limit")
+
+// DecodeBody undoes the Content-Encoding of a body: gzip and deflate are
+// supported, and a list of encodings is undone last to first. Decompression
+// stops with ErrDecodedBodyTooLarge once the output passes limit bytes, which
+// guards against compression bombs; a limit of 0 or less disables the check.
+// Brotli and zstd bodies return ErrUnsupportedEncoding, as does any other
+// encoding.
+func DecodeBody(body []byte, contentEncoding string, limit int64) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		var reader io.ReadCloser
+		var err error
+		switch encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			// Deflate is meant to be zlib-wrapped, but some servers send a raw stream
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				reader, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s body: %w", encoding, err)
+		}
+		body, err = readLimited(reader, limit)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s body: %w", encoding, err)
+		}
+	}
+	return body, nil
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrDecodedBodyTooLarge
+	}
+	return body, nil
+}
@@ -0,0 +1,25 @@
+package entities
+
+// ContentFallbackSettings configures the retry of requests blocked by the
+// upstream's content filter
+type ContentFallbackSettings struct {
+	// Model replaces the request's model in the retry; empty keeps it
+	Model string
+	// SystemPrompt is prepended to the messages of the retry; empty adds none
+	SystemPrompt string
+	// Codes are the upstream error codes or types that trigger the retry
+	Codes []string
+}
+
+// ContentFallback records that a request was retried after the upstream's
+// content filter blocked it
+type ContentFallback struct {
+	// Reason is the error code or finish reason of the blocked response
+	Reason string `json:"reason"`
+	// StatusCode is the status of the blocked response
+	StatusCode int `json:"status_code"`
+	// Model is the model of the retry, if it was replaced
+	Model string `json:"model,omitempty"`
+	// SystemPrompt is set when the retry carried the safety system prompt
+	SystemPrompt bool `json:"system_prompt,omitempty"`
+}
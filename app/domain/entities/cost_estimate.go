@@ -0,0 +1,15 @@
+package entities
+
+// CostEstimate is the estimated cost of a request, computed locally from its
+// prompt tokens and completion token limit without calling the upstream
+type CostEstimate struct {
+	Model        string `json:"model,omitempty"`
+	PromptTokens int    `json:"prompt_tokens"`
+	// MaxCompletionTokens is the completion token limit of the request, if it
+	// sets one; the completion costs at most this many tokens
+	MaxCompletionTokens int     `json:"max_completion_tokens,omitempty"`
+	PromptCost          float64 `json:"prompt_cost_usd"`
+	MaxCompletionCost   float64 `json:"max_completion_cost_usd"`
+	// EstimatedCost is the prompt cost plus the maximum completion cost
+	EstimatedCost float64 `json:"estimated_cost_usd"`
+}
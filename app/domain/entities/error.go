@@ -1,5 +1,67 @@
 package entities
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrSessionNotFound = errors.New("session not found")
+
+// ErrSessionExists is returned when cloning into a session ID that is taken
+var ErrSessionExists = errors.New("session already exists")
+
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrQueueFull is returned for requests a queue has no room for
+var ErrQueueFull = errors.New("queue is full")
+
+// SessionQueueFullError is returned for requests of a session that already
+// has the maximum number of requests queued. It matches ErrQueueFull.
+type SessionQueueFullError struct {
+	SessionID string
+	// Queued is how many requests the session has queued
+	Queued int
+	Max    int
+}
+
+func (e *SessionQueueFullError) Error() string {
+	return fmt.Sprintf("session %s already has %d of at most %d requests queued", e.SessionID, e.Queued, e.Max)
+}
+
+func (e *SessionQueueFullError) Unwrap() error {
+	return ErrQueueFull
+}
+
+// ErrQueueClosed is returned for requests pushed to a queue that is shutting down
+var ErrQueueClosed = errors.New("queue is shutting down")
+
+// ErrBudgetExceeded is returned for requests of a session that has exhausted its token budget
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// RequestError is returned when the proxy rejects a request itself.
+// It carries the HTTP status and the fields of the OpenAI error envelope.
+type RequestError struct {
+	StatusCode int
+	Message    string
+	Type       string
+	Code       string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// Envelope returns the error in the OpenAI error envelope format
+func (e *RequestError) Envelope() ErrorResponse {
+	return NewErrorResponse(e.Message, e.Type, e.Code)
+}
+
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// ErrTenantExists is returned when creating a tenant whose ID is taken
+var ErrTenantExists = errors.New("tenant already exists")
+
+var ErrVirtualKeyNotFound = errors.New("virtual key not found")
+
+// ErrThreadNotFound is returned for Assistants API threads not mapped to a session
+var ErrThreadNotFound = errors.New("thread not found")
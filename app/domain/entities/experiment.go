@@ -0,0 +1,26 @@
+package entities
+
+// ModelVariant is one arm of a weighted model routing rule
+type ModelVariant struct {
+	Model  string
+	Weight int
+}
+
+// ModelSplit routes requests for Model to weighted variants. When Tag is set,
+// the rule only applies to sessions with that tag.
+type ModelSplit struct {
+	Tag      string
+	Model    string
+	Variants []ModelVariant
+}
+
+// VariantUsage is the traffic and token usage routed to one variant of a split
+type VariantUsage struct {
+	Tag              string `json:"tag,omitempty"`
+	Model            string `json:"model"`
+	Variant          string `json:"variant"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
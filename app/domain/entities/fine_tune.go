@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// FineTuneJob is an upstream fine-tuning job created through a session. It is
+// polled until it finishes, when its trained tokens are counted against the
+// session.
+type FineTuneJob struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	// Model is the base model being fine-tuned, used for pricing
+	Model         string     `json:"model"`
+	Status        string     `json:"status"`
+	TrainedTokens int        `json:"trained_tokens,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Fixture modes
+const (
+	FixtureModeRecord = "record"
+	FixtureModeReplay = "replay"
+)
+
+// ErrFixtureNotFound is returned for requests no fixture was recorded for
+var ErrFixtureNotFound = errors.New("fixture not found")
+
+// Fixture is a recorded upstream response, served instead of calling the
+// upstream when the proxy runs in replay mode
+type Fixture struct {
+	// Key identifies the request the response was recorded for
+	Key    string `json:"key"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Request is the request body, kept so fixtures can be reviewed; it is
+	// empty for binary bodies
+	Request    string      `json:"request,omitempty"`
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	// Body holds text response bodies and BinaryBody the others
+	Body       string    `json:"body,omitempty"`
+	BinaryBody []byte    `json:"binary_body,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
@@ -0,0 +1,15 @@
+package entities
+
+import "net/netip"
+
+// IPRules restrict which client addresses may use the proxy and admin listeners
+type IPRules struct {
+	// Allowed and AdminAllowed are the allowlists of the proxy and admin
+	// listeners; an empty list allows every address
+	Allowed      []netip.Prefix
+	AdminAllowed []netip.Prefix
+	// Denied addresses are rejected on both listeners
+	Denied []netip.Prefix
+	// TrustedProxies are reverse proxies whose X-Forwarded-For header identifies the client
+	TrustedProxies []netip.Prefix
+}
@@ -0,0 +1,18 @@
+package entities
+
+import "time"
+
+// JetStreamSettings configure the jetstream queue backend
+type JetStreamSettings struct {
+	// Stream is the work-queue stream requests are published to; queue RPMs
+	// are paced through a second stream named Stream + "_PACING"
+	Stream string
+	// Subject prefixes the subjects of the streams: requests are published
+	// to <Subject>.requests.<queue>
+	Subject string
+	// AckWait is how long a replica may hold a request without reporting
+	// progress before it is redelivered to another replica
+	AckWait time.Duration
+	// ReplyTimeout bounds how long a request waits for its response
+	ReplyTimeout time.Duration
+}
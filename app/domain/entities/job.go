@@ -0,0 +1,99 @@
+package entities
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// Job is an asynchronously executed proxy request
+type Job struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	SessionID string `json:"session_id,omitempty"`
+	// TenantID is the tenant that submitted the job in multi-tenant mode
+	TenantID string `json:"-"`
+	// VirtualKeyID is the virtual key the job was submitted with, if any
+	VirtualKeyID string `json:"-"`
+	// Owner is the instance that runs the job, empty for a single instance
+	Owner               string      `json:"-"`
+	Method              string      `json:"method"`
+	Path                string      `json:"path"`
+	RequestHeaders      http.Header `json:"-"`
+	RequestBody         []byte      `json:"-"`
+	ResponseStatus      int         `json:"response_status,omitempty"`
+	ResponseBody        []byte      `json:"-"`
+	ResponseContentType string      `json:"-"`
+	Error               string      `json:"error,omitempty"`
+	// Queue is set while the job waits in the proxy queue; it is not persisted
+	Queue     *QueueEstimate `json:"queue,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Result returns the response body of a completed job as JSON. Non-JSON
+// bodies are returned as a JSON string.
+func (j *Job) Result() json.RawMessage {
+	if j.Status != JobStatusCompleted || len(j.ResponseBody) == 0 {
+		return nil
+	}
+	if json.Valid(j.ResponseBody) {
+		return j.ResponseBody
+	}
+	encoded, err := json.Marshal(string(j.ResponseBody))
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// JobRequest is the body of a job submission
+type JobRequest struct {
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	SessionID string          `json:"session_id"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// Validate applies defaults and checks that the job targets an upstream endpoint
+func (r *JobRequest) Validate() *RequestError {
+	if r.Method == "" {
+		r.Method = http.MethodPost
+	}
+	r.Method = strings.ToUpper(r.Method)
+
+	switch {
+	case !strings.HasPrefix(r.Path, "/v1/"),
+		strings.HasPrefix(r.Path, "/v1/jobs"),
+		strings.HasPrefix(r.Path, "/v1/session/"):
+		return &RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Job path must be an upstream endpoint such as /v1/chat/completions",
+			Type:       "invalid_request_error",
+			Code:       "invalid_job_path",
+		}
+	case strings.Contains(r.SessionID, "/"):
+		return &RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid session_id",
+			Type:       "invalid_request_error",
+		}
+	}
+	return nil
+}
+
+// JobStatusResponse is returned when polling a job. Result holds the upstream
+// response body once the job has completed.
+type JobStatusResponse struct {
+	*Job
+	Result json.RawMessage `json:"result,omitempty"`
+}
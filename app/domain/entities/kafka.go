@@ -0,0 +1,49 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// KafkaSettings configure the consumption of requests from a Kafka topic
+// through a Kafka REST Proxy
+type KafkaSettings struct {
+	// RESTURL is the base URL of the REST Proxy (v2 API)
+	RESTURL  string
+	Username string
+	Password string
+	// Group is the consumer group; replicas in the same group share the
+	// partitions of InputTopic
+	Group       string
+	InputTopic  string
+	OutputTopic string
+	// Concurrency bounds the records of a poll processed at the same time
+	Concurrency int
+	// PollTimeout is how long a poll waits for records
+	PollTimeout time.Duration
+}
+
+// KafkaRequest is the value of a record of the input topic: a job request
+// with an optional ID copied to its result
+type KafkaRequest struct {
+	ID string `json:"id"`
+	JobRequest
+	// Headers identify the tenant when TENANT_MODE is set, as the headers of
+	// an HTTP request would
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// KafkaResult is the value of the record written to the output topic for
+// each input record, with the input record's key
+type KafkaResult struct {
+	ID        string `json:"id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	// StatusCode is the upstream status, 400 for invalid records, or 502 when
+	// the request could not be sent
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	// Partition and Offset locate the input record
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// Lease grants one instance the right to run a coordinated task until it expires
+type Lease struct {
+	Name string
+	// Holder identifies the instance holding the lease
+	Holder    string
+	ExpiresAt time.Time
+}
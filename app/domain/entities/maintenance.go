@@ -0,0 +1,20 @@
+package entities
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidMaintenance is returned for maintenance settings that cannot apply
+var ErrInvalidMaintenance = errors.New("invalid maintenance settings")
+
+// MaintenanceState is the maintenance mode of the proxy. While it is enabled,
+// new proxy requests are answered with 503 and the reason; requests already
+// queued are still forwarded.
+type MaintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	// RetryAfterSeconds is sent in the Retry-After header of rejected requests
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
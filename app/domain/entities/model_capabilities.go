@@ -0,0 +1,15 @@
+package entities
+
+// ModelCapabilities describes what a model supports. Unset fields are not
+// checked, so only the known limitations of a model need to be listed.
+type ModelCapabilities struct {
+	// Vision allows image inputs
+	Vision *bool `json:"vision,omitempty"`
+	// Tools allows tool and function calling
+	Tools *bool `json:"tools,omitempty"`
+	// JSONMode allows JSON object and JSON schema response formats
+	JSONMode *bool `json:"json_mode,omitempty"`
+	// ContextWindow bounds the estimated prompt plus the requested completion
+	// tokens; 0 leaves it unchecked
+	ContextWindow int `json:"context_window,omitempty"`
+}
@@ -0,0 +1,20 @@
+package entities
+
+// ModelList is the response of GET /v1/models
+type ModelList struct {
+	Object string      `json:"object"`
+	Data   []ModelInfo `json:"data"`
+}
+
+// ModelInfo is a model of the list. Providers and Pricing are added by the
+// proxy when it merges the lists of several upstreams.
+type ModelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	// Providers are the names of the upstreams serving the model
+	Providers []string `json:"providers,omitempty"`
+	// Pricing is the unit prices of PRICING that apply to the model
+	Pricing map[string]float64 `json:"pricing,omitempty"`
+}
@@ -0,0 +1,30 @@
+package entities
+
+const (
+	// ModerationActionBlock rejects requests that exceed a category threshold
+	ModerationActionBlock = "block"
+	// ModerationActionFlag forwards them and only records the result
+	ModerationActionFlag = "flag"
+)
+
+// ModerationResult is the outcome of a moderation pre-check on a prompt
+type ModerationResult struct {
+	// Flagged reports whether any category exceeded its threshold
+	Flagged bool `json:"flagged"`
+	// Blocked reports whether the request was rejected because of it
+	Blocked bool `json:"blocked"`
+	// Categories lists the categories that exceeded their thresholds; classifiers
+	// report the categories they flag themselves
+	Categories []string           `json:"categories,omitempty"`
+	Scores     map[string]float64 `json:"scores,omitempty"`
+}
+
+// ModerationSettings configures how moderation results are acted upon
+type ModerationSettings struct {
+	// Action is ModerationActionBlock or ModerationActionFlag
+	Action string
+	// Thresholds are per-category score thresholds
+	Thresholds map[string]float64
+	// DefaultThreshold applies to other categories; 0 defers to the classifier's own flags
+	DefaultThreshold float64
+}
@@ -0,0 +1,30 @@
+package entities
+
+import "encoding/json"
+
+// DefaultPolicyTag selects the parameter policy for sessions without a policy of their own
+const DefaultPolicyTag = "*"
+
+// ParameterPolicy constrains the parameters of request bodies before forwarding
+type ParameterPolicy struct {
+	// Forbid rejects requests that set any of these fields
+	Forbid []string `json:"forbid,omitempty"`
+	// Strip removes these fields from requests
+	Strip []string `json:"strip,omitempty"`
+	// Ranges bounds numeric fields such as temperature or top_p
+	Ranges map[string]ParameterRange `json:"ranges,omitempty"`
+	// MaxTokens clamps max_tokens and its aliases; 0 disables it
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// Defaults sets fields that the request leaves unset
+	Defaults map[string]json.RawMessage `json:"defaults,omitempty"`
+	// Force overwrites fields regardless of the request's value
+	Force map[string]json.RawMessage `json:"force,omitempty"`
+}
+
+// ParameterRange bounds a numeric field. Out-of-range values are clamped when
+// Clamp is set and rejected otherwise.
+type ParameterRange struct {
+	Min   *float64 `json:"min,omitempty"`
+	Max   *float64 `json:"max,omitempty"`
+	Clamp bool     `json:"clamp,omitempty"`
+}
@@ -0,0 +1,21 @@
+package entities
+
+// Policies for requests that exceed prompt or completion token limits. A
+// model's context window may also be kept by summarizing the dropped messages.
+const (
+	LimitPolicyReject    = "reject"
+	LimitPolicyTruncate  = "truncate"
+	LimitPolicySummarize = "summarize"
+)
+
+// PromptLimits configures pre-flight token limits on request bodies
+type PromptLimits struct {
+	// MaxPromptTokens caps the estimated prompt size of every request; 0 disables it
+	MaxPromptTokens int
+	// SessionMaxPromptTokens overrides MaxPromptTokens for individual sessions
+	SessionMaxPromptTokens map[string]int
+	// MaxCompletionTokens caps max_tokens (and its newer aliases); 0 disables it
+	MaxCompletionTokens int
+	// Policy is LimitPolicyReject or LimitPolicyTruncate
+	Policy string
+}
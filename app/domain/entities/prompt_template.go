@@ -0,0 +1,11 @@
+package entities
+
+import "encoding/json"
+
+// PromptTemplate holds the messages injected ahead of a chat completion's own messages
+type PromptTemplate struct {
+	// System, when set, is injected as the first system message
+	System string `json:"system,omitempty"`
+	// Messages are injected after System, e.g. few-shot examples
+	Messages []json.RawMessage `json:"messages,omitempty"`
+}
@@ -1,11 +1,63 @@
 package entities
 
-import "net/http"
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
 
 type ProxyRequest struct {
+	// SessionID is the tracking session the request belongs to; empty for passthrough requests
+	SessionID string
+	// TenantID is the tenant the request belongs to in multi-tenant mode
+	TenantID string
+	// VirtualKeyID is the virtual key the request was made with, if any
+	VirtualKeyID string
+	// Residency is the region the request must be processed in, set from its
+	// tenant; upstreams in other regions are not sent the request
+	Residency string
+	// ResidencyChecked is set when the residency was checked against the
+	// primary upstream as the tenant was resolved, so Residency holds it
+	ResidencyChecked bool
+	// ClientIP is the address of the client that sent the request, if known
+	ClientIP string
+	// APIKey, when set, is used upstream instead of the proxy's OpenAI key
+	APIKey  string
 	Method  string
 	Path    string
 	Headers http.Header
 	Body    []byte
-	Reply   chan ProxyResponse
+	// BodyStream, when set, is sent upstream instead of Body without buffering
+	// (e.g. multipart uploads). ContentLength is its size, or -1 if unknown.
+	BodyStream    io.Reader
+	ContentLength int64
+	// StreamResponseAbove, when positive, lets the queue return response
+	// bodies larger than this many bytes, or of unknown length, as a
+	// ProxyResponse.BodyStream instead of reading them into memory. Decorators
+	// that need the whole response body reset it.
+	StreamResponseAbove int64
+	// Deadline is when the request stops being worth dispatching; zero means none
+	Deadline time.Time
+	// OnEnqueue, when set, is called with the request's place in the queue
+	OnEnqueue func(QueueEstimate)
+	// EnqueuedAt is set by the queue when the request starts waiting
+	EnqueuedAt time.Time
+	// Moderation is the result of the moderation pre-check, if one ran
+	Moderation *ModerationResult
+	// ReplayOf is the ID of the history record the request replays, if any
+	ReplayOf int64
+	Reply    chan ProxyResponse
+}
+
+// BodyModel returns the model named in a JSON request body, or an empty
+// string for bodies without one
+func BodyModel(body []byte) string {
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.Model
 }
@@ -1,10 +1,40 @@
 package entities
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+	"time"
+)
 
 type ProxyResponse struct {
 	StatusCode int
 	Headers    http.Header
 	Body       []byte
+	// BodyStream, when set, holds the body instead of Body; whoever receives
+	// the response must close it
+	BodyStream io.ReadCloser
 	Err        error
+	// Cached is set when the response did not cost a dedicated upstream call:
+	// it was served from a local cache or shared with an identical in-flight request
+	Cached bool
+	// QueueWait is how long the request waited in the queue before dispatch
+	QueueWait time.Duration
+	// UpstreamLatency is how long the upstream took to respond, including hedges
+	UpstreamLatency time.Duration
+	// Fallback is set when the response is that of a retry after the
+	// upstream's content filter blocked the request
+	Fallback *ContentFallback
+	// UpstreamError is the classification of an upstream error response
+	UpstreamError *UpstreamError
+}
+
+// DecodedBody returns the response body, decompressed if it is gzipped or
+// deflated, up to DefaultMaxDecodedBytes. If the body cannot be decompressed it
+// is returned as is.
+func (r ProxyResponse) DecodedBody() []byte {
+	body, err := DecodeBody(r.Body, r.Headers.Get("Content-Encoding"), DefaultMaxDecodedBytes)
+	if err != nil {
+		return r.Body
+	}
+	return body
 }
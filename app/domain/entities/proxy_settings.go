@@ -0,0 +1,23 @@
+package entities
+
+import "time"
+
+// ProxySettings holds the limits and policies applied by the proxy handler
+type ProxySettings struct {
+	// MaxBodyBytes caps buffered request bodies; 0 means unlimited
+	MaxBodyBytes int64
+	// MaxUploadBytes caps streamed multipart uploads; 0 means unlimited
+	MaxUploadBytes int64
+	// HeartbeatInterval is how often streaming requests waiting in the queue
+	// are sent SSE heartbeats; 0 disables them
+	HeartbeatInterval time.Duration
+	// StreamResponseBytes is the response size above which upstream bodies
+	// are streamed to the client instead of buffered; 0 buffers every body
+	StreamResponseBytes int64
+	// MaxDecodedBytes caps how far compressed response bodies are inflated
+	// for usage parsing; 0 means unlimited
+	MaxDecodedBytes int64
+	// OmitResponseBodyLogs keeps upstream response bodies out of the logs,
+	// which request filters such as redaction never see
+	OmitResponseBodyLogs bool
+}
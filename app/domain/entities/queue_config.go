@@ -0,0 +1,120 @@
+package entities
+
+import (
+	"slices"
+	"time"
+)
+
+// QueueConfig configures the throughput of a named queue
+type QueueConfig struct {
+	Name              string
+	RequestsPerMinute int
+	// TokensPerMinute caps estimated prompt tokens dispatched per minute; 0 disables
+	TokensPerMinute int
+	// Workers caps concurrent upstream requests; 0 means unlimited
+	Workers int
+	Hedge   HedgeConfig
+	// Priority lets interactive requests overtake batch requests
+	Priority PriorityPolicy
+	// Schedule overrides the limits during recurring windows; the first
+	// window active at a given time applies
+	Schedule []RateWindow
+	// Exempt requests are dispatched without waiting for the queue's limits
+	Exempt RateLimitExemptions
+}
+
+// RateLimitExemptions are the sessions and virtual keys whose requests skip
+// the rate limits of their queue, such as health-check probes
+type RateLimitExemptions struct {
+	// Sessions are session IDs, qualified by their tenant in multi-tenant mode
+	Sessions    []string
+	VirtualKeys []string
+}
+
+// Exempts reports whether a request is exempt from the rate limits
+func (e RateLimitExemptions) Exempts(r ProxyRequest) bool {
+	return (r.SessionID != "" && slices.Contains(e.Sessions, r.SessionID)) ||
+		(r.VirtualKeyID != "" && slices.Contains(e.VirtualKeys, r.VirtualKeyID))
+}
+
+// LimitsAt returns the requests and tokens per minute in effect at t
+func (c QueueConfig) LimitsAt(t time.Time) (requestsPerMinute, tokensPerMinute int) {
+	for _, window := range c.Schedule {
+		if !window.Contains(t) {
+			continue
+		}
+		tokensPerMinute = c.TokensPerMinute
+		if window.TokensPerMinute > 0 {
+			tokensPerMinute = window.TokensPerMinute
+		}
+		return window.RequestsPerMinute, tokensPerMinute
+	}
+	return c.RequestsPerMinute, c.TokensPerMinute
+}
+
+// RateWindow is a weekly recurring time window with its own rate limits,
+// e.g. business hours
+type RateWindow struct {
+	// Days are the weekdays the window starts on
+	Days [7]bool
+	// Start and End are times of day as offsets from midnight; a window whose
+	// End is not after its Start ends on the following day
+	Start time.Duration
+	End   time.Duration
+	// Location is the time zone of Days, Start and End
+	Location          *time.Location
+	RequestsPerMinute int
+	// TokensPerMinute replaces the queue's TPM limit; 0 keeps it
+	TokensPerMinute int
+}
+
+// Contains reports whether t falls within the window
+func (w RateWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	if w.End > w.Start {
+		return w.Days[today] && sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	// The window crosses midnight
+	return (w.Days[today] && sinceMidnight >= w.Start) || (w.Days[yesterday] && sinceMidnight < w.End)
+}
+
+// HedgeConfig configures hedged requests: when the upstream has not responded
+// within After, a duplicate is sent and the first response wins.
+type HedgeConfig struct {
+	// After is the latency threshold that triggers a hedge; 0 disables hedging
+	After time.Duration
+	// BaseURL and APIKey address the hedge target; empty values reuse the primary's
+	BaseURL string
+	APIKey  string
+	// Paths lists the path prefixes eligible for hedging
+	Paths []string
+	// Region is the hedge target's region; requests are not hedged to it
+	// unless it satisfies their residency
+	Region string
+}
+
+// PriorityPolicy ranks waiting requests so that interactive ones, streamed
+// or with small prompts, go before large batch prompts. A batch request is
+// only overtaken by interactive requests enqueued less than Boost after it,
+// so it still runs once it has waited that long.
+type PriorityPolicy struct {
+	// Boost is the head start of interactive requests; 0 dispatches in order
+	Boost time.Duration
+	// SmallPromptTokens is the largest estimated prompt of an interactive request
+	SmallPromptTokens int
+}
+
+// QueueRoute sends requests matching a path prefix or model to a named queue.
+// Exactly one of PathPrefix and Model is set.
+type QueueRoute struct {
+	PathPrefix string
+	// Model matches the request's model; a trailing "*" matches by prefix
+	Model string
+	Queue string
+	// MaxStreams caps the concurrent streaming requests of each model matching
+	// a model route; 0 means unlimited
+	MaxStreams int
+}
@@ -0,0 +1,10 @@
+package entities
+
+import "time"
+
+// QueueEstimate is a request's place in the queue at the time it was enqueued
+type QueueEstimate struct {
+	// Position is 1 for the next request to be dispatched
+	Position   int       `json:"position"`
+	DispatchAt time.Time `json:"estimated_dispatch_at"`
+}
@@ -0,0 +1,54 @@
+package entities
+
+import "time"
+
+// QueueStats is a snapshot of a queue's backlog and how much of its rate
+// limits was used over the last minute
+type QueueStats struct {
+	Name string `json:"name"`
+	// Depth is the number of requests waiting in the queue or being dispatched
+	Depth              int `json:"depth"`
+	RequestsPerMinute  int `json:"requests_per_minute"`
+	RequestsLastMinute int `json:"requests_last_minute"`
+	// TokensPerMinute is 0 when the queue has no token limit, and
+	// TokensLastMinute is then not counted
+	TokensPerMinute  int `json:"tokens_per_minute"`
+	TokensLastMinute int `json:"tokens_last_minute"`
+	// Workers is 0 when concurrency is unlimited
+	Workers     int `json:"workers"`
+	BusyWorkers int `json:"busy_workers"`
+	// RequestUtilization and TokenUtilization are the shares of the limits
+	// used over the last minute, from 0 to 1
+	RequestUtilization float64 `json:"request_utilization"`
+	TokenUtilization   float64 `json:"token_utilization"`
+	// RetryBudget is set when retries are budgeted
+	RetryBudget *RetryBudgetStats `json:"retry_budget,omitempty"`
+}
+
+// RetryBudgetStats is the state of the retry budget shared by the queues:
+// the retries allowed and made over the last minute
+type RetryBudgetStats struct {
+	// Percent is the share of requests that may be retries
+	Percent  int `json:"percent"`
+	Requests int `json:"requests_last_minute"`
+	Retries  int `json:"retries_last_minute"`
+	// Available is how many more retries the budget allows right now
+	Available int  `json:"available"`
+	Exhausted bool `json:"exhausted"`
+}
+
+// QueueMinute is how a queue behaved over one minute of the queue history
+type QueueMinute struct {
+	Queue  string    `json:"queue"`
+	Minute time.Time `json:"minute"`
+	// Depth is sampled at the end of the minute, MaxDepth is the highest seen
+	Depth    int `json:"depth"`
+	MaxDepth int `json:"max_depth"`
+	// Dispatched counts the requests the queue sent upstream
+	Dispatched int `json:"dispatched"`
+	// Completed counts the responses returned, of which Errors were failures,
+	// 429s or 5xx responses, including requests that expired in the queue
+	Completed int                `json:"completed"`
+	Errors    int                `json:"errors"`
+	QueueWait LatencyPercentiles `json:"queue_wait_ms"`
+}
@@ -0,0 +1,8 @@
+package entities
+
+// RedactionStats counts the redactions applied to a session's requests by rule
+type RedactionStats struct {
+	SessionID  string         `json:"session_id"`
+	Redactions map[string]int `json:"redactions"`
+	Total      int            `json:"total"`
+}
@@ -0,0 +1,37 @@
+package entities
+
+import "errors"
+
+// ErrNotReplayable is returned for history records whose request body was not
+// captured in full, so the request cannot be re-sent
+var ErrNotReplayable = errors.New("request body was not captured in full")
+
+// ErrUnknownUpstream is returned for replays naming an upstream that is not configured
+var ErrUnknownUpstream = errors.New("unknown upstream")
+
+// ReplayOptions changes where and how a recorded request is re-sent
+type ReplayOptions struct {
+	// Model replaces the model of the request body; empty keeps it
+	Model string `json:"model,omitempty"`
+	// Upstream names the upstream the replay is sent to: "primary", the
+	// default, sends it through the proxy like the original, and "shadow" to
+	// the shadow upstream when one is configured
+	Upstream string `json:"upstream,omitempty"`
+}
+
+// ReplayResult is the outcome of a replayed request next to the record it
+// replayed, for comparison
+type ReplayResult struct {
+	// ReplayOf is the ID of the replayed record; the replay is recorded in
+	// the history with the same ReplayOf
+	ReplayOf          int64  `json:"replay_of"`
+	Upstream          string `json:"upstream"`
+	Model             string `json:"model,omitempty"`
+	StatusCode        int    `json:"status_code"`
+	Error             string `json:"error,omitempty"`
+	UpstreamLatencyMs int64  `json:"upstream_latency_ms"`
+	TotalMs           int64  `json:"total_ms"`
+	// Body is the response body of the replay
+	Body     string        `json:"body"`
+	Original RequestRecord `json:"original"`
+}
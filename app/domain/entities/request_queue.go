@@ -0,0 +1,29 @@
+package entities
+
+// RequestQueue sends requests upstream within the limits of a queue. Queue
+// backends implement it, and are chosen with QUEUE_BACKEND.
+type RequestQueue interface {
+	// Push waits for the request to be sent and returns its response. Once
+	// the queue is closed, the response carries ErrQueueClosed.
+	Push(r ProxyRequest) ProxyResponse
+	// Depth returns the number of requests waiting or being dispatched
+	Depth() int
+	// Stats reports the queue's depth and rate-limit utilization
+	Stats() QueueStats
+	// Close stops accepting requests; those already waiting are still sent
+	Close()
+}
+
+// Queue backends
+const (
+	// QueueBackendMemory keeps waiting requests in memory; requests and async
+	// jobs in flight are lost when the proxy stops
+	QueueBackendMemory = "memory"
+	// QueueBackendDurable dispatches like QueueBackendMemory, and re-dispatches
+	// the async jobs left pending by a crash or restart from the repository
+	// (at-least-once)
+	QueueBackendDurable = "durable"
+	// QueueBackendJetStream publishes requests to a NATS JetStream stream
+	// that all replicas consume, sharing the queues' limits across the fleet
+	QueueBackendJetStream = "jetstream"
+)
@@ -0,0 +1,116 @@
+package entities
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrRequestRecordNotFound is returned for request records not in the history
+var ErrRequestRecordNotFound = errors.New("request record not found")
+
+// RequestRecord is an entry in the request history
+type RequestRecord struct {
+	ID         int64  `json:"id"`
+	SessionID  string `json:"session_id,omitempty"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Model      string `json:"model,omitempty"`
+	StatusCode int    `json:"status_code"`
+	// ClientIP is the address of the client, resolved through trusted proxies
+	ClientIP string `json:"client_ip,omitempty"`
+	// Error is set when the request failed before an upstream response was received
+	Error      string            `json:"error,omitempty"`
+	Moderation *ModerationResult `json:"moderation,omitempty"`
+	// Fallback is set when the request was retried after a content filter block
+	Fallback *ContentFallback `json:"fallback,omitempty"`
+	// QueueWaitMs and UpstreamLatencyMs are 0 for requests that never reached the queue or upstream
+	QueueWaitMs       int64 `json:"queue_wait_ms"`
+	UpstreamLatencyMs int64 `json:"upstream_latency_ms"`
+	// TotalMs is the time from enqueueing the request to its response
+	TotalMs int64 `json:"total_ms"`
+	// Capture holds the bodies of the request and response when capture is enabled
+	Capture *BodyCapture `json:"capture,omitempty"`
+	// ReplayOf is the ID of the record this request replayed, if it was a replay
+	ReplayOf  int64     `json:"replay_of,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Body capture modes
+const (
+	CaptureModeFull    = "full"
+	CaptureModePreview = "preview"
+	CaptureModeHash    = "hash"
+)
+
+// BodyCapture is the captured request and response of a history record. In
+// hash mode only the SHA-256 digests are kept.
+type BodyCapture struct {
+	RequestBody    string `json:"request_body,omitempty"`
+	ResponseBody   string `json:"response_body,omitempty"`
+	RequestSHA256  string `json:"request_sha256,omitempty"`
+	ResponseSHA256 string `json:"response_sha256,omitempty"`
+	// Truncated is set when a body was cut to the size cap
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// CaptureSettings configures which bodies are captured in the request history
+type CaptureSettings struct {
+	// Mode is one of the CaptureMode constants; empty disables capture
+	Mode string
+	// MaxBytes caps each body in full mode; PreviewBytes in preview mode
+	MaxBytes     int
+	PreviewBytes int
+	// Tenants limits capture to the listed tenants; empty captures every request
+	Tenants []string
+	// RedactFields are JSON keys whose values are replaced at any depth
+	RedactFields []string
+}
+
+// HistoryQuery selects request records
+type HistoryQuery struct {
+	// SessionID restricts the records to one session; empty selects all
+	SessionID string
+	// ReplayOf restricts the records to the replays of one record; 0 selects all
+	ReplayOf int64
+	Limit    int
+}
+
+// LatencyPercentiles summarizes a latency distribution in milliseconds
+type LatencyPercentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P95 int64 `json:"p95"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+// NewLatencyPercentiles computes nearest-rank percentiles of values, which it sorts
+func NewLatencyPercentiles(values []int64) LatencyPercentiles {
+	if len(values) == 0 {
+		return LatencyPercentiles{}
+	}
+	slices.Sort(values)
+	rank := func(p int) int64 {
+		// Smallest value with at least p% of the values at or below it
+		i := (p*len(values)+99)/100 - 1
+		return values[max(i, 0)]
+	}
+	return LatencyPercentiles{
+		P50: rank(50),
+		P90: rank(90),
+		P95: rank(95),
+		P99: rank(99),
+		Max: values[len(values)-1],
+	}
+}
+
+// LatencyReport summarizes the timing of recorded requests
+type LatencyReport struct {
+	// Count is the number of requests the report is based on
+	Count     int                `json:"count"`
+	QueueWait LatencyPercentiles `json:"queue_wait_ms"`
+	// Upstream only covers requests that were sent upstream
+	Upstream LatencyPercentiles `json:"upstream_latency_ms"`
+	Total    LatencyPercentiles `json:"total_ms"`
+}
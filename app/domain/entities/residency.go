@@ -0,0 +1,36 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrResidencyViolation is returned for requests of a tenant whose residency
+// requirement the upstream's region does not satisfy
+var ErrResidencyViolation = errors.New("data residency violation")
+
+// CheckResidency returns an error wrapping ErrResidencyViolation if an
+// upstream in region may not process the requests of tenant
+func CheckResidency(tenant *Tenant, region string) error {
+	if RegionSatisfies(region, tenant.Residency) {
+		return nil
+	}
+	if region == "" {
+		region = "an unconfigured region"
+	}
+	return fmt.Errorf("%w: tenant %s requires region %s, but the upstream is in %s",
+		ErrResidencyViolation, tenant.ID, tenant.Residency, region)
+}
+
+// RegionSatisfies reports whether an upstream in region may process requests
+// that must stay in residency. A region satisfies the residency it equals or
+// is part of, so "eu-west-1" satisfies "eu". An empty residency is satisfied
+// by any region, and an unknown (empty) region by none but that.
+func RegionSatisfies(region, residency string) bool {
+	if residency == "" {
+		return true
+	}
+	region, residency = strings.ToLower(region), strings.ToLower(residency)
+	return region == residency || strings.HasPrefix(region, residency+"-")
+}
@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+// RetentionPolicy is how long stored data is kept; zero keeps it forever
+type RetentionPolicy struct {
+	// RequestHistory is the age after which request records are deleted
+	RequestHistory time.Duration
+	// Jobs is the age after which completed and failed jobs are deleted
+	Jobs time.Duration
+	// Sessions is how long a session is kept after its last request
+	Sessions time.Duration
+}
+
+// Enabled reports whether any stored data expires
+func (p RetentionPolicy) Enabled() bool {
+	return p.RequestHistory > 0 || p.Jobs > 0 || p.Sessions > 0
+}
+
+// PruneResult counts the rows deleted by a prune
+type PruneResult struct {
+	RequestRecords int `json:"request_records"`
+	Jobs           int `json:"jobs"`
+	Sessions       int `json:"sessions"`
+}
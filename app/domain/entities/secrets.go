@@ -0,0 +1,9 @@
+package entities
+
+// AWSCredentials are the static credentials used to sign AWS API requests
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials
+	SessionToken string
+}
@@ -1,5 +1,14 @@
 package entities
 
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
 // SessionData holds information about a session including accumulated token usage
 type SessionData struct {
 	SessionID             string `json:"session_id"`
@@ -7,4 +16,114 @@ type SessionData struct {
 	TotalCompletionTokens int    `json:"total_completion_tokens"`
 	TotalTokens           int    `json:"total_tokens"`
 	RequestCount          int    `json:"request_count"`
+	// EstimatedTokens is the part of TotalTokens that was estimated locally
+	EstimatedTokens int `json:"estimated_tokens,omitempty"`
+	// Response counts by status class, including errors generated by the proxy
+	Responses2xx int `json:"responses_2xx,omitempty"`
+	Responses4xx int `json:"responses_4xx,omitempty"`
+	Responses5xx int `json:"responses_5xx,omitempty"`
+	// LastError is the message of the most recent 4xx or 5xx response
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// ErrorTypes counts the session's upstream errors by type
+	ErrorTypes map[string]int `json:"error_types,omitempty"`
+	// Metadata holds operator-defined attributes, e.g. the billing customer
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// MeteredTokens is the part of TotalTokens already reported for billing
+	MeteredTokens int `json:"metered_tokens,omitempty"`
+	// Usage of image, transcription and speech endpoints, which are not
+	// billed in tokens
+	TotalImages       int     `json:"total_images,omitempty"`
+	TotalAudioSeconds float64 `json:"total_audio_seconds,omitempty"`
+	TotalCharacters   int     `json:"total_characters,omitempty"`
+	// TotalTrainedTokens are the tokens of the session's finished fine-tuning jobs
+	TotalTrainedTokens int `json:"total_trained_tokens,omitempty"`
+	// TotalToolCalls counts the tool calls requested by the model in the
+	// session's responses, and ToolCalls breaks them down by function name
+	TotalToolCalls int            `json:"total_tool_calls,omitempty"`
+	ToolCalls      map[string]int `json:"tool_calls,omitempty"`
+	// TotalCost is the price of the session's usage according to the pricing table
+	TotalCost float64 `json:"total_cost,omitempty"`
+}
+
+// DefaultModelMetadataKey is the session metadata key naming the model used
+// for the session's requests that name none
+const DefaultModelMetadataKey = "default_model"
+
+// SessionUsage is the token usage of a session, as served on
+// /v1/session/{id}/usage
+type SessionUsage struct {
+	SessionID        string  `json:"session_id"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	EstimatedTokens  int     `json:"estimated_tokens,omitempty"`
+	RequestCount     int     `json:"request_count"`
+	TotalCost        float64 `json:"total_cost,omitempty"`
+}
+
+// SessionBudgetStatus is a session's token budget and how much of it is left,
+// as served on /v1/session/{id}/budget. A Budget of 0 means unlimited, and
+// RemainingTokens is then omitted.
+type SessionBudgetStatus struct {
+	SessionID       string `json:"session_id"`
+	Budget          int    `json:"budget"`
+	UsedTokens      int    `json:"used_tokens"`
+	RemainingTokens *int   `json:"remaining_tokens,omitempty"`
+	Exceeded        bool   `json:"exceeded"`
+	// OverdraftTokens are the tokens used past the budget
+	OverdraftTokens int `json:"overdraft_tokens,omitempty"`
+	// Blocked is set once the session's requests are rejected for its budget
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// SessionResponse is the outcome of a single session request, recorded for
+// per-session status-code statistics
+type SessionResponse struct {
+	StatusCode int
+	// Error is the error message of a failed response
+	Error string
+	// ErrorType is the type of an upstream error response, if it was classified
+	ErrorType string
+	At        time.Time
+}
+
+// SessionTag returns the tag of a session ID of the form "<tag>:<id>", or an
+// empty string if the ID has no tag. Tags group sessions for routing and policies.
+func SessionTag(sessionID string) string {
+	tag, _, found := strings.Cut(sessionID, ":")
+	if !found {
+		return ""
+	}
+	return tag
+}
+
+// SessionExportVersion is the schema version of the session exports written
+// by this version of the proxy. It is raised when the meaning of exported
+// fields changes; imports reject newer versions.
+const SessionExportVersion = 1
+
+// SessionExport is a line of a JSONL session export
+type SessionExport struct {
+	SchemaVersion int         `json:"schema_version"`
+	Session       SessionData `json:"session"`
+}
+
+// WriteSessionExport writes sessions as a JSONL export, one SessionExport
+// line per session sorted by ID
+func WriteSessionExport(w io.Writer, sessions map[string]*SessionData) error {
+	encoder := json.NewEncoder(w)
+	for _, id := range slices.Sorted(maps.Keys(sessions)) {
+		if err := encoder.Encode(SessionExport{SchemaVersion: SessionExportVersion, Session: *sessions[id]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SessionImportResult counts the sessions of an import
+type SessionImportResult struct {
+	Imported int `json:"imported"`
+	// Skipped are the sessions that already existed and were left alone
+	Skipped int `json:"skipped"`
 }
@@ -0,0 +1,78 @@
+package entities
+
+import "time"
+
+// SessionFilter selects the sessions listed by /sessions/status. Zero fields
+// do not filter.
+type SessionFilter struct {
+	// TenantID restricts the list to a tenant's sessions
+	TenantID string
+	// Tag selects sessions whose ID, within TenantID, is "<tag>:<id>"
+	Tag string
+	// MinTokens and MinCost are lower bounds of the session totals
+	MinTokens int
+	MinCost   float64
+	// ActiveSince selects sessions with requests since then
+	ActiveSince time.Time
+}
+
+// SessionSummaryQuery selects the sessions summarized by /sessions/summary
+type SessionSummaryQuery struct {
+	// TenantID restricts the summary to a tenant's sessions; empty covers all
+	TenantID string
+	// ActiveSince restricts it to sessions with requests since then; zero covers all
+	ActiveSince time.Time
+	// Limit is the length of each top list
+	Limit int
+}
+
+// SessionSummary holds the totals of the selected sessions and the sessions
+// that lead by tokens, cost, requests and error rate
+type SessionSummary struct {
+	Sessions         int     `json:"sessions"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	TotalCost        float64 `json:"total_cost"`
+
+	TopByTokens    []SessionRank `json:"top_by_tokens"`
+	TopByCost      []SessionRank `json:"top_by_cost"`
+	TopByRequests  []SessionRank `json:"top_by_requests"`
+	TopByErrorRate []SessionRank `json:"top_by_error_rate"`
+}
+
+// SessionRank is a session in a top list. ErrorRate is the share of its
+// responses that were 4xx or 5xx.
+type SessionRank struct {
+	SessionID    string  `json:"session_id"`
+	TotalTokens  int     `json:"total_tokens"`
+	TotalCost    float64 `json:"total_cost"`
+	RequestCount int     `json:"request_count"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+}
+
+// Session metadata keys that group sessions under the users and projects of
+// a product; set by the X-User-ID and X-Project-ID headers or the admin API
+const (
+	UserIDMetadataKey    = "user_id"
+	ProjectIDMetadataKey = "project_id"
+)
+
+// SessionGroupUsage is the usage rolled up across the sessions whose metadata
+// GroupKey is GroupID, such as all sessions of a user
+type SessionGroupUsage struct {
+	GroupKey         string  `json:"group_key"`
+	GroupID          string  `json:"group_id"`
+	Sessions         int     `json:"sessions"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	TotalCost        float64 `json:"total_cost"`
+	// SessionUsage lists the sessions by tokens, highest first
+	SessionUsage []SessionRank `json:"session_usage"`
+}
@@ -0,0 +1,32 @@
+package entities
+
+import "time"
+
+// ShadowResult pairs a production response with the response of its mirrored
+// shadow request, for offline comparison
+type ShadowResult struct {
+	Path             string    `json:"path"`
+	PrimaryModel     string    `json:"primary_model"`
+	ShadowModel      string    `json:"shadow_model"`
+	PrimaryStatus    int       `json:"primary_status"`
+	ShadowStatus     int       `json:"shadow_status"`
+	PrimaryLatencyMs int64     `json:"primary_latency_ms"`
+	ShadowLatencyMs  int64     `json:"shadow_latency_ms"`
+	PrimaryBody      string    `json:"primary_body"`
+	ShadowBody       string    `json:"shadow_body"`
+	ShadowError      string    `json:"shadow_error,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ShadowSettings configures which requests are mirrored and how
+type ShadowSettings struct {
+	// Percent of eligible requests to mirror, 0-100
+	Percent float64
+	// Model replaces the request's model in the mirrored request; empty keeps it
+	Model string
+	// Paths lists the path prefixes eligible for mirroring
+	Paths []string
+	// Region is the shadow target's region; requests are not mirrored to it
+	// unless it satisfies their residency
+	Region string
+}
@@ -0,0 +1,235 @@
+package entities
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tenant modes select how the tenant of a public request is identified
+const (
+	TenantModeHeader = "header"
+	TenantModeKey    = "key"
+	TenantModePath   = "path"
+)
+
+// Tenant is a customer of the proxy whose sessions, budgets, rate limits and
+// usage are kept separate from other tenants
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// UpstreamAPIKey, when set, replaces the proxy's OpenAI key for the tenant's requests
+	UpstreamAPIKey string `json:"upstream_api_key,omitempty"`
+	// RequestsPerMinute limits the tenant's requests; zero means unlimited
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// Residency is the region the tenant's requests must be processed in,
+	// e.g. "eu"; empty allows any region
+	Residency string    `json:"residency,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Masked returns a copy of the tenant safe to show to operators, with all but
+// the last four characters of the upstream key hidden
+func (t Tenant) Masked() Tenant {
+	t.UpstreamAPIKey = maskKey(t.UpstreamAPIKey)
+	return t
+}
+
+// maskKey hides all but the last four characters of an upstream key
+func maskKey(key string) string {
+	if len(key) > 4 {
+		return "..." + key[len(key)-4:]
+	}
+	if key != "" {
+		return "..."
+	}
+	return key
+}
+
+// TenantUpdate is a partial update of a tenant; nil fields are left unchanged
+type TenantUpdate struct {
+	Name              *string `json:"name"`
+	UpstreamAPIKey    *string `json:"upstream_api_key"`
+	RequestsPerMinute *int    `json:"requests_per_minute"`
+	Residency         *string `json:"residency"`
+}
+
+// Apply returns the tenant with the update applied
+func (u TenantUpdate) Apply(t Tenant) Tenant {
+	if u.Name != nil {
+		t.Name = *u.Name
+	}
+	if u.UpstreamAPIKey != nil {
+		t.UpstreamAPIKey = *u.UpstreamAPIKey
+	}
+	if u.RequestsPerMinute != nil {
+		t.RequestsPerMinute = *u.RequestsPerMinute
+	}
+	if u.Residency != nil {
+		t.Residency = *u.Residency
+	}
+	return t
+}
+
+// VirtualKey is a client API key issued to a tenant. Only a hash of the key
+// is stored; the key itself is shown once, when it is issued.
+type VirtualKey struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name,omitempty"`
+	Hash     string `json:"-"`
+	// SigningSecret, when set, is the HMAC secret shared with the client; the
+	// key then only accepts signed requests
+	SigningSecret string `json:"-"`
+	// UpstreamAPIKeys, when set, replace the tenant's and the proxy's OpenAI
+	// key for requests made with this key. With several keys, requests are
+	// spread over them in turn.
+	UpstreamAPIKeys []string  `json:"upstream_api_keys,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Masked returns a copy of the key safe to show to operators, with its
+// upstream keys masked like those of tenants
+func (k VirtualKey) Masked() VirtualKey {
+	if k.UpstreamAPIKeys != nil {
+		masked := make([]string, len(k.UpstreamAPIKeys))
+		for i, key := range k.UpstreamAPIKeys {
+			masked[i] = maskKey(key)
+		}
+		k.UpstreamAPIKeys = masked
+	}
+	return k
+}
+
+// VirtualKeyRequest is the body of a request to issue a virtual key
+type VirtualKeyRequest struct {
+	Name string `json:"name"`
+	// Signing issues a key that only accepts signed requests
+	Signing         bool     `json:"signing"`
+	UpstreamAPIKeys []string `json:"upstream_api_keys"`
+}
+
+// VirtualKeyUpdate is a partial update of a virtual key; nil fields are left
+// unchanged and an empty list of upstream keys removes them
+type VirtualKeyUpdate struct {
+	Name            *string   `json:"name"`
+	UpstreamAPIKeys *[]string `json:"upstream_api_keys"`
+}
+
+// Apply returns the key with the update applied
+func (u VirtualKeyUpdate) Apply(k VirtualKey) VirtualKey {
+	if u.Name != nil {
+		k.Name = *u.Name
+	}
+	if u.UpstreamAPIKeys != nil {
+		k.UpstreamAPIKeys = *u.UpstreamAPIKeys
+		if len(k.UpstreamAPIKeys) == 0 {
+			k.UpstreamAPIKeys = nil
+		}
+	}
+	return k
+}
+
+// IssuedKey is returned when a virtual key is created and carries the
+// plaintext key and signing secret
+type IssuedKey struct {
+	VirtualKey
+	Key           string `json:"key"`
+	SigningSecret string `json:"signing_secret,omitempty"`
+}
+
+// TenantUsage aggregates the token usage of a tenant's sessions
+type TenantUsage struct {
+	TenantID              string `json:"tenant_id"`
+	Sessions              int    `json:"sessions"`
+	RequestCount          int    `json:"request_count"`
+	TotalPromptTokens     int    `json:"total_prompt_tokens"`
+	TotalCompletionTokens int    `json:"total_completion_tokens"`
+	TotalTokens           int    `json:"total_tokens"`
+}
+
+// TenantSettings configures how tenants are identified
+type TenantSettings struct {
+	// Mode is one of the TenantMode constants; empty disables multi-tenancy
+	Mode string
+	// Header carries the tenant ID in header mode
+	Header string
+	// SignatureMaxSkew is how far the timestamp of a signed request may be
+	// from the proxy's clock; signatures are remembered this long to reject replays
+	SignatureMaxSkew time.Duration
+	// MaxBodyBytes limits the bodies buffered to verify signed requests; 0 means no limit
+	MaxBodyBytes int64
+}
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenantID reports whether id can be used as a tenant ID: lowercase
+// letters, digits, '-' and '_', up to 63 characters
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// TenantSessionID namespaces a session ID under a tenant as "<tenant>/<session>".
+// Since public session IDs cannot contain '/', namespaced IDs never collide
+// with each other or with sessions created outside multi-tenant mode.
+func TenantSessionID(tenantID, sessionID string) string {
+	if tenantID == "" || sessionID == "" {
+		return sessionID
+	}
+	return tenantID + "/" + sessionID
+}
+
+// SplitTenantSessionID splits a namespaced session ID into its tenant and
+// session parts. IDs of sessions without a tenant have an empty tenant part.
+func SplitTenantSessionID(id string) (tenantID, sessionID string) {
+	tenantID, sessionID, found := strings.Cut(id, "/")
+	if !found {
+		return "", id
+	}
+	return tenantID, sessionID
+}
+
+type tenantContextKey struct{}
+
+type virtualKeyContextKey struct{}
+
+type residencyContextKey struct{}
+
+// ContextWithTenant returns a copy of ctx carrying the tenant ID of a request
+func ContextWithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID of a request, or an empty string
+// outside multi-tenant mode
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// ContextWithResidency returns a copy of ctx carrying the residency of a
+// request's tenant, once it was checked against the primary upstream
+func ContextWithResidency(ctx context.Context, residency string) context.Context {
+	return context.WithValue(ctx, residencyContextKey{}, residency)
+}
+
+// ResidencyFromContext returns the checked residency of a request's tenant,
+// and whether it was checked
+func ResidencyFromContext(ctx context.Context) (string, bool) {
+	residency, ok := ctx.Value(residencyContextKey{}).(string)
+	return residency, ok
+}
+
+// ContextWithVirtualKey returns a copy of ctx carrying the ID of the virtual
+// key a request was made with
+func ContextWithVirtualKey(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, virtualKeyContextKey{}, keyID)
+}
+
+// VirtualKeyFromContext returns the ID of the virtual key a request was made
+// with, or an empty string if it was not made with one
+func VirtualKeyFromContext(ctx context.Context) string {
+	keyID, _ := ctx.Value(virtualKeyContextKey{}).(string)
+	return keyID
+}
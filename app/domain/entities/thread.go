@@ -0,0 +1,7 @@
+package entities
+
+// ThreadMapping is the session the runs of an Assistants API thread are accounted to
+type ThreadMapping struct {
+	ThreadID  string `json:"thread_id"`
+	SessionID string `json:"session_id"`
+}
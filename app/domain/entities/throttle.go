@@ -0,0 +1,15 @@
+package entities
+
+import "time"
+
+// ThrottleTier limits the request rate of the sessions of a tier. A session
+// may send Burst requests at once; beyond that it borrows against its future
+// rate, and its requests are delayed until what they borrowed is repaid, so
+// sustained overuse waits longer and longer instead of being rejected.
+type ThrottleTier struct {
+	RequestsPerMinute int
+	// Burst is how many requests may be sent without delay after a quiet period
+	Burst int
+	// MaxDelay, when positive, rejects requests that would wait longer with 429
+	MaxDelay time.Duration
+}
@@ -5,4 +5,18 @@ type TokenUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Estimated is set when the counts were computed locally rather than reported upstream
+	Estimated bool `json:"estimated,omitempty"`
+	// Images, AudioSeconds and Characters measure the usage of endpoints that
+	// are not billed in tokens: image generation, transcription and speech
+	Images       int     `json:"images,omitempty"`
+	AudioSeconds float64 `json:"audio_seconds,omitempty"`
+	Characters   int     `json:"characters,omitempty"`
+	// TrainedTokens are the tokens a finished fine-tuning job was trained on
+	TrainedTokens int `json:"trained_tokens,omitempty"`
+	// ToolCalls counts the tool and function calls the model requested, by
+	// function name
+	ToolCalls map[string]int `json:"tool_calls,omitempty"`
+	// Cost is the price of the usage in the currency of the pricing table
+	Cost float64 `json:"cost,omitempty"`
 }
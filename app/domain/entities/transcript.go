@@ -0,0 +1,43 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TranscriptMetadataKey is the session metadata key that opts a session into
+// conversation capture when set to "true"
+const TranscriptMetadataKey = "transcript"
+
+// TranscriptTurn is one exchange of a captured conversation: the prompt sent
+// to the model and what it answered
+type TranscriptTurn struct {
+	ID        int64  `json:"id"`
+	SessionID string `json:"session_id"`
+	Path      string `json:"path"`
+	Model     string `json:"model,omitempty"`
+	// Prompt is the request's chat messages, Responses API input or
+	// completion prompt, as sent upstream
+	Prompt json.RawMessage `json:"prompt"`
+	// Completion holds one entry per choice: the assistant message of a chat
+	// completion or the text of a completion. For the Responses API it holds
+	// the output items.
+	Completion []json.RawMessage `json:"completion"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// SessionTranscript is the captured conversation of a session, as served on
+// /v1/session/{id}/transcript
+type SessionTranscript struct {
+	SessionID string           `json:"session_id"`
+	Turns     []TranscriptTurn `json:"turns"`
+}
+
+// TranscriptSettings configures conversation capture
+type TranscriptSettings struct {
+	// SessionTags opts in every session with one of the tags, in addition
+	// to the sessions opted in through their metadata
+	SessionTags []string
+	// RedactFields are JSON keys whose values are replaced at any depth
+	RedactFields []string
+}
@@ -0,0 +1,26 @@
+package entities
+
+// Types of upstream errors. They are the error types of the OpenAI API, to
+// which the errors of other providers are mapped.
+const (
+	InvalidRequestErrorType = "invalid_request_error"
+	AuthenticationErrorType = "authentication_error"
+	PermissionErrorType     = "permission_error"
+	NotFoundErrorType       = "not_found_error"
+	RateLimitErrorType      = "rate_limit_error"
+	InsufficientQuotaType   = "insufficient_quota"
+	TimeoutErrorType        = "timeout_error"
+	OverloadedErrorType     = "overloaded_error"
+	ServerErrorType         = "server_error"
+)
+
+// UpstreamError is the classification of an upstream error response
+type UpstreamError struct {
+	// Type is one of the upstream error types above
+	Type string `json:"type"`
+	// Code is the provider's error code, if it reported one
+	Code string `json:"code,omitempty"`
+	// Message is the provider's error message, or the status text if it
+	// reported none
+	Message string `json:"message"`
+}
@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"net/http"
+	"time"
+)
+
+// UpstreamTarget is an upstream the health prober checks
+type UpstreamTarget struct {
+	// Name identifies the upstream on the status endpoint, e.g. "primary" or "hedge"
+	Name    string
+	BaseURL string
+	// APIKey is sent with the probes; empty uses the primary key
+	APIKey string
+	// Client sends the probes, e.g. one presenting a client certificate; nil
+	// uses a default client
+	Client *http.Client
+}
+
+// UpstreamHealth is the last known state of an upstream
+type UpstreamHealth struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+	// Reachable is false once ConsecutiveFailures reaches the failure
+	// threshold; an upstream not probed yet is assumed reachable
+	Reachable bool `json:"reachable"`
+	// StatusCode and LatencyMs are those of the last probe answered
+	StatusCode          int       `json:"status_code,omitempty"`
+	LatencyMs           int64     `json:"latency_ms"`
+	LastChecked         time.Time `json:"last_checked"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
@@ -0,0 +1,202 @@
+// Package affinity pins sessions to replicas. Responses carry a hint an
+// external load balancer can hash or match on, and replicas keeping sessions
+// in memory can forward requests to the replica that owns the session.
+package affinity
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+)
+
+// ForwardedHeader marks requests forwarded by a replica; they are always
+// served locally, so replicas that disagree on the owner cannot loop
+const ForwardedHeader = "X-Forwarded-By-Replica"
+
+// SecretHeader carries the secret shared by the replicas, without which
+// ForwardedHeader is ignored
+const SecretHeader = "X-Replica-Secret"
+
+// originalKey keys the request as received in the context
+type originalKey struct{}
+
+// original is the request as received, before the tenant resolver strips its
+// credentials and path prefix
+type original struct {
+	header    http.Header
+	url       *url.URL
+	forwarded bool
+}
+
+// sessionPathPattern matches the session of a /v1/session/{id}/... path
+var sessionPathPattern = regexp.MustCompile(`^/v1/session/([^/]+)`)
+
+// ParseReplicas parses replicas given as name=url
+func ParseReplicas(specs []string) ([]entities.Replica, error) {
+	replicas := make([]entities.Replica, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		name, rawURL, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid replica %q: expected name=url", spec)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate replica %q", name)
+		}
+		seen[name] = true
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL of replica %q: %q", name, rawURL)
+		}
+		replicas = append(replicas, entities.Replica{Name: name, URL: u})
+	}
+	return replicas, nil
+}
+
+// Router adds affinity hints to session responses and forwards session
+// requests to their owner
+type Router struct {
+	settings entities.AffinitySettings
+	proxies  map[string]*httputil.ReverseProxy
+}
+
+// NewRouter creates a new Router; transport carries forwarded requests
+func NewRouter(settings entities.AffinitySettings, transport http.RoundTripper) *Router {
+	r := &Router{
+		settings: settings,
+		proxies:  make(map[string]*httputil.ReverseProxy),
+	}
+	if settings.Forward {
+		for _, replica := range settings.Replicas {
+			if replica.Name != settings.Self {
+				r.proxies[replica.Name] = r.newProxy(replica, transport)
+			}
+		}
+	}
+	return r
+}
+
+// Owner returns the replica owning a session by rendezvous hashing, which
+// moves only the sessions of an added or removed replica. It returns an empty
+// name without replicas.
+func (r *Router) Owner(sessionID string) string {
+	var owner string
+	var best uint64
+	for _, replica := range r.settings.Replicas {
+		if score := hash(replica.Name + "\x00" + sessionID); owner == "" || score > best {
+			owner, best = replica.Name, score
+		}
+	}
+	return owner
+}
+
+// Hint returns the affinity hint of a session: its owner, or a hash of the
+// session ID without replicas
+func (r *Router) Hint(sessionID string) string {
+	if owner := r.Owner(sessionID); owner != "" {
+		return owner
+	}
+	return strconv.FormatUint(hash(sessionID), 16)
+}
+
+// Capture keeps the request as received for forwarding, and recognizes the
+// requests other replicas forwarded by the shared secret. The replica headers
+// are removed, so clients cannot have a request served by a replica that does
+// not own its session. It must run before tenants are resolved.
+func (r *Router) Capture(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		forwarded := req.Header.Get(ForwardedHeader) != "" && r.settings.Secret != "" &&
+			subtle.ConstantTimeCompare([]byte(req.Header.Get(SecretHeader)), []byte(r.settings.Secret)) == 1
+		req.Header.Del(ForwardedHeader)
+		req.Header.Del(SecretHeader)
+
+		u := *req.URL
+		ctx := context.WithValue(req.Context(), originalKey{}, &original{
+			header:    req.Header.Clone(),
+			url:       &u,
+			forwarded: forwarded,
+		})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// Middleware hints and forwards requests to session URLs. It must run after
+// tenants are resolved, since tenants' sessions are distinct, and after
+// Capture, whose copy of the request is what is forwarded.
+func (r *Router) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		matches := sessionPathPattern.FindStringSubmatch(req.URL.Path)
+		if matches == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		sessionID := entities.TenantSessionID(entities.TenantFromContext(req.Context()), matches[1])
+		hint := r.Hint(sessionID)
+		orig, _ := req.Context().Value(originalKey{}).(*original)
+		// The owner hints the responses of forwarded requests itself
+		if proxy, ok := r.proxies[hint]; ok && orig != nil && !orig.forwarded {
+			// The body is the one left by the resolver, which buffers signed
+			// bodies it reads
+			out := req.Clone(req.Context())
+			out.Header = orig.header
+			out.URL = orig.url
+			proxy.ServeHTTP(w, out)
+			return
+		}
+
+		w.Header().Set(r.settings.Header, hint)
+		if r.settings.Cookie != "" {
+			http.SetCookie(w, &http.Cookie{Name: r.settings.Cookie, Value: hint, Path: "/", HttpOnly: true})
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// newProxy creates the reverse proxy forwarding requests to a replica
+func (r *Router) newProxy(replica entities.Replica, transport http.RoundTripper) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(replica.URL)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(ForwardedHeader, r.settings.Self)
+			pr.Out.Header.Set(SecretHeader, r.settings.Secret)
+		},
+		Transport: transport,
+		// Streamed responses are relayed as they arrive
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("Error forwarding %s to replica %s: %v", req.URL.Path, replica.Name, err)
+			httperr.Write(w, &entities.RequestError{
+				StatusCode: http.StatusBadGateway,
+				Message:    "The replica owning this session is unavailable.",
+				Type:       "server_error",
+				Code:       "replica_unavailable",
+			})
+		},
+	}
+}
+
+// hash returns the FNV-1a hash of s with the splitmix64 finalizer applied, so
+// that keys differing in a few characters score independently
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
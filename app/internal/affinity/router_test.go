@@ -0,0 +1,218 @@
+package affinity_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/affinity"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+)
+
+func mustParseReplicas(t *testing.T, specs ...string) []entities.Replica {
+	t.Helper()
+	replicas, err := affinity.ParseReplicas(specs)
+	if err != nil {
+		t.Fatalf("ParseReplicas() error = %v", err)
+	}
+	return replicas
+}
+
+func TestParseReplicas(t *testing.T) {
+	replicas := mustParseReplicas(t, "a=http://10.0.0.1:8080", " b=http://10.0.0.2:8080")
+	if len(replicas) != 2 || replicas[1].Name != "b" || replicas[1].URL.Host != "10.0.0.2:8080" {
+		t.Errorf("ParseReplicas() = %+v", replicas)
+	}
+	for _, specs := range [][]string{{"http://10.0.0.1:8080"}, {"a=10.0.0.1"}, {"a=http://x", "a=http://y"}, {"=http://x"}} {
+		if _, err := affinity.ParseReplicas(specs); err == nil {
+			t.Errorf("ParseReplicas(%q) error = nil, want an error", specs)
+		}
+	}
+}
+
+func TestRouter_OwnerIsConsistent(t *testing.T) {
+	three := affinity.NewRouter(entities.AffinitySettings{Replicas: mustParseReplicas(t, "a=http://a", "b=http://b", "c=http://c")}, nil)
+	two := affinity.NewRouter(entities.AffinitySettings{Replicas: mustParseReplicas(t, "a=http://a", "b=http://b")}, nil)
+
+	owned := map[string]int{}
+	for i := 0; i < 300; i++ {
+		sessionID := fmt.Sprintf("agent-%d", i)
+		owner := three.Owner(sessionID)
+		owned[owner]++
+		// Removing replica c moves only the sessions c owned
+		if owner != "c" && two.Owner(sessionID) != owner {
+			t.Errorf("Owner(%s) moved from %s to %s", sessionID, owner, two.Owner(sessionID))
+		}
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if owned[name] < 50 {
+			t.Errorf("replica %s owns %d of 300 sessions, want a balanced share", name, owned[name])
+		}
+	}
+}
+
+func TestRouter_Hints(t *testing.T) {
+	router := affinity.NewRouter(entities.AffinitySettings{Header: "X-Session-Affinity", Cookie: "affinity"}, nil)
+	handler := router.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/session/agent-1/chat/completions", nil))
+	hint := rr.Header().Get("X-Session-Affinity")
+	if hint == "" || hint != router.Hint("agent-1") {
+		t.Errorf("hint = %q, want %q", hint, router.Hint("agent-1"))
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "affinity" || cookies[0].Value != hint {
+		t.Errorf("cookies = %v, want the hint in the affinity cookie", cookies)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if got := rr.Header().Get("X-Session-Affinity"); got != "" {
+		t.Errorf("hint of a request without session = %q, want none", got)
+	}
+}
+
+func TestRouter_ForwardsToOwner(t *testing.T) {
+	var forwardedBy, secret string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy, secret = r.Header.Get(affinity.ForwardedHeader), r.Header.Get(affinity.SecretHeader)
+		w.Write([]byte("served by owner"))
+	}))
+	defer owner.Close()
+
+	settings := entities.AffinitySettings{
+		Header:   "X-Session-Affinity",
+		Replicas: mustParseReplicas(t, "a=http://127.0.0.1:1", "b="+owner.URL),
+		Self:     "a",
+		Forward:  true,
+		Secret:   "replica-secret",
+	}
+	router := affinity.NewRouter(settings, http.DefaultTransport)
+	var localHeaders http.Header
+	handler := router.Capture(router.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		localHeaders = r.Header
+		w.Write([]byte("served locally"))
+	})))
+
+	var ownedByB, ownedByA string
+	for i := 0; ownedByA == "" || ownedByB == ""; i++ {
+		sessionID := fmt.Sprintf("agent-%d", i)
+		if router.Owner(sessionID) == "b" {
+			ownedByB = sessionID
+		} else {
+			ownedByA = sessionID
+		}
+	}
+
+	tests := []struct {
+		name      string
+		sessionID string
+		secret    string
+		want      string
+	}{
+		{"owned by another replica", ownedByB, "", "served by owner"},
+		{"owned by this replica", ownedByA, "", "served locally"},
+		{"already forwarded", ownedByB, "replica-secret", "served locally"},
+		{"forwarded header from a client", ownedByB, "guess", "served by owner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/session/"+tt.sessionID+"/chat/completions", nil)
+			if tt.secret != "" {
+				req.Header.Set(affinity.ForwardedHeader, "b")
+				req.Header.Set(affinity.SecretHeader, tt.secret)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Body.String() != tt.want {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.want)
+			}
+		})
+	}
+	if forwardedBy != "a" || secret != "replica-secret" {
+		t.Errorf("forwarded by %q with secret %q, want the forwarding replica a and the shared secret", forwardedBy, secret)
+	}
+	if localHeaders.Get(affinity.ForwardedHeader) != "" || localHeaders.Get(affinity.SecretHeader) != "" {
+		t.Errorf("headers served locally = %v, want the replica headers removed", localHeaders)
+	}
+
+	// Sessions of an unreachable owner fail with 502 rather than splitting their usage
+	settings.Self = "b"
+	router = affinity.NewRouter(settings, http.DefaultTransport)
+	rr := httptest.NewRecorder()
+	router.Capture(router.Middleware(http.NotFoundHandler())).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/session/"+ownedByA+"/chat/completions", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status of a request to an unreachable owner = %d, want %d", rr.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRouter_ForwardsTenantRequests(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	if err := store.CreateTenant(entities.Tenant{ID: "acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	issued, err := tenant.NewService(store).IssueKey("acme", entities.VirtualKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+
+	tests := []struct {
+		mode    string
+		path    string
+		prepare func(r *http.Request)
+	}{
+		{entities.TenantModeHeader, "", func(r *http.Request) { r.Header.Set("X-Tenant-ID", "acme") }},
+		{entities.TenantModeKey, "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+issued.Key) }},
+		{entities.TenantModePath, "/t/acme", func(r *http.Request) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			// Both replicas run the public chain: Capture, the tenant resolver,
+			// then Middleware
+			chain := func(router *affinity.Router, handler http.Handler) http.Handler {
+				resolver := tenant.NewResolver(store, entities.TenantSettings{Mode: tt.mode, Header: "X-Tenant-ID"})
+				return router.Capture(resolver.Middleware(router.Middleware(handler)))
+			}
+			var servedTenant, servedPath, servedBody string
+			ownerSettings := entities.AffinitySettings{Header: "X-Session-Affinity", Self: "b", Forward: true, Secret: "replica-secret"}
+			owner := httptest.NewServer(nil)
+			defer owner.Close()
+			ownerSettings.Replicas = mustParseReplicas(t, "a=http://127.0.0.1:1", "b="+owner.URL)
+			owner.Config.Handler = chain(affinity.NewRouter(ownerSettings, http.DefaultTransport), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				servedTenant, servedPath, servedBody = entities.TenantFromContext(r.Context()), r.URL.Path, string(body)
+				w.Write([]byte("served by owner"))
+			}))
+
+			settings := ownerSettings
+			settings.Self = "a"
+			router := affinity.NewRouter(settings, http.DefaultTransport)
+			handler := chain(router, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("served locally"))
+			}))
+
+			var sessionID string
+			for i := 0; sessionID == ""; i++ {
+				if id := fmt.Sprintf("agent-%d", i); router.Owner(entities.TenantSessionID("acme", id)) == "b" {
+					sessionID = id
+				}
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path+"/v1/session/"+sessionID+"/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+			tt.prepare(req)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Body.String() != "served by owner" {
+				t.Fatalf("response = %d %q, want the owner's", rr.Code, rr.Body.String())
+			}
+			if servedTenant != "acme" || servedPath != "/v1/session/"+sessionID+"/chat/completions" || servedBody != `{"model":"gpt-4o"}` {
+				t.Errorf("owner served tenant %q, path %q, body %q, want the request of acme", servedTenant, servedPath, servedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+type recordingFirer struct {
+	mu     sync.Mutex
+	alerts []entities.Alert
+}
+
+func (f *recordingFirer) Fire(alert entities.Alert) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alerts = append(f.alerts, alert)
+	return true
+}
+
+func TestWebhookNotifier_Formats(t *testing.T) {
+	alert := entities.Alert{Kind: entities.AlertQueueDepth, Message: "Queue default is deep", Queue: "default", Value: 120, Threshold: 100}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatJSON, `"kind":"queue_depth"`},
+		{FormatSlack, `"text":":rotating_light: *llm-queue-proxy* Queue default is deep"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				payload, _ := io.ReadAll(r.Body)
+				body = string(payload)
+			}))
+			defer server.Close()
+
+			if err := NewWebhookNotifier(server.URL, tt.format, server.Client()).Notify(context.Background(), alert); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("webhook body = %s, want it to contain %s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier(server.URL, FormatJSON, server.Client()).Notify(context.Background(), entities.Alert{}); err == nil {
+		t.Error("Notify() error = nil, want an error for a 500 response")
+	}
+}
+
+type notifierFunc func(ctx context.Context, alert entities.Alert) error
+
+func (f notifierFunc) Notify(ctx context.Context, alert entities.Alert) error {
+	return f(ctx, alert)
+}
+
+func TestDispatcher_Cooldown(t *testing.T) {
+	var mu sync.Mutex
+	var received []entities.Alert
+	notifier := notifierFunc(func(ctx context.Context, alert entities.Alert) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, alert)
+		return errors.New("delivery failures are only logged")
+	})
+	d := NewDispatcher([]Notifier{notifier}, time.Minute, time.Second)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	alert := entities.Alert{Kind: entities.AlertUpstreamErrorRate, Threshold: 10, At: start}
+	if !d.Fire(alert) {
+		t.Error("Fire() = false for the first alert, want true")
+	}
+	alert.At = start.Add(30 * time.Second)
+	if d.Fire(alert) {
+		t.Error("Fire() = true within the cooldown, want false")
+	}
+	if !d.Fire(entities.Alert{Kind: entities.AlertQueueDepth, Queue: "batch", At: alert.At}) {
+		t.Error("Fire() = false for a different alert, want true")
+	}
+	alert.At = start.Add(2 * time.Minute)
+	if !d.Fire(alert) {
+		t.Error("Fire() = false after the cooldown, want true")
+	}
+	d.Close()
+
+	if len(received) != 3 {
+		t.Errorf("notifier received %d alerts, want 3", len(received))
+	}
+}
+
+func TestBudgetMonitor_FiresOnCrossing(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	firer := &recordingFirer{}
+	monitor := NewBudgetMonitor(repo, entities.SessionBudgets{Sessions: map[string]int{"team": 1000}}, []int{50, 80, 100}, firer)
+	if _, err := monitor.CreateSession("team:alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	usages := []int{400, 150, 300, 100, 500}
+	for _, tokens := range usages {
+		if _, err := monitor.UpdateSessionTokens("team:alice", entities.TokenUsage{TotalTokens: tokens}); err != nil {
+			t.Fatalf("UpdateSessionTokens() error = %v", err)
+		}
+	}
+
+	// 400, 550 (50%), 850 (80%), 950, 1450 (100%)
+	var thresholds []float64
+	for _, alert := range firer.alerts {
+		thresholds = append(thresholds, alert.Threshold)
+		if alert.Kind != entities.AlertSessionBudget || alert.SessionID != "team:alice" {
+			t.Errorf("alert = %+v, want a session budget alert for team:alice", alert)
+		}
+	}
+	if len(thresholds) != 3 || thresholds[0] != 50 || thresholds[1] != 80 || thresholds[2] != 100 {
+		t.Errorf("fired thresholds = %v, want [50 80 100]", thresholds)
+	}
+}
+
+func TestBudgetMonitor_HighestThresholdOnly(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	firer := &recordingFirer{}
+	monitor := NewBudgetMonitor(repo, entities.SessionBudgets{Default: 100}, []int{80, 100}, firer)
+	monitor.CreateSession("s1")
+	monitor.CreateSession("unbudgeted")
+
+	monitor.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 150})
+
+	if len(firer.alerts) != 1 || firer.alerts[0].Threshold != 100 || firer.alerts[0].Value != 150 {
+		t.Errorf("alerts = %+v, want a single 100%% alert at 150%%", firer.alerts)
+	}
+}
+
+type stubQueue struct {
+	resp entities.ProxyResponse
+}
+
+func (q *stubQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return q.resp
+}
+
+func TestErrorRateMonitor(t *testing.T) {
+	next := &stubQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK}}
+	firer := &recordingFirer{}
+	monitor := NewErrorRateMonitor(next, firer, 50, 10*time.Second, 4)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+
+	monitor.Push(entities.ProxyRequest{})
+	next.resp = entities.ProxyResponse{StatusCode: http.StatusBadGateway}
+	monitor.Push(entities.ProxyRequest{})
+	monitor.Push(entities.ProxyRequest{})
+	if len(firer.alerts) != 0 {
+		t.Fatalf("alerts = %+v before the minimum number of requests, want none", firer.alerts)
+	}
+	next.resp = entities.ProxyResponse{StatusCode: http.StatusOK}
+	monitor.Push(entities.ProxyRequest{})
+	if len(firer.alerts) != 1 || firer.alerts[0].Value != 50 {
+		t.Fatalf("alerts = %+v, want one alert at a 50%% error rate", firer.alerts)
+	}
+
+	// Responses outside the window no longer count
+	now = now.Add(11 * time.Second)
+	for i := 0; i < 4; i++ {
+		monitor.Push(entities.ProxyRequest{})
+	}
+	if len(firer.alerts) != 1 {
+		t.Errorf("alerts = %+v, want no new alert after the failures left the window", firer.alerts)
+	}
+}
+
+type depthFunc func() int
+
+func (f depthFunc) Depth() int {
+	return f()
+}
+
+func TestQueueDepthMonitor(t *testing.T) {
+	depth := 150
+	firer := &recordingFirer{}
+	monitor := NewQueueDepthMonitor(map[string]DepthReporter{
+		"default": depthFunc(func() int { return depth }),
+		"batch":   depthFunc(func() int { return 0 }),
+	}, firer, 100, time.Minute, time.Second)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	monitor.now = func() time.Time { return now }
+
+	monitor.Check()
+	now = now.Add(30 * time.Second)
+	monitor.Check()
+	if len(firer.alerts) != 0 {
+		t.Fatalf("alerts = %+v before the duration elapsed, want none", firer.alerts)
+	}
+
+	now = now.Add(30 * time.Second)
+	monitor.Check()
+	if len(firer.alerts) != 1 || firer.alerts[0].Queue != "default" {
+		t.Fatalf("alerts = %+v, want one alert for the default queue", firer.alerts)
+	}
+
+	// Dropping below the limit restarts the duration
+	depth = 10
+	now = now.Add(time.Second)
+	monitor.Check()
+	depth = 150
+	now = now.Add(time.Second)
+	monitor.Check()
+	if len(firer.alerts) != 1 {
+		t.Errorf("alerts = %+v, want no new alert after the queue drained", firer.alerts)
+	}
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.CreateSession("agent")
+	repo.CreateSession("steady")
+	firer := &recordingFirer{}
+	detector := NewAnomalyDetector(repo, firer, entities.AnomalySettings{ZScore: 3, MinTokens: 1000, MinSamples: 3, Alpha: 0.3}, time.Hour)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	detector.now = func() time.Time { return now }
+	hour := func(agent, steady int) {
+		t.Helper()
+		repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: agent})
+		repo.UpdateSessionTokens("steady", entities.TokenUsage{TotalTokens: steady})
+		now = now.Add(time.Hour)
+		if err := detector.Check(); err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+
+	// The first sample only records the totals, the next ones build the baselines
+	hour(50000, 50000)
+	for _, tokens := range []int{1800, 2200, 2000, 2100} {
+		hour(tokens, 5000)
+	}
+	if len(firer.alerts) != 0 {
+		t.Fatalf("alerts = %+v while building baselines, want none", firer.alerts)
+	}
+
+	hour(20000, 5200)
+	if len(firer.alerts) != 1 || firer.alerts[0].Kind != entities.AlertSessionAnomaly || firer.alerts[0].SessionID != "agent" {
+		t.Fatalf("alerts = %+v, want one anomaly of the agent", firer.alerts)
+	}
+	anomalies := detector.Anomalies(10)
+	if len(anomalies) != 1 || anomalies[0].Tokens != 20000 || anomalies[0].ZScore < 3 || anomalies[0].Baseline < 1800 || anomalies[0].Baseline > 2200 {
+		t.Errorf("Anomalies() = %+v, want the agent's hour against its baseline", anomalies)
+	}
+
+	// After a gap in sampling the totals are recorded again, not compared
+	repo.UpdateSessionTokens("steady", entities.TokenUsage{TotalTokens: 90000})
+	now = now.Add(5 * time.Hour)
+	detector.Check()
+	if len(firer.alerts) != 1 {
+		t.Errorf("alerts = %+v after a gap in sampling, want no new alert", firer.alerts)
+	}
+}
@@ -0,0 +1,217 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// maxAnomalies bounds the anomalies kept for the admin API
+const maxAnomalies = 100
+
+// minRelativeStdDev floors the deviation of a baseline at this share of its
+// average, so that sessions with a steady consumption are not flagged for
+// small changes
+const minRelativeStdDev = 0.1
+
+// SessionLister lists the sessions and their token totals
+type SessionLister interface {
+	ListSessions() (map[string]*entities.SessionData, error)
+}
+
+// Leader reports whether this instance runs the background tasks of its replicas
+type Leader interface {
+	IsLeader() bool
+}
+
+// AnomalyDetector samples the token totals of the sessions every interval
+// and flags the sessions whose consumption over the interval deviates from
+// their baseline, an exponentially weighted moving average, by more than the
+// configured z-score. Baselines are kept in memory and are rebuilt after a
+// restart.
+type AnomalyDetector struct {
+	sessions SessionLister
+	alerts   Firer
+	settings entities.AnomalySettings
+	interval time.Duration
+	now      func() time.Time
+	leader   Leader
+
+	mu        sync.Mutex
+	baselines map[string]*baseline
+	sampledAt time.Time
+	anomalies []entities.SessionAnomaly
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// baseline is the moving consumption per interval of a session
+type baseline struct {
+	total    int
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// NewAnomalyDetector creates a new AnomalyDetector sampling every interval
+func NewAnomalyDetector(sessions SessionLister, alerts Firer, settings entities.AnomalySettings, interval time.Duration) *AnomalyDetector {
+	return &AnomalyDetector{
+		sessions:  sessions,
+		alerts:    alerts,
+		settings:  settings,
+		interval:  interval,
+		now:       time.Now,
+		baselines: make(map[string]*baseline),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// SetLeader limits sampling to the instance leader elects
+func (d *AnomalyDetector) SetLeader(leader Leader) {
+	d.leader = leader
+}
+
+// Start samples the sessions in the background until Close is called
+func (d *AnomalyDetector) Start() {
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				if d.leader != nil && !d.leader.IsLeader() {
+					continue
+				}
+				if err := d.Check(); err != nil {
+					log.Printf("Error checking sessions for anomalies: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Check samples the sessions once, flags the anomalies and updates the
+// baselines. When the previous sample is missing or more than two intervals
+// old, e.g. after this instance became the leader, it only records the totals.
+func (d *AnomalyDetector) Check() error {
+	sessions, err := d.sessions.ListSessions()
+	if err != nil {
+		return err
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fresh := !d.sampledAt.IsZero() && now.Sub(d.sampledAt) <= 2*d.interval
+	d.sampledAt = now
+
+	ids := make([]string, 0, len(sessions))
+	for id := range sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for id := range d.baselines {
+		if _, ok := sessions[id]; !ok {
+			delete(d.baselines, id)
+		}
+	}
+	for _, id := range ids {
+		total := sessions[id].TotalTokens
+		b, ok := d.baselines[id]
+		if !ok {
+			d.baselines[id] = &baseline{total: total}
+			continue
+		}
+		tokens := total - b.total
+		b.total = total
+		if !fresh || tokens < 0 {
+			continue
+		}
+		if anomaly, ok := d.evaluate(id, b, tokens, now); ok {
+			d.flag(anomaly)
+		}
+		b.add(float64(tokens), d.settings.Alpha)
+	}
+	return nil
+}
+
+// evaluate compares a session's consumption over the interval with its baseline
+func (d *AnomalyDetector) evaluate(sessionID string, b *baseline, tokens int, now time.Time) (entities.SessionAnomaly, bool) {
+	if b.samples < d.settings.MinSamples || tokens < d.settings.MinTokens {
+		return entities.SessionAnomaly{}, false
+	}
+	stdDev := max(math.Sqrt(b.variance), minRelativeStdDev*b.mean, 1)
+	z := (float64(tokens) - b.mean) / stdDev
+	if z < d.settings.ZScore {
+		return entities.SessionAnomaly{}, false
+	}
+	return entities.SessionAnomaly{
+		SessionID:  sessionID,
+		Tokens:     tokens,
+		Baseline:   b.mean,
+		StdDev:     stdDev,
+		ZScore:     z,
+		DetectedAt: now,
+	}, true
+}
+
+// add updates the moving average and variance with an interval's consumption
+func (b *baseline) add(tokens, alpha float64) {
+	if b.samples == 0 {
+		b.mean = tokens
+	} else {
+		diff := tokens - b.mean
+		increment := alpha * diff
+		b.mean += increment
+		b.variance = (1 - alpha) * (b.variance + diff*increment)
+	}
+	b.samples++
+}
+
+// flag keeps an anomaly and fires its alert
+func (d *AnomalyDetector) flag(anomaly entities.SessionAnomaly) {
+	message := fmt.Sprintf("Session %s used %d tokens in the last %v, %.1f standard deviations above its baseline of %.0f",
+		anomaly.SessionID, anomaly.Tokens, d.interval, anomaly.ZScore, anomaly.Baseline)
+	log.Print(message)
+	d.anomalies = append(d.anomalies, anomaly)
+	if len(d.anomalies) > maxAnomalies {
+		d.anomalies = d.anomalies[len(d.anomalies)-maxAnomalies:]
+	}
+	d.alerts.Fire(entities.Alert{
+		Kind:      entities.AlertSessionAnomaly,
+		Message:   message,
+		SessionID: anomaly.SessionID,
+		Value:     anomaly.ZScore,
+		Threshold: d.settings.ZScore,
+		At:        anomaly.DetectedAt,
+	})
+}
+
+// Anomalies returns up to limit of the latest anomalies, newest first
+func (d *AnomalyDetector) Anomalies(limit int) []entities.SessionAnomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	anomalies := make([]entities.SessionAnomaly, 0, min(limit, len(d.anomalies)))
+	for i := len(d.anomalies) - 1; i >= 0 && len(anomalies) < limit; i-- {
+		anomalies = append(anomalies, d.anomalies[i])
+	}
+	return anomalies
+}
+
+// Close stops sampling
+func (d *AnomalyDetector) Close() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+}
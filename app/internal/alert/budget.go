@@ -0,0 +1,70 @@
+package alert
+
+import (
+	"fmt"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/session"
+)
+
+// Firer sends alerts
+type Firer interface {
+	Fire(alert entities.Alert) bool
+}
+
+// Budgets returns the token budgets of sessions
+type Budgets interface {
+	BudgetFor(sessionID string) int
+}
+
+// BudgetMonitor wraps a session repository and fires an alert when a
+// session's token usage crosses one of the configured percentages of its budget
+type BudgetMonitor struct {
+	session.Repository
+	budgets    Budgets
+	thresholds []int
+	alerts     Firer
+}
+
+// NewBudgetMonitor creates a new BudgetMonitor in front of repo
+func NewBudgetMonitor(repo session.Repository, budgets Budgets, thresholds []int, alerts Firer) *BudgetMonitor {
+	return &BudgetMonitor{
+		Repository: repo,
+		budgets:    budgets,
+		thresholds: thresholds,
+		alerts:     alerts,
+	}
+}
+
+// UpdateSessionTokens adds token usage to the session and checks its budget
+func (m *BudgetMonitor) UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+	sessionData, err := m.Repository.UpdateSessionTokens(sessionID, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	budget := m.budgets.BudgetFor(sessionID)
+	if budget <= 0 {
+		return sessionData, nil
+	}
+	previous := sessionData.TotalTokens - usage.TotalTokens
+	// Only the highest threshold crossed by this update fires
+	crossed := 0
+	for _, threshold := range m.thresholds {
+		limit := budget * threshold / 100
+		if previous < limit && sessionData.TotalTokens >= limit && threshold > crossed {
+			crossed = threshold
+		}
+	}
+	if crossed > 0 {
+		m.alerts.Fire(entities.Alert{
+			Kind: entities.AlertSessionBudget,
+			Message: fmt.Sprintf("Session %s has used %d of its %d token budget (%d%% threshold crossed)",
+				sessionID, sessionData.TotalTokens, budget, crossed),
+			SessionID: sessionID,
+			Value:     float64(sessionData.TotalTokens) * 100 / float64(budget),
+			Threshold: float64(crossed),
+		})
+	}
+	return sessionData, nil
+}
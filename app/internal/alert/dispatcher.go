@@ -0,0 +1,76 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Notifier delivers an alert to an external system
+type Notifier interface {
+	Notify(ctx context.Context, alert entities.Alert) error
+}
+
+// Dispatcher logs alerts and sends them to all notifiers in the background.
+// Repeated alerts of the same kind and subject are suppressed for the cooldown.
+type Dispatcher struct {
+	notifiers []Notifier
+	cooldown  time.Duration
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	fired map[string]time.Time
+	wg    sync.WaitGroup
+}
+
+// NewDispatcher creates a new Dispatcher. Each notification is bounded by timeout.
+func NewDispatcher(notifiers []Notifier, cooldown, timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		notifiers: notifiers,
+		cooldown:  cooldown,
+		timeout:   timeout,
+		now:       time.Now,
+		fired:     make(map[string]time.Time),
+	}
+}
+
+// Fire sends the alert unless the same alert fired within the cooldown.
+// It reports whether the alert was sent.
+func (d *Dispatcher) Fire(alert entities.Alert) bool {
+	if alert.At.IsZero() {
+		alert.At = d.now()
+	}
+	key := fmt.Sprintf("%s/%s/%s/%g", alert.Kind, alert.SessionID, alert.Queue, alert.Threshold)
+
+	d.mu.Lock()
+	if last, ok := d.fired[key]; ok && alert.At.Sub(last) < d.cooldown {
+		d.mu.Unlock()
+		return false
+	}
+	d.fired[key] = alert.At
+	d.mu.Unlock()
+
+	log.Printf("Alert %s: %s", alert.Kind, alert.Message)
+	for _, notifier := range d.notifiers {
+		d.wg.Add(1)
+		go func(notifier Notifier) {
+			defer d.wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, alert); err != nil {
+				log.Printf("Error sending %s alert: %v", alert.Kind, err)
+			}
+		}(notifier)
+	}
+	return true
+}
+
+// Close waits for notifications in flight
+func (d *Dispatcher) Close() {
+	d.wg.Wait()
+}
@@ -0,0 +1,98 @@
+package alert
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// ErrorRateMonitor wraps a queue and fires an alert when the share of failed
+// upstream responses (transport errors, 429 and 5xx) within a sliding window
+// exceeds the threshold
+type ErrorRateMonitor struct {
+	next        Queue
+	alerts      Firer
+	threshold   float64
+	minRequests int
+	now         func() time.Time
+
+	mu sync.Mutex
+	// buckets count responses per second of the window, indexed by second modulo its length
+	buckets []errorBucket
+}
+
+type errorBucket struct {
+	second int64
+	total  int
+	failed int
+}
+
+// NewErrorRateMonitor creates a new ErrorRateMonitor in front of next. The
+// threshold is a percentage; the rate is not evaluated until the window holds
+// minRequests responses.
+func NewErrorRateMonitor(next Queue, alerts Firer, threshold float64, window time.Duration, minRequests int) *ErrorRateMonitor {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &ErrorRateMonitor{
+		next:        next,
+		alerts:      alerts,
+		threshold:   threshold,
+		minRequests: minRequests,
+		now:         time.Now,
+		buckets:     make([]errorBucket, seconds),
+	}
+}
+
+// Push forwards the request and records whether the upstream failed
+func (m *ErrorRateMonitor) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := m.next.Push(r)
+	m.record(resp.Err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500)
+	return resp
+}
+
+// record counts a response and fires an alert if the rate exceeds the threshold
+func (m *ErrorRateMonitor) record(failed bool) {
+	m.mu.Lock()
+	second := m.now().Unix()
+	bucket := &m.buckets[second%int64(len(m.buckets))]
+	if bucket.second != second {
+		*bucket = errorBucket{second: second}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+	}
+
+	total, failures := 0, 0
+	for _, b := range m.buckets {
+		if second-b.second < int64(len(m.buckets)) {
+			total += b.total
+			failures += b.failed
+		}
+	}
+	m.mu.Unlock()
+
+	if total < m.minRequests || total == 0 {
+		return
+	}
+	rate := float64(failures) * 100 / float64(total)
+	if rate < m.threshold {
+		return
+	}
+	m.alerts.Fire(entities.Alert{
+		Kind: entities.AlertUpstreamErrorRate,
+		Message: fmt.Sprintf("Upstream error rate is %.1f%% (%d of %d responses in the last %v), above %g%%",
+			rate, failures, total, time.Duration(len(m.buckets))*time.Second, m.threshold),
+		Value:     rate,
+		Threshold: m.threshold,
+	})
+}
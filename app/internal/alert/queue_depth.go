@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// DepthReporter reports the number of requests waiting in or dispatched from a queue
+type DepthReporter interface {
+	Depth() int
+}
+
+// QueueDepthMonitor polls queue depths and fires an alert when a queue stays
+// above the limit for the configured duration
+type QueueDepthMonitor struct {
+	queues   map[string]DepthReporter
+	alerts   Firer
+	limit    int
+	duration time.Duration
+	interval time.Duration
+	now      func() time.Time
+
+	// above records since when each queue has been above the limit
+	above map[string]time.Time
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewQueueDepthMonitor creates a new QueueDepthMonitor polling every interval
+func NewQueueDepthMonitor(queues map[string]DepthReporter, alerts Firer, limit int, duration, interval time.Duration) *QueueDepthMonitor {
+	return &QueueDepthMonitor{
+		queues:   queues,
+		alerts:   alerts,
+		limit:    limit,
+		duration: duration,
+		interval: interval,
+		now:      time.Now,
+		above:    make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start polls the queues in the background until Close is called
+func (m *QueueDepthMonitor) Start() {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.Check()
+			}
+		}
+	}()
+}
+
+// Check samples every queue once. It is called by the polling loop and must
+// not be called concurrently with it.
+func (m *QueueDepthMonitor) Check() {
+	now := m.now()
+	names := make([]string, 0, len(m.queues))
+	for name := range m.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		depth := m.queues[name].Depth()
+		if depth <= m.limit {
+			delete(m.above, name)
+			continue
+		}
+		since, ok := m.above[name]
+		if !ok {
+			m.above[name] = now
+			since = now
+		}
+		if now.Sub(since) < m.duration {
+			continue
+		}
+		m.alerts.Fire(entities.Alert{
+			Kind: entities.AlertQueueDepth,
+			Message: fmt.Sprintf("Queue %s has had more than %d pending requests for %v (currently %d)",
+				name, m.limit, now.Sub(since).Round(time.Second), depth),
+			Queue:     name,
+			Value:     float64(depth),
+			Threshold: float64(m.limit),
+		})
+	}
+}
+
+// Close stops polling
+func (m *QueueDepthMonitor) Close() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
@@ -0,0 +1,64 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+const (
+	// FormatJSON posts the alert as a JSON object
+	FormatJSON = "json"
+	// FormatSlack posts a Slack incoming webhook message
+	FormatSlack = "slack"
+)
+
+// WebhookNotifier posts alerts to a webhook URL
+type WebhookNotifier struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier posting alerts in the given
+// format, FormatJSON or FormatSlack
+func NewWebhookNotifier(url, format string, client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		format: format,
+		client: client,
+	}
+}
+
+// Notify posts the alert and fails on non-2xx responses
+func (n *WebhookNotifier) Notify(ctx context.Context, alert entities.Alert) error {
+	var payload any = alert
+	if n.format == FormatSlack {
+		payload = map[string]string{"text": fmt.Sprintf(":rotating_light: *llm-queue-proxy* %s", alert.Message)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
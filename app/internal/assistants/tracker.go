@@ -0,0 +1,190 @@
+// Package assistants attributes the usage of Assistants API runs and
+// Responses API responses to sessions. Runs are created on threads
+// (/v1/threads/{id}/runs) and background responses are polled by ID
+// (/v1/responses/{id}) rather than by session, so threads and responses are
+// mapped to the session they belong to.
+package assistants
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Store interface {
+	SetThreadSession(threadID, sessionID string) error
+	GetThreadSession(threadID string) (string, error)
+	MarkRunAccounted(runID string) (bool, error)
+}
+
+// finalRunStatuses are the run and response statuses in which usage is final
+var finalRunStatuses = map[string]bool{
+	"completed":  true,
+	"failed":     true,
+	"cancelled":  true,
+	"expired":    true,
+	"incomplete": true,
+}
+
+// Tracker maps threads and responses to sessions and counts the usage of each
+// run and response once. Responses share the thread mappings, keyed by their
+// resp_ ID.
+type Tracker struct {
+	store Store
+	// static maps thread IDs to sessions from the configuration; it takes
+	// precedence over stored mappings
+	static map[string]string
+}
+
+// NewTracker creates a new Tracker with the configured thread mappings
+func NewTracker(store Store, static map[string]string) *Tracker {
+	return &Tracker{
+		store:  store,
+		static: static,
+	}
+}
+
+// SessionFor returns the session a tenant's thread or response is mapped to
+func (t *Tracker) SessionFor(tenantID, threadID string) (string, bool) {
+	key := entities.TenantSessionID(tenantID, threadID)
+	if sessionID, ok := t.static[key]; ok {
+		return sessionID, true
+	}
+	sessionID, err := t.store.GetThreadSession(key)
+	if err != nil {
+		if !errors.Is(err, entities.ErrThreadNotFound) {
+			log.Printf("Error looking up thread %s: %v", key, err)
+		}
+		return "", false
+	}
+	return sessionID, true
+}
+
+// Observe inspects an Assistants or Responses API response of a session
+// request. Threads it creates or runs on and responses it creates are mapped
+// to the session unless they already are, and the usage of runs and responses
+// that finished and were not counted before is returned.
+func (t *Tracker) Observe(tenantID, sessionID string, responseBody []byte) (entities.TokenUsage, error) {
+	var total entities.TokenUsage
+	var errs []error
+	for _, obj := range objects(responseBody) {
+		mappedID := ""
+		switch obj.Object {
+		case "thread":
+			mappedID = obj.ID
+		case "thread.run":
+			mappedID = obj.ThreadID
+		case "response":
+			mappedID = obj.ID
+		default:
+			continue
+		}
+		if mappedID != "" {
+			if err := t.learn(tenantID, mappedID, sessionID); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if obj.Object == "thread" || obj.Usage == nil || !finalRunStatuses[obj.Status] {
+			continue
+		}
+		first, err := t.store.MarkRunAccounted(obj.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if first {
+			usage := obj.Usage.tokenUsage()
+			total.PromptTokens += usage.PromptTokens
+			total.CompletionTokens += usage.CompletionTokens
+			total.TotalTokens += usage.TotalTokens
+		}
+	}
+	if len(errs) > 0 {
+		return total, fmt.Errorf("failed to track assistants response: %w", errors.Join(errs...))
+	}
+	return total, nil
+}
+
+// learn maps a thread or response to the session that created it or first ran
+// it; those that are already mapped keep their session
+func (t *Tracker) learn(tenantID, id, sessionID string) error {
+	if _, ok := t.SessionFor(tenantID, id); ok {
+		return nil
+	}
+	return t.store.SetThreadSession(entities.TenantSessionID(tenantID, id), sessionID)
+}
+
+// object holds the fields of Assistants and Responses API objects that are
+// tracked. Responses API stream events nest the response under "response".
+type object struct {
+	ID       string   `json:"id"`
+	Object   string   `json:"object"`
+	ThreadID string   `json:"thread_id"`
+	Status   string   `json:"status"`
+	Usage    *usage   `json:"usage"`
+	Data     []object `json:"data"`
+	Response *object  `json:"response"`
+}
+
+// usage is reported as prompt/completion tokens by runs and as input/output
+// tokens by responses
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u usage) tokenUsage() entities.TokenUsage {
+	tokens := entities.TokenUsage{
+		PromptTokens:     u.PromptTokens + u.InputTokens,
+		CompletionTokens: u.CompletionTokens + u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if tokens.TotalTokens == 0 {
+		tokens.TotalTokens = tokens.PromptTokens + tokens.CompletionTokens
+	}
+	return tokens
+}
+
+// objects returns the objects of a response: a single object, the items of a
+// list, or the data of each event in a stream
+func objects(body []byte) []object {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var obj object
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return nil
+		}
+		if obj.Object == "list" {
+			return obj.Data
+		}
+		return []object{obj}
+	}
+
+	var objs []object
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var obj object
+		if json.Unmarshal([]byte(strings.TrimSpace(data)), &obj) != nil {
+			continue
+		}
+		if obj.Response != nil {
+			obj = *obj.Response
+		}
+		objs = append(objs, obj)
+	}
+	return objs
+}
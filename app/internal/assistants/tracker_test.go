@@ -0,0 +1,107 @@
+package assistants
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestTracker_LearnsThreads(t *testing.T) {
+	tracker := NewTracker(repository.NewMemoryRepository(), map[string]string{"thread_static": "configured"})
+
+	if _, err := tracker.Observe("", "agent-1", []byte(`{"id":"thread_a","object":"thread"}`)); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	// Create-and-run responses map the thread of the run
+	if _, err := tracker.Observe("acme", "acme/agent-2", []byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_b","status":"queued","usage":null}`)); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	// Threads keep the session that created them
+	tracker.Observe("", "agent-3", []byte(`{"id":"thread_a","object":"thread"}`))
+	tracker.Observe("", "agent-3", []byte(`{"id":"thread_static","object":"thread"}`))
+
+	tests := []struct {
+		tenantID, threadID string
+		want               string
+		wantOK             bool
+	}{
+		{"", "thread_a", "agent-1", true},
+		{"acme", "thread_b", "acme/agent-2", true},
+		{"", "thread_b", "", false},
+		{"", "thread_static", "configured", true},
+		{"", "thread_unknown", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tracker.SessionFor(tt.tenantID, tt.threadID)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("SessionFor(%q, %q) = %q, %v, want %q, %v", tt.tenantID, tt.threadID, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestTracker_CountsFinishedRunsOnce(t *testing.T) {
+	tracker := NewTracker(repository.NewMemoryRepository(), nil)
+	completed := []byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_a","status":"completed","usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"in progress run", `{"id":"run_1","object":"thread.run","thread_id":"thread_a","status":"in_progress","usage":null}`, 0},
+		{"completed run", string(completed), 15},
+		{"polled again", string(completed), 0},
+		{"run list", `{"object":"list","data":[` + string(completed) + `,{"id":"run_2","object":"thread.run","thread_id":"thread_a","status":"failed","usage":{"prompt_tokens":3,"completion_tokens":0,"total_tokens":3}}]}`, 3},
+		{"stream", "event: thread.run.step.completed\ndata: {\"id\":\"step_1\",\"object\":\"thread.run.step\",\"status\":\"completed\",\"usage\":{\"total_tokens\":7}}\n\n" +
+			"event: thread.run.completed\ndata: {\"id\":\"run_3\",\"object\":\"thread.run\",\"thread_id\":\"thread_a\",\"status\":\"completed\",\"usage\":{\"prompt_tokens\":4,\"completion_tokens\":3,\"total_tokens\":7}}\n\nevent: done\ndata: [DONE]\n\n", 7},
+		{"message", `{"id":"msg_1","object":"thread.message"}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := tracker.Observe("", "agent-1", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Observe() error = %v", err)
+			}
+			if usage.TotalTokens != tt.want {
+				t.Errorf("Observe() usage = %+v, want %d total tokens", usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_Responses(t *testing.T) {
+	tracker := NewTracker(repository.NewMemoryRepository(), nil)
+	completed := `{"id":"resp_1","object":"response","status":"completed","usage":{"input_tokens":12,"output_tokens":30,"total_tokens":42}}`
+
+	tests := []struct {
+		name string
+		body string
+		want entities.TokenUsage
+	}{
+		{"background response queued", `{"id":"resp_1","object":"response","status":"queued","background":true,"usage":null}`, entities.TokenUsage{}},
+		{"polled until completed", completed, entities.TokenUsage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42}},
+		{"polled again", completed, entities.TokenUsage{}},
+		{"stream", "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_2\",\"object\":\"response\",\"status\":\"in_progress\",\"usage\":null}}\n\n" +
+			"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_2\",\"object\":\"response\",\"status\":\"completed\",\"usage\":{\"input_tokens\":4,\"output_tokens\":3,\"total_tokens\":7}}}\n\n",
+			entities.TokenUsage{PromptTokens: 4, CompletionTokens: 3, TotalTokens: 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := tracker.Observe("acme", "acme/agent-1", []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Observe() error = %v", err)
+			}
+			if !reflect.DeepEqual(usage, tt.want) {
+				t.Errorf("Observe() usage = %+v, want %+v", usage, tt.want)
+			}
+		})
+	}
+
+	for _, id := range []string{"resp_1", "resp_2"} {
+		if sessionID, ok := tracker.SessionFor("acme", id); !ok || sessionID != "acme/agent-1" {
+			t.Errorf("SessionFor(acme, %s) = %q, %v, want acme/agent-1", id, sessionID, ok)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package authz delegates the decision to serve a public request to an
+// external HTTP service, in the manner of Envoy's ext_authz, so that existing
+// policy engines can decide who may use the proxy.
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+)
+
+// maxDecisionBytes bounds the service's reply
+const maxDecisionBytes = 1 << 20
+
+// exemptPaths are served without asking the service
+var exemptPaths = map[string]bool{
+	"/version": true,
+}
+
+// check describes the request being authorized. The body is not sent.
+type check struct {
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Query    string      `json:"query,omitempty"`
+	Headers  http.Header `json:"headers"`
+	ClientIP string      `json:"client_ip,omitempty"`
+	TenantID string      `json:"tenant_id,omitempty"`
+	// SessionID is the session named by the path, qualified with the tenant
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// decision is the service's answer. An allowed request continues with
+// Headers set on it and Metadata stored on its session; a denied one is
+// answered with StatusCode, Message and Code, and Headers are set on the
+// response.
+type decision struct {
+	Allow      bool              `json:"allow"`
+	Headers    map[string]string `json:"headers"`
+	Metadata   map[string]string `json:"metadata"`
+	StatusCode int               `json:"status_code"`
+	Message    string            `json:"message"`
+	Code       string            `json:"code"`
+}
+
+// Authorizer asks the authorization service about every public request
+type Authorizer struct {
+	url    string
+	token  string
+	client *http.Client
+	// failOpen serves requests when the service is unavailable instead of
+	// rejecting them
+	failOpen bool
+}
+
+// NewAuthorizer creates a new Authorizer calling the service at url,
+// authenticated with token when it is set
+func NewAuthorizer(url, token string, client *http.Client, failOpen bool) *Authorizer {
+	return &Authorizer{
+		url:      url,
+		token:    token,
+		client:   client,
+		failOpen: failOpen,
+	}
+}
+
+// Middleware serves the requests the service allows and rejects the others
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d, err := a.decide(r)
+		if err != nil {
+			log.Printf("Authorization service failed: %v", err)
+			if a.failOpen {
+				next.ServeHTTP(w, r)
+				return
+			}
+			httperr.Write(w, &entities.RequestError{
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "Authorization service is unavailable",
+				Type:       "server_error",
+				Code:       "authorization_unavailable",
+			})
+			return
+		}
+		if !d.Allow {
+			for name, value := range d.Headers {
+				w.Header().Set(name, value)
+			}
+			httperr.Write(w, d.requestError())
+			return
+		}
+
+		for name, value := range d.Headers {
+			r.Header.Set(name, value)
+		}
+		if len(d.Metadata) > 0 {
+			r = r.WithContext(entities.ContextWithAnnotations(r.Context(), d.Metadata))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decide posts the request's metadata to the service and decodes its decision
+func (a *Authorizer) decide(r *http.Request) (*decision, error) {
+	tenantID := entities.TenantFromContext(r.Context())
+	payload, err := json.Marshal(check{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		Headers:   r.Header,
+		ClientIP:  entities.ClientIPFromContext(r.Context()),
+		TenantID:  tenantID,
+		SessionID: entities.TenantSessionID(tenantID, sessionFromPath(r.URL.Path)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode authorization request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, a.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("authorization request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authorization service returned status %d", resp.StatusCode)
+	}
+	var d decision
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDecisionBytes)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode authorization decision: %w", err)
+	}
+	return &d, nil
+}
+
+// requestError converts a denial into the error returned to the client; a
+// missing or invalid status denies with 403
+func (d *decision) requestError() *entities.RequestError {
+	reqErr := &entities.RequestError{
+		StatusCode: d.StatusCode,
+		Message:    d.Message,
+		Type:       "invalid_request_error",
+		Code:       d.Code,
+	}
+	if reqErr.StatusCode < 400 || reqErr.StatusCode > 599 {
+		reqErr.StatusCode = http.StatusForbidden
+	}
+	if reqErr.StatusCode >= 500 {
+		reqErr.Type = "server_error"
+	}
+	if reqErr.Message == "" {
+		reqErr.Message = "Request denied by authorization policy"
+	}
+	if reqErr.Code == "" {
+		reqErr.Code = "access_denied"
+	}
+	return reqErr
+}
+
+// sessionFromPath returns the session of a /v1/session/{id}/... path, or an
+// empty string
+func sessionFromPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/v1/session/")
+	if !ok {
+		return ""
+	}
+	sessionID, _, _ := strings.Cut(rest, "/")
+	return sessionID
+}
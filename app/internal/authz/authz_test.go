@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestAuthorizer_Middleware(t *testing.T) {
+	var got check
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer authz-token" {
+			t.Errorf("service Authorization = %q, want the configured token", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding check: %v", err)
+		}
+		switch got.Headers.Get("Authorization") {
+		case "Bearer alice":
+			w.Write([]byte(`{"allow":true,"headers":{"X-User-ID":"alice"},"metadata":{"department":"sales"}}`))
+		case "Bearer expired":
+			w.Write([]byte(`{"allow":false,"status_code":401,"message":"Token expired","code":"token_expired","headers":{"WWW-Authenticate":"Bearer error=\"invalid_token\""}}`))
+		default:
+			w.Write([]byte(`{"allow":false}`))
+		}
+	}))
+	defer service.Close()
+
+	var served *http.Request
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r
+	})
+	handler := NewAuthorizer(service.URL, "authz-token", service.Client(), false).Middleware(next)
+
+	tests := []struct {
+		name       string
+		auth       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"allowed", "Bearer alice", http.StatusOK, ""},
+		{"denied with status", "Bearer expired", http.StatusUnauthorized, "token_expired"},
+		{"denied", "Bearer mallory", http.StatusForbidden, "access_denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served = nil
+			req := httptest.NewRequest(http.MethodPost, "/v1/session/agent-1/chat/completions?stream=true", nil)
+			req.Header.Set("Authorization", tt.auth)
+			req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got.Path != "/v1/session/agent-1/chat/completions" || got.Query != "stream=true" || got.TenantID != "acme" || got.SessionID != "acme/agent-1" {
+				t.Errorf("check = %+v, want the request's path, query, tenant and session", got)
+			}
+			if tt.wantCode == "" {
+				if served == nil {
+					t.Fatal("allowed request was not served")
+				}
+				if served.Header.Get("X-User-ID") != "alice" || entities.AnnotationsFromContext(served.Context())["department"] != "sales" {
+					t.Errorf("served request headers %v, annotations %v, want the decision's", served.Header, entities.AnnotationsFromContext(served.Context()))
+				}
+				return
+			}
+			if served != nil {
+				t.Error("denied request was served")
+			}
+			var errResp entities.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil || errResp.Error.Code == nil || *errResp.Error.Code != tt.wantCode {
+				t.Errorf("body = %q, want error code %s", rr.Body.String(), tt.wantCode)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("denial headers were not set on the response")
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Unavailable(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer service.Close()
+	client := &http.Client{Timeout: 10 * time.Millisecond}
+
+	tests := []struct {
+		name       string
+		failOpen   bool
+		path       string
+		wantStatus int
+	}{
+		{"fails closed", false, "/v1/chat/completions", http.StatusServiceUnavailable},
+		{"fails open", true, "/v1/chat/completions", http.StatusNoContent},
+		{"exempt path", false, "/version", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAuthorizer(service.URL, "", client, tt.failOpen).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
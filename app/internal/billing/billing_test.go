@@ -0,0 +1,125 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestStripeMeter_ReportUsage(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.Write([]byte(`{"object":"billing.meter_event"}`))
+	}))
+	defer server.Close()
+
+	meter := NewStripeMeter(server.URL+"/", "sk_test", server.Client())
+	err := meter.ReportUsage(context.Background(), entities.MeterEvent{
+		EventName:  "llm_tokens",
+		CustomerID: "cus_1",
+		Value:      1500,
+		Identifier: "llmqp-abc-1500",
+		Timestamp:  time.Unix(1714564800, 0),
+	})
+	if err != nil {
+		t.Fatalf("ReportUsage() error = %v", err)
+	}
+
+	if got.URL.Path != "/v1/billing/meter_events" || got.Header.Get("Authorization") != "Bearer sk_test" {
+		t.Errorf("request = %s %s with %q, want an authenticated meter event", got.Method, got.URL.Path, got.Header.Get("Authorization"))
+	}
+	want := map[string]string{
+		"event_name":                  "llm_tokens",
+		"payload[stripe_customer_id]": "cus_1",
+		"payload[value]":              "1500",
+		"identifier":                  "llmqp-abc-1500",
+		"timestamp":                   "1714564800",
+	}
+	for key, value := range want {
+		if got.PostForm.Get(key) != value {
+			t.Errorf("form %s = %q, want %q", key, got.PostForm.Get(key), value)
+		}
+	}
+}
+
+func TestStripeMeter_ReportUsageError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"No such customer: 'cus_x'"}}`))
+	}))
+	defer server.Close()
+
+	err := NewStripeMeter(server.URL, "sk_test", server.Client()).ReportUsage(context.Background(), entities.MeterEvent{})
+	if err == nil || err.Error() != "stripe returned status 400: No such customer: 'cus_x'" {
+		t.Errorf("ReportUsage() error = %v, want the Stripe error message", err)
+	}
+}
+
+type recordingMeter struct {
+	events []entities.MeterEvent
+	err    error
+}
+
+func (m *recordingMeter) ReportUsage(ctx context.Context, event entities.MeterEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestReporter_ReportsUnmeteredTokens(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.UpdateSessionTokens("billed", entities.TokenUsage{TotalTokens: 100})
+	repo.UpdateSessionTokens("unbilled", entities.TokenUsage{TotalTokens: 50})
+	repo.SetSessionMetadata("billed", map[string]string{"stripe_customer_id": "cus_1"})
+
+	meter := &recordingMeter{}
+	reporter := NewReporter(repo, meter, entities.MeteringSettings{EventName: "llm_tokens", CustomerMetadataKey: "stripe_customer_id"}, time.Hour, time.Second)
+
+	if reported, err := reporter.Report(); reported != 1 || err != nil {
+		t.Fatalf("Report() = (%d, %v), want (1, nil)", reported, err)
+	}
+	repo.UpdateSessionTokens("billed", entities.TokenUsage{TotalTokens: 30})
+	if reported, err := reporter.Report(); reported != 1 || err != nil {
+		t.Fatalf("second Report() = (%d, %v), want (1, nil)", reported, err)
+	}
+	if reported, err := reporter.Report(); reported != 0 || err != nil {
+		t.Fatalf("Report() without new usage = (%d, %v), want (0, nil)", reported, err)
+	}
+
+	if len(meter.events) != 2 || meter.events[0].Value != 100 || meter.events[1].Value != 30 || meter.events[1].CustomerID != "cus_1" {
+		t.Errorf("meter events = %+v, want 100 then 30 tokens for cus_1", meter.events)
+	}
+	if meter.events[0].Identifier == meter.events[1].Identifier {
+		t.Errorf("meter events share identifier %q, want distinct identifiers", meter.events[0].Identifier)
+	}
+}
+
+func TestReporter_RetriesFailedReports(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.UpdateSessionTokens("billed", entities.TokenUsage{TotalTokens: 100})
+	repo.SetSessionMetadata("billed", map[string]string{"customer": "cus_1"})
+
+	meter := &recordingMeter{err: errors.New("stripe unavailable")}
+	reporter := NewReporter(repo, meter, entities.MeteringSettings{EventName: "llm_tokens", CustomerMetadataKey: "customer"}, time.Hour, time.Second)
+
+	if _, err := reporter.Report(); err == nil {
+		t.Fatal("Report() error = nil, want the meter error")
+	}
+	meter.err = nil
+	if reported, err := reporter.Report(); reported != 1 || err != nil {
+		t.Fatalf("Report() after recovery = (%d, %v), want (1, nil)", reported, err)
+	}
+	if len(meter.events) != 1 || meter.events[0].Value != 100 {
+		t.Errorf("meter events = %+v, want the unreported 100 tokens", meter.events)
+	}
+}
@@ -0,0 +1,154 @@
+package billing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionStore interface {
+	ListSessions() (map[string]*entities.SessionData, error)
+	MarkSessionMetered(sessionID string, meteredTokens int) error
+}
+
+// Meter records usage with a billing provider
+type Meter interface {
+	ReportUsage(ctx context.Context, event entities.MeterEvent) error
+}
+
+// Leader reports whether this instance leads the replicas sharing the repository
+type Leader interface {
+	IsLeader() bool
+}
+
+// Reporter periodically reports the tokens each billable session used since
+// its last report. Sessions are billable when their metadata names a customer.
+type Reporter struct {
+	store    SessionStore
+	meter    Meter
+	settings entities.MeteringSettings
+	interval time.Duration
+	timeout  time.Duration
+	now      func() time.Time
+	leader   Leader
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReporter creates a new Reporter reporting every interval. Each report to
+// the meter is bounded by timeout.
+func NewReporter(store SessionStore, meter Meter, settings entities.MeteringSettings, interval, timeout time.Duration) *Reporter {
+	return &Reporter{
+		store:    store,
+		meter:    meter,
+		settings: settings,
+		interval: interval,
+		timeout:  timeout,
+		now:      time.Now,
+	}
+}
+
+// SetLeader limits reporting to the instance leader elects, so replicas
+// sharing the repository do not report the same usage twice
+func (r *Reporter) SetLeader(leader Leader) {
+	r.leader = leader
+}
+
+// Start reports usage in the background until Close is called
+func (r *Reporter) Start() {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if r.leader != nil && !r.leader.IsLeader() {
+					continue
+				}
+				reported, err := r.Report()
+				if err != nil {
+					log.Printf("Error reporting usage for billing: %v", err)
+				}
+				if reported > 0 {
+					log.Printf("Reported usage of %d sessions for billing", reported)
+				}
+			}
+		}
+	}()
+}
+
+// Report sends one meter event per billable session with unreported tokens and
+// returns the number of sessions reported. A failed session is retried on the
+// next report; the event identifier keeps retries from being counted twice.
+func (r *Reporter) Report() (int, error) {
+	sessions, err := r.store.ListSessions()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	ids := make([]string, 0, len(sessions))
+	for id := range sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	reported := 0
+	var firstErr error
+	for _, id := range ids {
+		sess := sessions[id]
+		customerID := sess.Metadata[r.settings.CustomerMetadataKey]
+		unreported := sess.TotalTokens - sess.MeteredTokens
+		if customerID == "" || unreported <= 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		err := r.meter.ReportUsage(ctx, entities.MeterEvent{
+			EventName:  r.settings.EventName,
+			CustomerID: customerID,
+			Value:      unreported,
+			Identifier: eventIdentifier(id, sess.TotalTokens),
+			Timestamp:  r.now(),
+		})
+		cancel()
+		if err == nil {
+			err = r.store.MarkSessionMetered(id, sess.TotalTokens)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("session %s: %w", id, err)
+			}
+			continue
+		}
+		reported++
+	}
+	return reported, firstErr
+}
+
+// eventIdentifier identifies the report of a session's usage up to totalTokens.
+// The session ID is hashed to stay within the provider's identifier length limit.
+func eventIdentifier(sessionID string, totalTokens int) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return fmt.Sprintf("llmqp-%s-%d", hex.EncodeToString(sum[:12]), totalTokens)
+}
+
+// Close stops background reporting
+func (r *Reporter) Close() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.stop = nil
+}
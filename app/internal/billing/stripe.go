@@ -0,0 +1,67 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// StripeMeter records usage with Stripe's billing meter events API
+type StripeMeter struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewStripeMeter creates a new StripeMeter. The base URL is normally https://api.stripe.com.
+func NewStripeMeter(baseURL, apiKey string, client *http.Client) *StripeMeter {
+	return &StripeMeter{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  client,
+	}
+}
+
+// ReportUsage creates a meter event for the customer
+func (m *StripeMeter) ReportUsage(ctx context.Context, event entities.MeterEvent) error {
+	form := url.Values{
+		"event_name":                  {event.EventName},
+		"payload[stripe_customer_id]": {event.CustomerID},
+		"payload[value]":              {strconv.Itoa(event.Value)},
+		"identifier":                  {event.Identifier},
+		"timestamp":                   {strconv.FormatInt(event.Timestamp.Unix(), 10)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v1/billing/meter_events", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var stripeErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(body))
+		if err := json.Unmarshal(body, &stripeErr); err == nil && stripeErr.Error.Message != "" {
+			message = stripeErr.Error.Message
+		}
+		return fmt.Errorf("stripe returned status %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Package budget lets operators move token budget between sessions and
+// session tags at runtime, without a restart. The transfers are stored and
+// the net amount moved to each key is added to its configured budget.
+package budget
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// reloadInterval is how often the transferred amounts are reloaded, so the
+// transfers made by other replicas apply
+const reloadInterval = 10 * time.Second
+
+type Store interface {
+	SaveBudgetTransfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error)
+	ListBudgetTransfers(limit int) ([]entities.BudgetTransfer, error)
+	BudgetAdjustments() (map[string]int, error)
+}
+
+// Ledger resolves the token budgets of sessions with the transfers applied.
+// A key is a session ID or a session tag. The amount transferred to a key is
+// added to the budget it has without transfers, whether configured or
+// inherited from its tag or the default, so a tag's transfers also reach its
+// sessions. A tag's budget applies to each of its sessions.
+type Ledger struct {
+	budgets entities.SessionBudgets
+	store   Store
+	now     func() time.Time
+
+	mu          sync.Mutex
+	adjustments map[string]int
+	loadedAt    time.Time
+}
+
+// NewLedger creates a new Ledger of the configured budgets
+func NewLedger(budgets entities.SessionBudgets, store Store) *Ledger {
+	return &Ledger{
+		budgets: budgets,
+		store:   store,
+		now:     time.Now,
+	}
+}
+
+// BudgetFor returns the token budget of a session, or 0 if it has none
+func (l *Ledger) BudgetFor(sessionID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(false); err != nil {
+		log.Printf("Error loading budget transfers: %v", err)
+	}
+	return l.budgetFor(sessionID)
+}
+
+// Allocations returns the budget of every configured key and of every key
+// party to a transfer, sorted by key
+func (l *Ledger) Allocations() ([]entities.BudgetAllocation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(true); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(l.budgets.Sessions)+len(l.adjustments))
+	for key := range l.budgets.Sessions {
+		keys = append(keys, key)
+	}
+	for key := range l.adjustments {
+		if _, ok := l.budgets.Sessions[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	allocations := make([]entities.BudgetAllocation, 0, len(keys))
+	for _, key := range keys {
+		allocations = append(allocations, entities.BudgetAllocation{
+			Key:         key,
+			Configured:  l.base(key),
+			Transferred: l.adjustments[key],
+			Budget:      l.budgetFor(key),
+		})
+	}
+	return allocations, nil
+}
+
+// Transfer moves tokens from one key's budget to another's. Both keys must
+// have a limited budget, and the source must keep at least one token, since
+// a budget of 0 means unlimited.
+func (l *Ledger) Transfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error) {
+	transfer.From = strings.TrimSpace(transfer.From)
+	transfer.To = strings.TrimSpace(transfer.To)
+	switch {
+	case transfer.From == "" || transfer.To == "":
+		return nil, fmt.Errorf("%w: from and to are required", entities.ErrInvalidBudgetTransfer)
+	case transfer.From == transfer.To:
+		return nil, fmt.Errorf("%w: from and to must differ", entities.ErrInvalidBudgetTransfer)
+	case transfer.Tokens <= 0:
+		return nil, fmt.Errorf("%w: tokens must be positive", entities.ErrInvalidBudgetTransfer)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(true); err != nil {
+		return nil, err
+	}
+	from, to := l.budgetFor(transfer.From), l.budgetFor(transfer.To)
+	switch {
+	case from <= 0:
+		return nil, fmt.Errorf("%w: %s has an unlimited budget", entities.ErrInvalidBudgetTransfer, transfer.From)
+	case to <= 0:
+		return nil, fmt.Errorf("%w: %s has an unlimited budget", entities.ErrInvalidBudgetTransfer, transfer.To)
+	case from-transfer.Tokens < 1:
+		return nil, fmt.Errorf("%w: %s has a budget of %d tokens", entities.ErrInvalidBudgetTransfer, transfer.From, from)
+	}
+
+	transfer.CreatedAt = l.now()
+	saved, err := l.store.SaveBudgetTransfer(transfer)
+	if err != nil {
+		return nil, err
+	}
+	l.adjustments[transfer.From] -= transfer.Tokens
+	l.adjustments[transfer.To] += transfer.Tokens
+	return saved, nil
+}
+
+// Match gives a key the budget of another, e.g. a session cloned from it,
+// recording the change as a transfer without a source. Nothing changes if
+// either budget is unlimited, since transfers cannot express that.
+func (l *Ledger) Match(source, target, reason string) (*entities.BudgetTransfer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(true); err != nil {
+		return nil, err
+	}
+	budget, current := l.budgetFor(source), l.budgetFor(target)
+	if budget <= 0 || current <= 0 || budget == current {
+		return nil, nil
+	}
+	transfer := entities.BudgetTransfer{To: target, Tokens: budget - current, Reason: reason, CreatedAt: l.now()}
+	saved, err := l.store.SaveBudgetTransfer(transfer)
+	if err != nil {
+		return nil, err
+	}
+	l.adjustments[target] += transfer.Tokens
+	return saved, nil
+}
+
+// Transfers returns up to limit transfers, newest first
+func (l *Ledger) Transfers(limit int) ([]entities.BudgetTransfer, error) {
+	return l.store.ListBudgetTransfers(limit)
+}
+
+// budgetFor resolves a key's budget with the transfers applied. Transfers
+// never turn a budget unlimited: a limited budget keeps at least one token,
+// and one that became unlimited in the configuration ignores them.
+func (l *Ledger) budgetFor(key string) int {
+	base := l.base(key)
+	if base <= 0 {
+		return 0
+	}
+	return max(base+l.adjustments[key], 1)
+}
+
+// base returns a key's budget without its own transfers: the configured one,
+// or the one it inherits from its tag or the default
+func (l *Ledger) base(key string) int {
+	if budget, ok := l.budgets.Sessions[key]; ok {
+		return budget
+	}
+	if tag := entities.SessionTag(key); tag != "" {
+		return l.budgetFor(tag)
+	}
+	return l.budgets.Default
+}
+
+// load reloads the transferred amounts when forced or once reloadInterval
+// has passed. On failure the amounts loaded last stay in use.
+func (l *Ledger) load(force bool) error {
+	if !force && l.adjustments != nil && l.now().Sub(l.loadedAt) < reloadInterval {
+		return nil
+	}
+	adjustments, err := l.store.BudgetAdjustments()
+	if err != nil {
+		if l.adjustments == nil {
+			l.adjustments = make(map[string]int)
+		}
+		l.loadedAt = l.now()
+		return fmt.Errorf("failed to load budget transfers: %w", err)
+	}
+	l.adjustments, l.loadedAt = adjustments, l.now()
+	return nil
+}
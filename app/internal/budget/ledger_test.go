@@ -0,0 +1,128 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestLedger_Transfer(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	ledger := NewLedger(entities.SessionBudgets{
+		Default:  1000,
+		Sessions: map[string]int{"batch": 50000, "interactive": 20000, "vip": 0},
+	}, repo)
+
+	transfers := []struct {
+		name     string
+		transfer entities.BudgetTransfer
+		wantErr  bool
+	}{
+		{"tag to tag", entities.BudgetTransfer{From: "batch", To: "interactive", Tokens: 10000, Reason: "launch"}, false},
+		{"tag to one of its sessions", entities.BudgetTransfer{From: "interactive", To: "interactive:agent-1", Tokens: 5000}, false},
+		{"session on the default", entities.BudgetTransfer{From: "batch", To: "adhoc", Tokens: 500}, false},
+		{"same key", entities.BudgetTransfer{From: "batch", To: "batch", Tokens: 1}, true},
+		{"no tokens", entities.BudgetTransfer{From: "batch", To: "adhoc", Tokens: 0}, true},
+		{"missing key", entities.BudgetTransfer{To: "adhoc", Tokens: 1}, true},
+		{"from unlimited", entities.BudgetTransfer{From: "vip", To: "adhoc", Tokens: 1}, true},
+		{"to unlimited", entities.BudgetTransfer{From: "batch", To: "vip:1", Tokens: 1}, true},
+		{"more than the budget", entities.BudgetTransfer{From: "adhoc", To: "batch", Tokens: 1500}, true},
+	}
+	for _, tt := range transfers {
+		_, err := ledger.Transfer(tt.transfer)
+		if tt.wantErr && !errors.Is(err, entities.ErrInvalidBudgetTransfer) {
+			t.Errorf("Transfer(%s) error = %v, want ErrInvalidBudgetTransfer", tt.name, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("Transfer(%s) error = %v", tt.name, err)
+		}
+	}
+
+	for sessionID, want := range map[string]int{
+		"batch":               39500,
+		"batch:nightly":       39500,
+		"interactive":         25000,
+		"interactive:agent-1": 30000,
+		"interactive:agent-2": 25000,
+		"adhoc":               1500,
+		"other":               1000,
+		"vip:1":               0,
+	} {
+		if got := ledger.BudgetFor(sessionID); got != want {
+			t.Errorf("BudgetFor(%s) = %d, want %d", sessionID, got, want)
+		}
+	}
+
+	allocations, err := ledger.Allocations()
+	if err != nil {
+		t.Fatalf("Allocations() error = %v", err)
+	}
+	want := []entities.BudgetAllocation{
+		{Key: "adhoc", Configured: 1000, Transferred: 500, Budget: 1500},
+		{Key: "batch", Configured: 50000, Transferred: -10500, Budget: 39500},
+		{Key: "interactive", Configured: 20000, Transferred: 5000, Budget: 25000},
+		{Key: "interactive:agent-1", Configured: 25000, Transferred: 5000, Budget: 30000},
+		{Key: "vip", Configured: 0, Transferred: 0, Budget: 0},
+	}
+	if len(allocations) != len(want) {
+		t.Fatalf("Allocations() = %+v, want %+v", allocations, want)
+	}
+	for i := range want {
+		if allocations[i] != want[i] {
+			t.Errorf("Allocations()[%d] = %+v, want %+v", i, allocations[i], want[i])
+		}
+	}
+}
+
+func TestLedger_Match(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	ledger := NewLedger(entities.SessionBudgets{
+		Default:  1000,
+		Sessions: map[string]int{"agent-1": 5000, "small": 200, "vip": 0},
+	}, repo)
+
+	transfer, err := ledger.Match("agent-1", "agent-2", "clone of agent-1")
+	if err != nil || transfer == nil || transfer.From != "" || transfer.Tokens != 4000 {
+		t.Fatalf("Match() = %+v, %v, want a transfer of 4000 tokens", transfer, err)
+	}
+	if transfer, _ := ledger.Match("small", "small-2", ""); transfer == nil || transfer.Tokens != -800 {
+		t.Errorf("Match(small) = %+v, want a transfer of -800 tokens", transfer)
+	}
+	// Unlimited budgets and budgets that already match are left alone
+	for _, source := range []string{"vip", "other"} {
+		if transfer, err := ledger.Match(source, "clone", ""); transfer != nil || err != nil {
+			t.Errorf("Match(%s) = %+v, %v, want no transfer", source, transfer, err)
+		}
+	}
+	for sessionID, want := range map[string]int{"agent-2": 5000, "small-2": 200, "agent-1": 5000, "clone": 1000} {
+		if got := ledger.BudgetFor(sessionID); got != want {
+			t.Errorf("BudgetFor(%s) = %d, want %d", sessionID, got, want)
+		}
+	}
+}
+
+func TestLedger_Reload(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	budgets := entities.SessionBudgets{Sessions: map[string]int{"a": 100, "b": 100}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ledger, other := NewLedger(budgets, repo), NewLedger(budgets, repo)
+	ledger.now = func() time.Time { return now }
+
+	if got := ledger.BudgetFor("b"); got != 100 {
+		t.Fatalf("BudgetFor(b) = %d, want 100", got)
+	}
+	// A transfer made by another replica applies once the amounts are reloaded
+	if _, err := other.Transfer(entities.BudgetTransfer{From: "a", To: "b", Tokens: 40}); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if got := ledger.BudgetFor("b"); got != 100 {
+		t.Errorf("BudgetFor(b) before the reload = %d, want 100", got)
+	}
+	now = now.Add(reloadInterval)
+	if got := ledger.BudgetFor("b"); got != 140 {
+		t.Errorf("BudgetFor(b) after the reload = %d, want 140", got)
+	}
+}
@@ -0,0 +1,155 @@
+package budget
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// DefaultTier is the key of the overdraft rule of sessions whose tag has none
+const DefaultTier = "*"
+
+// Metrics of the enforcer
+const (
+	// OverdraftMetric counts requests let through past their session's budget
+	OverdraftMetric = "budget_overdraft_requests_total"
+	// RejectedMetric counts requests rejected once the overdraft ran out
+	RejectedMetric = "budget_rejected_total"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// Enforcer wraps a queue and rejects the requests of sessions past their
+// budget and its overdraft. The rule of a session is the one keyed by its
+// tag, or the default rule; sessions without one are not enforced, and
+// neither are requests without a session.
+type Enforcer struct {
+	next     Queue
+	budgets  Budgets
+	sessions Sessions
+	rules    map[string]entities.BudgetOverdraft
+	metrics  Counter
+	now      func() time.Time
+
+	mu sync.Mutex
+	// exceededAt holds when each session went past its budget, which starts
+	// its grace period
+	exceededAt map[string]time.Time
+}
+
+// NewEnforcer creates a new Enforcer in front of next
+func NewEnforcer(next Queue, budgets Budgets, sessions Sessions, rules map[string]entities.BudgetOverdraft, metrics Counter) *Enforcer {
+	return &Enforcer{
+		next:       next,
+		budgets:    budgets,
+		sessions:   sessions,
+		rules:      rules,
+		metrics:    metrics,
+		now:        time.Now,
+		exceededAt: make(map[string]time.Time),
+	}
+}
+
+// Push forwards the request unless its session ran out of budget and overdraft
+func (e *Enforcer) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	overdraft, err := e.check(r.SessionID)
+	if err != nil {
+		e.metrics.Inc(RejectedMetric)
+		return entities.ProxyResponse{Err: err}
+	}
+	if overdraft {
+		e.metrics.Inc(OverdraftMetric)
+	}
+	return e.next.Push(r)
+}
+
+// Blocked reports whether the session's requests are rejected for its budget
+func (e *Enforcer) Blocked(sessionID string) bool {
+	_, err := e.check(sessionID)
+	return err != nil
+}
+
+// check returns an entities.ErrBudgetExceeded error if the session's requests
+// are rejected, and reports whether they are let through on overdraft
+func (e *Enforcer) check(sessionID string) (bool, error) {
+	rule, ok := e.ruleOf(sessionID)
+	if !ok {
+		return false, nil
+	}
+	budget := e.budgets.BudgetFor(sessionID)
+	if budget <= 0 {
+		return false, nil
+	}
+	sess, err := e.sessions.GetSession(sessionID)
+	if err != nil {
+		return false, nil
+	}
+	over := sess.TotalTokens - budget
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if over < 0 {
+		// Back within its budget, e.g. after a transfer
+		delete(e.exceededAt, sessionID)
+		return false, nil
+	}
+	now := e.now()
+	exceededAt, ok := e.exceededAt[sessionID]
+	if !ok {
+		exceededAt = now
+		e.exceededAt[sessionID] = now
+	}
+	if (rule.Tokens == 0 && rule.Grace == 0) ||
+		(rule.Tokens > 0 && over >= rule.Tokens) ||
+		(rule.Grace > 0 && now.Sub(exceededAt) >= rule.Grace) {
+		return false, fmt.Errorf("%w: session %s has used %d of its %d token budget", entities.ErrBudgetExceeded, sessionID, sess.TotalTokens, budget)
+	}
+	return true, nil
+}
+
+// ruleOf returns the overdraft rule of a session
+func (e *Enforcer) ruleOf(sessionID string) (entities.BudgetOverdraft, bool) {
+	if sessionID == "" {
+		return entities.BudgetOverdraft{}, false
+	}
+	if tag := entities.SessionTag(sessionID); tag != "" {
+		if rule, ok := e.rules[tag]; ok {
+			return rule, true
+		}
+	}
+	rule, ok := e.rules[DefaultTier]
+	return rule, ok
+}
+
+// ParseOverdrafts parses overdraft rules keyed by session tag, or "*" for the
+// default, with values of the form tokens[:grace], e.g. "50000:15m". A rule
+// of "0" blocks sessions at their budget.
+func ParseOverdrafts(specs map[string]string) (map[string]entities.BudgetOverdraft, error) {
+	rules := make(map[string]entities.BudgetOverdraft, len(specs))
+	for tag, spec := range specs {
+		tokens, grace, hasGrace := strings.Cut(strings.TrimSpace(spec), ":")
+		var rule entities.BudgetOverdraft
+		var err error
+		if rule.Tokens, err = strconv.Atoi(tokens); err != nil || rule.Tokens < 0 {
+			return nil, fmt.Errorf("invalid budget overdraft %s=%q: tokens must be a non-negative integer", tag, spec)
+		}
+		if hasGrace && grace != "" {
+			if rule.Grace, err = time.ParseDuration(grace); err != nil || rule.Grace < 0 {
+				return nil, fmt.Errorf("invalid budget overdraft %s=%q: grace must be a duration such as 15m", tag, spec)
+			}
+		}
+		rules[tag] = rule
+	}
+	return rules, nil
+}
@@ -0,0 +1,97 @@
+package budget
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+type okQueue struct{}
+
+func (okQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return entities.ProxyResponse{StatusCode: http.StatusOK}
+}
+
+type counter map[string]int
+
+func (c counter) Inc(name string) {
+	c[name]++
+}
+
+func TestEnforcer(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	budgets := entities.SessionBudgets{Default: 1000}
+	rules, err := ParseOverdrafts(map[string]string{"prod": "500", "chat": "0:15m", "eval": "500:15m", "*": "0"})
+	if err != nil {
+		t.Fatalf("ParseOverdrafts() error = %v", err)
+	}
+	metrics := counter{}
+	enforcer := NewEnforcer(okQueue{}, budgets, repo, rules, metrics)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	enforcer.now = func() time.Time { return now }
+
+	use := func(sessionID string, tokens int) {
+		repo.UpdateSessionTokens(sessionID, entities.TokenUsage{TotalTokens: tokens})
+	}
+	push := func(sessionID string) error {
+		return enforcer.Push(entities.ProxyRequest{SessionID: sessionID}).Err
+	}
+
+	steps := []struct {
+		name      string
+		sessionID string
+		tokens    int
+		advance   time.Duration
+		wantErr   bool
+	}{
+		{"within budget", "batch:1", 999, 0, false},
+		{"default rule blocks at the budget", "batch:1", 1, 0, true},
+		{"token allowance", "prod:1", 1400, 0, false},
+		{"token allowance used up", "prod:1", 100, 0, true},
+		{"grace period", "chat:1", 5000, 10 * time.Minute, false},
+		{"grace period over", "chat:1", 0, 5 * time.Minute, true},
+		{"both, allowance first", "eval:1", 1500, 0, true},
+		{"both, grace first", "eval:2", 1100, 15 * time.Minute, true},
+		{"no session", "", 0, 0, false},
+	}
+	for _, step := range steps {
+		use(step.sessionID, step.tokens)
+		if step.sessionID != "" && step.advance > 0 {
+			// The grace period starts at the first request past the budget
+			push(step.sessionID)
+			now = now.Add(step.advance)
+		}
+		err := push(step.sessionID)
+		if step.wantErr && !errors.Is(err, entities.ErrBudgetExceeded) {
+			t.Errorf("Push(%s) error = %v, want ErrBudgetExceeded", step.name, err)
+		}
+		if !step.wantErr && err != nil {
+			t.Errorf("Push(%s) error = %v", step.name, err)
+		}
+	}
+	if !enforcer.Blocked("prod:1") || enforcer.Blocked("unknown") {
+		t.Error("Blocked() should report the blocked sessions only")
+	}
+	if metrics[RejectedMetric] != 5 || metrics[OverdraftMetric] != 5 {
+		t.Errorf("metrics = %v", metrics)
+	}
+}
+
+func TestParseOverdrafts(t *testing.T) {
+	rules, err := ParseOverdrafts(map[string]string{"prod": "50000:15m", "*": "0"})
+	if err != nil {
+		t.Fatalf("ParseOverdrafts() error = %v", err)
+	}
+	if rules["prod"] != (entities.BudgetOverdraft{Tokens: 50000, Grace: 15 * time.Minute}) || rules["*"] != (entities.BudgetOverdraft{}) {
+		t.Errorf("ParseOverdrafts() = %+v", rules)
+	}
+	for _, spec := range []string{"", "-1", "100:soon", "x:1m"} {
+		if _, err := ParseOverdrafts(map[string]string{"prod": spec}); err == nil {
+			t.Errorf("ParseOverdrafts(%q) should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package budget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+const (
+	// WarningHeader carries the warning of a session running low on budget
+	WarningHeader = "X-Proxy-Warning"
+	// WarningField carries the warning in the body of chat completions
+	WarningField = "x-proxy-warning"
+)
+
+// chatPath is the endpoint whose bodies carry the warning
+const chatPath = "/v1/chat/completions"
+
+// Budgets resolves the token budget of a session
+type Budgets interface {
+	BudgetFor(sessionID string) int
+}
+
+// Sessions looks up the token usage of sessions
+type Sessions interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+}
+
+// Warner is a response filter that warns a session it is running low on
+// budget once it has used the configured share of it, so applications can
+// tell their users before the budget runs out
+type Warner struct {
+	budgets  Budgets
+	sessions Sessions
+	settings entities.BudgetWarningSettings
+}
+
+// NewWarner creates a new Warner with injected dependencies
+func NewWarner(budgets Budgets, sessions Sessions, settings entities.BudgetWarningSettings) *Warner {
+	return &Warner{
+		budgets:  budgets,
+		sessions: sessions,
+		settings: settings,
+	}
+}
+
+// FilterResponse adds the warning header to successful responses of a session
+// past the threshold and, if enabled, the warning field to chat completions.
+// The usage of the response itself is already counted.
+func (w *Warner) FilterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+	if sessionID == "" || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+	budget := w.budgets.BudgetFor(sessionID)
+	if budget <= 0 {
+		return nil
+	}
+	sess, err := w.sessions.GetSession(sessionID)
+	if err != nil {
+		log.Printf("Error getting session %s for its budget warning: %v", sessionID, err)
+		return nil
+	}
+	if sess.TotalTokens*100 < budget*w.settings.Percent {
+		return nil
+	}
+
+	warning := fmt.Sprintf("Session has used %d of its %d token budget (%d%%)",
+		sess.TotalTokens, budget, sess.TotalTokens*100/budget)
+	if resp.Headers == nil {
+		resp.Headers = make(http.Header)
+	}
+	resp.Headers.Set(WarningHeader, warning)
+	if w.settings.Body && req.Path == chatPath {
+		resp.Body = withWarningField(resp, warning)
+	}
+	return nil
+}
+
+// withWarningField returns the body with the warning field appended to its
+// JSON object, keeping the other fields in place. Compressed bodies and ones
+// that are not a JSON object are returned as they are.
+func withWarningField(resp *entities.ProxyResponse, warning string) []byte {
+	if encoding := resp.Headers.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return resp.Body
+	}
+	body := bytes.TrimSpace(resp.Body)
+	if len(body) < 2 || body[0] != '{' || !json.Valid(body) {
+		return resp.Body
+	}
+	field, _ := json.Marshal(map[string]string{WarningField: warning})
+	inner := bytes.TrimSpace(body[1 : len(body)-1])
+	withField := make([]byte, 0, len(body)+len(field))
+	withField = append(withField, '{')
+	if len(inner) > 0 {
+		withField = append(withField, inner...)
+		withField = append(withField, ',')
+	}
+	withField = append(withField, field[1:]...)
+	return withField
+}
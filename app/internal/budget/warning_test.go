@@ -0,0 +1,96 @@
+package budget
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestWarner_FilterResponse(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.UpdateSessionTokens("low", entities.TokenUsage{TotalTokens: 850})
+	repo.UpdateSessionTokens("fine", entities.TokenUsage{TotalTokens: 300})
+	repo.UpdateSessionTokens("unlimited", entities.TokenUsage{TotalTokens: 5000})
+	budgets := entities.SessionBudgets{Sessions: map[string]int{"low": 1000, "fine": 1000}}
+	warner := NewWarner(budgets, repo, entities.BudgetWarningSettings{Percent: 80, Body: true})
+	const warning = "Session has used 850 of its 1000 token budget (85%)"
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		path       string
+		resp       entities.ProxyResponse
+		wantHeader string
+		wantBody   string
+	}{
+		{
+			name:       "chat completion past the threshold",
+			sessionID:  "low",
+			path:       chatPath,
+			resp:       entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"id":"chatcmpl-1","choices":[]}` + "\n")},
+			wantHeader: warning,
+			wantBody:   `{"id":"chatcmpl-1","choices":[],"x-proxy-warning":"` + warning + `"}`,
+		},
+		{
+			name:       "other endpoint",
+			sessionID:  "low",
+			path:       "/v1/embeddings",
+			resp:       entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"data":[]}`)},
+			wantHeader: warning,
+			wantBody:   `{"data":[]}`,
+		},
+		{
+			name:       "compressed body",
+			sessionID:  "low",
+			path:       chatPath,
+			resp:       entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{"Content-Encoding": {"gzip"}}, Body: []byte("\x1f\x8b")},
+			wantHeader: warning,
+			wantBody:   "\x1f\x8b",
+		},
+		{
+			name:      "failed request",
+			sessionID: "low",
+			path:      chatPath,
+			resp:      entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"error":{}}`)},
+			wantBody:  `{"error":{}}`,
+		},
+		{
+			name:      "below the threshold",
+			sessionID: "fine",
+			path:      chatPath,
+			resp:      entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)},
+			wantBody:  `{}`,
+		},
+		{
+			name:      "unlimited budget",
+			sessionID: "unlimited",
+			path:      chatPath,
+			resp:      entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)},
+			wantBody:  `{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.resp
+			if err := warner.FilterResponse(tt.sessionID, &entities.ProxyRequest{Path: tt.path}, &resp); err != nil {
+				t.Fatalf("FilterResponse() error = %v", err)
+			}
+			if got := resp.Headers.Get(WarningHeader); got != tt.wantHeader {
+				t.Errorf("%s = %q, want %q", WarningHeader, got, tt.wantHeader)
+			}
+			if string(resp.Body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", resp.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// Without Body, only the header carries the warning
+	warner = NewWarner(budgets, repo, entities.BudgetWarningSettings{Percent: 80})
+	resp := entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"id":"chatcmpl-1"}`)}
+	warner.FilterResponse("low", &entities.ProxyRequest{Path: chatPath}, &resp)
+	if resp.Headers.Get(WarningHeader) != warning || string(resp.Body) != `{"id":"chatcmpl-1"}` {
+		t.Errorf("response = %+v, want the header only", resp)
+	}
+}
@@ -0,0 +1,51 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo.Version=v1.2.0
+//	  -X github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo.Commit=$(git rev-parse --short HEAD)
+//	  -X github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Get returns the build information. A commit or build date not set with
+// -ldflags falls back to the VCS information Go embeds in the binary.
+func Get() entities.BuildInfo {
+	info := entities.BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if info.Commit != "" && info.BuildDate != "" {
+		return info
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
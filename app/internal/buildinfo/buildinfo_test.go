@@ -0,0 +1,27 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet_UsesLinkerValues(t *testing.T) {
+	defer func(version, commit, date string) {
+		Version, Commit, BuildDate = version, commit, date
+	}(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.0", "abc1234", "2024-01-15T10:00:00Z"
+
+	info := Get()
+	if info.Version != "v1.2.0" || info.Commit != "abc1234" || info.BuildDate != "2024-01-15T10:00:00Z" {
+		t.Errorf("Get() = %+v, want the values set at link time", info)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("Get() GoVersion = %q, want %q", info.GoVersion, runtime.Version())
+	}
+}
+
+func TestGet_Defaults(t *testing.T) {
+	if info := Get(); info.Version != "dev" {
+		t.Errorf("Get() Version = %q, want dev", info.Version)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	GetCacheEntry(key string) (*entities.CacheEntry, error)
+	PutCacheEntry(entry entities.CacheEntry) error
+}
+
+// EmbeddingCache wraps a queue and serves repeated embedding requests from a
+// persistent store instead of calling the upstream again.
+type EmbeddingCache struct {
+	next        Queue
+	store       Store
+	hits        atomic.Int64
+	misses      atomic.Int64
+	tokensSaved atomic.Int64
+}
+
+// NewEmbeddingCache creates a new EmbeddingCache in front of the given queue
+func NewEmbeddingCache(next Queue, store Store) *EmbeddingCache {
+	return &EmbeddingCache{
+		next:  next,
+		store: store,
+	}
+}
+
+// Push serves embedding requests from the cache when possible and forwards
+// everything else to the wrapped queue
+func (c *EmbeddingCache) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	key, ok := cacheKey(r)
+	if !ok {
+		return c.next.Push(r)
+	}
+
+	entry, err := c.store.GetCacheEntry(key)
+	if err != nil {
+		log.Printf("Error reading embedding cache: %v", err)
+	}
+	if entry != nil && acceptsEncoding(r.Headers, entry.ContentEncoding) {
+		c.hits.Add(1)
+		c.tokensSaved.Add(int64(entry.PromptTokens))
+		headers := http.Header{}
+		headers.Set("Content-Type", entry.ContentType)
+		if entry.ContentEncoding != "" {
+			headers.Set("Content-Encoding", entry.ContentEncoding)
+		}
+		headers.Set("X-Cache", "HIT")
+		return entities.ProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    headers,
+			Body:       entry.Body,
+			Cached:     true,
+		}
+	}
+
+	c.misses.Add(1)
+	r.StreamResponseAbove = 0
+	resp := c.next.Push(r)
+	if resp.Err != nil || resp.StatusCode != http.StatusOK {
+		return resp
+	}
+
+	contentEncoding := resp.Headers.Get("Content-Encoding")
+	errPut := c.store.PutCacheEntry(entities.CacheEntry{
+		Key:             key,
+		Body:            resp.Body,
+		ContentType:     resp.Headers.Get("Content-Type"),
+		ContentEncoding: contentEncoding,
+		PromptTokens:    promptTokens(resp.Body, contentEncoding),
+		CreatedAt:       time.Now(),
+	})
+	if errPut != nil {
+		log.Printf("Error writing embedding cache: %v", errPut)
+	}
+	return resp
+}
+
+// Stats returns hit/miss counters and tokens saved since startup
+func (c *EmbeddingCache) Stats() entities.CacheStats {
+	stats := entities.CacheStats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		TokensSaved: c.tokensSaved.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// cacheKey derives the cache key of an embeddings request from the fields that
+// determine the vectors. It reports false for requests that are not cacheable.
+func cacheKey(r entities.ProxyRequest) (string, bool) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.Path, "/embeddings") || r.BodyStream != nil {
+		return "", false
+	}
+
+	var req struct {
+		Model          string          `json:"model"`
+		Input          json.RawMessage `json:"input"`
+		EncodingFormat string          `json:"encoding_format"`
+		Dimensions     int             `json:"dimensions"`
+	}
+	if err := json.Unmarshal(r.Body, &req); err != nil || req.Model == "" || len(req.Input) == 0 {
+		return "", false
+	}
+	var input bytes.Buffer
+	if err := json.Compact(&input, req.Input); err != nil {
+		return "", false
+	}
+
+	key, err := json.Marshal(struct {
+		Path           string          `json:"path"`
+		Model          string          `json:"model"`
+		Input          json.RawMessage `json:"input"`
+		EncodingFormat string          `json:"encoding_format"`
+		Dimensions     int             `json:"dimensions"`
+		// Tenants do not share cached responses
+		TenantID string `json:"tenant,omitempty"`
+	}{r.Path, req.Model, input.Bytes(), req.EncodingFormat, req.Dimensions, r.TenantID})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// acceptsEncoding reports whether the client can receive a body with the given encoding
+func acceptsEncoding(headers http.Header, encoding string) bool {
+	if encoding == "" || encoding == "identity" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(headers.Get("Accept-Encoding")), strings.ToLower(encoding))
+}
+
+// promptTokens reads usage.prompt_tokens from a (possibly compressed) embeddings response
+func promptTokens(body []byte, contentEncoding string) int {
+	body, err := entities.DecodeBody(body, contentEncoding, entities.DefaultMaxDecodedBytes)
+	if err != nil {
+		return 0
+	}
+
+	var resp struct {
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0
+	}
+	return resp.Usage.PromptTokens
+}
@@ -0,0 +1,98 @@
+package cache_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/cache"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+type countingQueue struct {
+	calls int
+	resp  entities.ProxyResponse
+}
+
+func (q *countingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.calls++
+	return q.resp
+}
+
+func embeddingRequest(body string) entities.ProxyRequest {
+	return entities.ProxyRequest{
+		Method:  http.MethodPost,
+		Path:    "/v1/embeddings",
+		Headers: http.Header{},
+		Body:    []byte(body),
+	}
+}
+
+func TestEmbeddingCache_HitAndMiss(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	upstreamBody := `{"data":[{"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":5,"total_tokens":5}}`
+	q := &countingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK, Headers: headers, Body: []byte(upstreamBody)}}
+	c := cache.NewEmbeddingCache(q, repository.NewMemoryRepository())
+
+	first := c.Push(embeddingRequest(`{"model":"text-embedding-3-small","input":"hello"}`))
+	if first.Cached {
+		t.Error("first request should not be served from cache")
+	}
+
+	// Whitespace differences in the input and extra fields don't change the key
+	second := c.Push(embeddingRequest(`{"input": "hello", "model":"text-embedding-3-small", "user":"u1"}`))
+	if !second.Cached {
+		t.Error("second identical request should be served from cache")
+	}
+	if string(second.Body) != upstreamBody {
+		t.Errorf("cached body = %s, want %s", second.Body, upstreamBody)
+	}
+	if second.Headers.Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache header = %q, want HIT", second.Headers.Get("X-Cache"))
+	}
+	if q.calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", q.calls)
+	}
+
+	// Different model is a miss
+	c.Push(embeddingRequest(`{"model":"text-embedding-3-large","input":"hello"}`))
+	if q.calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", q.calls)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.TokensSaved != 5 {
+		t.Errorf("Stats() = %+v, want 1 hit, 2 misses, 5 tokens saved", stats)
+	}
+}
+
+func TestEmbeddingCache_NonEmbeddingPassthrough(t *testing.T) {
+	q := &countingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}}}
+	c := cache.NewEmbeddingCache(q, repository.NewMemoryRepository())
+
+	req := entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{"model":"gpt-4","input":"x"}`)}
+	c.Push(req)
+	c.Push(req)
+
+	if q.calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", q.calls)
+	}
+	if stats := c.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v, want no cache activity", stats)
+	}
+}
+
+func TestEmbeddingCache_ErrorsNotCached(t *testing.T) {
+	q := &countingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Headers: http.Header{}}}
+	c := cache.NewEmbeddingCache(q, repository.NewMemoryRepository())
+
+	req := embeddingRequest(`{"model":"m","input":"x"}`)
+	c.Push(req)
+	if resp := c.Push(req); resp.Cached {
+		t.Error("error responses must not be cached")
+	}
+	if q.calls != 2 {
+		t.Errorf("upstream calls = %d, want 2", q.calls)
+	}
+}
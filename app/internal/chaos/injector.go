@@ -0,0 +1,219 @@
+// Package chaos injects faults into the requests of selected sessions and
+// virtual keys: errors, latency and event streams dropped midway
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Metrics of the injector
+const (
+	// ErrorsMetric counts injected error responses
+	ErrorsMetric = "chaos_errors_injected_total"
+	// DelaysMetric counts requests delayed by injected latency
+	DelaysMetric = "chaos_delays_injected_total"
+	// DropsMetric counts event streams cut off
+	DropsMetric = "chaos_streams_dropped_total"
+)
+
+// defaultDropAfterBytes is where streams are cut off when a rule does not say
+const defaultDropAfterBytes = 1024
+
+// errStreamDropped ends the streams that are cut off
+var errStreamDropped = errors.New("stream dropped by fault injection")
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// Injector is a queue decorator that applies the first fault rule matching a
+// request. Rules are set at runtime and are not persisted.
+type Injector struct {
+	next    Queue
+	metrics Counter
+	sleep   func(time.Duration)
+	// roll returns a number in [0, 100) that a percentage is compared with
+	roll func() float64
+
+	mu    sync.RWMutex
+	rules []entities.FaultRule
+}
+
+// NewInjector creates a new Injector without rules in front of next
+func NewInjector(next Queue, metrics Counter) *Injector {
+	return &Injector{
+		next:    next,
+		metrics: metrics,
+		sleep:   time.Sleep,
+		roll:    func() float64 { return rand.Float64() * 100 },
+	}
+}
+
+// Rules returns the active rules
+func (in *Injector) Rules() []entities.FaultRule {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return append([]entities.FaultRule{}, in.rules...)
+}
+
+// SetRules validates the rules and replaces the active ones with them
+func (in *Injector) SetRules(rules []entities.FaultRule) error {
+	for i, rule := range rules {
+		if err := validate(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	in.mu.Lock()
+	in.rules = append([]entities.FaultRule{}, rules...)
+	in.mu.Unlock()
+	if len(rules) > 0 {
+		log.Printf("Fault injection active with %d rules", len(rules))
+	}
+	return nil
+}
+
+// validate checks that a rule is scoped and its values are in range
+func validate(rule entities.FaultRule) error {
+	switch {
+	case rule.SessionTag == "" && rule.VirtualKeyID == "":
+		return errors.New("session_tag or virtual_key_id is required")
+	case rule.ErrorPercent < 0 || rule.ErrorPercent > 100:
+		return errors.New("error_percent must be between 0 and 100")
+	case rule.DropStreamPercent < 0 || rule.DropStreamPercent > 100:
+		return errors.New("drop_stream_percent must be between 0 and 100")
+	case rule.ErrorStatus != 0 && (rule.ErrorStatus < 400 || rule.ErrorStatus > 599):
+		return errors.New("error_status must be an HTTP error status")
+	case rule.LatencyMs < 0 || rule.DropAfterBytes < 0:
+		return errors.New("latency_ms and drop_after_bytes must not be negative")
+	}
+	return nil
+}
+
+// Push applies the faults of the rule matching the request, if any
+func (in *Injector) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	rule, ok := in.match(r)
+	if !ok {
+		return in.next.Push(r)
+	}
+	if rule.LatencyMs > 0 {
+		in.metrics.Inc(DelaysMetric)
+		in.sleep(time.Duration(rule.LatencyMs) * time.Millisecond)
+	}
+	if rule.ErrorPercent > 0 && in.roll() < rule.ErrorPercent {
+		in.metrics.Inc(ErrorsMetric)
+		return injectedError(rule.ErrorStatus)
+	}
+	resp := in.next.Push(r)
+	if rule.DropStreamPercent > 0 && isEventStream(resp) && in.roll() < rule.DropStreamPercent {
+		in.metrics.Inc(DropsMetric)
+		resp = drop(resp, rule.DropAfterBytes)
+	}
+	return resp
+}
+
+// match returns the first rule scoped to the request's session tag or virtual key
+func (in *Injector) match(r entities.ProxyRequest) (entities.FaultRule, bool) {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if len(in.rules) == 0 {
+		return entities.FaultRule{}, false
+	}
+	_, sessionID := entities.SplitTenantSessionID(r.SessionID)
+	tag := entities.SessionTag(sessionID)
+	for _, rule := range in.rules {
+		if rule.SessionTag != "" && rule.SessionTag != tag {
+			continue
+		}
+		if rule.VirtualKeyID != "" && rule.VirtualKeyID != r.VirtualKeyID {
+			continue
+		}
+		return rule, true
+	}
+	return entities.FaultRule{}, false
+}
+
+// injectedError is the error response of an injected fault, shaped like the
+// upstream's own
+func injectedError(status int) entities.ProxyResponse {
+	if status == 0 {
+		status = http.StatusTooManyRequests
+	}
+	errType, code := "server_error", "server_error"
+	headers := http.Header{"Content-Type": {"application/json"}}
+	switch {
+	case status == http.StatusTooManyRequests:
+		errType, code = "rate_limit_error", "rate_limit_exceeded"
+		headers.Set("Retry-After", "1")
+	case status == http.StatusServiceUnavailable:
+		headers.Set("Retry-After", "1")
+	case status < 500:
+		errType, code = "invalid_request_error", "injected_fault"
+	}
+	body, _ := json.Marshal(entities.NewErrorResponse(
+		fmt.Sprintf("Injected fault: %d %s", status, http.StatusText(status)), errType, code))
+	return entities.ProxyResponse{
+		StatusCode: status,
+		Headers:    headers,
+		Body:       body,
+	}
+}
+
+// isEventStream reports whether a successful response is a server-sent event stream
+func isEventStream(resp entities.ProxyResponse) bool {
+	if resp.Err != nil || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// drop returns the response with a body that fails after dropAfter bytes, or
+// halfway through a buffered body shorter than that
+func drop(resp entities.ProxyResponse, dropAfter int64) entities.ProxyResponse {
+	if dropAfter == 0 {
+		dropAfter = defaultDropAfterBytes
+	}
+	var body io.Reader
+	var closer io.Closer = io.NopCloser(nil)
+	if resp.BodyStream != nil {
+		body, closer = resp.BodyStream, resp.BodyStream
+	} else {
+		dropAfter = min(dropAfter, int64(len(resp.Body)/2))
+		body = bytes.NewReader(resp.Body)
+	}
+	resp.Body = nil
+	resp.BodyStream = droppedStream{
+		Reader: io.MultiReader(io.LimitReader(body, dropAfter), failingReader{}),
+		Closer: closer,
+	}
+	return resp
+}
+
+// droppedStream reads part of a body and then fails
+type droppedStream struct {
+	io.Reader
+	io.Closer
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errStreamDropped
+}
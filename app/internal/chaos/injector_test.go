@@ -0,0 +1,119 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+)
+
+type streamQueue struct {
+	pushed int
+	body   string
+}
+
+func (q *streamQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.pushed++
+	return entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": {"text/event-stream; charset=utf-8"}},
+		Body:       []byte(q.body),
+	}
+}
+
+func newTestInjector(t *testing.T, next Queue, rolls ...float64) (*Injector, *[]time.Duration) {
+	t.Helper()
+	injector := NewInjector(next, metrics.NewMetrics())
+	var slept []time.Duration
+	injector.sleep = func(d time.Duration) { slept = append(slept, d) }
+	injector.roll = func() float64 {
+		if len(rolls) == 0 {
+			t.Fatal("unexpected roll")
+		}
+		roll := rolls[0]
+		rolls = rolls[1:]
+		return roll
+	}
+	return injector, &slept
+}
+
+func TestInjector_Errors(t *testing.T) {
+	next := &streamQueue{body: "data: [DONE]\n\n"}
+	injector, slept := newTestInjector(t, next, 10, 60, 10)
+	if err := injector.SetRules([]entities.FaultRule{
+		{SessionTag: "ci", ErrorPercent: 50, LatencyMs: 200},
+		{VirtualKeyID: "vk_1", ErrorPercent: 50, ErrorStatus: http.StatusBadGateway},
+	}); err != nil {
+		t.Fatalf("SetRules() error = %v", err)
+	}
+
+	resp := injector.Push(entities.ProxyRequest{SessionID: "acme/ci:run-1"})
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Headers.Get("Retry-After") != "1" ||
+		!strings.Contains(string(resp.Body), "rate_limit_exceeded") || next.pushed != 0 {
+		t.Errorf("Push() = %d %v %s after %d upstream calls, want an injected 429", resp.StatusCode, resp.Headers, resp.Body, next.pushed)
+	}
+	if resp := injector.Push(entities.ProxyRequest{SessionID: "ci:run-2"}); resp.StatusCode != http.StatusOK || next.pushed != 1 {
+		t.Errorf("Push() above the error percent = %d, want the upstream response", resp.StatusCode)
+	}
+	if len(*slept) != 2 || (*slept)[0] != 200*time.Millisecond {
+		t.Errorf("slept %v, want the latency before both requests", *slept)
+	}
+	if resp := injector.Push(entities.ProxyRequest{SessionID: "prod:1", VirtualKeyID: "vk_1"}); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Push() with the virtual key = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	// Requests no rule is scoped to are never touched, and roll nothing
+	if resp := injector.Push(entities.ProxyRequest{SessionID: "prod:2", VirtualKeyID: "vk_2"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("Push() of an unmatched request = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestInjector_DropStream(t *testing.T) {
+	body := strings.Repeat("data: {\"choices\":[]}\n\n", 10)
+	next := &streamQueue{body: body}
+	injector, _ := newTestInjector(t, next, 10, 10, 90)
+	injector.SetRules([]entities.FaultRule{{SessionTag: "ci", DropStreamPercent: 50, DropAfterBytes: 40}})
+
+	resp := injector.Push(entities.ProxyRequest{SessionID: "ci:1"})
+	if resp.BodyStream == nil {
+		t.Fatalf("Push() body was not cut off")
+	}
+	got, err := io.ReadAll(resp.BodyStream)
+	if !errors.Is(err, errStreamDropped) || string(got) != body[:40] {
+		t.Errorf("stream = %q, %v, want the first 40 bytes and a failure", got, err)
+	}
+
+	// Streams shorter than the limit are cut halfway
+	next.body = "data: {}\n\ndata: [DONE]\n\n"
+	injector.rules[0].DropAfterBytes = 0
+	resp = injector.Push(entities.ProxyRequest{SessionID: "ci:1"})
+	got, _ = io.ReadAll(resp.BodyStream)
+	if string(got) != next.body[:len(next.body)/2] {
+		t.Errorf("short stream = %q, want its first half", got)
+	}
+	if resp := injector.Push(entities.ProxyRequest{SessionID: "ci:1"}); resp.BodyStream != nil || string(resp.Body) != next.body {
+		t.Errorf("Push() above the drop percent cut the stream off")
+	}
+}
+
+func TestInjector_SetRules(t *testing.T) {
+	injector := NewInjector(&streamQueue{}, metrics.NewMetrics())
+	for _, rule := range []entities.FaultRule{
+		{ErrorPercent: 10},
+		{SessionTag: "ci", ErrorPercent: 120},
+		{SessionTag: "ci", DropStreamPercent: -1},
+		{SessionTag: "ci", ErrorStatus: http.StatusOK},
+		{SessionTag: "ci", LatencyMs: -5},
+	} {
+		if err := injector.SetRules([]entities.FaultRule{rule}); err == nil {
+			t.Errorf("SetRules(%+v) succeeded, want an error", rule)
+		}
+	}
+	if len(injector.Rules()) != 0 {
+		t.Errorf("Rules() = %+v after invalid updates, want none", injector.Rules())
+	}
+}
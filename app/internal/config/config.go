@@ -1,28 +1,515 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	IsDev   bool `env:"IS_DEV" env-default:"false"`
-	IsDebug bool `env:"IS_DEBUG" env-default:"false"`
+	IsDev   bool `env:"IS_DEV" env-default:"false" yaml:"is_dev" toml:"is_dev"`
+	IsDebug bool `env:"IS_DEBUG" env-default:"false" yaml:"is_debug" toml:"is_debug"`
 
 	OpenAI struct {
-		APIKey          string `env:"OPENAI_API_KEY" env-required:"true"`
-		BaseURL         string `env:"OPENAI_BASE_URL" env-default:"https://api.openai.com/v1"`
-		RateLimitPerMin int    `env:"RATE_LIMIT_PER_MIN" env-default:"60"`
-	}
+		APIKey string `env:"OPENAI_API_KEY" yaml:"api_key" toml:"api_key"`
+		// File holding the API key, e.g. a Docker or Kubernetes secret mount; takes precedence over OPENAI_API_KEY
+		APIKeyFile      string `env:"OPENAI_API_KEY_FILE" yaml:"api_key_file" toml:"api_key_file"`
+		BaseURL         string `env:"OPENAI_BASE_URL" env-default:"https://api.openai.com/v1" yaml:"base_url" toml:"base_url"`
+		RateLimitPerMin int    `env:"RATE_LIMIT_PER_MIN" env-default:"60" yaml:"rate_limit_per_min" toml:"rate_limit_per_min"`
+		// Per-endpoint requests per minute keyed by path prefix, e.g. /v1/embeddings:3000
+		RateLimitOverrides map[string]int `env:"RATE_LIMIT_OVERRIDES" env-separator:"," yaml:"rate_limit_overrides" toml:"rate_limit_overrides"`
+		// Client certificate presented to the upstream, e.g. a private gateway requiring mutual TLS
+		ClientCertFile string `env:"OPENAI_CLIENT_CERT_FILE" yaml:"client_cert_file" toml:"client_cert_file"`
+		ClientKeyFile  string `env:"OPENAI_CLIENT_KEY_FILE" yaml:"client_key_file" toml:"client_key_file"`
+		// CAs trusted for the upstream in addition to the system roots
+		CAFile string `env:"OPENAI_CA_FILE" yaml:"ca_file" toml:"ca_file"`
+	} `yaml:"openai" toml:"openai"`
 	HTTP struct {
-		Port int `env:"PORT" env-default:"8080"`
-	}
+		Port         int           `env:"PORT" env-default:"8080" yaml:"port" toml:"port"`
+		ReadTimeout  time.Duration `env:"HTTP_READ_TIMEOUT" env-default:"60s" yaml:"read_timeout" toml:"read_timeout"`
+		WriteTimeout time.Duration `env:"HTTP_WRITE_TIMEOUT" env-default:"10m" yaml:"write_timeout" toml:"write_timeout"`
+		IdleTimeout  time.Duration `env:"HTTP_IDLE_TIMEOUT" env-default:"120s" yaml:"idle_timeout" toml:"idle_timeout"`
+		// Origins allowed to call the proxy from browsers; "*" allows any
+		CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS" env-separator:"," yaml:"cors_allowed_origins" toml:"cors_allowed_origins"`
+		// Maximum size of buffered request bodies; 0 disables the limit
+		MaxBodyBytes int64 `env:"MAX_BODY_BYTES" env-default:"33554432" yaml:"max_body_bytes" toml:"max_body_bytes"`
+		// Maximum size of streamed multipart uploads (audio, files); 0 disables the limit
+		MaxUploadBytes int64 `env:"MAX_UPLOAD_BYTES" env-default:"536870912" yaml:"max_upload_bytes" toml:"max_upload_bytes"`
+		// Interval of SSE heartbeats sent to streaming requests while they wait in the queue; 0 disables them
+		SSEHeartbeatInterval time.Duration `env:"SSE_HEARTBEAT_INTERVAL" env-default:"0s" yaml:"sse_heartbeat_interval" toml:"sse_heartbeat_interval"`
+		// Upstream responses larger than this, or of unknown length, are streamed to clients unbuffered; 0 buffers all
+		StreamResponseBytes int64 `env:"STREAM_RESPONSES_ABOVE" env-default:"0" yaml:"stream_responses_above" toml:"stream_responses_above"`
+		// Maximum size compressed response bodies are decompressed to for usage parsing; 0 disables the limit
+		MaxDecodedBytes int64 `env:"MAX_DECODED_RESPONSE_BYTES" env-default:"67108864" yaml:"max_decoded_response_bytes" toml:"max_decoded_response_bytes"`
+		// Client IPs or CIDR ranges allowed to use the proxy; empty allows all
+		AllowedCIDRs []string `env:"ALLOWED_CIDRS" env-separator:"," yaml:"allowed_cidrs" toml:"allowed_cidrs"`
+		// Client IPs or CIDR ranges rejected on both the proxy and admin listeners
+		DeniedCIDRs []string `env:"DENIED_CIDRS" env-separator:"," yaml:"denied_cidrs" toml:"denied_cidrs"`
+		// Reverse proxies whose X-Forwarded-For or X-Real-IP header identifies the client;
+		// TRUSTED_PROXIES is accepted as an alias
+		TrustedProxyCIDRs []string `env:"TRUSTED_PROXY_CIDRS,TRUSTED_PROXIES" env-separator:"," yaml:"trusted_proxy_cidrs" toml:"trusted_proxy_cidrs"`
+		// Send X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and Forwarded headers upstream
+		ForwardClientIP bool `env:"FORWARD_CLIENT_IP" env-default:"false" yaml:"forward_client_ip" toml:"forward_client_ip"`
+		// Requests per minute allowed from each client IP; 0 disables the limit
+		IPRateLimitPerMin int `env:"IP_RATE_LIMIT_PER_MIN" env-default:"0" yaml:"ip_rate_limit_per_min" toml:"ip_rate_limit_per_min"`
+		// Requests a client IP may burst above its rate; 0 allows a minute's worth
+		IPRateLimitBurst int `env:"IP_RATE_LIMIT_BURST" env-default:"0" yaml:"ip_rate_limit_burst" toml:"ip_rate_limit_burst"`
+	} `yaml:"http" toml:"http"`
+	TLS struct {
+		CertFile string `env:"TLS_CERT_FILE" yaml:"cert_file" toml:"cert_file"`
+		KeyFile  string `env:"TLS_KEY_FILE" yaml:"key_file" toml:"key_file"`
+		// Hostnames to obtain Let's Encrypt certificates for; mutually exclusive with cert files
+		AutocertHosts    []string `env:"TLS_AUTOCERT_HOSTS" env-separator:"," yaml:"autocert_hosts" toml:"autocert_hosts"`
+		AutocertCacheDir string   `env:"TLS_AUTOCERT_CACHE_DIR" env-default:"autocert-cache" yaml:"autocert_cache_dir" toml:"autocert_cache_dir"`
+		AutocertEmail    string   `env:"TLS_AUTOCERT_EMAIL" yaml:"autocert_email" toml:"autocert_email"`
+		// CAs that client certificates must chain to; setting it enables mutual TLS on the public listener
+		ClientCAFile string `env:"TLS_CLIENT_CA_FILE" yaml:"client_ca_file" toml:"client_ca_file"`
+		// "require" rejects clients without a certificate; "optional" only verifies certificates that are sent
+		ClientAuth string `env:"TLS_CLIENT_AUTH" env-default:"require" yaml:"client_auth" toml:"client_auth"`
+	} `yaml:"tls" toml:"tls"`
+	Alerts struct {
+		// Webhooks receiving alerts as JSON objects or Slack messages
+		WebhookURLs      []string `env:"ALERT_WEBHOOK_URLS" env-separator:"," yaml:"webhook_urls" toml:"webhook_urls"`
+		SlackWebhookURLs []string `env:"ALERT_SLACK_WEBHOOK_URLS" env-separator:"," yaml:"slack_webhook_urls" toml:"slack_webhook_urls"`
+		// Percentages of a session token budget that fire an alert when crossed
+		BudgetThresholds []int `env:"ALERT_BUDGET_THRESHOLDS" env-separator:"," env-default:"80,100" yaml:"budget_thresholds" toml:"budget_thresholds"`
+		// Percentage of failed upstream responses (errors, 429 and 5xx) that fires an alert; 0 disables
+		ErrorRate            float64       `env:"ALERT_ERROR_RATE" env-default:"0" yaml:"error_rate" toml:"error_rate"`
+		ErrorRateWindow      time.Duration `env:"ALERT_ERROR_RATE_WINDOW" env-default:"5m" yaml:"error_rate_window" toml:"error_rate_window"`
+		ErrorRateMinRequests int           `env:"ALERT_ERROR_RATE_MIN_REQUESTS" env-default:"20" yaml:"error_rate_min_requests" toml:"error_rate_min_requests"`
+		// Pending requests a queue must stay above for QueueDepthDuration to fire an alert; 0 disables
+		QueueDepth         int           `env:"ALERT_QUEUE_DEPTH" env-default:"0" yaml:"queue_depth" toml:"queue_depth"`
+		QueueDepthDuration time.Duration `env:"ALERT_QUEUE_DEPTH_DURATION" env-default:"60s" yaml:"queue_depth_duration" toml:"queue_depth_duration"`
+		// How often session token consumption is compared with its baseline; 0 disables anomaly detection
+		AnomalyInterval time.Duration `env:"ALERT_ANOMALY_INTERVAL" env-default:"0" yaml:"anomaly_interval" toml:"anomaly_interval"`
+		// Standard deviations above its baseline a session's consumption over an interval must be to fire an alert
+		AnomalyZScore float64 `env:"ALERT_ANOMALY_Z_SCORE" env-default:"3" yaml:"anomaly_z_score" toml:"anomaly_z_score"`
+		// Tokens per interval below which a session is never flagged
+		AnomalyMinTokens int `env:"ALERT_ANOMALY_MIN_TOKENS" env-default:"10000" yaml:"anomaly_min_tokens" toml:"anomaly_min_tokens"`
+		// Intervals of history a baseline needs before it is used
+		AnomalyMinSamples int `env:"ALERT_ANOMALY_MIN_SAMPLES" env-default:"6" yaml:"anomaly_min_samples" toml:"anomaly_min_samples"`
+		// Weight of the latest interval in the moving baseline, in (0, 1]
+		AnomalyAlpha float64 `env:"ALERT_ANOMALY_ALPHA" env-default:"0.2" yaml:"anomaly_alpha" toml:"anomaly_alpha"`
+		// Minimum time between repeated alerts of the same kind and subject
+		Cooldown time.Duration `env:"ALERT_COOLDOWN" env-default:"15m" yaml:"cooldown" toml:"cooldown"`
+		Timeout  time.Duration `env:"ALERT_TIMEOUT" env-default:"10s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"alerts" toml:"alerts"`
+	Billing struct {
+		// Report session token usage to Stripe meter events; empty disables
+		StripeAPIKey  string `env:"STRIPE_API_KEY" yaml:"stripe_api_key" toml:"stripe_api_key"`
+		StripeBaseURL string `env:"STRIPE_BASE_URL" env-default:"https://api.stripe.com" yaml:"stripe_base_url" toml:"stripe_base_url"`
+		// Event name of the Stripe meter the tokens are recorded on
+		MeterEventName string `env:"STRIPE_METER_EVENT_NAME" env-default:"llm_tokens" yaml:"meter_event_name" toml:"meter_event_name"`
+		// Session metadata key holding the Stripe customer ID; sessions without it are not reported
+		CustomerMetadataKey string        `env:"STRIPE_CUSTOMER_METADATA_KEY" env-default:"stripe_customer_id" yaml:"customer_metadata_key" toml:"customer_metadata_key"`
+		ReportInterval      time.Duration `env:"STRIPE_REPORT_INTERVAL" env-default:"1h" yaml:"report_interval" toml:"report_interval"`
+		Timeout             time.Duration `env:"STRIPE_TIMEOUT" env-default:"30s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"billing" toml:"billing"`
+	Pricing struct {
+		// Unit prices keyed by {model}/{unit} or {unit} for all other models, e.g. dall-e-3/image:0.04;
+		// units are prompt_token, completion_token, image, audio_second and character
+		Prices map[string]float64 `env:"PRICING" env-separator:"," yaml:"prices" toml:"prices"`
+	} `yaml:"pricing" toml:"pricing"`
+	FineTuning struct {
+		// How often fine-tuning jobs created through a session are polled until they finish
+		PollInterval time.Duration `env:"FINE_TUNE_POLL_INTERVAL" env-default:"1m" yaml:"poll_interval" toml:"poll_interval"`
+	} `yaml:"fine_tuning" toml:"fine_tuning"`
+	Assistants struct {
+		// Assistants API threads whose runs count against a session, e.g. thread_abc:agent-1;
+		// threads created through a session URL are mapped automatically
+		ThreadSessions map[string]string `env:"THREAD_SESSIONS" env-separator:"," yaml:"thread_sessions" toml:"thread_sessions"`
+	} `yaml:"assistants" toml:"assistants"`
+	Tenants struct {
+		// Identify tenants by "header", virtual "key" or "path" prefix (/t/{tenant}/...); empty disables multi-tenancy
+		Mode string `env:"TENANT_MODE" yaml:"mode" toml:"mode"`
+		// Header carrying the tenant ID in header mode
+		Header string `env:"TENANT_HEADER" env-default:"X-Tenant-ID" yaml:"header" toml:"header"`
+		// How far the timestamp of a signed request may be from the server time in key mode
+		SignatureMaxSkew time.Duration `env:"TENANT_SIGNATURE_MAX_SKEW" env-default:"5m" yaml:"signature_max_skew" toml:"signature_max_skew"`
+		// Regions of the primary, hedge and shadow upstreams as name:region,
+		// checked against the residency of tenants
+		UpstreamRegions map[string]string `env:"UPSTREAM_REGIONS" env-separator:"," yaml:"upstream_regions" toml:"upstream_regions"`
+	} `yaml:"tenants" toml:"tenants"`
+	Secrets struct {
+		// Fetch the API key from "vault" or "aws" (Secrets Manager); empty uses OPENAI_API_KEY or OPENAI_API_KEY_FILE
+		Provider string `env:"SECRETS_PROVIDER" yaml:"provider" toml:"provider"`
+		// How often the key file or secret is re-read so the key can rotate without a restart; 0 disables
+		RefreshInterval time.Duration `env:"SECRETS_REFRESH_INTERVAL" env-default:"5m" yaml:"refresh_interval" toml:"refresh_interval"`
+		Timeout         time.Duration `env:"SECRETS_TIMEOUT" env-default:"10s" yaml:"timeout" toml:"timeout"`
+		// Field of the secret holding the key; for AWS an empty value uses the whole secret string
+		Field string `env:"SECRETS_FIELD" env-default:"api_key" yaml:"field" toml:"field"`
+
+		VaultAddr  string `env:"VAULT_ADDR" yaml:"vault_addr" toml:"vault_addr"`
+		VaultToken string `env:"VAULT_TOKEN" yaml:"vault_token" toml:"vault_token"`
+		// KV path, e.g. secret/data/llm-queue-proxy for KV version 2
+		VaultPath string `env:"VAULT_SECRET_PATH" yaml:"vault_path" toml:"vault_path"`
+
+		AWSRegion   string `env:"AWS_REGION" yaml:"aws_region" toml:"aws_region"`
+		AWSSecretID string `env:"AWS_SECRET_ID" yaml:"aws_secret_id" toml:"aws_secret_id"`
+		// Overrides the regional Secrets Manager endpoint, e.g. for VPC endpoints
+		AWSEndpoint        string `env:"AWS_SECRETS_MANAGER_ENDPOINT" yaml:"aws_endpoint" toml:"aws_endpoint"`
+		AWSAccessKeyID     string `env:"AWS_ACCESS_KEY_ID" yaml:"aws_access_key_id" toml:"aws_access_key_id"`
+		AWSSecretAccessKey string `env:"AWS_SECRET_ACCESS_KEY" yaml:"aws_secret_access_key" toml:"aws_secret_access_key"`
+		AWSSessionToken    string `env:"AWS_SESSION_TOKEN" yaml:"aws_session_token" toml:"aws_session_token"`
+	} `yaml:"secrets" toml:"secrets"`
+	Admin struct {
+		// Port for the admin listener; 0 disables it
+		Port  int    `env:"ADMIN_PORT" env-default:"0" yaml:"port" toml:"port"`
+		Host  string `env:"ADMIN_HOST" env-default:"127.0.0.1" yaml:"host" toml:"host"`
+		Token string `env:"ADMIN_TOKEN" yaml:"token" toml:"token"`
+		// Client IPs or CIDR ranges allowed to use the admin listener; empty allows all
+		AllowedCIDRs []string `env:"ADMIN_ALLOWED_CIDRS" env-separator:"," yaml:"allowed_cidrs" toml:"allowed_cidrs"`
+	} `yaml:"admin" toml:"admin"`
+	GRPC struct {
+		// Port for the gRPC listener serving the ProxyService and KeyService; 0 disables it
+		Port int `env:"GRPC_PORT" env-default:"0" yaml:"port" toml:"port"`
+	} `yaml:"grpc" toml:"grpc"`
+	Tokens struct {
+		// Estimate usage locally when the upstream response omits it
+		EstimationEnabled bool `env:"TOKEN_ESTIMATION_ENABLED" env-default:"true" yaml:"estimation_enabled" toml:"estimation_enabled"`
+		// Pre-flight limits on estimated prompt size and requested completion tokens; 0 disables
+		MaxPromptTokens        int            `env:"MAX_PROMPT_TOKENS" env-default:"0" yaml:"max_prompt_tokens" toml:"max_prompt_tokens"`
+		SessionMaxPromptTokens map[string]int `env:"SESSION_MAX_PROMPT_TOKENS" env-separator:"," yaml:"session_max_prompt_tokens" toml:"session_max_prompt_tokens"`
+		MaxCompletionTokens    int            `env:"MAX_COMPLETION_TOKENS" env-default:"0" yaml:"max_completion_tokens" toml:"max_completion_tokens"`
+		// "reject" or "truncate"
+		LimitPolicy string `env:"TOKEN_LIMIT_POLICY" env-default:"reject" yaml:"limit_policy" toml:"limit_policy"`
+		// Total token budgets keyed by session ID or tag, used for budget alerts and overdraft rules; 0 means unlimited
+		SessionBudgets map[string]int `env:"SESSION_TOKEN_BUDGETS" env-separator:"," yaml:"session_budgets" toml:"session_budgets"`
+		DefaultBudget  int            `env:"DEFAULT_SESSION_TOKEN_BUDGET" env-default:"0" yaml:"default_budget" toml:"default_budget"`
+		// Share of its budget a session must have used for its responses to
+		// carry a warning; 0 disables
+		BudgetWarningPercent int `env:"BUDGET_WARNING_PERCENT" env-default:"0" yaml:"budget_warning_percent" toml:"budget_warning_percent"`
+		// Also add the warning to the JSON body of chat completions
+		BudgetWarningBody bool `env:"BUDGET_WARNING_BODY" env-default:"false" yaml:"budget_warning_body" toml:"budget_warning_body"`
+		// Overdraft rules keyed by session tag, or "*" for the default, as
+		// tokens[:grace]; sessions with a rule are blocked past their overdraft
+		BudgetOverdrafts map[string]string `env:"BUDGET_OVERDRAFT" env-separator:"," yaml:"budget_overdrafts" toml:"budget_overdrafts"`
+	} `yaml:"tokens" toml:"tokens"`
+	RetryBudget struct {
+		// Share of the requests of the last minute that hedges and content
+		// filter fallbacks may add; 0 leaves them unlimited
+		Percent int `env:"RETRY_BUDGET_PERCENT" env-default:"0" yaml:"percent" toml:"percent"`
+		// Retries allowed per minute however few requests were sent
+		MinPerMinute int `env:"RETRY_BUDGET_MIN_PER_MINUTE" env-default:"10" yaml:"min_per_minute" toml:"min_per_minute"`
+	} `yaml:"retry_budget" toml:"retry_budget"`
+	Throttle struct {
+		// Request rates of sessions keyed by session tag ("*" for the default)
+		// as rpm[:burst[:max_delay]]; bursts borrow against the rate and are
+		// repaid by delaying later requests
+		Tiers map[string]string `env:"SESSION_THROTTLE_TIERS" env-separator:"," yaml:"tiers" toml:"tiers"`
+	} `yaml:"throttle" toml:"throttle"`
+	Policies struct {
+		// JSON object of parameter policies keyed by session tag ("*" for the default)
+		ParameterPolicies string `env:"PARAMETER_POLICIES" yaml:"parameter_policies" toml:"parameter_policies"`
+		// JSON object of system prompts and prefix messages injected into chat
+		// completions, keyed by session tag ("*" for the default)
+		SystemPrompts string `env:"SYSTEM_PROMPTS" yaml:"system_prompts" toml:"system_prompts"`
+		// JSON object of model capabilities (vision, tools, json_mode,
+		// context_window) keyed by model name or name prefix ending in "*"
+		ModelCapabilities string `env:"MODEL_CAPABILITIES" yaml:"model_capabilities" toml:"model_capabilities"`
+		// What happens to chat completions overflowing a model's context_window:
+		// reject, truncate (drop the oldest messages) or summarize them
+		ContextOverflow string `env:"CONTEXT_OVERFLOW_POLICY" env-default:"reject" yaml:"context_overflow" toml:"context_overflow"`
+		// Cheap model summarizing the dropped messages
+		SummaryModel string `env:"CONTEXT_SUMMARY_MODEL" env-default:"gpt-4o-mini" yaml:"summary_model" toml:"summary_model"`
+		// Tokens kept free for, and requested of, the summary
+		SummaryMaxTokens int `env:"CONTEXT_SUMMARY_MAX_TOKENS" env-default:"256" yaml:"summary_max_tokens" toml:"summary_max_tokens"`
+	} `yaml:"policies" toml:"policies"`
+	Redaction struct {
+		// Scrub sensitive data from prompts before they are forwarded
+		Enabled bool `env:"REDACTION_ENABLED" env-default:"false" yaml:"enabled" toml:"enabled"`
+		// Built-in patterns to apply: email, phone
+		Builtins []string `env:"REDACT_BUILTINS" env-separator:"," env-default:"email,phone" yaml:"builtins" toml:"builtins"`
+		// JSON object of additional patterns, rule name to regular expression
+		Patterns string `env:"REDACT_PATTERNS" yaml:"patterns" toml:"patterns"`
+		// Terms redacted as whole words, case-insensitively, under the rule "term"
+		Terms []string `env:"REDACT_TERMS" env-separator:"," yaml:"terms" toml:"terms"`
+	} `yaml:"redaction" toml:"redaction"`
+	Moderation struct {
+		// Check prompts with a moderation classifier before they are enqueued
+		Enabled bool `env:"MODERATION_ENABLED" env-default:"false" yaml:"enabled" toml:"enabled"`
+		// "openai" (any OpenAI-compatible moderations endpoint) or "keywords"
+		Provider string `env:"MODERATION_PROVIDER" env-default:"openai" yaml:"provider" toml:"provider"`
+		BaseURL  string `env:"MODERATION_BASE_URL" yaml:"base_url" toml:"base_url"`
+		APIKey   string `env:"MODERATION_API_KEY" yaml:"api_key" toml:"api_key"`
+		Model    string `env:"MODERATION_MODEL" env-default:"omni-moderation-latest" yaml:"model" toml:"model"`
+		// JSON object of category to terms for the keywords provider
+		Keywords string `env:"MODERATION_KEYWORDS" yaml:"keywords" toml:"keywords"`
+		// "block" rejects requests over a threshold, "flag" only records them
+		Action string `env:"MODERATION_ACTION" env-default:"block" yaml:"action" toml:"action"`
+		// Per-category score thresholds as category:score
+		Thresholds map[string]float64 `env:"MODERATION_THRESHOLDS" env-separator:"," yaml:"thresholds" toml:"thresholds"`
+		// Threshold for other categories; 0 uses the classifier's own flags
+		DefaultThreshold float64 `env:"MODERATION_THRESHOLD" env-default:"0" yaml:"default_threshold" toml:"default_threshold"`
+		// Reject requests when the classifier is unavailable instead of forwarding them
+		FailClosed bool          `env:"MODERATION_FAIL_CLOSED" env-default:"false" yaml:"fail_closed" toml:"fail_closed"`
+		Timeout    time.Duration `env:"MODERATION_TIMEOUT" env-default:"10s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"moderation" toml:"moderation"`
+	ContentFallback struct {
+		// Model the request is retried with when the upstream's content filter blocks it
+		Model string `env:"CONTENT_FALLBACK_MODEL" yaml:"model" toml:"model"`
+		// System prompt prepended to the messages of the retry
+		SystemPrompt string `env:"CONTENT_FALLBACK_SYSTEM_PROMPT" yaml:"system_prompt" toml:"system_prompt"`
+		// Error codes or types, and finish reasons, that trigger the retry
+		Codes []string `env:"CONTENT_FALLBACK_CODES" env-separator:"," env-default:"content_filter,content_policy_violation,refusal" yaml:"codes" toml:"codes"`
+	} `yaml:"content_fallback" toml:"content_fallback"`
+	UpstreamErrors struct {
+		// Rewrite upstream errors that are not in the OpenAI error envelope into it
+		Normalize bool `env:"UPSTREAM_ERRORS_NORMALIZE" env-default:"false" yaml:"normalize" toml:"normalize"`
+	} `yaml:"upstream_errors" toml:"upstream_errors"`
+	Hooks struct {
+		// External HTTP service that may rewrite or reject requests and responses
+		URL string `env:"TRANSFORM_HOOK_URL" yaml:"url" toml:"url"`
+		// Bearer token sent to the hook
+		Token string `env:"TRANSFORM_HOOK_TOKEN" yaml:"token" toml:"token"`
+		// Stages sent to the hook: request (before enqueueing), response (before returning)
+		Stages []string `env:"TRANSFORM_HOOK_STAGES" env-separator:"," env-default:"request,response" yaml:"stages" toml:"stages"`
+		// Reject requests when the hook is unavailable instead of passing them on unchanged
+		FailClosed bool          `env:"TRANSFORM_HOOK_FAIL_CLOSED" env-default:"false" yaml:"fail_closed" toml:"fail_closed"`
+		Timeout    time.Duration `env:"TRANSFORM_HOOK_TIMEOUT" env-default:"5s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"hooks" toml:"hooks"`
+	Authz struct {
+		// External HTTP service deciding whether each public request is served
+		URL string `env:"AUTHZ_URL" yaml:"url" toml:"url"`
+		// Bearer token sent to the service
+		Token string `env:"AUTHZ_TOKEN" yaml:"token" toml:"token"`
+		// Serve requests when the service is unavailable instead of rejecting them
+		FailOpen bool          `env:"AUTHZ_FAIL_OPEN" env-default:"false" yaml:"fail_open" toml:"fail_open"`
+		Timeout  time.Duration `env:"AUTHZ_TIMEOUT" env-default:"2s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"authz" toml:"authz"`
+	History struct {
+		// Record every request in the repository's request history
+		Enabled bool `env:"REQUEST_HISTORY_ENABLED" env-default:"false" yaml:"enabled" toml:"enabled"`
+		// Store request and response bodies with the records: full, preview or hash; empty disables
+		Capture string `env:"HISTORY_CAPTURE" yaml:"capture" toml:"capture"`
+		// Size cap of each captured body in full and preview mode
+		CaptureMaxBytes     int `env:"HISTORY_CAPTURE_MAX_BYTES" env-default:"65536" yaml:"capture_max_bytes" toml:"capture_max_bytes"`
+		CapturePreviewBytes int `env:"HISTORY_CAPTURE_PREVIEW_BYTES" env-default:"256" yaml:"capture_preview_bytes" toml:"capture_preview_bytes"`
+		// Tenants whose bodies are captured; empty captures every request
+		CaptureTenants []string `env:"HISTORY_CAPTURE_TENANTS" env-separator:"," yaml:"capture_tenants" toml:"capture_tenants"`
+		// JSON keys whose values are replaced with [REDACTED] in captured bodies
+		CaptureRedactFields []string `env:"HISTORY_CAPTURE_REDACT_FIELDS" env-separator:"," yaml:"capture_redact_fields" toml:"capture_redact_fields"`
+		// How long captured bodies are kept; 0 keeps them as long as their records
+		CaptureRetention time.Duration `env:"HISTORY_CAPTURE_RETENTION" env-default:"24h" yaml:"capture_retention" toml:"capture_retention"`
+	} `yaml:"history" toml:"history"`
+	Transcript struct {
+		// Let sessions opt into conversation capture
+		Enabled bool `env:"TRANSCRIPT_ENABLED" env-default:"false" yaml:"enabled" toml:"enabled"`
+		// Session tags whose sessions are captured without opting in through their metadata
+		SessionTags []string `env:"TRANSCRIPT_SESSION_TAGS" env-separator:"," yaml:"session_tags" toml:"session_tags"`
+		// JSON keys whose values are replaced with [REDACTED] in transcripts
+		RedactFields []string `env:"TRANSCRIPT_REDACT_FIELDS" env-separator:"," yaml:"redact_fields" toml:"redact_fields"`
+	} `yaml:"transcript" toml:"transcript"`
+	Chaos struct {
+		// Let the admin API inject faults into the requests of session tags and virtual keys
+		Enabled bool `env:"CHAOS_ENABLED" env-default:"false" yaml:"enabled" toml:"enabled"`
+	} `yaml:"chaos" toml:"chaos"`
+	Fixtures struct {
+		// record saves every upstream response as a fixture; replay answers from the fixtures without calling the upstream
+		Mode string `env:"FIXTURES_MODE" yaml:"mode" toml:"mode"`
+		// Directory holding one JSON file per fixture
+		Dir string `env:"FIXTURES_DIR" env-default:"fixtures" yaml:"dir" toml:"dir"`
+	} `yaml:"fixtures" toml:"fixtures"`
+	Retention struct {
+		// How long request records are kept; 0 keeps them forever
+		History time.Duration `env:"HISTORY_RETENTION" env-default:"0" yaml:"history" toml:"history"`
+		// How long completed and failed async jobs are kept; 0 keeps them forever
+		Jobs time.Duration `env:"JOB_RETENTION" env-default:"0" yaml:"jobs" toml:"jobs"`
+		// How long sessions are kept after their last request; 0 keeps them forever
+		Sessions time.Duration `env:"SESSION_RETENTION" env-default:"0" yaml:"sessions" toml:"sessions"`
+		// How often expired data is deleted
+		PruneInterval time.Duration `env:"PRUNE_INTERVAL" env-default:"1h" yaml:"prune_interval" toml:"prune_interval"`
+	} `yaml:"retention" toml:"retention"`
+	Queue struct {
+		// Queue implementation: memory; durable to re-dispatch async jobs left
+		// pending by a crash or restart (at-least-once); or jetstream to share
+		// the queues and their limits across replicas through NATS JetStream
+		Backend string `env:"QUEUE_BACKEND" env-default:"memory" yaml:"backend" toml:"backend"`
+		// Re-dispatch async jobs left pending by a crash or restart (at-least-once);
+		// requires a persistent repository. Same as QUEUE_BACKEND=durable.
+		Durable bool `env:"QUEUE_DURABLE" env-default:"false" yaml:"durable" toml:"durable"`
+		// Drop requests that waited longer than this with 504; 0 disables
+		MaxAge time.Duration `env:"QUEUE_MAX_AGE" env-default:"0" yaml:"max_age" toml:"max_age"`
+		// Named queues as name:rpm[:tpm[:workers]]; a queue named "default"
+		// replaces RATE_LIMIT_PER_MIN for unrouted requests
+		Named []string `env:"QUEUES" env-separator:"," yaml:"named" toml:"named"`
+		// Routing rules as pattern=queue[:max_streams]; patterns starting with
+		// "/" match path prefixes, others match the model (trailing "*" for a
+		// prefix) and may cap its concurrent streaming requests
+		Routes []string `env:"QUEUE_ROUTES" env-separator:"," yaml:"routes" toml:"routes"`
+		// Rate-limit windows as queue@days/HH:MM-HH:MM=rpm[:tpm], replacing a
+		// queue's limits while they are active
+		Schedules []string `env:"QUEUE_SCHEDULES" env-separator:"," yaml:"schedules" toml:"schedules"`
+		// Requests a session may have queued at once; 0 means unlimited
+		MaxPerSession int `env:"QUEUE_MAX_PER_SESSION" env-default:"0" yaml:"max_per_session" toml:"max_per_session"`
+		// Head start of interactive requests (streamed or with small prompts)
+		// over batch requests waiting in the same queue; 0 dispatches in order
+		PriorityBoost time.Duration `env:"QUEUE_PRIORITY_BOOST" env-default:"0" yaml:"priority_boost" toml:"priority_boost"`
+		// Largest estimated prompt, in tokens, of an interactive request
+		PrioritySmallTokens int `env:"QUEUE_PRIORITY_SMALL_TOKENS" env-default:"1000" yaml:"priority_small_tokens" toml:"priority_small_tokens"`
+		// Minutes of per-queue statistics kept for the admin history; 0 disables it
+		HistoryMinutes int `env:"QUEUE_HISTORY_MINUTES" env-default:"60" yaml:"history_minutes" toml:"history_minutes"`
+		// Time zone of the schedule windows, as an IANA name such as Europe/Berlin
+		ScheduleTimezone string `env:"QUEUE_SCHEDULE_TIMEZONE" env-default:"UTC" yaml:"schedule_timezone" toml:"schedule_timezone"`
+		// Sessions and virtual keys dispatched without waiting for the rate
+		// limits of their queue, e.g. health-check probes
+		ExemptSessions    []string `env:"QUEUE_EXEMPT_SESSIONS" env-separator:"," yaml:"exempt_sessions" toml:"exempt_sessions"`
+		ExemptVirtualKeys []string `env:"QUEUE_EXEMPT_VIRTUAL_KEYS" env-separator:"," yaml:"exempt_virtual_keys" toml:"exempt_virtual_keys"`
+	} `yaml:"queue" toml:"queue"`
+	NATS struct {
+		// Server of the jetstream queue backend, as nats://host:port or
+		// tls://host:port; credentials may be given in the URL
+		URL      string `env:"NATS_URL" yaml:"url" toml:"url"`
+		Token    string `env:"NATS_TOKEN" yaml:"token" toml:"token"`
+		User     string `env:"NATS_USER" yaml:"user" toml:"user"`
+		Password string `env:"NATS_PASSWORD" yaml:"password" toml:"password"`
+		// Work-queue stream requests are published to; created if missing
+		Stream string `env:"NATS_STREAM" env-default:"LLM_QUEUE" yaml:"stream" toml:"stream"`
+		// Prefix of the stream subjects: <subject>.requests.<queue>
+		Subject string `env:"NATS_SUBJECT" env-default:"llm-queue" yaml:"subject" toml:"subject"`
+		// A request a replica stops reporting progress on for this long is
+		// redelivered to another replica
+		AckWait time.Duration `env:"NATS_ACK_WAIT" env-default:"30s" yaml:"ack_wait" toml:"ack_wait"`
+		// How long a request waits for a replica to respond
+		ReplyTimeout time.Duration `env:"NATS_REPLY_TIMEOUT" env-default:"10m" yaml:"reply_timeout" toml:"reply_timeout"`
+	} `yaml:"nats" toml:"nats"`
+	Kafka struct {
+		// Base URL of a Kafka REST Proxy (v2 API); setting it consumes requests
+		// from InputTopic and writes their results to OutputTopic
+		RESTURL  string `env:"KAFKA_REST_URL" yaml:"rest_url" toml:"rest_url"`
+		Username string `env:"KAFKA_REST_USERNAME" yaml:"rest_username" toml:"rest_username"`
+		Password string `env:"KAFKA_REST_PASSWORD" yaml:"rest_password" toml:"rest_password"`
+		// Replicas in the same group share the partitions of the input topic
+		Group       string `env:"KAFKA_CONSUMER_GROUP" env-default:"llm-queue-proxy" yaml:"consumer_group" toml:"consumer_group"`
+		InputTopic  string `env:"KAFKA_INPUT_TOPIC" yaml:"input_topic" toml:"input_topic"`
+		OutputTopic string `env:"KAFKA_OUTPUT_TOPIC" yaml:"output_topic" toml:"output_topic"`
+		// Records of a poll processed at the same time
+		Concurrency int `env:"KAFKA_CONCURRENCY" env-default:"10" yaml:"concurrency" toml:"concurrency"`
+		// How long a poll waits for records
+		PollTimeout time.Duration `env:"KAFKA_POLL_TIMEOUT" env-default:"1s" yaml:"poll_timeout" toml:"poll_timeout"`
+	} `yaml:"kafka" toml:"kafka"`
+	Hedge struct {
+		// Send a duplicate request when the upstream hasn't answered within this; 0 disables
+		After time.Duration `env:"HEDGE_AFTER" env-default:"0" yaml:"after" toml:"after"`
+		// Target of the duplicate request; empty values reuse OPENAI_BASE_URL and OPENAI_API_KEY
+		BaseURL string `env:"HEDGE_BASE_URL" yaml:"base_url" toml:"base_url"`
+		APIKey  string `env:"HEDGE_API_KEY" yaml:"api_key" toml:"api_key"`
+		// Path prefixes eligible for hedging
+		Paths []string `env:"HEDGE_PATHS" env-separator:"," env-default:"/v1/chat/completions,/v1/completions,/v1/embeddings" yaml:"paths" toml:"paths"`
+	} `yaml:"hedge" toml:"hedge"`
+	Models struct {
+		// How long GET /v1/models serves the list merged across upstreams; 0 passes it through
+		CacheTTL time.Duration `env:"MODELS_CACHE_TTL" env-default:"5m" yaml:"cache_ttl" toml:"cache_ttl"`
+		// Timeout of the model list requests to each upstream
+		Timeout time.Duration `env:"MODELS_TIMEOUT" env-default:"10s" yaml:"timeout" toml:"timeout"`
+	} `yaml:"models" toml:"models"`
+	Probe struct {
+		// Probe the upstreams this often; 0 disables probing
+		Interval time.Duration `env:"UPSTREAM_PROBE_INTERVAL" env-default:"0" yaml:"interval" toml:"interval"`
+		// Cheap endpoint requested with GET
+		Path    string        `env:"UPSTREAM_PROBE_PATH" env-default:"/v1/models" yaml:"path" toml:"path"`
+		Timeout time.Duration `env:"UPSTREAM_PROBE_TIMEOUT" env-default:"5s" yaml:"timeout" toml:"timeout"`
+		// Consecutive failed probes after which an upstream is unreachable
+		Failures int `env:"UPSTREAM_PROBE_FAILURES" env-default:"2" yaml:"failures" toml:"failures"`
+	} `yaml:"probe" toml:"probe"`
+	Shadow struct {
+		// Percentage (0-100) of eligible requests mirrored to the shadow target; 0 disables
+		Percent float64 `env:"SHADOW_PERCENT" env-default:"0" yaml:"percent" toml:"percent"`
+		// Shadow target; empty values reuse OPENAI_BASE_URL and OPENAI_API_KEY
+		BaseURL string `env:"SHADOW_BASE_URL" yaml:"base_url" toml:"base_url"`
+		APIKey  string `env:"SHADOW_API_KEY" yaml:"api_key" toml:"api_key"`
+		// Model substituted in mirrored requests; empty keeps the original model
+		Model           string `env:"SHADOW_MODEL" yaml:"model" toml:"model"`
+		RateLimitPerMin int    `env:"SHADOW_RATE_LIMIT_PER_MIN" env-default:"60" yaml:"rate_limit_per_min" toml:"rate_limit_per_min"`
+		// Mirrored requests waiting longer than this are dropped
+		MaxAge time.Duration `env:"SHADOW_MAX_AGE" env-default:"1m" yaml:"max_age" toml:"max_age"`
+		// Store both responses for comparison instead of discarding the shadow response
+		StoreResults bool     `env:"SHADOW_STORE_RESULTS" env-default:"false" yaml:"store_results" toml:"store_results"`
+		Paths        []string `env:"SHADOW_PATHS" env-separator:"," env-default:"/v1/chat/completions,/v1/completions,/v1/responses" yaml:"paths" toml:"paths"`
+	} `yaml:"shadow" toml:"shadow"`
+	Experiments struct {
+		// Weighted model routing as model[@tag]=variant:weight|variant:weight
+		ModelSplits []string `env:"MODEL_SPLITS" env-separator:"," yaml:"model_splits" toml:"model_splits"`
+	} `yaml:"experiments" toml:"experiments"`
+	Cache struct {
+		// Serve repeated embedding requests from the repository
+		EmbeddingsEnabled bool `env:"EMBEDDING_CACHE_ENABLED" env-default:"false" yaml:"embeddings_enabled" toml:"embeddings_enabled"`
+		// Coalesce identical concurrent requests into a single upstream call
+		DedupEnabled bool `env:"DEDUP_ENABLED" env-default:"false" yaml:"dedup_enabled" toml:"dedup_enabled"`
+	} `yaml:"cache" toml:"cache"`
 	Repository struct {
-		Type      string `env:"REPOSITORY_TYPE" env-default:"memory"`
-		SQLiteDSN string `env:"SQLITE_DSN" env-default:"sessions.db"`
+		Type      string `env:"REPOSITORY_TYPE" env-default:"memory" yaml:"type" toml:"type"`
+		SQLiteDSN string `env:"SQLITE_DSN" env-default:"sessions.db" yaml:"sqlite_dsn" toml:"sqlite_dsn"`
+	} `yaml:"repository" toml:"repository"`
+	Affinity struct {
+		// Add a consistent-hash hint to session responses for pinning sessions
+		// to replicas at the load balancer
+		StickySessions bool   `env:"STICKY_SESSIONS" env-default:"false" yaml:"sticky_sessions" toml:"sticky_sessions"`
+		Header         string `env:"STICKY_HEADER" env-default:"X-Session-Affinity" yaml:"header" toml:"header"`
+		// Also set the hint in this cookie; empty sets no cookie
+		Cookie string `env:"STICKY_COOKIE" yaml:"cookie" toml:"cookie"`
+		// Replicas as name=url; the hint names the replica owning the session
+		Replicas []string `env:"REPLICAS" env-separator:"," yaml:"replicas" toml:"replicas"`
+		// Name of this instance among REPLICAS
+		Self string `env:"REPLICA_SELF" yaml:"self" toml:"self"`
+		// Proxy session requests to the replica owning the session; requires the
+		// memory repository
+		Forwarding bool `env:"REPLICA_FORWARDING" env-default:"false" yaml:"forwarding" toml:"forwarding"`
+		// Shared by the replicas to authenticate forwarded requests
+		Secret string `env:"REPLICA_SECRET" yaml:"secret" toml:"secret"`
+	} `yaml:"affinity" toml:"affinity"`
+	Coordination struct {
+		// Run background tasks only on the instance holding a lease in the shared
+		// repository; requires REPOSITORY_TYPE=sqlite
+		LeaderElection bool `env:"LEADER_ELECTION" env-default:"false" yaml:"leader_election" toml:"leader_election"`
+		// Name of this instance in the lease; empty uses hostname-pid
+		InstanceID string `env:"INSTANCE_ID" yaml:"instance_id" toml:"instance_id"`
+		// How long the lease outlives its holder
+		LeaseTTL time.Duration `env:"LEADER_LEASE_TTL" env-default:"30s" yaml:"lease_ttl" toml:"lease_ttl"`
+	} `yaml:"coordination" toml:"coordination"`
+}
+
+// ConfigFileEnv names the environment variable holding the path of an optional
+// config file read by NewConfig and GetConfig.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// NewConfigFromEnv reads the configuration from environment variables and validates it.
+func NewConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
+
+// NewConfigFromFile reads the configuration from a file, overrides it with
+// environment variables and validates it. YAML (.yaml, .yml), TOML (.toml)
+// and JSON files are supported; the format is chosen by extension.
+func NewConfigFromFile(path string) (*Config, error) {
+	cfg := &Config{}
+	if err := cleanenv.ReadConfig(path, cfg); err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// NewConfig reads the configuration from the file named by CONFIG_FILE, if set,
+// and the environment.
+func NewConfig() (*Config, error) {
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		return NewConfigFromFile(path)
+	}
+	return NewConfigFromEnv()
 }
 
 // Singleton: Config should only ever be created once.
@@ -31,26 +518,25 @@ var instance *Config
 // Once is an object that will perform exactly one action.
 var once sync.Once
 
-// GetConfig returns pointer to Config.
+// GetConfig returns a process-wide Config read from CONFIG_FILE, if set, and
+// the environment. It exits the process if the configuration is invalid.
+// Prefer NewConfigFromEnv or NewConfigFromFile where the error can be handled.
 func GetConfig() *Config {
 	// Calls the function if and only if Do is being called for the first time for this instance of Once
 	once.Do(func() {
 		log.Print("collecting config...")
 
-		// Config initialization
-		instance = &Config{}
-
-		// Read environment variables into the instance of the Config
-		if err := cleanenv.ReadEnv(instance); err != nil {
+		var err error
+		instance, err = NewConfig()
+		if err != nil {
 			// If something is wrong
 			helpText := "Environment variables error:"
 			// Returns a description of environment variables with a custom header - helpText
-			help, err := cleanenv.GetDescription(instance, &helpText)
-			if err != nil {
-				log.Fatal(err)
+			help, errHelp := cleanenv.GetDescription(&Config{}, &helpText)
+			if errHelp != nil {
+				log.Fatal(errHelp)
 			}
 			log.Print(help)
-			log.Printf("%+v\n", instance)
 
 			log.Fatal(err)
 		}
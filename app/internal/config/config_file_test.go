@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestNewConfigFromFile_YAML(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	path := writeConfigFile(t, "config.yaml", `
+openai:
+  api_key: file-key
+  rate_limit_overrides:
+    /v1/embeddings: 3000
+http:
+  port: 9090
+  read_timeout: 30s
+queue:
+  named: ["fast:600", "batch:60"]
+moderation:
+  thresholds:
+    violence: 0.5
+`)
+
+	cfg, err := config.NewConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config.NewConfigFromFile() error = %v", err)
+	}
+	if cfg.OpenAI.APIKey != "env-key" {
+		t.Errorf("APIKey = %q, want the environment to override the file", cfg.OpenAI.APIKey)
+	}
+	if cfg.HTTP.Port != 9090 || cfg.HTTP.ReadTimeout != 30*time.Second {
+		t.Errorf("HTTP = (%d, %v), want (9090, 30s)", cfg.HTTP.Port, cfg.HTTP.ReadTimeout)
+	}
+	if cfg.OpenAI.RateLimitOverrides["/v1/embeddings"] != 3000 {
+		t.Errorf("RateLimitOverrides = %v", cfg.OpenAI.RateLimitOverrides)
+	}
+	if !reflect.DeepEqual(cfg.Queue.Named, []string{"fast:600", "batch:60"}) {
+		t.Errorf("Queue.Named = %v", cfg.Queue.Named)
+	}
+	if cfg.Moderation.Thresholds["violence"] != 0.5 {
+		t.Errorf("Moderation.Thresholds = %v", cfg.Moderation.Thresholds)
+	}
+	// Fields missing from the file keep their defaults
+	if cfg.OpenAI.RateLimitPerMin != 60 || cfg.Repository.Type != "memory" {
+		t.Errorf("defaults = (%d, %q), want (60, memory)", cfg.OpenAI.RateLimitPerMin, cfg.Repository.Type)
+	}
+}
+
+func TestNewConfigFromFile_TOML(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[openai]
+api_key = "file-key"
+
+[repository]
+type = "sqlite"
+sqlite_dsn = "/data/proxy.db"
+`)
+
+	cfg, err := config.NewConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("config.NewConfigFromFile() error = %v", err)
+	}
+	if cfg.OpenAI.APIKey != "file-key" || cfg.Repository.Type != "sqlite" || cfg.Repository.SQLiteDSN != "/data/proxy.db" {
+		t.Errorf("config.NewConfigFromFile() = %+v, want values from the file", cfg)
+	}
+}
+
+func TestNewConfigFromFile_ValidationListsAllFields(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	path := writeConfigFile(t, "config.yaml", `
+queue:
+  backend: redis
+tokens:
+  limit_policy: drop
+pricing:
+  prices:
+    dall-e-3/images: 0.04
+hooks:
+  url: ftp://hooks.internal
+  stages: [request, body]
+shadow:
+  percent: 150
+`)
+
+	_, err := config.NewConfigFromFile(path)
+	var validationErr *entities.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("config.NewConfigFromFile() error = %v, want *entities.ValidationError", err)
+	}
+	var fields []string
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	want := []string{"openai.api_key", "queue.backend", "tokens.limit_policy", "pricing.prices", "hooks.url", "hooks.stages", "shadow.percent"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("invalid fields = %v, want %v", fields, want)
+	}
+}
+
+func TestNewConfigFromFile_Missing(t *testing.T) {
+	if _, err := config.NewConfigFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("config.NewConfigFromFile() error = nil, want an error for a missing file")
+	}
+}
+
+func TestNewConfigFromFile_SecretsProvider(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	path := writeConfigFile(t, "config.yaml", `
+secrets:
+  provider: vault
+  vault_addr: https://vault.internal:8200
+`)
+
+	_, err := config.NewConfigFromFile(path)
+	var validationErr *entities.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("config.NewConfigFromFile() error = %v, want *entities.ValidationError", err)
+	}
+	var fields []string
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	want := []string{"secrets.vault_token", "secrets.vault_path"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("invalid fields = %v, want %v", fields, want)
+	}
+}
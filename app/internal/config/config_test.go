@@ -32,3 +32,34 @@ func TestGetConfig_Singleton(t *testing.T) {
 	// This depends on the environment the test is run in.
 	// A more robust test would involve clearing relevant env vars.
 }
+
+func TestNewConfigFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	t.Setenv("PORT", "9090")
+
+	cfg1, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() error = %v", err)
+	}
+	if cfg1.OpenAI.APIKey != "env-key" || cfg1.HTTP.Port != 9090 {
+		t.Errorf("NewConfigFromEnv() = (%q, %d), want (env-key, 9090)", cfg1.OpenAI.APIKey, cfg1.HTTP.Port)
+	}
+
+	t.Setenv("PORT", "9091")
+	cfg2, err := config.NewConfigFromEnv()
+	if err != nil {
+		t.Fatalf("NewConfigFromEnv() error = %v", err)
+	}
+	if cfg2 == cfg1 || cfg2.HTTP.Port != 9091 || cfg1.HTTP.Port != 9090 {
+		t.Errorf("NewConfigFromEnv() ports = (%d, %d), want independent configs (9090, 9091)", cfg1.HTTP.Port, cfg2.HTTP.Port)
+	}
+}
+
+func TestNewConfigFromEnv_Invalid(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	t.Setenv("REPOSITORY_TYPE", "postgres")
+
+	if _, err := config.NewConfigFromEnv(); err == nil {
+		t.Error("NewConfigFromEnv() error = nil, want a validation error")
+	}
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Validate checks values that cannot be expressed with struct tags and
+// returns an *entities.ValidationError listing all offending fields, or nil.
+func (c *Config) Validate() error {
+	var errs []entities.FieldError
+	check := func(ok bool, field, env, format string, args ...any) {
+		if !ok {
+			errs = append(errs, entities.FieldError{Field: field, Env: env, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	check(c.OpenAI.APIKey != "" || c.OpenAI.APIKeyFile != "" || c.Secrets.Provider != "", "openai.api_key", "OPENAI_API_KEY", "is required unless OPENAI_API_KEY_FILE or SECRETS_PROVIDER is set")
+	check(c.OpenAI.RateLimitPerMin > 0, "openai.rate_limit_per_min", "RATE_LIMIT_PER_MIN", "must be positive, got %d", c.OpenAI.RateLimitPerMin)
+
+	check(validPort(c.HTTP.Port) && c.HTTP.Port != 0, "http.port", "PORT", "must be between 1 and 65535, got %d", c.HTTP.Port)
+	check(c.HTTP.MaxBodyBytes >= 0, "http.max_body_bytes", "MAX_BODY_BYTES", "must not be negative")
+	check(c.HTTP.MaxUploadBytes >= 0, "http.max_upload_bytes", "MAX_UPLOAD_BYTES", "must not be negative")
+	check(c.HTTP.SSEHeartbeatInterval >= 0, "http.sse_heartbeat_interval", "SSE_HEARTBEAT_INTERVAL", "must not be negative")
+	check(c.HTTP.StreamResponseBytes >= 0, "http.stream_responses_above", "STREAM_RESPONSES_ABOVE", "must not be negative")
+	check(c.HTTP.MaxDecodedBytes >= 0, "http.max_decoded_response_bytes", "MAX_DECODED_RESPONSE_BYTES", "must not be negative")
+	for _, list := range []struct {
+		field, env string
+		values     []string
+	}{
+		{"http.allowed_cidrs", "ALLOWED_CIDRS", c.HTTP.AllowedCIDRs},
+		{"http.denied_cidrs", "DENIED_CIDRS", c.HTTP.DeniedCIDRs},
+		{"http.trusted_proxy_cidrs", "TRUSTED_PROXY_CIDRS", c.HTTP.TrustedProxyCIDRs},
+		{"admin.allowed_cidrs", "ADMIN_ALLOWED_CIDRS", c.Admin.AllowedCIDRs},
+	} {
+		for _, value := range list.values {
+			check(validCIDR(value), list.field, list.env, "invalid IP address or CIDR %q", value)
+		}
+	}
+	check(c.HTTP.IPRateLimitPerMin >= 0, "http.ip_rate_limit_per_min", "IP_RATE_LIMIT_PER_MIN", "must not be negative")
+	check(c.HTTP.IPRateLimitBurst >= 0, "http.ip_rate_limit_burst", "IP_RATE_LIMIT_BURST", "must not be negative")
+
+	hasCertFiles := c.TLS.CertFile != "" || c.TLS.KeyFile != ""
+	check(!hasCertFiles || len(c.TLS.AutocertHosts) == 0, "tls.autocert_hosts", "TLS_AUTOCERT_HOSTS", "is mutually exclusive with certificate files")
+	check(!hasCertFiles || (c.TLS.CertFile != "" && c.TLS.KeyFile != ""), "tls.cert_file", "TLS_CERT_FILE", "must be set together with TLS_KEY_FILE")
+	check(c.TLS.ClientCAFile == "" || hasCertFiles || len(c.TLS.AutocertHosts) > 0, "tls.client_ca_file", "TLS_CLIENT_CA_FILE", "requires TLS_CERT_FILE or TLS_AUTOCERT_HOSTS")
+	check(oneOf(c.TLS.ClientAuth, "", "require", "optional"), "tls.client_auth", "TLS_CLIENT_AUTH", "must be require or optional, got %q", c.TLS.ClientAuth)
+	check((c.OpenAI.ClientCertFile == "") == (c.OpenAI.ClientKeyFile == ""), "openai.client_cert_file", "OPENAI_CLIENT_CERT_FILE", "must be set together with OPENAI_CLIENT_KEY_FILE")
+
+	check(c.Billing.StripeAPIKey == "" || c.Billing.ReportInterval > 0, "billing.report_interval", "STRIPE_REPORT_INTERVAL", "must be positive")
+	check(c.Billing.StripeAPIKey == "" || c.Billing.CustomerMetadataKey != "", "billing.customer_metadata_key", "STRIPE_CUSTOMER_METADATA_KEY", "is required when STRIPE_API_KEY is set")
+
+	check(oneOf(c.Tenants.Mode, "", "header", "key", "path"), "tenants.mode", "TENANT_MODE", "must be header, key or path, got %q", c.Tenants.Mode)
+	check(c.Tenants.Mode != "header" || c.Tenants.Header != "", "tenants.header", "TENANT_HEADER", "is required in header mode")
+	check(c.Tenants.SignatureMaxSkew >= 0, "tenants.signature_max_skew", "TENANT_SIGNATURE_MAX_SKEW", "must not be negative")
+	for _, name := range slices.Sorted(maps.Keys(c.Tenants.UpstreamRegions)) {
+		check(oneOf(name, "primary", "hedge", "shadow"), "tenants.upstream_regions", "UPSTREAM_REGIONS", "unknown upstream %q, want primary, hedge or shadow", name)
+	}
+
+	check(oneOf(c.Secrets.Provider, "", "vault", "aws"), "secrets.provider", "SECRETS_PROVIDER", "must be vault or aws, got %q", c.Secrets.Provider)
+	check(c.Secrets.RefreshInterval >= 0, "secrets.refresh_interval", "SECRETS_REFRESH_INTERVAL", "must not be negative")
+	switch c.Secrets.Provider {
+	case "vault":
+		check(c.Secrets.VaultAddr != "", "secrets.vault_addr", "VAULT_ADDR", "is required for the vault provider")
+		check(c.Secrets.VaultToken != "", "secrets.vault_token", "VAULT_TOKEN", "is required for the vault provider")
+		check(c.Secrets.VaultPath != "", "secrets.vault_path", "VAULT_SECRET_PATH", "is required for the vault provider")
+		check(c.Secrets.Field != "", "secrets.field", "SECRETS_FIELD", "is required for the vault provider")
+	case "aws":
+		check(c.Secrets.AWSRegion != "", "secrets.aws_region", "AWS_REGION", "is required for the aws provider")
+		check(c.Secrets.AWSSecretID != "", "secrets.aws_secret_id", "AWS_SECRET_ID", "is required for the aws provider")
+		check(c.Secrets.AWSAccessKeyID != "" && c.Secrets.AWSSecretAccessKey != "", "secrets.aws_access_key_id", "AWS_ACCESS_KEY_ID", "must be set together with AWS_SECRET_ACCESS_KEY for the aws provider")
+	}
+
+	check(validPort(c.Admin.Port), "admin.port", "ADMIN_PORT", "must be between 0 and 65535, got %d", c.Admin.Port)
+	check(c.Admin.Port == 0 || c.Admin.Port != c.HTTP.Port, "admin.port", "ADMIN_PORT", "must differ from PORT (%d)", c.HTTP.Port)
+	check(validPort(c.GRPC.Port), "grpc.port", "GRPC_PORT", "must be between 0 and 65535, got %d", c.GRPC.Port)
+	check(c.GRPC.Port == 0 || (c.GRPC.Port != c.HTTP.Port && c.GRPC.Port != c.Admin.Port), "grpc.port", "GRPC_PORT", "must differ from PORT (%d) and ADMIN_PORT (%d)", c.HTTP.Port, c.Admin.Port)
+
+	check(oneOf(c.Queue.Backend, "memory", "durable", "jetstream"), "queue.backend", "QUEUE_BACKEND", "must be memory, durable or jetstream, got %q", c.Queue.Backend)
+	check(c.Models.CacheTTL >= 0, "models.cache_ttl", "MODELS_CACHE_TTL", "must not be negative")
+	check(c.Models.Timeout > 0, "models.timeout", "MODELS_TIMEOUT", "must be positive")
+	check(c.Probe.Interval >= 0, "probe.interval", "UPSTREAM_PROBE_INTERVAL", "must not be negative")
+	if c.Probe.Interval > 0 {
+		check(strings.HasPrefix(c.Probe.Path, "/"), "probe.path", "UPSTREAM_PROBE_PATH", "must start with /, got %q", c.Probe.Path)
+		check(c.Probe.Timeout > 0, "probe.timeout", "UPSTREAM_PROBE_TIMEOUT", "must be positive")
+		check(c.Probe.Failures > 0, "probe.failures", "UPSTREAM_PROBE_FAILURES", "must be positive, got %d", c.Probe.Failures)
+	}
+	check(c.RetryBudget.Percent >= 0 && c.RetryBudget.Percent <= 100, "retry_budget.percent", "RETRY_BUDGET_PERCENT", "must be between 0 and 100, got %d", c.RetryBudget.Percent)
+	check(c.RetryBudget.MinPerMinute >= 0, "retry_budget.min_per_minute", "RETRY_BUDGET_MIN_PER_MINUTE", "must not be negative")
+	check(c.Queue.MaxPerSession >= 0, "queue.max_per_session", "QUEUE_MAX_PER_SESSION", "must not be negative")
+	check(c.Queue.HistoryMinutes >= 0, "queue.history_minutes", "QUEUE_HISTORY_MINUTES", "must not be negative")
+	check(c.Queue.PriorityBoost >= 0, "queue.priority_boost", "QUEUE_PRIORITY_BOOST", "must not be negative")
+	check(c.Queue.PrioritySmallTokens >= 0, "queue.priority_small_tokens", "QUEUE_PRIORITY_SMALL_TOKENS", "must not be negative")
+	_, err := time.LoadLocation(c.Queue.ScheduleTimezone)
+	check(err == nil, "queue.schedule_timezone", "QUEUE_SCHEDULE_TIMEZONE", "unknown time zone %q", c.Queue.ScheduleTimezone)
+	if c.Queue.Backend == "jetstream" {
+		natsURL, err := url.Parse(c.NATS.URL)
+		check(err == nil && (natsURL.Scheme == "nats" || natsURL.Scheme == "tls") && natsURL.Host != "", "nats.url", "NATS_URL", "must be a nats or tls URL for the jetstream backend, got %q", c.NATS.URL)
+		check(validSubjectToken(c.NATS.Stream), "nats.stream", "NATS_STREAM", "must be a name without spaces, dots or wildcards, got %q", c.NATS.Stream)
+		check(validSubject(c.NATS.Subject), "nats.subject", "NATS_SUBJECT", "must be a subject without wildcards, got %q", c.NATS.Subject)
+		check(c.NATS.AckWait > 0, "nats.ack_wait", "NATS_ACK_WAIT", "must be positive")
+		check(c.NATS.ReplyTimeout > 0, "nats.reply_timeout", "NATS_REPLY_TIMEOUT", "must be positive")
+	}
+
+	if c.Kafka.RESTURL != "" {
+		restURL, err := url.Parse(c.Kafka.RESTURL)
+		check(err == nil && (restURL.Scheme == "http" || restURL.Scheme == "https") && restURL.Host != "", "kafka.rest_url", "KAFKA_REST_URL", "must be an http or https URL, got %q", c.Kafka.RESTURL)
+		check(c.Kafka.Group != "", "kafka.consumer_group", "KAFKA_CONSUMER_GROUP", "is required when KAFKA_REST_URL is set")
+		check(c.Kafka.InputTopic != "", "kafka.input_topic", "KAFKA_INPUT_TOPIC", "is required when KAFKA_REST_URL is set")
+		check(c.Kafka.OutputTopic != "", "kafka.output_topic", "KAFKA_OUTPUT_TOPIC", "is required when KAFKA_REST_URL is set")
+		check(c.Kafka.OutputTopic != c.Kafka.InputTopic, "kafka.output_topic", "KAFKA_OUTPUT_TOPIC", "must differ from KAFKA_INPUT_TOPIC")
+		check(c.Kafka.Concurrency > 0, "kafka.concurrency", "KAFKA_CONCURRENCY", "must be positive")
+		check(c.Kafka.PollTimeout > 0, "kafka.poll_timeout", "KAFKA_POLL_TIMEOUT", "must be positive")
+	}
+
+	check(oneOf(c.Policies.ContextOverflow, "reject", "truncate", "summarize"), "policies.context_overflow", "CONTEXT_OVERFLOW_POLICY", "must be reject, truncate or summarize, got %q", c.Policies.ContextOverflow)
+	check(c.Policies.ContextOverflow != "summarize" || c.Policies.SummaryModel != "", "policies.summary_model", "CONTEXT_SUMMARY_MODEL", "must be set to summarize overflowing requests")
+	check(c.Policies.ContextOverflow != "summarize" || c.Policies.SummaryMaxTokens > 0, "policies.summary_max_tokens", "CONTEXT_SUMMARY_MAX_TOKENS", "must be positive, got %d", c.Policies.SummaryMaxTokens)
+	check(oneOf(c.Tokens.LimitPolicy, "reject", "truncate"), "tokens.limit_policy", "TOKEN_LIMIT_POLICY", "must be reject or truncate, got %q", c.Tokens.LimitPolicy)
+
+	check(c.Tokens.DefaultBudget >= 0, "tokens.default_budget", "DEFAULT_SESSION_TOKEN_BUDGET", "must not be negative")
+	check(c.Tokens.BudgetWarningPercent >= 0 && c.Tokens.BudgetWarningPercent <= 100, "tokens.budget_warning_percent", "BUDGET_WARNING_PERCENT", "must be between 0 and 100, got %d", c.Tokens.BudgetWarningPercent)
+
+	for _, threshold := range c.Alerts.BudgetThresholds {
+		check(threshold > 0, "alerts.budget_thresholds", "ALERT_BUDGET_THRESHOLDS", "must be positive percentages, got %d", threshold)
+	}
+	check(c.Alerts.ErrorRate >= 0 && c.Alerts.ErrorRate <= 100, "alerts.error_rate", "ALERT_ERROR_RATE", "must be between 0 and 100, got %g", c.Alerts.ErrorRate)
+	check(c.Alerts.ErrorRate == 0 || c.Alerts.ErrorRateWindow >= time.Second, "alerts.error_rate_window", "ALERT_ERROR_RATE_WINDOW", "must be at least 1s")
+	check(c.Alerts.QueueDepth >= 0, "alerts.queue_depth", "ALERT_QUEUE_DEPTH", "must not be negative")
+	check(c.Alerts.AnomalyInterval >= 0, "alerts.anomaly_interval", "ALERT_ANOMALY_INTERVAL", "must not be negative")
+	if c.Alerts.AnomalyInterval > 0 {
+		check(c.Alerts.AnomalyZScore > 0, "alerts.anomaly_z_score", "ALERT_ANOMALY_Z_SCORE", "must be positive, got %g", c.Alerts.AnomalyZScore)
+		check(c.Alerts.AnomalyMinTokens >= 0, "alerts.anomaly_min_tokens", "ALERT_ANOMALY_MIN_TOKENS", "must not be negative")
+		check(c.Alerts.AnomalyMinSamples >= 1, "alerts.anomaly_min_samples", "ALERT_ANOMALY_MIN_SAMPLES", "must be at least 1, got %d", c.Alerts.AnomalyMinSamples)
+		check(c.Alerts.AnomalyAlpha > 0 && c.Alerts.AnomalyAlpha <= 1, "alerts.anomaly_alpha", "ALERT_ANOMALY_ALPHA", "must be in (0, 1], got %g", c.Alerts.AnomalyAlpha)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Pricing.Prices)) {
+		unit := key[strings.LastIndex(key, "/")+1:]
+		check(oneOf(unit, "prompt_token", "completion_token", "image", "audio_second", "character", "trained_token"), "pricing.prices", "PRICING",
+			"unknown unit in %q, want prompt_token, completion_token, image, audio_second, character or trained_token", key)
+		check(c.Pricing.Prices[key] >= 0, "pricing.prices", "PRICING", "price of %q must not be negative", key)
+	}
+
+	check(c.FineTuning.PollInterval > 0, "fine_tuning.poll_interval", "FINE_TUNE_POLL_INTERVAL", "must be positive")
+
+	check(oneOf(c.Moderation.Provider, "openai", "keywords"), "moderation.provider", "MODERATION_PROVIDER", "must be openai or keywords, got %q", c.Moderation.Provider)
+	check(oneOf(c.Moderation.Action, "block", "flag"), "moderation.action", "MODERATION_ACTION", "must be block or flag, got %q", c.Moderation.Action)
+
+	if c.ContentFallback.Model != "" || c.ContentFallback.SystemPrompt != "" {
+		check(len(c.ContentFallback.Codes) > 0, "content_fallback.codes", "CONTENT_FALLBACK_CODES", "must not be empty")
+	}
+	if c.Hooks.URL != "" {
+		hookURL, err := url.Parse(c.Hooks.URL)
+		check(err == nil && (hookURL.Scheme == "http" || hookURL.Scheme == "https") && hookURL.Host != "", "hooks.url", "TRANSFORM_HOOK_URL", "must be an http or https URL, got %q", c.Hooks.URL)
+		for _, stage := range c.Hooks.Stages {
+			check(oneOf(stage, "request", "response"), "hooks.stages", "TRANSFORM_HOOK_STAGES", "must be request or response, got %q", stage)
+		}
+		check(c.Hooks.Timeout > 0, "hooks.timeout", "TRANSFORM_HOOK_TIMEOUT", "must be positive")
+	}
+	if c.Authz.URL != "" {
+		authzURL, err := url.Parse(c.Authz.URL)
+		check(err == nil && (authzURL.Scheme == "http" || authzURL.Scheme == "https") && authzURL.Host != "", "authz.url", "AUTHZ_URL", "must be an http or https URL, got %q", c.Authz.URL)
+		check(c.Authz.Timeout > 0, "authz.timeout", "AUTHZ_TIMEOUT", "must be positive")
+	}
+
+	check(c.Shadow.Percent >= 0 && c.Shadow.Percent <= 100, "shadow.percent", "SHADOW_PERCENT", "must be between 0 and 100, got %g", c.Shadow.Percent)
+
+	check(oneOf(c.History.Capture, "", "full", "preview", "hash"), "history.capture", "HISTORY_CAPTURE", "must be full, preview or hash, got %q", c.History.Capture)
+	check(c.History.Capture == "" || c.History.Enabled, "history.capture", "HISTORY_CAPTURE", "requires REQUEST_HISTORY_ENABLED")
+	check(c.History.CaptureMaxBytes >= 0, "history.capture_max_bytes", "HISTORY_CAPTURE_MAX_BYTES", "must not be negative")
+	check(c.History.CapturePreviewBytes >= 0, "history.capture_preview_bytes", "HISTORY_CAPTURE_PREVIEW_BYTES", "must not be negative")
+	check(c.History.CaptureRetention >= 0, "history.capture_retention", "HISTORY_CAPTURE_RETENTION", "must not be negative")
+	check(oneOf(c.Fixtures.Mode, "", "record", "replay"), "fixtures.mode", "FIXTURES_MODE", "must be record or replay, got %q", c.Fixtures.Mode)
+	check(c.Fixtures.Mode == "" || c.Fixtures.Dir != "", "fixtures.dir", "FIXTURES_DIR", "is required when FIXTURES_MODE is set")
+	check(c.Retention.History >= 0, "retention.history", "HISTORY_RETENTION", "must not be negative")
+	check(c.Retention.Jobs >= 0, "retention.jobs", "JOB_RETENTION", "must not be negative")
+	check(c.Retention.Sessions >= 0, "retention.sessions", "SESSION_RETENTION", "must not be negative")
+	check(c.Retention.PruneInterval > 0, "retention.prune_interval", "PRUNE_INTERVAL", "must be positive")
+
+	check(oneOf(c.Repository.Type, "memory", "sqlite"), "repository.type", "REPOSITORY_TYPE", "must be memory or sqlite, got %q", c.Repository.Type)
+	check(!c.Affinity.StickySessions || c.Affinity.Header != "", "affinity.header", "STICKY_HEADER", "must not be empty")
+	replicaNames := make([]string, 0, len(c.Affinity.Replicas))
+	for _, replica := range c.Affinity.Replicas {
+		name, _, _ := strings.Cut(strings.TrimSpace(replica), "=")
+		replicaNames = append(replicaNames, name)
+	}
+	check(c.Affinity.Self == "" || slices.Contains(replicaNames, c.Affinity.Self), "affinity.self", "REPLICA_SELF", "must name one of REPLICAS, got %q", c.Affinity.Self)
+	check(!c.Affinity.Forwarding || c.Affinity.Self != "", "affinity.forwarding", "REPLICA_FORWARDING", "requires REPLICAS and REPLICA_SELF")
+	check(!c.Affinity.Forwarding || c.Repository.Type == "memory", "affinity.forwarding", "REPLICA_FORWARDING", "requires REPOSITORY_TYPE=memory")
+	check(!c.Affinity.Forwarding || c.Affinity.Secret != "", "affinity.secret", "REPLICA_SECRET", "is required for REPLICA_FORWARDING")
+	check(!c.Coordination.LeaderElection || c.Repository.Type == "sqlite", "coordination.leader_election", "LEADER_ELECTION", "requires REPOSITORY_TYPE=sqlite")
+	check(c.Coordination.LeaseTTL >= time.Second, "coordination.lease_ttl", "LEADER_LEASE_TTL", "must be at least 1s")
+
+	if len(errs) > 0 {
+		return &entities.ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// validPort reports whether port is a TCP port number or 0
+func validPort(port int) bool {
+	return port >= 0 && port <= 65535
+}
+
+// validCIDR reports whether value is an IP address or CIDR range; empty
+// entries are ignored
+func validCIDR(value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return true
+	}
+	if strings.Contains(value, "/") {
+		_, err := netip.ParsePrefix(value)
+		return err == nil
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+// oneOf reports whether value is one of the allowed values
+// validSubjectToken reports whether s can be one token of a NATS subject
+func validSubjectToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \t\r\n.*>")
+}
+
+// validSubject reports whether s is a NATS subject without wildcards
+func validSubject(s string) bool {
+	for _, token := range strings.Split(s, ".") {
+		if !validSubjectToken(token) {
+			return false
+		}
+	}
+	return true
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
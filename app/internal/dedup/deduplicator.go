@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// call is an upstream request that identical requests are waiting on
+type call struct {
+	done chan struct{}
+	resp entities.ProxyResponse
+}
+
+// Deduplicator wraps a queue and coalesces byte-identical requests of a session
+// that are in flight at the same time into a single upstream call, fanning the
+// response out to every waiter.
+type Deduplicator struct {
+	next     Queue
+	inFlight map[string]*call
+	mu       sync.Mutex
+}
+
+// NewDeduplicator creates a new Deduplicator in front of the given queue
+func NewDeduplicator(next Queue) *Deduplicator {
+	return &Deduplicator{
+		next:     next,
+		inFlight: make(map[string]*call),
+	}
+}
+
+// Push forwards the request, or waits for an identical request already in flight.
+// Responses handed to waiters are marked as Cached since they cost no upstream call.
+func (d *Deduplicator) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.BodyStream != nil {
+		return d.next.Push(r)
+	}
+	key := requestKey(r)
+
+	d.mu.Lock()
+	if c, ok := d.inFlight[key]; ok {
+		d.mu.Unlock()
+		<-c.done
+		if c.resp.BodyStream != nil {
+			// A large response streamed to the first client cannot be read
+			// again, so the waiter sends its own request
+			return d.next.Push(r)
+		}
+		resp := c.resp
+		resp.Headers = resp.Headers.Clone()
+		resp.Cached = resp.Err == nil
+		return resp
+	}
+	c := &call{done: make(chan struct{})}
+	d.inFlight[key] = c
+	d.mu.Unlock()
+
+	c.resp = d.next.Push(r)
+
+	d.mu.Lock()
+	delete(d.inFlight, key)
+	d.mu.Unlock()
+	close(c.done)
+
+	return c.resp
+}
+
+// requestKey identifies requests that would produce the same upstream response.
+// Requests of different tenants or sessions are never merged: a waiter is not
+// charged for the response, and its session's budget and queue cap are only
+// checked for the request that is sent upstream.
+func requestKey(r entities.ProxyRequest) string {
+	h := sha256.New()
+	for _, part := range []string{r.TenantID, r.SessionID, r.Method, r.Path, r.Headers.Get("Accept-Encoding")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(r.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,143 @@
+package dedup_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/dedup"
+)
+
+type slowQueue struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (q *slowQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.calls.Add(1)
+	<-q.release
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: r.Body}
+}
+
+func TestDeduplicator_CoalescesIdenticalRequests(t *testing.T) {
+	q := &slowQueue{release: make(chan struct{})}
+	d := dedup.NewDeduplicator(q)
+
+	req := entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Headers: http.Header{}, Body: []byte(`{"a":1}`)}
+
+	const waiters = 5
+	var wg sync.WaitGroup
+	var cached atomic.Int32
+	responses := make([]entities.ProxyResponse, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = d.Push(req)
+			if responses[i].Cached {
+				cached.Add(1)
+			}
+		}(i)
+	}
+
+	// Give all goroutines time to join the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	close(q.release)
+	wg.Wait()
+
+	if q.calls.Load() != 1 {
+		t.Errorf("upstream calls = %d, want 1", q.calls.Load())
+	}
+	for i, resp := range responses {
+		if string(resp.Body) != `{"a":1}` {
+			t.Errorf("response %d body = %s", i, resp.Body)
+		}
+	}
+	if cached.Load() != waiters-1 {
+		t.Errorf("coalesced responses = %d, want %d", cached.Load(), waiters-1)
+	}
+}
+
+func TestDeduplicator_DifferentBodiesNotCoalesced(t *testing.T) {
+	q := &slowQueue{release: make(chan struct{})}
+	close(q.release)
+	d := dedup.NewDeduplicator(q)
+
+	d.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/x", Headers: http.Header{}, Body: []byte(`1`)})
+	d.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/x", Headers: http.Header{}, Body: []byte(`2`)})
+
+	if q.calls.Load() != 2 {
+		t.Errorf("upstream calls = %d, want 2", q.calls.Load())
+	}
+}
+
+func TestDeduplicator_SessionsNotCoalesced(t *testing.T) {
+	q := &slowQueue{release: make(chan struct{})}
+	d := dedup.NewDeduplicator(q)
+
+	var wg sync.WaitGroup
+	var cached atomic.Int32
+	for _, sessionID := range []string{"s1", "s2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := d.Push(entities.ProxyRequest{SessionID: sessionID, Method: http.MethodPost, Path: "/v1/chat/completions", Headers: http.Header{}, Body: []byte(`{"a":1}`)})
+			if resp.Cached {
+				cached.Add(1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(q.release)
+	wg.Wait()
+
+	// Each session pays for its own request and is checked against its own budget
+	if q.calls.Load() != 2 || cached.Load() != 0 {
+		t.Errorf("upstream calls = %d, coalesced = %d, want 2 and 0", q.calls.Load(), cached.Load())
+	}
+}
+
+type streamingQueue struct {
+	slowQueue
+}
+
+func (q *streamingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := q.slowQueue.Push(r)
+	if r.StreamResponseAbove > 0 {
+		resp.BodyStream = io.NopCloser(bytes.NewReader(resp.Body))
+		resp.Body = nil
+	}
+	return resp
+}
+
+func TestDeduplicator_StreamedResponses(t *testing.T) {
+	q := &streamingQueue{slowQueue{release: make(chan struct{})}}
+	d := dedup.NewDeduplicator(q)
+
+	req := entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/files/f1/content", Headers: http.Header{}, StreamResponseAbove: 1}
+	var wg sync.WaitGroup
+	var streamed atomic.Int32
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := d.Push(req)
+			if resp.BodyStream != nil {
+				streamed.Add(1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(q.release)
+	wg.Wait()
+
+	// Streaming stays on, and the waiter of a streamed response sends its own request
+	if q.calls.Load() != 2 || streamed.Load() != 2 {
+		t.Errorf("upstream calls = %d, streamed responses = %d, want 2 and 2", q.calls.Load(), streamed.Load())
+	}
+}
@@ -0,0 +1,211 @@
+package experiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type UsageParser interface {
+	ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error)
+}
+
+// VariantHeader reports which variant served an A/B routed request
+const VariantHeader = "X-Model-Variant"
+
+// Splitter wraps a queue and rewrites the model of matching requests to one of
+// several weighted variants. Sessions are assigned sticky variants by hashing
+// the session ID; requests without a session are assigned at random.
+type Splitter struct {
+	next   Queue
+	parser UsageParser
+	splits []entities.ModelSplit
+	usage  map[string]*entities.VariantUsage
+	mu     sync.Mutex
+}
+
+// NewSplitter creates a new Splitter in front of next. Tag-scoped splits take
+// precedence over untagged splits for the same model.
+func NewSplitter(next Queue, parser UsageParser, splits []entities.ModelSplit) *Splitter {
+	sorted := append([]entities.ModelSplit(nil), splits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Tag != "" && sorted[j].Tag == ""
+	})
+	return &Splitter{
+		next:   next,
+		parser: parser,
+		splits: sorted,
+		usage:  make(map[string]*entities.VariantUsage),
+	}
+}
+
+// Push routes the request to its variant and records the variant's usage
+func (s *Splitter) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.BodyStream != nil || len(r.Body) == 0 {
+		return s.next.Push(r)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(r.Body, &fields); err != nil {
+		return s.next.Push(r)
+	}
+	var model string
+	if err := json.Unmarshal(fields["model"], &model); err != nil || model == "" {
+		return s.next.Push(r)
+	}
+
+	split, ok := s.match(entities.SessionTag(r.SessionID), model)
+	if !ok {
+		return s.next.Push(r)
+	}
+	variant := assign(split, r.SessionID)
+	if variant != model {
+		encoded, err := json.Marshal(variant)
+		if err != nil {
+			return s.next.Push(r)
+		}
+		fields["model"] = encoded
+		body, err := json.Marshal(fields)
+		if err != nil {
+			return s.next.Push(r)
+		}
+		r.Body = body
+	}
+
+	// Variant usage is parsed from the body, so it has to be buffered
+	r.StreamResponseAbove = 0
+	resp := s.next.Push(r)
+	s.record(split, variant, resp)
+	if resp.Err == nil {
+		if resp.Headers == nil {
+			resp.Headers = make(http.Header)
+		}
+		resp.Headers.Set(VariantHeader, variant)
+	}
+	return resp
+}
+
+// Usage returns the traffic and token usage per variant
+func (s *Splitter) Usage() []entities.VariantUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]entities.VariantUsage, 0, len(s.usage))
+	for _, u := range s.usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tag != result[j].Tag {
+			return result[i].Tag < result[j].Tag
+		}
+		if result[i].Model != result[j].Model {
+			return result[i].Model < result[j].Model
+		}
+		return result[i].Variant < result[j].Variant
+	})
+	return result
+}
+
+// match returns the first split for the model that applies to the session tag
+func (s *Splitter) match(tag, model string) (entities.ModelSplit, bool) {
+	for _, split := range s.splits {
+		if split.Model == model && (split.Tag == "" || split.Tag == tag) {
+			return split, true
+		}
+	}
+	return entities.ModelSplit{}, false
+}
+
+// record adds a routed request and its reported token usage to the variant's totals
+func (s *Splitter) record(split entities.ModelSplit, variant string, resp entities.ProxyResponse) {
+	var usage *entities.TokenUsage
+	if resp.Err == nil && !resp.Cached && resp.StatusCode >= http.StatusOK && resp.StatusCode < 300 && s.parser != nil {
+		usage, _ = s.parser.ParseTokenUsageFromResponse(resp.DecodedBody())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := split.Tag + "/" + split.Model + "/" + variant
+	u, ok := s.usage[key]
+	if !ok {
+		u = &entities.VariantUsage{Tag: split.Tag, Model: split.Model, Variant: variant}
+		s.usage[key] = u
+	}
+	u.Requests++
+	if usage != nil {
+		u.PromptTokens += int64(usage.PromptTokens)
+		u.CompletionTokens += int64(usage.CompletionTokens)
+		u.TotalTokens += int64(usage.TotalTokens)
+	}
+}
+
+// assign picks a variant by weight. With a session ID the choice is derived
+// from a hash, so a session always gets the same variant.
+func assign(split entities.ModelSplit, sessionID string) string {
+	total := 0
+	for _, v := range split.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return split.Model
+	}
+
+	var point int
+	if sessionID != "" {
+		h := fnv.New64a()
+		h.Write([]byte(split.Tag + "/" + split.Model + "/" + sessionID))
+		point = int(h.Sum64() % uint64(total))
+	} else {
+		point = rand.IntN(total)
+	}
+	for _, v := range split.Variants {
+		if point < v.Weight {
+			return v.Model
+		}
+		point -= v.Weight
+	}
+	return split.Variants[len(split.Variants)-1].Model
+}
+
+// ParseSplits parses rules of the form model[@tag]=variant:weight|variant:weight
+func ParseSplits(specs []string) ([]entities.ModelSplit, error) {
+	splits := make([]entities.ModelSplit, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		target, variantSpecs, ok := strings.Cut(spec, "=")
+		if !ok || target == "" || variantSpecs == "" {
+			return nil, fmt.Errorf("invalid model split %q: expected model[@tag]=variant:weight|variant:weight", spec)
+		}
+
+		var split entities.ModelSplit
+		split.Model, split.Tag, _ = strings.Cut(target, "@")
+
+		for _, variantSpec := range strings.Split(variantSpecs, "|") {
+			idx := strings.LastIndex(variantSpec, ":")
+			if idx <= 0 {
+				return nil, fmt.Errorf("invalid variant %q in model split %q", variantSpec, spec)
+			}
+			weight, err := strconv.Atoi(variantSpec[idx+1:])
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight in variant %q of model split %q", variantSpec, spec)
+			}
+			split.Variants = append(split.Variants, entities.ModelVariant{Model: variantSpec[:idx], Weight: weight})
+		}
+		splits = append(splits, split)
+	}
+	return splits, nil
+}
@@ -0,0 +1,123 @@
+package experiment_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/experiment"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/session"
+)
+
+// modelQueue answers with the model it received and fixed token usage
+type modelQueue struct{}
+
+func (modelQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(r.Body, &req)
+	body := fmt.Sprintf(`{"model":%q,"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`, req.Model)
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(body)}
+}
+
+func newTestSplitter(t *testing.T, specs ...string) *experiment.Splitter {
+	t.Helper()
+	splits, err := experiment.ParseSplits(specs)
+	if err != nil {
+		t.Fatalf("ParseSplits() error = %v", err)
+	}
+	return experiment.NewSplitter(modelQueue{}, session.NewSessionManager(nil, nil), splits)
+}
+
+func push(s *experiment.Splitter, sessionID, model string) entities.ProxyResponse {
+	return s.Push(entities.ProxyRequest{
+		SessionID: sessionID,
+		Method:    http.MethodPost,
+		Path:      "/v1/chat/completions",
+		Body:      []byte(fmt.Sprintf(`{"model":%q,"messages":[]}`, model)),
+	})
+}
+
+func TestSplitter_StickyPerSession(t *testing.T) {
+	s := newTestSplitter(t, "gpt-4o=gpt-4o:50|gpt-4o-mini:50")
+
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		sessionID := fmt.Sprintf("user-%d", i)
+		first := push(s, sessionID, "gpt-4o").Headers.Get(experiment.VariantHeader)
+		for j := 0; j < 3; j++ {
+			if got := push(s, sessionID, "gpt-4o").Headers.Get(experiment.VariantHeader); got != first {
+				t.Fatalf("session %s moved from variant %s to %s", sessionID, first, got)
+			}
+		}
+		counts[first]++
+	}
+
+	if counts["gpt-4o"] < 60 || counts["gpt-4o-mini"] < 60 {
+		t.Errorf("variant assignment = %v, want roughly even split", counts)
+	}
+}
+
+func TestSplitter_TagScopedSplitWins(t *testing.T) {
+	s := newTestSplitter(t, "gpt-4o=gpt-4o:100", "gpt-4o@beta=gpt-4.1:100")
+
+	if got := push(s, "beta:user-1", "gpt-4o").Headers.Get(experiment.VariantHeader); got != "gpt-4.1" {
+		t.Errorf("tagged session variant = %s, want gpt-4.1", got)
+	}
+	if got := push(s, "user-1", "gpt-4o").Headers.Get(experiment.VariantHeader); got != "gpt-4o" {
+		t.Errorf("untagged session variant = %s, want gpt-4o", got)
+	}
+	if got := push(s, "user-1", "gpt-3.5-turbo").Headers.Get(experiment.VariantHeader); got != "" {
+		t.Errorf("unmatched model variant header = %q, want none", got)
+	}
+}
+
+func TestSplitter_RewritesModelAndRecordsUsage(t *testing.T) {
+	s := newTestSplitter(t, "gpt-4o=gpt-4o-mini:1")
+
+	resp := push(s, "", "gpt-4o")
+	if string(resp.Body) != `{"model":"gpt-4o-mini","usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}` {
+		t.Errorf("upstream received unexpected model: %s", resp.Body)
+	}
+	push(s, "", "gpt-4o")
+
+	want := []entities.VariantUsage{{
+		Model:            "gpt-4o",
+		Variant:          "gpt-4o-mini",
+		Requests:         2,
+		PromptTokens:     6,
+		CompletionTokens: 4,
+		TotalTokens:      10,
+	}}
+	if got := s.Usage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Usage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSplits(t *testing.T) {
+	got, err := experiment.ParseSplits([]string{"gpt-4o@beta=gpt-4o:90|ft:gpt-4o-mini:org:abc:10"})
+	if err != nil {
+		t.Fatalf("ParseSplits() error = %v", err)
+	}
+	want := []entities.ModelSplit{{
+		Tag:   "beta",
+		Model: "gpt-4o",
+		Variants: []entities.ModelVariant{
+			{Model: "gpt-4o", Weight: 90},
+			{Model: "ft:gpt-4o-mini:org:abc", Weight: 10},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSplits() = %+v, want %+v", got, want)
+	}
+
+	for _, spec := range []string{"gpt-4o", "=gpt-4o:1", "gpt-4o=gpt-4o", "gpt-4o=gpt-4o:x", "gpt-4o=gpt-4o:-1"} {
+		if _, err := experiment.ParseSplits([]string{spec}); err == nil {
+			t.Errorf("ParseSplits(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package fallback retries requests the upstream's content filter blocked
+// with a fallback model or a safety system prompt.
+package fallback
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// RetryBudget limits the retries the proxy makes
+type RetryBudget interface {
+	// Retry reports whether a retry is allowed, and counts it if so
+	Retry() bool
+}
+
+// ContentRetrier is a queue decorator that retries a request once when the
+// upstream blocks it with one of the configured content filter codes, or a
+// completion finishes with one of them. The client receives the response of
+// the retry, which carries what was changed in ProxyResponse.Fallback.
+type ContentRetrier struct {
+	next     Queue
+	settings entities.ContentFallbackSettings
+	budget   RetryBudget
+}
+
+// NewContentRetrier creates a new ContentRetrier in front of next
+func NewContentRetrier(next Queue, settings entities.ContentFallbackSettings) *ContentRetrier {
+	return &ContentRetrier{
+		next:     next,
+		settings: settings,
+	}
+}
+
+// WithRetryBudget skips the retries the budget does not allow, returning the
+// blocked response instead
+func (cr *ContentRetrier) WithRetryBudget(budget RetryBudget) *ContentRetrier {
+	cr.budget = budget
+	return cr
+}
+
+// Push forwards the request and retries it if its response was blocked
+func (cr *ContentRetrier) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := cr.next.Push(r)
+	// Streamed request bodies cannot be replayed, and streamed responses
+	// are already being read
+	if r.BodyStream != nil || resp.BodyStream != nil || resp.Err != nil {
+		return resp
+	}
+	reason := cr.blocked(resp)
+	if reason == "" {
+		return resp
+	}
+
+	fallback := &entities.ContentFallback{Reason: reason, StatusCode: resp.StatusCode}
+	body := r.Body
+	if cr.settings.Model != "" {
+		body = withModel(body, cr.settings.Model)
+		fallback.Model = cr.settings.Model
+	}
+	if cr.settings.SystemPrompt != "" {
+		if prompted, ok := withSystemPrompt(body, cr.settings.SystemPrompt); ok {
+			body = prompted
+			fallback.SystemPrompt = true
+		}
+	}
+	if fallback.Model == "" && !fallback.SystemPrompt {
+		// Nothing to change; the same request would be blocked again
+		return resp
+	}
+	if cr.budget != nil && !cr.budget.Retry() {
+		return resp
+	}
+
+	log.Printf("Retrying %s for session %s after the content filter blocked it (%s)", r.Path, r.SessionID, reason)
+	retry := r
+	retry.Body = body
+	retryResp := cr.next.Push(retry)
+	retryResp.Fallback = fallback
+	return retryResp
+}
+
+// blocked returns the configured code that blocked the response: the code or
+// type of an error, or the finish reason of a completion, which is
+// "content_filter" when a completion was cut, and "refusal" when the model
+// refused to answer. It returns an empty string for other responses.
+func (cr *ContentRetrier) blocked(resp entities.ProxyResponse) string {
+	body := resp.DecodedBody()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var payload struct {
+			Error struct {
+				Code json.RawMessage `json:"code"`
+				Type string          `json:"type"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &payload) != nil {
+			return ""
+		}
+		var code string
+		json.Unmarshal(payload.Error.Code, &code)
+		for _, candidate := range []string{code, payload.Error.Type} {
+			if candidate != "" && slices.Contains(cr.settings.Codes, candidate) {
+				return candidate
+			}
+		}
+		return ""
+	}
+
+	var completion struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Refusal *string `json:"refusal"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(body, &completion) != nil {
+		return ""
+	}
+	for _, choice := range completion.Choices {
+		reason := choice.FinishReason
+		if choice.Message.Refusal != nil && *choice.Message.Refusal != "" {
+			reason = "refusal"
+		}
+		if reason != "" && slices.Contains(cr.settings.Codes, reason) {
+			return reason
+		}
+	}
+	return ""
+}
+
+// withModel returns the body with its model field replaced. Bodies that are
+// not JSON objects are returned unchanged.
+func withModel(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return body
+	}
+	encodedModel, err := json.Marshal(model)
+	if err != nil {
+		return body
+	}
+	fields["model"] = encodedModel
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// withSystemPrompt returns the body with a system message holding prompt
+// before its messages. It reports false for bodies without messages.
+func withSystemPrompt(body []byte, prompt string) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body, false
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil || messages == nil {
+		return body, false
+	}
+	system, err := json.Marshal(map[string]string{"role": "system", "content": prompt})
+	if err != nil {
+		return body, false
+	}
+	encoded, err := json.Marshal(append([]json.RawMessage{system}, messages...))
+	if err != nil {
+		return body, false
+	}
+	fields["messages"] = encoded
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body, false
+	}
+	return rewritten, true
+}
@@ -0,0 +1,127 @@
+package fallback
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type scriptedQueue struct {
+	responses []entities.ProxyResponse
+	requests  []entities.ProxyRequest
+}
+
+func (q *scriptedQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.requests = append(q.requests, r)
+	resp := q.responses[0]
+	if len(q.responses) > 1 {
+		q.responses = q.responses[1:]
+	}
+	return resp
+}
+
+func TestContentRetrier(t *testing.T) {
+	codes := []string{"content_filter", "content_policy_violation", "refusal"}
+	blocked := entities.ProxyResponse{StatusCode: http.StatusBadRequest,
+		Body: []byte(`{"error":{"message":"filtered","type":"invalid_request_error","code":"content_filter"}}`)}
+	ok := entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"choices":[{"finish_reason":"stop","message":{"content":"hi"}}]}`)}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name         string
+		settings     entities.ContentFallbackSettings
+		first        entities.ProxyResponse
+		wantRequests int
+		wantFallback *entities.ContentFallback
+	}{
+		{"blocked error retried with model", entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: codes}, blocked, 2,
+			&entities.ContentFallback{Reason: "content_filter", StatusCode: http.StatusBadRequest, Model: "gpt-4o-mini"}},
+		{"filtered completion retried with prompt", entities.ContentFallbackSettings{SystemPrompt: "Be safe.", Codes: codes},
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"choices":[{"finish_reason":"content_filter"}]}`)}, 2,
+			&entities.ContentFallback{Reason: "content_filter", StatusCode: http.StatusOK, SystemPrompt: true}},
+		{"refusal", entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: codes},
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"choices":[{"finish_reason":"stop","message":{"refusal":"I can't help with that."}}]}`)}, 2,
+			&entities.ContentFallback{Reason: "refusal", StatusCode: http.StatusOK, Model: "gpt-4o-mini"}},
+		{"code not configured", entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: []string{"refusal"}}, blocked, 1, nil},
+		{"other error", entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: codes},
+			entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"error":{"code":"rate_limit_exceeded"}}`)}, 1, nil},
+		{"success", entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: codes}, ok, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &scriptedQueue{responses: []entities.ProxyResponse{tt.first, ok}}
+			resp := NewContentRetrier(next, tt.settings).Push(entities.ProxyRequest{Path: "/v1/chat/completions", Body: []byte(body)})
+
+			if len(next.requests) != tt.wantRequests {
+				t.Fatalf("sent %d requests, want %d", len(next.requests), tt.wantRequests)
+			}
+			if (resp.Fallback == nil) != (tt.wantFallback == nil) || (resp.Fallback != nil && *resp.Fallback != *tt.wantFallback) {
+				t.Errorf("Fallback = %+v, want %+v", resp.Fallback, tt.wantFallback)
+			}
+			if tt.wantFallback == nil {
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want the retry's response", resp.StatusCode)
+			}
+			var retried struct {
+				Model    string `json:"model"`
+				Messages []struct {
+					Role    string `json:"role"`
+					Content string `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(next.requests[1].Body, &retried); err != nil {
+				t.Fatalf("retry body %s: %v", next.requests[1].Body, err)
+			}
+			wantModel := "gpt-4o"
+			if tt.settings.Model != "" {
+				wantModel = tt.settings.Model
+			}
+			wantMessages := 1
+			if tt.settings.SystemPrompt != "" {
+				wantMessages = 2
+			}
+			if retried.Model != wantModel || len(retried.Messages) != wantMessages || retried.Messages[0].Role == "" {
+				t.Errorf("retry body = %s, want model %s and %d messages", next.requests[1].Body, wantModel, wantMessages)
+			}
+			if wantMessages == 2 && (retried.Messages[0].Role != "system" || retried.Messages[0].Content != "Be safe.") {
+				t.Errorf("retry messages = %+v, want the safety prompt first", retried.Messages)
+			}
+		})
+	}
+}
+
+func TestContentRetrier_NothingToChange(t *testing.T) {
+	// A prompt cannot be added to a body without messages, and the model is kept
+	next := &scriptedQueue{responses: []entities.ProxyResponse{{StatusCode: http.StatusBadRequest,
+		Body: []byte(`{"error":{"code":"content_policy_violation"}}`)}}}
+	retrier := NewContentRetrier(next, entities.ContentFallbackSettings{SystemPrompt: "Be safe.", Codes: []string{"content_policy_violation"}})
+	resp := retrier.Push(entities.ProxyRequest{Path: "/v1/images/generations", Body: []byte(`{"prompt":"a cat"}`)})
+	if len(next.requests) != 1 || resp.Fallback != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("sent %d requests, response %d with fallback %+v, want the blocked response without a retry", len(next.requests), resp.StatusCode, resp.Fallback)
+	}
+}
+
+type budget struct{ allowed bool }
+
+func (b budget) Retry() bool { return b.allowed }
+
+func TestContentRetrier_RetryBudget(t *testing.T) {
+	blocked := entities.ProxyResponse{StatusCode: http.StatusBadRequest, Body: []byte(`{"error":{"code":"content_filter"}}`)}
+	settings := entities.ContentFallbackSettings{Model: "gpt-4o-mini", Codes: []string{"content_filter"}}
+	for _, allowed := range []bool{true, false} {
+		next := &scriptedQueue{responses: []entities.ProxyResponse{blocked, {StatusCode: http.StatusOK}}}
+		resp := NewContentRetrier(next, settings).WithRetryBudget(budget{allowed}).
+			Push(entities.ProxyRequest{Path: "/v1/chat/completions", Body: []byte(`{"model":"gpt-4o"}`)})
+		want := 1
+		if allowed {
+			want = 2
+		}
+		if len(next.requests) != want || (resp.Fallback != nil) != allowed {
+			t.Errorf("budget allowing a retry %v: sent %d requests with fallback %+v, want %d", allowed, len(next.requests), resp.Fallback, want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package finetune counts the trained tokens of fine-tuning jobs against the
+// session that created them. Jobs run upstream for minutes to hours, so they
+// are polled in the background until they finish.
+package finetune
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	SaveFineTuneJob(job entities.FineTuneJob) error
+	ListPendingFineTuneJobs() ([]entities.FineTuneJob, error)
+}
+
+type SessionManager interface {
+	UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
+}
+
+// Pricer prices the usage of a request on a model
+type Pricer interface {
+	Cost(model string, usage entities.TokenUsage) float64
+}
+
+// finalStatuses are the job statuses in which trained tokens are final
+var finalStatuses = map[string]bool{
+	"succeeded": true,
+	"failed":    true,
+	"cancelled": true,
+}
+
+// Leader reports whether this instance polls on behalf of all replicas
+type Leader interface {
+	IsLeader() bool
+}
+
+// Tracker records the fine-tuning jobs created through sessions and polls
+// them through the proxy queue until they finish
+type Tracker struct {
+	store    Store
+	queue    Queue
+	sessions SessionManager
+	pricer   Pricer
+	interval time.Duration
+	now      func() time.Time
+	leader   Leader
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTracker creates a new Tracker polling pending jobs every interval
+func NewTracker(store Store, queue Queue, sessions SessionManager, pricer Pricer, interval time.Duration) *Tracker {
+	return &Tracker{
+		store:    store,
+		queue:    queue,
+		sessions: sessions,
+		pricer:   pricer,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// job holds the fields of an upstream fine-tuning job that are tracked
+type job struct {
+	ID            string `json:"id"`
+	Object        string `json:"object"`
+	Model         string `json:"model"`
+	Status        string `json:"status"`
+	TrainedTokens int    `json:"trained_tokens"`
+}
+
+// Track records the job in the response to a job creation request of a session
+func (t *Tracker) Track(sessionID string, responseBody []byte) error {
+	var created job
+	if err := json.Unmarshal(responseBody, &created); err != nil {
+		return fmt.Errorf("failed to decode fine-tuning job: %w", err)
+	}
+	if created.Object != "fine_tuning.job" || created.ID == "" {
+		return nil
+	}
+	return t.store.SaveFineTuneJob(entities.FineTuneJob{
+		ID:        created.ID,
+		SessionID: sessionID,
+		Model:     created.Model,
+		Status:    created.Status,
+		CreatedAt: t.now(),
+	})
+}
+
+// SetLeader limits background polling to the instance leader elects
+func (t *Tracker) SetLeader(leader Leader) {
+	t.leader = leader
+}
+
+// Start polls pending jobs in the background until Close is called
+func (t *Tracker) Start() {
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				if t.leader != nil && !t.leader.IsLeader() {
+					continue
+				}
+				finished, err := t.Poll()
+				if err != nil {
+					log.Printf("Error polling fine-tuning jobs: %v", err)
+				}
+				if finished > 0 {
+					log.Printf("Counted the trained tokens of %d finished fine-tuning jobs", finished)
+				}
+			}
+		}
+	}()
+}
+
+// Poll fetches the status of each pending job and counts the trained tokens of
+// jobs that finished against their session. It returns the number of jobs that
+// finished. A job that cannot be fetched is retried on the next poll.
+func (t *Tracker) Poll() (int, error) {
+	pending, err := t.store.ListPendingFineTuneJobs()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list fine-tuning jobs: %w", err)
+	}
+
+	finished := 0
+	var firstErr error
+	for _, tracked := range pending {
+		done, err := t.poll(tracked)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("job %s: %w", tracked.ID, err)
+			}
+			continue
+		}
+		if done {
+			finished++
+		}
+	}
+	return finished, firstErr
+}
+
+// poll fetches a job and reports whether it finished
+func (t *Tracker) poll(tracked entities.FineTuneJob) (bool, error) {
+	tenantID, _ := entities.SplitTenantSessionID(tracked.SessionID)
+	resp := t.queue.Push(entities.ProxyRequest{
+		SessionID: tracked.SessionID,
+		TenantID:  tenantID,
+		Method:    http.MethodGet,
+		Path:      "/v1/fine_tuning/jobs/" + tracked.ID,
+	})
+	if resp.Err != nil {
+		return false, resp.Err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	var current job
+	if err := json.Unmarshal(resp.Body, &current); err != nil {
+		return false, fmt.Errorf("failed to decode fine-tuning job: %w", err)
+	}
+	if !finalStatuses[current.Status] {
+		if current.Status != tracked.Status {
+			tracked.Status = current.Status
+			return false, t.store.SaveFineTuneJob(tracked)
+		}
+		return false, nil
+	}
+
+	// The job is marked finished before its tokens are counted, so a failure
+	// in between cannot count them twice
+	now := t.now()
+	tracked.Status = current.Status
+	tracked.TrainedTokens = current.TrainedTokens
+	tracked.FinishedAt = &now
+	if err := t.store.SaveFineTuneJob(tracked); err != nil {
+		return false, err
+	}
+	usage := entities.TokenUsage{TrainedTokens: current.TrainedTokens}
+	if t.pricer != nil {
+		usage.Cost = t.pricer.Cost(tracked.Model, usage)
+	}
+	if _, err := t.sessions.UpdateSessionTokens(tracked.SessionID, usage); err != nil {
+		return true, fmt.Errorf("failed to count trained tokens against session %s: %w", tracked.SessionID, err)
+	}
+	log.Printf("Fine-tuning job %s %s after training on %d tokens, counted against session %s",
+		tracked.ID, current.Status, current.TrainedTokens, tracked.SessionID)
+	return true, nil
+}
+
+// Close stops background polling
+func (t *Tracker) Close() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.stop = nil
+}
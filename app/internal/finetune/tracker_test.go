@@ -0,0 +1,66 @@
+package finetune
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/pricing"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+type fakeQueue struct {
+	statuses map[string]string
+	pushed   []entities.ProxyRequest
+}
+
+func (f *fakeQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	f.pushed = append(f.pushed, r)
+	status := f.statuses[r.Path]
+	body := `{"id":"ftjob-1","object":"fine_tuning.job","model":"gpt-4o-mini-2024-07-18","status":"` + status + `","trained_tokens":null}`
+	if status == "succeeded" {
+		body = `{"id":"ftjob-1","object":"fine_tuning.job","model":"gpt-4o-mini-2024-07-18","status":"succeeded","trained_tokens":10000}`
+	}
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(body)}
+}
+
+func TestTracker_CountsTrainedTokensOnce(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	queue := &fakeQueue{statuses: map[string]string{"/v1/fine_tuning/jobs/ftjob-1": "running"}}
+	table := pricing.NewTable(map[string]float64{"gpt-4o-mini-2024-07-18/trained_token": 0.000003})
+	tracker := NewTracker(repo, queue, repo, table, 0)
+
+	if err := tracker.Track("acme/trainer", []byte(`{"id":"ftjob-1","object":"fine_tuning.job","model":"gpt-4o-mini-2024-07-18","status":"validating_files"}`)); err != nil {
+		t.Fatalf("Track() error = %v", err)
+	}
+	// Other responses, e.g. job lists, are not tracked
+	if err := tracker.Track("acme/trainer", []byte(`{"object":"list","data":[]}`)); err != nil {
+		t.Fatalf("Track() of a list error = %v", err)
+	}
+
+	if finished, err := tracker.Poll(); err != nil || finished != 0 {
+		t.Fatalf("Poll() of a running job = %d, %v, want 0", finished, err)
+	}
+	if len(queue.pushed) != 1 || queue.pushed[0].Method != http.MethodGet || queue.pushed[0].TenantID != "acme" {
+		t.Errorf("pushed %+v, want a GET of the job for tenant acme", queue.pushed)
+	}
+	if _, err := repo.GetSession("acme/trainer"); err == nil {
+		t.Error("session updated before the job finished")
+	}
+
+	queue.statuses["/v1/fine_tuning/jobs/ftjob-1"] = "succeeded"
+	if finished, err := tracker.Poll(); err != nil || finished != 1 {
+		t.Fatalf("Poll() of a succeeded job = %d, %v, want 1", finished, err)
+	}
+	if finished, err := tracker.Poll(); err != nil || finished != 0 || len(queue.pushed) != 2 {
+		t.Errorf("Poll() after the job finished = %d, %v with %d requests, want no more requests", finished, err, len(queue.pushed))
+	}
+
+	sess, err := repo.GetSession("acme/trainer")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.TotalTrainedTokens != 10000 || sess.TotalCost < 0.0299 || sess.TotalCost > 0.0301 {
+		t.Errorf("session = %+v, want 10000 trained tokens costing 0.03", sess)
+	}
+}
@@ -0,0 +1,167 @@
+// Package fixture records upstream responses and serves them back, so teams
+// depending on the proxy can run deterministic integration tests: a run in
+// record mode stores the response of every request as a fixture keyed by the
+// request, and a run in replay mode answers from the fixtures without calling
+// the upstream.
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	LoadFixture(key string) (*entities.Fixture, error)
+	SaveFixture(fixture entities.Fixture) error
+}
+
+// Response headers that describe the recorded transfer rather than the
+// response, and are not replayed
+var transferHeaders = []string{"Content-Encoding", "Content-Length", "Date"}
+
+// Recorder is a queue decorator that saves the response of every request it
+// forwards as the fixture of the request
+type Recorder struct {
+	next  Queue
+	store Store
+	now   func() time.Time
+}
+
+// NewRecorder creates a new Recorder with injected dependencies
+func NewRecorder(next Queue, store Store) *Recorder {
+	return &Recorder{
+		next:  next,
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Push forwards the request and records its response. Streamed uploads cannot
+// be keyed and are forwarded without recording.
+func (rec *Recorder) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.BodyStream != nil {
+		return rec.next.Push(r)
+	}
+	// The whole response body is needed for the fixture
+	r.StreamResponseAbove = 0
+	resp := rec.next.Push(r)
+	if resp.Err != nil || resp.BodyStream != nil {
+		return resp
+	}
+
+	fixture := entities.Fixture{
+		Key:        Key(r),
+		Method:     r.Method,
+		Path:       r.Path,
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Headers.Clone(),
+		RecordedAt: rec.now(),
+	}
+	if utf8.Valid(r.Body) {
+		fixture.Request = string(r.Body)
+	}
+	// Bodies are stored decompressed so fixtures can be read and edited
+	for _, name := range transferHeaders {
+		fixture.Headers.Del(name)
+	}
+	if body := resp.DecodedBody(); utf8.Valid(body) {
+		fixture.Body = string(body)
+	} else {
+		fixture.BinaryBody = body
+	}
+	if err := rec.store.SaveFixture(fixture); err != nil {
+		log.Printf("Error recording fixture of %s %s: %v", r.Method, r.Path, err)
+	}
+	return resp
+}
+
+// Player is a queue that answers every request with its recorded fixture and
+// never calls the upstream. Requests without a fixture are answered with 404.
+type Player struct {
+	store Store
+}
+
+// NewPlayer creates a new Player with injected dependencies
+func NewPlayer(store Store) *Player {
+	return &Player{
+		store: store,
+	}
+}
+
+// Push answers the request with its fixture
+func (p *Player) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.BodyStream != nil {
+		return notRecorded("Streamed uploads cannot be replayed from fixtures")
+	}
+	fixture, err := p.store.LoadFixture(Key(r))
+	if errors.Is(err, entities.ErrFixtureNotFound) {
+		return notRecorded("No fixture was recorded for " + r.Method + " " + r.Path + " with this body")
+	}
+	if err != nil {
+		return entities.ProxyResponse{Err: err}
+	}
+	body := fixture.BinaryBody
+	if body == nil {
+		body = []byte(fixture.Body)
+	}
+	headers := fixture.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	return entities.ProxyResponse{
+		StatusCode: fixture.StatusCode,
+		Headers:    headers,
+		Body:       body,
+	}
+}
+
+// notRecorded returns the error response to requests without a fixture
+func notRecorded(message string) entities.ProxyResponse {
+	body, _ := json.Marshal(entities.NewErrorResponse(message, "invalid_request_error", "fixture_not_found"))
+	return entities.ProxyResponse{
+		StatusCode: http.StatusNotFound,
+		Headers:    http.Header{"Content-Type": {"application/json"}},
+		Body:       body,
+	}
+}
+
+// Key identifies a request by its method, path and body. JSON bodies are
+// compared by their content, so key order and whitespace do not matter.
+func Key(r entities.ProxyRequest) string {
+	h := sha256.New()
+	for _, part := range []string{r.Method, r.Path} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(canonical(r.Body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// canonical returns a JSON body re-encoded with sorted keys and no
+// whitespace; other bodies are returned as is
+func canonical(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return body
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return encoded
+}
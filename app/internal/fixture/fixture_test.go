@@ -0,0 +1,126 @@
+package fixture_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/fixture"
+)
+
+type countingQueue struct {
+	resp  entities.ProxyResponse
+	calls int
+}
+
+func (q *countingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.calls++
+	return q.resp
+}
+
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(body))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestKey(t *testing.T) {
+	chat := func(body string) entities.ProxyRequest {
+		return entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(body)}
+	}
+	key := fixture.Key(chat(`{"model":"gpt-4o","temperature":0.0,"messages":[]}`))
+	if got := fixture.Key(chat(`{ "messages": [], "temperature": 0.0, "model": "gpt-4o" }`)); got != key {
+		t.Errorf("Key() differs for the same JSON with other key order and whitespace")
+	}
+	for _, other := range []entities.ProxyRequest{
+		chat(`{"model":"gpt-4o","temperature":0,"messages":[]}`),
+		chat(`{"model":"gpt-4o-mini","temperature":0.0,"messages":[]}`),
+		{Method: http.MethodPost, Path: "/v1/completions", Body: []byte(`{"model":"gpt-4o","temperature":0.0,"messages":[]}`)},
+	} {
+		if fixture.Key(other) == key {
+			t.Errorf("Key(%s %s) matches another request", other.Path, other.Body)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	store := fixture.NewDirStore(dir)
+	upstream := &countingQueue{resp: entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers: http.Header{
+			"Content-Type":     {"application/json"},
+			"Content-Encoding": {"gzip"},
+			"X-Request-Id":     {"req_1"},
+		},
+		Body: gzipped(t, `{"id":"chatcmpl-1","choices":[]}`),
+	}}
+	recorder := fixture.NewRecorder(upstream, store)
+	request := entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions",
+		Body: []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`), StreamResponseAbove: 1024}
+	if resp := recorder.Push(request); resp.StatusCode != http.StatusOK || upstream.calls != 1 {
+		t.Fatalf("Push() = %d after %d calls, want the upstream response", resp.StatusCode, upstream.calls)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, fixture.Key(request)+".json"))
+	if err != nil {
+		t.Fatalf("fixture file not written: %v", err)
+	}
+	var saved entities.Fixture
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("fixture file is not JSON: %v", err)
+	}
+	if saved.Body != `{"id":"chatcmpl-1","choices":[]}` || saved.Request != string(request.Body) ||
+		saved.Headers.Get("Content-Encoding") != "" || saved.RecordedAt.IsZero() {
+		t.Errorf("saved fixture = %+v, want the decompressed body and request", saved)
+	}
+
+	player := fixture.NewPlayer(store)
+	replayed := request
+	replayed.Body = []byte(`{"messages":[{"content":"Hi","role":"user"}],"model":"gpt-4o"}`)
+	resp := player.Push(replayed)
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != saved.Body ||
+		resp.Headers.Get("X-Request-Id") != "req_1" || resp.Headers.Get("Content-Encoding") != "" {
+		t.Errorf("replayed response = %d %v %s, want the fixture", resp.StatusCode, resp.Headers, resp.Body)
+	}
+
+	missing := player.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{"model":"gpt-4o"}`)})
+	if missing.StatusCode != http.StatusNotFound || !strings.Contains(string(missing.Body), "fixture_not_found") {
+		t.Errorf("response without a fixture = %d %s, want 404 fixture_not_found", missing.StatusCode, missing.Body)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("upstream called %d times, want only while recording", upstream.calls)
+	}
+}
+
+func TestRecorder_BinaryAndFailed(t *testing.T) {
+	store := fixture.NewDirStore(t.TempDir())
+	speech := entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/audio/speech", Body: []byte(`{"input":"Hi"}`)}
+	audio := []byte{0xff, 0xf3, 0x00, 0x80}
+	fixture.NewRecorder(&countingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK, Body: audio}}, store).Push(speech)
+
+	saved, err := store.LoadFixture(fixture.Key(speech))
+	if err != nil || saved.Body != "" || !bytes.Equal(saved.BinaryBody, audio) {
+		t.Fatalf("LoadFixture() = %+v, %v, want the binary body", saved, err)
+	}
+	if resp := fixture.NewPlayer(store).Push(speech); !bytes.Equal(resp.Body, audio) {
+		t.Errorf("replayed body = %v, want %v", resp.Body, audio)
+	}
+
+	failed := entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/embeddings", Body: []byte(`{"input":"x"}`)}
+	fixture.NewRecorder(&countingQueue{resp: entities.ProxyResponse{Err: entities.ErrQueueFull}}, store).Push(failed)
+	if _, err := store.LoadFixture(fixture.Key(failed)); err != entities.ErrFixtureNotFound {
+		t.Errorf("LoadFixture() of a failed request error = %v, want ErrFixtureNotFound", err)
+	}
+}
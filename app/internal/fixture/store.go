@@ -0,0 +1,74 @@
+package fixture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// DirStore keeps each fixture in a JSON file of a directory, named after its
+// key, so fixtures can be reviewed and committed with the tests using them
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a new DirStore of the directory
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{
+		dir: dir,
+	}
+}
+
+// LoadFixture returns the fixture recorded under the key, or entities.ErrFixtureNotFound
+func (s *DirStore) LoadFixture(key string) (*entities.Fixture, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, entities.ErrFixtureNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var fixture entities.Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture %s: %w", key, err)
+	}
+	return &fixture, nil
+}
+
+// SaveFixture writes the fixture, replacing the one recorded under its key.
+// The file is renamed into place, so concurrent readers never see a partial one.
+func (s *DirStore) SaveFixture(fixture entities.Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, fixture.Key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create fixture file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(fixture.Key)); err != nil {
+		return fmt.Errorf("failed to save fixture: %w", err)
+	}
+	return nil
+}
+
+// path returns the file of the fixture recorded under the key
+func (s *DirStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
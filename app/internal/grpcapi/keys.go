@@ -0,0 +1,148 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	llmqueueproxyv1 "github.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// KeyService issues and revokes the virtual keys of tenants
+type KeyService interface {
+	GetTenant(id string) (*entities.Tenant, error)
+	IssueKey(tenantID string, req entities.VirtualKeyRequest) (*entities.IssuedKey, error)
+	ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error)
+	DeleteVirtualKey(tenantID, id string) error
+}
+
+// KeyServer serves KeyService. Like the /tenants routes of the admin API, it
+// requires the admin token as a bearer token in the authorization metadata.
+type KeyServer struct {
+	llmqueueproxyv1.UnimplementedKeyServiceServer
+	keys  KeyService
+	token string
+}
+
+// NewKeyServer creates a new KeyServer protected by the given token. An empty
+// token disables authentication.
+func NewKeyServer(keys KeyService, token string) *KeyServer {
+	return &KeyServer{
+		keys:  keys,
+		token: token,
+	}
+}
+
+// IssueKey creates a virtual key for a tenant and returns its plaintext,
+// which is not available afterwards
+func (ks *KeyServer) IssueKey(ctx context.Context, req *llmqueueproxyv1.IssueKeyRequest) (*llmqueueproxyv1.IssuedKey, error) {
+	if err := ks.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	if err := ks.checkTenant(req.GetTenantId()); err != nil {
+		return nil, err
+	}
+	issued, err := ks.keys.IssueKey(req.GetTenantId(), entities.VirtualKeyRequest{
+		Name:    req.GetName(),
+		Signing: req.GetSigning(),
+	})
+	if err != nil {
+		return nil, keyError("issuing key for tenant "+req.GetTenantId(), err)
+	}
+	return &llmqueueproxyv1.IssuedKey{
+		Key:           keyMessage(issued.VirtualKey),
+		PlaintextKey:  issued.Key,
+		SigningSecret: issued.SigningSecret,
+	}, nil
+}
+
+// ListKeys returns a tenant's virtual keys, without their plaintext
+func (ks *KeyServer) ListKeys(ctx context.Context, req *llmqueueproxyv1.ListKeysRequest) (*llmqueueproxyv1.ListKeysResponse, error) {
+	if err := ks.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	if err := ks.checkTenant(req.GetTenantId()); err != nil {
+		return nil, err
+	}
+	keys, err := ks.keys.ListVirtualKeys(req.GetTenantId())
+	if err != nil {
+		return nil, keyError("listing keys of tenant "+req.GetTenantId(), err)
+	}
+	resp := &llmqueueproxyv1.ListKeysResponse{}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, keyMessage(key))
+	}
+	return resp, nil
+}
+
+// DeleteKey revokes a tenant's virtual key
+func (ks *KeyServer) DeleteKey(ctx context.Context, req *llmqueueproxyv1.DeleteKeyRequest) (*llmqueueproxyv1.DeleteKeyResponse, error) {
+	if err := ks.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetTenantId() == "" || req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant_id and id are required")
+	}
+	if err := ks.keys.DeleteVirtualKey(req.GetTenantId(), req.GetId()); err != nil {
+		return nil, keyError("revoking key "+req.GetId(), err)
+	}
+	return &llmqueueproxyv1.DeleteKeyResponse{}, nil
+}
+
+// authenticate checks the bearer token of the call against the admin token
+func (ks *KeyServer) authenticate(ctx context.Context) error {
+	if ks.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		provided, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(provided), []byte(ks.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid admin token")
+}
+
+// checkTenant makes sure the tenant keys are managed for exists
+func (ks *KeyServer) checkTenant(tenantID string) error {
+	if tenantID == "" {
+		return status.Error(codes.InvalidArgument, "tenant_id is required")
+	}
+	if _, err := ks.keys.GetTenant(tenantID); err != nil {
+		return keyError("accessing tenant "+tenantID, err)
+	}
+	return nil
+}
+
+// keyError maps a service error to a gRPC error
+func keyError(action string, err error) error {
+	switch {
+	case errors.Is(err, entities.ErrTenantNotFound):
+		return status.Error(codes.NotFound, "tenant not found")
+	case errors.Is(err, entities.ErrVirtualKeyNotFound):
+		return status.Error(codes.NotFound, "key not found")
+	default:
+		log.Printf("Error %s: %v", action, err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// keyMessage converts a virtual key; its hash, secrets and upstream keys are
+// left out
+func keyMessage(key entities.VirtualKey) *llmqueueproxyv1.VirtualKey {
+	return &llmqueueproxyv1.VirtualKey{
+		Id:        key.ID,
+		TenantId:  key.TenantID,
+		Name:      key.Name,
+		CreatedAt: timestamppb.New(key.CreatedAt),
+	}
+}
@@ -0,0 +1,74 @@
+package grpcapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	llmqueueproxyv1 "github.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/grpcapi"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+)
+
+func TestKeyServer_ManagesKeys(t *testing.T) {
+	store := repository.NewMemoryRepository()
+	if err := store.CreateTenant(entities.Tenant{ID: "acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	conn := dial(t, func(server *grpc.Server) {
+		llmqueueproxyv1.RegisterKeyServiceServer(server, grpcapi.NewKeyServer(tenant.NewService(store), "admin-token"))
+	})
+	client := llmqueueproxyv1.NewKeyServiceClient(conn)
+	admin := withKey("admin-token")
+
+	if _, err := client.IssueKey(context.Background(), &llmqueueproxyv1.IssueKeyRequest{TenantId: "acme"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("IssueKey() without token error = %v, want Unauthenticated", err)
+	}
+	if _, err := client.ListKeys(withKey("wrong"), &llmqueueproxyv1.ListKeysRequest{TenantId: "acme"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListKeys() with a wrong token error = %v, want Unauthenticated", err)
+	}
+
+	issued, err := client.IssueKey(admin, &llmqueueproxyv1.IssueKeyRequest{TenantId: "acme", Name: "ci", Signing: true})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+	if issued.GetKey().GetTenantId() != "acme" || issued.GetKey().GetName() != "ci" || issued.GetKey().GetCreatedAt() == nil {
+		t.Errorf("IssueKey() key = %v, want key ci of acme", issued.GetKey())
+	}
+	if !strings.HasPrefix(issued.GetPlaintextKey(), "sk-") || issued.GetSigningSecret() == "" {
+		t.Errorf("IssueKey() = %q, secret %q, want a plaintext key and a signing secret", issued.GetPlaintextKey(), issued.GetSigningSecret())
+	}
+	stored, err := store.GetVirtualKeyByHash(tenant.HashKey(issued.GetPlaintextKey()))
+	if err != nil || stored.ID != issued.GetKey().GetId() {
+		t.Errorf("stored key = %v, %v, want key %s", stored, err, issued.GetKey().GetId())
+	}
+
+	if _, err := client.IssueKey(admin, &llmqueueproxyv1.IssueKeyRequest{TenantId: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Errorf("IssueKey(unknown tenant) error = %v, want NotFound", err)
+	}
+
+	list, err := client.ListKeys(admin, &llmqueueproxyv1.ListKeysRequest{TenantId: "acme"})
+	if err != nil {
+		t.Fatalf("ListKeys() error = %v", err)
+	}
+	if len(list.GetKeys()) != 1 || list.GetKeys()[0].GetId() != issued.GetKey().GetId() {
+		t.Errorf("ListKeys() = %v, want the issued key", list.GetKeys())
+	}
+
+	if _, err := client.DeleteKey(admin, &llmqueueproxyv1.DeleteKeyRequest{TenantId: "acme", Id: issued.GetKey().GetId()}); err != nil {
+		t.Fatalf("DeleteKey() error = %v", err)
+	}
+	if _, err := client.DeleteKey(admin, &llmqueueproxyv1.DeleteKeyRequest{TenantId: "acme", Id: issued.GetKey().GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteKey() twice error = %v, want NotFound", err)
+	}
+	list, err = client.ListKeys(admin, &llmqueueproxyv1.ListKeysRequest{TenantId: "acme"})
+	if err != nil || len(list.GetKeys()) != 0 {
+		t.Errorf("ListKeys() after delete = %v, %v, want no keys", list.GetKeys(), err)
+	}
+}
@@ -0,0 +1,414 @@
+// Package grpcapi serves the proxy's core operations over gRPC, as defined in
+// api/proto/llmqueueproxy/v1/proxy.proto: submitting requests, with natively
+// streamed responses, reading session statistics and managing virtual keys.
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	llmqueueproxyv1 "github.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/handlers"
+)
+
+// ProxyServer serves ProxyService by passing each call to the public HTTP
+// handler in process. Calls thus go through the same tenant resolution,
+// authorization, request filters and session accounting as requests on the
+// HTTP listener; their gRPC metadata is passed on as request headers.
+type ProxyServer struct {
+	llmqueueproxyv1.UnimplementedProxyServiceServer
+	handler http.Handler
+	now     func() time.Time
+}
+
+// NewProxyServer creates a new ProxyServer around the public HTTP handler
+func NewProxyServer(handler http.Handler) *ProxyServer {
+	return &ProxyServer{
+		handler: handler,
+		now:     time.Now,
+	}
+}
+
+// Submit queues a request and returns the complete response. Upstream and
+// proxy errors are returned as responses with their status code and error
+// envelope, as on the HTTP listener.
+func (ps *ProxyServer) Submit(ctx context.Context, req *llmqueueproxyv1.SubmitRequest) (*llmqueueproxyv1.SubmitResponse, error) {
+	r, err := submitRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	w := newResponseWriter()
+	ps.handler.ServeHTTP(w, r)
+	return &llmqueueproxyv1.SubmitResponse{
+		StatusCode:        int32(w.statusCode),
+		Headers:           flattenHeaders(w.header),
+		Body:              w.body.Bytes(),
+		Cached:            w.header.Get("X-Cache") == "HIT",
+		QueueWaitMs:       headerInt(w.header, handlers.QueueWaitHeader),
+		UpstreamLatencyMs: headerInt(w.header, handlers.UpstreamLatencyHeader),
+	}, nil
+}
+
+// SubmitStream queues a request and sends each server-sent event of the
+// response as a message of its own. A response that is not an event stream
+// is sent as a single data event, or error event for error statuses.
+func (ps *ProxyServer) SubmitStream(req *llmqueueproxyv1.SubmitRequest, stream grpc.ServerStreamingServer[llmqueueproxyv1.StreamEvent]) error {
+	r, err := submitRequest(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	w := newEventWriter(stream.Send, ps.now())
+	ps.handler.ServeHTTP(w, r)
+	return w.finish()
+}
+
+// GetSession returns the statistics of a session of the caller's tenant
+func (ps *ProxyServer) GetSession(ctx context.Context, req *llmqueueproxyv1.GetSessionRequest) (*llmqueueproxyv1.Session, error) {
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+	var data entities.SessionData
+	if err := ps.get(ctx, "/v1/session/"+url.PathEscape(req.GetSessionId())+"/status", &data); err != nil {
+		return nil, err
+	}
+	return sessionMessage(data.SessionID, &data), nil
+}
+
+// ListSessions returns the statistics of the caller's tenant's sessions,
+// ordered by session ID
+func (ps *ProxyServer) ListSessions(ctx context.Context, _ *llmqueueproxyv1.ListSessionsRequest) (*llmqueueproxyv1.ListSessionsResponse, error) {
+	var sessions map[string]*entities.SessionData
+	if err := ps.get(ctx, "/sessions/status", &sessions); err != nil {
+		return nil, err
+	}
+	resp := &llmqueueproxyv1.ListSessionsResponse{}
+	for _, id := range slices.Sorted(maps.Keys(sessions)) {
+		resp.Sessions = append(resp.Sessions, sessionMessage(id, sessions[id]))
+	}
+	return resp, nil
+}
+
+// get serves a GET request for a JSON document through the HTTP handler and
+// decodes it into v. Error responses are converted into gRPC errors.
+func (ps *ProxyServer) get(ctx context.Context, target string, v any) error {
+	r, err := newRequest(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	w := newResponseWriter()
+	ps.handler.ServeHTTP(w, r)
+	if w.statusCode != http.StatusOK {
+		return statusError(w.statusCode, w.body.Bytes())
+	}
+	if err := json.Unmarshal(w.body.Bytes(), v); err != nil {
+		return status.Errorf(codes.Internal, "decoding %s: %v", target, err)
+	}
+	return nil
+}
+
+// submitRequest builds the HTTP request a Submit call stands for. The path is
+// the upstream path, prefixed with /t/{tenant} in path mode, and the session
+// is inserted into it as in /v1/session/{sessionID}/chat/completions.
+func submitRequest(ctx context.Context, req *llmqueueproxyv1.SubmitRequest) (*http.Request, error) {
+	prefix, rest, ok := strings.Cut(req.GetPath(), "/v1/")
+	if !ok || strings.HasPrefix(rest, "session/") {
+		return nil, status.Errorf(codes.InvalidArgument, "path must be an upstream path such as /v1/chat/completions, got %q", req.GetPath())
+	}
+	target := req.GetPath()
+	if req.GetSessionId() != "" {
+		target = prefix + "/v1/session/" + url.PathEscape(req.GetSessionId()) + "/" + rest
+	}
+	method := req.GetMethod()
+	if method == "" {
+		method = http.MethodPost
+	}
+	r, err := newRequest(ctx, method, target, req.GetBody())
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range req.GetHeaders() {
+		r.Header.Set(name, value)
+	}
+	if len(req.GetBody()) > 0 && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if req.GetDeadline() != nil {
+		r.Header.Set(handlers.QueueDeadlineHeader, req.GetDeadline().AsTime().Format(time.RFC3339Nano))
+	}
+	return r, nil
+}
+
+// newRequest builds an HTTP request carrying the call's metadata as headers
+// and its peer as the remote address
+func newRequest(ctx context.Context, method, target string, body []byte) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		if !forwardedMetadata(name) {
+			continue
+		}
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+	return r, nil
+}
+
+// forwardedMetadata reports whether a metadata key is passed on as a header.
+// Pseudo-headers, the gRPC protocol's own headers and binary values are not.
+func forwardedMetadata(name string) bool {
+	switch {
+	case strings.HasPrefix(name, ":"), strings.HasPrefix(name, "grpc-"), strings.HasSuffix(name, "-bin"):
+		return false
+	case name == "content-type", name == "te":
+		return false
+	}
+	return true
+}
+
+// statusError converts an error response of the HTTP handler into a gRPC
+// error with the message of its error envelope
+func statusError(statusCode int, body []byte) error {
+	message := http.StatusText(statusCode)
+	var envelope entities.ErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error.Message != "" {
+		message = envelope.Error.Message
+	}
+	return status.Error(grpcCode(statusCode), message)
+}
+
+// grpcCode maps an HTTP status to the closest gRPC code
+func grpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Internal
+}
+
+// sessionMessage converts the statistics of a session
+func sessionMessage(sessionID string, data *entities.SessionData) *llmqueueproxyv1.Session {
+	msg := &llmqueueproxyv1.Session{
+		SessionId:             sessionID,
+		TotalPromptTokens:     int64(data.TotalPromptTokens),
+		TotalCompletionTokens: int64(data.TotalCompletionTokens),
+		TotalTokens:           int64(data.TotalTokens),
+		RequestCount:          int64(data.RequestCount),
+		EstimatedTokens:       int64(data.EstimatedTokens),
+		Responses_2Xx:         int64(data.Responses2xx),
+		Responses_4Xx:         int64(data.Responses4xx),
+		Responses_5Xx:         int64(data.Responses5xx),
+		LastError:             data.LastError,
+		Metadata:              data.Metadata,
+	}
+	if data.LastErrorAt != nil {
+		msg.LastErrorAt = timestamppb.New(*data.LastErrorAt)
+	}
+	return msg
+}
+
+// flattenHeaders joins the values of each header, as they may be combined
+// in HTTP
+func flattenHeaders(header http.Header) map[string]string {
+	flat := make(map[string]string, len(header))
+	for name, values := range header {
+		flat[name] = strings.Join(values, ", ")
+	}
+	return flat
+}
+
+// headerInt parses an integer header, or returns 0
+func headerInt(header http.Header, name string) int64 {
+	value, _ := strconv.ParseInt(header.Get(name), 10, 64)
+	return value
+}
+
+// responseWriter buffers the response of the HTTP handler
+type responseWriter struct {
+	header      http.Header
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.statusCode = statusCode
+	rw.wroteHeader = true
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(p)
+}
+
+// Flush is a no-op; the response is returned once the handler is done
+func (rw *responseWriter) Flush() {}
+
+// eventWriter sends the response of the HTTP handler as stream events, each
+// server-sent event as soon as it is complete
+type eventWriter struct {
+	responseWriter
+	send    func(*llmqueueproxyv1.StreamEvent) error
+	started time.Time
+	// events is set for successful event stream responses, which are split
+	// into events; other responses are buffered in body
+	events bool
+	// err is the first error sending an event, after which nothing is sent
+	err error
+}
+
+func newEventWriter(send func(*llmqueueproxyv1.StreamEvent) error, started time.Time) *eventWriter {
+	return &eventWriter{
+		responseWriter: *newResponseWriter(),
+		send:           send,
+		started:        started,
+	}
+}
+
+// WriteHeader sends the request's place in the queue, if it entered one
+func (ew *eventWriter) WriteHeader(statusCode int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.responseWriter.WriteHeader(statusCode)
+	ew.events = statusCode >= http.StatusOK && statusCode < 300 &&
+		strings.HasPrefix(ew.header.Get("Content-Type"), "text/event-stream")
+	position, err := strconv.Atoi(ew.header.Get(handlers.QueuePositionHeader))
+	if err != nil {
+		return
+	}
+	eta, _ := strconv.ParseFloat(ew.header.Get(handlers.QueueETAHeader), 64)
+	ew.sendEvent(&llmqueueproxyv1.StreamEvent{Event: &llmqueueproxyv1.StreamEvent_Queued{Queued: &llmqueueproxyv1.QueueEstimate{
+		Position:   int32(position),
+		DispatchAt: timestamppb.New(ew.started.Add(time.Duration(eta * float64(time.Second)))),
+	}}})
+}
+
+func (ew *eventWriter) Write(p []byte) (int, error) {
+	ew.WriteHeader(http.StatusOK)
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	ew.body.Write(p)
+	if !ew.events {
+		return len(p), nil
+	}
+	for {
+		event, rest, found := bytes.Cut(ew.body.Bytes(), []byte("\n\n"))
+		if !found {
+			break
+		}
+		ew.sendServerEvent(event)
+		remaining := bytes.Clone(rest)
+		ew.body.Reset()
+		ew.body.Write(remaining)
+	}
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	return len(p), nil
+}
+
+// finish sends what the handler left: the last event of an event stream
+// without a trailing blank line, or the whole of any other response
+func (ew *eventWriter) finish() error {
+	ew.WriteHeader(http.StatusOK)
+	switch {
+	case ew.err != nil:
+	case ew.events:
+		if len(bytes.TrimSpace(ew.body.Bytes())) > 0 {
+			ew.sendServerEvent(ew.body.Bytes())
+		}
+	case ew.statusCode >= http.StatusOK && ew.statusCode < 300:
+		ew.sendEvent(&llmqueueproxyv1.StreamEvent{Event: &llmqueueproxyv1.StreamEvent_Data{Data: ew.body.Bytes()}})
+	default:
+		ew.sendEvent(&llmqueueproxyv1.StreamEvent{Event: &llmqueueproxyv1.StreamEvent_Error{Error: ew.body.Bytes()}})
+	}
+	return ew.err
+}
+
+// sendServerEvent sends the data of a server-sent event. Events without
+// data, such as the heartbeats sent while a request waits, are dropped;
+// events whose data is an error envelope are sent as errors.
+func (ew *eventWriter) sendServerEvent(event []byte) {
+	var data [][]byte
+	for line := range bytes.Lines(event) {
+		line = bytes.TrimRight(line, "\r\n")
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+		}
+	}
+	if data == nil {
+		return
+	}
+	joined := bytes.Join(data, []byte("\n"))
+	if isErrorEnvelope(joined) {
+		ew.sendEvent(&llmqueueproxyv1.StreamEvent{Event: &llmqueueproxyv1.StreamEvent_Error{Error: joined}})
+		return
+	}
+	ew.sendEvent(&llmqueueproxyv1.StreamEvent{Event: &llmqueueproxyv1.StreamEvent_Data{Data: joined}})
+}
+
+func (ew *eventWriter) sendEvent(event *llmqueueproxyv1.StreamEvent) {
+	if ew.err != nil {
+		return
+	}
+	if err := ew.send(event); err != nil {
+		ew.err = err
+	}
+}
+
+// isErrorEnvelope reports whether event data is an OpenAI error envelope
+func isErrorEnvelope(data []byte) bool {
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	return json.Unmarshal(data, &envelope) == nil && len(envelope.Error) > 0 && string(envelope.Error) != "null"
+}
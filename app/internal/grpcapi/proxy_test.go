@@ -0,0 +1,298 @@
+package grpcapi_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	llmqueueproxyv1 "github.com/marketconnect/llm-queue-proxy/api/gen/llmqueueproxy/v1"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/grpcapi"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/handlers"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/session"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+)
+
+const streamBody = "data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+	"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+	"data: [DONE]\n\n"
+
+// stubQueue records pushed requests and answers them after placing them
+// third in the queue, with an event stream for streaming requests
+type stubQueue struct {
+	mu       sync.Mutex
+	requests []entities.ProxyRequest
+}
+
+func (q *stubQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.mu.Lock()
+	q.requests = append(q.requests, r)
+	q.mu.Unlock()
+	if r.OnEnqueue != nil {
+		r.OnEnqueue(entities.QueueEstimate{Position: 3, DispatchAt: time.Now().Add(2 * time.Second)})
+	}
+	if strings.Contains(string(r.Body), `"stream":true`) {
+		return entities.ProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    http.Header{"Content-Type": {"text/event-stream"}},
+			Body:       []byte(streamBody),
+			QueueWait:  40 * time.Millisecond,
+		}
+	}
+	return entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": {"application/json"}},
+		Body:       []byte(`{"id":"chatcmpl-1","usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`),
+		QueueWait:  40 * time.Millisecond,
+	}
+}
+
+func (q *stubQueue) pushed() []entities.ProxyRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]entities.ProxyRequest(nil), q.requests...)
+}
+
+// dial serves the registered services on an in-memory listener and returns
+// a client connection to them
+func dial(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newProxyClient serves the public routes of the proxy and the session
+// status handler to tenants authenticated by virtual keys, and returns a
+// client and a key of tenant acme
+func newProxyClient(t *testing.T, queue *stubQueue) (llmqueueproxyv1.ProxyServiceClient, string) {
+	t.Helper()
+	store := repository.NewMemoryRepository()
+	if err := store.CreateTenant(entities.Tenant{ID: "acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	issued, err := tenant.NewService(store).IssueKey("acme", entities.VirtualKeyRequest{})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+
+	sessions := session.NewSessionManager(store, nil)
+	proxyHandler := handlers.NewProxyHandler(sessions, queue, entities.ProxySettings{})
+	statusHandler := handlers.NewSessionStatusHandler(sessions)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/session/", proxyHandler.Handle)
+	mux.HandleFunc("/v1/session/{sessionID}/status", statusHandler.HandleSingle)
+	mux.HandleFunc("/v1/", proxyHandler.Handle)
+	mux.HandleFunc("/sessions/status", statusHandler.HandleSingle)
+	resolver := tenant.NewResolver(store, entities.TenantSettings{Mode: entities.TenantModeKey})
+
+	conn := dial(t, func(server *grpc.Server) {
+		llmqueueproxyv1.RegisterProxyServiceServer(server, grpcapi.NewProxyServer(resolver.Middleware(mux)))
+	})
+	return llmqueueproxyv1.NewProxyServiceClient(conn), issued.Key
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+}
+
+func TestProxyServer_SubmitAndSessionStats(t *testing.T) {
+	queue := &stubQueue{}
+	client, key := newProxyClient(t, queue)
+	deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	resp, err := client.Submit(withKey(key), &llmqueueproxyv1.SubmitRequest{
+		SessionId: "s1",
+		Path:      "/v1/chat/completions",
+		Headers:   map[string]string{"X-Trace": "abc"},
+		Body:      []byte(`{"model":"gpt-4o","messages":[]}`),
+		Deadline:  timestamppb.New(deadline),
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if resp.GetStatusCode() != http.StatusOK || !strings.Contains(string(resp.GetBody()), "chatcmpl-1") {
+		t.Errorf("Submit() = %d %s, want 200 and the upstream body", resp.GetStatusCode(), resp.GetBody())
+	}
+	if resp.GetQueueWaitMs() != 40 || resp.GetHeaders()[handlers.QueuePositionHeader] != "3" {
+		t.Errorf("Submit() queue wait = %d, position = %q, want 40 and 3", resp.GetQueueWaitMs(), resp.GetHeaders()[handlers.QueuePositionHeader])
+	}
+
+	pushed := queue.pushed()
+	if len(pushed) != 1 {
+		t.Fatalf("pushed %d requests, want 1", len(pushed))
+	}
+	req := pushed[0]
+	if req.Method != http.MethodPost || req.Path != "/v1/chat/completions" {
+		t.Errorf("pushed %s %s, want POST /v1/chat/completions", req.Method, req.Path)
+	}
+	if req.TenantID != "acme" || req.SessionID != entities.TenantSessionID("acme", "s1") {
+		t.Errorf("pushed tenant = %q, session = %q, want acme and its session s1", req.TenantID, req.SessionID)
+	}
+	if req.Headers.Get("X-Trace") != "abc" || req.Headers.Get("Authorization") != "" {
+		t.Errorf("pushed headers = %v, want X-Trace without the virtual key", req.Headers)
+	}
+	if !req.Deadline.Equal(deadline) {
+		t.Errorf("pushed deadline = %v, want %v", req.Deadline, deadline)
+	}
+
+	sess, err := client.GetSession(withKey(key), &llmqueueproxyv1.GetSessionRequest{SessionId: "s1"})
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.GetSessionId() != "s1" || sess.GetRequestCount() != 1 || sess.GetTotalTokens() != 12 || sess.GetResponses_2Xx() != 1 {
+		t.Errorf("GetSession() = %v, want s1 with 1 request of 12 tokens", sess)
+	}
+
+	list, err := client.ListSessions(withKey(key), &llmqueueproxyv1.ListSessionsRequest{})
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(list.GetSessions()) != 1 || list.GetSessions()[0].GetSessionId() != "s1" {
+		t.Errorf("ListSessions() = %v, want session s1", list.GetSessions())
+	}
+
+	if _, err := client.GetSession(withKey(key), &llmqueueproxyv1.GetSessionRequest{SessionId: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetSession(missing) error = %v, want NotFound", err)
+	}
+	if _, err := client.GetSession(context.Background(), &llmqueueproxyv1.GetSessionRequest{SessionId: "s1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetSession() without key error = %v, want Unauthenticated", err)
+	}
+}
+
+func TestProxyServer_SubmitReturnsProxyErrors(t *testing.T) {
+	queue := &stubQueue{}
+	client, _ := newProxyClient(t, queue)
+
+	resp, err := client.Submit(withKey("sk-unknown"), &llmqueueproxyv1.SubmitRequest{
+		Path: "/v1/chat/completions",
+		Body: []byte(`{"model":"gpt-4o"}`),
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if resp.GetStatusCode() != http.StatusUnauthorized || !strings.Contains(string(resp.GetBody()), "invalid_api_key") {
+		t.Errorf("Submit() = %d %s, want 401 with the error envelope", resp.GetStatusCode(), resp.GetBody())
+	}
+	if len(queue.pushed()) != 0 {
+		t.Error("request with an unknown key was queued")
+	}
+
+	for _, path := range []string{"/chat/completions", "/v1/session/s1/chat/completions"} {
+		_, err := client.Submit(context.Background(), &llmqueueproxyv1.SubmitRequest{Path: path})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Submit(%s) error = %v, want InvalidArgument", path, err)
+		}
+	}
+}
+
+// receive reads a stream to its end
+func receive(t *testing.T, stream grpc.ServerStreamingClient[llmqueueproxyv1.StreamEvent]) []*llmqueueproxyv1.StreamEvent {
+	t.Helper()
+	var events []*llmqueueproxyv1.StreamEvent
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("Recv() error = %v", err)
+			}
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func TestProxyServer_SubmitStream(t *testing.T) {
+	queue := &stubQueue{}
+	client, key := newProxyClient(t, queue)
+
+	stream, err := client.SubmitStream(withKey(key), &llmqueueproxyv1.SubmitRequest{
+		SessionId: "s1",
+		Path:      "/v1/chat/completions",
+		Body:      []byte(`{"model":"gpt-4o","stream":true}`),
+	})
+	if err != nil {
+		t.Fatalf("SubmitStream() error = %v", err)
+	}
+	events := receive(t, stream)
+	if len(events) != 4 {
+		t.Fatalf("received %d events, want the queue estimate and 3 data events: %v", len(events), events)
+	}
+	if events[0].GetQueued().GetPosition() != 3 {
+		t.Errorf("first event = %v, want position 3 in the queue", events[0])
+	}
+	want := []string{`{"choices":[{"delta":{"content":"Hel"}}]}`, `{"choices":[{"delta":{"content":"lo"}}]}`, "[DONE]"}
+	for i, data := range want {
+		if got := string(events[i+1].GetData()); got != data {
+			t.Errorf("event %d data = %q, want %q", i+1, got, data)
+		}
+	}
+
+	stream, err = client.SubmitStream(context.Background(), &llmqueueproxyv1.SubmitRequest{
+		Path: "/v1/chat/completions",
+		Body: []byte(`{"model":"gpt-4o","stream":true}`),
+	})
+	if err != nil {
+		t.Fatalf("SubmitStream() error = %v", err)
+	}
+	events = receive(t, stream)
+	if len(events) != 1 || !strings.Contains(string(events[0].GetError()), "invalid_api_key") {
+		t.Errorf("events without a key = %v, want one error event", events)
+	}
+}
+
+func TestProxyServer_SubmitStreamSplitsEvents(t *testing.T) {
+	// Events arrive split across writes, after a heartbeat comment
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(": heartbeat\n\n"))
+		w.Write([]byte("data: {\"a\":"))
+		w.Write([]byte("1}\n\ndata: {\"error\":{\"message\":\"upstream failed\"}}\n\n"))
+		w.Write([]byte("data: tail"))
+	})
+	conn := dial(t, func(server *grpc.Server) {
+		llmqueueproxyv1.RegisterProxyServiceServer(server, grpcapi.NewProxyServer(handler))
+	})
+	client := llmqueueproxyv1.NewProxyServiceClient(conn)
+
+	stream, err := client.SubmitStream(context.Background(), &llmqueueproxyv1.SubmitRequest{Path: "/v1/chat/completions"})
+	if err != nil {
+		t.Fatalf("SubmitStream() error = %v", err)
+	}
+	events := receive(t, stream)
+	if len(events) != 3 {
+		t.Fatalf("received %d events, want 3: %v", len(events), events)
+	}
+	if string(events[0].GetData()) != `{"a":1}` || !strings.Contains(string(events[1].GetError()), "upstream failed") || string(events[2].GetData()) != "tail" {
+		t.Errorf("events = %v, want data, error and the unterminated tail", events)
+	}
+}
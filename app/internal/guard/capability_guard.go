@@ -0,0 +1,307 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Summarizer condenses chat messages into a text of at most maxTokens
+type Summarizer interface {
+	Summarize(messages []json.RawMessage, maxTokens int) (string, error)
+}
+
+// CapabilityGuard rejects requests that use features their model does not
+// support, such as images sent to a text-only model, before they are queued.
+// Chat completions overflowing the model's context window are rejected too,
+// unless an overflow policy drops or summarizes their oldest messages.
+type CapabilityGuard struct {
+	counter PromptTokenCounter
+	// models maps model names, or name prefixes ending in "*", to capabilities
+	models map[string]entities.ModelCapabilities
+	// overflow is an entities.LimitPolicy* value; summarizer is set for
+	// LimitPolicySummarize, with summaryTokens kept free for the summary
+	overflow      string
+	summarizer    Summarizer
+	summaryTokens int
+}
+
+// NewCapabilityGuard creates a new CapabilityGuard with injected dependencies
+func NewCapabilityGuard(counter PromptTokenCounter, models map[string]entities.ModelCapabilities) *CapabilityGuard {
+	return &CapabilityGuard{
+		counter: counter,
+		models:  models,
+	}
+}
+
+// WithOverflow sets how requests overflowing the context window are handled:
+// entities.LimitPolicyReject, LimitPolicyTruncate, or LimitPolicySummarize,
+// which replaces the dropped messages with a summary of up to summaryTokens
+// by summarizer
+func (g *CapabilityGuard) WithOverflow(policy string, summarizer Summarizer, summaryTokens int) *CapabilityGuard {
+	g.overflow = policy
+	g.summarizer = summarizer
+	g.summaryTokens = summaryTokens
+	return g
+}
+
+// ParseModelCapabilities parses capabilities from a JSON object keyed by model
+// name or by a name prefix ending in "*"
+func ParseModelCapabilities(raw string) (map[string]entities.ModelCapabilities, error) {
+	var models map[string]entities.ModelCapabilities
+	if err := json.Unmarshal([]byte(raw), &models); err != nil {
+		return nil, fmt.Errorf("invalid model capabilities: %w", err)
+	}
+	for name, capabilities := range models {
+		if capabilities.ContextWindow < 0 {
+			return nil, fmt.Errorf("invalid model capabilities: context_window of %s must not be negative", name)
+		}
+	}
+	return models, nil
+}
+
+// capabilityRequest holds the fields of a request body that need a capability
+type capabilityRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	// Input is the input of the Responses API
+	Input          json.RawMessage   `json:"input"`
+	Tools          []json.RawMessage `json:"tools"`
+	Functions      []json.RawMessage `json:"functions"`
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+	Text *struct {
+		Format *struct {
+			Type string `json:"type"`
+		} `json:"format"`
+	} `json:"text"`
+}
+
+// Filter checks the request against the capabilities of its model
+func (g *CapabilityGuard) Filter(sessionID string, req *entities.ProxyRequest) error {
+	if len(req.Body) == 0 {
+		return nil
+	}
+	var body capabilityRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil || body.Model == "" {
+		// Not a JSON object naming a model; nothing to check
+		return nil
+	}
+	capabilities, ok := g.capabilitiesOf(body.Model)
+	if !ok {
+		return nil
+	}
+
+	if unsupported(capabilities.Vision) && body.hasImages() {
+		return unsupportedError(body.Model, "image inputs")
+	}
+	if unsupported(capabilities.Tools) && (len(body.Tools) > 0 || len(body.Functions) > 0) {
+		return unsupportedError(body.Model, "tool calling")
+	}
+	if unsupported(capabilities.JSONMode) && body.jsonMode() {
+		return unsupportedError(body.Model, "JSON response formats")
+	}
+	if capabilities.ContextWindow > 0 {
+		return g.fitContext(req, body.Model, capabilities.ContextWindow)
+	}
+	return nil
+}
+
+// fitContext rejects a request overflowing the context window, or shrinks
+// its messages to fit according to the overflow policy
+func (g *CapabilityGuard) fitContext(req *entities.ProxyRequest, model string, window int) error {
+	tokens := g.contextTokens(req.Body)
+	if tokens <= window {
+		return nil
+	}
+	if g.overflow == entities.LimitPolicyTruncate || g.overflow == entities.LimitPolicySummarize {
+		if body, ok := g.shrink(req.Body, window); ok {
+			req.Body = body
+			return nil
+		}
+	}
+	return &entities.RequestError{
+		StatusCode: http.StatusBadRequest,
+		Message:    fmt.Sprintf("Estimated prompt and completion of %d tokens exceed the context window of %s (%d tokens)", tokens, model, window),
+		Type:       "invalid_request_error",
+		Code:       "context_length_exceeded",
+	}
+}
+
+// contextTokens estimates the prompt plus the requested completion tokens
+func (g *CapabilityGuard) contextTokens(body []byte) int {
+	return g.counter.CountPromptTokens(body) + completionTokens(body)
+}
+
+// shrink drops the oldest non-system chat messages until the request fits
+// the window, keeping the last message. With the summarize policy, room is
+// also made for the summary replacing the dropped messages; if it cannot be
+// had, the request without it is used.
+func (g *CapabilityGuard) shrink(body []byte, window int) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	var messages []json.RawMessage
+	if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields["messages"], &messages) != nil {
+		return nil, false
+	}
+	encode := func(messages []json.RawMessage) []byte {
+		fields["messages"], _ = json.Marshal(messages)
+		candidate, _ := json.Marshal(fields)
+		return candidate
+	}
+	summarize := g.overflow == entities.LimitPolicySummarize && g.summarizer != nil
+	reserve := 0
+	if summarize {
+		reserve = g.summaryTokens
+	}
+
+	var dropped []json.RawMessage
+	at := -1
+	var truncated []byte
+	for {
+		i := oldestDroppableMessage(messages)
+		if i < 0 {
+			break
+		}
+		if at < 0 {
+			at = i
+		}
+		dropped = append(dropped, messages[i])
+		messages = slices.Delete(messages, i, i+1)
+		candidate := encode(messages)
+		tokens := g.contextTokens(candidate)
+		if tokens <= window && truncated == nil {
+			truncated = candidate
+		}
+		if tokens+reserve <= window {
+			break
+		}
+	}
+	if truncated == nil {
+		return nil, false
+	}
+	if !summarize {
+		log.Printf("Dropped %d messages to fit the context window of %d tokens", len(dropped), window)
+		return truncated, true
+	}
+
+	summary, err := g.summarizer.Summarize(dropped, g.summaryTokens)
+	if err != nil {
+		log.Printf("Failed to summarize %d messages, dropping them instead: %v", len(dropped), err)
+		return truncated, true
+	}
+	message, _ := json.Marshal(map[string]string{"role": "system", "content": "Summary of the earlier conversation: " + summary})
+	if candidate := encode(slices.Insert(messages, at, message)); g.contextTokens(candidate) <= window {
+		log.Printf("Summarized %d messages to fit the context window of %d tokens", len(dropped), window)
+		return candidate, true
+	}
+	log.Printf("Summary of %d messages does not fit the context window of %d tokens, dropping them instead", len(dropped), window)
+	return truncated, true
+}
+
+// capabilitiesOf returns the capabilities of a model: those listed under its
+// name, or else under the longest matching prefix
+func (g *CapabilityGuard) capabilitiesOf(model string) (entities.ModelCapabilities, bool) {
+	if capabilities, ok := g.models[model]; ok {
+		return capabilities, true
+	}
+	var best string
+	found := false
+	for pattern := range g.models {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	return g.models[best+"*"], found
+}
+
+// hasImages reports whether a chat message or Responses API input has an image part
+func (b capabilityRequest) hasImages() bool {
+	for _, message := range b.Messages {
+		if hasImagePart(message.Content) {
+			return true
+		}
+	}
+	var items []struct {
+		Type    string          `json:"type"`
+		Content json.RawMessage `json:"content"`
+	}
+	if json.Unmarshal(b.Input, &items) != nil {
+		return false
+	}
+	for _, item := range items {
+		if isImageType(item.Type) || hasImagePart(item.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonMode reports whether the request asks for a JSON object or schema
+func (b capabilityRequest) jsonMode() bool {
+	format := ""
+	if b.ResponseFormat != nil {
+		format = b.ResponseFormat.Type
+	} else if b.Text != nil && b.Text.Format != nil {
+		format = b.Text.Format.Type
+	}
+	return format == "json_object" || format == "json_schema"
+}
+
+// hasImagePart reports whether message content is an array with an image part
+func hasImagePart(content json.RawMessage) bool {
+	var parts []struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return false
+	}
+	for _, part := range parts {
+		if isImageType(part.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func isImageType(partType string) bool {
+	return partType == "image_url" || partType == "input_image"
+}
+
+// completionTokens returns the completion tokens the request asks for, 0 if unset
+func completionTokens(body []byte) int {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return 0
+	}
+	for _, name := range maxTokensFields {
+		var requested int
+		if raw, ok := fields[name]; ok && json.Unmarshal(raw, &requested) == nil {
+			return requested
+		}
+	}
+	return 0
+}
+
+// unsupported reports whether a capability is known to be missing
+func unsupported(capability *bool) bool {
+	return capability != nil && !*capability
+}
+
+// unsupportedError rejects a request using a feature the model lacks
+func unsupportedError(model, feature string) error {
+	return &entities.RequestError{
+		StatusCode: http.StatusBadRequest,
+		Message:    fmt.Sprintf("Model %s does not support %s", model, feature),
+		Type:       "invalid_request_error",
+		Code:       "unsupported_capability",
+	}
+}
@@ -0,0 +1,168 @@
+package guard_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/guard"
+)
+
+func TestCapabilityGuard(t *testing.T) {
+	capabilities, err := guard.ParseModelCapabilities(`{
+		"gpt-3.5-turbo": {"vision": false, "context_window": 35},
+		"o1-mini*":      {"tools": false, "json_mode": false},
+		"o1*":           {"vision": true}
+	}`)
+	if err != nil {
+		t.Fatalf("ParseModelCapabilities: %v", err)
+	}
+	g := guard.NewCapabilityGuard(messageCounter{}, capabilities)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{"image to text-only model", `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"x"}}]}]}`, "unsupported_capability"},
+		{"text to text-only model", `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`, ""},
+		{"Responses API image", `{"model":"gpt-3.5-turbo","input":[{"role":"user","content":[{"type":"input_image","image_url":"x"}]}]}`, "unsupported_capability"},
+		{"tools matched by the longest prefix", `{"model":"o1-mini-2024","messages":[],"tools":[{"type":"function"}]}`, "unsupported_capability"},
+		{"JSON mode", `{"model":"o1-mini","messages":[],"response_format":{"type":"json_object"}}`, "unsupported_capability"},
+		{"Responses API JSON schema", `{"model":"o1-mini","input":"hi","text":{"format":{"type":"json_schema"}}}`, "unsupported_capability"},
+		{"text response format", `{"model":"o1-mini","messages":[],"response_format":{"type":"text"}}`, ""},
+		{"unset capability is not checked", `{"model":"o1-preview","messages":[],"tools":[{"type":"function"}]}`, ""},
+		{"unlisted model", `{"model":"gpt-4o","messages":[],"tools":[{"type":"function"}]}`, ""},
+		{"prompt and completion within the window", `{"model":"gpt-3.5-turbo","max_tokens":15,"messages":[{"role":"user","content":"a"},{"role":"user","content":"b"}]}`, ""},
+		{"prompt and completion beyond the window", `{"model":"gpt-3.5-turbo","max_tokens":16,"messages":[{"role":"user","content":"a"},{"role":"user","content":"b"}]}`, "context_length_exceeded"},
+		{"not JSON", `audio`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.Filter("", &entities.ProxyRequest{Body: []byte(tt.body)})
+			var reqErr *entities.RequestError
+			switch {
+			case tt.wantCode == "" && err != nil:
+				t.Errorf("Filter() error = %v, want none", err)
+			case tt.wantCode != "" && (!errors.As(err, &reqErr) || reqErr.StatusCode != 400 || reqErr.Code != tt.wantCode):
+				t.Errorf("Filter() error = %v, want 400 %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestParseModelCapabilities_Invalid(t *testing.T) {
+	for _, raw := range []string{`[]`, `{"gpt-4":{"context_window":-1}}`, `{"gpt-4":{"vision":"no"}}`} {
+		if _, err := guard.ParseModelCapabilities(raw); err == nil {
+			t.Errorf("ParseModelCapabilities(%s) succeeded, want an error", raw)
+		}
+	}
+}
+
+type fixedSummarizer struct {
+	summary string
+	err     error
+	got     []json.RawMessage
+	// maxTokens is the bound it was given
+	maxTokens int
+}
+
+func (s *fixedSummarizer) Summarize(messages []json.RawMessage, maxTokens int) (string, error) {
+	s.got = messages
+	s.maxTokens = maxTokens
+	return s.summary, s.err
+}
+
+func TestCapabilityGuard_Overflow(t *testing.T) {
+	// 40 tokens of messages and 10 of completion against a window of 45; the
+	// summary needs 10 more, so one more message is dropped to make room
+	capabilities := map[string]entities.ModelCapabilities{"gpt-4": {ContextWindow: 45}}
+	body := `{"model":"gpt-4","max_tokens":10,"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`
+
+	tests := []struct {
+		name         string
+		policy       string
+		summarizer   *fixedSummarizer
+		wantContents []string
+	}{
+		{"truncate", entities.LimitPolicyTruncate, nil, []string{"s", "b", "c"}},
+		{"summarize", entities.LimitPolicySummarize, &fixedSummarizer{summary: "greeting"},
+			[]string{"s", "Summary of the earlier conversation: greeting", "c"}},
+		{"summary failure falls back to truncation", entities.LimitPolicySummarize, &fixedSummarizer{err: errors.New("unavailable")},
+			[]string{"s", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var summarizer guard.Summarizer
+			if tt.summarizer != nil {
+				summarizer = tt.summarizer
+			}
+			g := guard.NewCapabilityGuard(messageCounter{}, capabilities).WithOverflow(tt.policy, summarizer, 10)
+			req := &entities.ProxyRequest{Body: []byte(body)}
+			if err := g.Filter("", req); err != nil {
+				t.Fatalf("Filter() error = %v", err)
+			}
+			var got struct {
+				MaxTokens int `json:"max_tokens"`
+				Messages  []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			}
+			json.Unmarshal(req.Body, &got)
+			contents := make([]string, len(got.Messages))
+			for i, m := range got.Messages {
+				contents[i] = m.Content
+			}
+			if !reflect.DeepEqual(contents, tt.wantContents) || got.MaxTokens != 10 {
+				t.Errorf("messages = %q, want %q", contents, tt.wantContents)
+			}
+			if tt.summarizer != nil && (len(tt.summarizer.got) != 2 || tt.summarizer.maxTokens != 10) {
+				t.Errorf("summarized %d messages in %d tokens, want the 2 dropped in 10", len(tt.summarizer.got), tt.summarizer.maxTokens)
+			}
+		})
+	}
+
+	// Nothing can be dropped from a single message
+	g := guard.NewCapabilityGuard(messageCounter{}, map[string]entities.ModelCapabilities{"gpt-4": {ContextWindow: 5}}).
+		WithOverflow(entities.LimitPolicyTruncate, nil, 0)
+	var reqErr *entities.RequestError
+	err := g.Filter("", &entities.ProxyRequest{Body: []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"a"}]}`)})
+	if !errors.As(err, &reqErr) || reqErr.Code != "context_length_exceeded" {
+		t.Errorf("Filter() error = %v, want context_length_exceeded", err)
+	}
+}
+
+type summaryQueue struct {
+	request entities.ProxyRequest
+}
+
+func (q *summaryQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.request = r
+	return entities.ProxyResponse{StatusCode: 200, Body: []byte(`{"choices":[{"message":{"content":"They said hello."}}]}`)}
+}
+
+func TestQueueSummarizer(t *testing.T) {
+	queue := &summaryQueue{}
+	summary, err := guard.NewQueueSummarizer(queue, "gpt-4o-mini").Summarize([]json.RawMessage{
+		json.RawMessage(`{"role":"user","content":"hello"}`),
+		json.RawMessage(`{"role":"assistant","content":[{"type":"text","text":"hi"},{"type":"image_url"}]}`),
+	}, 200)
+	if err != nil || summary != "They said hello." {
+		t.Fatalf("Summarize() = %q, %v", summary, err)
+	}
+	var sent struct {
+		Model     string `json:"model"`
+		MaxTokens int    `json:"max_tokens"`
+		Messages  []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(queue.request.Body, &sent)
+	if queue.request.Path != "/v1/chat/completions" || sent.Model != "gpt-4o-mini" || sent.MaxTokens != 200 || len(sent.Messages) != 2 ||
+		sent.Messages[1].Content != "user: hello\nassistant: hi [image_url]\n" {
+		t.Errorf("summary request = %s", queue.request.Body)
+	}
+}
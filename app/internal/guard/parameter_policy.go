@@ -0,0 +1,137 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// ParameterPolicyGuard enforces parameter policies on request bodies. The
+// policy is selected by session tag, falling back to the default policy.
+type ParameterPolicyGuard struct {
+	policies map[string]entities.ParameterPolicy
+}
+
+// NewParameterPolicyGuard creates a new ParameterPolicyGuard with policies keyed
+// by session tag; entities.DefaultPolicyTag applies to all other requests.
+func NewParameterPolicyGuard(policies map[string]entities.ParameterPolicy) *ParameterPolicyGuard {
+	return &ParameterPolicyGuard{
+		policies: policies,
+	}
+}
+
+// ParseParameterPolicies parses policies from a JSON object keyed by session tag
+func ParseParameterPolicies(raw string) (map[string]entities.ParameterPolicy, error) {
+	var policies map[string]entities.ParameterPolicy
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return nil, fmt.Errorf("invalid parameter policies: %w", err)
+	}
+	return policies, nil
+}
+
+// Filter applies the session's policy to a request body
+func (g *ParameterPolicyGuard) Filter(sessionID string, req *entities.ProxyRequest) error {
+	policy, ok := g.policyFor(sessionID)
+	if !ok || len(req.Body) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(req.Body, &fields); err != nil {
+		// Not a JSON object; nothing to enforce
+		return nil
+	}
+
+	for _, name := range policy.Forbid {
+		if _, set := fields[name]; set {
+			return &entities.RequestError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("Parameter %q is not allowed", name),
+				Type:       "invalid_request_error",
+				Code:       "parameter_not_allowed",
+			}
+		}
+	}
+	for _, name := range policy.Strip {
+		delete(fields, name)
+	}
+	for name, bounds := range policy.Ranges {
+		if err := enforceRange(fields, name, bounds); err != nil {
+			return err
+		}
+	}
+	if policy.MaxTokens > 0 {
+		limit := float64(policy.MaxTokens)
+		for _, name := range maxTokensFields {
+			if err := enforceRange(fields, name, entities.ParameterRange{Max: &limit, Clamp: true}); err != nil {
+				return err
+			}
+		}
+	}
+	for name, value := range policy.Defaults {
+		if _, set := fields[name]; !set {
+			fields[name] = value
+		}
+	}
+	for name, value := range policy.Force {
+		fields[name] = value
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode request body: %w", err)
+	}
+	req.Body = body
+	return nil
+}
+
+// policyFor returns the policy for the session's tag, or the default policy
+func (g *ParameterPolicyGuard) policyFor(sessionID string) (entities.ParameterPolicy, bool) {
+	if tag := entities.SessionTag(sessionID); tag != "" {
+		if policy, ok := g.policies[tag]; ok {
+			return policy, true
+		}
+	}
+	policy, ok := g.policies[entities.DefaultPolicyTag]
+	return policy, ok
+}
+
+// enforceRange clamps or rejects a numeric field outside its bounds
+func enforceRange(fields map[string]json.RawMessage, name string, bounds entities.ParameterRange) error {
+	raw, set := fields[name]
+	if !set || string(raw) == "null" {
+		return nil
+	}
+	var value float64
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return &entities.RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Parameter %q must be a number", name),
+			Type:       "invalid_request_error",
+			Code:       "invalid_parameter",
+		}
+	}
+
+	clamped := value
+	if bounds.Min != nil && clamped < *bounds.Min {
+		clamped = *bounds.Min
+	}
+	if bounds.Max != nil && clamped > *bounds.Max {
+		clamped = *bounds.Max
+	}
+	if clamped == value {
+		return nil
+	}
+	if !bounds.Clamp {
+		return &entities.RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("Parameter %q is outside the allowed range", name),
+			Type:       "invalid_request_error",
+			Code:       "parameter_out_of_range",
+		}
+	}
+	fields[name] = json.RawMessage(strconv.FormatFloat(clamped, 'f', -1, 64))
+	return nil
+}
@@ -0,0 +1,123 @@
+package guard_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/guard"
+)
+
+func filterFields(t *testing.T, g *guard.ParameterPolicyGuard, sessionID, body string) map[string]json.RawMessage {
+	t.Helper()
+	req := &entities.ProxyRequest{Body: []byte(body)}
+	if err := g.Filter(sessionID, req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(req.Body, &fields); err != nil {
+		t.Fatalf("Filter() produced invalid JSON: %v", err)
+	}
+	return fields
+}
+
+func TestParameterPolicyGuard_Rewrite(t *testing.T) {
+	policies, err := guard.ParseParameterPolicies(`{"*":{
+		"strip":["logit_bias"],
+		"ranges":{"temperature":{"min":0,"max":1,"clamp":true}},
+		"max_tokens":100,
+		"defaults":{"top_p":0.9,"user":"proxy"},
+		"force":{"n":1}
+	}}`)
+	if err != nil {
+		t.Fatalf("ParseParameterPolicies() error = %v", err)
+	}
+	g := guard.NewParameterPolicyGuard(policies)
+
+	fields := filterFields(t, g, "s1", `{"model":"gpt-4","logit_bias":{"1":5},"temperature":1.7,"max_tokens":500,"user":"u1","n":3}`)
+
+	want := map[string]string{
+		"model":       `"gpt-4"`,
+		"temperature": `1`,
+		"max_tokens":  `100`,
+		"top_p":       `0.9`,
+		"user":        `"u1"`,
+		"n":           `1`,
+	}
+	if len(fields) != len(want) {
+		t.Errorf("Filter() fields = %v, want %v", fields, want)
+	}
+	for name, value := range want {
+		if string(fields[name]) != value {
+			t.Errorf("Filter() %s = %s, want %s", name, fields[name], value)
+		}
+	}
+}
+
+func TestParameterPolicyGuard_Reject(t *testing.T) {
+	minTemp := 0.0
+	maxTemp := 1.0
+	g := guard.NewParameterPolicyGuard(map[string]entities.ParameterPolicy{
+		"*": {
+			Forbid: []string{"logit_bias"},
+			Ranges: map[string]entities.ParameterRange{"temperature": {Min: &minTemp, Max: &maxTemp}},
+		},
+	})
+
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{"forbidden field", `{"logit_bias":{"1":5}}`, "parameter_not_allowed"},
+		{"out of range", `{"temperature":1.5}`, "parameter_out_of_range"},
+		{"not a number", `{"temperature":"hot"}`, "invalid_parameter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := g.Filter("s1", &entities.ProxyRequest{Body: []byte(tt.body)})
+			var reqErr *entities.RequestError
+			if !errors.As(err, &reqErr) || reqErr.Code != tt.code {
+				t.Errorf("Filter() error = %v, want code %s", err, tt.code)
+			}
+		})
+	}
+
+	if err := g.Filter("s1", &entities.ProxyRequest{Body: []byte(`{"temperature":0.5}`)}); err != nil {
+		t.Errorf("Filter() in-range error = %v, want nil", err)
+	}
+}
+
+func TestParameterPolicyGuard_SessionTag(t *testing.T) {
+	g := guard.NewParameterPolicyGuard(map[string]entities.ParameterPolicy{
+		"*":     {MaxTokens: 100},
+		"batch": {MaxTokens: 1000},
+	})
+
+	if got := filterFields(t, g, "batch:42", `{"max_tokens":500}`)["max_tokens"]; string(got) != "500" {
+		t.Errorf("Filter() tagged max_tokens = %s, want 500", got)
+	}
+	if got := filterFields(t, g, "other:42", `{"max_tokens":500}`)["max_tokens"]; string(got) != "100" {
+		t.Errorf("Filter() default max_tokens = %s, want 100", got)
+	}
+}
+
+func TestParameterPolicyGuard_NoPolicy(t *testing.T) {
+	g := guard.NewParameterPolicyGuard(map[string]entities.ParameterPolicy{"batch": {MaxTokens: 10}})
+
+	body := `{"max_tokens": 500}`
+	req := &entities.ProxyRequest{Body: []byte(body)}
+	if err := g.Filter("s1", req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+	if string(req.Body) != body {
+		t.Errorf("Filter() body = %s, want unchanged %s", req.Body, body)
+	}
+}
+
+func TestParseParameterPolicies_Invalid(t *testing.T) {
+	if _, err := guard.ParseParameterPolicies(`{"*":`); err == nil {
+		t.Error("ParseParameterPolicies() error = nil, want error")
+	}
+}
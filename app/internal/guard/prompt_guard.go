@@ -0,0 +1,162 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type PromptTokenCounter interface {
+	CountPromptTokens(requestBody []byte) int
+}
+
+// maxTokensFields are the request fields that bound the completion length
+var maxTokensFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// PromptGuard rejects or truncates requests whose estimated prompt exceeds the
+// configured limit, and enforces a cap on the requested completion tokens.
+type PromptGuard struct {
+	counter PromptTokenCounter
+	limits  entities.PromptLimits
+}
+
+// NewPromptGuard creates a new PromptGuard with injected dependencies
+func NewPromptGuard(counter PromptTokenCounter, limits entities.PromptLimits) *PromptGuard {
+	return &PromptGuard{
+		counter: counter,
+		limits:  limits,
+	}
+}
+
+// Filter applies the limits to a request body
+func (g *PromptGuard) Filter(sessionID string, req *entities.ProxyRequest) error {
+	if len(req.Body) == 0 {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(req.Body, &fields); err != nil {
+		// Not a JSON object; nothing to enforce
+		return nil
+	}
+
+	modified, err := g.enforceCompletionLimit(fields)
+	if err != nil {
+		return err
+	}
+
+	limit := g.promptLimit(sessionID)
+	if limit > 0 {
+		truncated, err := g.enforcePromptLimit(fields, req.Body, limit)
+		if err != nil {
+			return err
+		}
+		modified = modified || truncated
+	}
+
+	if modified {
+		body, err := json.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("failed to encode guarded request body: %w", err)
+		}
+		req.Body = body
+	}
+	return nil
+}
+
+// promptLimit returns the prompt token limit for a session
+func (g *PromptGuard) promptLimit(sessionID string) int {
+	if limit, ok := g.limits.SessionMaxPromptTokens[sessionID]; ok && sessionID != "" {
+		return limit
+	}
+	return g.limits.MaxPromptTokens
+}
+
+// enforceCompletionLimit rejects or clamps max_tokens values above the cap
+func (g *PromptGuard) enforceCompletionLimit(fields map[string]json.RawMessage) (bool, error) {
+	if g.limits.MaxCompletionTokens <= 0 {
+		return false, nil
+	}
+	modified := false
+	for _, name := range maxTokensFields {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var requested int
+		if err := json.Unmarshal(raw, &requested); err != nil || requested <= g.limits.MaxCompletionTokens {
+			continue
+		}
+		if g.limits.Policy != entities.LimitPolicyTruncate {
+			return false, &entities.RequestError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("%s of %d exceeds the proxy limit of %d tokens", name, requested, g.limits.MaxCompletionTokens),
+				Type:       "invalid_request_error",
+				Code:       "max_tokens_exceeded",
+			}
+		}
+		fields[name] = json.RawMessage(fmt.Sprint(g.limits.MaxCompletionTokens))
+		modified = true
+	}
+	return modified, nil
+}
+
+// enforcePromptLimit rejects the request, or with the truncate policy drops the
+// oldest non-system chat messages until the prompt fits. The last message is always kept.
+func (g *PromptGuard) enforcePromptLimit(fields map[string]json.RawMessage, body []byte, limit int) (bool, error) {
+	tokens := g.counter.CountPromptTokens(body)
+	if tokens <= limit {
+		return false, nil
+	}
+
+	if g.limits.Policy == entities.LimitPolicyTruncate {
+		var messages []json.RawMessage
+		if err := json.Unmarshal(fields["messages"], &messages); err == nil {
+			for tokens > limit {
+				idx := oldestDroppableMessage(messages)
+				if idx < 0 {
+					break
+				}
+				messages = append(messages[:idx], messages[idx+1:]...)
+				encoded, err := json.Marshal(messages)
+				if err != nil {
+					return false, fmt.Errorf("failed to encode truncated messages: %w", err)
+				}
+				fields["messages"] = encoded
+				candidate, err := json.Marshal(fields)
+				if err != nil {
+					return false, fmt.Errorf("failed to encode truncated request: %w", err)
+				}
+				tokens = g.counter.CountPromptTokens(candidate)
+			}
+			if tokens <= limit {
+				return true, nil
+			}
+		}
+	}
+
+	return false, &entities.RequestError{
+		StatusCode: http.StatusBadRequest,
+		Message:    fmt.Sprintf("Estimated prompt size of %d tokens exceeds the proxy limit of %d tokens", tokens, limit),
+		Type:       "invalid_request_error",
+		Code:       "prompt_too_large",
+	}
+}
+
+// oldestDroppableMessage returns the index of the oldest non-system message,
+// excluding the final message, or -1 if none can be dropped
+func oldestDroppableMessage(messages []json.RawMessage) int {
+	for i := 0; i < len(messages)-1; i++ {
+		var msg struct {
+			Role string `json:"role"`
+		}
+		if err := json.Unmarshal(messages[i], &msg); err != nil {
+			continue
+		}
+		if msg.Role != "system" && msg.Role != "developer" {
+			return i
+		}
+	}
+	return -1
+}
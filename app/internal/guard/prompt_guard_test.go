@@ -0,0 +1,104 @@
+package guard_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/guard"
+)
+
+// messageCounter counts 10 tokens per chat message
+type messageCounter struct{}
+
+func (messageCounter) CountPromptTokens(requestBody []byte) int {
+	var req struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	json.Unmarshal(requestBody, &req)
+	return 10 * len(req.Messages)
+}
+
+const chatBody = `{"model":"gpt-4","max_tokens":500,"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`
+
+func TestPromptGuard_Reject(t *testing.T) {
+	g := guard.NewPromptGuard(messageCounter{}, entities.PromptLimits{MaxPromptTokens: 30, Policy: entities.LimitPolicyReject})
+
+	req := &entities.ProxyRequest{Body: []byte(chatBody)}
+	err := g.Filter("s1", req)
+
+	var reqErr *entities.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("Filter() error = %v, want *entities.RequestError", err)
+	}
+	if reqErr.StatusCode != http.StatusBadRequest || reqErr.Code != "prompt_too_large" {
+		t.Errorf("Filter() error = %+v, want 400 prompt_too_large", reqErr)
+	}
+}
+
+func TestPromptGuard_SessionLimitOverridesGlobal(t *testing.T) {
+	g := guard.NewPromptGuard(messageCounter{}, entities.PromptLimits{
+		MaxPromptTokens:        30,
+		SessionMaxPromptTokens: map[string]int{"big": 100},
+	})
+
+	if err := g.Filter("big", &entities.ProxyRequest{Body: []byte(chatBody)}); err != nil {
+		t.Errorf("Filter() for session with higher limit error = %v, want nil", err)
+	}
+	if err := g.Filter("other", &entities.ProxyRequest{Body: []byte(chatBody)}); err == nil {
+		t.Error("Filter() for session without override error = nil, want rejection")
+	}
+}
+
+func TestPromptGuard_Truncate(t *testing.T) {
+	g := guard.NewPromptGuard(messageCounter{}, entities.PromptLimits{
+		MaxPromptTokens:     20,
+		MaxCompletionTokens: 100,
+		Policy:              entities.LimitPolicyTruncate,
+	})
+
+	req := &entities.ProxyRequest{Body: []byte(chatBody)}
+	if err := g.Filter("s1", req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+
+	var got struct {
+		MaxTokens int `json:"max_tokens"`
+		Messages  []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(req.Body, &got); err != nil {
+		t.Fatalf("filtered body is not JSON: %v", err)
+	}
+	if got.MaxTokens != 100 {
+		t.Errorf("max_tokens = %d, want 100", got.MaxTokens)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[1].Content != "c" {
+		t.Errorf("messages = %+v, want system message and last user message", got.Messages)
+	}
+}
+
+func TestPromptGuard_MaxTokensReject(t *testing.T) {
+	g := guard.NewPromptGuard(messageCounter{}, entities.PromptLimits{MaxCompletionTokens: 100})
+
+	err := g.Filter("", &entities.ProxyRequest{Body: []byte(chatBody)})
+	var reqErr *entities.RequestError
+	if !errors.As(err, &reqErr) || reqErr.Code != "max_tokens_exceeded" {
+		t.Errorf("Filter() error = %v, want max_tokens_exceeded", err)
+	}
+}
+
+func TestPromptGuard_NonJSONBody(t *testing.T) {
+	g := guard.NewPromptGuard(messageCounter{}, entities.PromptLimits{MaxPromptTokens: 1})
+	req := &entities.ProxyRequest{Body: []byte("not json")}
+	if err := g.Filter("", req); err != nil {
+		t.Errorf("Filter() on non-JSON body error = %v, want nil", err)
+	}
+	if string(req.Body) != "not json" {
+		t.Errorf("Filter() modified non-JSON body: %q", req.Body)
+	}
+}
@@ -0,0 +1,90 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// chatCompletionsSuffix identifies the chat completions endpoint
+const chatCompletionsSuffix = "/chat/completions"
+
+// PromptInjector prepends configured system prompts and prefix messages to chat
+// completion requests. The template is selected by session tag, falling back to
+// the default template.
+type PromptInjector struct {
+	templates map[string]entities.PromptTemplate
+}
+
+// NewPromptInjector creates a new PromptInjector with templates keyed by session
+// tag; entities.DefaultPolicyTag applies to all other requests.
+func NewPromptInjector(templates map[string]entities.PromptTemplate) *PromptInjector {
+	return &PromptInjector{
+		templates: templates,
+	}
+}
+
+// ParsePromptTemplates parses templates from a JSON object keyed by session tag
+func ParsePromptTemplates(raw string) (map[string]entities.PromptTemplate, error) {
+	var templates map[string]entities.PromptTemplate
+	if err := json.Unmarshal([]byte(raw), &templates); err != nil {
+		return nil, fmt.Errorf("invalid system prompts: %w", err)
+	}
+	return templates, nil
+}
+
+// Filter injects the session's template into a chat completion request body
+func (p *PromptInjector) Filter(sessionID string, req *entities.ProxyRequest) error {
+	if !strings.HasSuffix(req.Path, chatCompletionsSuffix) || len(req.Body) == 0 {
+		return nil
+	}
+	template, ok := p.templateFor(sessionID)
+	if !ok {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(req.Body, &fields); err != nil {
+		// Not a JSON object; leave validation to upstream
+		return nil
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+		return nil
+	}
+
+	injected := make([]json.RawMessage, 0, len(template.Messages)+len(messages)+1)
+	if template.System != "" {
+		system, err := json.Marshal(map[string]string{"role": "system", "content": template.System})
+		if err != nil {
+			return fmt.Errorf("failed to encode system prompt: %w", err)
+		}
+		injected = append(injected, system)
+	}
+	injected = append(injected, template.Messages...)
+	injected = append(injected, messages...)
+
+	encoded, err := json.Marshal(injected)
+	if err != nil {
+		return fmt.Errorf("failed to encode messages: %w", err)
+	}
+	fields["messages"] = encoded
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode request body: %w", err)
+	}
+	req.Body = body
+	return nil
+}
+
+// templateFor returns the template for the session's tag, or the default template
+func (p *PromptInjector) templateFor(sessionID string) (entities.PromptTemplate, bool) {
+	if tag := entities.SessionTag(sessionID); tag != "" {
+		if template, ok := p.templates[tag]; ok {
+			return template, true
+		}
+	}
+	template, ok := p.templates[entities.DefaultPolicyTag]
+	return template, ok
+}
@@ -0,0 +1,73 @@
+package guard_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/guard"
+)
+
+func injectedMessages(t *testing.T, p *guard.PromptInjector, sessionID, path string) []map[string]string {
+	t.Helper()
+	req := &entities.ProxyRequest{
+		Path: path,
+		Body: []byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`),
+	}
+	if err := p.Filter(sessionID, req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+	var body struct {
+		Messages []map[string]string `json:"messages"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("Filter() produced invalid JSON: %v", err)
+	}
+	return body.Messages
+}
+
+func TestPromptInjector_Filter(t *testing.T) {
+	templates, err := guard.ParsePromptTemplates(`{
+		"*":       {"system": "Be polite."},
+		"support": {"system": "You are Acme support.", "messages": [{"role":"user","content":"example"},{"role":"assistant","content":"answer"}]}
+	}`)
+	if err != nil {
+		t.Fatalf("ParsePromptTemplates() error = %v", err)
+	}
+	p := guard.NewPromptInjector(templates)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		path      string
+		want      []string
+	}{
+		{"default template", "s1", "/v1/chat/completions", []string{"Be polite.", "hi"}},
+		{"tagged template", "support:7", "/v1/chat/completions", []string{"You are Acme support.", "example", "answer", "hi"}},
+		{"other endpoint", "s1", "/v1/embeddings", []string{"hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := injectedMessages(t, p, tt.sessionID, tt.path)
+			if len(messages) != len(tt.want) {
+				t.Fatalf("Filter() messages = %v, want contents %v", messages, tt.want)
+			}
+			for i, content := range tt.want {
+				if messages[i]["content"] != content {
+					t.Errorf("Filter() message %d = %v, want content %q", i, messages[i], content)
+				}
+			}
+			if len(tt.want) > 1 && messages[0]["role"] != "system" {
+				t.Errorf("Filter() first message role = %q, want system", messages[0]["role"])
+			}
+		})
+	}
+}
+
+func TestPromptInjector_NoTemplate(t *testing.T) {
+	p := guard.NewPromptInjector(map[string]entities.PromptTemplate{"support": {System: "x"}})
+
+	if messages := injectedMessages(t, p, "s1", "/v1/chat/completions"); len(messages) != 1 {
+		t.Errorf("Filter() messages = %v, want unchanged", messages)
+	}
+}
@@ -0,0 +1,110 @@
+package guard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// summaryPrompt instructs the model condensing dropped messages
+const summaryPrompt = "Summarize the following conversation in a few sentences, keeping every fact, " +
+	"decision and open question a continuation would need. Reply with the summary only."
+
+// Queue processes proxy requests
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// QueueSummarizer condenses chat messages with a cheap model, sending the
+// request through a queue so it respects the upstream's limits
+type QueueSummarizer struct {
+	queue Queue
+	model string
+}
+
+// NewQueueSummarizer creates a new QueueSummarizer using model
+func NewQueueSummarizer(queue Queue, model string) *QueueSummarizer {
+	return &QueueSummarizer{
+		queue: queue,
+		model: model,
+	}
+}
+
+// Summarize returns a summary of the messages of at most maxTokens
+func (s *QueueSummarizer) Summarize(messages []json.RawMessage, maxTokens int) (string, error) {
+	var transcript strings.Builder
+	for _, raw := range messages {
+		var message struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		}
+		if json.Unmarshal(raw, &message) != nil {
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", message.Role, messageText(message.Content))
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":      s.model,
+		"max_tokens": maxTokens,
+		"messages": []map[string]string{
+			{"role": "system", "content": summaryPrompt},
+			{"role": "user", "content": transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp := s.queue.Push(entities.ProxyRequest{
+		Method:  http.MethodPost,
+		Path:    "/v1/chat/completions",
+		Headers: http.Header{"Content-Type": {"application/json"}},
+		Body:    body,
+	})
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("summary model returned status %d", resp.StatusCode)
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.Body, &completion); err != nil {
+		return "", fmt.Errorf("invalid summary response: %w", err)
+	}
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
+		return "", errors.New("summary model returned no content")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// messageText returns the text of message content, a string or an array of parts
+func messageText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(content, &parts)
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		} else if part.Type != "" {
+			texts = append(texts, "["+part.Type+"]")
+		}
+	}
+	return strings.Join(texts, " ")
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+// AdminHandler serves administrative endpoints on the dedicated admin listener.
+// All routes registered on it share the same token-based authentication. The
+// token is accepted as a bearer token or, for browsers opening the dashboard,
+// as the password of HTTP Basic authentication.
+type AdminHandler struct {
+	mux     *http.ServeMux
+	handler http.Handler
+}
+
+// NewAdminHandler creates a new AdminHandler protected by the given token.
+// An empty token disables authentication.
+func NewAdminHandler(token string) *AdminHandler {
+	mux := http.NewServeMux()
+	return &AdminHandler{
+		mux:     mux,
+		handler: middleware.Chain(mux, middleware.TokenAuth(token, "admin")),
+	}
+}
+
+// Handle registers an admin route
+func (ah *AdminHandler) Handle(pattern string, handler http.Handler) {
+	ah.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP authenticates the request and dispatches it to the registered routes
+func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ah.handler.ServeHTTP(w, r)
+}
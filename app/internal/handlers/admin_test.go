@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler_Auth(t *testing.T) {
+	tests := []struct {
+		name               string
+		token              string
+		authHeader         string
+		expectedStatusCode int
+	}{
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"non-bearer scheme", "secret", "Digest secret", http.StatusUnauthorized},
+		{"malformed basic credentials", "secret", "Basic secret", http.StatusUnauthorized},
+		{"basic password", "secret", "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:secret")), http.StatusOK},
+		{"wrong basic password", "secret", "Basic " + base64.StdEncoding.EncodeToString([]byte("secret:wrong")), http.StatusUnauthorized},
+		{"auth disabled", "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewAdminHandler(tt.token)
+			handler.Handle("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatusCode {
+				t.Errorf("AdminHandler status code = %v, want %v", rr.Code, tt.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_UnknownRoute(t *testing.T) {
+	handler := NewAdminHandler("")
+	req := httptest.NewRequest(http.MethodGet, "/v1/chat/completions", nil)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("AdminHandler status code = %v, want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+type BackupStore interface {
+	Backup(path string) error
+}
+
+// BackupHandler downloads snapshots of the database for disaster recovery
+type BackupHandler struct {
+	store BackupStore
+	now   func() time.Time
+}
+
+// NewBackupHandler creates a new BackupHandler with injected dependencies
+func NewBackupHandler(store BackupStore) *BackupHandler {
+	return &BackupHandler{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Handle writes a snapshot to a temporary file and returns it as an
+// attachment, which `llm-queue-proxy restore` accepts
+func (bh *BackupHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	snapshot, err := bh.snapshot()
+	if err != nil {
+		log.Printf("Error backing up database: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(snapshot.Name())
+	defer snapshot.Close()
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="llm-queue-proxy-%s.db"`, bh.now().UTC().Format("20060102T150405Z")))
+	if info, err := snapshot.Stat(); err == nil {
+		w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	}
+	if _, err := io.Copy(w, snapshot); err != nil {
+		log.Printf("Error sending backup: %v", err)
+	}
+}
+
+// snapshot backs the database up to a temporary file and opens it for reading
+func (bh *BackupHandler) snapshot() (*os.File, error) {
+	tmp, err := os.CreateTemp("", "llm-queue-proxy-backup-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	if err := bh.store.Backup(tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	snapshot, err := os.Open(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return snapshot, nil
+}
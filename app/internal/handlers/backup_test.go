@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// backupFunc adapts a function to BackupStore
+type backupFunc func(path string) error
+
+func (f backupFunc) Backup(path string) error { return f(path) }
+
+func TestBackupHandler_Handle(t *testing.T) {
+	var snapshotPath string
+	handler := NewBackupHandler(backupFunc(func(path string) error {
+		snapshotPath = path
+		return os.WriteFile(path, []byte("SQLite format 3"), 0o600)
+	}))
+	handler.now = func() time.Time { return time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC) }
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "SQLite format 3" {
+		t.Fatalf("Handle() = %d %q, want the snapshot", rr.Code, rr.Body.String())
+	}
+	if got, want := rr.Header().Get("Content-Disposition"), `attachment; filename="llm-queue-proxy-20240501T123000Z.db"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(snapshotPath); !os.IsNotExist(err) {
+		t.Errorf("temporary snapshot %s was not removed: %v", snapshotPath, err)
+	}
+
+	handler = NewBackupHandler(backupFunc(func(string) error { return errors.New("disk full") }))
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/backup", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Handle() with a failing backup status code = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/backup", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Handle() POST status code = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
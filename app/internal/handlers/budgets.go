@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// defaultTransferLimit and maxTransferLimit bound the transfers listed
+const (
+	defaultTransferLimit = 100
+	maxTransferLimit     = 1000
+)
+
+// BudgetLedger resolves and moves the token budgets of sessions and tags
+type BudgetLedger interface {
+	Allocations() ([]entities.BudgetAllocation, error)
+	Transfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error)
+	Transfers(limit int) ([]entities.BudgetTransfer, error)
+}
+
+// BudgetsHandler serves the token budgets and their transfers
+type BudgetsHandler struct {
+	ledger BudgetLedger
+}
+
+// NewBudgetsHandler creates a new BudgetsHandler with injected dependencies
+func NewBudgetsHandler(ledger BudgetLedger) *BudgetsHandler {
+	return &BudgetsHandler{
+		ledger: ledger,
+	}
+}
+
+// HandleBudgets returns the budget of every configured key and of every key
+// party to a transfer
+func (bh *BudgetsHandler) HandleBudgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	allocations, err := bh.ledger.Allocations()
+	if err != nil {
+		log.Printf("Error listing budgets: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, allocations)
+}
+
+// HandleTransfers lists the most recent transfers on GET, ?limit= how many,
+// and moves budget on POST with a JSON body of from, to, tokens and reason
+func (bh *BudgetsHandler) HandleTransfers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		limit := defaultTransferLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(parsed, maxTransferLimit)
+		}
+		transfers, err := bh.ledger.Transfers(limit)
+		if err != nil {
+			log.Printf("Error listing budget transfers: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, transfers)
+	case http.MethodPost:
+		var request struct {
+			From   string `json:"from"`
+			To     string `json:"to"`
+			Tokens int    `json:"tokens"`
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		transfer, err := bh.ledger.Transfer(entities.BudgetTransfer{
+			From:   request.From,
+			To:     request.To,
+			Tokens: request.Tokens,
+			Reason: request.Reason,
+		})
+		if errors.Is(err, entities.ErrInvalidBudgetTransfer) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error transferring budget: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Transferred %d tokens of budget from %s to %s", transfer.Tokens, transfer.From, transfer.To)
+		writeJSON(w, http.StatusCreated, transfer)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/budget"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestBudgetsHandler(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	ledger := budget.NewLedger(entities.SessionBudgets{Sessions: map[string]int{"batch": 5000, "interactive": 1000}}, repo)
+	handler := NewBudgetsHandler(ledger)
+	transfer := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.HandleTransfers(rec, httptest.NewRequest(http.MethodPost, "/budgets/transfers", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := transfer(`{"from":"batch","to":"interactive","tokens":2000,"reason":"launch"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d, body %s", rec.Code, rec.Body)
+	}
+	var created entities.BudgetTransfer
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Errorf("POST body = %s, want the stored transfer", rec.Body)
+	}
+	for _, body := range []string{`{"from":"batch","to":"interactive","tokens":3000}`, `{"from":"batch"`} {
+		if rec := transfer(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleTransfers(rec, httptest.NewRequest(http.MethodGet, "/budgets/transfers?limit=5", nil))
+	var transfers []entities.BudgetTransfer
+	if err := json.Unmarshal(rec.Body.Bytes(), &transfers); err != nil || len(transfers) != 1 || transfers[0].Reason != "launch" {
+		t.Errorf("GET /budgets/transfers = %s, want the transfer", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleBudgets(rec, httptest.NewRequest(http.MethodGet, "/budgets", nil))
+	var allocations []entities.BudgetAllocation
+	if err := json.Unmarshal(rec.Body.Bytes(), &allocations); err != nil {
+		t.Fatalf("GET /budgets body %s: %v", rec.Body, err)
+	}
+	want := []entities.BudgetAllocation{
+		{Key: "batch", Configured: 5000, Transferred: -2000, Budget: 3000},
+		{Key: "interactive", Configured: 1000, Transferred: 2000, Budget: 3000},
+	}
+	if len(allocations) != 2 || allocations[0] != want[0] || allocations[1] != want[1] {
+		t.Errorf("GET /budgets = %+v, want %+v", allocations, want)
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type CacheStatsSource interface {
+	Stats() entities.CacheStats
+}
+
+// CacheStatsHandler reports cache hit rate and tokens saved
+type CacheStatsHandler struct {
+	cache CacheStatsSource
+}
+
+// NewCacheStatsHandler creates a new CacheStatsHandler with injected dependencies
+func NewCacheStatsHandler(cache CacheStatsSource) *CacheStatsHandler {
+	return &CacheStatsHandler{
+		cache: cache,
+	}
+}
+
+// Handle returns the current cache statistics
+func (ch *CacheStatsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ch.cache.Stats()); err != nil {
+		log.Printf("Error encoding cache stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// DashboardHandler serves a single-page dashboard of the queues, top sessions,
+// recent errors and counters. The page polls the admin JSON endpoints it is
+// served next to, so it needs no configuration of its own.
+type DashboardHandler struct{}
+
+// NewDashboardHandler creates a new DashboardHandler
+func NewDashboardHandler() *DashboardHandler {
+	return &DashboardHandler{}
+}
+
+// Handle returns the dashboard page
+func (dh *DashboardHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	w.Write(dashboardPage)
+}
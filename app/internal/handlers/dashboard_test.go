@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler_Handle(t *testing.T) {
+	handler := NewDashboardHandler()
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Handle() = %d %q, want 200 text/html", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	// The page polls the admin endpoints relative to /dashboard
+	for _, endpoint := range []string{`"queues"`, `"sessions/summary?limit=10"`, `"history?limit=500"`, `"metrics"`} {
+		if !strings.Contains(rr.Body.String(), endpoint) {
+			t.Errorf("dashboard does not poll %s", endpoint)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/dashboard", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
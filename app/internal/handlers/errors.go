@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+)
+
+// writeRequestError writes a proxy rejection in the OpenAI error envelope format
+func writeRequestError(w http.ResponseWriter, reqErr *entities.RequestError) {
+	httperr.Write(w, reqErr)
+}
+
+// writeError writes a proxy-generated error in the OpenAI error envelope format
+func writeError(w http.ResponseWriter, statusCode int, message, errType, code string) {
+	writeRequestError(w, &entities.RequestError{
+		StatusCode: statusCode,
+		Message:    message,
+		Type:       errType,
+		Code:       code,
+	})
+}
+
+// upstreamErrorMessage extracts the message of an upstream error response.
+// It returns an empty string for successful responses and bodies that are
+// not in the OpenAI error envelope format.
+func upstreamErrorMessage(statusCode int, body []byte) string {
+	if statusCode < 400 {
+		return ""
+	}
+	var envelope entities.ErrorResponse
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return ""
+	}
+	return envelope.Error.Message
+}
+
+// upstreamError returns the message and type of an upstream error response,
+// taken from its classification if the queue classified it. The type is
+// empty for unclassified responses.
+func upstreamError(resp entities.ProxyResponse) (message, errType string) {
+	if resp.UpstreamError != nil {
+		return resp.UpstreamError.Message, resp.UpstreamError.Type
+	}
+	return upstreamErrorMessage(resp.StatusCode, resp.Body), ""
+}
+
+// queueError maps an error returned for a queued request to the error reported to the client
+func queueError(err error) *entities.RequestError {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &entities.RequestError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    fmt.Sprintf("Upload exceeds the maximum size of %d bytes", maxBytesErr.Limit),
+			Type:       "invalid_request_error",
+			Code:       "request_too_large",
+		}
+	case errors.Is(err, entities.ErrQueueFull):
+		return &entities.RequestError{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    "Proxy queue is full: " + err.Error(),
+			Type:       "rate_limit_error",
+			Code:       "queue_full",
+		}
+	case errors.Is(err, entities.ErrQueueClosed):
+		return &entities.RequestError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Proxy is shutting down, retry the request",
+			Type:       "server_error",
+			Code:       "queue_closed",
+		}
+	case errors.Is(err, entities.ErrBudgetExceeded):
+		return &entities.RequestError{
+			StatusCode: http.StatusTooManyRequests,
+			Message:    "Token budget exceeded: " + err.Error(),
+			Type:       "insufficient_quota",
+			Code:       "budget_exceeded",
+		}
+	case errors.Is(err, entities.ErrResidencyViolation):
+		return &entities.RequestError{
+			StatusCode: http.StatusForbidden,
+			Message:    "Request refused by the data residency policy: " + err.Error(),
+			Type:       "permission_error",
+			Code:       "residency_violation",
+		}
+	default:
+		return &entities.RequestError{
+			StatusCode: http.StatusBadGateway,
+			Message:    "Proxy error: " + err.Error(),
+			Type:       "server_error",
+			Code:       "upstream_error",
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// PromptCounter counts the prompt tokens of a request body
+type PromptCounter interface {
+	CountPromptTokens(requestBody []byte) int
+}
+
+// EstimateHandler prices a request body locally, without sending it upstream,
+// so clients can preview its cost
+type EstimateHandler struct {
+	counter      PromptCounter
+	pricer       Pricer
+	maxBodyBytes int64
+}
+
+// NewEstimateHandler creates a new EstimateHandler. Bodies larger than
+// maxBodyBytes are rejected; zero means no limit.
+func NewEstimateHandler(counter PromptCounter, pricer Pricer, maxBodyBytes int64) *EstimateHandler {
+	return &EstimateHandler{
+		counter:      counter,
+		pricer:       pricer,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Handle estimates the cost of the request body it is posted, which is the
+// body the client would send to a completion, chat or embeddings endpoint
+func (eh *EstimateHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+	if eh.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, eh.maxBodyBytes)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "Request body too large", "invalid_request_error", "request_too_large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error(), "invalid_request_error", "")
+		return
+	}
+	var limits struct {
+		Model               string `json:"model"`
+		MaxTokens           int    `json:"max_tokens"`
+		MaxCompletionTokens int    `json:"max_completion_tokens"`
+		MaxOutputTokens     int    `json:"max_output_tokens"`
+	}
+	if err := json.Unmarshal(raw, &limits); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body must be a JSON object", "invalid_request_error", "")
+		return
+	}
+
+	estimate := entities.CostEstimate{
+		Model:        limits.Model,
+		PromptTokens: eh.counter.CountPromptTokens(raw),
+	}
+	// max_completion_tokens supersedes max_tokens in chat completions, and
+	// the Responses API names its limit max_output_tokens
+	for _, limit := range []int{limits.MaxCompletionTokens, limits.MaxOutputTokens, limits.MaxTokens} {
+		if limit > 0 {
+			estimate.MaxCompletionTokens = limit
+			break
+		}
+	}
+	estimate.PromptCost = eh.pricer.Cost(estimate.Model, entities.TokenUsage{PromptTokens: estimate.PromptTokens})
+	estimate.MaxCompletionCost = eh.pricer.Cost(estimate.Model, entities.TokenUsage{CompletionTokens: estimate.MaxCompletionTokens})
+	estimate.EstimatedCost = estimate.PromptCost + estimate.MaxCompletionCost
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(estimate); err != nil {
+		log.Printf("Error encoding cost estimate: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type fakePromptCounter int
+
+func (f fakePromptCounter) CountPromptTokens(requestBody []byte) int {
+	return int(f)
+}
+
+func TestEstimateHandler(t *testing.T) {
+	pricer := pricerFunc(func(model string, usage entities.TokenUsage) float64 {
+		if model == "gpt-4o" {
+			return float64(usage.PromptTokens)*0.25 + float64(usage.CompletionTokens)*1
+		}
+		return float64(usage.PromptTokens+usage.CompletionTokens) * 0.5
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		want       entities.CostEstimate
+	}{
+		{"chat completion with limit", http.MethodPost, `{"model":"gpt-4o","messages":[{"role":"user","content":"Hello"}],"max_completion_tokens":10,"max_tokens":99}`,
+			http.StatusOK, entities.CostEstimate{Model: "gpt-4o", PromptTokens: 8, MaxCompletionTokens: 10, PromptCost: 2, MaxCompletionCost: 10, EstimatedCost: 12}},
+		{"responses api limit", http.MethodPost, `{"model":"gpt-4o","input":"Hello","max_output_tokens":4}`,
+			http.StatusOK, entities.CostEstimate{Model: "gpt-4o", PromptTokens: 8, MaxCompletionTokens: 4, PromptCost: 2, MaxCompletionCost: 4, EstimatedCost: 6}},
+		{"no limit", http.MethodPost, `{"model":"text-embedding-3-small","input":"Hello"}`,
+			http.StatusOK, entities.CostEstimate{Model: "text-embedding-3-small", PromptTokens: 8, PromptCost: 4, EstimatedCost: 4}},
+		{"invalid JSON", http.MethodPost, `{"model":`, http.StatusBadRequest, entities.CostEstimate{}},
+		{"not an object", http.MethodPost, `["gpt-4o"]`, http.StatusBadRequest, entities.CostEstimate{}},
+		{"too large", http.MethodPost, `{"model":"gpt-4o","input":"` + strings.Repeat("a", 200) + `"}`, http.StatusRequestEntityTooLarge, entities.CostEstimate{}},
+		{"wrong method", http.MethodGet, ``, http.StatusMethodNotAllowed, entities.CostEstimate{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewEstimateHandler(fakePromptCounter(8), pricer, 128)
+			rr := httptest.NewRecorder()
+			handler.Handle(rr, httptest.NewRequest(tt.method, "/v1/estimate", strings.NewReader(tt.body)))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				var errResp entities.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil || errResp.Error.Message == "" {
+					t.Errorf("body = %q, want an error envelope", rr.Body.String())
+				}
+				return
+			}
+			var got entities.CostEstimate
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode estimate: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("estimate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
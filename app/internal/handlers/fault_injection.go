@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type FaultRules interface {
+	Rules() []entities.FaultRule
+	SetRules(rules []entities.FaultRule) error
+}
+
+// FaultInjectionHandler manages the fault injection rules
+type FaultInjectionHandler struct {
+	rules FaultRules
+}
+
+// NewFaultInjectionHandler creates a new FaultInjectionHandler with injected dependencies
+func NewFaultInjectionHandler(rules FaultRules) *FaultInjectionHandler {
+	return &FaultInjectionHandler{
+		rules: rules,
+	}
+}
+
+// Handle returns the active rules on GET, replaces them with a JSON array of
+// rules on PUT and removes them all on DELETE
+func (fh *FaultInjectionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var rules []entities.FaultRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "Body must be a JSON array of fault rules", http.StatusBadRequest)
+			return
+		}
+		if err := fh.rules.SetRules(rules); err != nil {
+			http.Error(w, "Invalid fault rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if err := fh.rules.SetRules(nil); err != nil {
+			log.Printf("Error clearing fault rules: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fh.rules.Rules()); err != nil {
+		log.Printf("Error encoding fault rules: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type memoryFaultRules struct {
+	rules []entities.FaultRule
+}
+
+func (m *memoryFaultRules) Rules() []entities.FaultRule {
+	return append([]entities.FaultRule{}, m.rules...)
+}
+
+func (m *memoryFaultRules) SetRules(rules []entities.FaultRule) error {
+	for _, rule := range rules {
+		if rule.SessionTag == "" && rule.VirtualKeyID == "" {
+			return errors.New("session_tag or virtual_key_id is required")
+		}
+	}
+	m.rules = rules
+	return nil
+}
+
+func TestFaultInjectionHandler_Handle(t *testing.T) {
+	rules := &memoryFaultRules{}
+	handler := NewFaultInjectionHandler(rules)
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(method, "/chaos", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodPut, `[{"session_tag":"ci","error_percent":25,"latency_ms":500}]`)
+	var got []entities.FaultRule
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); rec.Code != http.StatusOK || err != nil ||
+		len(got) != 1 || got[0].SessionTag != "ci" || got[0].ErrorPercent != 25 || got[0].LatencyMs != 500 {
+		t.Fatalf("PUT = %d %s, want the new rules", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"session_tag":"ci"`) {
+		t.Errorf("GET = %s, want the active rules", rec.Body.String())
+	}
+	for _, body := range []string{`{"session_tag":"ci"}`, `[{"error_percent":25}]`} {
+		if rec := serve(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if rec := serve(http.MethodDelete, ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" || len(rules.rules) != 0 {
+		t.Errorf("DELETE = %d %s, want no rules left", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "[]"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// heartbeat is an SSE comment, which clients ignore but which keeps idle
+// connections from being closed by load balancers
+const heartbeat = ": keep-alive\n\n"
+
+// wantsStream reports whether a JSON request body asks for a streamed response
+func wantsStream(body []byte) bool {
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(body, &req) == nil && req.Stream
+}
+
+// pushWithHeartbeats pushes a request and, while it waits, writes a heartbeat
+// every interval. The first heartbeat commits a 200 event stream response, so
+// it reports whether the response headers were sent.
+func (ph *ProxyHandler) pushWithHeartbeats(w http.ResponseWriter, req entities.ProxyRequest, interval time.Duration) (entities.ProxyResponse, bool) {
+	done := make(chan entities.ProxyResponse, 1)
+	go func() {
+		done <- ph.queue.Push(req)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	rc := http.NewResponseController(w)
+	started := false
+	for {
+		select {
+		case resp := <-done:
+			return resp, started
+		case <-ticker.C:
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.Header().Set("X-Accel-Buffering", "no")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			// A client that went away still gets its response accounted for
+			io.WriteString(w, heartbeat)
+			if err := rc.Flush(); err != nil {
+				log.Printf("Error flushing heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// writeStreamedResponse writes a response after heartbeats were sent. The
+// status line is already gone, so errors become an SSE event with the error
+// envelope, which OpenAI clients raise.
+func writeStreamedResponse(w http.ResponseWriter, resp entities.ProxyResponse) {
+	switch {
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= 300:
+		var event bytes.Buffer
+		if json.Compact(&event, resp.Body) != nil {
+			event.Reset()
+			message, errType := upstreamError(resp)
+			if errType == "" {
+				errType = "upstream_error"
+			}
+			json.NewEncoder(&event).Encode(entities.NewErrorResponse(message, errType, ""))
+		}
+		writeEvent(w, event.Bytes())
+	case strings.HasPrefix(resp.Headers.Get("Content-Type"), "text/event-stream"):
+		w.Write(resp.Body)
+	default:
+		// Events are single lines, so JSON bodies are compacted
+		var event bytes.Buffer
+		if json.Compact(&event, resp.Body) != nil {
+			event.Reset()
+			event.Write(resp.Body)
+		}
+		writeEvent(w, event.Bytes())
+	}
+}
+
+// writeStreamError writes a proxy-generated error as an SSE event
+func writeStreamError(w http.ResponseWriter, reqErr *entities.RequestError) {
+	event, err := json.Marshal(reqErr.Envelope())
+	if err != nil {
+		log.Printf("Error encoding error response: %v", err)
+		return
+	}
+	writeEvent(w, event)
+}
+
+func writeEvent(w http.ResponseWriter, data []byte) {
+	w.Write([]byte("data: "))
+	w.Write(bytes.TrimSpace(data))
+	w.Write([]byte("\n\n"))
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestProxyHandler_Heartbeats(t *testing.T) {
+	const stream = "data: {\"choices\":[]}\n\ndata: [DONE]\n\n"
+	tests := []struct {
+		name        string
+		body        string
+		wait        time.Duration
+		resp        entities.ProxyResponse
+		wantStatus  int
+		wantBeats   bool
+		wantSuffix  string
+		wantContent string
+	}{
+		{
+			name:        "slow streaming request",
+			body:        `{"stream":true}`,
+			wait:        60 * time.Millisecond,
+			resp:        entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{"Content-Type": {"text/event-stream"}}, Body: []byte(stream)},
+			wantStatus:  http.StatusOK,
+			wantBeats:   true,
+			wantSuffix:  stream,
+			wantContent: "text/event-stream",
+		},
+		{
+			name:       "upstream error after heartbeats",
+			body:       `{"stream":true}`,
+			wait:       60 * time.Millisecond,
+			resp:       entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Headers: http.Header{}, Body: []byte("{\n \"error\": {\"message\": \"slow down\"}\n}")},
+			wantStatus: http.StatusOK,
+			wantBeats:  true,
+			wantSuffix: "data: {\"error\":{\"message\":\"slow down\"}}\n\n",
+		},
+		{
+			name:       "queue error after heartbeats",
+			body:       `{"stream":true}`,
+			wait:       60 * time.Millisecond,
+			resp:       entities.ProxyResponse{Err: errors.New("connection refused")},
+			wantStatus: http.StatusOK,
+			wantBeats:  true,
+			wantSuffix: "\"code\":\"upstream_error\"}}\n\n",
+		},
+		{
+			name:        "fast streaming request",
+			body:        `{"stream":true}`,
+			resp:        entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Headers: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"error":{}}`)},
+			wantStatus:  http.StatusTooManyRequests,
+			wantSuffix:  `{"error":{}}`,
+			wantContent: "application/json",
+		},
+		{
+			name:        "slow non-streaming request",
+			body:        `{"stream":false}`,
+			wait:        60 * time.Millisecond,
+			resp:        entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{}`)},
+			wantStatus:  http.StatusOK,
+			wantSuffix:  `{}`,
+			wantContent: "application/json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				time.Sleep(tt.wait)
+				return tt.resp
+			}}
+			proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{HeartbeatInterval: 10 * time.Millisecond})
+
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+			body := rr.Body.String()
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := strings.HasPrefix(body, heartbeat); got != tt.wantBeats {
+				t.Errorf("body starts with a heartbeat = %v, want %v: %q", got, tt.wantBeats, body)
+			}
+			if !strings.HasSuffix(body, tt.wantSuffix) {
+				t.Errorf("body = %q, want it to end with %q", body, tt.wantSuffix)
+			}
+			if tt.wantContent != "" && rr.Header().Get("Content-Type") != tt.wantContent {
+				t.Errorf("Content-Type = %q, want %q", rr.Header().Get("Content-Type"), tt.wantContent)
+			}
+		})
+	}
+}
+
+func Test_wantsStream(t *testing.T) {
+	tests := map[string]bool{
+		`{"stream":true,"model":"gpt-4o"}`: true,
+		`{"stream":false}`:                 false,
+		`{"model":"gpt-4o"}`:               false,
+		`not json`:                         false,
+	}
+	for body, want := range tests {
+		if got := wantsStream([]byte(body)); got != want {
+			t.Errorf("wantsStream(%s) = %v, want %v", body, got, want)
+		}
+	}
+}
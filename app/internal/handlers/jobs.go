@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type JobRunner interface {
+	Submit(job entities.Job) (*entities.Job, error)
+	Get(id string) (*entities.Job, error)
+}
+
+// JobsHandler handles asynchronous job submission and polling
+type JobsHandler struct {
+	runner   JobRunner
+	settings entities.ProxySettings
+	filters  []RequestFilter
+	// maintenance rejects submissions while maintenance is on; submitted
+	// jobs still run
+	maintenance MaintenanceMode
+}
+
+// NewJobsHandler creates a new JobsHandler. Filters are applied to every
+// submitted request body, as for synchronous requests.
+func NewJobsHandler(runner JobRunner, settings entities.ProxySettings, filters ...RequestFilter) *JobsHandler {
+	return &JobsHandler{
+		runner:   runner,
+		settings: settings,
+		filters:  filters,
+	}
+}
+
+// WithMaintenance makes the handler reject new jobs while maintenance is on
+func (jh *JobsHandler) WithMaintenance(mode MaintenanceMode) *JobsHandler {
+	jh.maintenance = mode
+	return jh
+}
+
+// HandleSubmit enqueues a request as a job and returns its ID immediately
+func (jh *JobsHandler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeRequestError(w, &entities.RequestError{
+			StatusCode: http.StatusMethodNotAllowed,
+			Message:    "Method not allowed",
+			Type:       "invalid_request_error",
+		})
+		return
+	}
+	if rejectForMaintenance(w, jh.maintenance) {
+		return
+	}
+
+	if jh.settings.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, jh.settings.MaxBodyBytes)
+	}
+	var jobReq entities.JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&jobReq); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeRequestError(w, &entities.RequestError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Message:    "Request body too large",
+				Type:       "invalid_request_error",
+			})
+			return
+		}
+		writeRequestError(w, &entities.RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid job request: " + err.Error(),
+			Type:       "invalid_request_error",
+		})
+		return
+	}
+	if reqErr := jobReq.Validate(); reqErr != nil {
+		writeRequestError(w, reqErr)
+		return
+	}
+
+	headers := r.Header.Clone()
+	// The result is stored and polled later, so ask upstream for an uncompressed body
+	headers.Del("Accept-Encoding")
+	headers.Del("Content-Length")
+	if len(jobReq.Body) > 0 {
+		headers.Set("Content-Type", "application/json")
+	}
+
+	tenantID := entities.TenantFromContext(r.Context())
+	sessionID := entities.TenantSessionID(tenantID, jobReq.SessionID)
+	proxyReq := entities.ProxyRequest{
+		SessionID:    sessionID,
+		TenantID:     tenantID,
+		VirtualKeyID: entities.VirtualKeyFromContext(r.Context()),
+		Method:       jobReq.Method,
+		Path:         jobReq.Path,
+		Headers:      headers,
+		Body:         jobReq.Body,
+	}
+	for _, filter := range jh.filters {
+		if err := filter.Filter(sessionID, &proxyReq); err != nil {
+			var reqErr *entities.RequestError
+			if errors.As(err, &reqErr) {
+				writeRequestError(w, reqErr)
+				return
+			}
+			log.Printf("Request filter error: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to process request", "server_error", "internal_error")
+			return
+		}
+	}
+
+	job, err := jh.runner.Submit(entities.Job{
+		SessionID:      jobReq.SessionID,
+		TenantID:       tenantID,
+		VirtualKeyID:   proxyReq.VirtualKeyID,
+		Method:         proxyReq.Method,
+		Path:           proxyReq.Path,
+		RequestHeaders: proxyReq.Headers,
+		RequestBody:    proxyReq.Body,
+	})
+	if err != nil {
+		log.Printf("Error submitting job: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to submit job", "server_error", "internal_error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding job: %v", err)
+	}
+}
+
+// HandleGet returns the status of a job and, once completed, its result
+func (jh *JobsHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeRequestError(w, &entities.RequestError{
+			StatusCode: http.StatusMethodNotAllowed,
+			Message:    "Method not allowed",
+			Type:       "invalid_request_error",
+		})
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+	if id == "" || strings.Contains(id, "/") {
+		writeRequestError(w, &entities.RequestError{
+			StatusCode: http.StatusNotFound,
+			Message:    "Job not found",
+			Type:       "invalid_request_error",
+			Code:       "job_not_found",
+		})
+		return
+	}
+
+	job, err := jh.runner.Get(id)
+	if err == nil && job.TenantID != entities.TenantFromContext(r.Context()) {
+		// Jobs of other tenants are indistinguishable from unknown jobs
+		err = entities.ErrJobNotFound
+	}
+	if err != nil {
+		if errors.Is(err, entities.ErrJobNotFound) {
+			writeRequestError(w, &entities.RequestError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Job not found",
+				Type:       "invalid_request_error",
+				Code:       "job_not_found",
+			})
+			return
+		}
+		log.Printf("Error getting job %s: %v", id, err)
+		writeError(w, http.StatusInternalServerError, "Failed to get job", "server_error", "internal_error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entities.JobStatusResponse{Job: job, Result: job.Result()}); err != nil {
+		log.Printf("Error encoding job: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type mockJobRunner struct {
+	submitted *entities.Job
+	jobs      map[string]*entities.Job
+}
+
+func (m *mockJobRunner) Submit(job entities.Job) (*entities.Job, error) {
+	job.ID = "job_1"
+	job.Status = entities.JobStatusQueued
+	m.submitted = &job
+	return &job, nil
+}
+
+func (m *mockJobRunner) Get(id string) (*entities.Job, error) {
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, entities.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func TestJobsHandler_HandleSubmit(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		body               string
+		filters            []RequestFilter
+		expectedStatusCode int
+		expectedPath       string
+	}{
+		{"valid job", http.MethodPost, `{"path":"/v1/chat/completions","session_id":"s1","body":{"model":"gpt-4o"}}`, nil, http.StatusAccepted, "/v1/chat/completions"},
+		{"invalid json", http.MethodPost, `{`, nil, http.StatusBadRequest, ""},
+		{"non-upstream path", http.MethodPost, `{"path":"/v1/jobs"}`, nil, http.StatusBadRequest, ""},
+		{"session path", http.MethodPost, `{"path":"/v1/session/s1/chat/completions"}`, nil, http.StatusBadRequest, ""},
+		{"wrong method", http.MethodGet, ``, nil, http.StatusMethodNotAllowed, ""},
+		{"rejected by filter", http.MethodPost, `{"path":"/v1/chat/completions","body":{}}`, []RequestFilter{&rejectingFilter{err: &entities.RequestError{StatusCode: http.StatusBadRequest, Message: "rejected"}}}, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &mockJobRunner{}
+			handler := NewJobsHandler(runner, entities.ProxySettings{MaxBodyBytes: 1 << 20}, tt.filters...)
+
+			req := httptest.NewRequest(tt.method, "/v1/jobs", strings.NewReader(tt.body))
+			req.Header.Set("Accept-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+
+			handler.HandleSubmit(rr, req)
+
+			if rr.Code != tt.expectedStatusCode {
+				t.Fatalf("HandleSubmit status code = %v, want %v, body: %s", rr.Code, tt.expectedStatusCode, rr.Body.String())
+			}
+			if tt.expectedPath == "" {
+				if runner.submitted != nil {
+					t.Errorf("HandleSubmit submitted %+v, want no job", runner.submitted)
+				}
+				return
+			}
+			if runner.submitted == nil || runner.submitted.Path != tt.expectedPath || runner.submitted.Method != http.MethodPost {
+				t.Fatalf("submitted job = %+v, want POST %s", runner.submitted, tt.expectedPath)
+			}
+			if runner.submitted.RequestHeaders.Get("Accept-Encoding") != "" {
+				t.Error("submitted job kept Accept-Encoding, want it removed")
+			}
+			if rr.Header().Get("Location") != "/v1/jobs/job_1" {
+				t.Errorf("Location = %q, want /v1/jobs/job_1", rr.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestJobsHandler_HandleGet(t *testing.T) {
+	runner := &mockJobRunner{jobs: map[string]*entities.Job{
+		"job_done": {ID: "job_done", Status: entities.JobStatusCompleted, ResponseStatus: http.StatusOK, ResponseBody: []byte(`{"id":"chatcmpl-1"}`)},
+		"job_text": {ID: "job_text", Status: entities.JobStatusCompleted, ResponseStatus: http.StatusOK, ResponseBody: []byte("plain text")},
+		"job_wait": {ID: "job_wait", Status: entities.JobStatusRunning},
+	}}
+	handler := NewJobsHandler(runner, entities.ProxySettings{})
+
+	tests := []struct {
+		name               string
+		path               string
+		expectedStatusCode int
+		expectedResult     string
+	}{
+		{"completed json", "/v1/jobs/job_done", http.StatusOK, `{"id":"chatcmpl-1"}`},
+		{"completed text", "/v1/jobs/job_text", http.StatusOK, `"plain text"`},
+		{"running", "/v1/jobs/job_wait", http.StatusOK, ""},
+		{"unknown", "/v1/jobs/job_missing", http.StatusNotFound, ""},
+		{"empty id", "/v1/jobs/", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+
+			handler.HandleGet(rr, req)
+
+			if rr.Code != tt.expectedStatusCode {
+				t.Fatalf("HandleGet status code = %v, want %v", rr.Code, tt.expectedStatusCode)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Status string          `json:"status"`
+				Result json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("HandleGet returned invalid JSON: %v", err)
+			}
+			if string(resp.Result) != tt.expectedResult {
+				t.Errorf("HandleGet result = %s, want %s", resp.Result, tt.expectedResult)
+			}
+		})
+	}
+}
+
+func TestJobsHandler_TenantScoped(t *testing.T) {
+	runner := &mockJobRunner{jobs: map[string]*entities.Job{
+		"job_acme": {ID: "job_acme", Status: entities.JobStatusRunning, TenantID: "acme"},
+	}}
+	handler := NewJobsHandler(runner, entities.ProxySettings{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(`{"path":"/v1/chat/completions","session_id":"s1","body":{}}`))
+	req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+	rr := httptest.NewRecorder()
+	handler.HandleSubmit(rr, req)
+	if rr.Code != http.StatusAccepted || runner.submitted.TenantID != "acme" || runner.submitted.SessionID != "s1" {
+		t.Fatalf("HandleSubmit status = %d, submitted %+v, want the job of tenant acme with its own session ID", rr.Code, runner.submitted)
+	}
+
+	for tenantID, want := range map[string]int{"acme": http.StatusOK, "beta": http.StatusNotFound, "": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/jobs/job_acme", nil)
+		req = req.WithContext(entities.ContextWithTenant(req.Context(), tenantID))
+		rr := httptest.NewRecorder()
+		handler.HandleGet(rr, req)
+		if rr.Code != want {
+			t.Errorf("HandleGet by tenant %q status = %d, want %d", tenantID, rr.Code, want)
+		}
+	}
+}
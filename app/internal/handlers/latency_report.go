@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type LatencyReportSource interface {
+	LatencyReport(query entities.HistoryQuery) (entities.LatencyReport, error)
+}
+
+const (
+	defaultLatencySampleSize = 1000
+	maxLatencySampleSize     = 10000
+)
+
+// LatencyReportHandler reports latency percentiles over the request history
+type LatencyReportHandler struct {
+	source LatencyReportSource
+}
+
+// NewLatencyReportHandler creates a new LatencyReportHandler with injected dependencies
+func NewLatencyReportHandler(source LatencyReportSource) *LatencyReportHandler {
+	return &LatencyReportHandler{
+		source: source,
+	}
+}
+
+// Handle returns percentiles over the most recent requests; ?session_id= selects a
+// session and ?limit= how many requests to sample
+func (lh *LatencyReportHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := entities.HistoryQuery{
+		SessionID: r.URL.Query().Get("session_id"),
+		Limit:     defaultLatencySampleSize,
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		query.Limit = min(parsed, maxLatencySampleSize)
+	}
+
+	report, err := lh.source.LatencyReport(query)
+	if err != nil {
+		log.Printf("Error computing latency report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error encoding latency report: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// MaintenanceMode reports whether the proxy is down for maintenance
+type MaintenanceMode interface {
+	State() entities.MaintenanceState
+}
+
+type MaintenanceSwitch interface {
+	MaintenanceMode
+	Enable(reason string, retryAfterSeconds int) (entities.MaintenanceState, error)
+	Disable() entities.MaintenanceState
+}
+
+// rejectForMaintenance answers a request with 503, the reason and a
+// Retry-After header while maintenance is on. It reports whether it did.
+func rejectForMaintenance(w http.ResponseWriter, mode MaintenanceMode) bool {
+	if mode == nil {
+		return false
+	}
+	state := mode.State()
+	if !state.Enabled {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfterSeconds))
+	writeError(w, http.StatusServiceUnavailable, state.Reason, "server_error", "maintenance")
+	return true
+}
+
+// MaintenanceHandler switches the maintenance mode
+type MaintenanceHandler struct {
+	mode MaintenanceSwitch
+}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler with injected dependencies
+func NewMaintenanceHandler(mode MaintenanceSwitch) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		mode: mode,
+	}
+}
+
+// Handle returns the maintenance state on GET, enables maintenance on PUT
+// with an optional JSON body of the reason and Retry-After, and disables it
+// on DELETE
+func (mh *MaintenanceHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	var state entities.MaintenanceState
+	switch r.Method {
+	case http.MethodGet:
+		state = mh.mode.State()
+	case http.MethodPut:
+		var body struct {
+			Reason            string `json:"reason"`
+			RetryAfterSeconds int    `json:"retry_after_seconds"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		var err error
+		state, err = mh.mode.Enable(body.Reason, body.RetryAfterSeconds)
+		if err != nil {
+			if errors.Is(err, entities.ErrInvalidMaintenance) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error enabling maintenance: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Maintenance enabled: %s", state.Reason)
+	case http.MethodDelete:
+		state = mh.mode.Disable()
+		log.Printf("Maintenance disabled")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
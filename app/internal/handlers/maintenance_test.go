@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/maintenance"
+)
+
+func TestMaintenanceHandler(t *testing.T) {
+	mode := maintenance.NewMode()
+	handler := NewMaintenanceHandler(mode)
+	pushed := 0
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		pushed++
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}}, entities.ProxySettings{}).WithMaintenance(mode)
+	runner := &mockJobRunner{}
+	jobsHandler := NewJobsHandler(runner, entities.ProxySettings{}).WithMaintenance(mode)
+	admin := func(method, body string) (*httptest.ResponseRecorder, entities.MaintenanceState) {
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, httptest.NewRequest(method, "/maintenance", strings.NewReader(body)))
+		var state entities.MaintenanceState
+		json.Unmarshal(rec.Body.Bytes(), &state)
+		return rec, state
+	}
+	proxy := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		proxyHandler.Handle(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)))
+		return rec
+	}
+
+	if rec := proxy(); rec.Code != http.StatusOK || pushed != 1 {
+		t.Fatalf("proxy status before maintenance = %d", rec.Code)
+	}
+
+	rec, state := admin(http.MethodPut, `{"reason":"Migrating to the new cluster","retry_after_seconds":120}`)
+	if rec.Code != http.StatusOK || !state.Enabled || state.Since == nil {
+		t.Fatalf("PUT status = %d, body %s", rec.Code, rec.Body)
+	}
+	rec = proxy()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" || pushed != 1 {
+		t.Errorf("proxy status = %d, Retry-After %q, want 503 without forwarding", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	var errResp entities.ErrorResponse
+	if json.Unmarshal(rec.Body.Bytes(), &errResp) != nil || errResp.Error.Message != "Migrating to the new cluster" ||
+		errResp.Error.Code == nil || *errResp.Error.Code != "maintenance" {
+		t.Errorf("proxy body = %s, want the reason", rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	jobsHandler.HandleSubmit(rec, httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(`{"path":"/v1/chat/completions"}`)))
+	if rec.Code != http.StatusServiceUnavailable || runner.submitted != nil {
+		t.Errorf("job submission status = %d, want 503", rec.Code)
+	}
+
+	if _, state := admin(http.MethodGet, ""); !state.Enabled || state.RetryAfterSeconds != 120 {
+		t.Errorf("GET = %+v", state)
+	}
+	if rec, _ := admin(http.MethodPut, `{"retry_after_seconds":-5}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a negative Retry-After status = %d, want 400", rec.Code)
+	}
+	if _, state := admin(http.MethodDelete, ""); state.Enabled {
+		t.Errorf("DELETE = %+v", state)
+	}
+	if rec := proxy(); rec.Code != http.StatusOK || pushed != 2 {
+		t.Errorf("proxy status after maintenance = %d", rec.Code)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+type MetricsSource interface {
+	Snapshot() map[string]int64
+}
+
+// MetricsHandler exposes in-process counters as JSON
+type MetricsHandler struct {
+	metrics MetricsSource
+}
+
+// NewMetricsHandler creates a new MetricsHandler with injected dependencies
+func NewMetricsHandler(metrics MetricsSource) *MetricsHandler {
+	return &MetricsHandler{
+		metrics: metrics,
+	}
+}
+
+// Handle returns a snapshot of all counters
+func (mh *MetricsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mh.metrics.Snapshot()); err != nil {
+		log.Printf("Error encoding metrics: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
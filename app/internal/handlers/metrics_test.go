@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockMetricsSource struct {
+	snapshot map[string]int64
+}
+
+func (m *mockMetricsSource) Snapshot() map[string]int64 {
+	return m.snapshot
+}
+
+func TestMetricsHandler_Handle(t *testing.T) {
+	handler := NewMetricsHandler(&mockMetricsSource{snapshot: map[string]int64{"http_panics_total": 2}})
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("MetricsHandler status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+	if strings.TrimSpace(rr.Body.String()) != `{"http_panics_total":2}` {
+		t.Errorf("MetricsHandler body = %q", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("MetricsHandler POST status code = %v, want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -1,16 +1,20 @@
 package handlers
 
 import (
-	"bytes"
-	"compress/gzip"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httpheader"
 )
 
 type Queue interface {
@@ -23,22 +27,120 @@ type ProxySessionManager interface {
 	ListSessions() (map[string]*entities.SessionData, error)
 	UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
 	ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error)
+	EstimateTokenUsage(requestBody, responseBody []byte) *entities.TokenUsage
+	ParseMediaUsage(path string, requestBody, responseBody []byte) *entities.TokenUsage
+	ParseToolCalls(responseBody []byte) map[string]int
+	RecordResponse(sessionID string, statusCode int, message, errorType string) error
+}
+
+// RequestFilter inspects or rewrites a buffered request before it is enqueued.
+// Returning an *entities.RequestError rejects the request with that error.
+type RequestFilter interface {
+	Filter(sessionID string, req *entities.ProxyRequest) error
+}
+
+// ResponseFilter inspects or rewrites a buffered response before it is
+// returned to the client. Returning an *entities.RequestError replaces the
+// response with that error.
+type ResponseFilter interface {
+	FilterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error
+}
+
+// ThreadTracker attributes Assistants API usage to the sessions of threads
+type ThreadTracker interface {
+	SessionFor(tenantID, threadID string) (string, bool)
+	Observe(tenantID, sessionID string, responseBody []byte) (entities.TokenUsage, error)
+}
+
+// FineTuneTracker polls the fine-tuning jobs created through sessions until
+// they finish
+type FineTuneTracker interface {
+	Track(sessionID string, responseBody []byte) error
+}
+
+// Pricer prices the usage of a request on a model
+type Pricer interface {
+	Cost(model string, usage entities.TokenUsage) float64
+}
+
+// SessionGrouper stores the user and project a session belongs to, and the
+// metadata the authorization service annotated it with
+type SessionGrouper interface {
+	SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error)
+}
+
+// sessionGroupHeaders map the headers naming a session's user and project to
+// the metadata keys they are stored under
+var sessionGroupHeaders = map[string]string{
+	UserIDHeader:    entities.UserIDMetadataKey,
+	ProjectIDHeader: entities.ProjectIDMetadataKey,
 }
 
 // ProxyHandler handles both regular and session-based requests
 type ProxyHandler struct {
 	sessionManager ProxySessionManager
 	queue          Queue
+	settings       entities.ProxySettings
+	filters        []RequestFilter
+	threads        ThreadTracker
+	fineTunes      FineTuneTracker
+	pricer         Pricer
+	groups         SessionGrouper
+	respFilters    []ResponseFilter
+	maintenance    MaintenanceMode
 }
 
-// NewProxyHandler creates a new ProxyHandler with injected dependencies
-func NewProxyHandler(sessionManager ProxySessionManager, queue Queue) *ProxyHandler {
+// NewProxyHandler creates a new ProxyHandler with injected dependencies.
+// Filters are applied in order to every buffered request body.
+func NewProxyHandler(sessionManager ProxySessionManager, queue Queue, settings entities.ProxySettings, filters ...RequestFilter) *ProxyHandler {
 	return &ProxyHandler{
 		sessionManager: sessionManager,
 		queue:          queue,
+		settings:       settings,
+		filters:        filters,
 	}
 }
 
+// WithMaintenance makes the handler reject new requests while maintenance is on
+func (ph *ProxyHandler) WithMaintenance(mode MaintenanceMode) *ProxyHandler {
+	ph.maintenance = mode
+	return ph
+}
+
+// WithThreads makes the handler account Assistants API runs to the sessions
+// their threads are mapped to
+func (ph *ProxyHandler) WithThreads(threads ThreadTracker) *ProxyHandler {
+	ph.threads = threads
+	return ph
+}
+
+// WithFineTuning makes the handler count the trained tokens of fine-tuning jobs
+// created through a session against it once they finish
+func (ph *ProxyHandler) WithFineTuning(fineTunes FineTuneTracker) *ProxyHandler {
+	ph.fineTunes = fineTunes
+	return ph
+}
+
+// WithPricing makes the handler add the cost of each request's usage to its session
+func (ph *ProxyHandler) WithPricing(pricer Pricer) *ProxyHandler {
+	ph.pricer = pricer
+	return ph
+}
+
+// WithSessionGroups makes the handler store the X-User-ID and X-Project-ID
+// headers of session requests in the session's metadata
+func (ph *ProxyHandler) WithSessionGroups(groups SessionGrouper) *ProxyHandler {
+	ph.groups = groups
+	return ph
+}
+
+// WithResponseFilters makes the handler apply the filters in order to every
+// buffered response, after its usage is recorded
+func (ph *ProxyHandler) WithResponseFilters(filters ...ResponseFilter) *ProxyHandler {
+	ph.respFilters = filters
+	return ph
+}
+
 // Handle processes the HTTP request
 func (ph *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Handling request for: %s", r.URL.String())
@@ -47,52 +149,123 @@ func (ph *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Header: %s: %s", k, val)
 		}
 	}
+	if rejectForMaintenance(w, ph.maintenance) {
+		return
+	}
 
 	// Check if this is a session-based request
-	sessionID := extractSessionID(r.URL.Path)
+	tenantID := entities.TenantFromContext(r.Context())
+	pathSessionID := extractSessionID(r.URL.Path)
+	sessionID := entities.TenantSessionID(tenantID, pathSessionID)
 	log.Printf("Path: %s", r.URL.Path)
+	if sessionID == "" && ph.threads != nil {
+		// Runs on a thread and polls of a background response count against
+		// the session the thread or response is mapped to
+		if trackedID := trackedIDFromPath(r.URL.Path); trackedID != "" {
+			if mapped, ok := ph.threads.SessionFor(tenantID, trackedID); ok {
+				log.Printf("%s is mapped to session %s", trackedID, mapped)
+				sessionID = mapped
+			}
+		}
+	}
 
+	// defaultModel is set in the session's metadata for requests naming no model
+	var defaultModel string
 	if sessionID != "" {
 		log.Printf("Extracted session ID: %s", sessionID)
 
 		// Validate that there's an endpoint after the session ID
-		upstreamPath := removeSessionFromPath(r.URL.Path)
-		if upstreamPath == "/v1/" {
-			http.Error(w, "Missing OpenAI endpoint. Use format: /v1/session/{sessionID}/chat/completions", http.StatusBadRequest)
+		if pathSessionID != "" && removeSessionFromPath(r.URL.Path) == "/v1/" {
+			writeError(w, http.StatusBadRequest, "Missing OpenAI endpoint. Use format: /v1/session/{sessionID}/chat/completions", "invalid_request_error", "missing_endpoint")
+			return
+		}
+		// Session status, usage and budget are answered by the proxy and must
+		// never reach the upstream, even where their routes are not registered
+		if pathSessionID != "" && sessionInfoPaths[removeSessionFromPath(r.URL.Path)] {
+			writeError(w, http.StatusNotFound, "Session endpoint is not available", "invalid_request_error", "not_found")
 			return
 		}
 
 		// Get or create session
-		_, errSess := ph.sessionManager.GetSession(sessionID)
+		sess, errSess := ph.sessionManager.GetSession(sessionID)
 		if errSess != nil {
 			if errors.Is(errSess, entities.ErrSessionNotFound) {
-				_, errSess = ph.sessionManager.CreateSession(sessionID)
+				sess, errSess = ph.sessionManager.CreateSession(sessionID)
 				if errSess != nil {
 					log.Printf("Error creating session %s: %v", sessionID, errSess)
-					http.Error(w, "Failed to initialize session", http.StatusInternalServerError)
+					writeError(w, http.StatusInternalServerError, "Failed to initialize session", "server_error", "session_error")
 					return
 				}
 				log.Printf("Created new session: %s", sessionID)
 			} else {
 				log.Printf("Error retrieving session %s: %v", sessionID, errSess)
-				http.Error(w, "Failed to retrieve session", http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "Failed to retrieve session", "server_error", "session_error")
 				return
 			}
 		}
+		if ph.groups != nil {
+			ph.groupSession(sessionID, sess, r.Header, entities.AnnotationsFromContext(r.Context()))
+		}
+		defaultModel = sess.Metadata[entities.DefaultModelMetadataKey]
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
-		return
-	}
 	defer r.Body.Close()
 
-	log.Printf("Request body: %s", string(body))
+	// Multipart uploads (audio, files) are streamed upstream instead of buffered
+	streamBody := isMultipart(r.Header.Get("Content-Type"))
+
+	var body []byte
+	var bodyStream io.Reader
+	var maxBytesErr *http.MaxBytesError
+	if streamBody {
+		if ph.settings.MaxUploadBytes > 0 {
+			if r.ContentLength > ph.settings.MaxUploadBytes {
+				ph.reject(w, sessionID, &entities.RequestError{
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Message:    fmt.Sprintf("Upload exceeds the maximum size of %d bytes", ph.settings.MaxUploadBytes),
+					Type:       "invalid_request_error",
+					Code:       "request_too_large",
+				})
+				return
+			}
+			// Chunked uploads trip the limit mid-stream. The transport then drops
+			// the upstream connection before the final chunk, so the partial
+			// upload is never a complete request, and queueError reports 413.
+			bodyStream = http.MaxBytesReader(w, r.Body, ph.settings.MaxUploadBytes)
+		} else {
+			bodyStream = r.Body
+		}
+		log.Printf("Streaming multipart request body (Content-Length: %d)", r.ContentLength)
+	} else {
+		var reader io.Reader = r.Body
+		if ph.settings.MaxBodyBytes > 0 {
+			reader = http.MaxBytesReader(w, r.Body, ph.settings.MaxBodyBytes)
+		}
+		var err error
+		body, err = io.ReadAll(reader)
+		if err != nil {
+			if errors.As(err, &maxBytesErr) {
+				ph.reject(w, sessionID, &entities.RequestError{
+					StatusCode: http.StatusRequestEntityTooLarge,
+					Message:    fmt.Sprintf("Request body exceeds the maximum size of %d bytes", maxBytesErr.Limit),
+					Type:       "invalid_request_error",
+					Code:       "request_too_large",
+				})
+				return
+			}
+			ph.reject(w, sessionID, &entities.RequestError{
+				StatusCode: http.StatusBadRequest,
+				Message:    "Failed to read body",
+				Type:       "invalid_request_error",
+				Code:       "invalid_body",
+			})
+			return
+		}
+	}
 
 	// Determine the upstream path
 	var upstreamPath string
-	if sessionID != "" {
+	if pathSessionID != "" {
 		// Remove session ID from path for upstream request
 		upstreamPath = removeSessionFromPath(r.URL.Path)
 	} else {
@@ -100,70 +273,408 @@ func (ph *ProxyHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		upstreamPath = r.URL.Path
 	}
 
+	if defaultModel != "" && modelPaths[upstreamPath] && r.Method == http.MethodPost {
+		body = withDefaultModel(body, defaultModel)
+	}
+
+	deadline, err := parseQueueDeadline(r.Header.Get(QueueDeadlineHeader), time.Now())
+	if err != nil {
+		ph.reject(w, sessionID, &entities.RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    err.Error(),
+			Type:       "invalid_request_error",
+		})
+		return
+	}
+
+	residency, residencyChecked := entities.ResidencyFromContext(r.Context())
 	req := entities.ProxyRequest{
-		Reply:   make(chan entities.ProxyResponse, 1),
-		Method:  r.Method,
-		Path:    upstreamPath,
-		Headers: r.Header.Clone(),
-		Body:    body,
+		Reply:            make(chan entities.ProxyResponse, 1),
+		SessionID:        sessionID,
+		TenantID:         tenantID,
+		VirtualKeyID:     entities.VirtualKeyFromContext(r.Context()),
+		Residency:        residency,
+		ResidencyChecked: residencyChecked,
+		ClientIP:         entities.ClientIPFromContext(r.Context()),
+		Method:           r.Method,
+		Path:             upstreamPath,
+		Headers:          r.Header.Clone(),
+		Body:             body,
+		BodyStream:       bodyStream,
+		ContentLength:    r.ContentLength,
+		Deadline:         deadline,
+	}
+	req.Headers.Del(QueueDeadlineHeader)
+	for header := range sessionGroupHeaders {
+		req.Headers.Del(header)
 	}
 
-	resp := ph.queue.Push(req)
+	var queueEstimate *entities.QueueEstimate
+	enqueuedAt := time.Now()
+	req.OnEnqueue = func(estimate entities.QueueEstimate) {
+		queueEstimate = &estimate
+	}
+
+	if bodyStream == nil {
+		for _, filter := range ph.filters {
+			if err := filter.Filter(sessionID, &req); err != nil {
+				var reqErr *entities.RequestError
+				if errors.As(err, &reqErr) {
+					log.Printf("Request rejected by filter: %v", reqErr)
+					ph.reject(w, sessionID, reqErr)
+					return
+				}
+				log.Printf("Error applying request filter: %v", err)
+				ph.reject(w, sessionID, &entities.RequestError{
+					StatusCode: http.StatusInternalServerError,
+					Message:    "Failed to process request",
+					Type:       "server_error",
+					Code:       "internal_error",
+				})
+				return
+			}
+		}
+		// Filters may have rewritten the body. It is logged only now, so a
+		// redacting filter keeps the raw prompt out of the logs.
+		body = req.Body
+		log.Printf("Request body: %s", truncateForLog(body))
+	}
+	if ph.settings.StreamResponseBytes > 0 && !wantsStream(body) {
+		req.StreamResponseAbove = ph.settings.StreamResponseBytes
+	}
+
+	var resp entities.ProxyResponse
+	heartbeating := false
+	if ph.settings.HeartbeatInterval > 0 && bodyStream == nil && wantsStream(body) {
+		resp, heartbeating = ph.pushWithHeartbeats(w, req, ph.settings.HeartbeatInterval)
+	} else {
+		resp = ph.queue.Push(req)
+	}
 	if resp.Err != nil {
-		http.Error(w, "Proxy error: "+resp.Err.Error(), http.StatusBadGateway)
+		if heartbeating {
+			reqErr := queueError(resp.Err)
+			ph.recordResponse(sessionID, reqErr.StatusCode, reqErr.Message, "")
+			writeStreamError(w, reqErr)
+			return
+		}
+		ph.reject(w, sessionID, queueError(resp.Err))
 		return
 	}
+	message, errorType := upstreamError(resp)
+	ph.recordResponse(sessionID, resp.StatusCode, message, errorType)
+
+	// Large responses were not buffered by the queue. They are copied to the
+	// client first; a JSON body small enough to keep is parsed for usage
+	// below, otherwise the usage is estimated from the request.
+	streamed := resp.BodyStream != nil
+	if streamed {
+		// The cost is known only once the body is through, so it follows as a
+		// trailer, which needs a chunked rather than length-delimited body
+		if ph.pricer != nil {
+			resp.Headers.Del("Content-Length")
+		}
+		ph.writeHeaders(w, r.Method, resp, queueEstimate, enqueuedAt)
+		keep := int64(0)
+		if sessionID != "" && ph.sessionManager != nil && isJSONContent(resp.Headers.Get("Content-Type")) {
+			keep = ph.settings.StreamResponseBytes
+		}
+		resp.Body = copyStreamedBody(w, resp.BodyStream, keep)
+	}
+
+	// Binary payloads (file downloads, audio) carry no usage data and are not logged
+	binaryResponse := isBinaryContent(resp.Headers.Get("Content-Type"))
+	if binaryResponse && !streamed {
+		log.Printf("Binary response from upstream: %s, %d bytes", resp.Headers.Get("Content-Type"), len(resp.Body))
+	}
 
-	// Decompress response body if it's gzipped for token parsing
+	// Decompress response body if it's gzipped for token parsing. Passthrough
+	// requests are not counted, but their usage is measured to be priced.
 	var responseBodyForParsing []byte
-	if sessionID != "" && ph.sessionManager != nil && resp.StatusCode >= http.StatusOK && resp.StatusCode < 300 {
-		// Check if response is gzipped
+	var usage *entities.TokenUsage
+	measured := sessionID != "" || ph.pricer != nil
+	succeeded := resp.StatusCode >= http.StatusOK && resp.StatusCode < 300
+	if ph.sessionManager != nil && resp.Cached {
+		// Served from the local cache: count the request but no upstream tokens
+		usage = &entities.TokenUsage{}
+		if sessionID != "" {
+			if _, err := ph.sessionManager.UpdateSessionTokens(sessionID, entities.TokenUsage{}); err != nil {
+				log.Printf("Error updating session tokens for %s: %v", sessionID, err)
+			}
+		}
+	} else if measured && ph.sessionManager != nil && binaryResponse && isMediaPath(upstreamPath) && succeeded {
+		// Speech is measured by its input, the audio itself carries no usage
+		usage = ph.mediaUsage(upstreamPath, body, nil)
+		ph.recordUsage(sessionID, usage)
+	} else if measured && ph.sessionManager != nil && !binaryResponse && succeeded {
+		// Compressed bodies are decompressed for token parsing, within the size
+		// limit. A body that cannot be decoded is left out and the usage is
+		// estimated from the request instead.
 		contentEncoding := resp.Headers.Get("Content-Encoding")
-		if strings.Contains(strings.ToLower(contentEncoding), "gzip") {
-			// Decompress for token parsing
-			reader, err := gzip.NewReader(bytes.NewReader(resp.Body))
+		if contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity") {
+			decompressed, err := entities.DecodeBody(resp.Body, contentEncoding, ph.settings.MaxDecodedBytes)
 			if err != nil {
-				log.Printf("Error creating gzip reader: %v", err)
-				responseBodyForParsing = resp.Body
+				log.Printf("Error decompressing response for session %s: %v", sessionID, err)
 			} else {
-				decompressed, err := io.ReadAll(reader)
-				reader.Close()
-				if err != nil {
-					log.Printf("Error decompressing response: %v", err)
-					responseBodyForParsing = resp.Body
-				} else {
-					responseBodyForParsing = decompressed
-					log.Printf("Decompressed response body: %s", string(responseBodyForParsing))
+				responseBodyForParsing = decompressed
+				if !ph.settings.OmitResponseBodyLogs {
+					log.Printf("Decompressed response body: %s", truncateForLog(responseBodyForParsing))
 				}
 			}
 		} else {
 			responseBodyForParsing = resp.Body
-			log.Printf("Response body from upstream: %s", string(responseBodyForParsing))
+			if !ph.settings.OmitResponseBodyLogs {
+				log.Printf("Response body from upstream: %s", truncateForLog(responseBodyForParsing))
+			}
 		}
 
-		// Parse token usage from decompressed response
-		if tokenUsage, err := ph.sessionManager.ParseTokenUsageFromResponse(responseBodyForParsing); err == nil && tokenUsage != nil {
-			updatedSession, errUpdate := ph.sessionManager.UpdateSessionTokens(sessionID, *tokenUsage)
-			if errUpdate != nil {
-				log.Printf("Error updating session tokens for %s: %v", sessionID, errUpdate)
-				// Potentially return an error to client, or just log and continue
-			} else {
-				log.Printf("Updated session %s token usage - Prompt: %d, Completion: %d, Total: %d, Requests: %d",
-					sessionID, updatedSession.TotalPromptTokens, updatedSession.TotalCompletionTokens,
-					updatedSession.TotalTokens, updatedSession.RequestCount)
+		switch {
+		case sessionID == "" && isMediaPath(upstreamPath):
+			usage = ph.mediaUsage(upstreamPath, body, responseBodyForParsing)
+		case sessionID == "" && !isTrackedPath(upstreamPath) && !isFineTuningPath(upstreamPath):
+			usage = ph.tokenUsage(sessionID, body, responseBodyForParsing)
+		case sessionID == "":
+			// Runs and fine-tuning jobs are priced once they finish
+		case ph.threads != nil && isTrackedPath(upstreamPath):
+			usage = ph.recordRunUsage(tenantID, sessionID, body, responseBodyForParsing)
+		case ph.fineTunes != nil && isFineTuningPath(upstreamPath):
+			ph.recordFineTuning(sessionID, r.Method, upstreamPath, responseBodyForParsing)
+		case isMediaPath(upstreamPath):
+			usage = ph.mediaUsage(upstreamPath, body, responseBodyForParsing)
+			ph.recordUsage(sessionID, usage)
+		default:
+			usage = ph.recordTokenUsage(sessionID, body, responseBodyForParsing)
+		}
+	}
+
+	if streamed {
+		// Response filters need the body in hand, so they do not see streamed
+		// responses
+		if usage != nil && ph.pricer != nil {
+			w.Header().Set(http.TrailerPrefix+RequestCostHeader, strconv.FormatFloat(usage.Cost, 'f', -1, 64))
+		}
+		return
+	}
+	if reqErr := ph.filterResponse(sessionID, &req, &resp); reqErr != nil {
+		if heartbeating {
+			writeStreamError(w, reqErr)
+		} else {
+			writeRequestError(w, reqErr)
+		}
+		return
+	}
+	if heartbeating {
+		writeStreamedResponse(w, resp)
+		return
+	}
+
+	if usage != nil && ph.pricer != nil {
+		w.Header().Set(RequestCostHeader, strconv.FormatFloat(usage.Cost, 'f', -1, 64))
+	}
+	ph.writeHeaders(w, r.Method, resp, queueEstimate, enqueuedAt)
+	w.Write(resp.Body)
+}
+
+// filterResponse applies the response filters. Usage was already counted from
+// the upstream body, so filters cannot change what a session is charged.
+func (ph *ProxyHandler) filterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) *entities.RequestError {
+	for _, filter := range ph.respFilters {
+		if err := filter.FilterResponse(sessionID, req, resp); err != nil {
+			var reqErr *entities.RequestError
+			if errors.As(err, &reqErr) {
+				log.Printf("Response rejected by filter: %v", reqErr)
+				return reqErr
+			}
+			log.Printf("Error applying response filter: %v", err)
+			return &entities.RequestError{
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Failed to process response",
+				Type:       "server_error",
+				Code:       "internal_error",
 			}
-		} else if err != nil {
-			log.Printf("Error parsing token usage for session %s: %v", sessionID, err)
 		}
 	}
+	return nil
+}
 
+// writeHeaders writes the upstream headers and status with the queue headers.
+// Hop-by-hop headers belong to the upstream connection and are dropped, and
+// the Content-Length of a buffered body is set from the body the client gets,
+// since decorators may have replaced it.
+func (ph *ProxyHandler) writeHeaders(w http.ResponseWriter, method string, resp entities.ProxyResponse, queueEstimate *entities.QueueEstimate, enqueuedAt time.Time) {
 	for k, v := range resp.Headers {
 		for _, val := range v {
 			w.Header().Add(k, val)
 		}
 	}
+	httpheader.RemoveHopByHop(w.Header())
+	switch {
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode < http.StatusOK:
+		w.Header().Del("Content-Length")
+	case resp.BodyStream != nil, resp.StatusCode == http.StatusNotModified, method == http.MethodHead && len(resp.Body) == 0:
+		// The body is not in hand or there is none; the upstream length stands
+	default:
+		w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	}
+	// Cached and deduplicated responses never entered the queue
+	if queueEstimate != nil {
+		w.Header().Set(QueuePositionHeader, strconv.Itoa(queueEstimate.Position))
+		w.Header().Set(QueueETAHeader, strconv.FormatFloat(queueEstimate.DispatchAt.Sub(enqueuedAt).Seconds(), 'f', 3, 64))
+		w.Header().Set(QueueWaitHeader, strconv.FormatInt(resp.QueueWait.Milliseconds(), 10))
+		if resp.UpstreamLatency > 0 {
+			w.Header().Set(UpstreamLatencyHeader, strconv.FormatInt(resp.UpstreamLatency.Milliseconds(), 10))
+		}
+	}
 	w.WriteHeader(resp.StatusCode)
-	w.Write(resp.Body)
+}
+
+// reject writes a proxy-generated error and counts it against the session
+func (ph *ProxyHandler) reject(w http.ResponseWriter, sessionID string, reqErr *entities.RequestError) {
+	ph.recordResponse(sessionID, reqErr.StatusCode, reqErr.Message, "")
+	writeRequestError(w, reqErr)
+}
+
+// recordResponse adds the response status to the session's statistics
+func (ph *ProxyHandler) recordResponse(sessionID string, statusCode int, message, errorType string) {
+	if sessionID == "" || ph.sessionManager == nil {
+		return
+	}
+	if err := ph.sessionManager.RecordResponse(sessionID, statusCode, message, errorType); err != nil {
+		log.Printf("Error recording response status for session %s: %v", sessionID, err)
+	}
+}
+
+// recordTokenUsage adds the usage reported in the response to the session and
+// returns it. If the upstream did not report usage, it falls back to a local estimate.
+func (ph *ProxyHandler) recordTokenUsage(sessionID string, requestBody, responseBody []byte) *entities.TokenUsage {
+	tokenUsage := ph.tokenUsage(sessionID, requestBody, responseBody)
+	if tokenUsage == nil {
+		return nil
+	}
+
+	updatedSession, errUpdate := ph.sessionManager.UpdateSessionTokens(sessionID, *tokenUsage)
+	if errUpdate != nil {
+		log.Printf("Error updating session tokens for %s: %v", sessionID, errUpdate)
+		// Potentially return an error to client, or just log and continue
+		return tokenUsage
+	}
+	log.Printf("Updated session %s token usage - Prompt: %d, Completion: %d, Total: %d, Requests: %d",
+		sessionID, updatedSession.TotalPromptTokens, updatedSession.TotalCompletionTokens,
+		updatedSession.TotalTokens, updatedSession.RequestCount)
+	return tokenUsage
+}
+
+// tokenUsage returns the priced usage reported in the response, or a local
+// estimate if the upstream did not report usage, with the tool calls the
+// model requested. The session ID, empty for
+// passthrough requests, is only logged.
+func (ph *ProxyHandler) tokenUsage(sessionID string, requestBody, responseBody []byte) *entities.TokenUsage {
+	tokenUsage, err := ph.sessionManager.ParseTokenUsageFromResponse(responseBody)
+	if err != nil {
+		log.Printf("Error parsing token usage for session %s: %v", sessionID, err)
+	}
+	if tokenUsage == nil {
+		tokenUsage = ph.sessionManager.EstimateTokenUsage(requestBody, responseBody)
+		if tokenUsage == nil {
+			return nil
+		}
+		log.Printf("Upstream reported no usage for session %s, estimated %d prompt and %d completion tokens",
+			sessionID, tokenUsage.PromptTokens, tokenUsage.CompletionTokens)
+	}
+	tokenUsage.ToolCalls = ph.sessionManager.ParseToolCalls(responseBody)
+	ph.price(tokenUsage, requestBody, responseBody)
+	return tokenUsage
+}
+
+// groupSession stores the user and project named by the request headers, and
+// the annotations of the authorization service, in the session's metadata
+// when they changed. A failure is logged and does not fail the request.
+func (ph *ProxyHandler) groupSession(sessionID string, sess *entities.SessionData, headers http.Header, annotations map[string]string) {
+	var changed map[string]string
+	set := func(key, value string) {
+		if value == "" || sess.Metadata[key] == value {
+			return
+		}
+		if changed == nil {
+			changed = make(map[string]string)
+		}
+		changed[key] = value
+	}
+	for header, key := range sessionGroupHeaders {
+		set(key, strings.TrimSpace(headers.Get(header)))
+	}
+	for key, value := range annotations {
+		set(key, value)
+	}
+	if changed == nil {
+		return
+	}
+	if _, err := ph.groups.SetSessionMetadata(sessionID, changed); err != nil {
+		log.Printf("Error storing the metadata of session %s: %v", sessionID, err)
+	}
+}
+
+// recordRunUsage counts an Assistants or Responses API request against the
+// session with the usage of the runs and responses that finished. Unfinished
+// ones carry no usage yet, and polling them must not count them again, so
+// nothing is estimated.
+func (ph *ProxyHandler) recordRunUsage(tenantID, sessionID string, requestBody, responseBody []byte) *entities.TokenUsage {
+	usage, err := ph.threads.Observe(tenantID, sessionID, responseBody)
+	if err != nil {
+		log.Printf("Error tracking assistants usage for session %s: %v", sessionID, err)
+	}
+	ph.price(&usage, requestBody, responseBody)
+	ph.recordUsage(sessionID, &usage)
+	return &usage
+}
+
+// mediaUsage returns the priced images, seconds of audio or characters used
+// by an image, transcription or speech request. Their responses hold no text
+// to estimate tokens from, so nothing is estimated.
+func (ph *ProxyHandler) mediaUsage(path string, requestBody, responseBody []byte) *entities.TokenUsage {
+	usage := ph.sessionManager.ParseMediaUsage(path, requestBody, responseBody)
+	if usage == nil {
+		usage = &entities.TokenUsage{}
+	}
+	ph.price(usage, requestBody, responseBody)
+	return usage
+}
+
+// recordUsage counts a request against the session with the usage; nothing is
+// recorded for passthrough requests
+func (ph *ProxyHandler) recordUsage(sessionID string, usage *entities.TokenUsage) {
+	if sessionID == "" {
+		return
+	}
+	if _, err := ph.sessionManager.UpdateSessionTokens(sessionID, *usage); err != nil {
+		log.Printf("Error updating session tokens for %s: %v", sessionID, err)
+	}
+}
+
+// recordFineTuning counts a fine-tuning request against the session without
+// tokens and tracks the jobs it creates. Their trained tokens are counted when
+// they finish, so nothing is estimated.
+func (ph *ProxyHandler) recordFineTuning(sessionID, method, path string, responseBody []byte) {
+	if method == http.MethodPost && path == "/v1/fine_tuning/jobs" {
+		if err := ph.fineTunes.Track(sessionID, responseBody); err != nil {
+			log.Printf("Error tracking fine-tuning job of session %s: %v", sessionID, err)
+		}
+	}
+	if _, err := ph.sessionManager.UpdateSessionTokens(sessionID, entities.TokenUsage{}); err != nil {
+		log.Printf("Error updating session tokens for %s: %v", sessionID, err)
+	}
+}
+
+// price sets the cost of the usage on the model named in the request, or in
+// the response for requests that do not name one in JSON
+func (ph *ProxyHandler) price(usage *entities.TokenUsage, requestBody, responseBody []byte) {
+	if ph.pricer == nil {
+		return
+	}
+	model := entities.BodyModel(requestBody)
+	if model == "" {
+		model = entities.BodyModel(responseBody)
+	}
+	usage.Cost = ph.pricer.Cost(model, *usage)
 }
 
 // Legacy function for backward compatibility - renamed to avoid conflict
@@ -173,6 +684,84 @@ func LegacyProxyHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "ProxyHandler requires dependency injection. Use NewProxyHandler instead.", http.StatusInternalServerError)
 }
 
+const (
+	// QueueDeadlineHeader lets clients bound how long a request may wait in the queue
+	QueueDeadlineHeader = "X-Queue-Deadline"
+	// QueuePositionHeader reports the request's position in the queue when it was enqueued
+	QueuePositionHeader = "X-Queue-Position"
+	// QueueETAHeader reports the estimated wait before dispatch, in seconds
+	QueueETAHeader = "X-Queue-ETA"
+	// QueueWaitHeader reports how long the request waited in the queue, in milliseconds
+	QueueWaitHeader = "X-Queue-Wait-Ms"
+	// UpstreamLatencyHeader reports how long the upstream took to respond, in milliseconds
+	UpstreamLatencyHeader = "X-Upstream-Latency-Ms"
+	// RequestCostHeader reports the price of the request's usage, in US dollars
+	RequestCostHeader = "X-Request-Cost-USD"
+	// UserIDHeader and ProjectIDHeader group a session under a user and a
+	// project; they are not forwarded upstream
+	UserIDHeader    = "X-User-ID"
+	ProjectIDHeader = "X-Project-ID"
+)
+
+// parseQueueDeadline parses an X-Queue-Deadline value, either a number of
+// seconds from now or an RFC 3339 timestamp. An empty value means no deadline.
+func parseQueueDeadline(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return time.Time{}, fmt.Errorf("invalid %s: must be positive", QueueDeadlineHeader)
+		}
+		return now.Add(time.Duration(seconds * float64(time.Second))), nil
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected seconds or an RFC 3339 timestamp", QueueDeadlineHeader)
+	}
+	return deadline, nil
+}
+
+// isMultipart reports whether the content type is a multipart upload
+func isMultipart(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// isBinaryContent reports whether a response content type is a non-text payload.
+// JSON, text and event streams are treated as text; a missing content type is
+// assumed to be JSON.
+func isBinaryContent(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/x-ndjson",
+		mediaType == "application/jsonl":
+		return false
+	}
+	return true
+}
+
+// maxLoggedBodyBytes limits how much of a body is written to the log,
+// so large payloads like b64_json images don't flood it
+const maxLoggedBodyBytes = 4096
+
+// truncateForLog returns the body as a string, truncated for logging
+func truncateForLog(body []byte) string {
+	if len(body) <= maxLoggedBodyBytes {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", body[:maxLoggedBodyBytes], len(body)-maxLoggedBodyBytes)
+}
+
 // extractSessionID extracts session ID from URL path like /v1/session/{sessionID}/chat/completions
 func extractSessionID(path string) string {
 	// Pattern: /v1/session/{sessionID}/...
@@ -184,6 +773,90 @@ func extractSessionID(path string) string {
 	return matches[1]
 }
 
+// trackedIDFromPath returns the thread addressed by a path such as
+// /v1/threads/{id}/runs or the response addressed by /v1/responses/{id}, or an
+// empty string
+func trackedIDFromPath(path string) string {
+	for _, prefix := range []string{"/v1/threads/", "/v1/responses/"} {
+		rest, ok := strings.CutPrefix(path, prefix)
+		if !ok {
+			continue
+		}
+		id, _, _ := strings.Cut(rest, "/")
+		// POST /v1/threads/runs creates a thread and runs it
+		if id == "runs" {
+			return ""
+		}
+		return id
+	}
+	return ""
+}
+
+// isTrackedPath reports whether an upstream path belongs to the Assistants or
+// Responses API, whose responses only report final usage on runs and responses
+func isTrackedPath(path string) bool {
+	for _, prefix := range []string{"/v1/threads", "/v1/assistants", "/v1/responses"} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isMediaPath reports whether an upstream path belongs to the image or audio
+// endpoints, which are measured in images, seconds and characters
+func isMediaPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/images/") || strings.HasPrefix(path, "/v1/audio/")
+}
+
+// isFineTuningPath reports whether an upstream path belongs to the fine-tuning API
+func isFineTuningPath(path string) bool {
+	return path == "/v1/fine_tuning" || strings.HasPrefix(path, "/v1/fine_tuning/")
+}
+
+// modelPaths are the upstream paths whose JSON requests name a model
+var modelPaths = map[string]bool{
+	"/v1/chat/completions":   true,
+	"/v1/completions":        true,
+	"/v1/embeddings":         true,
+	"/v1/responses":          true,
+	"/v1/moderations":        true,
+	"/v1/images/generations": true,
+	"/v1/audio/speech":       true,
+}
+
+// withDefaultModel returns a JSON object body with its model set to model
+// when it names none. Other bodies are returned unchanged.
+func withDefaultModel(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil || fields == nil {
+		return body
+	}
+	if current, set := fields["model"]; set && string(current) != "null" && string(current) != `""` {
+		return body
+	}
+	encodedModel, err := json.Marshal(model)
+	if err != nil {
+		return body
+	}
+	fields["model"] = encodedModel
+	updated, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	log.Printf("Using the session's default model %s", model)
+	return updated
+}
+
+// sessionInfoPaths are the session subpaths served by SessionStatusHandler,
+// after removeSessionFromPath
+var sessionInfoPaths = map[string]bool{
+	"/v1/status":     true,
+	"/v1/usage":      true,
+	"/v1/budget":     true,
+	"/v1/transcript": true,
+}
+
 // removeSessionFromPath removes the session part from the path for upstream request
 // e.g., /v1/session/abc123/chat/completions -> /v1/chat/completions
 func removeSessionFromPath(path string) string {
@@ -2,13 +2,23 @@ package handlers
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -19,6 +29,10 @@ type mockProxySessionManager struct {
 	ListSessionsFunc                func() (map[string]*entities.SessionData, error)
 	UpdateSessionTokensFunc         func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
 	ParseTokenUsageFromResponseFunc func(responseBody []byte) (*entities.TokenUsage, error)
+	EstimateTokenUsageFunc          func(requestBody, responseBody []byte) *entities.TokenUsage
+	ParseMediaUsageFunc             func(path string, requestBody, responseBody []byte) *entities.TokenUsage
+	ParseToolCallsFunc              func(responseBody []byte) map[string]int
+	RecordResponseFunc              func(sessionID string, statusCode int, message, errorType string) error
 }
 
 func (m *mockProxySessionManager) GetSession(sessionID string) (*entities.SessionData, error) {
@@ -62,6 +76,33 @@ func (m *mockProxySessionManager) ParseTokenUsageFromResponse(responseBody []byt
 	return &response.Usage, nil
 }
 
+func (m *mockProxySessionManager) ParseMediaUsage(path string, requestBody, responseBody []byte) *entities.TokenUsage {
+	if m.ParseMediaUsageFunc != nil {
+		return m.ParseMediaUsageFunc(path, requestBody, responseBody)
+	}
+	return nil
+}
+func (m *mockProxySessionManager) EstimateTokenUsage(requestBody, responseBody []byte) *entities.TokenUsage {
+	if m.EstimateTokenUsageFunc != nil {
+		return m.EstimateTokenUsageFunc(requestBody, responseBody)
+	}
+	return nil
+}
+
+func (m *mockProxySessionManager) ParseToolCalls(responseBody []byte) map[string]int {
+	if m.ParseToolCallsFunc != nil {
+		return m.ParseToolCallsFunc(responseBody)
+	}
+	return nil
+}
+
+func (m *mockProxySessionManager) RecordResponse(sessionID string, statusCode int, message, errorType string) error {
+	if m.RecordResponseFunc != nil {
+		return m.RecordResponseFunc(sessionID, statusCode, message, errorType)
+	}
+	return nil
+}
+
 type mockQueue struct {
 	PushFunc func(r entities.ProxyRequest) entities.ProxyResponse
 }
@@ -246,6 +287,29 @@ func TestProxyHandler_Handle(t *testing.T) {
 			expectedStatusCode:   http.StatusNotFound,
 			expectedBodyContains: "404 Not Found",
 		},
+		{
+			name: "binary response skips token parsing",
+			path: "/v1/session/bin123/files/file-abc/content",
+			mockSessionManagerSetup: func(msm *mockProxySessionManager) {
+				msm.GetSessionFunc = func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				}
+				msm.ParseTokenUsageFromResponseFunc = func(responseBody []byte) (*entities.TokenUsage, error) {
+					t.Errorf("ParseTokenUsageFromResponse should not be called for binary content")
+					return nil, nil
+				}
+			},
+			mockQueueSetup: func(mq *mockQueue) {
+				mq.PushFunc = func(r entities.ProxyRequest) entities.ProxyResponse {
+					headers := http.Header{}
+					headers.Set("Content-Type", "application/octet-stream")
+					return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte{0x00, 0xff, 0x10}, Headers: headers}
+				}
+			},
+			expectedStatusCode:     http.StatusOK,
+			expectedBodyContains:   "\x00\xff\x10",
+			expectGetSessionCalled: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -260,7 +324,7 @@ func TestProxyHandler_Handle(t *testing.T) {
 				tt.mockQueueSetup(mockQ)
 			}
 
-			proxyHandler := NewProxyHandler(mockSM, mockQ)
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
 
 			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.requestBody))
 			rr := httptest.NewRecorder()
@@ -283,6 +347,671 @@ func TestProxyHandler_Handle(t *testing.T) {
 	}
 }
 
+func TestProxyHandler_EstimatesMissingUsage(t *testing.T) {
+	var recorded entities.TokenUsage
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+			if string(requestBody) != `{"prompt":"hi"}` {
+				t.Errorf("estimator got request body %q", requestBody)
+			}
+			return &entities.TokenUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3, Estimated: true}
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			recorded = usage
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"choices":[{"text":"hello"}]}`)}
+	}}
+
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
+	req := httptest.NewRequest(http.MethodPost, "/v1/session/est/completions", strings.NewReader(`{"prompt":"hi"}`))
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if !recorded.Estimated || recorded.TotalTokens != 3 {
+		t.Errorf("recorded usage = %+v, want estimated usage with 3 total tokens", recorded)
+	}
+}
+
+func TestProxyHandler_DecodesCompressedUsage(t *testing.T) {
+	usageBody := `{"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`
+	compress := func(encoding string, body []byte) []byte {
+		var b bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&b)
+		case "deflate":
+			w = zlib.NewWriter(&b)
+		case "raw deflate":
+			w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+		}
+		w.Write(body)
+		w.Close()
+		return b.Bytes()
+	}
+	// A small body that inflates past the limit
+	bomb := compress("gzip", []byte(`{"usage":{"total_tokens":9},"pad":"`+strings.Repeat("0", 4096)+`"}`))
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantTokens int
+		estimated  bool
+	}{
+		{"gzip", "gzip", compress("gzip", []byte(usageBody)), 3, false},
+		{"deflate", "deflate", compress("deflate", []byte(usageBody)), 3, false},
+		{"raw deflate", "deflate", compress("raw deflate", []byte(usageBody)), 3, false},
+		{"stacked encodings", "deflate, gzip", compress("gzip", compress("deflate", []byte(usageBody))), 3, false},
+		{"over the limit", "gzip", bomb, 1, true},
+		{"unsupported encoding", "br", []byte{0x1b, 0x02}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorded entities.TokenUsage
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+					if responseBody != nil {
+						t.Errorf("estimated from an undecoded response of %d bytes", len(responseBody))
+					}
+					return &entities.TokenUsage{PromptTokens: 1, TotalTokens: 1, Estimated: true}
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					recorded = usage
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+			}
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return entities.ProxyResponse{
+					StatusCode: http.StatusOK,
+					Headers:    http.Header{"Content-Type": []string{"application/json"}, "Content-Encoding": []string{tt.encoding}},
+					Body:       tt.body,
+				}
+			}}
+
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{MaxDecodedBytes: 1024})
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/enc/chat/completions", strings.NewReader(`{}`)))
+
+			if !bytes.Equal(rr.Body.Bytes(), tt.body) {
+				t.Error("client did not receive the upstream body unchanged")
+			}
+			if recorded.TotalTokens != tt.wantTokens || recorded.Estimated != tt.estimated {
+				t.Errorf("recorded usage = %+v, want %d total tokens (estimated %v)", recorded, tt.wantTokens, tt.estimated)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_SanitizesResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		body       string
+		wantLength string
+	}{
+		{"stale length is recomputed", http.MethodPost, http.StatusOK, `{"ok":true}`, "11"},
+		{"no content has no length", http.MethodPost, http.StatusNoContent, "", ""},
+		{"HEAD keeps the upstream length", http.MethodHead, http.StatusOK, "", "999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return entities.ProxyResponse{
+					StatusCode: tt.status,
+					Headers: http.Header{
+						"Content-Length":    []string{"999"},
+						"Connection":        []string{"close, X-Upstream-Hop"},
+						"X-Upstream-Hop":    []string{"1"},
+						"Transfer-Encoding": []string{"chunked"},
+						"Content-Type":      []string{"application/json"},
+					},
+					Body: []byte(tt.body),
+				}
+			}}
+			proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(tt.method, "/v1/models", nil))
+
+			if got := rr.Header().Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+			for _, name := range []string{"Connection", "X-Upstream-Hop", "Transfer-Encoding"} {
+				if rr.Header().Get(name) != "" {
+					t.Errorf("hop-by-hop header %s was forwarded", name)
+				}
+			}
+			if rr.Header().Get("Content-Type") != "application/json" {
+				t.Error("end-to-end header Content-Type was dropped")
+			}
+		})
+	}
+}
+
+type rejectingFilter struct {
+	err error
+}
+
+func (f *rejectingFilter) Filter(sessionID string, req *entities.ProxyRequest) error {
+	return f.err
+}
+
+type rewritingFilter struct{}
+
+func (f *rewritingFilter) Filter(sessionID string, req *entities.ProxyRequest) error {
+	req.Body = []byte(`{"rewritten":true}`)
+	return nil
+}
+
+func TestProxyHandler_RequestFilters(t *testing.T) {
+	t.Run("rejection uses error envelope", func(t *testing.T) {
+		mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+			t.Error("Push should not be called for rejected request")
+			return entities.ProxyResponse{}
+		}}
+		filter := &rejectingFilter{err: &entities.RequestError{StatusCode: http.StatusBadRequest, Message: "too big", Type: "invalid_request_error", Code: "prompt_too_large"}}
+		proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{}, filter)
+
+		rr := httptest.NewRecorder()
+		proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+		}
+		var errResp entities.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil {
+			t.Fatalf("body is not an error envelope: %q", rr.Body.String())
+		}
+		if errResp.Error.Code == nil || *errResp.Error.Code != "prompt_too_large" {
+			t.Errorf("error code = %v, want prompt_too_large", errResp.Error.Code)
+		}
+	})
+
+	t.Run("rewritten body is forwarded", func(t *testing.T) {
+		var forwarded string
+		mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+			forwarded = string(r.Body)
+			return entities.ProxyResponse{StatusCode: http.StatusOK}
+		}}
+		proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{}, &rewritingFilter{})
+
+		rr := httptest.NewRecorder()
+		proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+
+		if forwarded != `{"rewritten":true}` {
+			t.Errorf("forwarded body = %q, want rewritten body", forwarded)
+		}
+	})
+}
+
+func TestProxyHandler_LogsFilteredBodies(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{"Content-Type": {"application/json"}},
+			Body: []byte(`{"echo":"alice@example.com"}`)}
+	}}
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{OmitResponseBodyLogs: true}, &rewritingFilter{})
+
+	rr := httptest.NewRecorder()
+	proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{"secret":"alice@example.com"}`)))
+
+	if strings.Contains(logs.String(), "alice@example.com") {
+		t.Errorf("logs contain the unfiltered body:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `{"rewritten":true}`) {
+		t.Errorf("logs miss the filtered request body:\n%s", logs.String())
+	}
+}
+
+type responseFilterFunc func(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error
+
+func (f responseFilterFunc) FilterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+	return f(sessionID, req, resp)
+}
+
+func TestProxyHandler_ResponseFilters(t *testing.T) {
+	var charged int
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			charged = usage.TotalTokens
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{"Content-Type": {"application/json"}},
+			Body: []byte(`{"id":"chatcmpl-1","usage":{"total_tokens":9}}`)}
+	}}
+
+	t.Run("rewritten response is returned after usage is counted", func(t *testing.T) {
+		var filteredPath string
+		proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithResponseFilters(
+			responseFilterFunc(func(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+				filteredPath = req.Path
+				resp.Body = []byte(`{"id":"chatcmpl-1"}`)
+				return nil
+			}))
+
+		rr := httptest.NewRecorder()
+		proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{}`)))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != `{"id":"chatcmpl-1"}` || rr.Header().Get("Content-Length") != "19" {
+			t.Errorf("response = %d %q (Content-Length %s), want the rewritten body", rr.Code, rr.Body.String(), rr.Header().Get("Content-Length"))
+		}
+		if filteredPath != "/v1/chat/completions" || charged != 9 {
+			t.Errorf("filtered path %q, charged %d tokens, want /v1/chat/completions and 9", filteredPath, charged)
+		}
+	})
+
+	t.Run("rejection uses error envelope", func(t *testing.T) {
+		proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithResponseFilters(
+			responseFilterFunc(func(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+				return &entities.RequestError{StatusCode: http.StatusForbidden, Message: "blocked", Type: "invalid_request_error", Code: "policy"}
+			}))
+
+		rr := httptest.NewRecorder()
+		proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{}`)))
+
+		var errResp entities.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil || rr.Code != http.StatusForbidden {
+			t.Fatalf("response = %d %q, want a 403 error envelope", rr.Code, rr.Body.String())
+		}
+		if errResp.Error.Code == nil || *errResp.Error.Code != "policy" {
+			t.Errorf("error code = %v, want policy", errResp.Error.Code)
+		}
+	})
+}
+
+func TestProxyHandler_MultipartStreaming(t *testing.T) {
+	payload := "--boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.wav\"\r\n\r\nRIFF\r\n--boundary--\r\n"
+
+	var streamed string
+	var contentType string
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		if r.BodyStream == nil {
+			t.Fatal("expected multipart body to be streamed")
+		}
+		if len(r.Body) != 0 {
+			t.Errorf("expected buffered body to be empty, got %d bytes", len(r.Body))
+		}
+		b, _ := io.ReadAll(r.BodyStream)
+		streamed = string(b)
+		contentType = r.Headers.Get("Content-Type")
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"text":"hi"}`)}
+	}}
+
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{MaxUploadBytes: 1024})
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if streamed != payload {
+		t.Errorf("streamed body = %q, want %q", streamed, payload)
+	}
+	if contentType != "multipart/form-data; boundary=boundary" {
+		t.Errorf("Content-Type not preserved: %q", contentType)
+	}
+}
+
+func TestProxyHandler_StreamsLargeResponses(t *testing.T) {
+	large := strings.Repeat("a", 256)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantTokens  int
+	}{
+		{"small JSON is parsed", "application/json", `{"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`, 3},
+		{"large body is estimated", "application/json", `{"data":"` + large + `"}`, 1},
+		{"binary body is not kept", "application/octet-stream", large, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorded *entities.TokenUsage
+			var threshold int64
+			stream := &closeRecorder{Reader: strings.NewReader(tt.body)}
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+					if responseBody != nil {
+						t.Errorf("estimated from a truncated response of %d bytes", len(responseBody))
+					}
+					return &entities.TokenUsage{PromptTokens: 1, TotalTokens: 1, Estimated: true}
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					recorded = &usage
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+			}
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				threshold = r.StreamResponseAbove
+				return entities.ProxyResponse{
+					StatusCode: http.StatusOK,
+					Headers:    http.Header{"Content-Type": []string{tt.contentType}},
+					BodyStream: stream,
+				}
+			}}
+
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{StreamResponseBytes: 128})
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/big/files", strings.NewReader(`{}`)))
+
+			if threshold != 128 {
+				t.Errorf("StreamResponseAbove = %d, want 128", threshold)
+			}
+			if rr.Code != http.StatusOK || rr.Body.String() != tt.body {
+				t.Errorf("response = %d %q, want 200 with the streamed body", rr.Code, rr.Body.String())
+			}
+			if rr.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", rr.Header().Get("Content-Type"), tt.contentType)
+			}
+			if !stream.closed {
+				t.Error("streamed body was not closed")
+			}
+			if tt.wantTokens == 0 {
+				if recorded != nil {
+					t.Errorf("recorded usage %+v for a binary response", recorded)
+				}
+			} else if recorded == nil || recorded.TotalTokens != tt.wantTokens {
+				t.Errorf("recorded usage = %+v, want %d total tokens", recorded, tt.wantTokens)
+			}
+		})
+	}
+
+	t.Run("streaming requests stay buffered", func(t *testing.T) {
+		mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+			if r.StreamResponseAbove != 0 {
+				t.Errorf("StreamResponseAbove = %d for an SSE request, want 0", r.StreamResponseAbove)
+			}
+			return entities.ProxyResponse{StatusCode: http.StatusOK}
+		}}
+		proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{StreamResponseBytes: 128})
+		proxyHandler.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"stream":true}`)))
+	})
+}
+
+func TestProxyHandler_StreamedCostTrailer(t *testing.T) {
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	body := `{"model":"gpt-4o","usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		return entities.ProxyResponse{
+			StatusCode: http.StatusOK,
+			Headers:    http.Header{"Content-Type": {"application/json"}, "Content-Length": {strconv.Itoa(len(body))}},
+			BodyStream: &closeRecorder{Reader: strings.NewReader(body)},
+		}
+	}}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{StreamResponseBytes: 1024}).WithPricing(
+		pricerFunc(func(model string, usage entities.TokenUsage) float64 {
+			return float64(usage.PromptTokens)*0.0001 + float64(usage.CompletionTokens)*0.001
+		}))
+
+	rr := httptest.NewRecorder()
+	proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`)))
+
+	result := rr.Result()
+	if rr.Body.String() != body || result.Header.Get("Content-Length") != "" {
+		t.Errorf("response = %q (Content-Length %q), want the streamed body without a length", rr.Body.String(), result.Header.Get("Content-Length"))
+	}
+	if result.Header.Get(RequestCostHeader) != "" {
+		t.Errorf("%s was sent as a header before the body", RequestCostHeader)
+	}
+	if got := result.Trailer.Get(RequestCostHeader); got != "0.003" {
+		t.Errorf("%s trailer = %q, want 0.003", RequestCostHeader, got)
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestProxyHandler_SessionInfoPathsStayLocal(t *testing.T) {
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		t.Errorf("%s was forwarded upstream", r.Path)
+		return entities.ProxyResponse{StatusCode: http.StatusOK}
+	}}
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+
+	for _, path := range []string{"/v1/session/s1/status", "/v1/session/s1/usage", "/v1/session/s1/budget"} {
+		rr := httptest.NewRecorder()
+		proxyHandler.Handle(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", path, rr.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestProxyHandler_MultipartTooLarge(t *testing.T) {
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		t.Error("Push should not be called for oversized upload")
+		return entities.ProxyResponse{}
+	}}
+
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{MaxUploadBytes: 4})
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", strings.NewReader("0123456789"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestProxyHandler_ChunkedMultipartTooLarge(t *testing.T) {
+	var sent int64
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		// The upstream transport reads the stream until the limit trips
+		n, err := io.Copy(io.Discard, r.BodyStream)
+		sent = n
+		return entities.ProxyResponse{Err: err}
+	}}
+
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{MaxUploadBytes: 4})
+	req := httptest.NewRequest(http.MethodPost, "/v1/files", strings.NewReader("0123456789"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if sent > 4 {
+		t.Errorf("%d bytes were streamed upstream, want at most the 4 byte limit", sent)
+	}
+}
+
+func TestProxyHandler_BodyTooLarge(t *testing.T) {
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		t.Error("Push should not be called for oversized body")
+		return entities.ProxyResponse{}
+	}}
+
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{MaxBodyBytes: 8})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages":[]}`))
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	if !strings.Contains(rr.Body.String(), "maximum size of 8 bytes") {
+		t.Errorf("handler returned unexpected body: %q", rr.Body.String())
+	}
+}
+
+func TestProxyHandler_QueueDeadline(t *testing.T) {
+	var got entities.ProxyRequest
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		got = r
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{}`)}
+	}}
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set(QueueDeadlineHeader, "30")
+	rr := httptest.NewRecorder()
+	before := time.Now()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if got.Deadline.Before(before.Add(30*time.Second)) || got.Deadline.After(time.Now().Add(30*time.Second)) {
+		t.Errorf("request deadline = %v, want 30s from now", got.Deadline)
+	}
+	if got.Headers.Get(QueueDeadlineHeader) != "" {
+		t.Errorf("%s was forwarded upstream", QueueDeadlineHeader)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set(QueueDeadlineHeader, "soon")
+	rr = httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid deadline: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestProxyHandler_QueuePositionHeaders(t *testing.T) {
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		r.OnEnqueue(entities.QueueEstimate{Position: 4, DispatchAt: time.Now().Add(2 * time.Second)})
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{}`)}
+	}}
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+
+	proxyHandler.Handle(rr, req)
+
+	if got := rr.Header().Get(QueuePositionHeader); got != "4" {
+		t.Errorf("%s = %q, want %q", QueuePositionHeader, got, "4")
+	}
+	eta, err := strconv.ParseFloat(rr.Header().Get(QueueETAHeader), 64)
+	if err != nil || eta < 1.9 || eta > 2.1 {
+		t.Errorf("%s = %q, want about 2 seconds", QueueETAHeader, rr.Header().Get(QueueETAHeader))
+	}
+}
+
+func TestProxyHandler_TimingHeaders(t *testing.T) {
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		r.OnEnqueue(entities.QueueEstimate{Position: 1, DispatchAt: time.Now()})
+		return entities.ProxyResponse{
+			StatusCode:      http.StatusOK,
+			Headers:         http.Header{},
+			Body:            []byte(`{}`),
+			QueueWait:       1500 * time.Millisecond,
+			UpstreamLatency: 250 * time.Millisecond,
+		}
+	}}
+	proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+
+	rr := httptest.NewRecorder()
+	proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+
+	if got := rr.Header().Get(QueueWaitHeader); got != "1500" {
+		t.Errorf("%s = %q, want %q", QueueWaitHeader, got, "1500")
+	}
+	if got := rr.Header().Get(UpstreamLatencyHeader); got != "250" {
+		t.Errorf("%s = %q, want %q", UpstreamLatencyHeader, got, "250")
+	}
+}
+
+func Test_parseQueueDeadline(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"10", now.Add(10 * time.Second), false},
+		{"1.5", now.Add(1500 * time.Millisecond), false},
+		{"2025-01-01T12:05:00Z", now.Add(5 * time.Minute), false},
+		{"0", time.Time{}, true},
+		{"-3", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueueDeadline(tt.value, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseQueueDeadline(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseQueueDeadline(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_isBinaryContent(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/json; charset=utf-8", false},
+		{"text/event-stream", false},
+		{"application/problem+json", false},
+		{"application/octet-stream", true},
+		{"image/png", true},
+		{"audio/mpeg", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := isBinaryContent(tt.contentType); got != tt.want {
+				t.Errorf("isBinaryContent(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_extractSessionID(t *testing.T) {
 	tests := []struct {
 		name string
@@ -345,3 +1074,466 @@ func TestLegacyProxyHandler(t *testing.T) {
 			rr.Body.String(), expectedBody)
 	}
 }
+
+func TestProxyHandler_QueueErrorsUseEnvelope(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"queue full", fmt.Errorf("%w: 100 requests waiting", entities.ErrQueueFull), http.StatusTooManyRequests, "queue_full"},
+		{"session queue full", &entities.SessionQueueFullError{SessionID: "s1", Queued: 5, Max: 5}, http.StatusTooManyRequests, "queue_full"},
+		{"budget exceeded", entities.ErrBudgetExceeded, http.StatusTooManyRequests, "budget_exceeded"},
+		{"queue closed", entities.ErrQueueClosed, http.StatusServiceUnavailable, "queue_closed"},
+		{"residency violation", fmt.Errorf("%w: tenant acme requires region eu", entities.ErrResidencyViolation), http.StatusForbidden, "residency_violation"},
+		{"upload too large", &http.MaxBytesError{Limit: 8}, http.StatusRequestEntityTooLarge, "request_too_large"},
+		{"upstream failure", errors.New("connection refused"), http.StatusBadGateway, "upstream_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return entities.ProxyResponse{Err: tt.err}
+			}}
+			proxyHandler := NewProxyHandler(&mockProxySessionManager{}, mockQ, entities.ProxySettings{})
+
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+			var errResp entities.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil {
+				t.Fatalf("body is not an error envelope: %q", rr.Body.String())
+			}
+			if errResp.Error.Code == nil || *errResp.Error.Code != tt.wantCode {
+				t.Errorf("error code = %v, want %s", errResp.Error.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_RecordsResponseStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		resp        entities.ProxyResponse
+		wantStatus  int
+		wantMessage string
+		wantType    string
+	}{
+		{"success", entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}, http.StatusOK, "", ""},
+		{"upstream error", entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"error":{"message":"Rate limit reached","type":"requests"}}`)}, http.StatusTooManyRequests, "Rate limit reached", ""},
+		{"non-JSON upstream error", entities.ProxyResponse{StatusCode: http.StatusServiceUnavailable, Body: []byte("<html>down</html>")}, http.StatusServiceUnavailable, "", ""},
+		{"classified upstream error", entities.ProxyResponse{
+			StatusCode:    http.StatusServiceUnavailable,
+			Body:          []byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+			UpstreamError: &entities.UpstreamError{Type: entities.OverloadedErrorType, Message: "Overloaded"},
+		}, http.StatusServiceUnavailable, "Overloaded", entities.OverloadedErrorType},
+		{"proxy error", entities.ProxyResponse{Err: errors.New("connection refused")}, http.StatusBadGateway, "Proxy error: connection refused", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotStatus int
+			var gotMessage, gotType string
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				RecordResponseFunc: func(sessionID string, statusCode int, message, errorType string) error {
+					if sessionID != "s1" {
+						t.Errorf("RecordResponse session = %q, want s1", sessionID)
+					}
+					gotStatus, gotMessage, gotType = statusCode, message, errorType
+					return nil
+				},
+			}
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return tt.resp
+			}}
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
+
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{}`)))
+
+			if gotStatus != tt.wantStatus || gotMessage != tt.wantMessage || gotType != tt.wantType {
+				t.Errorf("RecordResponse(%d, %q, %q), want (%d, %q, %q)", gotStatus, gotMessage, gotType, tt.wantStatus, tt.wantMessage, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestProxyHandler_TenantNamespacesSessions(t *testing.T) {
+	var updated string
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			updated = sessionID
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	var pushed entities.ProxyRequest
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		pushed = r
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"usage":{"total_tokens":3}}`)}
+	}}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", strings.NewReader(`{}`))
+	req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+	proxyHandler.Handle(httptest.NewRecorder(), req)
+
+	if pushed.SessionID != "acme/s1" || pushed.TenantID != "acme" || pushed.Path != "/v1/chat/completions" {
+		t.Errorf("pushed session %q, tenant %q, path %q, want acme/s1, acme and /v1/chat/completions", pushed.SessionID, pushed.TenantID, pushed.Path)
+	}
+	if updated != "acme/s1" {
+		t.Errorf("UpdateSessionTokens session = %q, want acme/s1", updated)
+	}
+}
+
+type fakeSessionGrouper map[string]map[string]string
+
+func (f fakeSessionGrouper) SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error) {
+	f[sessionID] = metadata
+	return &entities.SessionData{SessionID: sessionID, Metadata: metadata}, nil
+}
+
+func TestProxyHandler_SessionGroups(t *testing.T) {
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			// s2 already belongs to u1 and is only moved to a project
+			if sessionID == "s2" {
+				return &entities.SessionData{SessionID: sessionID, Metadata: map[string]string{entities.UserIDMetadataKey: "u1"}}, nil
+			}
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	var pushed entities.ProxyRequest
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		pushed = r
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}}
+	groups := fakeSessionGrouper{}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithSessionGroups(groups)
+
+	for _, sessionID := range []string{"s1", "s2", "s3"} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/session/"+sessionID+"/chat/completions", strings.NewReader(`{}`))
+		if sessionID != "s3" {
+			req.Header.Set(UserIDHeader, "u1")
+			req.Header.Set(ProjectIDHeader, "p1")
+		} else {
+			// Annotations of the authorization service take precedence over headers
+			req.Header.Set(UserIDHeader, "u1")
+			req = req.WithContext(entities.ContextWithAnnotations(req.Context(), map[string]string{entities.UserIDMetadataKey: "u9", "department": "sales"}))
+		}
+		proxyHandler.Handle(httptest.NewRecorder(), req)
+
+		if pushed.Headers.Get(UserIDHeader) != "" || pushed.Headers.Get(ProjectIDHeader) != "" {
+			t.Errorf("%s: user and project headers were forwarded upstream: %v", sessionID, pushed.Headers)
+		}
+	}
+
+	want := fakeSessionGrouper{
+		"s1": {entities.UserIDMetadataKey: "u1", entities.ProjectIDMetadataKey: "p1"},
+		"s2": {entities.ProjectIDMetadataKey: "p1"},
+		"s3": {entities.UserIDMetadataKey: "u9", "department": "sales"},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("stored metadata = %v, want %v", groups, want)
+	}
+	for sessionID, metadata := range want {
+		if !maps.Equal(groups[sessionID], metadata) {
+			t.Errorf("metadata of %s = %v, want %v", sessionID, groups[sessionID], metadata)
+		}
+	}
+}
+
+func TestProxyHandler_DefaultModel(t *testing.T) {
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			if sessionID == "plain" {
+				return &entities.SessionData{SessionID: sessionID}, nil
+			}
+			return &entities.SessionData{SessionID: sessionID, Metadata: map[string]string{entities.DefaultModelMetadataKey: "gpt-4o-mini"}}, nil
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+	}
+	var pushed entities.ProxyRequest
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		pushed = r
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}
+	}}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
+
+	tests := []struct {
+		name      string
+		sessionID string
+		endpoint  string
+		body      string
+		wantModel string
+	}{
+		{"model omitted", "agent-1", "chat/completions", `{"messages":[]}`, "gpt-4o-mini"},
+		{"empty model", "agent-1", "embeddings", `{"model":"","input":"hi"}`, "gpt-4o-mini"},
+		{"model named", "agent-1", "chat/completions", `{"model":"o3","messages":[]}`, "o3"},
+		{"no default", "plain", "chat/completions", `{"messages":[]}`, ""},
+		{"endpoint without model", "agent-1", "threads", `{"messages":[]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/session/"+tt.sessionID+"/"+tt.endpoint, strings.NewReader(tt.body))
+			proxyHandler.Handle(httptest.NewRecorder(), req)
+			if got := entities.BodyModel(pushed.Body); got != tt.wantModel {
+				t.Errorf("forwarded model = %q, want %q (body %s)", got, tt.wantModel, pushed.Body)
+			}
+		})
+	}
+}
+
+type fakeThreadTracker struct {
+	sessions map[string]string
+	observed string
+}
+
+func (f *fakeThreadTracker) SessionFor(tenantID, threadID string) (string, bool) {
+	sessionID, ok := f.sessions[threadID]
+	return sessionID, ok
+}
+
+func (f *fakeThreadTracker) Observe(tenantID, sessionID string, responseBody []byte) (entities.TokenUsage, error) {
+	f.observed = sessionID
+	return entities.TokenUsage{PromptTokens: 2, CompletionTokens: 1, TotalTokens: 3}, nil
+}
+
+func TestProxyHandler_Threads(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		wantSession string
+		wantPath    string
+	}{
+		{"mapped thread", "/v1/threads/thread_a/runs", "agent-1", "/v1/threads/thread_a/runs"},
+		{"session URL", "/v1/session/agent-2/threads/thread_a/runs", "agent-2", "/v1/threads/thread_a/runs"},
+		{"unmapped thread", "/v1/threads/thread_b/runs", "", "/v1/threads/thread_b/runs"},
+		{"background response", "/v1/responses/resp_a", "agent-1", "/v1/responses/resp_a"},
+		{"response through a session", "/v1/session/agent-2/responses", "agent-2", "/v1/responses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated string
+			var updatedUsage entities.TokenUsage
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					updated, updatedUsage = sessionID, usage
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+					t.Error("EstimateTokenUsage() called for an Assistants API response")
+					return nil
+				},
+			}
+			var pushed entities.ProxyRequest
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				pushed = r
+				return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{"object":"thread.run"}`)}
+			}}
+			threads := &fakeThreadTracker{sessions: map[string]string{"thread_a": "agent-1", "resp_a": "agent-1"}}
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithThreads(threads)
+
+			proxyHandler.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{}`)))
+
+			if pushed.SessionID != tt.wantSession || pushed.Path != tt.wantPath {
+				t.Errorf("pushed session %q and path %q, want %q and %q", pushed.SessionID, pushed.Path, tt.wantSession, tt.wantPath)
+			}
+			if updated != tt.wantSession || threads.observed != tt.wantSession {
+				t.Errorf("usage recorded for session %q, observed for %q, want %q", updated, threads.observed, tt.wantSession)
+			}
+			if tt.wantSession != "" && updatedUsage.TotalTokens != 3 {
+				t.Errorf("recorded usage = %+v, want the run usage from the tracker", updatedUsage)
+			}
+		})
+	}
+}
+
+type fakePricer struct {
+	model string
+}
+
+func (f *fakePricer) Cost(model string, usage entities.TokenUsage) float64 {
+	f.model = model
+	return float64(usage.Characters) * 0.5
+}
+
+func TestProxyHandler_MediaUsage(t *testing.T) {
+	var updated entities.TokenUsage
+	var parsedPath string
+	mockSM := &mockProxySessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+			updated = usage
+			return &entities.SessionData{SessionID: sessionID}, nil
+		},
+		ParseMediaUsageFunc: func(path string, requestBody, responseBody []byte) *entities.TokenUsage {
+			parsedPath = path
+			return &entities.TokenUsage{Characters: 5}
+		},
+		EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+			t.Error("EstimateTokenUsage() called for a media response")
+			return nil
+		},
+	}
+	mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+		headers := http.Header{}
+		headers.Set("Content-Type", "audio/mpeg")
+		return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: headers, Body: []byte{0xff, 0xfb}}
+	}}
+	pricer := &fakePricer{}
+	proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithPricing(pricer)
+
+	rr := httptest.NewRecorder()
+	proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, "/v1/session/tts/audio/speech", strings.NewReader(`{"model":"tts-1","input":"Hello"}`)))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "\xff\xfb" {
+		t.Errorf("response = %d %q, want the audio passed through", rr.Code, rr.Body.String())
+	}
+	if parsedPath != "/v1/audio/speech" || pricer.model != "tts-1" {
+		t.Errorf("measured path %q priced on model %q, want /v1/audio/speech on tts-1", parsedPath, pricer.model)
+	}
+	if updated.Characters != 5 || updated.Cost != 2.5 {
+		t.Errorf("recorded usage = %+v, want 5 characters costing 2.5", updated)
+	}
+	if got := rr.Header().Get(RequestCostHeader); got != "2.5" {
+		t.Errorf("%s = %q, want 2.5", RequestCostHeader, got)
+	}
+}
+
+type pricerFunc func(model string, usage entities.TokenUsage) float64
+
+func (f pricerFunc) Cost(model string, usage entities.TokenUsage) float64 {
+	return f(model, usage)
+}
+
+func TestProxyHandler_CostHeader(t *testing.T) {
+	pricer := pricerFunc(func(model string, usage entities.TokenUsage) float64 {
+		if model != "gpt-4o" {
+			t.Errorf("priced on model %q, want gpt-4o", model)
+		}
+		return float64(usage.PromptTokens)*0.0001 + float64(usage.CompletionTokens)*0.001
+	})
+	tests := []struct {
+		name   string
+		path   string
+		pricer Pricer
+		resp   entities.ProxyResponse
+		want   string
+	}{
+		{"session request", "/v1/session/s1/chat/completions", pricer,
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)}, "0.003"},
+		{"passthrough request", "/v1/chat/completions", pricer,
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)}, "0.003"},
+		{"cached response", "/v1/chat/completions", pricer,
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`), Cached: true}, "0"},
+		{"upstream error", "/v1/chat/completions", pricer,
+			entities.ProxyResponse{StatusCode: http.StatusBadRequest, Body: []byte(`{"error":{"message":"bad"}}`)}, ""},
+		{"no pricing", "/v1/session/s1/chat/completions", nil,
+			entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recorded int
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					recorded++
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+			}
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return tt.resp
+			}}
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{})
+			if tt.pricer != nil {
+				proxyHandler.WithPricing(tt.pricer)
+			}
+
+			rr := httptest.NewRecorder()
+			proxyHandler.Handle(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"model":"gpt-4o"}`)))
+
+			if got := rr.Header().Get(RequestCostHeader); got != tt.want {
+				t.Errorf("%s = %q, want %q", RequestCostHeader, got, tt.want)
+			}
+			if strings.HasPrefix(tt.path, "/v1/session/") != (recorded > 0) {
+				t.Errorf("session usage recorded %d times for %s", recorded, tt.path)
+			}
+		})
+	}
+}
+
+type fakeFineTuneTracker struct {
+	tracked []string
+}
+
+func (f *fakeFineTuneTracker) Track(sessionID string, responseBody []byte) error {
+	f.tracked = append(f.tracked, sessionID)
+	return nil
+}
+
+func TestProxyHandler_FineTuning(t *testing.T) {
+	tests := []struct {
+		method      string
+		path        string
+		wantTracked int
+	}{
+		{http.MethodPost, "/v1/session/trainer/fine_tuning/jobs", 1},
+		{http.MethodGet, "/v1/session/trainer/fine_tuning/jobs/ftjob-1", 0},
+		{http.MethodPost, "/v1/session/trainer/fine_tuning/jobs/ftjob-1/cancel", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var updated []entities.TokenUsage
+			mockSM := &mockProxySessionManager{
+				GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				UpdateSessionTokensFunc: func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error) {
+					updated = append(updated, usage)
+					return &entities.SessionData{SessionID: sessionID}, nil
+				},
+				EstimateTokenUsageFunc: func(requestBody, responseBody []byte) *entities.TokenUsage {
+					t.Error("EstimateTokenUsage() called for a fine-tuning response")
+					return nil
+				},
+			}
+			mockQ := &mockQueue{PushFunc: func(r entities.ProxyRequest) entities.ProxyResponse {
+				return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{"id":"ftjob-1","object":"fine_tuning.job","status":"queued"}`)}
+			}}
+			fineTunes := &fakeFineTuneTracker{}
+			proxyHandler := NewProxyHandler(mockSM, mockQ, entities.ProxySettings{}).WithFineTuning(fineTunes)
+
+			proxyHandler.Handle(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`)))
+
+			if len(fineTunes.tracked) != tt.wantTracked {
+				t.Errorf("tracked %v, want %d jobs", fineTunes.tracked, tt.wantTracked)
+			}
+			if len(updated) != 1 || !reflect.DeepEqual(updated[0], entities.TokenUsage{}) {
+				t.Errorf("recorded usage %+v, want one request without tokens", updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Pruner interface {
+	Prune() (entities.PruneResult, error)
+}
+
+// PruneHandler deletes expired stored data on demand
+type PruneHandler struct {
+	pruner Pruner
+}
+
+// NewPruneHandler creates a new PruneHandler with injected dependencies
+func NewPruneHandler(pruner Pruner) *PruneHandler {
+	return &PruneHandler{
+		pruner: pruner,
+	}
+}
+
+// Handle prunes on POST and returns how many rows of each kind were deleted
+func (ph *PruneHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := ph.pruner.Prune()
+	if err != nil {
+		log.Printf("Error pruning stored data: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding prune result: %v", err)
+	}
+}
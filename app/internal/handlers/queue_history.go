@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type QueueHistorySource interface {
+	Minutes(queue string) []entities.QueueMinute
+}
+
+// QueueHistoryHandler reports the per-minute statistics of the queues
+type QueueHistoryHandler struct {
+	history QueueHistorySource
+}
+
+// NewQueueHistoryHandler creates a new QueueHistoryHandler with injected dependencies
+func NewQueueHistoryHandler(history QueueHistorySource) *QueueHistoryHandler {
+	return &QueueHistoryHandler{
+		history: history,
+	}
+}
+
+// Handle returns the recorded minutes, oldest first; ?queue= selects a queue
+func (qh *QueueHistoryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(qh.history.Minutes(r.URL.Query().Get("queue"))); err != nil {
+		log.Printf("Error encoding queue history: %v", err)
+	}
+}
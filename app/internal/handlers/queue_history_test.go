@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type fixedQueueHistory []entities.QueueMinute
+
+func (f fixedQueueHistory) Minutes(queue string) []entities.QueueMinute {
+	var minutes []entities.QueueMinute
+	for _, m := range f {
+		if queue == "" || m.Queue == queue {
+			minutes = append(minutes, m)
+		}
+	}
+	return minutes
+}
+
+func TestQueueHistoryHandler_Handle(t *testing.T) {
+	handler := NewQueueHistoryHandler(fixedQueueHistory{
+		{Queue: "batch", Dispatched: 10},
+		{Queue: "default", Dispatched: 3, Errors: 1},
+	})
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/queues/history?queue=default", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handle() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var minutes []entities.QueueMinute
+	if err := json.Unmarshal(rr.Body.Bytes(), &minutes); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(minutes) != 1 || minutes[0].Queue != "default" || minutes[0].Errors != 1 {
+		t.Errorf("Handle() = %+v, want the default queue's minute", minutes)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/queues/history", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
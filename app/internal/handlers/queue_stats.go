@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type QueueStatsSource interface {
+	Stats() entities.QueueStats
+}
+
+// QueueStatsHandler reports the depth and rate-limit utilization of the queues
+type QueueStatsHandler struct {
+	queues []QueueStatsSource
+}
+
+// NewQueueStatsHandler creates a new QueueStatsHandler with injected dependencies
+func NewQueueStatsHandler(queues ...QueueStatsSource) *QueueStatsHandler {
+	return &QueueStatsHandler{
+		queues: queues,
+	}
+}
+
+// Handle returns the statistics of every queue, ordered by name
+func (qh *QueueStatsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats := make([]entities.QueueStats, 0, len(qh.queues))
+	for _, q := range qh.queues {
+		stats = append(stats, q.Stats())
+	}
+	slices.SortFunc(stats, func(a, b entities.QueueStats) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding queue stats: %v", err)
+	}
+}
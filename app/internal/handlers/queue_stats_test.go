@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type fixedQueueStats entities.QueueStats
+
+func (f fixedQueueStats) Stats() entities.QueueStats {
+	return entities.QueueStats(f)
+}
+
+func TestQueueStatsHandler_Handle(t *testing.T) {
+	handler := NewQueueStatsHandler(
+		fixedQueueStats{Name: "default", Depth: 3, RequestsPerMinute: 60, RequestsLastMinute: 30, RequestUtilization: 0.5},
+		fixedQueueStats{Name: "batch", RequestsPerMinute: 10},
+	)
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/queues", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handle() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var stats []entities.QueueStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Name != "batch" || stats[1].Name != "default" || stats[1].Depth != 3 || stats[1].RequestUtilization != 0.5 {
+		t.Errorf("Handle() = %s, want batch and default ordered by name", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/queues", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
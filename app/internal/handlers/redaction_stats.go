@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type RedactionStatsSource interface {
+	Stats() []entities.RedactionStats
+	SessionStats(sessionID string) entities.RedactionStats
+}
+
+// RedactionStatsHandler reports how many values were redacted per session
+type RedactionStatsHandler struct {
+	source RedactionStatsSource
+}
+
+// NewRedactionStatsHandler creates a new RedactionStatsHandler with injected dependencies
+func NewRedactionStatsHandler(source RedactionStatsSource) *RedactionStatsHandler {
+	return &RedactionStatsHandler{
+		source: source,
+	}
+}
+
+// Handle returns the redaction counts of all sessions, or of one with ?session_id=
+func (rh *RedactionStatsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{}
+	if sessionID := r.URL.Query().Get("session_id"); sessionID != "" {
+		result = rh.source.SessionStats(sessionID)
+	} else {
+		result = rh.source.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding redaction stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type RequestHistorySource interface {
+	ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error)
+}
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// RequestHistoryHandler lists recorded requests
+type RequestHistoryHandler struct {
+	source RequestHistorySource
+}
+
+// NewRequestHistoryHandler creates a new RequestHistoryHandler with injected dependencies
+func NewRequestHistoryHandler(source RequestHistorySource) *RequestHistoryHandler {
+	return &RequestHistoryHandler{
+		source: source,
+	}
+}
+
+// Handle returns the most recent requests; ?session_id= selects a session,
+// ?replay_of= the replays of a record and ?limit= how many
+func (hh *RequestHistoryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := entities.HistoryQuery{
+		SessionID: r.URL.Query().Get("session_id"),
+		Limit:     defaultHistoryLimit,
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		query.Limit = min(parsed, maxHistoryLimit)
+	}
+	if value := r.URL.Query().Get("replay_of"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid replay_of", http.StatusBadRequest)
+			return
+		}
+		query.ReplayOf = parsed
+	}
+
+	records, err := hh.source.ListRequestRecords(query)
+	if err != nil {
+		log.Printf("Error listing request history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		log.Printf("Error encoding request history: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type RequestReplayer interface {
+	Replay(id int64, options entities.ReplayOptions) (*entities.ReplayResult, error)
+}
+
+// maxReplayOptionsBytes bounds the body of replay requests
+const maxReplayOptionsBytes = 64 << 10
+
+// RequestReplayHandler re-sends recorded requests
+type RequestReplayHandler struct {
+	replayer RequestReplayer
+}
+
+// NewRequestReplayHandler creates a new RequestReplayHandler with injected dependencies
+func NewRequestReplayHandler(replayer RequestReplayer) *RequestReplayHandler {
+	return &RequestReplayHandler{
+		replayer: replayer,
+	}
+}
+
+// Handle handles POST /history/{id}/replay. The optional JSON body overrides
+// the model and the upstream; the response holds the replay's outcome and the
+// original record.
+func (rh *RequestReplayHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid record ID", http.StatusBadRequest)
+		return
+	}
+	var options entities.ReplayOptions
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxReplayOptionsBytes)).Decode(&options); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := rh.replayer.Replay(id, options)
+	switch {
+	case errors.Is(err, entities.ErrRequestRecordNotFound):
+		http.Error(w, "Request record not found", http.StatusNotFound)
+		return
+	case errors.Is(err, entities.ErrUnknownUpstream):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, entities.ErrNotReplayable):
+		http.Error(w, "Request cannot be replayed: "+err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error replaying request %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
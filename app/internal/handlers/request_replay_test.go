@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type requestReplayerFunc func(id int64, options entities.ReplayOptions) (*entities.ReplayResult, error)
+
+func (f requestReplayerFunc) Replay(id int64, options entities.ReplayOptions) (*entities.ReplayResult, error) {
+	return f(id, options)
+}
+
+func TestRequestReplayHandler_Handle(t *testing.T) {
+	replayer := requestReplayerFunc(func(id int64, options entities.ReplayOptions) (*entities.ReplayResult, error) {
+		switch {
+		case id == 404:
+			return nil, entities.ErrRequestRecordNotFound
+		case id == 409:
+			return nil, entities.ErrNotReplayable
+		case options.Upstream == "hedge":
+			return nil, fmt.Errorf("%w %q", entities.ErrUnknownUpstream, options.Upstream)
+		}
+		return &entities.ReplayResult{ReplayOf: id, Upstream: "primary", Model: options.Model, StatusCode: http.StatusOK}, nil
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/history/{id}/replay", NewRequestReplayHandler(replayer).Handle)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "replay", method: http.MethodPost, path: "/history/7/replay", want: http.StatusOK},
+		{name: "model override", method: http.MethodPost, path: "/history/7/replay", body: `{"model":"gpt-4o-mini"}`, want: http.StatusOK},
+		{name: "wrong method", method: http.MethodGet, path: "/history/7/replay", want: http.StatusMethodNotAllowed},
+		{name: "invalid id", method: http.MethodPost, path: "/history/abc/replay", want: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, path: "/history/7/replay", body: `{"model":`, want: http.StatusBadRequest},
+		{name: "unknown upstream", method: http.MethodPost, path: "/history/7/replay", body: `{"upstream":"hedge"}`, want: http.StatusBadRequest},
+		{name: "missing record", method: http.MethodPost, path: "/history/404/replay", want: http.StatusNotFound},
+		{name: "body not captured", method: http.MethodPost, path: "/history/409/replay", want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var result entities.ReplayResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.ReplayOf != 7 {
+				t.Errorf("body = %s, want the replay of record 7", rec.Body.String())
+			}
+			if tt.body != "" && result.Model != "gpt-4o-mini" {
+				t.Errorf("model = %q, want the override", result.Model)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionAnomalySource interface {
+	Anomalies(limit int) []entities.SessionAnomaly
+}
+
+const (
+	defaultAnomaliesLimit = 50
+	maxAnomaliesLimit     = 100
+)
+
+// SessionAnomaliesHandler lists the sessions flagged for consuming tokens far
+// above their baseline
+type SessionAnomaliesHandler struct {
+	source SessionAnomalySource
+}
+
+// NewSessionAnomaliesHandler creates a new SessionAnomaliesHandler with injected dependencies
+func NewSessionAnomaliesHandler(source SessionAnomalySource) *SessionAnomaliesHandler {
+	return &SessionAnomaliesHandler{
+		source: source,
+	}
+}
+
+// Handle returns the latest anomalies, newest first; ?limit= selects how many
+func (ah *SessionAnomaliesHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultAnomaliesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxAnomaliesLimit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ah.source.Anomalies(limit)); err != nil {
+		log.Printf("Error encoding session anomalies: %v", err)
+	}
+}
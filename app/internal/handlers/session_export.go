@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// maxImportLineBytes bounds a line of a session import
+const maxImportLineBytes = 16 << 20
+
+type SessionExportStore interface {
+	ListSessions() (map[string]*entities.SessionData, error)
+	ImportSession(sess entities.SessionData, overwrite bool) (bool, error)
+}
+
+// SessionExportHandler exports sessions as JSONL and imports them, to move
+// them between repository backends or deployments
+type SessionExportHandler struct {
+	store SessionExportStore
+	now   func() time.Time
+}
+
+// NewSessionExportHandler creates a new SessionExportHandler with injected dependencies
+func NewSessionExportHandler(store SessionExportStore) *SessionExportHandler {
+	return &SessionExportHandler{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// HandleExport returns every session as a line of JSON, sorted by ID
+func (eh *SessionExportHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessions, err := eh.store.ListSessions()
+	if err != nil {
+		log.Printf("Error listing sessions for export: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sessions-%s.jsonl"`, eh.now().UTC().Format("20060102T150405Z")))
+	if err := entities.WriteSessionExport(w, sessions); err != nil {
+		log.Printf("Error writing session export: %v", err)
+	}
+}
+
+// HandleImport stores the sessions of a JSONL export. The whole body is
+// validated before anything is stored. Existing sessions are skipped unless
+// ?overwrite=true.
+func (eh *SessionExportHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	overwrite := false
+	if value := r.URL.Query().Get("overwrite"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid overwrite", http.StatusBadRequest)
+			return
+		}
+		overwrite = parsed
+	}
+
+	var sessions []entities.SessionData
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var line entities.SessionExport
+		switch err := json.Unmarshal(scanner.Bytes(), &line); {
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Line %d is not valid JSON: %v", n, err), http.StatusBadRequest)
+			return
+		case line.SchemaVersion < 1 || line.SchemaVersion > entities.SessionExportVersion:
+			http.Error(w, fmt.Sprintf("Line %d has unsupported schema_version %d, expected 1 to %d",
+				n, line.SchemaVersion, entities.SessionExportVersion), http.StatusBadRequest)
+			return
+		case line.Session.SessionID == "":
+			http.Error(w, fmt.Sprintf("Line %d has no session_id", n), http.StatusBadRequest)
+			return
+		}
+		sessions = append(sessions, line.Session)
+	}
+	if err := scanner.Err(); err != nil {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result entities.SessionImportResult
+	for _, sess := range sessions {
+		imported, err := eh.store.ImportSession(sess, overwrite)
+		if err != nil {
+			log.Printf("Error importing session %s: %v", sess.SessionID, err)
+			http.Error(w, fmt.Sprintf("Failed to import session %s after importing %d", sess.SessionID, result.Imported),
+				http.StatusInternalServerError)
+			return
+		}
+		if imported {
+			result.Imported++
+		} else {
+			result.Skipped++
+		}
+	}
+	log.Printf("Imported %d sessions, skipped %d existing ones", result.Imported, result.Skipped)
+	writeJSON(w, http.StatusOK, result)
+}
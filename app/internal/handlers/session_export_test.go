@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestSessionExportHandler(t *testing.T) {
+	source := repository.NewMemoryRepository()
+	source.UpdateSessionTokens("agent-2", entities.TokenUsage{TotalTokens: 20})
+	source.UpdateSessionTokens("agent-1", entities.TokenUsage{TotalTokens: 100})
+	source.SetSessionMetadata("agent-1", map[string]string{"team": "search"})
+
+	rec := httptest.NewRecorder()
+	NewSessionExportHandler(source).HandleExport(rec, httptest.NewRequest(http.MethodGet, "/sessions/export", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("export status = %d, headers %v", rec.Code, rec.Header())
+	}
+	export := rec.Body.String()
+	lines := strings.Split(strings.TrimSpace(export), "\n")
+	var first entities.SessionExport
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &first) != nil ||
+		first.SchemaVersion != entities.SessionExportVersion || first.Session.SessionID != "agent-1" {
+		t.Fatalf("export = %s, want two versioned lines sorted by ID", export)
+	}
+
+	target := repository.NewMemoryRepository()
+	target.UpdateSessionTokens("agent-2", entities.TokenUsage{TotalTokens: 5})
+	handler := NewSessionExportHandler(target)
+	importLines := func(query, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.HandleImport(rec, httptest.NewRequest(http.MethodPost, "/sessions/import"+query, strings.NewReader(body)))
+		return rec
+	}
+
+	rec = importLines("", export)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"imported":1,"skipped":1}` {
+		t.Fatalf("import status = %d, body %s", rec.Code, rec.Body)
+	}
+	sess, _ := target.GetSession("agent-1")
+	if sess.TotalTokens != 100 || sess.Metadata["team"] != "search" {
+		t.Errorf("imported session = %+v", sess)
+	}
+	if sess, _ := target.GetSession("agent-2"); sess.TotalTokens != 5 {
+		t.Errorf("existing session has %d tokens, want it kept at 5", sess.TotalTokens)
+	}
+
+	if rec := importLines("?overwrite=true", export); rec.Code != http.StatusOK {
+		t.Fatalf("overwrite status = %d, body %s", rec.Code, rec.Body)
+	}
+	if sess, _ := target.GetSession("agent-2"); sess.TotalTokens != 20 {
+		t.Errorf("overwritten session has %d tokens, want 20", sess.TotalTokens)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{"newer schema", "\n" + `{"schema_version":2,"session":{"session_id":"agent-3"}}`, "Line 2"},
+		{"missing session ID", `{"schema_version":1,"session":{}}`, "Line 1"},
+		{"invalid JSON", lines[0] + "\n{", "Line 2"},
+	} {
+		rec := importLines("", tt.body)
+		if rec.Code != http.StatusBadRequest || !strings.HasPrefix(rec.Body.String(), tt.want) {
+			t.Errorf("%s: status = %d, body %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+	if _, err := target.GetSession("agent-3"); err == nil {
+		t.Error("a rejected import stored sessions")
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionGroupSummarizer interface {
+	SummarizeGroup(tenantID, key, id string) (*entities.SessionGroupUsage, error)
+}
+
+// SessionGroupHandler rolls up the usage of the sessions grouped under a user
+// or project by a session metadata key
+type SessionGroupHandler struct {
+	summarizer SessionGroupSummarizer
+	key        string
+}
+
+// NewSessionGroupHandler creates a new SessionGroupHandler for the sessions
+// grouped by the metadata key
+func NewSessionGroupHandler(summarizer SessionGroupSummarizer, key string) *SessionGroupHandler {
+	return &SessionGroupHandler{
+		summarizer: summarizer,
+		key:        key,
+	}
+}
+
+// HandleUsage handles GET /users/{id}/usage and /projects/{id}/usage with the
+// totals and per-session usage of the group's sessions. Tenants see their own
+// sessions.
+func (gh *SessionGroupHandler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing "+gh.key, "invalid_request_error", "")
+		return
+	}
+
+	tenantID := entities.TenantFromContext(r.Context())
+	group, err := gh.summarizer.SummarizeGroup(tenantID, gh.key, id)
+	if err != nil {
+		log.Printf("Error summarizing sessions of %s %s: %v", gh.key, id, err)
+		writeError(w, http.StatusInternalServerError, "Failed to summarize sessions", "server_error", "session_error")
+		return
+	}
+	if group.Sessions == 0 {
+		writeError(w, http.StatusNotFound, "No sessions found for "+gh.key+" "+id, "invalid_request_error", "not_found")
+		return
+	}
+	if tenantID != "" {
+		for i := range group.SessionUsage {
+			_, group.SessionUsage[i].SessionID = entities.SplitTenantSessionID(group.SessionUsage[i].SessionID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(group); err != nil {
+		log.Printf("Error encoding session group usage: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type groupSummarizerFunc func(tenantID, key, id string) (*entities.SessionGroupUsage, error)
+
+func (f groupSummarizerFunc) SummarizeGroup(tenantID, key, id string) (*entities.SessionGroupUsage, error) {
+	return f(tenantID, key, id)
+}
+
+func TestSessionGroupHandler_HandleUsage(t *testing.T) {
+	var gotTenant, gotKey, gotID string
+	handler := NewSessionGroupHandler(groupSummarizerFunc(func(tenantID, key, id string) (*entities.SessionGroupUsage, error) {
+		gotTenant, gotKey, gotID = tenantID, key, id
+		switch id {
+		case "broken":
+			return nil, errors.New("database is locked")
+		case "nobody":
+			return &entities.SessionGroupUsage{GroupKey: key, GroupID: id, SessionUsage: []entities.SessionRank{}}, nil
+		}
+		prefix := ""
+		if tenantID != "" {
+			prefix = tenantID + "/"
+		}
+		return &entities.SessionGroupUsage{GroupKey: key, GroupID: id, Sessions: 1, TotalTokens: 42,
+			SessionUsage: []entities.SessionRank{{SessionID: prefix + "s1", TotalTokens: 42}}}, nil
+	}), entities.UserIDMetadataKey)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/{id}/usage", handler.HandleUsage)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		tenantID   string
+		wantStatus int
+	}{
+		{"usage", http.MethodGet, "/users/u1/usage", "", http.StatusOK},
+		{"tenant", http.MethodGet, "/users/u1/usage", "acme", http.StatusOK},
+		{"no sessions", http.MethodGet, "/users/nobody/usage", "", http.StatusNotFound},
+		{"storage error", http.MethodGet, "/users/broken/usage", "", http.StatusInternalServerError},
+		{"wrong method", http.MethodPost, "/users/u1/usage", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.tenantID != "" {
+				req = req.WithContext(entities.ContextWithTenant(req.Context(), tt.tenantID))
+			}
+			rr := httptest.NewRecorder()
+
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", rr.Code, rr.Body.String(), tt.wantStatus)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			if gotTenant != tt.tenantID || gotKey != entities.UserIDMetadataKey || gotID != "u1" {
+				t.Errorf("SummarizeGroup(%q, %q, %q), want %q, user_id, u1", gotTenant, gotKey, gotID, tt.tenantID)
+			}
+			var group entities.SessionGroupUsage
+			if err := json.Unmarshal(rr.Body.Bytes(), &group); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+			if group.GroupID != "u1" || group.TotalTokens != 42 || len(group.SessionUsage) != 1 || group.SessionUsage[0].SessionID != "s1" {
+				t.Errorf("body = %s, want u1 with session s1", rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionMetadataStore interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+	SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error)
+}
+
+// SessionMetadataHandler reads and updates session metadata, such as the
+// billing customer a session's usage is reported for
+type SessionMetadataHandler struct {
+	store SessionMetadataStore
+}
+
+// NewSessionMetadataHandler creates a new SessionMetadataHandler with injected dependencies
+func NewSessionMetadataHandler(store SessionMetadataStore) *SessionMetadataHandler {
+	return &SessionMetadataHandler{
+		store: store,
+	}
+}
+
+// Handle returns the metadata of the session named by ?session_id= on GET, and
+// merges a JSON object of string values into it on PATCH; empty values remove keys
+func (mh *SessionMetadataHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		http.Error(w, "Missing session_id", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		sess *entities.SessionData
+		err  error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		sess, err = mh.store.GetSession(sessionID)
+	case http.MethodPatch:
+		var metadata map[string]string
+		if errDecode := json.NewDecoder(r.Body).Decode(&metadata); errDecode != nil {
+			http.Error(w, "Body must be a JSON object of string values", http.StatusBadRequest)
+			return
+		}
+		sess, err = mh.store.SetSessionMetadata(sessionID, metadata)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, entities.ErrSessionNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error accessing metadata of session %s: %v", sessionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	metadata := sess.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(metadata); err != nil {
+		log.Printf("Error encoding session metadata: %v", err)
+	}
+}
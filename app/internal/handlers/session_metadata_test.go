@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestSessionMetadataHandler(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.CreateSession("s1")
+	handler := NewSessionMetadataHandler(repo)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"set", http.MethodPatch, "/sessions/metadata?session_id=s1", `{"stripe_customer_id":"cus_1","team":"a"}`, http.StatusOK, `{"stripe_customer_id":"cus_1","team":"a"}`},
+		{"remove key", http.MethodPatch, "/sessions/metadata?session_id=s1", `{"team":""}`, http.StatusOK, `{"stripe_customer_id":"cus_1"}`},
+		{"get", http.MethodGet, "/sessions/metadata?session_id=s1", "", http.StatusOK, `{"stripe_customer_id":"cus_1"}`},
+		{"non-string value", http.MethodPatch, "/sessions/metadata?session_id=s1", `{"team":1}`, http.StatusBadRequest, ""},
+		{"unknown session", http.MethodPatch, "/sessions/metadata?session_id=s2", `{"team":"a"}`, http.StatusNotFound, ""},
+		{"missing session_id", http.MethodGet, "/sessions/metadata", "", http.StatusBadRequest, ""},
+		{"wrong method", http.MethodDelete, "/sessions/metadata?session_id=s1", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.Handle(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rr.Body.String()) != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionMigrationStore interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+	CreateSession(sessionID string) (*entities.SessionData, error)
+	SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error)
+	MergeSessions(sourceID, targetID string) (*entities.SessionData, error)
+}
+
+// BudgetMatcher gives a session the token budget of another
+type BudgetMatcher interface {
+	Match(source, target, reason string) (*entities.BudgetTransfer, error)
+}
+
+// SessionMigrationHandler clones sessions into new IDs and merges sessions
+type SessionMigrationHandler struct {
+	store   SessionMigrationStore
+	budgets BudgetMatcher
+}
+
+// NewSessionMigrationHandler creates a new SessionMigrationHandler with injected dependencies
+func NewSessionMigrationHandler(store SessionMigrationStore) *SessionMigrationHandler {
+	return &SessionMigrationHandler{
+		store: store,
+	}
+}
+
+// WithBudgets makes clones take the budget of their session
+func (mh *SessionMigrationHandler) WithBudgets(budgets BudgetMatcher) *SessionMigrationHandler {
+	mh.budgets = budgets
+	return mh
+}
+
+// sessionPair is the body of the clone and merge requests
+type sessionPair struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// decodePair reads the session IDs of a clone or merge request, writing the
+// error response if they are missing
+func decodePair(w http.ResponseWriter, r *http.Request) (sessionPair, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return sessionPair{}, false
+	}
+	var pair sessionPair
+	if err := json.NewDecoder(r.Body).Decode(&pair); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return sessionPair{}, false
+	}
+	if pair.From == "" || pair.To == "" || pair.From == pair.To {
+		http.Error(w, "from and to must be two different session IDs", http.StatusBadRequest)
+		return sessionPair{}, false
+	}
+	return pair, true
+}
+
+// HandleClone creates the session to with the metadata of the session from,
+// including its default model, and with its budget. Usage is not copied.
+func (mh *SessionMigrationHandler) HandleClone(w http.ResponseWriter, r *http.Request) {
+	pair, ok := decodePair(w, r)
+	if !ok {
+		return
+	}
+	source, err := mh.store.GetSession(pair.From)
+	if err != nil {
+		writeMigrationError(w, "cloning", pair, err)
+		return
+	}
+	if _, err := mh.store.GetSession(pair.To); !errors.Is(err, entities.ErrSessionNotFound) {
+		if err == nil {
+			err = entities.ErrSessionExists
+		}
+		writeMigrationError(w, "cloning", pair, err)
+		return
+	}
+	clone, err := mh.store.CreateSession(pair.To)
+	if err == nil && len(source.Metadata) > 0 {
+		clone, err = mh.store.SetSessionMetadata(pair.To, source.Metadata)
+	}
+	if err == nil && mh.budgets != nil {
+		_, err = mh.budgets.Match(pair.From, pair.To, "clone of "+pair.From)
+	}
+	if err != nil {
+		writeMigrationError(w, "cloning", pair, err)
+		return
+	}
+	log.Printf("Cloned session %s into %s", pair.From, pair.To)
+	writeJSON(w, http.StatusCreated, clone)
+}
+
+// HandleMerge adds the usage of the session from to the session to, moves
+// its request history, transcript, jobs and threads there, and deletes it
+func (mh *SessionMigrationHandler) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	pair, ok := decodePair(w, r)
+	if !ok {
+		return
+	}
+	merged, err := mh.store.MergeSessions(pair.From, pair.To)
+	if err != nil {
+		writeMigrationError(w, "merging", pair, err)
+		return
+	}
+	log.Printf("Merged session %s into %s", pair.From, pair.To)
+	writeJSON(w, http.StatusOK, merged)
+}
+
+// writeMigrationError writes the response to a failed clone or merge
+func writeMigrationError(w http.ResponseWriter, action string, pair sessionPair, err error) {
+	switch {
+	case errors.Is(err, entities.ErrSessionNotFound):
+		http.Error(w, "Session not found", http.StatusNotFound)
+	case errors.Is(err, entities.ErrSessionExists):
+		http.Error(w, "Session already exists", http.StatusConflict)
+	default:
+		log.Printf("Error %s session %s into %s: %v", action, pair.From, pair.To, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/budget"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestSessionMigrationHandler(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.UpdateSessionTokens("agent-1", entities.TokenUsage{TotalTokens: 100})
+	repo.SetSessionMetadata("agent-1", map[string]string{entities.DefaultModelMetadataKey: "gpt-4o-mini"})
+	repo.UpdateSessionTokens("legacy-id", entities.TokenUsage{TotalTokens: 50})
+	ledger := budget.NewLedger(entities.SessionBudgets{Default: 1000, Sessions: map[string]int{"agent-1": 5000}}, repo)
+	handler := NewSessionMigrationHandler(repo).WithBudgets(ledger)
+	serve := func(handle http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handle(rec, httptest.NewRequest(http.MethodPost, "/sessions/clone", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(handler.HandleClone, `{"from":"agent-1","to":"agent-2"}`)
+	var clone entities.SessionData
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &clone) != nil {
+		t.Fatalf("clone status = %d, body %s", rec.Code, rec.Body)
+	}
+	if clone.SessionID != "agent-2" || clone.TotalTokens != 0 || clone.Metadata[entities.DefaultModelMetadataKey] != "gpt-4o-mini" {
+		t.Errorf("clone = %+v, want the metadata without the usage", clone)
+	}
+	if got := ledger.BudgetFor("agent-2"); got != 5000 {
+		t.Errorf("budget of the clone = %d, want 5000", got)
+	}
+
+	rec = serve(handler.HandleMerge, `{"from":"legacy-id","to":"agent-1"}`)
+	var merged entities.SessionData
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &merged) != nil || merged.TotalTokens != 150 {
+		t.Errorf("merge status = %d, body %s, want 150 tokens", rec.Code, rec.Body)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		handle http.HandlerFunc
+		body   string
+		want   int
+	}{
+		{"clone into an existing session", handler.HandleClone, `{"from":"agent-1","to":"agent-2"}`, http.StatusConflict},
+		{"clone of an unknown session", handler.HandleClone, `{"from":"missing","to":"agent-3"}`, http.StatusNotFound},
+		{"merge of a merged session", handler.HandleMerge, `{"from":"legacy-id","to":"agent-1"}`, http.StatusNotFound},
+		{"same session", handler.HandleMerge, `{"from":"agent-1","to":"agent-1"}`, http.StatusBadRequest},
+		{"invalid body", handler.HandleClone, `{`, http.StatusBadRequest},
+	} {
+		if rec := serve(tt.handle, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -17,86 +19,323 @@ type SessionManager interface {
 	ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error)
 }
 
+// SessionFinder searches sessions in the backend
+type SessionFinder interface {
+	FindSessions(filter entities.SessionFilter) (map[string]*entities.SessionData, error)
+}
+
+// TranscriptSource lists the captured turns of a session
+type TranscriptSource interface {
+	ListTranscript(sessionID string, limit int) ([]entities.TranscriptTurn, error)
+}
+
+// BudgetSource returns the token budgets of sessions
+type BudgetSource interface {
+	BudgetFor(sessionID string) int
+}
+
+// BudgetBlocker reports the sessions whose requests are rejected for their budget
+type BudgetBlocker interface {
+	Blocked(sessionID string) bool
+}
+
+// sessionFilterParams are the /sessions/status query parameters that filter
+// the list through the SessionFinder
+var sessionFilterParams = []string{"min_tokens", "min_cost", "active_since", "tag"}
+
 // SessionStatusHandler handles requests to get session statistics
 type SessionStatusHandler struct {
 	sessionManager SessionManager
+	budgets        BudgetSource
+	blocker        BudgetBlocker
+	finder         SessionFinder
+	transcripts    TranscriptSource
+	now            func() time.Time
 }
 
 // NewSessionStatusHandler creates a new SessionStatusHandler with injected dependencies
 func NewSessionStatusHandler(sessionManager SessionManager) *SessionStatusHandler {
 	return &SessionStatusHandler{
 		sessionManager: sessionManager,
+		budgets:        entities.SessionBudgets{},
+		now:            time.Now,
 	}
 }
 
+// WithSessionFinder enables the filters of /sessions/status
+func (ssh *SessionStatusHandler) WithSessionFinder(finder SessionFinder) *SessionStatusHandler {
+	ssh.finder = finder
+	return ssh
+}
+
+// WithBudgets sets the token budgets reported on /v1/session/{id}/budget
+func (ssh *SessionStatusHandler) WithBudgets(budgets BudgetSource) *SessionStatusHandler {
+	ssh.budgets = budgets
+	return ssh
+}
+
+// WithBudgetBlocker reports on /v1/session/{id}/budget whether the session
+// is blocked
+func (ssh *SessionStatusHandler) WithBudgetBlocker(blocker BudgetBlocker) *SessionStatusHandler {
+	ssh.blocker = blocker
+	return ssh
+}
+
+// WithTranscripts enables /v1/session/{id}/transcript
+func (ssh *SessionStatusHandler) WithTranscripts(transcripts TranscriptSource) *SessionStatusHandler {
+	ssh.transcripts = transcripts
+	return ssh
+}
+
 // HandleSingle handles requests to get specific session statistics
 func (ssh *SessionStatusHandler) HandleSingle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
 		return
 	}
 
 	// Check if specific session ID is requested: /v1/session/{sessionID}/status
-	sessionID := extractSessionID(r.URL.Path)
+	tenantID := entities.TenantFromContext(r.Context())
+	sessionID := entities.TenantSessionID(tenantID, extractSessionID(r.URL.Path))
 
 	w.Header().Set("Content-Type", "application/json")
 
 	if sessionID != "" {
 		// Return specific session data
-		sessionData, errGet := ssh.sessionManager.GetSession(sessionID)
-		if errGet != nil {
-			if errors.Is(errGet, entities.ErrSessionNotFound) {
-				http.Error(w, "Session not found", http.StatusNotFound)
-			} else {
-				log.Printf("Error retrieving session %s: %v", sessionID, errGet)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-			}
+		sessionData, ok := ssh.session(w, r)
+		if !ok {
 			return
 		}
-
 		if err := json.NewEncoder(w).Encode(sessionData); err != nil {
 			log.Printf("Error encoding session data: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
 		}
 	} else {
-		// Return all sessions
-		allSessions, errList := ssh.sessionManager.ListSessions()
+		// Return all sessions, or those selected by the filter parameters
+		var allSessions map[string]*entities.SessionData
+		var errList error
+		if ssh.finder != nil && hasSessionFilter(r) {
+			filter, errFilter := ssh.sessionFilter(r)
+			if errFilter != nil {
+				writeError(w, http.StatusBadRequest, errFilter.Error(), "invalid_request_error", "")
+				return
+			}
+			filter.TenantID = tenantID
+			allSessions, errList = ssh.finder.FindSessions(filter)
+		} else {
+			allSessions, errList = ssh.sessionManager.ListSessions()
+		}
 		if errList != nil {
 			log.Printf("Error listing sessions: %v", errList)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve sessions", "server_error", "session_error")
 			return
 		}
+		if tenantID != "" {
+			allSessions = tenantSessions(tenantID, allSessions)
+		}
 		if err := json.NewEncoder(w).Encode(allSessions); err != nil {
 			log.Printf("Error encoding sessions data: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// hasSessionFilter reports whether the request has any filter parameter
+func hasSessionFilter(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range sessionFilterParams {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionFilter parses ?min_tokens=, ?min_cost=, ?tag= and ?active_since=,
+// which is an RFC 3339 time or a duration before now such as 24h
+func (ssh *SessionStatusHandler) sessionFilter(r *http.Request) (entities.SessionFilter, error) {
+	query := r.URL.Query()
+	filter := entities.SessionFilter{Tag: query.Get("tag")}
+	if value := query.Get("min_tokens"); value != "" {
+		minTokens, err := strconv.Atoi(value)
+		if err != nil || minTokens < 0 {
+			return filter, errors.New("Invalid min_tokens")
+		}
+		filter.MinTokens = minTokens
+	}
+	if value := query.Get("min_cost"); value != "" {
+		minCost, err := strconv.ParseFloat(value, 64)
+		if err != nil || minCost < 0 {
+			return filter, errors.New("Invalid min_cost")
+		}
+		filter.MinCost = minCost
+	}
+	if value := query.Get("active_since"); value != "" {
+		if since, err := time.Parse(time.RFC3339, value); err == nil {
+			filter.ActiveSince = since
+		} else if window, err := time.ParseDuration(value); err == nil && window > 0 {
+			filter.ActiveSince = ssh.now().Add(-window)
+		} else {
+			return filter, errors.New("Invalid active_since, expected an RFC 3339 time or a duration such as 24h")
+		}
+	}
+	return filter, nil
+}
+
+// HandleUsage handles GET /v1/session/{sessionID}/usage with the session's
+// token usage
+func (ssh *SessionStatusHandler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+	sessionData, ok := ssh.session(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entities.SessionUsage{
+		SessionID:        sessionData.SessionID,
+		PromptTokens:     sessionData.TotalPromptTokens,
+		CompletionTokens: sessionData.TotalCompletionTokens,
+		TotalTokens:      sessionData.TotalTokens,
+		EstimatedTokens:  sessionData.EstimatedTokens,
+		RequestCount:     sessionData.RequestCount,
+		TotalCost:        sessionData.TotalCost,
+	}); err != nil {
+		log.Printf("Error encoding session usage: %v", err)
+	}
+}
+
+// HandleBudget handles GET /v1/session/{sessionID}/budget with the session's
+// token budget and the tokens left in it
+func (ssh *SessionStatusHandler) HandleBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+	sessionData, ok := ssh.session(w, r)
+	if !ok {
+		return
+	}
+	// Budgets are keyed by the tenant-qualified session ID
+	qualifiedID := entities.TenantSessionID(entities.TenantFromContext(r.Context()), sessionData.SessionID)
+	status := entities.SessionBudgetStatus{
+		SessionID:  sessionData.SessionID,
+		Budget:     ssh.budgets.BudgetFor(qualifiedID),
+		UsedTokens: sessionData.TotalTokens,
+	}
+	if status.Budget > 0 {
+		remaining := max(status.Budget-status.UsedTokens, 0)
+		status.RemainingTokens = &remaining
+		status.Exceeded = status.UsedTokens >= status.Budget
+		status.OverdraftTokens = max(status.UsedTokens-status.Budget, 0)
+		status.Blocked = ssh.blocker != nil && ssh.blocker.Blocked(qualifiedID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Error encoding session budget: %v", err)
+	}
+}
+
+// HandleTranscript handles GET /v1/session/{sessionID}/transcript with the
+// session's latest captured turns, oldest first; ?limit= sets how many
+func (ssh *SessionStatusHandler) HandleTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+	if ssh.transcripts == nil {
+		writeError(w, http.StatusNotFound, "Session endpoint is not available", "invalid_request_error", "not_found")
+		return
+	}
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid limit", "invalid_request_error", "")
 			return
 		}
+		limit = min(parsed, maxHistoryLimit)
+	}
+	sessionData, ok := ssh.session(w, r)
+	if !ok {
+		return
+	}
+	qualifiedID := entities.TenantSessionID(entities.TenantFromContext(r.Context()), sessionData.SessionID)
+	turns, err := ssh.transcripts.ListTranscript(qualifiedID, limit)
+	if err != nil {
+		log.Printf("Error listing the transcript of session %s: %v", qualifiedID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve transcript", "server_error", "session_error")
+		return
+	}
+	for i := range turns {
+		turns[i].SessionID = sessionData.SessionID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entities.SessionTranscript{SessionID: sessionData.SessionID, Turns: turns}); err != nil {
+		log.Printf("Error encoding session transcript: %v", err)
+	}
+}
+
+// session returns the session addressed by a /v1/session/{sessionID}/...
+// path, identified without its tenant prefix, or writes the error response
+func (ssh *SessionStatusHandler) session(w http.ResponseWriter, r *http.Request) (*entities.SessionData, bool) {
+	tenantID := entities.TenantFromContext(r.Context())
+	sessionID := entities.TenantSessionID(tenantID, extractSessionID(r.URL.Path))
+	sessionData, errGet := ssh.sessionManager.GetSession(sessionID)
+	if errGet != nil {
+		if errors.Is(errGet, entities.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, "Session not found", "invalid_request_error", "session_not_found")
+		} else {
+			log.Printf("Error retrieving session %s: %v", sessionID, errGet)
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve session", "server_error", "session_error")
+		}
+		return nil, false
+	}
+
+	if tenantID != "" {
+		scoped := *sessionData
+		_, scoped.SessionID = entities.SplitTenantSessionID(scoped.SessionID)
+		sessionData = &scoped
 	}
+	return sessionData, true
 }
 
 // HandleList handles the /sessions/status endpoint to list all sessions
 func (ssh *SessionStatusHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
 		return
 	}
 
 	allSessions, errList := ssh.sessionManager.ListSessions()
 	if errList != nil {
 		log.Printf("Error listing sessions: %v", errList)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve sessions", "server_error", "session_error")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(allSessions); err != nil {
 		log.Printf("Error encoding all sessions data: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
 }
 
+// tenantSessions returns the sessions of a tenant keyed and identified by
+// their IDs without the tenant prefix
+func tenantSessions(tenantID string, sessions map[string]*entities.SessionData) map[string]*entities.SessionData {
+	scoped := make(map[string]*entities.SessionData)
+	for id, sess := range sessions {
+		owner, sessionID := entities.SplitTenantSessionID(id)
+		if owner != tenantID {
+			continue
+		}
+		stripped := *sess
+		stripped.SessionID = sessionID
+		scoped[sessionID] = &stripped
+	}
+	return scoped
+}
+
 // Legacy functions for backward compatibility
 func SessionStatusHandler_Legacy(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "SessionStatusHandler requires dependency injection. Use NewSessionStatusHandler instead.", http.StatusInternalServerError)
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -78,7 +79,7 @@ func TestSessionStatusHandler_HandleList(t *testing.T) {
 				}
 			},
 			expectedStatusCode: http.StatusInternalServerError,
-			expectedBody:       "Internal server error\n",
+			expectedBody:       `"code":"session_error"`,
 		},
 	}
 
@@ -160,3 +161,235 @@ func TestSessionStatusHandler_HandleSingle(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionStatusHandler_TenantScoped(t *testing.T) {
+	sessions := map[string]*entities.SessionData{
+		"acme/s1": {SessionID: "acme/s1", TotalTokens: 10},
+		"beta/s1": {SessionID: "beta/s1", TotalTokens: 20},
+		"s1":      {SessionID: "s1", TotalTokens: 30},
+	}
+	handler := NewSessionStatusHandler(&mockSessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			if sess, ok := sessions[sessionID]; ok {
+				return sess, nil
+			}
+			return nil, entities.ErrSessionNotFound
+		},
+		ListSessionsFunc: func() (map[string]*entities.SessionData, error) {
+			return sessions, nil
+		},
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{"single", "/v1/session/s1/status", `{"session_id":"s1","total_prompt_tokens":0,"total_completion_tokens":0,"total_tokens":10,"request_count":0}`},
+		{"list", "/sessions/status", `{"s1":{"session_id":"s1","total_prompt_tokens":0,"total_completion_tokens":0,"total_tokens":10,"request_count":0}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+			rr := httptest.NewRecorder()
+
+			handler.HandleSingle(rr, req)
+
+			if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != tt.wantBody {
+				t.Errorf("HandleSingle = %d %s, want 200 %s", rr.Code, rr.Body.String(), tt.wantBody)
+			}
+			if sessions["acme/s1"].SessionID != "acme/s1" {
+				t.Errorf("HandleSingle modified the stored session ID")
+			}
+		})
+	}
+}
+
+type budgetBlockerFunc func(sessionID string) bool
+
+func (f budgetBlockerFunc) Blocked(sessionID string) bool {
+	return f(sessionID)
+}
+
+func TestSessionStatusHandler_UsageAndBudget(t *testing.T) {
+	sessions := map[string]*entities.SessionData{
+		"s1":      {SessionID: "s1", TotalPromptTokens: 40, TotalCompletionTokens: 20, TotalTokens: 60, RequestCount: 3},
+		"acme/s2": {SessionID: "acme/s2", TotalTokens: 150},
+		"free":    {SessionID: "free", TotalTokens: 5},
+	}
+	handler := NewSessionStatusHandler(&mockSessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			if sess, ok := sessions[sessionID]; ok {
+				return sess, nil
+			}
+			return nil, entities.ErrSessionNotFound
+		},
+	}).WithBudgets(entities.SessionBudgets{Sessions: map[string]int{"s1": 100, "acme/s2": 100}}).
+		WithBudgetBlocker(budgetBlockerFunc(func(sessionID string) bool { return sessionID == "acme/s2" }))
+
+	tests := []struct {
+		name       string
+		handle     func(http.ResponseWriter, *http.Request)
+		tenantID   string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"usage", handler.HandleUsage, "", "/v1/session/s1/usage", http.StatusOK,
+			`{"session_id":"s1","prompt_tokens":40,"completion_tokens":20,"total_tokens":60,"request_count":3}`},
+		{"budget", handler.HandleBudget, "", "/v1/session/s1/budget", http.StatusOK,
+			`{"session_id":"s1","budget":100,"used_tokens":60,"remaining_tokens":40,"exceeded":false}`},
+		{"exceeded tenant budget", handler.HandleBudget, "acme", "/v1/session/s2/budget", http.StatusOK,
+			`{"session_id":"s2","budget":100,"used_tokens":150,"remaining_tokens":0,"exceeded":true,"overdraft_tokens":50,"blocked":true}`},
+		{"unlimited", handler.HandleBudget, "", "/v1/session/free/budget", http.StatusOK,
+			`{"session_id":"free","budget":0,"used_tokens":5,"exceeded":false}`},
+		{"unknown session", handler.HandleUsage, "", "/v1/session/missing/usage", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(entities.ContextWithTenant(req.Context(), tt.tenantID))
+			rr := httptest.NewRecorder()
+
+			tt.handle(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rr.Body.String()) != tt.wantBody {
+				t.Errorf("body = %s, want %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+type transcriptSourceFunc func(sessionID string, limit int) ([]entities.TranscriptTurn, error)
+
+func (f transcriptSourceFunc) ListTranscript(sessionID string, limit int) ([]entities.TranscriptTurn, error) {
+	return f(sessionID, limit)
+}
+
+func TestSessionStatusHandler_HandleTranscript(t *testing.T) {
+	manager := &mockSessionManager{
+		GetSessionFunc: func(sessionID string) (*entities.SessionData, error) {
+			if sessionID == "acme/agent" {
+				return &entities.SessionData{SessionID: sessionID}, nil
+			}
+			return nil, entities.ErrSessionNotFound
+		},
+	}
+	var gotID string
+	var gotLimit int
+	source := transcriptSourceFunc(func(sessionID string, limit int) ([]entities.TranscriptTurn, error) {
+		gotID, gotLimit = sessionID, limit
+		return []entities.TranscriptTurn{{
+			ID:         7,
+			SessionID:  sessionID,
+			Path:       "/v1/chat/completions",
+			Prompt:     json.RawMessage(`[{"role":"user","content":"Hi"}]`),
+			Completion: []json.RawMessage{json.RawMessage(`{"role":"assistant","content":"Hello"}`)},
+			CreatedAt:  time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		}}, nil
+	})
+
+	get := func(handler *SessionStatusHandler, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+		rr := httptest.NewRecorder()
+		handler.HandleTranscript(rr, req)
+		return rr
+	}
+
+	handler := NewSessionStatusHandler(manager).WithTranscripts(source)
+	rr := get(handler, "/v1/session/agent/transcript?limit=5000")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+	want := `{"session_id":"agent","turns":[{"id":7,"session_id":"agent","path":"/v1/chat/completions",` +
+		`"prompt":[{"role":"user","content":"Hi"}],"completion":[{"role":"assistant","content":"Hello"}],"created_at":"2024-01-15T10:00:00Z"}]}`
+	if got := strings.TrimSpace(rr.Body.String()); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+	if gotID != "acme/agent" || gotLimit != maxHistoryLimit {
+		t.Errorf("listed (%q, %d), want the tenant's session and the maximum limit", gotID, gotLimit)
+	}
+
+	if rr := get(handler, "/v1/session/missing/transcript"); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown session: status = %d, want 404", rr.Code)
+	}
+	if rr := get(handler, "/v1/session/agent/transcript?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit: status = %d, want 400", rr.Code)
+	}
+	if rr := get(NewSessionStatusHandler(manager), "/v1/session/agent/transcript"); rr.Code != http.StatusNotFound {
+		t.Errorf("without transcripts: status = %d, want 404", rr.Code)
+	}
+}
+
+type sessionFinderFunc func(filter entities.SessionFilter) (map[string]*entities.SessionData, error)
+
+func (f sessionFinderFunc) FindSessions(filter entities.SessionFilter) (map[string]*entities.SessionData, error) {
+	return f(filter)
+}
+
+func TestSessionStatusHandler_FiltersList(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var got entities.SessionFilter
+	handler := NewSessionStatusHandler(&mockSessionManager{
+		ListSessionsFunc: func() (map[string]*entities.SessionData, error) {
+			return nil, errors.New("ListSessions should not be called with filters")
+		},
+	}).WithSessionFinder(sessionFinderFunc(func(filter entities.SessionFilter) (map[string]*entities.SessionData, error) {
+		got = filter
+		return map[string]*entities.SessionData{"acme/batch:1": {SessionID: "acme/batch:1", TotalTokens: 900}}, nil
+	}))
+	handler.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantFilter entities.SessionFilter
+	}{
+		{"thresholds", "min_tokens=500&min_cost=0.25&tag=batch", http.StatusOK,
+			entities.SessionFilter{TenantID: "acme", Tag: "batch", MinTokens: 500, MinCost: 0.25}},
+		{"active since duration", "active_since=24h", http.StatusOK,
+			entities.SessionFilter{TenantID: "acme", ActiveSince: now.Add(-24 * time.Hour)}},
+		{"active since time", "active_since=2026-02-28T00:00:00Z", http.StatusOK,
+			entities.SessionFilter{TenantID: "acme", ActiveSince: time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC)}},
+		{"invalid min tokens", "min_tokens=lots", http.StatusBadRequest, entities.SessionFilter{}},
+		{"invalid min cost", "min_cost=-1", http.StatusBadRequest, entities.SessionFilter{}},
+		{"invalid active since", "active_since=yesterday", http.StatusBadRequest, entities.SessionFilter{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = entities.SessionFilter{}
+			req := httptest.NewRequest(http.MethodGet, "/sessions/status?"+tt.query, nil)
+			req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+			rr := httptest.NewRecorder()
+
+			handler.HandleSingle(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("HandleSingle status = %d %s, want %d", rr.Code, rr.Body.String(), tt.wantStatus)
+			}
+			if !got.ActiveSince.Equal(tt.wantFilter.ActiveSince) {
+				t.Errorf("filter active since = %v, want %v", got.ActiveSince, tt.wantFilter.ActiveSince)
+			}
+			got.ActiveSince, tt.wantFilter.ActiveSince = time.Time{}, time.Time{}
+			if got != tt.wantFilter {
+				t.Errorf("filter = %+v, want %+v", got, tt.wantFilter)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var sessions map[string]*entities.SessionData
+			if err := json.Unmarshal(rr.Body.Bytes(), &sessions); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+			if sess, ok := sessions["batch:1"]; !ok || sess.SessionID != "batch:1" {
+				t.Errorf("sessions = %s, want batch:1 without the tenant prefix", rr.Body.String())
+			}
+		})
+	}
+}
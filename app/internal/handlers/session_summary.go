@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type SessionSummarizer interface {
+	SummarizeSessions(query entities.SessionSummaryQuery) (*entities.SessionSummary, error)
+}
+
+const (
+	defaultSummaryLimit = 10
+	maxSummaryLimit     = 100
+)
+
+// SessionSummaryHandler reports totals and top sessions
+type SessionSummaryHandler struct {
+	summarizer SessionSummarizer
+	now        func() time.Time
+}
+
+// NewSessionSummaryHandler creates a new SessionSummaryHandler with injected dependencies
+func NewSessionSummaryHandler(summarizer SessionSummarizer) *SessionSummaryHandler {
+	return &SessionSummaryHandler{
+		summarizer: summarizer,
+		now:        time.Now,
+	}
+}
+
+// Handle returns the totals of all sessions and the top ?limit= sessions by
+// tokens, cost, requests and error rate. ?window= (e.g. 24h) restricts them
+// to sessions with requests within the window. Tenants see their own sessions.
+func (sh *SessionSummaryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", "invalid_request_error", "")
+		return
+	}
+
+	tenantID := entities.TenantFromContext(r.Context())
+	query := entities.SessionSummaryQuery{TenantID: tenantID, Limit: defaultSummaryLimit}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid limit", "invalid_request_error", "")
+			return
+		}
+		query.Limit = min(parsed, maxSummaryLimit)
+	}
+	if value := r.URL.Query().Get("window"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid window, expected a duration such as 24h", "invalid_request_error", "")
+			return
+		}
+		query.ActiveSince = sh.now().Add(-window)
+	}
+
+	summary, err := sh.summarizer.SummarizeSessions(query)
+	if err != nil {
+		log.Printf("Error summarizing sessions: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to summarize sessions", "server_error", "session_error")
+		return
+	}
+	if tenantID != "" {
+		for _, list := range [][]entities.SessionRank{summary.TopByTokens, summary.TopByCost, summary.TopByRequests, summary.TopByErrorRate} {
+			for i := range list {
+				_, list[i].SessionID = entities.SplitTenantSessionID(list[i].SessionID)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		log.Printf("Error encoding session summary: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type summarizerFunc func(query entities.SessionSummaryQuery) (*entities.SessionSummary, error)
+
+func (f summarizerFunc) SummarizeSessions(query entities.SessionSummaryQuery) (*entities.SessionSummary, error) {
+	return f(query)
+}
+
+func TestSessionSummaryHandler_Handle(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var got entities.SessionSummaryQuery
+	handler := NewSessionSummaryHandler(summarizerFunc(func(query entities.SessionSummaryQuery) (*entities.SessionSummary, error) {
+		got = query
+		if query.Limit == 99 {
+			return nil, errors.New("database is locked")
+		}
+		return &entities.SessionSummary{
+			Sessions:    1,
+			TopByTokens: []entities.SessionRank{{SessionID: query.TenantID + "/s1", TotalTokens: 10}},
+		}, nil
+	}))
+	handler.now = func() time.Time { return now }
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantQuery  entities.SessionSummaryQuery
+	}{
+		{"defaults", "/sessions/summary", http.StatusOK, entities.SessionSummaryQuery{TenantID: "acme", Limit: defaultSummaryLimit}},
+		{"window and limit", "/sessions/summary?window=24h&limit=500", http.StatusOK,
+			entities.SessionSummaryQuery{TenantID: "acme", ActiveSince: now.Add(-24 * time.Hour), Limit: maxSummaryLimit}},
+		{"invalid window", "/sessions/summary?window=yesterday", http.StatusBadRequest, entities.SessionSummaryQuery{}},
+		{"invalid limit", "/sessions/summary?limit=0", http.StatusBadRequest, entities.SessionSummaryQuery{}},
+		{"store error", "/sessions/summary?limit=99", http.StatusInternalServerError, entities.SessionSummaryQuery{TenantID: "acme", Limit: 99}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = entities.SessionSummaryQuery{}
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req = req.WithContext(entities.ContextWithTenant(req.Context(), "acme"))
+			rr := httptest.NewRecorder()
+
+			handler.Handle(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if got != tt.wantQuery {
+				t.Errorf("query = %+v, want %+v", got, tt.wantQuery)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var summary entities.SessionSummary
+			if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+				t.Fatalf("response is not a summary: %v", err)
+			}
+			if summary.TopByTokens[0].SessionID != "s1" {
+				t.Errorf("top session = %q, want it without the tenant prefix", summary.TopByTokens[0].SessionID)
+			}
+		})
+	}
+}
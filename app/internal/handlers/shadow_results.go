@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type ShadowResultsSource interface {
+	ListShadowResults(limit int) ([]entities.ShadowResult, error)
+}
+
+const (
+	defaultShadowResultsLimit = 50
+	maxShadowResultsLimit     = 1000
+)
+
+// ShadowResultsHandler lists stored shadow traffic results for comparison
+type ShadowResultsHandler struct {
+	source ShadowResultsSource
+}
+
+// NewShadowResultsHandler creates a new ShadowResultsHandler with injected dependencies
+func NewShadowResultsHandler(source ShadowResultsSource) *ShadowResultsHandler {
+	return &ShadowResultsHandler{
+		source: source,
+	}
+}
+
+// Handle returns the most recent shadow results; ?limit= selects how many
+func (sh *ShadowResultsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultShadowResultsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxShadowResultsLimit)
+	}
+
+	results, err := sh.source.ListShadowResults(limit)
+	if err != nil {
+		log.Printf("Error listing shadow results: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error encoding shadow results: %v", err)
+	}
+}
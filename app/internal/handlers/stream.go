@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"strings"
+)
+
+// copyStreamedBody copies an upstream body the queue did not buffer to the
+// client and closes it. Up to keep bytes are retained on the way through; the
+// body is returned only if it fit, so that usage is never parsed from a
+// truncated document.
+func copyStreamedBody(w io.Writer, stream io.ReadCloser, keep int64) []byte {
+	defer stream.Close()
+	retained := &boundedBuffer{limit: keep}
+	n, err := io.Copy(w, io.TeeReader(stream, retained))
+	if err != nil {
+		log.Printf("Error streaming response body after %d bytes: %v", n, err)
+		return nil
+	}
+	log.Printf("Streamed response body from upstream: %d bytes", n)
+	if retained.overflow {
+		return nil
+	}
+	return retained.buf.Bytes()
+}
+
+// boundedBuffer keeps what is written to it until the limit is exceeded, and
+// then drops it all. It never fails, so it cannot interrupt the copy it tees.
+type boundedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if int64(b.buf.Len()+len(p)) > b.limit {
+		b.overflow = true
+		b.buf = bytes.Buffer{}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// isJSONContent reports whether a response content type is JSON; a missing
+// content type is assumed to be JSON
+func isJSONContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type TenantService interface {
+	CreateTenant(tenant entities.Tenant) (*entities.Tenant, error)
+	UpdateTenant(id string, update entities.TenantUpdate) (*entities.Tenant, error)
+	GetTenant(id string) (*entities.Tenant, error)
+	ListTenants() ([]entities.Tenant, error)
+	DeleteTenant(id string) error
+	IssueKey(tenantID string, req entities.VirtualKeyRequest) (*entities.IssuedKey, error)
+	UpdateKey(tenantID, id string, update entities.VirtualKeyUpdate) (*entities.VirtualKey, error)
+	ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error)
+	DeleteVirtualKey(tenantID, id string) error
+	Usage(tenantID string) (*entities.TenantUsage, error)
+}
+
+// TenantsHandler manages tenants, their upstream keys and their virtual keys
+type TenantsHandler struct {
+	tenants TenantService
+}
+
+// NewTenantsHandler creates a new TenantsHandler with injected dependencies
+func NewTenantsHandler(tenants TenantService) *TenantsHandler {
+	return &TenantsHandler{
+		tenants: tenants,
+	}
+}
+
+// Handle serves the tenant routes:
+//
+//	GET, POST          /tenants
+//	GET, PATCH, DELETE /tenants/{id}
+//	GET                /tenants/{id}/usage
+//	GET, POST          /tenants/{id}/keys
+//	PATCH, DELETE      /tenants/{id}/keys/{keyID}
+//
+// Upstream API keys, of tenants and of virtual keys, are masked in responses.
+// The plaintext of a virtual key is only returned by the POST that creates it.
+func (th *TenantsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tenants"), "/")
+	var parts []string
+	if rest != "" {
+		parts = strings.Split(rest, "/")
+	}
+
+	switch {
+	case len(parts) == 0:
+		th.handleCollection(w, r)
+	case len(parts) == 1:
+		th.handleTenant(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "usage":
+		th.handleUsage(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "keys":
+		th.handleKeys(w, r, parts[0])
+	case len(parts) == 3 && parts[1] == "keys":
+		th.handleKey(w, r, parts[0], parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (th *TenantsHandler) handleCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tenants, err := th.tenants.ListTenants()
+		if err != nil {
+			th.fail(w, "listing tenants", err)
+			return
+		}
+		masked := make([]entities.Tenant, 0, len(tenants))
+		for _, tenant := range tenants {
+			masked = append(masked, tenant.Masked())
+		}
+		writeJSON(w, http.StatusOK, masked)
+	case http.MethodPost:
+		var tenant entities.Tenant
+		if err := json.NewDecoder(r.Body).Decode(&tenant); err != nil {
+			http.Error(w, "Invalid tenant: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !entities.ValidTenantID(tenant.ID) {
+			http.Error(w, "Tenant id must be 1-63 lowercase letters, digits, '-' or '_'", http.StatusBadRequest)
+			return
+		}
+		if tenant.RequestsPerMinute < 0 {
+			http.Error(w, "requests_per_minute must not be negative", http.StatusBadRequest)
+			return
+		}
+		created, err := th.tenants.CreateTenant(tenant)
+		if err != nil {
+			th.fail(w, "creating tenant "+tenant.ID, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (th *TenantsHandler) handleTenant(w http.ResponseWriter, r *http.Request, id string) {
+	var (
+		tenant *entities.Tenant
+		err    error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		tenant, err = th.tenants.GetTenant(id)
+	case http.MethodPatch:
+		var update entities.TenantUpdate
+		if errDecode := json.NewDecoder(r.Body).Decode(&update); errDecode != nil {
+			http.Error(w, "Invalid tenant update: "+errDecode.Error(), http.StatusBadRequest)
+			return
+		}
+		if update.RequestsPerMinute != nil && *update.RequestsPerMinute < 0 {
+			http.Error(w, "requests_per_minute must not be negative", http.StatusBadRequest)
+			return
+		}
+		tenant, err = th.tenants.UpdateTenant(id, update)
+	case http.MethodDelete:
+		if err := th.tenants.DeleteTenant(id); err != nil {
+			th.fail(w, "deleting tenant "+id, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		th.fail(w, "accessing tenant "+id, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tenant.Masked())
+}
+
+func (th *TenantsHandler) handleUsage(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	usage, err := th.tenants.Usage(id)
+	if err != nil {
+		th.fail(w, "getting usage of tenant "+id, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func (th *TenantsHandler) handleKeys(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if _, err := th.tenants.GetTenant(id); err != nil {
+			th.fail(w, "accessing tenant "+id, err)
+			return
+		}
+		keys, err := th.tenants.ListVirtualKeys(id)
+		if err != nil {
+			th.fail(w, "listing keys of tenant "+id, err)
+			return
+		}
+		masked := make([]entities.VirtualKey, 0, len(keys))
+		for _, key := range keys {
+			masked = append(masked, key.Masked())
+		}
+		writeJSON(w, http.StatusOK, masked)
+	case http.MethodPost:
+		var body entities.VirtualKeyRequest
+		// The body is optional; a key needs no name
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid key request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if !validUpstreamKeys(body.UpstreamAPIKeys) {
+			http.Error(w, "upstream_api_keys must not contain empty keys", http.StatusBadRequest)
+			return
+		}
+		issued, err := th.tenants.IssueKey(id, body)
+		if err != nil {
+			th.fail(w, "issuing key for tenant "+id, err)
+			return
+		}
+		issued.VirtualKey = issued.VirtualKey.Masked()
+		writeJSON(w, http.StatusCreated, issued)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (th *TenantsHandler) handleKey(w http.ResponseWriter, r *http.Request, id, keyID string) {
+	switch r.Method {
+	case http.MethodPatch:
+		var update entities.VirtualKeyUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid key update: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if update.UpstreamAPIKeys != nil && !validUpstreamKeys(*update.UpstreamAPIKeys) {
+			http.Error(w, "upstream_api_keys must not contain empty keys", http.StatusBadRequest)
+			return
+		}
+		key, err := th.tenants.UpdateKey(id, keyID, update)
+		if err != nil {
+			th.fail(w, "updating key "+keyID, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, key.Masked())
+	case http.MethodDelete:
+		if err := th.tenants.DeleteVirtualKey(id, keyID); err != nil {
+			th.fail(w, "revoking key "+keyID, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validUpstreamKeys reports whether a virtual key's upstream keys are all set
+func validUpstreamKeys(keys []string) bool {
+	for _, key := range keys {
+		if strings.TrimSpace(key) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// fail maps a service error to a response
+func (th *TenantsHandler) fail(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, entities.ErrTenantNotFound):
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+	case errors.Is(err, entities.ErrVirtualKeyNotFound):
+		http.Error(w, "Key not found", http.StatusNotFound)
+	case errors.Is(err, entities.ErrTenantExists):
+		http.Error(w, "Tenant already exists", http.StatusConflict)
+	default:
+		log.Printf("Error %s: %v", action, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
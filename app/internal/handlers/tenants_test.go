@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+)
+
+func TestTenantsHandler(t *testing.T) {
+	handler := NewTenantsHandler(tenant.NewService(repository.NewMemoryRepository()))
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Handle(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"create", http.MethodPost, "/tenants", `{"id":"acme","name":"Acme","upstream_api_key":"sk-acme-secret"}`, http.StatusCreated, `"upstream_api_key":"...cret"`},
+		{"create duplicate", http.MethodPost, "/tenants", `{"id":"acme"}`, http.StatusConflict, ""},
+		{"create invalid id", http.MethodPost, "/tenants", `{"id":"Acme/1"}`, http.StatusBadRequest, ""},
+		{"list", http.MethodGet, "/tenants", "", http.StatusOK, `"id":"acme"`},
+		{"update", http.MethodPatch, "/tenants/acme", `{"requests_per_minute":120}`, http.StatusOK, `"requests_per_minute":120`},
+		{"negative limit", http.MethodPatch, "/tenants/acme", `{"requests_per_minute":-1}`, http.StatusBadRequest, ""},
+		{"get", http.MethodGet, "/tenants/acme", "", http.StatusOK, `"name":"Acme"`},
+		{"get missing", http.MethodGet, "/tenants/beta", "", http.StatusNotFound, ""},
+		{"usage", http.MethodGet, "/tenants/acme/usage", "", http.StatusOK, `"tenant_id":"acme"`},
+		{"no keys", http.MethodGet, "/tenants/acme/keys", "", http.StatusOK, `[]`},
+		{"issue key for missing tenant", http.MethodPost, "/tenants/beta/keys", "", http.StatusNotFound, ""},
+		{"revoke missing key", http.MethodDelete, "/tenants/acme/keys/k1", "", http.StatusNotFound, ""},
+		{"unknown route", http.MethodGet, "/tenants/acme/other", "", http.StatusNotFound, ""},
+		{"wrong method", http.MethodPut, "/tenants/acme", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := do(tt.method, tt.target, tt.body)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	if rr := do(http.MethodPost, "/tenants/acme/keys", `{"upstream_api_keys":[""]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("issue key with an empty upstream key status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	rr := do(http.MethodPost, "/tenants/acme/keys", `{"name":"ci","upstream_api_keys":["sk-ci-account-1"]}`)
+	var issued entities.IssuedKey
+	if err := json.Unmarshal(rr.Body.Bytes(), &issued); err != nil || rr.Code != http.StatusCreated || issued.Key == "" {
+		t.Fatalf("issue key = %d %s, want 201 with the plaintext key", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "sk-ci-account-1") {
+		t.Errorf("issue key = %s, want the upstream key masked", rr.Body.String())
+	}
+	if rr := do(http.MethodPatch, "/tenants/acme/keys/"+issued.ID, `{"upstream_api_keys":["sk-ci-account-1","sk-ci-account-2"]}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"upstream_api_keys":["...nt-1","...nt-2"]`) {
+		t.Errorf("update key = %d %s, want both upstream keys masked", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/tenants/acme/keys", ""); strings.Contains(rr.Body.String(), issued.Key) || !strings.Contains(rr.Body.String(), issued.ID) {
+		t.Errorf("list keys = %s, want key %s without its plaintext", rr.Body.String(), issued.ID)
+	}
+	if rr := do(http.MethodDelete, "/tenants/acme/keys/"+issued.ID, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("revoke key status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	if rr := do(http.MethodDelete, "/tenants/acme", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete tenant status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+}
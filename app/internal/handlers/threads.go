@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type ThreadStore interface {
+	SetThreadSession(threadID, sessionID string) error
+	GetThreadSession(threadID string) (string, error)
+	DeleteThreadSession(threadID string) error
+}
+
+// ThreadsHandler maps Assistants API threads to sessions, for threads that
+// were not created through a session URL
+type ThreadsHandler struct {
+	store ThreadStore
+}
+
+// NewThreadsHandler creates a new ThreadsHandler with injected dependencies
+func NewThreadsHandler(store ThreadStore) *ThreadsHandler {
+	return &ThreadsHandler{
+		store: store,
+	}
+}
+
+// Handle returns the session of the thread named by ?thread_id= on GET, maps
+// it to the session in a {"session_id": ...} body on PUT and removes the
+// mapping on DELETE. Tenants' threads are named "{tenant}/{thread}".
+func (th *ThreadsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	threadID := r.URL.Query().Get("thread_id")
+	if threadID == "" {
+		http.Error(w, "Missing thread_id", http.StatusBadRequest)
+		return
+	}
+
+	mapping := entities.ThreadMapping{ThreadID: threadID}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		mapping.SessionID, err = th.store.GetThreadSession(threadID)
+	case http.MethodPut:
+		if errDecode := json.NewDecoder(r.Body).Decode(&mapping); errDecode != nil || mapping.SessionID == "" {
+			http.Error(w, `Body must be a JSON object with a "session_id"`, http.StatusBadRequest)
+			return
+		}
+		mapping.ThreadID = threadID
+		err = th.store.SetThreadSession(threadID, mapping.SessionID)
+	case http.MethodDelete:
+		err = th.store.DeleteThreadSession(threadID)
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, entities.ErrThreadNotFound) {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error accessing the session of thread %s: %v", threadID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mapping); err != nil {
+		log.Printf("Error encoding thread mapping: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestThreadsHandler_Handle(t *testing.T) {
+	handler := NewThreadsHandler(repository.NewMemoryRepository())
+	request := func(method, query, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.Handle(rr, httptest.NewRequest(method, "/threads"+query, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := request(http.MethodGet, "?thread_id=thread_a", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("GET of an unmapped thread status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+	if rr := request(http.MethodPut, "?thread_id=thread_a", `{"session_id":"agent-1"}`); rr.Code != http.StatusOK {
+		t.Errorf("PUT status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	rr := request(http.MethodGet, "?thread_id=thread_a", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"session_id":"agent-1"`) {
+		t.Errorf("GET = %d %s, want the mapping to agent-1", rr.Code, rr.Body.String())
+	}
+	if rr := request(http.MethodDelete, "?thread_id=thread_a", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	for _, tt := range []struct{ method, query, body string }{
+		{http.MethodGet, "", ""},
+		{http.MethodPut, "?thread_id=thread_a", `{}`},
+		{http.MethodPost, "?thread_id=thread_a", ""},
+	} {
+		if rr := request(tt.method, tt.query, tt.body); rr.Code < 400 {
+			t.Errorf("%s %s %s status = %d, want an error", tt.method, tt.query, tt.body, rr.Code)
+		}
+	}
+}
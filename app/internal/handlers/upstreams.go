@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type UpstreamStatusSource interface {
+	Statuses() []entities.UpstreamHealth
+}
+
+// UpstreamsHandler reports the reachability and latency of the probed upstreams
+type UpstreamsHandler struct {
+	upstreams UpstreamStatusSource
+}
+
+// NewUpstreamsHandler creates a new UpstreamsHandler with injected dependencies
+func NewUpstreamsHandler(upstreams UpstreamStatusSource) *UpstreamsHandler {
+	return &UpstreamsHandler{
+		upstreams: upstreams,
+	}
+}
+
+// Handle returns the last known state of every upstream; it responds 503
+// when one of them is unreachable, so it can back an external health check
+func (uh *UpstreamsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := uh.upstreams.Statuses()
+	w.Header().Set("Content-Type", "application/json")
+	for _, status := range statuses {
+		if !status.Reachable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			break
+		}
+	}
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		log.Printf("Error encoding upstream statuses: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type fixedUpstreams []entities.UpstreamHealth
+
+func (f fixedUpstreams) Statuses() []entities.UpstreamHealth { return f }
+
+func TestUpstreamsHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name       string
+		upstreams  fixedUpstreams
+		wantStatus int
+	}{
+		{"all reachable", fixedUpstreams{{Name: "primary", Reachable: true, LatencyMs: 120}}, http.StatusOK},
+		{"one unreachable", fixedUpstreams{{Name: "primary", Reachable: true}, {Name: "hedge", LastError: "status 503"}}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewUpstreamsHandler(tt.upstreams).Handle(rr, httptest.NewRequest(http.MethodGet, "/upstreams", nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			var statuses []entities.UpstreamHealth
+			if err := json.Unmarshal(rr.Body.Bytes(), &statuses); err != nil || len(statuses) != len(tt.upstreams) {
+				t.Errorf("body = %s (%v)", rr.Body, err)
+			}
+		})
+	}
+}
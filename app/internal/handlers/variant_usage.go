@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type VariantUsageSource interface {
+	Usage() []entities.VariantUsage
+}
+
+// VariantUsageHandler reports traffic and token usage per A/B routing variant
+type VariantUsageHandler struct {
+	source VariantUsageSource
+}
+
+// NewVariantUsageHandler creates a new VariantUsageHandler with injected dependencies
+func NewVariantUsageHandler(source VariantUsageSource) *VariantUsageHandler {
+	return &VariantUsageHandler{
+		source: source,
+	}
+}
+
+// Handle returns the usage of every variant that has served traffic
+func (vh *VariantUsageHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(vh.source.Usage()); err != nil {
+		log.Printf("Error encoding variant usage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
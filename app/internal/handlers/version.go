@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// VersionHandler reports which build is running
+type VersionHandler struct {
+	info entities.BuildInfo
+}
+
+// NewVersionHandler creates a new VersionHandler for the given build
+func NewVersionHandler(info entities.BuildInfo) *VersionHandler {
+	return &VersionHandler{
+		info: info,
+	}
+}
+
+// Handle returns the build information
+func (vh *VersionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(vh.info); err != nil {
+		log.Printf("Error encoding build info: %v", err)
+	}
+}
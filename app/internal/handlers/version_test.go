@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestVersionHandler_Handle(t *testing.T) {
+	info := entities.BuildInfo{Version: "v1.2.0", Commit: "abc1234", BuildDate: "2024-01-15T10:00:00Z", GoVersion: "go1.24.2"}
+	handler := NewVersionHandler(info)
+
+	rr := httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handle() status code = %v, want %v", rr.Code, http.StatusOK)
+	}
+	var got entities.BuildInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Handle() body is not JSON: %v", err)
+	}
+	if got != info {
+		t.Errorf("Handle() = %+v, want %+v", got, info)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Handle(rr, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Handle() POST status code = %v, want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
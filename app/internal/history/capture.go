@@ -0,0 +1,174 @@
+package history
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// redactedValue replaces the values of redacted fields
+const redactedValue = "[REDACTED]"
+
+// Capturer selects the bodies stored with history records and applies the
+// privacy controls: tenant opt-in, field redaction and size caps
+type Capturer struct {
+	settings     entities.CaptureSettings
+	tenants      map[string]bool
+	redactFields map[string]bool
+}
+
+// NewCapturer creates a new Capturer with the given settings
+func NewCapturer(settings entities.CaptureSettings) *Capturer {
+	c := &Capturer{
+		settings:     settings,
+		tenants:      make(map[string]bool, len(settings.Tenants)),
+		redactFields: make(map[string]bool, len(settings.RedactFields)),
+	}
+	for _, tenant := range settings.Tenants {
+		c.tenants[tenant] = true
+	}
+	for _, field := range settings.RedactFields {
+		c.redactFields[strings.ToLower(field)] = true
+	}
+	return c
+}
+
+// Capture returns the captured bodies of a request and its response, or nil if
+// the request is not captured
+func (c *Capturer) Capture(r entities.ProxyRequest, resp entities.ProxyResponse) *entities.BodyCapture {
+	if c.settings.Mode == "" || (len(c.tenants) > 0 && !c.tenants[r.TenantID]) {
+		return nil
+	}
+	// Streamed uploads and response bodies were not buffered and are left out
+	requestBody := r.Body
+	responseBody := resp.DecodedBody()
+
+	capture := &entities.BodyCapture{}
+	if c.settings.Mode == entities.CaptureModeHash {
+		capture.RequestSHA256 = digest(requestBody)
+		capture.ResponseSHA256 = digest(responseBody)
+		return capture
+	}
+
+	limit := c.settings.MaxBytes
+	if c.settings.Mode == entities.CaptureModePreview {
+		limit = c.settings.PreviewBytes
+	}
+	var truncated bool
+	capture.RequestBody, truncated = c.text(requestBody, r.Headers.Get("Content-Type"), limit)
+	capture.Truncated = truncated
+	capture.ResponseBody, truncated = c.text(responseBody, resp.Headers.Get("Content-Type"), limit)
+	capture.Truncated = capture.Truncated || truncated
+	return capture
+}
+
+// text returns a body as redacted text cut to limit bytes, or a placeholder
+// for binary content
+func (c *Capturer) text(body []byte, contentType string, limit int) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+	if isBinary(contentType) || !utf8.Valid(body) {
+		return fmt.Sprintf("[%d bytes of %s]", len(body), contentType), false
+	}
+	body = c.redact(body)
+	if limit <= 0 || len(body) <= limit {
+		return string(body), false
+	}
+	cut := body[:limit]
+	// Do not split a multi-byte character
+	for len(cut) > 0 && !utf8.Valid(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return string(cut), true
+}
+
+// redact replaces the values of redacted fields in a JSON body, or in each
+// event of a server-sent event stream. Other bodies are returned unchanged.
+func (c *Capturer) redact(body []byte) []byte {
+	if len(c.redactFields) == 0 {
+		return body
+	}
+	if redacted, ok := c.redactJSON(body); ok {
+		return redacted
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	for i, line := range lines {
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		if redacted, ok := c.redactJSON(bytes.TrimSpace(data)); ok {
+			lines[i] = append([]byte("data: "), redacted...)
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// redactJSON redacts a JSON document, reporting false if it is not one
+func (c *Capturer) redactJSON(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		if _, ok := value.([]interface{}); !ok {
+			return nil, false
+		}
+	}
+	encoded, err := json.Marshal(c.walk(value))
+	if err != nil {
+		return nil, false
+	}
+	return encoded, true
+}
+
+// walk replaces the values of redacted fields at any depth
+func (c *Capturer) walk(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if c.redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = c.walk(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = c.walk(child)
+		}
+	}
+	return value
+}
+
+// digest returns the hex SHA-256 of a body, or an empty string for no body
+func digest(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// isBinary reports whether a content type holds neither text nor JSON
+func isBinary(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(mediaType, "text/") && mediaType != "application/json" &&
+		!strings.HasSuffix(mediaType, "+json") && mediaType != "application/x-ndjson" && mediaType != "application/jsonl"
+}
@@ -0,0 +1,113 @@
+package history_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/history"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestCapturer_Capture(t *testing.T) {
+	request := entities.ProxyRequest{
+		TenantID: "acme",
+		Body:     []byte(`{"model":"gpt-4o","user":"alice@example.com","messages":[{"role":"user","content":"hi"}]}`),
+	}
+	jsonHeaders := http.Header{"Content-Type": []string{"application/json"}}
+	response := entities.ProxyResponse{StatusCode: http.StatusOK, Headers: jsonHeaders, Body: []byte(`{"choices":[{"message":{"content":"Hello!"}}]}`)}
+
+	tests := []struct {
+		name     string
+		settings entities.CaptureSettings
+		request  entities.ProxyRequest
+		response entities.ProxyResponse
+		want     *entities.BodyCapture
+	}{
+		{
+			name:     "full with redacted fields",
+			settings: entities.CaptureSettings{Mode: entities.CaptureModeFull, MaxBytes: 1024, RedactFields: []string{"User", "content"}},
+			request:  request,
+			response: response,
+			want: &entities.BodyCapture{
+				RequestBody:  `{"messages":[{"content":"[REDACTED]","role":"user"}],"model":"gpt-4o","user":"[REDACTED]"}`,
+				ResponseBody: `{"choices":[{"message":{"content":"[REDACTED]"}}]}`,
+			},
+		},
+		{
+			name:     "preview",
+			settings: entities.CaptureSettings{Mode: entities.CaptureModePreview, MaxBytes: 1024, PreviewBytes: 16},
+			request:  request,
+			response: response,
+			want:     &entities.BodyCapture{RequestBody: `{"model":"gpt-4o`, ResponseBody: `{"choices":[{"me`, Truncated: true},
+		},
+		{
+			name:     "hash",
+			settings: entities.CaptureSettings{Mode: entities.CaptureModeHash},
+			request:  entities.ProxyRequest{Body: []byte("abc")},
+			response: entities.ProxyResponse{},
+			want:     &entities.BodyCapture{RequestSHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		},
+		{
+			name:     "tenant not opted in",
+			settings: entities.CaptureSettings{Mode: entities.CaptureModeFull, Tenants: []string{"globex"}},
+			request:  request,
+			response: response,
+			want:     nil,
+		},
+		{
+			name:     "stream and binary",
+			settings: entities.CaptureSettings{Mode: entities.CaptureModeFull, RedactFields: []string{"content"}},
+			request:  entities.ProxyRequest{Headers: http.Header{"Content-Type": []string{"audio/mpeg"}}, Body: []byte{0xff, 0xfb}},
+			response: entities.ProxyResponse{Headers: http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body: []byte("data: {\"delta\":{\"content\":\"Hi\"}}\n\ndata: [DONE]\n\n")},
+			want: &entities.BodyCapture{
+				RequestBody:  "[2 bytes of audio/mpeg]",
+				ResponseBody: "data: {\"delta\":{\"content\":\"[REDACTED]\"}}\n\ndata: [DONE]\n\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := history.NewCapturer(tt.settings).Capture(tt.request, tt.response)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("Capture() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapturer_GzippedResponse(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"ok":true}`))
+	writer.Close()
+
+	got := history.NewCapturer(entities.CaptureSettings{Mode: entities.CaptureModeFull}).Capture(entities.ProxyRequest{}, entities.ProxyResponse{
+		Headers: http.Header{"Content-Type": []string{"application/json"}, "Content-Encoding": []string{"gzip"}},
+		Body:    compressed.Bytes(),
+	})
+	if got == nil || got.ResponseBody != `{"ok":true}` {
+		t.Errorf("Capture() = %+v, want the decompressed response", got)
+	}
+}
+
+func TestPurger_Purge(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, time.Hour} {
+		repo.SaveRequestRecord(entities.RequestRecord{Path: "/v1/chat/completions", Capture: &entities.BodyCapture{RequestBody: "{}"}, CreatedAt: now.Add(-age)})
+	}
+
+	cleared, err := history.NewPurger(repo, 24*time.Hour).Purge()
+	if err != nil || cleared != 1 {
+		t.Fatalf("Purge() = %d, %v, want 1", cleared, err)
+	}
+	records, _ := repo.ListRequestRecords(entities.HistoryQuery{Limit: 10})
+	if len(records) != 2 || records[0].Capture == nil || records[1].Capture != nil {
+		t.Errorf("records after Purge() = %+v, want only the old body deleted", records)
+	}
+}
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"log"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	SaveRequestRecord(record entities.RequestRecord) error
+}
+
+// Recorder is a queue decorator that adds every request it forwards to the
+// request history.
+type Recorder struct {
+	next     Queue
+	store    Store
+	capturer *Capturer
+}
+
+// NewRecorder creates a new Recorder with injected dependencies
+func NewRecorder(next Queue, store Store) *Recorder {
+	return &Recorder{
+		next:  next,
+		store: store,
+	}
+}
+
+// SetCapturer makes the recorder store the bodies selected by the capturer
+func (rec *Recorder) SetCapturer(capturer *Capturer) {
+	rec.capturer = capturer
+}
+
+// Push forwards the request and records its outcome
+func (rec *Recorder) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	start := time.Now()
+	resp := rec.next.Push(r)
+
+	record := entities.RequestRecord{
+		SessionID:  r.SessionID,
+		Method:     r.Method,
+		Path:       r.Path,
+		Model:      entities.BodyModel(r.Body),
+		StatusCode: resp.StatusCode,
+		ClientIP:   r.ClientIP,
+		Moderation: r.Moderation,
+		Fallback:   resp.Fallback,
+		ReplayOf:   r.ReplayOf,
+		TotalMs:    time.Since(start).Milliseconds(),
+		CreatedAt:  time.Now(),
+	}
+	// Cached and shared responses did not wait in the queue or call upstream themselves
+	if !resp.Cached {
+		record.QueueWaitMs = resp.QueueWait.Milliseconds()
+		record.UpstreamLatencyMs = resp.UpstreamLatency.Milliseconds()
+	}
+	if resp.Err != nil {
+		record.Error = resp.Err.Error()
+	}
+	if rec.capturer != nil {
+		record.Capture = rec.capturer.Capture(r, resp)
+	}
+	if err := rec.store.SaveRequestRecord(record); err != nil {
+		log.Printf("Error recording request history: %v", err)
+	}
+	return resp
+}
@@ -0,0 +1,109 @@
+package history_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/history"
+)
+
+type fixedQueue struct {
+	resp entities.ProxyResponse
+}
+
+func (q *fixedQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return q.resp
+}
+
+type recordStore struct {
+	records []entities.RequestRecord
+}
+
+func (s *recordStore) SaveRequestRecord(record entities.RequestRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordStore) ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error) {
+	return s.records, nil
+}
+
+func TestRecorder_Push(t *testing.T) {
+	store := &recordStore{}
+	moderation := &entities.ModerationResult{Flagged: true, Categories: []string{"hate"}}
+	fallback := &entities.ContentFallback{Reason: "content_filter", StatusCode: http.StatusBadRequest, Model: "gpt-4o-mini"}
+
+	ok := history.NewRecorder(&fixedQueue{resp: entities.ProxyResponse{
+		StatusCode:      http.StatusOK,
+		QueueWait:       300 * time.Millisecond,
+		UpstreamLatency: 1200 * time.Millisecond,
+		Fallback:        fallback,
+	}}, store)
+	resp := ok.Push(entities.ProxyRequest{
+		SessionID:  "s1",
+		Method:     http.MethodPost,
+		Path:       "/v1/chat/completions",
+		ClientIP:   "203.0.113.7",
+		Body:       []byte(`{"model":"gpt-4o"}`),
+		Moderation: moderation,
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Push() status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	failing := history.NewRecorder(&fixedQueue{resp: entities.ProxyResponse{Err: errors.New("connection refused")}}, store)
+	failing.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+
+	if len(store.records) != 2 {
+		t.Fatalf("Push() recorded %d requests, want 2", len(store.records))
+	}
+	first := store.records[0]
+	if first.SessionID != "s1" || first.Model != "gpt-4o" || first.StatusCode != http.StatusOK || first.ClientIP != "203.0.113.7" || first.Moderation != moderation || first.Fallback != fallback || first.CreatedAt.IsZero() {
+		t.Errorf("Push() record = %+v, want request details, moderation result and fallback", first)
+	}
+	if first.QueueWaitMs != 300 || first.UpstreamLatencyMs != 1200 {
+		t.Errorf("Push() record timing = %d/%d ms, want 300/1200", first.QueueWaitMs, first.UpstreamLatencyMs)
+	}
+	if store.records[1].Error != "connection refused" {
+		t.Errorf("Push() record error = %q, want upstream error", store.records[1].Error)
+	}
+}
+
+func TestReporter_LatencyReport(t *testing.T) {
+	store := &recordStore{}
+	for i := int64(1); i <= 100; i++ {
+		record := entities.RequestRecord{QueueWaitMs: i, UpstreamLatencyMs: 10 * i, TotalMs: 10*i + i}
+		if i > 90 {
+			// Cache hits never reach upstream
+			record.UpstreamLatencyMs = 0
+		}
+		store.records = append(store.records, record)
+	}
+	store.records = append(store.records, entities.RequestRecord{
+		TotalMs:    5000,
+		Moderation: &entities.ModerationResult{Flagged: true, Blocked: true},
+	})
+
+	report, err := history.NewReporter(store).LatencyReport(entities.HistoryQuery{Limit: 1000})
+	if err != nil {
+		t.Fatalf("LatencyReport() error = %v", err)
+	}
+
+	if report.Count != 100 {
+		t.Errorf("LatencyReport() count = %d, want 100 (blocked requests excluded)", report.Count)
+	}
+	wantQueue := entities.LatencyPercentiles{P50: 50, P90: 90, P95: 95, P99: 99, Max: 100}
+	if report.QueueWait != wantQueue {
+		t.Errorf("LatencyReport() queue wait = %+v, want %+v", report.QueueWait, wantQueue)
+	}
+	wantUpstream := entities.LatencyPercentiles{P50: 450, P90: 810, P95: 860, P99: 900, Max: 900}
+	if report.Upstream != wantUpstream {
+		t.Errorf("LatencyReport() upstream = %+v, want %+v", report.Upstream, wantUpstream)
+	}
+	if report.Total.Max != 1100 {
+		t.Errorf("LatencyReport() total max = %d, want 1100", report.Total.Max)
+	}
+}
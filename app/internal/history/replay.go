@@ -0,0 +1,105 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// PrimaryUpstream is the name of the target replays are sent to by default
+const PrimaryUpstream = "primary"
+
+type RecordSource interface {
+	GetRequestRecord(id int64) (*entities.RequestRecord, error)
+}
+
+// Replayer re-sends recorded requests from their captured bodies. Each
+// target is a queue named after the upstream it reaches; the primary one is
+// the proxy's own queue, so replays are recorded like any other request.
+type Replayer struct {
+	records RecordSource
+	targets map[string]Queue
+}
+
+// NewReplayer creates a new Replayer with injected dependencies
+func NewReplayer(records RecordSource, targets map[string]Queue) *Replayer {
+	return &Replayer{
+		records: records,
+		targets: targets,
+	}
+}
+
+// Replay re-sends the request of a history record, optionally with another
+// model or to another upstream, and returns the outcome next to the original
+func (rp *Replayer) Replay(id int64, options entities.ReplayOptions) (*entities.ReplayResult, error) {
+	upstream := options.Upstream
+	if upstream == "" {
+		upstream = PrimaryUpstream
+	}
+	target, ok := rp.targets[upstream]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", entities.ErrUnknownUpstream, upstream)
+	}
+	record, err := rp.records.GetRequestRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	body, err := replayBody(record, options.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID, _ := entities.SplitTenantSessionID(record.SessionID)
+	start := time.Now()
+	resp := target.Push(entities.ProxyRequest{
+		SessionID: record.SessionID,
+		TenantID:  tenantID,
+		Method:    record.Method,
+		Path:      record.Path,
+		Headers:   http.Header{"Content-Type": {"application/json"}},
+		Body:      body,
+		ReplayOf:  record.ID,
+	})
+
+	result := &entities.ReplayResult{
+		ReplayOf:   record.ID,
+		Upstream:   upstream,
+		Model:      entities.BodyModel(body),
+		StatusCode: resp.StatusCode,
+		TotalMs:    time.Since(start).Milliseconds(),
+		Body:       string(resp.DecodedBody()),
+		Original:   *record,
+	}
+	if !resp.Cached {
+		result.UpstreamLatencyMs = resp.UpstreamLatency.Milliseconds()
+	}
+	if resp.Err != nil {
+		result.Error = resp.Err.Error()
+	}
+	return result, nil
+}
+
+// replayBody returns the captured request body of a record with the model
+// replaced. Hashed, truncated and binary bodies are not valid JSON and cannot
+// be replayed.
+func replayBody(record *entities.RequestRecord, model string) ([]byte, error) {
+	if record.Capture == nil || record.Capture.RequestBody == "" {
+		return nil, entities.ErrNotReplayable
+	}
+	body := []byte(record.Capture.RequestBody)
+	if !json.Valid(body) {
+		return nil, entities.ErrNotReplayable
+	}
+	if model == "" {
+		return body, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: the body is not a JSON object to set the model of", entities.ErrNotReplayable)
+	}
+	fields["model"], _ = json.Marshal(model)
+	return json.Marshal(fields)
+}
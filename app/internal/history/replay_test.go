@@ -0,0 +1,98 @@
+package history_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/history"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+// capturingQueue answers with a fixed response and keeps the requests it was sent
+type capturingQueue struct {
+	resp     entities.ProxyResponse
+	requests []entities.ProxyRequest
+}
+
+func (q *capturingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.requests = append(q.requests, r)
+	return q.resp
+}
+
+func TestReplayer_Replay(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.SaveRequestRecord(entities.RequestRecord{
+		SessionID:  "acme/eval:1",
+		Method:     http.MethodPost,
+		Path:       "/v1/chat/completions",
+		Model:      "gpt-4o",
+		StatusCode: http.StatusOK,
+		Capture:    &entities.BodyCapture{RequestBody: `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`},
+	})
+	primary := &capturingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{"id":"chatcmpl-2"}`),
+		UpstreamLatency: 700 * time.Millisecond}}
+	shadow := &capturingQueue{resp: entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"error":{}}`)}}
+	replayer := history.NewReplayer(repo, map[string]history.Queue{history.PrimaryUpstream: primary, "shadow": shadow})
+
+	result, err := replayer.Replay(1, entities.ReplayOptions{})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if result.ReplayOf != 1 || result.Upstream != history.PrimaryUpstream || result.Model != "gpt-4o" ||
+		result.StatusCode != http.StatusOK || result.UpstreamLatencyMs != 700 || result.Body != `{"id":"chatcmpl-2"}` ||
+		result.Original.ID != 1 {
+		t.Errorf("Replay() = %+v", result)
+	}
+	sent := primary.requests[0]
+	if sent.SessionID != "acme/eval:1" || sent.TenantID != "acme" || sent.ReplayOf != 1 || sent.Method != http.MethodPost ||
+		sent.Path != "/v1/chat/completions" || string(sent.Body) != `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}` {
+		t.Errorf("replayed request = %+v", sent)
+	}
+
+	result, err = replayer.Replay(1, entities.ReplayOptions{Model: "gpt-4o-mini", Upstream: "shadow"})
+	if err != nil {
+		t.Fatalf("Replay(shadow) error = %v", err)
+	}
+	if result.Upstream != "shadow" || result.Model != "gpt-4o-mini" || result.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Replay(shadow) = %+v", result)
+	}
+	if got := string(shadow.requests[0].Body); got != `{"messages":[{"role":"user","content":"Hi"}],"model":"gpt-4o-mini"}` {
+		t.Errorf("replayed body = %s, want the model replaced", got)
+	}
+}
+
+func TestReplayer_Errors(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, capture := range []*entities.BodyCapture{
+		nil,
+		{RequestSHA256: "e3b0c442"},
+		{RequestBody: `{"model":"gpt-4o","messages":[{"role":"us`, Truncated: true},
+		{RequestBody: `[12 bytes of audio/wav]`},
+		{RequestBody: `["not","an","object"]`},
+	} {
+		repo.SaveRequestRecord(entities.RequestRecord{Method: http.MethodPost, Path: "/v1/chat/completions", Capture: capture})
+	}
+	queue := &capturingQueue{}
+	replayer := history.NewReplayer(repo, map[string]history.Queue{history.PrimaryUpstream: queue})
+
+	for id := int64(1); id <= 4; id++ {
+		if _, err := replayer.Replay(id, entities.ReplayOptions{}); !errors.Is(err, entities.ErrNotReplayable) {
+			t.Errorf("Replay(%d) error = %v, want ErrNotReplayable", id, err)
+		}
+	}
+	if _, err := replayer.Replay(5, entities.ReplayOptions{Model: "gpt-4o"}); !errors.Is(err, entities.ErrNotReplayable) {
+		t.Errorf("Replay(5) with a model error = %v, want ErrNotReplayable", err)
+	}
+	if _, err := replayer.Replay(6, entities.ReplayOptions{}); !errors.Is(err, entities.ErrRequestRecordNotFound) {
+		t.Errorf("Replay(6) error = %v, want ErrRequestRecordNotFound", err)
+	}
+	if _, err := replayer.Replay(5, entities.ReplayOptions{Upstream: "hedge"}); !errors.Is(err, entities.ErrUnknownUpstream) {
+		t.Errorf("Replay(hedge) error = %v, want ErrUnknownUpstream", err)
+	}
+	if len(queue.requests) != 0 {
+		t.Errorf("queue was sent %d requests, want none", len(queue.requests))
+	}
+}
@@ -0,0 +1,49 @@
+package history
+
+import (
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Lister interface {
+	ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error)
+}
+
+// Reporter computes latency percentiles over the request history
+type Reporter struct {
+	store Lister
+}
+
+// NewReporter creates a new Reporter with injected dependencies
+func NewReporter(store Lister) *Reporter {
+	return &Reporter{
+		store: store,
+	}
+}
+
+// LatencyReport summarizes the timing of the most recent requests matching the query.
+// Requests blocked before they were enqueued are left out.
+func (rep *Reporter) LatencyReport(query entities.HistoryQuery) (entities.LatencyReport, error) {
+	records, err := rep.store.ListRequestRecords(query)
+	if err != nil {
+		return entities.LatencyReport{}, err
+	}
+
+	var queueWait, upstream, total []int64
+	for _, record := range records {
+		if record.Moderation != nil && record.Moderation.Blocked {
+			continue
+		}
+		queueWait = append(queueWait, record.QueueWaitMs)
+		total = append(total, record.TotalMs)
+		if record.UpstreamLatencyMs > 0 {
+			upstream = append(upstream, record.UpstreamLatencyMs)
+		}
+	}
+
+	return entities.LatencyReport{
+		Count:     len(total),
+		QueueWait: entities.NewLatencyPercentiles(queueWait),
+		Upstream:  entities.NewLatencyPercentiles(upstream),
+		Total:     entities.NewLatencyPercentiles(total),
+	}, nil
+}
@@ -0,0 +1,88 @@
+package history
+
+import (
+	"log"
+	"time"
+)
+
+type CaptureStore interface {
+	DeleteCapturedBodies(before time.Time) (int, error)
+}
+
+// maxPurgeInterval bounds how long captured bodies outlive their retention
+const maxPurgeInterval = time.Hour
+
+// Leader reports whether this instance runs the background tasks of its replicas
+type Leader interface {
+	IsLeader() bool
+}
+
+// Purger deletes captured bodies once they are older than the retention
+// period. The records themselves are kept.
+type Purger struct {
+	store     CaptureStore
+	retention time.Duration
+	now       func() time.Time
+	leader    Leader
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPurger creates a new Purger keeping captured bodies for retention
+func NewPurger(store CaptureStore, retention time.Duration) *Purger {
+	return &Purger{
+		store:     store,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// SetLeader limits background purging to the instance leader elects
+func (p *Purger) SetLeader(leader Leader) {
+	p.leader = leader
+}
+
+// Start purges expired bodies in the background until Close is called
+func (p *Purger) Start() {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(min(p.retention, maxPurgeInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				if p.leader != nil && !p.leader.IsLeader() {
+					continue
+				}
+				if _, err := p.Purge(); err != nil {
+					log.Printf("Error purging captured bodies: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Purge deletes the captured bodies older than the retention period and
+// returns how many records it cleared
+func (p *Purger) Purge() (int, error) {
+	cleared, err := p.store.DeleteCapturedBodies(p.now().Add(-p.retention))
+	if cleared > 0 {
+		log.Printf("Deleted the captured bodies of %d history records older than %v", cleared, p.retention)
+	}
+	return cleared, err
+}
+
+// Close stops background purging
+func (p *Purger) Close() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+}
@@ -0,0 +1,237 @@
+// Package hook sends requests before they are enqueued, and responses before
+// they are returned, to an external HTTP service that may rewrite or reject
+// them. It lets operators apply custom policies without forking the proxy.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Stages of the exchange sent to the hook
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+)
+
+// credentialHeaders carry the client's credentials; they are not sent to the
+// hook, which has no use for them, and the hook cannot change them
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// maxReplyBytes bounds the hook's reply, which carries a whole body
+const maxReplyBytes = 64 << 20
+
+// exchange is what the hook receives. Bodies are base64 encoded, as
+// encoding/json does for []byte, so binary payloads survive the round trip.
+type exchange struct {
+	Stage     string      `json:"stage"`
+	SessionID string      `json:"session_id,omitempty"`
+	TenantID  string      `json:"tenant_id,omitempty"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Headers   http.Header `json:"headers"`
+	Body      []byte      `json:"body"`
+	// StatusCode is the upstream status in the response stage
+	StatusCode int `json:"status_code,omitempty"`
+}
+
+// reply is the hook's answer. Fields that are absent leave the request or
+// response unchanged; Reject fails it with the given error instead.
+type reply struct {
+	Headers    http.Header `json:"headers"`
+	Body       []byte      `json:"body"`
+	StatusCode int         `json:"status_code"`
+	Reject     *rejection  `json:"reject"`
+}
+
+type rejection struct {
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message"`
+	Code       string `json:"code"`
+}
+
+// Client calls the transformation hook. It is a request filter and a
+// response filter of the proxy handler.
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+	// failClosed fails requests when the hook is unavailable instead of
+	// passing them on unchanged
+	failClosed bool
+}
+
+// NewClient creates a new Client calling the hook at url, authenticated with
+// token when it is set
+func NewClient(url, token string, client *http.Client, failClosed bool) *Client {
+	return &Client{
+		url:        url,
+		token:      token,
+		client:     client,
+		failClosed: failClosed,
+	}
+}
+
+// Filter sends a request to the hook before it is enqueued and applies the
+// hook's changes to its headers and body
+func (c *Client) Filter(sessionID string, req *entities.ProxyRequest) error {
+	r, err := c.call(exchange{
+		Stage:     StageRequest,
+		SessionID: sessionID,
+		TenantID:  req.TenantID,
+		Method:    req.Method,
+		Path:      req.Path,
+		Headers:   withoutCredentials(req.Headers),
+		Body:      req.Body,
+	})
+	if err != nil {
+		return c.unavailable(err)
+	}
+	if r == nil {
+		return nil
+	}
+	if r.Reject != nil {
+		return r.Reject.requestError()
+	}
+	if r.Headers != nil {
+		headers := r.Headers.Clone()
+		for _, name := range credentialHeaders {
+			headers.Del(name)
+			if values := req.Headers.Values(name); len(values) > 0 {
+				headers[name] = values
+			}
+		}
+		req.Headers = headers
+	}
+	if r.Body != nil {
+		req.Body = r.Body
+	}
+	return nil
+}
+
+// FilterResponse sends a buffered response to the hook before it is returned
+// to the client and applies the hook's changes to its status, headers and body
+func (c *Client) FilterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+	r, err := c.call(exchange{
+		Stage:      StageResponse,
+		SessionID:  sessionID,
+		TenantID:   req.TenantID,
+		Method:     req.Method,
+		Path:       req.Path,
+		Headers:    resp.Headers,
+		Body:       resp.Body,
+		StatusCode: resp.StatusCode,
+	})
+	if err != nil {
+		return c.unavailable(err)
+	}
+	if r == nil {
+		return nil
+	}
+	if r.Reject != nil {
+		return r.Reject.requestError()
+	}
+	if r.StatusCode >= 100 && r.StatusCode <= 599 {
+		resp.StatusCode = r.StatusCode
+	}
+	if r.Headers != nil {
+		resp.Headers = r.Headers
+	}
+	if r.Body != nil {
+		resp.Body = r.Body
+	}
+	return nil
+}
+
+// call posts the exchange to the hook. A 204 or empty reply means no change
+// and is returned as nil.
+func (c *Client) call(ex exchange) (*reply, error) {
+	payload, err := json.Marshal(ex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode hook request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(context.Background(), http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReplyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hook reply: %w", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var r reply
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode hook reply: %w", err)
+	}
+	return &r, nil
+}
+
+// unavailable logs a failed hook call and, when failing closed, rejects the
+// request
+func (c *Client) unavailable(err error) error {
+	log.Printf("Transformation hook failed: %v", err)
+	if !c.failClosed {
+		return nil
+	}
+	return &entities.RequestError{
+		StatusCode: http.StatusBadGateway,
+		Message:    "Transformation hook is unavailable",
+		Type:       "server_error",
+		Code:       "hook_unavailable",
+	}
+}
+
+// requestError converts the hook's rejection into the error returned to the
+// client; a missing status rejects with 403
+func (rj *rejection) requestError() *entities.RequestError {
+	reqErr := &entities.RequestError{
+		StatusCode: rj.StatusCode,
+		Message:    rj.Message,
+		Type:       "invalid_request_error",
+		Code:       rj.Code,
+	}
+	if reqErr.StatusCode < 400 || reqErr.StatusCode > 599 {
+		reqErr.StatusCode = http.StatusForbidden
+	}
+	if reqErr.StatusCode >= 500 {
+		reqErr.Type = "server_error"
+	}
+	if reqErr.Message == "" {
+		reqErr.Message = "Request rejected by policy"
+	}
+	return reqErr
+}
+
+// withoutCredentials returns a copy of the headers without the credential headers
+func withoutCredentials(headers http.Header) http.Header {
+	clean := headers.Clone()
+	if clean == nil {
+		clean = http.Header{}
+	}
+	for _, name := range credentialHeaders {
+		clean.Del(name)
+	}
+	return clean
+}
@@ -0,0 +1,129 @@
+package hook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/hook"
+)
+
+// received is the part of the exchange the tests inspect
+type received struct {
+	Stage      string      `json:"stage"`
+	SessionID  string      `json:"session_id"`
+	Path       string      `json:"path"`
+	Headers    http.Header `json:"headers"`
+	Body       []byte      `json:"body"`
+	StatusCode int         `json:"status_code"`
+}
+
+func newHook(t *testing.T, reply func(w http.ResponseWriter, ex received)) (*httptest.Server, *received) {
+	t.Helper()
+	var last received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hook-token" {
+			t.Errorf("hook Authorization = %q, want the hook token", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			t.Errorf("invalid exchange: %v", err)
+		}
+		reply(w, last)
+	}))
+	t.Cleanup(server.Close)
+	return server, &last
+}
+
+func TestClient_Filter(t *testing.T) {
+	server, last := newHook(t, func(w http.ResponseWriter, ex received) {
+		w.Write([]byte(`{"headers":{"Content-Type":["application/json"],"X-Policy":["strict"],"Authorization":["Bearer forged"]},"body":"eyJtb2RlbCI6ImdwdC00by1taW5pIn0="}`))
+	})
+	client := hook.NewClient(server.URL, "hook-token", server.Client(), false)
+
+	req := &entities.ProxyRequest{
+		Method:  http.MethodPost,
+		Path:    "/v1/chat/completions",
+		Headers: http.Header{"Authorization": {"Bearer client-key"}, "Cookie": {"a=b"}, "Content-Type": {"application/json"}},
+		Body:    []byte(`{"model":"gpt-4o"}`),
+	}
+	if err := client.Filter("s1", req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+
+	if last.Stage != hook.StageRequest || last.SessionID != "s1" || last.Path != "/v1/chat/completions" || string(last.Body) != `{"model":"gpt-4o"}` {
+		t.Errorf("hook received %+v", last)
+	}
+	if last.Headers.Get("Authorization") != "" || last.Headers.Get("Cookie") != "" {
+		t.Errorf("hook received the client's credentials: %v", last.Headers)
+	}
+	if string(req.Body) != `{"model":"gpt-4o-mini"}` || req.Headers.Get("X-Policy") != "strict" {
+		t.Errorf("Filter() request = %s %v, want the hook's body and headers", req.Body, req.Headers)
+	}
+	if req.Headers.Get("Authorization") != "Bearer client-key" || req.Headers.Get("Cookie") != "a=b" {
+		t.Errorf("Filter() credentials = %v, want the client's", req.Headers)
+	}
+}
+
+func TestClient_FilterResponse(t *testing.T) {
+	server, last := newHook(t, func(w http.ResponseWriter, ex received) {
+		w.Write([]byte(`{"status_code":200,"body":"e30="}`))
+	})
+	client := hook.NewClient(server.URL, "hook-token", server.Client(), false)
+
+	resp := &entities.ProxyResponse{StatusCode: http.StatusTeapot, Headers: http.Header{"X-Upstream": {"1"}}, Body: []byte(`{"secret":true}`)}
+	if err := client.FilterResponse("s1", &entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/embeddings"}, resp); err != nil {
+		t.Fatalf("FilterResponse() error = %v", err)
+	}
+
+	if last.Stage != hook.StageResponse || last.StatusCode != http.StatusTeapot || string(last.Body) != `{"secret":true}` {
+		t.Errorf("hook received %+v", last)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `{}` || resp.Headers.Get("X-Upstream") != "1" {
+		t.Errorf("FilterResponse() = %d %s %v, want the hook's status and body with the upstream headers", resp.StatusCode, resp.Body, resp.Headers)
+	}
+}
+
+func TestClient_Replies(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		failClosed bool
+		wantStatus int
+		wantCode   string
+	}{
+		{"no change", http.StatusNoContent, "", false, 0, ""},
+		{"empty object", http.StatusOK, `{}`, false, 0, ""},
+		{"rejected", http.StatusOK, `{"reject":{"status_code":429,"message":"Quota exceeded","code":"quota"}}`, false, http.StatusTooManyRequests, "quota"},
+		{"rejected without status", http.StatusOK, `{"reject":{}}`, false, http.StatusForbidden, ""},
+		{"hook error failing open", http.StatusInternalServerError, "", false, 0, ""},
+		{"hook error failing closed", http.StatusInternalServerError, "", true, http.StatusBadGateway, "hook_unavailable"},
+		{"invalid reply failing closed", http.StatusOK, `not json`, true, http.StatusBadGateway, "hook_unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newHook(t, func(w http.ResponseWriter, ex received) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			client := hook.NewClient(server.URL, "hook-token", server.Client(), tt.failClosed)
+			req := &entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{}`)}
+
+			err := client.Filter("", req)
+
+			var reqErr *entities.RequestError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("Filter() error = %v, want none", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &reqErr) || reqErr.StatusCode != tt.wantStatus || reqErr.Code != tt.wantCode):
+				t.Errorf("Filter() error = %v, want status %d with code %q", err, tt.wantStatus, tt.wantCode)
+			}
+			if string(req.Body) != `{}` {
+				t.Errorf("Filter() body = %s, want it unchanged", req.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package httperr writes the rejections of the proxy's handlers and
+// middlewares in the OpenAI error envelope format.
+package httperr
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Write writes the rejection with its status code and error envelope
+func Write(w http.ResponseWriter, reqErr *entities.RequestError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reqErr.StatusCode)
+	if err := json.NewEncoder(w).Encode(reqErr.Envelope()); err != nil {
+		log.Printf("Error encoding error response: %v", err)
+	}
+}
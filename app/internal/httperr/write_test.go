@@ -0,0 +1,26 @@
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestWrite(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Write(rr, &entities.RequestError{StatusCode: http.StatusForbidden, Message: "denied", Type: "permission_error", Code: "ip_denied"})
+
+	if rr.Code != http.StatusForbidden || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("response = %d %q, want 403 application/json", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var errResp entities.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("body is not an error envelope: %q", rr.Body.String())
+	}
+	if errResp.Error.Message != "denied" || errResp.Error.Type != "permission_error" || errResp.Error.Code == nil || *errResp.Error.Code != "ip_denied" {
+		t.Errorf("envelope = %+v, want the request error fields", errResp.Error)
+	}
+}
@@ -0,0 +1,38 @@
+// Package httpheader sanitizes headers copied between the client and upstream
+// connections.
+package httpheader
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopByHop are the headers that describe a single connection rather than the
+// message (RFC 7230, section 6.1, plus the non-standard Proxy-Connection and
+// Keep-Alive), so a proxy must not forward them
+var hopByHop = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopByHop deletes the hop-by-hop headers from h, including any header
+// the Connection header lists
+func RemoveHopByHop(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHop {
+		h.Del(name)
+	}
+}
@@ -0,0 +1,32 @@
+package httpheader
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRemoveHopByHop(t *testing.T) {
+	h := http.Header{
+		"Connection":        []string{"keep-alive, X-Trace-Hop", "Upgrade"},
+		"Keep-Alive":        []string{"timeout=5"},
+		"Transfer-Encoding": []string{"chunked"},
+		"Upgrade":           []string{"websocket"},
+		"Te":                []string{"trailers"},
+		"X-Trace-Hop":       []string{"1"},
+		"Content-Type":      []string{"application/json"},
+		"Content-Encoding":  []string{"gzip"},
+		"Openai-Model":      []string{"gpt-4o"},
+	}
+
+	RemoveHopByHop(h)
+
+	want := http.Header{
+		"Content-Type":     []string{"application/json"},
+		"Content-Encoding": []string{"gzip"},
+		"Openai-Model":     []string{"gpt-4o"},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("RemoveHopByHop() left %v, want %v", h, want)
+	}
+}
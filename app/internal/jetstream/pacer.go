@@ -0,0 +1,72 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	natsjs "github.com/nats-io/nats.go/jetstream"
+)
+
+// pacer spaces the dispatches of all replicas consuming a queue by the
+// interval in effect at each slot, which makes a queue's RPM a fleet-wide
+// limit. The time of the next free dispatch slot is kept as the last message
+// on a subject of the pacing stream, and replicas take slots by publishing
+// the following one only if nobody published since they read it.
+type pacer struct {
+	js natsjs.JetStream
+	// stream is the pacing stream, set by Queue.Start
+	stream   natsjs.Stream
+	subject  string
+	interval func(now time.Time) time.Duration
+	now      func() time.Time
+}
+
+// reserve takes the next free slot and returns when it starts
+func (p *pacer) reserve(ctx context.Context) (time.Time, error) {
+	for {
+		var lastSeq uint64
+		slot := p.now()
+		last, err := p.stream.GetLastMsgForSubject(ctx, p.subject)
+		switch {
+		case errors.Is(err, natsjs.ErrMsgNotFound):
+		case err != nil:
+			return time.Time{}, err
+		default:
+			lastSeq = last.Sequence
+			if nanos, err := strconv.ParseInt(string(last.Data), 10, 64); err == nil {
+				if next := time.Unix(0, nanos); next.After(slot) {
+					slot = next
+				}
+			}
+		}
+		next := strconv.FormatInt(slot.Add(p.interval(slot)).UnixNano(), 10)
+		_, err = p.js.Publish(ctx, p.subject, []byte(next), natsjs.WithExpectLastSequencePerSubject(lastSeq))
+		if isAPIError(err, natsjs.JSErrCodeStreamWrongLastSequence) {
+			// Another replica took the slot; read the new last one
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		return slot, nil
+	}
+}
+
+// wait reserves a slot and sleeps until it starts, or until ctx is done
+func (p *pacer) wait(ctx context.Context) error {
+	slot, err := p.reserve(ctx)
+	if err != nil {
+		return err
+	}
+	if delay := slot.Sub(p.now()); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
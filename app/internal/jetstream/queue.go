@@ -0,0 +1,528 @@
+// Package jetstream implements the jetstream queue backend: requests are
+// published to a NATS JetStream work-queue stream, which proxy replicas
+// consume and dispatch under fleet-wide limits.
+package jetstream
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// pullExpires is how long a pull request waits for a message. Requests
+// delivered after the queue stops pulling wait for AckWait before they are
+// redelivered, so it is kept short.
+const pullExpires = 5 * time.Second
+
+// unpacedRequestsPerMinute is the RPM of the local queues, which leave pacing
+// to the fleet-wide pacer
+const unpacedRequestsPerMinute = 60_000_000
+
+// KeySetter sets the upstream API key of a consumed request. Keys are not
+// published to the stream, so the consuming replica looks them up.
+type KeySetter interface {
+	SetKey(r *entities.ProxyRequest) error
+}
+
+// requestMessage is a request as published to the stream. Bodies are base64
+// encoded, as encoding/json does for []byte. The upstream API key is left
+// out, so tenants' keys are not stored in the stream.
+type requestMessage struct {
+	// ReplyTo is the subject the replica waiting for the response listens on
+	ReplyTo      string      `json:"reply_to"`
+	SessionID    string      `json:"session_id,omitempty"`
+	TenantID     string      `json:"tenant_id,omitempty"`
+	VirtualKeyID string      `json:"virtual_key_id,omitempty"`
+	Residency    string      `json:"residency,omitempty"`
+	ClientIP     string      `json:"client_ip,omitempty"`
+	Method       string      `json:"method"`
+	Path         string      `json:"path"`
+	Headers      http.Header `json:"headers"`
+	Body         []byte      `json:"body"`
+	Deadline     time.Time   `json:"deadline"`
+}
+
+// responseMessage is a part of a response sent back to the waiting replica.
+// The first part carries the status and headers; bodies that do not fit one
+// message follow in parts of their own, and all but the last set More.
+type responseMessage struct {
+	StatusCode      int           `json:"status_code,omitempty"`
+	Headers         http.Header   `json:"headers,omitempty"`
+	Body            []byte        `json:"body,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Cached          bool          `json:"cached,omitempty"`
+	UpstreamLatency time.Duration `json:"upstream_latency,omitempty"`
+	More            bool          `json:"more,omitempty"`
+}
+
+// Queue is a queue backed by a JetStream work-queue stream. Push publishes
+// the request and waits for its response; every replica consumes the
+// stream, paces dispatches by the queue's RPM across the fleet, and sends
+// them through a local queue that applies the token and worker limits.
+// Requests are delivered at least once: those a replica stops reporting
+// progress on for AckWait are redelivered to another one.
+type Queue struct {
+	conn     *nats.Conn
+	js       natsjs.JetStream
+	settings entities.JetStreamSettings
+	name     string
+	// subject is where requests are published; consumer is the durable
+	// consumer of that subject shared by all replicas
+	subject  string
+	consumer string
+	// pull is the consumer, set by Start
+	pull natsjs.Consumer
+	// keys sets the upstream keys of consumed requests; nil sends them with
+	// the proxy's key
+	keys KeySetter
+	// limits holds the queue's RPM and its schedule
+	limits  entities.QueueConfig
+	workers int
+	local   entities.RequestQueue
+	pacer   *pacer
+
+	pending atomic.Int64
+	closed  atomic.Bool
+	// ctx is cancelled by Close to stop consuming
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewQueue creates a queue for cfg, dispatching consumed requests through
+// local, which should be created with LocalConfig. Start must be called
+// before requests are pushed.
+func NewQueue(conn *nats.Conn, cfg entities.QueueConfig, local entities.RequestQueue, settings entities.JetStreamSettings) (*Queue, error) {
+	js, err := natsjs.New(conn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RequestsPerMinute <= 0 {
+		cfg.RequestsPerMinute = 60
+	}
+	token := subjectToken(cfg.Name)
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		conn:     conn,
+		js:       js,
+		settings: settings,
+		name:     cfg.Name,
+		subject:  settings.Subject + ".requests." + token,
+		consumer: token,
+		limits:   cfg,
+		workers:  cfg.Workers,
+		local:    local,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	q.pacer = &pacer{
+		js:      js,
+		subject: settings.Subject + ".pacing." + token,
+		interval: func(now time.Time) time.Duration {
+			return time.Minute / time.Duration(q.requestsPerMinute(now))
+		},
+		now: time.Now,
+	}
+	return q, nil
+}
+
+// WithUpstreamKeys makes the queue set the upstream keys of the requests it
+// consumes, which are published without them
+func (q *Queue) WithUpstreamKeys(keys KeySetter) *Queue {
+	q.keys = keys
+	return q
+}
+
+// requestsPerMinute returns the RPM limit in effect at t
+func (q *Queue) requestsPerMinute(t time.Time) int {
+	rpm, _ := q.limits.LimitsAt(t)
+	return rpm
+}
+
+// LocalConfig returns the configuration of the local queue of cfg. The pacer
+// limits the request rate across the fleet, so the local queue does not.
+func LocalConfig(cfg entities.QueueConfig) entities.QueueConfig {
+	cfg.RequestsPerMinute = unpacedRequestsPerMinute
+	cfg.Schedule = slices.Clone(cfg.Schedule)
+	for i := range cfg.Schedule {
+		cfg.Schedule[i].RequestsPerMinute = unpacedRequestsPerMinute
+	}
+	return cfg
+}
+
+// Start creates the streams and the consumer of the queue, keeping those
+// that exist, and starts consuming
+func (q *Queue) Start() error {
+	_, err := ensureStream(q.ctx, q.js, natsjs.StreamConfig{
+		Name:              q.settings.Stream,
+		Subjects:          []string{q.settings.Subject + ".requests.>"},
+		Retention:         natsjs.WorkQueuePolicy,
+		Storage:           natsjs.FileStorage,
+		MaxMsgsPerSubject: -1,
+		// Requests nobody consumed before their sender gave up are useless
+		MaxAge: q.settings.ReplyTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", q.settings.Stream, err)
+	}
+	pacing := q.settings.Stream + "_PACING"
+	q.pacer.stream, err = ensureStream(q.ctx, q.js, natsjs.StreamConfig{
+		Name:              pacing,
+		Subjects:          []string{q.settings.Subject + ".pacing.>"},
+		Retention:         natsjs.LimitsPolicy,
+		Storage:           natsjs.MemoryStorage,
+		MaxMsgsPerSubject: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", pacing, err)
+	}
+	q.pull, err = ensureConsumer(q.ctx, q.js, q.settings.Stream, natsjs.ConsumerConfig{
+		Durable:   q.consumer,
+		AckPolicy: natsjs.AckExplicitPolicy,
+		AckWait:   q.settings.AckWait,
+		// Requests held by all replicas, the queue's fleet-wide concurrency
+		MaxAckPending: q.workers,
+		FilterSubject: q.subject,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer %s: %w", q.consumer, err)
+	}
+	q.wg.Add(1)
+	go q.consume()
+	return nil
+}
+
+// ensureStream creates a stream. A stream of that name that already exists
+// is used as is, so operators can tune it without the proxy reverting it.
+func ensureStream(ctx context.Context, js natsjs.JetStream, cfg natsjs.StreamConfig) (natsjs.Stream, error) {
+	stream, err := js.CreateStream(ctx, cfg)
+	if errors.Is(err, natsjs.ErrStreamNameAlreadyInUse) {
+		return js.Stream(ctx, cfg.Name)
+	}
+	return stream, err
+}
+
+// ensureConsumer creates the durable consumer of a stream, keeping an
+// existing one as it is
+func ensureConsumer(ctx context.Context, js natsjs.JetStream, stream string, cfg natsjs.ConsumerConfig) (natsjs.Consumer, error) {
+	consumer, err := js.CreateConsumer(ctx, stream, cfg)
+	if isAPIError(err, natsjs.JSErrCodeConsumerExists) {
+		return js.Consumer(ctx, stream, cfg.Durable)
+	}
+	return consumer, err
+}
+
+// isAPIError reports whether err is a JetStream API error with the code
+func isAPIError(err error, code natsjs.ErrorCode) bool {
+	var apiErr *natsjs.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == code
+}
+
+// Push publishes the request and waits for its response. Requests that do
+// not fit a message, such as streamed uploads, and requests exempt from the
+// rate limits are dispatched by the local queue instead.
+func (q *Queue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if q.closed.Load() {
+		return entities.ProxyResponse{Err: entities.ErrQueueClosed}
+	}
+	q.pending.Add(1)
+	defer q.pending.Add(-1)
+	if r.BodyStream != nil || q.limits.Exempt.Exempts(r) {
+		return q.local.Push(r)
+	}
+
+	sub, err := q.conn.SubscribeSync(q.conn.NewInbox())
+	if err != nil {
+		return entities.ProxyResponse{Err: fmt.Errorf("failed to subscribe to JetStream replies: %w", err)}
+	}
+	defer sub.Unsubscribe()
+	data, err := json.Marshal(requestMessage{
+		ReplyTo:      sub.Subject,
+		SessionID:    r.SessionID,
+		TenantID:     r.TenantID,
+		VirtualKeyID: r.VirtualKeyID,
+		Residency:    r.Residency,
+		ClientIP:     r.ClientIP,
+		Method:       r.Method,
+		Path:         r.Path,
+		Headers:      r.Headers,
+		Body:         r.Body,
+		Deadline:     r.Deadline,
+	})
+	if err != nil {
+		return entities.ProxyResponse{Err: err}
+	}
+	if int64(len(data)) > q.conn.MaxPayload() {
+		return q.local.Push(r)
+	}
+
+	start := time.Now()
+	if _, err := q.js.Publish(q.ctx, q.subject, data); err != nil {
+		return entities.ProxyResponse{Err: fmt.Errorf("failed to publish request to JetStream: %w", err)}
+	}
+	resp := q.await(sub)
+	if resp.Err == nil {
+		// Everything but the upstream call, including the time in the stream
+		resp.QueueWait = max(time.Since(start)-resp.UpstreamLatency, 0)
+	}
+	return resp
+}
+
+// await reads the parts of a response from the subscription
+func (q *Queue) await(sub *nats.Subscription) entities.ProxyResponse {
+	deadline := time.Now().Add(q.settings.ReplyTimeout)
+	var resp entities.ProxyResponse
+	for first := true; ; first = false {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if errors.Is(err, nats.ErrTimeout) {
+			return entities.ProxyResponse{Err: fmt.Errorf("no response from the JetStream queue within %s", q.settings.ReplyTimeout)}
+		}
+		if err != nil {
+			return entities.ProxyResponse{Err: err}
+		}
+		var part responseMessage
+		if err := json.Unmarshal(msg.Data, &part); err != nil {
+			return entities.ProxyResponse{Err: fmt.Errorf("invalid response from the JetStream queue: %w", err)}
+		}
+		if first {
+			if part.Error != "" {
+				return entities.ProxyResponse{Err: errors.New(part.Error)}
+			}
+			resp = entities.ProxyResponse{
+				StatusCode:      part.StatusCode,
+				Headers:         part.Headers,
+				Cached:          part.Cached,
+				UpstreamLatency: part.UpstreamLatency,
+			}
+		}
+		resp.Body = append(resp.Body, part.Body...)
+		if !part.More {
+			return resp
+		}
+	}
+}
+
+// consume pulls requests one at a time, waits for their dispatch slot and
+// hands them to handle, until the queue is closed
+func (q *Queue) consume() {
+	defer q.wg.Done()
+	for !q.closed.Load() {
+		msg, err := q.next()
+		if err != nil {
+			log.Printf("Failed to pull from JetStream queue %s: %v", q.name, err)
+			q.sleep(time.Second)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+		stop := q.reportProgress(msg)
+		if err := q.pacer.wait(q.ctx); err != nil && q.ctx.Err() == nil {
+			log.Printf("Failed to pace JetStream queue %s: %v", q.name, err)
+			stop()
+			q.ack(msg.Nak)
+			q.sleep(time.Second)
+			continue
+		}
+		if q.closed.Load() {
+			// Left for another replica rather than delaying the shutdown
+			stop()
+			q.ack(msg.Nak)
+			return
+		}
+		q.wg.Add(1)
+		go q.handle(msg, stop)
+	}
+}
+
+// next pulls one request, waiting up to pullExpires. It returns nil when
+// none arrived or the queue was closed.
+func (q *Queue) next() (natsjs.Msg, error) {
+	ctx, cancel := context.WithTimeout(q.ctx, pullExpires)
+	defer cancel()
+	msg, err := q.pull.Next(natsjs.FetchContext(ctx))
+	if errors.Is(err, nats.ErrTimeout) || q.ctx.Err() != nil {
+		return nil, nil
+	}
+	return msg, err
+}
+
+// handle dispatches a consumed request through the local queue, replies to
+// its sender and acknowledges it
+func (q *Queue) handle(msg natsjs.Msg, stopProgress func()) {
+	defer q.wg.Done()
+	defer stopProgress()
+
+	var req requestMessage
+	if err := json.Unmarshal(msg.Data(), &req); err != nil {
+		log.Printf("Dropping malformed request from JetStream queue %s: %v", q.name, err)
+		q.ack(msg.Term)
+		return
+	}
+	r := entities.ProxyRequest{
+		SessionID:    req.SessionID,
+		TenantID:     req.TenantID,
+		VirtualKeyID: req.VirtualKeyID,
+		Residency:    req.Residency,
+		ClientIP:     req.ClientIP,
+		Method:       req.Method,
+		Path:         req.Path,
+		Headers:      req.Headers,
+		Body:         req.Body,
+		Deadline:     req.Deadline,
+	}
+	var resp entities.ProxyResponse
+	if q.keys != nil {
+		if err := q.keys.SetKey(&r); err != nil {
+			resp.Err = err
+		}
+	}
+	if resp.Err == nil {
+		resp = q.local.Push(r)
+	}
+	// Progress reports after the acknowledgement would be refused
+	stopProgress()
+	if errors.Is(resp.Err, entities.ErrQueueClosed) {
+		q.ack(msg.Nak)
+		return
+	}
+	q.reply(req.ReplyTo, resp)
+	q.ack(msg.Ack)
+}
+
+// reply sends a response to the replica waiting for it, in as many parts as
+// the server's message size limit requires
+func (q *Queue) reply(subject string, resp entities.ProxyResponse) {
+	first := responseMessage{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.Headers,
+		Cached:          resp.Cached,
+		UpstreamLatency: resp.UpstreamLatency,
+	}
+	if resp.Err != nil {
+		first.Error = resp.Err.Error()
+	}
+	parts := []responseMessage{first}
+	// Bodies are base64 encoded, growing by a third, and the envelope of a
+	// part needs some room
+	partSize := int((q.conn.MaxPayload() - 1024) * 3 / 4)
+	body := resp.Body
+	if len(body) <= partSize/2 {
+		parts[0].Body = body
+		body = nil
+	}
+	for len(body) > 0 {
+		n := min(partSize, len(body))
+		parts[len(parts)-1].More = true
+		parts = append(parts, responseMessage{Body: body[:n]})
+		body = body[n:]
+	}
+	for _, part := range parts {
+		data, err := json.Marshal(part)
+		if err == nil {
+			err = q.conn.Publish(subject, data)
+		}
+		if err != nil {
+			log.Printf("Failed to reply from JetStream queue %s: %v", q.name, err)
+			return
+		}
+	}
+}
+
+// reportProgress tells the server the request is still being worked on
+// every half AckWait until the returned function is called
+func (q *Queue) reportProgress(msg natsjs.Msg) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(max(q.settings.AckWait/2, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				q.ack(msg.InProgress)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+// ack sends an acknowledgement, progress report, request for redelivery or
+// termination of a consumed message, one of its methods
+func (q *Queue) ack(send func() error) {
+	if err := send(); err != nil {
+		log.Printf("Failed to acknowledge request of JetStream queue %s: %v", q.name, err)
+	}
+}
+
+// sleep waits for d or until the queue is closed
+func (q *Queue) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-q.ctx.Done():
+	}
+}
+
+// Depth returns the number of requests pushed on this replica that are
+// waiting for their response
+func (q *Queue) Depth() int {
+	return int(q.pending.Load())
+}
+
+// Stats reports the dispatches of this replica against the queue's limits
+func (q *Queue) Stats() entities.QueueStats {
+	stats := q.local.Stats()
+	stats.Name = q.name
+	stats.Depth = q.Depth()
+	stats.RequestsPerMinute = q.requestsPerMinute(time.Now())
+	stats.RequestUtilization = min(float64(stats.RequestsLastMinute)/float64(stats.RequestsPerMinute), 1)
+	return stats
+}
+
+// Close stops accepting requests and consuming the stream. Requests being
+// dispatched by this replica are finished before the local queue is closed.
+func (q *Queue) Close() {
+	q.once.Do(func() {
+		q.closed.Store(true)
+		q.cancel()
+		q.wg.Wait()
+		q.local.Close()
+	})
+}
+
+// subjectToken returns a subject token and consumer name for a queue name.
+// Names with characters not allowed in either are sanitized, with a hash
+// suffix keeping them distinct.
+func subjectToken(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if clean == name && name != "" {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return clean + "-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,309 @@
+package jetstream
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// localQueue stands in for the local queue of a replica, answering every
+// request with its body and recording when it was dispatched
+type localQueue struct {
+	name     string
+	respBody []byte
+
+	mu       sync.Mutex
+	requests []entities.ProxyRequest
+	times    []time.Time
+	closed   bool
+}
+
+func (l *localQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return entities.ProxyResponse{Err: entities.ErrQueueClosed}
+	}
+	l.requests = append(l.requests, r)
+	l.times = append(l.times, time.Now())
+	body := l.respBody
+	if body == nil {
+		body = append([]byte(l.name+": "), r.Body...)
+	}
+	return entities.ProxyResponse{
+		StatusCode:      http.StatusOK,
+		Headers:         http.Header{"Content-Type": {"text/plain"}},
+		Body:            body,
+		UpstreamLatency: 5 * time.Millisecond,
+	}
+}
+
+func (l *localQueue) Depth() int { return 0 }
+
+func (l *localQueue) Stats() entities.QueueStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return entities.QueueStats{Name: "local", RequestsPerMinute: unpacedRequestsPerMinute, RequestsLastMinute: len(l.requests)}
+}
+
+func (l *localQueue) Close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+}
+
+func (l *localQueue) dispatched() []entities.ProxyRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]entities.ProxyRequest(nil), l.requests...)
+}
+
+var testSettings = entities.JetStreamSettings{
+	Stream:       "LLM_QUEUE",
+	Subject:      "llm-queue",
+	AckWait:      30 * time.Second,
+	ReplyTimeout: 5 * time.Second,
+}
+
+// keySetter stands in for the tenants' upstream keys, recording the key
+// consumed requests arrived with
+type keySetter struct {
+	mu       sync.Mutex
+	received []string
+}
+
+func (k *keySetter) SetKey(r *entities.ProxyRequest) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.received = append(k.received, r.APIKey)
+	r.APIKey = "sk-" + r.TenantID
+	return nil
+}
+
+func startQueue(t *testing.T, server *fakeServer, cfg entities.QueueConfig, local entities.RequestQueue) *Queue {
+	t.Helper()
+	return startQueueWithKeys(t, server, cfg, local, nil)
+}
+
+func startQueueWithKeys(t *testing.T, server *fakeServer, cfg entities.QueueConfig, local entities.RequestQueue, keys *keySetter) *Queue {
+	t.Helper()
+	q, err := NewQueue(dialFake(t, server), cfg, local, testSettings)
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	if keys != nil {
+		q.WithUpstreamKeys(keys)
+	}
+	if err := q.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(q.Close)
+	return q
+}
+
+func dialFake(t *testing.T, server *fakeServer) *nats.Conn {
+	t.Helper()
+	conn, err := nats.Connect(server.url())
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+func TestQueue_PushIsDispatchedByAReplica(t *testing.T) {
+	server := newFakeServer(t, 1<<20)
+	cfg := entities.QueueConfig{Name: "default", RequestsPerMinute: 6000}
+	localA := &localQueue{name: "a"}
+	localB := &localQueue{name: "b"}
+	keys := &keySetter{}
+	replicaA := startQueueWithKeys(t, server, cfg, localA, keys)
+	startQueueWithKeys(t, server, cfg, localB, keys)
+
+	deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+	resp := replicaA.Push(entities.ProxyRequest{
+		SessionID: "s1",
+		TenantID:  "t1",
+		APIKey:    "sk-publisher",
+		Method:    http.MethodPost,
+		Path:      "/v1/chat/completions",
+		Headers:   http.Header{"Content-Type": {"application/json"}},
+		Body:      []byte(`{"model":"gpt-4o"}`),
+		Deadline:  deadline,
+	})
+	if resp.Err != nil {
+		t.Fatalf("Push: %v", resp.Err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Headers.Get("Content-Type") != "text/plain" {
+		t.Errorf("response = %d %v", resp.StatusCode, resp.Headers)
+	}
+	if !bytes.HasSuffix(resp.Body, []byte(`: {"model":"gpt-4o"}`)) {
+		t.Errorf("body = %q", resp.Body)
+	}
+	if resp.UpstreamLatency != 5*time.Millisecond {
+		t.Errorf("UpstreamLatency = %v, want 5ms", resp.UpstreamLatency)
+	}
+
+	requests := append(localA.dispatched(), localB.dispatched()...)
+	if len(requests) != 1 {
+		t.Fatalf("dispatched %d requests, want 1", len(requests))
+	}
+	got := requests[0]
+	if got.SessionID != "s1" || got.TenantID != "t1" || got.APIKey != "sk-t1" || got.Path != "/v1/chat/completions" ||
+		!got.Deadline.Equal(deadline) || got.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("dispatched request = %+v", got)
+	}
+
+	// The key is looked up by the consuming replica, not published
+	if len(keys.received) != 1 || keys.received[0] != "" {
+		t.Errorf("keys of consumed requests = %q, want one empty", keys.received)
+	}
+
+	waitFor(t, func() bool { return server.pending(testSettings.Stream) == 0 }, "request was not acknowledged")
+}
+
+func TestQueue_LargeBodies(t *testing.T) {
+	server := newFakeServer(t, 4096)
+	large := bytes.Repeat([]byte("x"), 20000)
+	local := &localQueue{respBody: large}
+	q := startQueue(t, server, entities.QueueConfig{Name: "default", RequestsPerMinute: 6000}, local)
+
+	// The response is sent back in parts that fit the server's limit
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/embeddings", Body: []byte("small")})
+	if resp.Err != nil {
+		t.Fatalf("Push: %v", resp.Err)
+	}
+	if !bytes.Equal(resp.Body, large) {
+		t.Errorf("body of %d bytes, want %d", len(resp.Body), len(large))
+	}
+
+	// A request that does not fit a message is dispatched locally
+	resp = q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/embeddings", Body: large})
+	if resp.Err != nil {
+		t.Fatalf("Push of large request: %v", resp.Err)
+	}
+	if n := len(local.dispatched()); n != 2 {
+		t.Errorf("dispatched %d requests, want 2", n)
+	}
+}
+
+func TestQueue_PacesReplicasTogether(t *testing.T) {
+	server := newFakeServer(t, 1<<20)
+	// 600 RPM: one dispatch every 100ms across both replicas
+	cfg := entities.QueueConfig{Name: "batch", RequestsPerMinute: 600}
+	localA := &localQueue{name: "a"}
+	localB := &localQueue{name: "b"}
+	replicaA := startQueue(t, server, cfg, localA)
+	replicaB := startQueue(t, server, cfg, localB)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		q := replicaA
+		if i%2 == 1 {
+			q = replicaB
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/completions"}); resp.Err != nil {
+				t.Errorf("Push: %v", resp.Err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	localA.mu.Lock()
+	localB.mu.Lock()
+	times := append(append([]time.Time(nil), localA.times...), localB.times...)
+	localB.mu.Unlock()
+	localA.mu.Unlock()
+	if len(times) != 6 {
+		t.Fatalf("dispatched %d requests, want 6", len(times))
+	}
+	first, last := times[0], times[0]
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	// Six slots are at least five intervals apart
+	if spread := last.Sub(first); spread < 450*time.Millisecond {
+		t.Errorf("six dispatches spread over %v, want at least 500ms", spread)
+	}
+}
+
+func TestQueue_Close(t *testing.T) {
+	server := newFakeServer(t, 1<<20)
+	local := &localQueue{}
+	q := startQueue(t, server, entities.QueueConfig{Name: "default"}, local)
+
+	q.Close()
+	if resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"}); !errors.Is(resp.Err, entities.ErrQueueClosed) {
+		t.Errorf("Push after Close: err = %v, want ErrQueueClosed", resp.Err)
+	}
+	local.mu.Lock()
+	defer local.mu.Unlock()
+	if !local.closed {
+		t.Error("local queue was not closed")
+	}
+}
+
+func TestQueue_Stats(t *testing.T) {
+	server := newFakeServer(t, 1<<20)
+	q := startQueue(t, server, entities.QueueConfig{Name: "default", RequestsPerMinute: 100}, &localQueue{})
+
+	q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+	stats := q.Stats()
+	if stats.Name != "default" || stats.RequestsPerMinute != 100 || stats.RequestsLastMinute != 1 || stats.RequestUtilization != 0.01 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestLocalConfig(t *testing.T) {
+	cfg := entities.QueueConfig{Name: "batch", RequestsPerMinute: 60, TokensPerMinute: 1000,
+		Schedule: []entities.RateWindow{{RequestsPerMinute: 600, TokensPerMinute: 5000}}}
+	local := LocalConfig(cfg)
+	if local.RequestsPerMinute != unpacedRequestsPerMinute || local.Schedule[0].RequestsPerMinute != unpacedRequestsPerMinute {
+		t.Errorf("LocalConfig() = %+v, want the RPM left to the pacer", local)
+	}
+	if local.TokensPerMinute != 1000 || local.Schedule[0].TokensPerMinute != 5000 {
+		t.Errorf("LocalConfig() = %+v, want the TPM limits kept", local)
+	}
+	if cfg.Schedule[0].RequestsPerMinute != 600 {
+		t.Error("LocalConfig() modified the schedule of the queue")
+	}
+}
+
+func TestSubjectToken(t *testing.T) {
+	if got := subjectToken("interactive"); got != "interactive" {
+		t.Errorf("subjectToken(interactive) = %q", got)
+	}
+	a, b := subjectToken("endpoint:/v1/embeddings"), subjectToken("endpoint_/v1/embeddings")
+	if a == b {
+		t.Errorf("sanitized names collide: %q", a)
+	}
+	if bytes.ContainsAny([]byte(a), ".*>:/ ") {
+		t.Errorf("subjectToken = %q, has characters not allowed in subjects", a)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
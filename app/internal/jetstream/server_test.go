@@ -0,0 +1,482 @@
+package jetstream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	natsjs "github.com/nats-io/nats.go/jetstream"
+)
+
+// fakeServer is a NATS server with the subset of JetStream the queue uses:
+// work-queue and limits streams, durable pull consumers, last-message reads
+// and expected-last-subject-sequence publishes. Acknowledged messages are
+// removed; unacknowledged ones are never redelivered on a timer.
+type fakeServer struct {
+	t          *testing.T
+	ln         net.Listener
+	maxPayload int
+	done       chan struct{}
+
+	mu        sync.Mutex
+	clients   map[*fakeClient]bool
+	streams   map[string]*fakeStream
+	consumers map[string]*fakeConsumer
+}
+
+type fakeClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	subs map[string]string // sid -> subject
+}
+
+type fakeStream struct {
+	cfg     natsjs.StreamConfig
+	lastSeq uint64
+	msgs    []fakeStored
+}
+
+type fakeStored struct {
+	seq     uint64
+	subject string
+	data    []byte
+}
+
+type fakeConsumer struct {
+	stream string
+	cfg    natsjs.ConsumerConfig
+	// delivered holds the sequences delivered and not yet acknowledged
+	delivered map[uint64]bool
+	waiting   []fakePull
+}
+
+type fakePull struct {
+	reply   string
+	expires time.Time
+}
+
+func newFakeServer(t *testing.T, maxPayload int) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		t:          t,
+		ln:         ln,
+		maxPayload: maxPayload,
+		done:       make(chan struct{}),
+		clients:    make(map[*fakeClient]bool),
+		streams:    make(map[string]*fakeStream),
+		consumers:  make(map[string]*fakeConsumer),
+	}
+	go s.accept()
+	go s.expirePulls()
+	t.Cleanup(func() {
+		close(s.done)
+		ln.Close()
+		s.disconnectAll()
+	})
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+func (s *fakeServer) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &fakeClient{conn: conn, subs: make(map[string]string)}
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+// disconnectAll drops every client connection, as a server restart would
+func (s *fakeServer) disconnectAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+		delete(s.clients, c)
+	}
+}
+
+func (s *fakeServer) serve(c *fakeClient) {
+	defer func() {
+		c.conn.Close()
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+	fmt.Fprintf(c.conn, "INFO {\"server_id\":\"fake\",\"proto\":1,\"headers\":true,\"max_payload\":%d}\r\n", s.maxPayload)
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args := splitOp(line)
+		fields := strings.Fields(args)
+		switch op {
+		case "PING":
+			c.write("PONG\r\n")
+		case "SUB":
+			c.mu.Lock()
+			c.subs[fields[len(fields)-1]] = fields[0]
+			c.mu.Unlock()
+		case "UNSUB":
+			c.mu.Lock()
+			delete(c.subs, fields[0])
+			c.mu.Unlock()
+		case "PUB", "HPUB":
+			headerSize := 0
+			if op == "HPUB" {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			reply := ""
+			if op == "PUB" && len(fields) == 3 || op == "HPUB" && len(fields) == 4 {
+				reply = fields[1]
+			}
+			payload := make([]byte, total+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.publish(fields[0], reply, payload[:headerSize], payload[headerSize:total])
+		}
+	}
+}
+
+func (c *fakeClient) write(data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write([]byte(data))
+}
+
+// deliver sends a message to the subscriptions matching subject and reports
+// whether there were any. deliverAs is the subject in the MSG line, and
+// header the raw header block, if any.
+func (s *fakeServer) deliver(subject, deliverAs, reply string, header, data []byte) bool {
+	s.mu.Lock()
+	clients := make([]*fakeClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+	delivered := false
+	for _, c := range clients {
+		c.mu.Lock()
+		var sids []string
+		for sid, pattern := range c.subs {
+			if subjectMatches(pattern, subject) {
+				sids = append(sids, sid)
+			}
+		}
+		c.mu.Unlock()
+		for _, sid := range sids {
+			delivered = true
+			replyArg := ""
+			if reply != "" {
+				replyArg = reply + " "
+			}
+			if len(header) > 0 {
+				c.write(fmt.Sprintf("HMSG %s %s %s%d %d\r\n%s%s\r\n", deliverAs, sid, replyArg, len(header), len(header)+len(data), header, data))
+			} else {
+				c.write(fmt.Sprintf("MSG %s %s %s%d\r\n%s\r\n", deliverAs, sid, replyArg, len(data), data))
+			}
+		}
+	}
+	return delivered
+}
+
+func subjectMatches(pattern, subject string) bool {
+	p, t := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(t) > i
+		}
+		if i >= len(t) || token != "*" && token != t[i] {
+			return false
+		}
+	}
+	return len(p) == len(t)
+}
+
+// status returns the header block of a status message
+func status(code string) []byte {
+	return []byte("NATS/1.0 " + code + "\r\n\r\n")
+}
+
+func (s *fakeServer) publish(subject, reply string, headerBlock, data []byte) {
+	switch {
+	case strings.HasPrefix(subject, "$JS.API."):
+		s.respond(reply, s.api(strings.TrimPrefix(subject, "$JS.API."), reply, data))
+	case strings.HasPrefix(subject, "$JS.ACK."):
+		s.acknowledge(subject, string(data))
+	default:
+		if stream := s.streamFor(subject); stream != "" {
+			var header nats.Header
+			if len(headerBlock) > 0 {
+				header, _ = nats.DecodeHeadersMsg(headerBlock)
+			}
+			s.respond(reply, s.store(stream, subject, header, data))
+			s.fillPulls()
+			return
+		}
+		if !s.deliver(subject, subject, reply, headerBlock, data) && reply != "" {
+			s.deliver(reply, reply, "", status("503"), nil)
+		}
+	}
+}
+
+func (s *fakeServer) respond(reply string, body any) {
+	if reply == "" || body == nil {
+		return
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	s.deliver(reply, reply, "", nil, data)
+}
+
+func apiErr(code, errCode int, description string) map[string]any {
+	return map[string]any{"error": map[string]any{"code": code, "err_code": errCode, "description": description}}
+}
+
+// api handles a JetStream API request; a nil result means the reply is sent
+// later, as for pull requests
+func (s *fakeServer) api(call, reply string, data []byte) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case strings.HasPrefix(call, "STREAM.CREATE."):
+		var cfg natsjs.StreamConfig
+		json.Unmarshal(data, &cfg)
+		if existing, ok := s.streams[cfg.Name]; ok {
+			if fmt.Sprint(existing.cfg) != fmt.Sprint(cfg) {
+				return apiErr(400, int(natsjs.JSErrCodeStreamNameInUse), "stream name already in use with a different configuration")
+			}
+			return map[string]any{"config": cfg}
+		}
+		s.streams[cfg.Name] = &fakeStream{cfg: cfg}
+		return map[string]any{"config": cfg}
+	case strings.HasPrefix(call, "STREAM.INFO."):
+		stream, ok := s.streams[strings.TrimPrefix(call, "STREAM.INFO.")]
+		if !ok {
+			return apiErr(404, int(natsjs.JSErrCodeStreamNotFound), "stream not found")
+		}
+		return map[string]any{"config": stream.cfg}
+	case strings.HasPrefix(call, "CONSUMER.CREATE."):
+		// CONSUMER.CREATE.<stream>.<consumer>[.<filter subject>]
+		parts := strings.Split(call, ".")
+		var req struct {
+			Config natsjs.ConsumerConfig `json:"config"`
+		}
+		json.Unmarshal(data, &req)
+		key := parts[2] + "." + parts[3]
+		if existing, ok := s.consumers[key]; ok {
+			if fmt.Sprint(existing.cfg) != fmt.Sprint(req.Config) {
+				return apiErr(400, int(natsjs.JSErrCodeConsumerExists), "consumer already exists")
+			}
+		} else {
+			s.consumers[key] = &fakeConsumer{stream: parts[2], cfg: req.Config, delivered: make(map[uint64]bool)}
+		}
+		return map[string]any{"stream_name": parts[2], "name": parts[3], "config": s.consumers[key].cfg}
+	case strings.HasPrefix(call, "CONSUMER.INFO."):
+		parts := strings.Split(call, ".")
+		consumer, ok := s.consumers[parts[2]+"."+parts[3]]
+		if !ok {
+			return apiErr(404, int(natsjs.JSErrCodeConsumerNotFound), "consumer not found")
+		}
+		return map[string]any{"stream_name": parts[2], "name": parts[3], "config": consumer.cfg}
+	case strings.HasPrefix(call, "STREAM.MSG.GET."):
+		stream := s.streams[strings.TrimPrefix(call, "STREAM.MSG.GET.")]
+		var req struct {
+			LastBySubject string `json:"last_by_subj"`
+		}
+		json.Unmarshal(data, &req)
+		for i := len(stream.msgs) - 1; i >= 0; i-- {
+			if msg := stream.msgs[i]; msg.subject == req.LastBySubject {
+				return map[string]any{"message": map[string]any{"subject": msg.subject, "seq": msg.seq, "data": msg.data, "time": time.Now()}}
+			}
+		}
+		return apiErr(404, int(natsjs.JSErrCodeMessageNotFound), "no message found")
+	case strings.HasPrefix(call, "CONSUMER.MSG.NEXT."):
+		parts := strings.Split(call, ".")
+		consumer := s.consumers[parts[3]+"."+parts[4]]
+		var req struct {
+			Expires int64 `json:"expires"`
+		}
+		json.Unmarshal(data, &req)
+		consumer.waiting = append(consumer.waiting, fakePull{reply: reply, expires: time.Now().Add(time.Duration(req.Expires))})
+		go s.fillPulls()
+		return nil
+	}
+	return apiErr(400, 10000, "unsupported API call "+call)
+}
+
+func (s *fakeServer) streamFor(subject string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, stream := range s.streams {
+		for _, pattern := range stream.cfg.Subjects {
+			if subjectMatches(pattern, subject) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func (s *fakeServer) store(name, subject string, header nats.Header, data []byte) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.streams[name]
+	if expected := header.Get("Nats-Expected-Last-Subject-Sequence"); expected != "" {
+		var last uint64
+		for _, msg := range stream.msgs {
+			if msg.subject == subject {
+				last = msg.seq
+			}
+		}
+		if expected != strconv.FormatUint(last, 10) {
+			return apiErr(400, int(natsjs.JSErrCodeStreamWrongLastSequence), fmt.Sprintf("wrong last sequence: %d", last))
+		}
+	}
+	stream.lastSeq++
+	if stream.cfg.MaxMsgsPerSubject == 1 {
+		kept := stream.msgs[:0]
+		for _, msg := range stream.msgs {
+			if msg.subject != subject {
+				kept = append(kept, msg)
+			}
+		}
+		stream.msgs = kept
+	}
+	stream.msgs = append(stream.msgs, fakeStored{seq: stream.lastSeq, subject: subject, data: append([]byte(nil), data...)})
+	return natsjs.PubAck{Stream: name, Sequence: stream.lastSeq}
+}
+
+// fillPulls delivers stored messages to waiting pull requests
+func (s *fakeServer) fillPulls() {
+	type delivery struct {
+		reply, subject, ack string
+		data                []byte
+	}
+	var deliveries []delivery
+	s.mu.Lock()
+	for name, consumer := range s.consumers {
+		stream := s.streams[consumer.stream]
+		for _, msg := range stream.msgs {
+			if len(consumer.waiting) == 0 {
+				break
+			}
+			if consumer.delivered[msg.seq] || !subjectMatches(consumer.cfg.FilterSubject, msg.subject) {
+				continue
+			}
+			if consumer.cfg.MaxAckPending > 0 && len(consumer.delivered) >= consumer.cfg.MaxAckPending {
+				break
+			}
+			pull := consumer.waiting[0]
+			consumer.waiting = consumer.waiting[1:]
+			consumer.delivered[msg.seq] = true
+			deliveries = append(deliveries, delivery{
+				reply:   pull.reply,
+				subject: msg.subject,
+				ack:     fmt.Sprintf("$JS.ACK.%s.%d.%d.%d.0.0", name, 1, msg.seq, msg.seq),
+				data:    msg.data,
+			})
+		}
+	}
+	s.mu.Unlock()
+	for _, d := range deliveries {
+		s.deliver(d.reply, d.subject, d.ack, nil, d.data)
+	}
+}
+
+// expirePulls ends pull requests that waited past their expiry with a 408
+func (s *fakeServer) expirePulls() {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		var expired []string
+		s.mu.Lock()
+		for _, consumer := range s.consumers {
+			kept := consumer.waiting[:0]
+			for _, pull := range consumer.waiting {
+				if time.Now().After(pull.expires) {
+					expired = append(expired, pull.reply)
+				} else {
+					kept = append(kept, pull)
+				}
+			}
+			consumer.waiting = kept
+		}
+		s.mu.Unlock()
+		for _, reply := range expired {
+			s.deliver(reply, reply, "", status("408 Request Timeout"), nil)
+		}
+	}
+}
+
+// acknowledge handles an ack subject $JS.ACK.<stream.consumer>.<n>.<seq>...
+func (s *fakeServer) acknowledge(subject, kind string) {
+	parts := strings.Split(strings.TrimPrefix(subject, "$JS.ACK."), ".")
+	seq, _ := strconv.ParseUint(parts[3], 10, 64)
+	s.mu.Lock()
+	consumer := s.consumers[parts[0]+"."+parts[1]]
+	switch kind {
+	case "+ACK", "+TERM":
+		delete(consumer.delivered, seq)
+		stream := s.streams[consumer.stream]
+		kept := stream.msgs[:0]
+		for _, msg := range stream.msgs {
+			if msg.seq != seq {
+				kept = append(kept, msg)
+			}
+		}
+		stream.msgs = kept
+	case "-NAK":
+		delete(consumer.delivered, seq)
+	}
+	s.mu.Unlock()
+	s.fillPulls()
+}
+
+func splitOp(line string) (string, string) {
+	line = strings.TrimRight(line, "\r\n")
+	op, args, _ := strings.Cut(line, " ")
+	return strings.ToUpper(op), strings.TrimSpace(args)
+}
+
+// pending returns the number of messages stored in a stream
+func (s *fakeServer) pending(stream string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.streams[stream]; ok {
+		return len(st.msgs)
+	}
+	return 0
+}
@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Maintenance reports whether the proxy is in maintenance mode
+type Maintenance interface {
+	State() entities.MaintenanceState
+}
+
+// maintenanceCheckInterval is how often held jobs check whether maintenance
+// has ended
+const maintenanceCheckInterval = 500 * time.Millisecond
+
+type Store interface {
+	CreateJob(job entities.Job) error
+	UpdateJob(job entities.Job) error
+	GetJob(id string) (*entities.Job, error)
+	ListPendingJobs() ([]entities.Job, error)
+}
+
+type SessionManager interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+	CreateSession(sessionID string) (*entities.SessionData, error)
+	UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
+	ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error)
+	EstimateTokenUsage(requestBody, responseBody []byte) *entities.TokenUsage
+	ParseToolCalls(responseBody []byte) map[string]int
+	RecordResponse(sessionID string, statusCode int, message, errorType string) error
+}
+
+// Runner executes submitted jobs in the background through the proxy queue
+// and persists their state so clients can poll for the result.
+type Runner struct {
+	store    Store
+	queue    Queue
+	sessions SessionManager
+	// owner is recorded on submitted jobs; empty recovers every pending job
+	owner string
+	// maintenance holds jobs back while it is on; nil never holds them
+	maintenance Maintenance
+	wg          sync.WaitGroup
+
+	// estimates holds the queue position of jobs waiting in the proxy queue
+	estimates map[string]entities.QueueEstimate
+	mu        sync.Mutex
+}
+
+// NewRunner creates a new Runner. The session manager is optional; when nil,
+// token usage of session jobs is not recorded.
+func NewRunner(store Store, queue Queue, sessions SessionManager) *Runner {
+	return &Runner{
+		store:     store,
+		queue:     queue,
+		sessions:  sessions,
+		estimates: make(map[string]entities.QueueEstimate),
+	}
+}
+
+// WithOwner records the instance on the jobs it submits and limits Resume and
+// FailPending to them, so instances sharing a store leave each other's jobs
+// alone
+func (r *Runner) WithOwner(owner string) *Runner {
+	r.owner = owner
+	return r
+}
+
+// WithMaintenance holds jobs that are not yet in the proxy queue, including
+// executed and resumed ones, while maintenance mode is on
+func (r *Runner) WithMaintenance(maintenance Maintenance) *Runner {
+	r.maintenance = maintenance
+	return r
+}
+
+// Submit stores the job as queued and starts executing it in the background.
+// ID, status and timestamps are assigned by the runner.
+func (r *Runner) Submit(job entities.Job) (*entities.Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job.ID = id
+	job.Owner = r.owner
+	job.Status = entities.JobStatusQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	if err := r.store.CreateJob(job); err != nil {
+		return nil, err
+	}
+
+	r.dispatch(job)
+	return &job, nil
+}
+
+// Resume re-dispatches jobs left queued or running by a previous process.
+// A job that was already sent upstream before the restart is sent again, so
+// dispatch is at-least-once. It returns the number of resumed jobs.
+func (r *Runner) Resume() (int, error) {
+	pending, err := r.pendingJobs()
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range pending {
+		log.Printf("Resuming job %s (%s)", job.ID, job.Status)
+		job.Status = entities.JobStatusQueued
+		r.dispatch(job)
+	}
+	return len(pending), nil
+}
+
+// FailPending marks jobs left queued or running by a previous process as
+// failed with the given reason, for when they must not be re-dispatched.
+func (r *Runner) FailPending(reason string) (int, error) {
+	pending, err := r.pendingJobs()
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range pending {
+		job.Status = entities.JobStatusFailed
+		job.Error = reason
+		r.update(&job)
+	}
+	return len(pending), nil
+}
+
+// pendingJobs returns the queued and running jobs of the runner's owner
+func (r *Runner) pendingJobs() ([]entities.Job, error) {
+	pending, err := r.store.ListPendingJobs()
+	if err != nil || r.owner == "" {
+		return pending, err
+	}
+	owned := pending[:0]
+	for _, job := range pending {
+		if job.Owner == r.owner {
+			owned = append(owned, job)
+		}
+	}
+	return owned, nil
+}
+
+// Get returns the current state of a job, including its queue position
+// while it waits to be dispatched
+func (r *Runner) Get(id string) (*entities.Job, error) {
+	job, err := r.store.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if estimate, ok := r.estimates[id]; ok {
+		job.Queue = &estimate
+	}
+	return job, nil
+}
+
+// Wait blocks until all submitted jobs have finished
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// dispatch runs the job in the background
+func (r *Runner) dispatch(job entities.Job) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(job)
+	}()
+}
+
+// Execute sends a job upstream and returns it with its outcome, without
+// storing it, for callers that deliver results themselves. Usage is recorded
+// as for submitted jobs.
+func (r *Runner) Execute(job entities.Job) entities.Job {
+	r.awaitMaintenance(job.ID)
+	job.Status = entities.JobStatusRunning
+	r.execute(&job, nil)
+	return job
+}
+
+// run sends the job upstream and stores the outcome
+func (r *Runner) run(job entities.Job) {
+	r.awaitMaintenance(job.ID)
+	job.Status = entities.JobStatusRunning
+	r.update(&job)
+
+	r.execute(&job, func(estimate entities.QueueEstimate) {
+		r.mu.Lock()
+		r.estimates[job.ID] = estimate
+		r.mu.Unlock()
+	})
+	r.mu.Lock()
+	delete(r.estimates, job.ID)
+	r.mu.Unlock()
+	r.update(&job)
+}
+
+// awaitMaintenance blocks while maintenance mode is on, so the job stays
+// queued instead of being sent upstream
+func (r *Runner) awaitMaintenance(id string) {
+	if r.maintenance == nil || !r.maintenance.State().Enabled {
+		return
+	}
+	log.Printf("Holding job %s until maintenance ends", id)
+	for r.maintenance.State().Enabled {
+		time.Sleep(maintenanceCheckInterval)
+	}
+}
+
+// execute pushes the job through the queue, sets its outcome and records its
+// response and usage in its session
+func (r *Runner) execute(job *entities.Job, onEnqueue func(entities.QueueEstimate)) {
+	resp := r.queue.Push(entities.ProxyRequest{
+		SessionID:    sessionOf(*job),
+		TenantID:     job.TenantID,
+		VirtualKeyID: job.VirtualKeyID,
+		Method:       job.Method,
+		Path:         job.Path,
+		Headers:      job.RequestHeaders,
+		Body:         job.RequestBody,
+		OnEnqueue:    onEnqueue,
+	})
+
+	if resp.Err != nil {
+		log.Printf("Job %s failed: %v", job.ID, resp.Err)
+		job.Status = entities.JobStatusFailed
+		job.Error = resp.Err.Error()
+		r.recordResponse(*job, http.StatusBadGateway, job.Error, "")
+		return
+	}
+
+	job.Status = entities.JobStatusCompleted
+	job.ResponseStatus = resp.StatusCode
+	job.ResponseBody = resp.Body
+	job.ResponseContentType = resp.Headers.Get("Content-Type")
+	var message, errorType string
+	if resp.UpstreamError != nil {
+		message, errorType = resp.UpstreamError.Message, resp.UpstreamError.Type
+	}
+	r.recordResponse(*job, resp.StatusCode, message, errorType)
+
+	succeeded := resp.StatusCode >= http.StatusOK && resp.StatusCode < 300
+	if job.SessionID != "" && r.sessions != nil && (resp.Cached || succeeded) {
+		r.recordTokenUsage(*job, resp)
+	}
+}
+
+// update persists the job state, stamping the update time
+func (r *Runner) update(job *entities.Job) {
+	job.UpdatedAt = time.Now()
+	if err := r.store.UpdateJob(*job); err != nil {
+		log.Printf("Error updating job %s: %v", job.ID, err)
+	}
+}
+
+// recordResponse adds the job's response status to its session's statistics
+func (r *Runner) recordResponse(job entities.Job, statusCode int, message, errorType string) {
+	if job.SessionID == "" || r.sessions == nil {
+		return
+	}
+	if err := r.sessions.RecordResponse(sessionOf(job), statusCode, message, errorType); err != nil {
+		log.Printf("Error recording response status for job %s: %v", job.ID, err)
+	}
+}
+
+// recordTokenUsage adds the job's usage to its session, creating the session if needed
+func (r *Runner) recordTokenUsage(job entities.Job, resp entities.ProxyResponse) {
+	sessionID := sessionOf(job)
+	if _, err := r.sessions.GetSession(sessionID); err != nil {
+		if _, err := r.sessions.CreateSession(sessionID); err != nil {
+			log.Printf("Error creating session %s for job %s: %v", sessionID, job.ID, err)
+			return
+		}
+	}
+
+	// Cached responses count as a request but cost no upstream tokens
+	var usage entities.TokenUsage
+	if !resp.Cached {
+		parsed, err := r.sessions.ParseTokenUsageFromResponse(resp.Body)
+		if err != nil {
+			log.Printf("Error parsing token usage for job %s: %v", job.ID, err)
+		}
+		if parsed == nil {
+			parsed = r.sessions.EstimateTokenUsage(job.RequestBody, resp.Body)
+		}
+		if parsed != nil {
+			usage = *parsed
+		}
+		usage.ToolCalls = r.sessions.ParseToolCalls(resp.Body)
+	}
+
+	if _, err := r.sessions.UpdateSessionTokens(sessionID, usage); err != nil {
+		log.Printf("Error updating session tokens for %s: %v", sessionID, err)
+	}
+}
+
+// sessionOf returns the ID of the session a job is tracked in, namespaced by its tenant
+func sessionOf(job entities.Job) string {
+	return entities.TenantSessionID(job.TenantID, job.SessionID)
+}
+
+// newJobID generates a random job identifier
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return "job_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,285 @@
+package jobs_test
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/jobs"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/session"
+)
+
+type stubQueue struct {
+	resp entities.ProxyResponse
+	got  entities.ProxyRequest
+}
+
+func (q *stubQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.got = r
+	return q.resp
+}
+
+func TestRunner_CompletesJobAndRecordsUsage(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	q := &stubQueue{resp: entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`),
+	}}
+	runner := jobs.NewRunner(repo, q, session.NewSessionManager(repo, nil))
+
+	job, err := runner.Submit(entities.Job{
+		SessionID:   "s1",
+		Method:      http.MethodPost,
+		Path:        "/v1/chat/completions",
+		RequestBody: []byte(`{"model":"gpt-4o"}`),
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job.ID == "" || job.Status != entities.JobStatusQueued {
+		t.Fatalf("Submit() = %+v, want queued job with ID", job)
+	}
+	runner.Wait()
+
+	got, err := runner.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Status != entities.JobStatusCompleted || got.ResponseStatus != http.StatusOK || string(got.ResponseBody) != string(q.resp.Body) {
+		t.Errorf("Get() = %+v, want completed job with upstream response", got)
+	}
+	if q.got.Path != "/v1/chat/completions" || string(q.got.Body) != `{"model":"gpt-4o"}` {
+		t.Errorf("queued request = %+v, want job request", q.got)
+	}
+
+	sess, err := repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.TotalTokens != 15 || sess.RequestCount != 1 || sess.Responses2xx != 1 {
+		t.Errorf("session = %+v, want 15 tokens over 1 successful request", sess)
+	}
+}
+
+func TestRunner_RecordsUpstreamFailure(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	q := &stubQueue{resp: entities.ProxyResponse{Err: errors.New("connection refused")}}
+	runner := jobs.NewRunner(repo, q, nil)
+
+	job, err := runner.Submit(entities.Job{Method: http.MethodPost, Path: "/v1/embeddings"})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	runner.Wait()
+
+	got, err := runner.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Status != entities.JobStatusFailed || got.Error != "connection refused" {
+		t.Errorf("Get() = %+v, want failed job with error", got)
+	}
+}
+
+func TestRunner_ExecuteDoesNotStoreJob(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	q := &stubQueue{resp: entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`{"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`),
+	}}
+	runner := jobs.NewRunner(repo, q, session.NewSessionManager(repo, nil))
+
+	got := runner.Execute(entities.Job{ID: "r1", SessionID: "s1", Method: http.MethodPost, Path: "/v1/chat/completions"})
+	if got.Status != entities.JobStatusCompleted || got.ResponseStatus != http.StatusOK || string(got.ResponseBody) != string(q.resp.Body) {
+		t.Errorf("Execute() = %+v, want completed job with upstream response", got)
+	}
+	if _, err := runner.Get("r1"); !errors.Is(err, entities.ErrJobNotFound) {
+		t.Errorf("Get() error = %v, want ErrJobNotFound", err)
+	}
+	sess, err := repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.TotalTokens != 5 {
+		t.Errorf("session tokens = %d, want 5", sess.TotalTokens)
+	}
+}
+
+func TestRunner_Resume(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	now := time.Now()
+	for _, job := range []entities.Job{
+		{ID: "job_queued", Status: entities.JobStatusQueued, Method: http.MethodPost, Path: "/v1/embeddings", CreatedAt: now},
+		{ID: "job_running", Status: entities.JobStatusRunning, Method: http.MethodPost, Path: "/v1/embeddings", CreatedAt: now.Add(time.Second)},
+		{ID: "job_done", Status: entities.JobStatusCompleted, Method: http.MethodPost, Path: "/v1/embeddings", CreatedAt: now},
+	} {
+		if err := repo.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+	}
+
+	q := &stubQueue{resp: entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{}`)}}
+	runner := jobs.NewRunner(repo, q, nil)
+	resumed, err := runner.Resume()
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	runner.Wait()
+
+	if resumed != 2 {
+		t.Errorf("Resume() = %d, want 2", resumed)
+	}
+	for _, id := range []string{"job_queued", "job_running"} {
+		job, _ := repo.GetJob(id)
+		if job.Status != entities.JobStatusCompleted {
+			t.Errorf("job %s status = %s, want %s", id, job.Status, entities.JobStatusCompleted)
+		}
+	}
+}
+
+func TestRunner_FailPending(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	if err := repo.CreateJob(entities.Job{ID: "job_running", Status: entities.JobStatusRunning}); err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+
+	runner := jobs.NewRunner(repo, &stubQueue{}, nil)
+	failed, err := runner.FailPending("interrupted")
+	if err != nil {
+		t.Fatalf("FailPending() error = %v", err)
+	}
+	if failed != 1 {
+		t.Errorf("FailPending() = %d, want 1", failed)
+	}
+	job, _ := repo.GetJob("job_running")
+	if job.Status != entities.JobStatusFailed || job.Error != "interrupted" {
+		t.Errorf("job = %+v, want failed with reason", job)
+	}
+}
+
+func TestRunner_RecoversOwnJobs(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, job := range []entities.Job{
+		{ID: "job_mine", Status: entities.JobStatusRunning, Owner: "replica-a"},
+		{ID: "job_peer", Status: entities.JobStatusRunning, Owner: "replica-b"},
+	} {
+		if err := repo.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+	}
+
+	runner := jobs.NewRunner(repo, &stubQueue{}, nil).WithOwner("replica-a")
+	failed, err := runner.FailPending("interrupted")
+	if err != nil || failed != 1 {
+		t.Fatalf("FailPending() = %d, %v, want 1", failed, err)
+	}
+	if job, _ := repo.GetJob("job_peer"); job.Status != entities.JobStatusRunning {
+		t.Errorf("peer job status = %s, want it left running", job.Status)
+	}
+
+	submitted, err := runner.Submit(entities.Job{Method: http.MethodPost, Path: "/v1/embeddings"})
+	runner.Wait()
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job, _ := repo.GetJob(submitted.ID); job.Owner != "replica-a" {
+		t.Errorf("submitted job owner = %q, want replica-a", job.Owner)
+	}
+}
+
+type blockingQueue struct {
+	enqueued chan struct{}
+	release  chan struct{}
+}
+
+func (q *blockingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	r.OnEnqueue(entities.QueueEstimate{Position: 2, DispatchAt: time.Now().Add(time.Second)})
+	close(q.enqueued)
+	<-q.release
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{}`)}
+}
+
+func TestRunner_ReportsQueuePosition(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	q := &blockingQueue{enqueued: make(chan struct{}), release: make(chan struct{})}
+	runner := jobs.NewRunner(repo, q, nil)
+
+	job, err := runner.Submit(entities.Job{Method: http.MethodPost, Path: "/v1/embeddings"})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-q.enqueued
+
+	got, err := runner.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Queue == nil || got.Queue.Position != 2 {
+		t.Errorf("Get().Queue = %+v, want position 2", got.Queue)
+	}
+
+	close(q.release)
+	runner.Wait()
+
+	got, _ = runner.Get(job.ID)
+	if got.Queue != nil {
+		t.Errorf("Get().Queue = %+v after completion, want nil", got.Queue)
+	}
+}
+
+type stubMaintenance struct {
+	enabled atomic.Bool
+}
+
+func (m *stubMaintenance) State() entities.MaintenanceState {
+	return entities.MaintenanceState{Enabled: m.enabled.Load()}
+}
+
+func TestRunner_HoldsJobsDuringMaintenance(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	queue := &countingQueue{}
+	mode := &stubMaintenance{}
+	mode.enabled.Store(true)
+	runner := jobs.NewRunner(repo, queue, nil).WithMaintenance(mode)
+
+	submitted, err := runner.Submit(entities.Job{Method: http.MethodPost, Path: "/v1/embeddings"})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	executed := make(chan entities.Job)
+	go func() { executed <- runner.Execute(entities.Job{Method: http.MethodPost, Path: "/v1/embeddings"}) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := queue.pushes.Load(); n != 0 {
+		t.Fatalf("pushes during maintenance = %d, want 0", n)
+	}
+	if job, _ := repo.GetJob(submitted.ID); job.Status != entities.JobStatusQueued {
+		t.Errorf("job status during maintenance = %s, want queued", job.Status)
+	}
+
+	mode.enabled.Store(false)
+	if job := <-executed; job.Status != entities.JobStatusCompleted {
+		t.Errorf("executed job status = %s, want completed", job.Status)
+	}
+	runner.Wait()
+	if job, _ := repo.GetJob(submitted.ID); job.Status != entities.JobStatusCompleted {
+		t.Errorf("job status after maintenance = %s, want completed", job.Status)
+	}
+	if n := queue.pushes.Load(); n != 2 {
+		t.Errorf("pushes after maintenance = %d, want 2", n)
+	}
+}
+
+type countingQueue struct {
+	pushes atomic.Int32
+}
+
+func (q *countingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.pushes.Add(1)
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(`{}`)}
+}
@@ -0,0 +1,402 @@
+// Package kafka turns the proxy into a batch worker: it consumes requests
+// from a Kafka topic, sends them through the proxy queue like async jobs,
+// and writes their responses to an output topic. It talks to Kafka through
+// the v2 API of a Kafka REST Proxy, such as Confluent's or Redpanda's.
+package kafka
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Metrics of the consumer
+const (
+	// RecordsMetric counts the records consumed from the input topic
+	RecordsMetric = "kafka_records_total"
+	// InvalidRecordsMetric counts the records that were not valid requests
+	InvalidRecordsMetric = "kafka_invalid_records_total"
+	// RejectedRecordsMetric counts the records rejected by tenant resolution
+	// or a request filter
+	RejectedRecordsMetric = "kafka_rejected_records_total"
+	// ErrorsMetric counts failed calls to the REST Proxy
+	ErrorsMetric = "kafka_errors_total"
+)
+
+// maxRetryDelay bounds the backoff after failed REST Proxy calls
+const maxRetryDelay = 30 * time.Second
+
+// callTimeout bounds the REST Proxy calls that finish a batch, which are not
+// interrupted by Close
+const callTimeout = 30 * time.Second
+
+// Executor runs a job synchronously and returns its outcome
+type Executor interface {
+	Execute(job entities.Job) entities.Job
+}
+
+// RequestFilter rewrites or rejects the request of a record before it is
+// sent, as for requests of the HTTP API
+type RequestFilter interface {
+	Filter(sessionID string, req *entities.ProxyRequest) error
+}
+
+// TenantResolver finds the tenant, and the virtual key if any, of a request
+// from its credentials
+type TenantResolver interface {
+	Resolve(r *http.Request) (*entities.Tenant, string, *entities.RequestError)
+}
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// Consumer consumes requests from the input topic and produces their results
+// to the output topic. A poll's records are processed concurrently; their
+// offsets are committed once all results are produced, so records are
+// processed at least once.
+type Consumer struct {
+	rest     *restClient
+	settings entities.KafkaSettings
+	executor Executor
+	metrics  Counter
+	name     string
+	// tenants identifies the tenant of each record; nil sends records without one
+	tenants TenantResolver
+	filters []RequestFilter
+
+	// ctx is cancelled by Close to stop polling
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// NewConsumer creates a new Consumer. Start must be called to begin consuming.
+func NewConsumer(settings entities.KafkaSettings, executor Executor, metrics Counter, client *http.Client) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{
+		rest: &restClient{
+			baseURL:  settings.RESTURL,
+			username: settings.Username,
+			password: settings.Password,
+			client:   client,
+		},
+		settings: settings,
+		executor: executor,
+		metrics:  metrics,
+		name:     instanceName(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// WithTenants makes the consumer identify the tenant of each record from its
+// headers and path, as the tenant middleware does for HTTP requests
+func (c *Consumer) WithTenants(tenants TenantResolver) *Consumer {
+	c.tenants = tenants
+	return c
+}
+
+// WithFilters applies filters to the request of each record, in order
+func (c *Consumer) WithFilters(filters ...RequestFilter) *Consumer {
+	c.filters = filters
+	return c
+}
+
+// Start consumes in the background until Close is called
+func (c *Consumer) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run()
+	}()
+}
+
+// Close stops polling, waits for the records being processed and the
+// production of their results, and deletes the consumer instance
+func (c *Consumer) Close() {
+	c.once.Do(func() {
+		c.cancel()
+		c.wg.Wait()
+	})
+}
+
+// run polls, processes and commits batches of records, re-creating the
+// consumer instance when the REST Proxy expired it
+func (c *Consumer) run() {
+	var consumer string
+	delay := time.Second
+	defer func() {
+		if consumer != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+			defer cancel()
+			if err := c.rest.deleteConsumer(ctx, consumer); err != nil {
+				log.Printf("Failed to delete Kafka consumer %s: %v", c.name, err)
+			}
+		}
+	}()
+
+	for c.ctx.Err() == nil {
+		if consumer == "" {
+			var err error
+			if consumer, err = c.subscribe(); err != nil {
+				c.fail("subscribe to "+c.settings.InputTopic, err, &delay)
+				continue
+			}
+			log.Printf("Consuming Kafka topic %s as %s in group %s", c.settings.InputTopic, c.name, c.settings.Group)
+		}
+
+		records, err := c.rest.poll(c.ctx, consumer, c.settings.PollTimeout)
+		if isNotFound(err) {
+			log.Printf("Kafka consumer %s expired, re-creating it", c.name)
+			consumer = ""
+			continue
+		}
+		if err != nil {
+			c.fail("poll "+c.settings.InputTopic, err, &delay)
+			continue
+		}
+		if len(records) == 0 {
+			continue
+		}
+
+		if !c.finish(consumer, records) {
+			log.Printf("Kafka consumer %s expired before committing its records, re-creating it", c.name)
+			consumer = ""
+		}
+		delay = time.Second
+	}
+}
+
+// subscribe creates a consumer instance and subscribes it to the input topic
+func (c *Consumer) subscribe() (string, error) {
+	consumer, err := c.rest.createConsumer(c.ctx, c.settings.Group, c.name)
+	if err != nil {
+		return "", err
+	}
+	if err := c.rest.subscribe(c.ctx, consumer, c.settings.InputTopic); err != nil {
+		c.rest.deleteConsumer(c.ctx, consumer)
+		return "", err
+	}
+	return consumer, nil
+}
+
+// fail logs and counts a failed REST Proxy call, then backs off
+func (c *Consumer) fail(action string, err error, delay *time.Duration) {
+	if c.ctx.Err() != nil {
+		return
+	}
+	log.Printf("Kafka consumer failed to %s: %v", action, err)
+	c.metrics.Inc(ErrorsMetric)
+	timer := time.NewTimer(*delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+	}
+	*delay = min(*delay*2, maxRetryDelay)
+}
+
+// process runs the records' requests, at most Concurrency at a time, and
+// returns the output records in the same order
+func (c *Consumer) process(records []record) []produceRecord {
+	results := make([]produceRecord, len(records))
+	slots := make(chan struct{}, max(c.settings.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, rec := range records {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			results[i] = produceRecord{Key: rec.Key, Value: c.handle(rec)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// handle runs the request of a record and returns the value of its result
+func (c *Consumer) handle(rec record) []byte {
+	c.metrics.Inc(RecordsMetric)
+	result := entities.KafkaResult{Partition: rec.Partition, Offset: rec.Offset}
+
+	var req entities.KafkaRequest
+	if err := json.Unmarshal(rec.Value, &req); err != nil {
+		c.metrics.Inc(InvalidRecordsMetric)
+		result.StatusCode = http.StatusBadRequest
+		result.Error = "Invalid request record: " + err.Error()
+		return encodeResult(result)
+	}
+	result.ID, result.SessionID = req.ID, req.SessionID
+	var tenantID, keyID string
+	if c.tenants != nil {
+		var reqErr *entities.RequestError
+		if tenantID, keyID, reqErr = c.resolveTenant(&req); reqErr != nil {
+			c.metrics.Inc(RejectedRecordsMetric)
+			return encodeRejection(result, reqErr)
+		}
+	}
+	if reqErr := req.Validate(); reqErr != nil {
+		c.metrics.Inc(InvalidRecordsMetric)
+		return encodeRejection(result, reqErr)
+	}
+
+	sessionID := entities.TenantSessionID(tenantID, req.SessionID)
+	proxyReq := entities.ProxyRequest{
+		SessionID:    sessionID,
+		TenantID:     tenantID,
+		VirtualKeyID: keyID,
+		Method:       req.Method,
+		Path:         req.Path,
+		Headers:      http.Header{"Content-Type": {"application/json"}},
+		Body:         req.Body,
+	}
+	for _, filter := range c.filters {
+		if err := filter.Filter(sessionID, &proxyReq); err != nil {
+			var reqErr *entities.RequestError
+			if !errors.As(err, &reqErr) {
+				log.Printf("Request filter error on Kafka record %d/%d: %v", rec.Partition, rec.Offset, err)
+				reqErr = &entities.RequestError{StatusCode: http.StatusInternalServerError, Message: "Failed to process request"}
+			}
+			c.metrics.Inc(RejectedRecordsMetric)
+			return encodeRejection(result, reqErr)
+		}
+	}
+
+	job := c.executor.Execute(entities.Job{
+		ID:             req.ID,
+		SessionID:      req.SessionID,
+		TenantID:       tenantID,
+		VirtualKeyID:   keyID,
+		Method:         proxyReq.Method,
+		Path:           proxyReq.Path,
+		RequestHeaders: proxyReq.Headers,
+		RequestBody:    proxyReq.Body,
+	})
+	if job.Status == entities.JobStatusFailed {
+		result.StatusCode = http.StatusBadGateway
+		result.Error = job.Error
+		return encodeResult(result)
+	}
+	result.StatusCode = job.ResponseStatus
+	result.Body = job.Result()
+	return encodeResult(result)
+}
+
+// resolveTenant identifies the tenant of a record from its headers and path,
+// and strips the tenant prefix from the path in path mode
+func (c *Consumer) resolveTenant(req *entities.KafkaRequest) (string, string, *entities.RequestError) {
+	httpReq, err := http.NewRequest(cmp.Or(req.Method, http.MethodPost), req.Path, bytes.NewReader(req.Body))
+	if err != nil {
+		return "", "", &entities.RequestError{StatusCode: http.StatusBadRequest, Message: "Invalid request path: " + err.Error()}
+	}
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	tenant, keyID, reqErr := c.tenants.Resolve(httpReq)
+	if reqErr != nil {
+		return "", "", reqErr
+	}
+	req.Path = httpReq.URL.Path
+	return tenant.ID, keyID, nil
+}
+
+// finish processes a batch of records, then produces their results and
+// commits their offsets, retrying until both succeed. The consumer instance
+// has moved past the records, so they are only consumed again, by whichever
+// member gets their partitions, if it gives up: when the consumer is closed,
+// or has expired, which it reports by returning false.
+func (c *Consumer) finish(consumer string, records []record) bool {
+	results := c.process(records)
+	produced := false
+	delay := time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+		var err error
+		if !produced {
+			err = c.rest.produce(ctx, c.settings.OutputTopic, results)
+			produced = err == nil
+		}
+		if err == nil {
+			err = c.rest.commit(ctx, consumer, lastOffsets(records))
+		}
+		cancel()
+		switch {
+		case err == nil:
+			return true
+		case isNotFound(err) && produced:
+			return false
+		case c.ctx.Err() != nil:
+			log.Printf("Kafka consumer closed before finishing a batch: %v", err)
+			return true
+		}
+		c.fail("finish a batch of "+c.settings.InputTopic, err, &delay)
+	}
+}
+
+// encodeResult returns the JSON of a result
+func encodeResult(result entities.KafkaResult) []byte {
+	value, err := json.Marshal(result)
+	if err != nil {
+		// Only the body can fail to encode, and Job.Result returns valid JSON
+		log.Printf("Error encoding Kafka result: %v", err)
+		result.Body = nil
+		value, _ = json.Marshal(result)
+	}
+	return value
+}
+
+// encodeRejection returns the JSON of a result for a record that was not sent
+func encodeRejection(result entities.KafkaResult, reqErr *entities.RequestError) []byte {
+	result.StatusCode = reqErr.StatusCode
+	result.Error = reqErr.Message
+	return encodeResult(result)
+}
+
+// lastOffsets returns the highest offset of each partition of the records
+func lastOffsets(records []record) []offset {
+	last := make(map[string]map[int]int64)
+	var offsets []offset
+	for _, rec := range records {
+		if last[rec.Topic] == nil {
+			last[rec.Topic] = make(map[int]int64)
+		}
+		if current, ok := last[rec.Topic][rec.Partition]; !ok || rec.Offset > current {
+			last[rec.Topic][rec.Partition] = rec.Offset
+		}
+	}
+	for topic, partitions := range last {
+		for partition, o := range partitions {
+			offsets = append(offsets, offset{Topic: topic, Partition: partition, Offset: o})
+		}
+	}
+	return offsets
+}
+
+// instanceName returns a consumer instance name unique to this process
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "llm-queue-proxy"
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", host, hex.EncodeToString(b))
+}
@@ -0,0 +1,288 @@
+package kafka_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/kafka"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/redact"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tenant"
+)
+
+type record struct {
+	Topic     string `json:"topic"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// restProxy is a Kafka REST Proxy serving one batch of records to the first
+// poll and recording what is produced and committed
+type restProxy struct {
+	t       *testing.T
+	server  *httptest.Server
+	records []record
+	// expireFirstPoll makes the first poll fail as if the instance expired
+	expireFirstPoll bool
+
+	mu        sync.Mutex
+	consumers int
+	polls     int
+	deleted   int
+	produced  []record
+	committed []map[string]any
+}
+
+func newRESTProxy(t *testing.T, records []record) *restProxy {
+	p := &restProxy{t: t, records: records}
+	p.server = httptest.NewServer(http.HandlerFunc(p.handle))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *restProxy) handle(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	instance := "/consumers/batch/instances/worker"
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/consumers/batch":
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["format"] != "binary" || req["auto.commit.enable"] != "false" {
+			p.t.Errorf("consumer created with %v", req)
+		}
+		p.consumers++
+		w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+		json.NewEncoder(w).Encode(map[string]string{"instance_id": req["name"], "base_uri": p.server.URL + instance})
+	case r.Method == http.MethodPost && r.URL.Path == instance+"/subscription":
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == instance+"/records":
+		p.polls++
+		if p.expireFirstPoll && p.polls == 1 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error_code": 40403, "message": "Consumer instance not found."})
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+		if p.records == nil {
+			time.Sleep(10 * time.Millisecond)
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(p.records)
+		p.records = nil
+	case r.Method == http.MethodPost && r.URL.Path == "/topics/results":
+		if got := r.Header.Get("Content-Type"); got != "application/vnd.kafka.binary.v2+json" {
+			p.t.Errorf("produce Content-Type = %q", got)
+		}
+		var req struct {
+			Records []record `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		p.produced = append(p.produced, req.Records...)
+		offsets := make([]map[string]any, len(req.Records))
+		for i := range offsets {
+			offsets[i] = map[string]any{"partition": 0, "offset": i, "error_code": nil, "error": nil}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"offsets": offsets})
+	case r.Method == http.MethodPost && r.URL.Path == instance+"/offsets":
+		var req struct {
+			Offsets []map[string]any `json:"offsets"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		p.committed = append(p.committed, req.Offsets...)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && r.URL.Path == instance:
+		p.deleted++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		p.t.Errorf("unexpected REST Proxy call %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (p *restProxy) wait(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		p.mu.Lock()
+		done := cond()
+		p.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the consumer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// executor answers jobs with a canned response per path
+type executor struct {
+	mu   sync.Mutex
+	jobs []entities.Job
+}
+
+func (e *executor) Execute(job entities.Job) entities.Job {
+	e.mu.Lock()
+	e.jobs = append(e.jobs, job)
+	e.mu.Unlock()
+	switch job.Path {
+	case "/v1/audio/speech":
+		job.Status = entities.JobStatusFailed
+		job.Error = "upstream unreachable"
+	default:
+		job.Status = entities.JobStatusCompleted
+		job.ResponseStatus = http.StatusOK
+		job.ResponseBody = []byte(`{"choices":[]}`)
+	}
+	return job
+}
+
+func settings(url string) entities.KafkaSettings {
+	return entities.KafkaSettings{
+		RESTURL:     url,
+		Group:       "batch",
+		InputTopic:  "requests",
+		OutputTopic: "results",
+		Concurrency: 2,
+		PollTimeout: 10 * time.Millisecond,
+	}
+}
+
+func TestConsumer_ProcessesRecords(t *testing.T) {
+	proxy := newRESTProxy(t, []record{
+		{Topic: "requests", Key: []byte("k1"), Partition: 0, Offset: 7,
+			Value: []byte(`{"id":"r1","path":"/v1/chat/completions","session_id":"s1","body":{"model":"gpt-4o"}}`)},
+		{Topic: "requests", Key: []byte("k2"), Partition: 1, Offset: 3, Value: []byte(`not json`)},
+		{Topic: "requests", Key: []byte("k3"), Partition: 0, Offset: 8, Value: []byte(`{"id":"r3","path":"/v1/jobs"}`)},
+		{Topic: "requests", Key: []byte("k4"), Partition: 1, Offset: 4, Value: []byte(`{"id":"r4","path":"/v1/audio/speech"}`)},
+	})
+	exec := &executor{}
+	registry := metrics.NewMetrics()
+	consumer := kafka.NewConsumer(settings(proxy.server.URL), exec, registry, http.DefaultClient)
+	consumer.Start()
+
+	proxy.wait(t, func() bool { return len(proxy.committed) == 2 })
+	consumer.Close()
+
+	if len(exec.jobs) != 2 {
+		t.Fatalf("executed %d jobs, want 2", len(exec.jobs))
+	}
+	for _, job := range exec.jobs {
+		if job.Path == "/v1/chat/completions" && (job.Method != http.MethodPost || job.SessionID != "s1" || string(job.RequestBody) != `{"model":"gpt-4o"}`) {
+			t.Errorf("job = %+v", job)
+		}
+	}
+
+	want := map[string]string{
+		"k1": `{"id":"r1","session_id":"s1","status_code":200,"body":{"choices":[]},"partition":0,"offset":7}`,
+		"k3": `{"id":"r3","status_code":400,"error":"Job path must be an upstream endpoint such as /v1/chat/completions","partition":0,"offset":8}`,
+		"k4": `{"id":"r4","status_code":502,"error":"upstream unreachable","partition":1,"offset":4}`,
+	}
+	if len(proxy.produced) != 4 {
+		t.Fatalf("produced %d records, want 4", len(proxy.produced))
+	}
+	for _, rec := range proxy.produced {
+		key := string(rec.Key)
+		if key == "k2" {
+			if !strings.Contains(string(rec.Value), `"status_code":400,"error":"Invalid request record`) {
+				t.Errorf("result of invalid record = %s", rec.Value)
+			}
+			continue
+		}
+		if string(rec.Value) != want[key] {
+			t.Errorf("result of %s = %s, want %s", key, rec.Value, want[key])
+		}
+	}
+
+	// The last offset of each partition is committed
+	offsets := map[float64]float64{}
+	for _, o := range proxy.committed {
+		offsets[o["partition"].(float64)] = o["offset"].(float64)
+	}
+	if offsets[0] != 8 || offsets[1] != 4 {
+		t.Errorf("committed offsets = %v, want partition 0 at 8 and 1 at 4", offsets)
+	}
+	if proxy.deleted != 1 {
+		t.Errorf("consumer instance deleted %d times, want 1", proxy.deleted)
+	}
+
+	counters := registry.Snapshot()
+	if counters[kafka.RecordsMetric] != 4 || counters[kafka.InvalidRecordsMetric] != 2 {
+		t.Errorf("metrics = %v, want 4 records of which 2 invalid", counters)
+	}
+}
+
+func TestConsumer_RecreatesExpiredInstance(t *testing.T) {
+	proxy := newRESTProxy(t, []record{
+		{Topic: "requests", Key: []byte("k1"), Value: []byte(`{"path":"/v1/embeddings"}`)},
+	})
+	proxy.expireFirstPoll = true
+	consumer := kafka.NewConsumer(settings(proxy.server.URL), &executor{}, metrics.NewMetrics(), http.DefaultClient)
+	consumer.Start()
+	defer consumer.Close()
+
+	proxy.wait(t, func() bool { return len(proxy.produced) == 1 })
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	if proxy.consumers != 2 {
+		t.Errorf("created %d consumer instances, want 2", proxy.consumers)
+	}
+}
+
+func TestConsumer_ResolvesTenantsAndFiltersRecords(t *testing.T) {
+	proxy := newRESTProxy(t, []record{
+		{Topic: "requests", Key: []byte("k1"), Partition: 0, Offset: 1,
+			Value: []byte(`{"id":"r1","path":"/v1/chat/completions","session_id":"s1","headers":{"X-Tenant":"acme"},"body":{"prompt":"mail jane@example.com"}}`)},
+		{Topic: "requests", Key: []byte("k2"), Partition: 0, Offset: 2,
+			Value: []byte(`{"id":"r2","path":"/v1/chat/completions","body":{"prompt":"hi"}}`)},
+	})
+	store := repository.NewMemoryRepository()
+	if err := store.CreateTenant(entities.Tenant{ID: "acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	email, err := redact.NewBuiltinScrubber("email")
+	if err != nil {
+		t.Fatalf("NewBuiltinScrubber() error = %v", err)
+	}
+	exec := &executor{}
+	registry := metrics.NewMetrics()
+	consumer := kafka.NewConsumer(settings(proxy.server.URL), exec, registry, http.DefaultClient).
+		WithTenants(tenant.NewResolver(store, entities.TenantSettings{Mode: entities.TenantModeHeader, Header: "X-Tenant"})).
+		WithFilters(redact.NewRedactor(email))
+	consumer.Start()
+
+	proxy.wait(t, func() bool { return len(proxy.committed) == 1 })
+	consumer.Close()
+
+	if len(exec.jobs) != 1 {
+		t.Fatalf("executed %d jobs, want 1", len(exec.jobs))
+	}
+	job := exec.jobs[0]
+	if job.TenantID != "acme" || job.SessionID != "s1" {
+		t.Errorf("job tenant = %q, session = %q, want acme and s1", job.TenantID, job.SessionID)
+	}
+	if body := string(job.RequestBody); !strings.Contains(body, "[REDACTED_EMAIL]") || strings.Contains(body, "jane@example.com") {
+		t.Errorf("job body = %s, want the email redacted", body)
+	}
+
+	for _, rec := range proxy.produced {
+		if string(rec.Key) == "k2" && !strings.Contains(string(rec.Value), `"status_code":401`) {
+			t.Errorf("result of record without tenant = %s, want 401", rec.Value)
+		}
+	}
+	if counters := registry.Snapshot(); counters[kafka.RejectedRecordsMetric] != 1 {
+		t.Errorf("metrics = %v, want 1 rejected record", counters)
+	}
+}
@@ -0,0 +1,184 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types of the REST Proxy v2 API
+const (
+	contentTypeV2     = "application/vnd.kafka.v2+json"
+	contentTypeBinary = "application/vnd.kafka.binary.v2+json"
+)
+
+// maxErrorBytes bounds the error bodies read from the REST Proxy
+const maxErrorBytes = 4096
+
+// restError is an error response of the REST Proxy
+type restError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *restError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Kafka REST Proxy returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Kafka REST Proxy returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound reports whether err is a 404 of the REST Proxy, e.g. for a
+// consumer instance it expired
+func isNotFound(err error) bool {
+	var restErr *restError
+	return errors.As(err, &restErr) && restErr.StatusCode == http.StatusNotFound
+}
+
+// record is a record read from a topic. Keys and values are base64 encoded,
+// as encoding/json does for []byte, in the binary embedded format.
+type record struct {
+	Topic     string `json:"topic"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// produceRecord is a record written to a topic
+type produceRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// offset is the position committed for a partition
+type offset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// restClient calls the v2 API of a Kafka REST Proxy
+type restClient struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// createConsumer creates a consumer instance in the group that reads binary
+// records from the earliest uncommitted offset and commits explicitly. It
+// returns the instance's URL.
+func (c *restClient) createConsumer(ctx context.Context, group, name string) (string, error) {
+	var created struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := c.do(ctx, http.MethodPost, c.baseURL+"/consumers/"+url.PathEscape(group), contentTypeV2, map[string]string{
+		"name":               name,
+		"format":             "binary",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &created)
+	if err != nil {
+		return "", err
+	}
+	if created.BaseURI == "" {
+		return "", errors.New("Kafka REST Proxy returned no consumer base_uri")
+	}
+	return created.BaseURI, nil
+}
+
+// subscribe subscribes a consumer instance to a topic
+func (c *restClient) subscribe(ctx context.Context, consumer, topic string) error {
+	return c.do(ctx, http.MethodPost, consumer+"/subscription", contentTypeV2, map[string][]string{"topics": {topic}}, nil)
+}
+
+// poll fetches the next records of a consumer instance, waiting up to timeout
+func (c *restClient) poll(ctx context.Context, consumer string, timeout time.Duration) ([]record, error) {
+	var records []record
+	err := c.do(ctx, http.MethodGet, consumer+"/records?timeout="+strconv.FormatInt(timeout.Milliseconds(), 10), "", nil, &records)
+	return records, err
+}
+
+// commit commits the offsets of processed records. The REST Proxy commits the
+// position after each given offset.
+func (c *restClient) commit(ctx context.Context, consumer string, offsets []offset) error {
+	return c.do(ctx, http.MethodPost, consumer+"/offsets", contentTypeV2, map[string][]offset{"offsets": offsets}, nil)
+}
+
+// deleteConsumer deletes a consumer instance, handing its partitions to the
+// other members of the group
+func (c *restClient) deleteConsumer(ctx context.Context, consumer string) error {
+	return c.do(ctx, http.MethodDelete, consumer, contentTypeV2, nil, nil)
+}
+
+// produce writes records to a topic
+func (c *restClient) produce(ctx context.Context, topic string, records []produceRecord) error {
+	var produced struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	err := c.do(ctx, http.MethodPost, c.baseURL+"/topics/"+url.PathEscape(topic), contentTypeBinary, map[string][]produceRecord{"records": records}, &produced)
+	if err != nil {
+		return err
+	}
+	for _, o := range produced.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return fmt.Errorf("failed to produce to %s: %s", topic, o.Error)
+		}
+	}
+	return nil
+}
+
+// do sends a request with a JSON body, if any, and decodes the JSON response into out
+func (c *restClient) do(ctx context.Context, method, target, contentType string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", strings.Join([]string{contentTypeBinary, contentTypeV2}, ", "))
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Kafka REST Proxy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		restErr := &restError{StatusCode: resp.StatusCode}
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+		json.Unmarshal(errBody, restErr)
+		return restErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Kafka REST Proxy response: %w", err)
+	}
+	return nil
+}
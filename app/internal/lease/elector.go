@@ -0,0 +1,104 @@
+// Package lease elects the instance that runs background tasks when several
+// instances share a repository, so periodic work runs on exactly one of them.
+package lease
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Store interface {
+	AcquireLease(lease entities.Lease, now time.Time) (bool, error)
+	ReleaseLease(name, holder string) error
+}
+
+// Elector holds a named lease for as long as its instance runs. The lease is
+// renewed at a third of its TTL, so a stopped instance's lease is taken over
+// by another within one TTL.
+type Elector struct {
+	store  Store
+	name   string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+	leader atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewElector creates a new Elector competing for the named lease as holder
+func NewElector(store Store, name, holder string, ttl time.Duration) *Elector {
+	return &Elector{
+		store:  store,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Start tries to acquire the lease, then keeps renewing or competing for it in
+// the background until Close is called
+func (e *Elector) Start() {
+	e.Renew()
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				e.Renew()
+			}
+		}
+	}()
+}
+
+// Renew acquires or renews the lease and reports whether this instance leads.
+// Leadership is given up when the store cannot be reached, since another
+// instance may take over once the lease expires.
+func (e *Elector) Renew() bool {
+	now := e.now()
+	held, err := e.store.AcquireLease(entities.Lease{Name: e.name, Holder: e.holder, ExpiresAt: now.Add(e.ttl)}, now)
+	if err != nil {
+		log.Printf("Error renewing the %s lease: %v", e.name, err)
+		held = false
+	}
+	if e.leader.Swap(held) != held {
+		if held {
+			log.Printf("Instance %s acquired the %s lease and runs background tasks", e.holder, e.name)
+		} else {
+			log.Printf("Instance %s lost the %s lease", e.holder, e.name)
+		}
+	}
+	return held
+}
+
+// IsLeader reports whether this instance held the lease when it last renewed it
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Close stops renewing and releases the lease so another instance can take
+// over without waiting for it to expire
+func (e *Elector) Close() {
+	if e.stop == nil {
+		return
+	}
+	close(e.stop)
+	<-e.done
+	e.stop = nil
+	if e.leader.Swap(false) {
+		if err := e.store.ReleaseLease(e.name, e.holder); err != nil {
+			log.Printf("Error releasing the %s lease: %v", e.name, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package lease
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestElector_SingleLeader(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	now := time.Now()
+	clock := func() time.Time { return now }
+	a := NewElector(repo, "background", "replica-a", 30*time.Second)
+	b := NewElector(repo, "background", "replica-b", 30*time.Second)
+	a.now, b.now = clock, clock
+
+	if !a.Renew() || b.Renew() {
+		t.Fatalf("Renew() = %v, %v, want only the first instance to lead", a.IsLeader(), b.IsLeader())
+	}
+
+	// The lease moves once its holder stops renewing it
+	now = now.Add(31 * time.Second)
+	if !b.Renew() || !b.IsLeader() {
+		t.Error("Renew() of the second instance after the lease expired = false, want true")
+	}
+	if a.Renew() || a.IsLeader() {
+		t.Error("Renew() of the first instance after losing the lease = true, want false")
+	}
+}
+
+func TestElector_CloseReleasesLease(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	a := NewElector(repo, "background", "replica-a", time.Minute)
+	a.Start()
+	if !a.IsLeader() {
+		t.Fatal("IsLeader() after Start() = false, want true")
+	}
+	a.Close()
+	a.Close()
+
+	b := NewElector(repo, "background", "replica-b", time.Minute)
+	if !b.Renew() {
+		t.Error("Renew() after the leader closed = false, want true")
+	}
+}
@@ -0,0 +1,74 @@
+// Package maintenance holds the maintenance mode of the proxy, switched on the
+// admin listener while upstreams, keys or the proxy itself are being worked on
+package maintenance
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Defaults of the maintenance settings
+const (
+	DefaultReason            = "The proxy is down for maintenance, retry later"
+	DefaultRetryAfterSeconds = 60
+)
+
+// Mode is the maintenance mode. It is not persisted, so a restarted proxy
+// accepts requests again.
+type Mode struct {
+	mu    sync.RWMutex
+	state entities.MaintenanceState
+	now   func() time.Time
+}
+
+// NewMode creates a new Mode, disabled
+func NewMode() *Mode {
+	return &Mode{now: time.Now}
+}
+
+// State returns the current maintenance state
+func (m *Mode) State() entities.MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Enable starts maintenance, or updates its reason and Retry-After while it
+// is on. An empty reason and a zero Retry-After take the defaults.
+func (m *Mode) Enable(reason string, retryAfterSeconds int) (entities.MaintenanceState, error) {
+	if retryAfterSeconds < 0 {
+		return entities.MaintenanceState{}, fmt.Errorf("%w: retry_after_seconds must not be negative", entities.ErrInvalidMaintenance)
+	}
+	if reason == "" {
+		reason = DefaultReason
+	}
+	if retryAfterSeconds == 0 {
+		retryAfterSeconds = DefaultRetryAfterSeconds
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	since := m.state.Since
+	if !m.state.Enabled {
+		now := m.now()
+		since = &now
+	}
+	m.state = entities.MaintenanceState{
+		Enabled:           true,
+		Reason:            reason,
+		RetryAfterSeconds: retryAfterSeconds,
+		Since:             since,
+	}
+	return m.state, nil
+}
+
+// Disable ends maintenance
+func (m *Mode) Disable() entities.MaintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = entities.MaintenanceState{}
+	return m.state
+}
@@ -0,0 +1,42 @@
+package maintenance
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestMode(t *testing.T) {
+	m := NewMode()
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return start }
+	if m.State().Enabled {
+		t.Fatal("new mode is enabled")
+	}
+
+	state, err := m.Enable("", 0)
+	if err != nil || !state.Enabled || state.Reason != DefaultReason || state.RetryAfterSeconds != DefaultRetryAfterSeconds ||
+		state.Since == nil || !state.Since.Equal(start) {
+		t.Fatalf("Enable() = %+v, %v, want the defaults", state, err)
+	}
+
+	// Updating the reason keeps the start of the maintenance
+	m.now = func() time.Time { return start.Add(time.Hour) }
+	state, _ = m.Enable("Rotating upstream keys", 300)
+	if state.Reason != "Rotating upstream keys" || state.RetryAfterSeconds != 300 || !state.Since.Equal(start) {
+		t.Errorf("Enable() while enabled = %+v", state)
+	}
+
+	if _, err := m.Enable("", -1); !errors.Is(err, entities.ErrInvalidMaintenance) {
+		t.Errorf("Enable() with a negative Retry-After error = %v, want ErrInvalidMaintenance", err)
+	}
+	if m.State().RetryAfterSeconds != 300 {
+		t.Errorf("a rejected Enable() changed the state to %+v", m.State())
+	}
+
+	if state := m.Disable(); state.Enabled || state.Since != nil {
+		t.Errorf("Disable() = %+v", state)
+	}
+}
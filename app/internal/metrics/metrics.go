@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// Metrics is a set of named in-process counters
+type Metrics struct {
+	counters map[string]int64
+	mu       sync.Mutex
+}
+
+// NewMetrics creates an empty Metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters: make(map[string]int64),
+	}
+}
+
+// Inc increments the named counter by one
+func (m *Metrics) Inc(name string) {
+	m.Add(name, 1)
+}
+
+// Add increments the named counter by delta
+func (m *Metrics) Add(name string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// Snapshot returns a copy of all counters
+func (m *Metrics) Snapshot() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[string]int64, len(m.counters))
+	for k, v := range m.counters {
+		result[k] = v
+	}
+	return result
+}
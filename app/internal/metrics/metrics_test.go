@@ -0,0 +1,37 @@
+package metrics_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+)
+
+func TestMetrics_IncAndSnapshot(t *testing.T) {
+	m := metrics.NewMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Inc("requests")
+		}()
+	}
+	wg.Wait()
+	m.Add("tokens", 42)
+
+	snap := m.Snapshot()
+	if snap["requests"] != 10 {
+		t.Errorf("requests = %d, want 10", snap["requests"])
+	}
+	if snap["tokens"] != 42 {
+		t.Errorf("tokens = %d, want 42", snap["tokens"])
+	}
+
+	// Snapshot must be a copy
+	snap["requests"] = 0
+	if m.Snapshot()["requests"] != 10 {
+		t.Error("Snapshot() returned a map aliasing internal state")
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenAuth rejects requests without the token with 401. The token is
+// accepted as a bearer token or, for browsers, as the password of HTTP Basic
+// authentication with any user name. An empty token disables the check.
+func TokenAuth(token, realm string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasToken(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+				w.Header().Add("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasToken checks the Authorization header against the token
+func hasToken(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		if _, provided, ok = r.BasicAuth(); !ok {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
@@ -0,0 +1,41 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+func TestTokenAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		token      string
+		setAuth    func(r *http.Request)
+		wantStatus int
+	}{
+		{"bearer token", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+		{"basic password", "secret", func(r *http.Request) { r.SetBasicAuth("anyone", "secret") }, http.StatusOK},
+		{"wrong token", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"no credentials", "secret", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"disabled", "", func(r *http.Request) {}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			tt.setAuth(req)
+			rr := httptest.NewRecorder()
+			middleware.TokenAuth(tt.token, "admin")(ok).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && len(rr.Header().Values("WWW-Authenticate")) != 2 {
+				t.Errorf("WWW-Authenticate = %v, want Bearer and Basic challenges", rr.Header().Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Forwarded resolves the client address of each request, through trusted
+// proxies, and stores it in the request context. With setHeaders, it also
+// adds the peer to X-Forwarded-For and Forwarded and sets X-Forwarded-Proto
+// and X-Forwarded-Host, so that the upstream sees where requests came from.
+// Forwarding headers sent by untrusted peers are replaced rather than extended,
+// since anyone could have written them.
+func Forwarded(trustedProxies []netip.Prefix, setHeaders bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if addr, ok := ClientIP(r, trustedProxies); ok {
+				ctx = entities.ContextWithClientIP(ctx, addr.String())
+			}
+			r = r.WithContext(ctx)
+			if setHeaders {
+				r.Header = r.Header.Clone()
+				setForwardedHeaders(r, trustedProxies)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setForwardedHeaders adds the peer of a request to its forwarding headers
+func setForwardedHeaders(r *http.Request, trustedProxies []netip.Prefix) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return
+	}
+	peer = peer.Unmap()
+	trusted := contains(trustedProxies, peer)
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	if !trusted {
+		for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"} {
+			r.Header.Del(name)
+		}
+	}
+
+	forwardedFor := peer.String()
+	prior := strings.Join(r.Header.Values("X-Forwarded-For"), ", ")
+	if prior == "" && trusted {
+		// Keep the client a trusted X-Real-IP named, which ClientIP would
+		// otherwise lose once the peer is in X-Forwarded-For
+		prior = strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	}
+	if prior != "" {
+		forwardedFor = prior + ", " + forwardedFor
+	}
+	r.Header.Set("X-Forwarded-For", forwardedFor)
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		r.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if r.Header.Get("X-Forwarded-Host") == "" {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+
+	// RFC 7239 requires IPv6 addresses to be bracketed and quoted
+	node := peer.String()
+	if peer.Is6() {
+		node = strconv.Quote("[" + node + "]")
+	}
+	element := "for=" + node + ";host=" + strconv.Quote(r.Host) + ";proto=" + proto
+	if prior := strings.Join(r.Header.Values("Forwarded"), ", "); prior != "" {
+		element = prior + ", " + element
+	}
+	r.Header.Set("Forwarded", element)
+}
@@ -0,0 +1,111 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+func TestForwarded(t *testing.T) {
+	trusted := mustParsePrefixes(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		setHeaders bool
+		wantIP     string
+		want       http.Header
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:5000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}, "Forwarded": {"for=198.51.100.1"}},
+			setHeaders: true,
+			wantIP:     "203.0.113.7",
+			want: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"proxy.example.com"},
+				"Forwarded":         {`for=203.0.113.7;host="proxy.example.com";proto=http`},
+			},
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:5000",
+			header: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"api.example.com"},
+			},
+			setHeaders: true,
+			wantIP:     "198.51.100.1",
+			want: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1, 10.0.0.2"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"api.example.com"},
+				"Forwarded":         {`for=10.0.0.2;host="proxy.example.com";proto=http`},
+			},
+		},
+		{
+			name:       "trusted real IP",
+			remoteAddr: "10.0.0.2:5000",
+			header:     http.Header{"X-Real-Ip": {"198.51.100.1"}},
+			setHeaders: true,
+			wantIP:     "198.51.100.1",
+			want: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1, 10.0.0.2"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"proxy.example.com"},
+				"Forwarded":         {`for=10.0.0.2;host="proxy.example.com";proto=http`},
+			},
+		},
+		{
+			name:       "IPv6 client",
+			remoteAddr: "[2001:db8::1]:5000",
+			setHeaders: true,
+			wantIP:     "2001:db8::1",
+			want: http.Header{
+				"X-Forwarded-For":   {"2001:db8::1"},
+				"X-Forwarded-Proto": {"http"},
+				"X-Forwarded-Host":  {"proxy.example.com"},
+				"Forwarded":         {`for="[2001:db8::1]";host="proxy.example.com";proto=http`},
+			},
+		},
+		{
+			name:       "headers disabled",
+			remoteAddr: "203.0.113.7:5000",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			wantIP:     "203.0.113.7",
+			want:       http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIP string
+			var got http.Header
+			handler := middleware.Forwarded(trusted, tt.setHeaders)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP = entities.ClientIPFromContext(r.Context())
+				got = r.Header
+			}))
+			req := httptest.NewRequest(http.MethodPost, "http://proxy.example.com/v1/chat/completions", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotIP != tt.wantIP {
+				t.Errorf("client IP = %q, want %q", gotIP, tt.wantIP)
+			}
+			for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "Forwarded"} {
+				if got.Get(name) != tt.want.Get(name) {
+					t.Errorf("%s = %q, want %q", name, got.Get(name), tt.want.Get(name))
+				}
+			}
+		})
+	}
+}
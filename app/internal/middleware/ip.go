@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+)
+
+// Limiter is a set of token buckets keyed by client
+type Limiter interface {
+	Allow(key string, now time.Time, perMinute, burst int) (time.Duration, bool)
+}
+
+// ParsePrefixes parses CIDR ranges such as 10.0.0.0/8; plain addresses match only themselves
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR %q", value)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR %q", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ClientIP returns the address of the client that sent a request. When the
+// peer is a trusted proxy, the client is the last address in X-Forwarded-For
+// that was not added by a trusted proxy. Proxies such as nginx that only set
+// X-Real-IP are trusted for that header when X-Forwarded-For is absent.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !contains(trustedProxies, addr) {
+		return addr, true
+	}
+
+	forwardedFor := r.Header.Values("X-Forwarded-For")
+	if len(forwardedFor) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap(), true
+		}
+		return addr, true
+	}
+	hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed entry ends the chain that can be trusted
+			break
+		}
+		addr = hop.Unmap()
+		if !contains(trustedProxies, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+// IPFilter rejects requests from clients outside allowed (if not empty) or
+// inside denied with 403
+func IPFilter(allowed, denied, trustedProxies []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := ClientIP(r, trustedProxies)
+			if !ok || (len(allowed) > 0 && !contains(allowed, addr)) || contains(denied, addr) {
+				log.Printf("Rejected request from %s to %s", r.RemoteAddr, r.URL.Path)
+				httperr.Write(w, &entities.RequestError{
+					StatusCode: http.StatusForbidden,
+					Message:    "Requests from your IP address are not allowed",
+					Type:       "permission_error",
+					Code:       "ip_not_allowed",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPRateLimit limits each client IP to perMinute requests with bursts of up
+// to burst requests, replying 429 with Retry-After beyond that
+func IPRateLimit(limiter Limiter, perMinute, burst int, trustedProxies []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := ClientIP(r, trustedProxies)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if wait, allowed := limiter.Allow(addr.String(), time.Now(), perMinute, burst); !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				httperr.Write(w, &entities.RequestError{
+					StatusCode: http.StatusTooManyRequests,
+					Message:    fmt.Sprintf("Too many requests from your IP address; the limit is %d per minute", perMinute),
+					Type:       "rate_limit_error",
+					Code:       "ip_rate_limit_exceeded",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/ratelimit"
+)
+
+func mustParsePrefixes(t *testing.T, values ...string) []netip.Prefix {
+	t.Helper()
+	prefixes, err := middleware.ParsePrefixes(values)
+	if err != nil {
+		t.Fatalf("ParsePrefixes(%v) error = %v", values, err)
+	}
+	return prefixes
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes := mustParsePrefixes(t, "10.1.2.3/8", "192.168.1.5", " 2001:db8::/32 ", "")
+	want := []string{"10.0.0.0/8", "192.168.1.5/32", "2001:db8::/32"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("ParsePrefixes() = %v, want %v", prefixes, want)
+	}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("ParsePrefixes()[%d] = %s, want %s", i, prefix, want[i])
+		}
+	}
+
+	if _, err := middleware.ParsePrefixes([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParsePrefixes() with an invalid CIDR error = nil, want an error")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := mustParsePrefixes(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "", "203.0.113.7"},
+		{"untrusted peer ignores header", "203.0.113.7:5000", "198.51.100.1", "", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed hop before the client", "10.0.0.2:5000", "1.1.1.1, 198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"malformed hop", "10.0.0.2:5000", "198.51.100.1, junk", "", "10.0.0.2"},
+		{"ipv4-mapped ipv6", "[::ffff:203.0.113.7]:5000", "", "", "203.0.113.7"},
+		{"real IP from trusted proxy", "10.0.0.2:5000", "", "198.51.100.1", "198.51.100.1"},
+		{"real IP from untrusted peer", "203.0.113.7:5000", "", "198.51.100.1", "203.0.113.7"},
+		{"forwarded-for wins over real IP", "10.0.0.2:5000", "198.51.100.1", "192.0.2.9", "198.51.100.1"},
+		{"malformed real IP", "10.0.0.2:5000", "", "junk", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			got, ok := middleware.ClientIP(req, trusted)
+			if !ok || got.String() != tt.want {
+				t.Errorf("ClientIP() = %s, %v, want %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	allowed := mustParsePrefixes(t, "203.0.113.0/24")
+	denied := mustParsePrefixes(t, "203.0.113.66")
+	handler := middleware.IPFilter(allowed, denied, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"203.0.113.7:5000", http.StatusOK},
+		{"203.0.113.66:5000", http.StatusForbidden},
+		{"198.51.100.1:5000", http.StatusForbidden},
+		{"not-an-address", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.RemoteAddr = tt.remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("request from %s status = %d, want %d", tt.remoteAddr, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestIPRateLimit(t *testing.T) {
+	handler := middleware.IPRateLimit(ratelimit.NewLimiter(), 60, 2, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := request("203.0.113.7:5000"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i+1, rr.Code, http.StatusOK)
+		}
+	}
+	rr := request("203.0.113.7:5001")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("request beyond the burst = %d, Retry-After %q, want 429 and 1", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if rr := request("198.51.100.1:5000"); rr.Code != http.StatusOK {
+		t.Errorf("request from another client status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
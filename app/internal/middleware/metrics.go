@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RequestsMetric is the counter incremented for every request, in total and
+// per status class, e.g. http_requests_total{status="5xx"}
+const RequestsMetric = "http_requests_total"
+
+// Metrics counts the requests served and the class of their status codes
+func Metrics(counter Counter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			counter.Inc(RequestsMetric)
+			counter.Inc(fmt.Sprintf("%s{status=%q}", RequestsMetric, fmt.Sprintf("%dxx", rec.Status()/100)))
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+func TestMetrics(t *testing.T) {
+	counter := &mockCounter{}
+	status := http.StatusOK
+	h := middleware.Metrics(counter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	for _, code := range []int{http.StatusOK, http.StatusCreated, http.StatusTooManyRequests, http.StatusBadGateway} {
+		status = code
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/version", nil))
+	}
+
+	want := map[string]int{
+		middleware.RequestsMetric:                    4,
+		middleware.RequestsMetric + `{status="2xx"}`: 2,
+		middleware.RequestsMetric + `{status="4xx"}`: 1,
+		middleware.RequestsMetric + `{status="5xx"}`: 1,
+	}
+	for name, count := range want {
+		if counter.counts[name] != count {
+			t.Errorf("%s = %d, want %d", name, counter.counts[name], count)
+		}
+	}
+}
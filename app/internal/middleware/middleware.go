@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Middleware wraps an http.Handler with cross-cutting behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middlewares to a handler. The first middleware is the outermost,
+// so Chain(h, a, b) handles a request as a(b(h)).
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Logging logs the method, path, status code and duration of every request
+func Logging() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			log.Printf("%s %s -> %d (%s)", r.Method, r.URL.Path, rec.Status(), time.Since(start))
+		})
+	}
+}
+
+// CORS adds CORS headers for the allowed origins and answers preflight requests.
+// An origin of "*" allows any origin.
+func CORS(allowedOrigins []string) Middleware {
+	allowAny := slices.Contains(allowedOrigins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || (!allowAny && !slices.Contains(allowedOrigins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", strings.TrimSpace(reqHeaders))
+				}
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StatusRecorder wraps an http.ResponseWriter and remembers the status code written
+type StatusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+// NewStatusRecorder creates a new StatusRecorder around w
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records the status code and forwards it
+func (sr *StatusRecorder) WriteHeader(code int) {
+	if !sr.wroteHeader {
+		sr.status = code
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Write marks the header as written and forwards the body
+func (sr *StatusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer if it supports flushing
+func (sr *StatusRecorder) Flush() {
+	sr.wroteHeader = true
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (sr *StatusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Status returns the recorded status code
+func (sr *StatusRecorder) Status() int {
+	return sr.status
+}
+
+// WroteHeader reports whether the response header has already been sent
+func (sr *StatusRecorder) WroteHeader() bool {
+	return sr.wroteHeader
+}
@@ -0,0 +1,89 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	tag := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+
+	middleware.Chain(h, tag("first"), tag("second")).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{"first", "second", "handler"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Chain order = %v, want %v", order, want)
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rec := middleware.NewStatusRecorder(rr)
+	if rec.Status() != http.StatusOK || rec.WroteHeader() {
+		t.Errorf("new recorder = (%d, %v), want (200, false)", rec.Status(), rec.WroteHeader())
+	}
+	rec.WriteHeader(http.StatusTeapot)
+	rec.WriteHeader(http.StatusOK) // second call must not override
+	if rec.Status() != http.StatusTeapot || !rec.WroteHeader() {
+		t.Errorf("recorder after WriteHeader = (%d, %v), want (418, true)", rec.Status(), rec.WroteHeader())
+	}
+}
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name               string
+		allowed            []string
+		method             string
+		origin             string
+		preflight          bool
+		expectedStatusCode int
+		expectedAllow      string
+	}{
+		{"allowed origin", []string{"https://a.example"}, http.MethodPost, "https://a.example", false, http.StatusOK, "https://a.example"},
+		{"disallowed origin", []string{"https://a.example"}, http.MethodPost, "https://b.example", false, http.StatusOK, ""},
+		{"wildcard", []string{"*"}, http.MethodGet, "https://b.example", false, http.StatusOK, "https://b.example"},
+		{"preflight", []string{"*"}, http.MethodOptions, "https://b.example", true, http.StatusNoContent, "https://b.example"},
+		{"no origin", []string{"*"}, http.MethodGet, "", false, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/chat/completions", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			rr := httptest.NewRecorder()
+
+			middleware.CORS(tt.allowed)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatusCode {
+				t.Errorf("CORS status code = %v, want %v", rr.Code, tt.expectedStatusCode)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.expectedAllow)
+			}
+		})
+	}
+}
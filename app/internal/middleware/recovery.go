@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+)
+
+// Counter records named events
+type Counter interface {
+	Inc(name string)
+}
+
+// PanicsMetric is the counter incremented for every recovered panic
+const PanicsMetric = "http_panics_total"
+
+// Recovery recovers from panics in downstream handlers, logs the stack trace,
+// increments the panic counter and replies with a JSON 500 in the OpenAI error format.
+func Recovery(counter Counter) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := NewStatusRecorder(w)
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					// Deliberate abort; let net/http handle it silently
+					panic(p)
+				}
+
+				log.Printf("Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+				if counter != nil {
+					counter.Inc(PanicsMetric)
+				}
+
+				if rec.WroteHeader() {
+					// Too late for an error response; drop the connection
+					panic(http.ErrAbortHandler)
+				}
+				httperr.Write(w, &entities.RequestError{
+					StatusCode: http.StatusInternalServerError,
+					Message:    "The proxy encountered an internal error while processing the request.",
+					Type:       "server_error",
+					Code:       "internal_error",
+				})
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/middleware"
+)
+
+type mockCounter struct {
+	counts map[string]int
+}
+
+func (m *mockCounter) Inc(name string) {
+	if m.counts == nil {
+		m.counts = make(map[string]int)
+	}
+	m.counts[name]++
+}
+
+func TestRecovery_Panic(t *testing.T) {
+	counter := &mockCounter{}
+	h := middleware.Recovery(counter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/session/s1/chat/completions", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Recovery status code = %v, want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Recovery Content-Type = %q, want application/json", ct)
+	}
+	var errResp entities.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Recovery body is not JSON: %v (%q)", err, rr.Body.String())
+	}
+	if errResp.Error.Type != "server_error" || errResp.Error.Message == "" {
+		t.Errorf("Recovery error envelope = %+v, want server_error with message", errResp.Error)
+	}
+	if counter.counts[middleware.PanicsMetric] != 1 {
+		t.Errorf("panic counter = %d, want 1", counter.counts[middleware.PanicsMetric])
+	}
+}
+
+func TestRecovery_NoPanic(t *testing.T) {
+	counter := &mockCounter{}
+	h := middleware.Recovery(counter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Recovery status code = %v, want %v", rr.Code, http.StatusAccepted)
+	}
+	if len(counter.counts) != 0 {
+		t.Errorf("panic counter incremented without panic: %v", counter.counts)
+	}
+}
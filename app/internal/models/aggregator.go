@@ -0,0 +1,192 @@
+// Package models answers GET /v1/models with the models of every configured
+// upstream, so clients can discover what the proxy can route
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Path is the endpoint the aggregator answers
+const Path = "/v1/models"
+
+// maxListBytes bounds the model lists read from the upstreams
+const maxListBytes = 8 << 20
+
+// Queue processes proxy requests
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Pricer returns the unit prices that apply to a model
+type Pricer interface {
+	Prices(model string) map[string]float64
+}
+
+// Aggregator is a queue decorator that answers GET /v1/models with the
+// merged model lists of the upstreams, each model annotated with the
+// upstreams serving it and its prices. The merged list is cached for the
+// TTL; when no upstream answers, the last list is served, or the request
+// is passed on if there is none.
+type Aggregator struct {
+	next      Queue
+	upstreams []entities.UpstreamTarget
+	pricer    Pricer
+	ttl       time.Duration
+	timeout   time.Duration
+	now       func() time.Time
+	// apiKey is the primary key, replaced when it is rotated
+	apiKey atomic.Pointer[string]
+
+	// mu is held while the list is refreshed, so concurrent requests wait
+	// for one refresh
+	mu        sync.Mutex
+	body      []byte
+	fetchedAt time.Time
+}
+
+// NewAggregator creates a new Aggregator of the upstreams in front of next.
+// The primary key is sent to upstreams without a key of their own.
+func NewAggregator(next Queue, upstreams []entities.UpstreamTarget, apiKey string, pricer Pricer, ttl, timeout time.Duration) *Aggregator {
+	a := &Aggregator{
+		next:      next,
+		upstreams: upstreams,
+		pricer:    pricer,
+		ttl:       ttl,
+		timeout:   timeout,
+		now:       time.Now,
+	}
+	a.apiKey.Store(&apiKey)
+	return a
+}
+
+// SetAPIKey replaces the primary key, e.g. after it was rotated
+func (a *Aggregator) SetAPIKey(key string) {
+	a.apiKey.Store(&key)
+}
+
+// Push answers model list requests and forwards the others
+func (a *Aggregator) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.Method != http.MethodGet || r.Path != Path {
+		return a.next.Push(r)
+	}
+	body := a.list()
+	if body == nil {
+		return a.next.Push(r)
+	}
+	return entities.ProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    http.Header{"Content-Type": {"application/json"}},
+		Body:       body,
+	}
+}
+
+// list returns the cached merged list, refreshing it once the TTL has passed
+func (a *Aggregator) list() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.body != nil && a.now().Sub(a.fetchedAt) < a.ttl {
+		return a.body
+	}
+	if body := a.fetch(); body != nil {
+		a.body, a.fetchedAt = body, a.now()
+	}
+	return a.body
+}
+
+// fetch requests the lists of the upstreams concurrently and merges them. It
+// returns nil when none of them answered.
+func (a *Aggregator) fetch() []byte {
+	lists := make([][]entities.ModelInfo, len(a.upstreams))
+	var wg sync.WaitGroup
+	for i, upstream := range a.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models, err := a.fetchList(upstream)
+			if err != nil {
+				log.Printf("Failed to list the models of upstream %s: %v", upstream.Name, err)
+				return
+			}
+			lists[i] = models
+		}()
+	}
+	wg.Wait()
+
+	merged := entities.ModelList{Object: "list", Data: []entities.ModelInfo{}}
+	index := make(map[string]int)
+	answered := false
+	for i, models := range lists {
+		if models == nil {
+			continue
+		}
+		answered = true
+		for _, model := range models {
+			j, ok := index[model.ID]
+			if !ok {
+				j = len(merged.Data)
+				index[model.ID] = j
+				model.Providers = nil
+				model.Pricing = a.pricer.Prices(model.ID)
+				merged.Data = append(merged.Data, model)
+			}
+			if !slices.Contains(merged.Data[j].Providers, a.upstreams[i].Name) {
+				merged.Data[j].Providers = append(merged.Data[j].Providers, a.upstreams[i].Name)
+			}
+		}
+	}
+	if !answered {
+		return nil
+	}
+	body, err := json.Marshal(merged)
+	if err != nil {
+		log.Printf("Error encoding the model list: %v", err)
+		return nil
+	}
+	return body
+}
+
+// fetchList requests the model list of an upstream
+func (a *Aggregator) fetchList(upstream entities.UpstreamTarget) ([]entities.ModelInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.BaseURL+Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := upstream.APIKey
+	if apiKey == "" {
+		apiKey = *a.apiKey.Load()
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	client := upstream.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var list entities.ModelList
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxListBytes)).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	if list.Data == nil {
+		list.Data = []entities.ModelInfo{}
+	}
+	return list.Data, nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/pricing"
+)
+
+type passThrough struct {
+	pushed int
+}
+
+func (p *passThrough) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	p.pushed++
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte("upstream")}
+}
+
+// modelServer lists the models and counts the requests it receives
+func modelServer(t *testing.T, key string, status *atomic.Int32, models ...string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != Path || r.Header.Get("Authorization") != "Bearer "+key {
+			t.Errorf("model list requested at %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if status != nil && status.Load() != http.StatusOK {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		list := entities.ModelList{Object: "list"}
+		for _, id := range models {
+			list.Data = append(list.Data, entities.ModelInfo{ID: id, Object: "model", OwnedBy: "system"})
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAggregator(t *testing.T) {
+	var primaryStatus atomic.Int32
+	primaryStatus.Store(http.StatusOK)
+	primary, primaryRequests := modelServer(t, "primary-key", &primaryStatus, "gpt-4o", "gpt-4o-mini")
+	hedge, _ := modelServer(t, "hedge-key", nil, "gpt-4o", "llama-3")
+
+	next := &passThrough{}
+	prices := pricing.NewTable(map[string]float64{"gpt-4o/prompt_token": 2.5e-6})
+	a := NewAggregator(next, []entities.UpstreamTarget{
+		{Name: "primary", BaseURL: primary.URL},
+		{Name: "hedge", BaseURL: hedge.URL, APIKey: "hedge-key"},
+	}, "primary-key", prices, time.Minute, time.Second)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	resp := a.Push(entities.ProxyRequest{Method: http.MethodGet, Path: Path})
+	if resp.StatusCode != http.StatusOK || resp.Headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("response = %d %v", resp.StatusCode, resp.Headers)
+	}
+	var list entities.ModelList
+	if err := json.Unmarshal(resp.Body, &list); err != nil {
+		t.Fatalf("invalid list %s: %v", resp.Body, err)
+	}
+	if list.Object != "list" || len(list.Data) != 3 {
+		t.Fatalf("list = %s, want 3 models", resp.Body)
+	}
+	gpt4o := list.Data[0]
+	if gpt4o.ID != "gpt-4o" || len(gpt4o.Providers) != 2 || gpt4o.Providers[0] != "primary" || gpt4o.Providers[1] != "hedge" ||
+		gpt4o.Pricing[pricing.UnitPromptToken] != 2.5e-6 || gpt4o.OwnedBy != "system" {
+		t.Errorf("gpt-4o = %+v", gpt4o)
+	}
+	if llama := list.Data[2]; llama.ID != "llama-3" || len(llama.Providers) != 1 || llama.Providers[0] != "hedge" || llama.Pricing != nil {
+		t.Errorf("llama-3 = %+v", llama)
+	}
+
+	// Served from the cache within the TTL
+	a.Push(entities.ProxyRequest{Method: http.MethodGet, Path: Path})
+	if primaryRequests.Load() != 1 {
+		t.Errorf("primary listed %d times within the TTL, want 1", primaryRequests.Load())
+	}
+
+	// A failing upstream is left out once the TTL has passed
+	primaryStatus.Store(http.StatusServiceUnavailable)
+	now = now.Add(time.Minute)
+	resp = a.Push(entities.ProxyRequest{Method: http.MethodGet, Path: Path})
+	json.Unmarshal(resp.Body, &list)
+	if len(list.Data) != 2 || list.Data[0].Providers[0] != "hedge" {
+		t.Errorf("list without the primary = %s", resp.Body)
+	}
+
+	// Other requests are passed on
+	if resp := a.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions"}); string(resp.Body) != "upstream" || next.pushed != 1 {
+		t.Errorf("other request = %q, pushed %d", resp.Body, next.pushed)
+	}
+}
+
+func TestAggregator_NoUpstreamAnswers(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server, _ := modelServer(t, "key", &status)
+	next := &passThrough{}
+	a := NewAggregator(next, []entities.UpstreamTarget{{Name: "primary", BaseURL: server.URL}}, "key", pricing.NewTable(nil), time.Minute, time.Second)
+
+	if resp := a.Push(entities.ProxyRequest{Method: http.MethodGet, Path: Path}); string(resp.Body) != "upstream" || next.pushed != 1 {
+		t.Errorf("response = %q, want the request passed on", resp.Body)
+	}
+}
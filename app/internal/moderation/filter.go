@@ -0,0 +1,142 @@
+package moderation
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Classifier scores prompt text per moderation category
+type Classifier interface {
+	Classify(ctx context.Context, input []string) (*entities.ModerationResult, error)
+}
+
+type PromptExtractor interface {
+	PromptText(requestBody []byte) []string
+}
+
+type Store interface {
+	SaveRequestRecord(record entities.RequestRecord) error
+}
+
+// Filter runs a moderation pre-check on prompts before they are enqueued,
+// blocking or flagging requests that exceed the configured thresholds.
+type Filter struct {
+	classifier Classifier
+	extractor  PromptExtractor
+	store      Store
+	settings   entities.ModerationSettings
+	// failClosed rejects requests when the classifier is unavailable
+	failClosed bool
+}
+
+// NewFilter creates a new Filter with injected dependencies. Blocked requests
+// are recorded in store, which may be nil; forwarded requests carry their result
+// in ProxyRequest.Moderation.
+func NewFilter(classifier Classifier, extractor PromptExtractor, store Store, settings entities.ModerationSettings, failClosed bool) *Filter {
+	return &Filter{
+		classifier: classifier,
+		extractor:  extractor,
+		store:      store,
+		settings:   settings,
+		failClosed: failClosed,
+	}
+}
+
+// Filter classifies the request's prompt and applies the moderation action
+func (f *Filter) Filter(sessionID string, req *entities.ProxyRequest) error {
+	input := f.extractor.PromptText(req.Body)
+	if len(input) == 0 {
+		return nil
+	}
+
+	result, err := f.classifier.Classify(context.Background(), input)
+	if err != nil {
+		log.Printf("Moderation check failed: %v", err)
+		if f.failClosed {
+			return &entities.RequestError{
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "Content moderation is unavailable",
+				Type:       "server_error",
+				Code:       "moderation_unavailable",
+			}
+		}
+		return nil
+	}
+
+	result.Categories = f.triggered(result)
+	result.Flagged = len(result.Categories) > 0
+	result.Blocked = result.Flagged && f.settings.Action != entities.ModerationActionFlag
+	req.Moderation = result
+	if !result.Blocked {
+		if result.Flagged {
+			log.Printf("Request flagged by moderation: %s", strings.Join(result.Categories, ", "))
+		}
+		return nil
+	}
+
+	f.record(sessionID, req)
+	return &entities.RequestError{
+		StatusCode: http.StatusBadRequest,
+		Message:    "Request blocked by content moderation: " + strings.Join(result.Categories, ", "),
+		Type:       "invalid_request_error",
+		Code:       "content_flagged",
+	}
+}
+
+// triggered returns the categories that exceed their thresholds, sorted. Categories
+// without a threshold defer to the classifier's own flags.
+func (f *Filter) triggered(result *entities.ModerationResult) []string {
+	flagged := make(map[string]bool, len(result.Categories))
+	for _, category := range result.Categories {
+		flagged[category] = true
+	}
+	candidates := make(map[string]bool, len(result.Scores)+len(flagged))
+	for category := range result.Scores {
+		candidates[category] = true
+	}
+	for category := range flagged {
+		candidates[category] = true
+	}
+
+	var triggered []string
+	for category := range candidates {
+		threshold, ok := f.settings.Thresholds[category]
+		if !ok {
+			threshold = f.settings.DefaultThreshold
+		}
+		if threshold > 0 {
+			if result.Scores[category] >= threshold {
+				triggered = append(triggered, category)
+			}
+		} else if flagged[category] {
+			triggered = append(triggered, category)
+		}
+	}
+	sort.Strings(triggered)
+	return triggered
+}
+
+// record adds a blocked request to the request history
+func (f *Filter) record(sessionID string, req *entities.ProxyRequest) {
+	if f.store == nil {
+		return
+	}
+	record := entities.RequestRecord{
+		SessionID:  sessionID,
+		Method:     req.Method,
+		Path:       req.Path,
+		Model:      entities.BodyModel(req.Body),
+		StatusCode: http.StatusBadRequest,
+		Moderation: req.Moderation,
+		CreatedAt:  time.Now(),
+	}
+	if err := f.store.SaveRequestRecord(record); err != nil {
+		log.Printf("Error recording moderated request: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package moderation_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/moderation"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tokenizer"
+)
+
+type fixedClassifier struct {
+	result entities.ModerationResult
+	err    error
+}
+
+func (c *fixedClassifier) Classify(ctx context.Context, input []string) (*entities.ModerationResult, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	result := c.result
+	return &result, nil
+}
+
+type recordStore struct {
+	records []entities.RequestRecord
+}
+
+func (s *recordStore) SaveRequestRecord(record entities.RequestRecord) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+const chatBody = `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`
+
+func TestFilter_Thresholds(t *testing.T) {
+	classifier := &fixedClassifier{result: entities.ModerationResult{
+		Categories: []string{"harassment"},
+		Scores:     map[string]float64{"harassment": 0.6, "violence": 0.7, "self-harm": 0.2},
+	}}
+
+	tests := []struct {
+		name     string
+		settings entities.ModerationSettings
+		want     []string
+		blocked  bool
+	}{
+		{"classifier flags", entities.ModerationSettings{Action: entities.ModerationActionBlock}, []string{"harassment"}, true},
+		{"per-category thresholds", entities.ModerationSettings{
+			Action:     entities.ModerationActionBlock,
+			Thresholds: map[string]float64{"harassment": 0.9, "violence": 0.5},
+		}, []string{"violence"}, true},
+		{"default threshold", entities.ModerationSettings{Action: entities.ModerationActionBlock, DefaultThreshold: 0.1}, []string{"harassment", "self-harm", "violence"}, true},
+		{"flag only", entities.ModerationSettings{Action: entities.ModerationActionFlag}, []string{"harassment"}, false},
+		{"under thresholds", entities.ModerationSettings{Action: entities.ModerationActionBlock, DefaultThreshold: 0.95}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordStore{}
+			f := moderation.NewFilter(classifier, tokenizer.NewEstimator(), store, tt.settings, false)
+			req := &entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(chatBody)}
+
+			err := f.Filter("s1", req)
+
+			var reqErr *entities.RequestError
+			if blocked := errors.As(err, &reqErr); blocked != tt.blocked {
+				t.Fatalf("Filter() error = %v, want blocked %v", err, tt.blocked)
+			}
+			if tt.blocked && reqErr.Code != "content_flagged" {
+				t.Errorf("Filter() error code = %q, want content_flagged", reqErr.Code)
+			}
+			if req.Moderation == nil || len(req.Moderation.Categories) != len(tt.want) {
+				t.Fatalf("Filter() moderation = %+v, want categories %v", req.Moderation, tt.want)
+			}
+			for i, category := range tt.want {
+				if req.Moderation.Categories[i] != category {
+					t.Errorf("Filter() categories = %v, want %v", req.Moderation.Categories, tt.want)
+				}
+			}
+			if req.Moderation.Flagged != (len(tt.want) > 0) || req.Moderation.Blocked != tt.blocked {
+				t.Errorf("Filter() moderation = %+v, want flagged %v blocked %v", req.Moderation, len(tt.want) > 0, tt.blocked)
+			}
+			if tt.blocked != (len(store.records) == 1) {
+				t.Errorf("Filter() recorded %d requests, want a record only for blocked requests", len(store.records))
+			}
+			if tt.blocked && (store.records[0].Model != "gpt-4o" || store.records[0].StatusCode != http.StatusBadRequest) {
+				t.Errorf("Filter() record = %+v, want model and status", store.records[0])
+			}
+		})
+	}
+}
+
+func TestFilter_ClassifierUnavailable(t *testing.T) {
+	classifier := &fixedClassifier{err: errors.New("timeout")}
+	settings := entities.ModerationSettings{Action: entities.ModerationActionBlock}
+
+	open := moderation.NewFilter(classifier, tokenizer.NewEstimator(), nil, settings, false)
+	if err := open.Filter("s1", &entities.ProxyRequest{Body: []byte(chatBody)}); err != nil {
+		t.Errorf("Filter() fail-open error = %v, want nil", err)
+	}
+
+	closed := moderation.NewFilter(classifier, tokenizer.NewEstimator(), nil, settings, true)
+	var reqErr *entities.RequestError
+	if err := closed.Filter("s1", &entities.ProxyRequest{Body: []byte(chatBody)}); !errors.As(err, &reqErr) || reqErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Filter() fail-closed error = %v, want 503", err)
+	}
+}
+
+func TestFilter_SkipsRequestsWithoutPrompt(t *testing.T) {
+	classifier := &fixedClassifier{err: errors.New("must not be called")}
+	f := moderation.NewFilter(classifier, tokenizer.NewEstimator(), nil, entities.ModerationSettings{}, true)
+
+	if err := f.Filter("s1", &entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"}); err != nil {
+		t.Errorf("Filter() error = %v, want nil for requests without a prompt", err)
+	}
+}
+
+func TestKeywordClassifier(t *testing.T) {
+	keywords, err := moderation.ParseKeywords(`{"weapons":["grenade","rifle"],"spam":["buy now"]}`)
+	if err != nil {
+		t.Fatalf("ParseKeywords() error = %v", err)
+	}
+	c, err := moderation.NewKeywordClassifier(keywords)
+	if err != nil {
+		t.Fatalf("NewKeywordClassifier() error = %v", err)
+	}
+
+	result, err := c.Classify(context.Background(), []string{"How do I clean a Rifle?", "riflescope"})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if len(result.Categories) != 1 || result.Categories[0] != "weapons" || result.Scores["weapons"] != 1 || result.Scores["spam"] != 0 {
+		t.Errorf("Classify() = %+v, want only weapons flagged", result)
+	}
+}
+
+func TestOpenAIClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.Unmarshal(body, &req)
+		if r.URL.Path != "/v1/moderations" || r.Header.Get("Authorization") != "Bearer key" || req.Model != "omni-moderation-latest" || len(req.Input) != 2 {
+			t.Errorf("unexpected moderation request %s %q: %s", r.URL.Path, r.Header.Get("Authorization"), body)
+		}
+		w.Write([]byte(`{"results":[
+			{"categories":{"violence":false,"hate":true},"category_scores":{"violence":0.3,"hate":0.8}},
+			{"categories":{"violence":true,"hate":false},"category_scores":{"violence":0.9,"hate":0.1}}
+		]}`))
+	}))
+	defer server.Close()
+
+	c := moderation.NewOpenAIClassifier(server.URL, "key", "omni-moderation-latest", server.Client())
+	result, err := c.Classify(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Classify() error = %v", err)
+	}
+	if result.Scores["violence"] != 0.9 || result.Scores["hate"] != 0.8 || len(result.Categories) != 2 {
+		t.Errorf("Classify() = %+v, want merged scores and both categories", result)
+	}
+}
@@ -0,0 +1,68 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// KeywordClassifier is a local classifier that flags a category when the prompt
+// contains any of its terms as a whole word, case-insensitively.
+type KeywordClassifier struct {
+	patterns map[string]*regexp.Regexp
+}
+
+// NewKeywordClassifier creates a new KeywordClassifier from terms keyed by category
+func NewKeywordClassifier(keywords map[string][]string) (*KeywordClassifier, error) {
+	patterns := make(map[string]*regexp.Regexp, len(keywords))
+	for category, terms := range keywords {
+		quoted := make([]string, 0, len(terms))
+		for _, term := range terms {
+			if term = strings.TrimSpace(term); term != "" {
+				quoted = append(quoted, regexp.QuoteMeta(term))
+			}
+		}
+		if len(quoted) == 0 {
+			return nil, fmt.Errorf("moderation category %q has no terms", category)
+		}
+		patterns[category] = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return &KeywordClassifier{
+		patterns: patterns,
+	}, nil
+}
+
+// ParseKeywords parses keyword categories from a JSON object of category to terms
+func ParseKeywords(raw string) (map[string][]string, error) {
+	var keywords map[string][]string
+	if err := json.Unmarshal([]byte(raw), &keywords); err != nil {
+		return nil, fmt.Errorf("invalid moderation keywords: %w", err)
+	}
+	if len(keywords) == 0 {
+		return nil, errors.New("invalid moderation keywords: no categories")
+	}
+	return keywords, nil
+}
+
+// Classify scores each category 1 if any input matches one of its terms and 0 otherwise
+func (c *KeywordClassifier) Classify(ctx context.Context, input []string) (*entities.ModerationResult, error) {
+	result := &entities.ModerationResult{
+		Scores: make(map[string]float64, len(c.patterns)),
+	}
+	for category, pattern := range c.patterns {
+		result.Scores[category] = 0
+		for _, text := range input {
+			if pattern.MatchString(text) {
+				result.Scores[category] = 1
+				result.Categories = append(result.Categories, category)
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// OpenAIClassifier calls an OpenAI-compatible moderations endpoint, either the
+// provider's or a local classifier serving the same API.
+type OpenAIClassifier struct {
+	baseURL string
+	// apiKey is replaced at runtime by SetAPIKey when the key rotates
+	apiKey atomic.Pointer[string]
+	model  string
+	client *http.Client
+}
+
+// NewOpenAIClassifier creates a new OpenAIClassifier; an empty model uses the
+// endpoint's default
+func NewOpenAIClassifier(baseURL, apiKey, model string, client *http.Client) *OpenAIClassifier {
+	c := &OpenAIClassifier{
+		baseURL: baseURL,
+		model:   model,
+		client:  client,
+	}
+	c.SetAPIKey(apiKey)
+	return c
+}
+
+// SetAPIKey replaces the API key used for subsequent requests
+func (c *OpenAIClassifier) SetAPIKey(key string) {
+	c.apiKey.Store(&key)
+}
+
+type moderationRequest struct {
+	Model string   `json:"model,omitempty"`
+	Input []string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// Classify moderates the input, merging the results of all inputs: the highest
+// score per category and every category the endpoint flagged
+func (c *OpenAIClassifier) Classify(ctx context.Context, input []string) (*entities.ModerationResult, error) {
+	payload, err := json.Marshal(moderationRequest{Model: c.model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode moderation request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/moderations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create moderation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey := *c.apiKey.Load(); apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("moderation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var parsed moderationResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+
+	result := &entities.ModerationResult{
+		Scores: make(map[string]float64),
+	}
+	flagged := make(map[string]bool)
+	for _, r := range parsed.Results {
+		for category, score := range r.CategoryScores {
+			result.Scores[category] = max(result.Scores[category], score)
+		}
+		for category, isFlagged := range r.Categories {
+			if isFlagged && !flagged[category] {
+				flagged[category] = true
+				result.Categories = append(result.Categories, category)
+			}
+		}
+	}
+	return result, nil
+}
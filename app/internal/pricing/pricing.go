@@ -0,0 +1,70 @@
+// Package pricing prices session usage from a table of unit prices, so that
+// sessions reflect spend on endpoints that are not billed in tokens as well.
+package pricing
+
+import (
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Units that can be priced
+const (
+	UnitPromptToken     = "prompt_token"
+	UnitCompletionToken = "completion_token"
+	UnitImage           = "image"
+	UnitAudioSecond     = "audio_second"
+	UnitCharacter       = "character"
+	UnitTrainedToken    = "trained_token"
+)
+
+// Table holds unit prices keyed by "{model}/{unit}", or by "{unit}" for the
+// price of models without their own
+type Table struct {
+	prices map[string]float64
+}
+
+// NewTable creates a new Table from the configured prices
+func NewTable(prices map[string]float64) *Table {
+	return &Table{
+		prices: prices,
+	}
+}
+
+// Cost returns the price of a request's usage on a model. Units without a
+// price cost nothing.
+func (t *Table) Cost(model string, usage entities.TokenUsage) float64 {
+	if len(t.prices) == 0 {
+		return 0
+	}
+	return float64(usage.PromptTokens)*t.price(model, UnitPromptToken) +
+		float64(usage.CompletionTokens)*t.price(model, UnitCompletionToken) +
+		float64(usage.Images)*t.price(model, UnitImage) +
+		usage.AudioSeconds*t.price(model, UnitAudioSecond) +
+		float64(usage.Characters)*t.price(model, UnitCharacter) +
+		float64(usage.TrainedTokens)*t.price(model, UnitTrainedToken)
+}
+
+// price returns the price of a unit on a model, falling back to the price of
+// the unit
+func (t *Table) price(model, unit string) float64 {
+	if model != "" {
+		if price, ok := t.prices[model+"/"+unit]; ok {
+			return price
+		}
+	}
+	return t.prices[unit]
+}
+
+// Prices returns the unit prices that apply to a model, its own or the
+// default of the unit, keyed by unit; nil when none is set
+func (t *Table) Prices(model string) map[string]float64 {
+	var prices map[string]float64
+	for _, unit := range []string{UnitPromptToken, UnitCompletionToken, UnitImage, UnitAudioSecond, UnitCharacter, UnitTrainedToken} {
+		if price := t.price(model, unit); price != 0 {
+			if prices == nil {
+				prices = make(map[string]float64)
+			}
+			prices[unit] = price
+		}
+	}
+	return prices
+}
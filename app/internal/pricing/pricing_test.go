@@ -0,0 +1,53 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestTable_Cost(t *testing.T) {
+	table := NewTable(map[string]float64{
+		"gpt-4o/prompt_token":     0.0000025,
+		"gpt-4o/completion_token": 0.00001,
+		"dall-e-3/image":          0.04,
+		"image":                   0.02,
+		"whisper-1/audio_second":  0.0001,
+		"tts-1/character":         0.000015,
+		"trained_token":           0.000003,
+	})
+
+	tests := []struct {
+		name  string
+		model string
+		usage entities.TokenUsage
+		want  float64
+	}{
+		{"tokens", "gpt-4o", entities.TokenUsage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}, 0.0035},
+		{"images of a priced model", "dall-e-3", entities.TokenUsage{Images: 2}, 0.08},
+		{"images of another model", "dall-e-2", entities.TokenUsage{Images: 2}, 0.04},
+		{"audio seconds", "whisper-1", entities.TokenUsage{AudioSeconds: 90}, 0.009},
+		{"characters", "tts-1", entities.TokenUsage{Characters: 1000}, 0.015},
+		{"trained tokens", "gpt-4o-mini-2024-07-18", entities.TokenUsage{TrainedTokens: 10000}, 0.03},
+		{"unpriced model", "gpt-3.5-turbo", entities.TokenUsage{PromptTokens: 1000, TotalTokens: 1000}, 0},
+	}
+	for _, tt := range tests {
+		if got := table.Cost(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTable_Prices(t *testing.T) {
+	table := NewTable(map[string]float64{"gpt-4o/prompt_token": 2.5e-6, "prompt_token": 1e-6, "image": 0.04})
+	if got := table.Prices("gpt-4o"); len(got) != 2 || got[UnitPromptToken] != 2.5e-6 || got[UnitImage] != 0.04 {
+		t.Errorf("Prices(gpt-4o) = %v", got)
+	}
+	if got := table.Prices("other"); got[UnitPromptToken] != 1e-6 {
+		t.Errorf("Prices(other) = %v, want the unit default", got)
+	}
+	if got := NewTable(nil).Prices("gpt-4o"); got != nil {
+		t.Errorf("Prices() without prices = %v, want nil", got)
+	}
+}
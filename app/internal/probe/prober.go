@@ -0,0 +1,197 @@
+// Package probe checks in the background that the upstreams answer, so
+// their state can be reported and unreachable ones avoided
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Metrics of the prober
+const (
+	// ProbesMetric counts the probes sent
+	ProbesMetric = "upstream_probes_total"
+	// ProbeFailuresMetric counts the probes that failed or got a 5xx response
+	ProbeFailuresMetric = "upstream_probe_failures_total"
+)
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// Prober periodically sends a cheap request, such as GET /v1/models, to each
+// upstream and keeps their reachability and latency. An upstream is
+// unreachable after failures consecutive probes fail or get a 5xx response;
+// any other status, 401 and 429 included, shows it is up.
+type Prober struct {
+	targets  []entities.UpstreamTarget
+	path     string
+	interval time.Duration
+	timeout  time.Duration
+	failures int
+	metrics  Counter
+	// apiKey is the primary key, replaced when it is rotated
+	apiKey atomic.Pointer[string]
+
+	mu     sync.RWMutex
+	health []entities.UpstreamHealth
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewProber creates a new Prober of the targets. The primary key is sent to
+// targets without a key of their own.
+func NewProber(targets []entities.UpstreamTarget, apiKey, path string, interval, timeout time.Duration, failures int, metrics Counter) *Prober {
+	p := &Prober{
+		targets:  targets,
+		path:     path,
+		interval: interval,
+		timeout:  timeout,
+		failures: max(failures, 1),
+		metrics:  metrics,
+		health:   make([]entities.UpstreamHealth, len(targets)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	p.apiKey.Store(&apiKey)
+	for i, target := range targets {
+		p.health[i] = entities.UpstreamHealth{Name: target.Name, BaseURL: target.BaseURL, Reachable: true}
+	}
+	return p
+}
+
+// SetAPIKey replaces the primary key, e.g. after it was rotated
+func (p *Prober) SetAPIKey(key string) {
+	p.apiKey.Store(&key)
+}
+
+// Start probes the upstreams right away, then every interval until Close is called
+func (p *Prober) Start() {
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.Check()
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Check probes every upstream once, concurrently
+func (p *Prober) Check() {
+	var wg sync.WaitGroup
+	for i := range p.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.probe(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe sends one request to the i-th target and records the outcome
+func (p *Prober) probe(i int) {
+	target := p.targets[i]
+	p.metrics.Inc(ProbesMetric)
+	start := time.Now()
+	status, err := p.send(target)
+	latency := time.Since(start)
+	if err == nil && status >= 500 {
+		err = fmt.Errorf("status %d", status)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	health := &p.health[i]
+	health.LastChecked = start
+	if status != 0 {
+		health.StatusCode = status
+		health.LatencyMs = latency.Milliseconds()
+	}
+	if err == nil {
+		if !health.Reachable {
+			log.Printf("Upstream %s (%s) is reachable again", target.Name, target.BaseURL)
+		}
+		health.Reachable = true
+		health.ConsecutiveFailures = 0
+		health.LastError = ""
+		return
+	}
+	p.metrics.Inc(ProbeFailuresMetric)
+	health.ConsecutiveFailures++
+	health.LastError = err.Error()
+	if health.Reachable && health.ConsecutiveFailures >= p.failures {
+		log.Printf("Upstream %s (%s) is unreachable after %d failed probes: %v", target.Name, target.BaseURL, health.ConsecutiveFailures, err)
+		health.Reachable = false
+	}
+}
+
+// send sends the probe request and returns the response status
+func (p *Prober) send(target entities.UpstreamTarget) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.BaseURL+p.path, nil)
+	if err != nil {
+		return 0, err
+	}
+	apiKey := target.APIKey
+	if apiKey == "" {
+		apiKey = *p.apiKey.Load()
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	client := target.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// Statuses returns the state of every upstream, in the order of the targets
+func (p *Prober) Statuses() []entities.UpstreamHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]entities.UpstreamHealth(nil), p.health...)
+}
+
+// Reachable reports whether the upstream at baseURL answers its probes.
+// Upstreams that are not probed are assumed reachable.
+func (p *Prober) Reachable(baseURL string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, health := range p.health {
+		if health.BaseURL == baseURL && !health.Reachable {
+			return false
+		}
+	}
+	return true
+}
+
+// Close stops probing
+func (p *Prober) Close() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
@@ -0,0 +1,91 @@
+package probe_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/probe"
+)
+
+func TestProber(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var auth atomic.Value
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/models" {
+			t.Errorf("probe %s %s", r.Method, r.URL.Path)
+		}
+		auth.Store(r.Header.Get("Authorization"))
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer primary.Close()
+	hedge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hedge-key" {
+			t.Errorf("hedge probed with %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer hedge.Close()
+
+	m := metrics.NewMetrics()
+	p := probe.NewProber([]entities.UpstreamTarget{
+		{Name: "primary", BaseURL: primary.URL},
+		{Name: "hedge", BaseURL: hedge.URL, APIKey: "hedge-key"},
+	}, "old-key", "/v1/models", time.Hour, time.Second, 2, m)
+	p.SetAPIKey("new-key")
+
+	p.Check()
+	statuses := p.Statuses()
+	if len(statuses) != 2 || !statuses[0].Reachable || statuses[0].StatusCode != http.StatusOK || statuses[0].LastChecked.IsZero() {
+		t.Errorf("Statuses() = %+v", statuses)
+	}
+	// A rate-limited upstream is up
+	if !statuses[1].Reachable || statuses[1].StatusCode != http.StatusTooManyRequests {
+		t.Errorf("hedge status = %+v, want reachable", statuses[1])
+	}
+	if got := auth.Load(); got != "Bearer new-key" {
+		t.Errorf("primary probed with %q, want the rotated key", got)
+	}
+
+	// Unreachable only after two consecutive failures
+	status.Store(http.StatusBadGateway)
+	p.Check()
+	if !p.Reachable(primary.URL) {
+		t.Error("Reachable() = false after one failure")
+	}
+	p.Check()
+	if p.Reachable(primary.URL) || !p.Reachable(hedge.URL) || !p.Reachable("http://not-probed") {
+		t.Errorf("after two failures: %+v", p.Statuses())
+	}
+	if health := p.Statuses()[0]; health.ConsecutiveFailures != 2 || health.LastError != "status 502" {
+		t.Errorf("primary status = %+v", health)
+	}
+
+	status.Store(http.StatusOK)
+	p.Check()
+	if !p.Reachable(primary.URL) || p.Statuses()[0].ConsecutiveFailures != 0 {
+		t.Errorf("after recovery: %+v", p.Statuses()[0])
+	}
+
+	counters := m.Snapshot()
+	if counters[probe.ProbesMetric] != 8 || counters[probe.ProbeFailuresMetric] != 2 {
+		t.Errorf("metrics = %v, want 8 probes and 2 failures", counters)
+	}
+}
+
+func TestProber_ConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	p := probe.NewProber([]entities.UpstreamTarget{{Name: "primary", BaseURL: url}}, "key", "/v1/models", time.Hour, time.Second, 1, metrics.NewMetrics())
+	p.Check()
+	if health := p.Statuses()[0]; health.Reachable || health.LastError == "" || health.StatusCode != 0 {
+		t.Errorf("status of a closed upstream = %+v", health)
+	}
+}
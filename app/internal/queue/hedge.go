@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Hedging metrics
+const (
+	// HedgeableRequestsMetric counts requests eligible for hedging
+	HedgeableRequestsMetric = "hedgeable_requests_total"
+	// HedgesMetric counts duplicate requests issued after the hedge threshold
+	HedgesMetric = "hedged_requests_total"
+	// HedgeWinsMetric counts hedges that answered before the original request
+	HedgeWinsMetric = "hedge_wins_total"
+)
+
+// UpstreamHealth reports whether an upstream answers
+type UpstreamHealth interface {
+	Reachable(baseURL string) bool
+}
+
+type hedgeResult struct {
+	resp  entities.ProxyResponse
+	hedge bool
+}
+
+// hedgeable reports whether the request may be duplicated. Streamed bodies
+// cannot be replayed, and only allow-listed paths are hedged since a
+// duplicate is not harmless on every endpoint. Requests are not hedged out
+// of their residency region.
+func (q *Queue) hedgeable(p entities.ProxyRequest) bool {
+	if q.hedge.After <= 0 || p.BodyStream != nil || !entities.RegionSatisfies(q.hedge.Region, p.Residency) {
+		return false
+	}
+	for _, prefix := range q.hedge.Paths {
+		if strings.HasPrefix(p.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendHedged sends the request and, if no response arrives within the hedge
+// threshold, a duplicate to the hedge target. The first successful response
+// wins and the other request is cancelled.
+func (q *Queue) sendHedged(p entities.ProxyRequest) entities.ProxyResponse {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancelling the losing request would also cut off a streamed winner
+	p.StreamResponseAbove = 0
+
+	results := make(chan hedgeResult, 2)
+	go func() {
+		results <- hedgeResult{resp: q.send(ctx, q.baseURL, q.apiKey(p), p)}
+	}()
+	q.inc(HedgeableRequestsMetric)
+
+	timer := time.NewTimer(q.hedge.After)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return result.resp
+	case <-timer.C:
+	}
+
+	baseURL, apiKey := q.hedge.BaseURL, q.hedge.APIKey
+	if baseURL == "" {
+		baseURL = q.baseURL
+	}
+	if apiKey == "" {
+		apiKey = q.apiKey(p)
+	}
+	if q.upstreams != nil && !q.upstreams.Reachable(baseURL) {
+		log.Printf("Not hedging %s %s: %s is unreachable", p.Method, p.Path, baseURL)
+		return (<-results).resp
+	}
+	if !q.retries.Retry() {
+		return (<-results).resp
+	}
+	log.Printf("No response for %s %s after %v, sending hedge to %s", p.Method, p.Path, q.hedge.After, baseURL)
+	go func() {
+		results <- hedgeResult{resp: q.send(ctx, baseURL, apiKey, p), hedge: true}
+	}()
+	q.inc(HedgesMetric)
+
+	first := <-results
+	if first.resp.Err != nil {
+		// Fall back to the other request if the first one to finish failed
+		if second := <-results; second.resp.Err == nil {
+			first = second
+		}
+	}
+	if first.hedge {
+		q.inc(HedgeWinsMetric)
+	}
+	return first.resp
+}
+
+// inc increments a metric if metrics are configured
+func (q *Queue) inc(name string) {
+	if q.metrics != nil {
+		q.metrics.Inc(name)
+	}
+}
@@ -0,0 +1,173 @@
+package queue_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
+)
+
+func TestQueue_Hedging(t *testing.T) {
+	primaryCancelled := make(chan struct{}, 1)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/chat/completions/slow" {
+			// The server only notices a closed connection once the body is consumed
+			io.ReadAll(r.Body)
+			select {
+			case <-r.Context().Done():
+				primaryCancelled <- struct{}{}
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	hedgeTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hedge"))
+	}))
+	defer hedgeTarget.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantBody   string
+		wantHedges int64
+		wantWins   int64
+	}{
+		{"fast primary is not hedged", "/v1/chat/completions", "primary", 0, 0},
+		{"slow primary loses to hedge", "/v1/chat/completions/slow", "hedge", 1, 1},
+		{"path not eligible", "/v1/files", "primary", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := metrics.NewMetrics()
+			q := queue.NewNamedQueue(entities.QueueConfig{
+				Name:              "default",
+				RequestsPerMinute: 6000,
+				Hedge: entities.HedgeConfig{
+					After:   100 * time.Millisecond,
+					BaseURL: hedgeTarget.URL,
+					Paths:   []string{"/v1/chat/completions"},
+				},
+			}, primary.URL, "test-key", 0, nil, m)
+			defer q.Close()
+
+			resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: tt.path, Body: []byte(`{}`)})
+
+			if string(resp.Body) != tt.wantBody {
+				t.Errorf("Expected response from %s, got %q", tt.wantBody, resp.Body)
+			}
+			snapshot := m.Snapshot()
+			if snapshot[queue.HedgesMetric] != tt.wantHedges || snapshot[queue.HedgeWinsMetric] != tt.wantWins {
+				t.Errorf("Expected %d hedges and %d wins, got %v", tt.wantHedges, tt.wantWins, snapshot)
+			}
+		})
+	}
+
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the losing primary request to be cancelled")
+	}
+}
+
+func TestQueue_HedgingWithoutRetryBudget(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	hedgeTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hedge"))
+	}))
+	defer hedgeTarget.Close()
+
+	m := metrics.NewMetrics()
+	q := queue.NewNamedQueue(entities.QueueConfig{
+		Name:              "default",
+		RequestsPerMinute: 6000,
+		Hedge:             entities.HedgeConfig{After: 50 * time.Millisecond, BaseURL: hedgeTarget.URL, Paths: []string{"/v1/chat/completions"}},
+	}, primary.URL, "test-key", 0, nil, m)
+	defer q.Close()
+	q.SetRetryBudget(queue.NewRetryBudget(0, 0, m))
+
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{}`)})
+	if string(resp.Body) != "primary" {
+		t.Errorf("Expected the primary response, got %q", resp.Body)
+	}
+	snapshot := m.Snapshot()
+	if snapshot[queue.HedgesMetric] != 0 || snapshot[queue.RetriesExhaustedMetric] != 1 {
+		t.Errorf("Expected the hedge to be skipped, got %v", snapshot)
+	}
+	if stats := q.Stats().RetryBudget; stats == nil || !stats.Exhausted || stats.Requests != 1 {
+		t.Errorf("Stats().RetryBudget = %+v", stats)
+	}
+}
+
+type unreachable string
+
+func (u unreachable) Reachable(baseURL string) bool { return baseURL != string(u) }
+
+func TestQueue_HedgingSkipsUnreachableTarget(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	hedgeTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no hedge to an unreachable target")
+	}))
+	defer hedgeTarget.Close()
+
+	m := metrics.NewMetrics()
+	q := queue.NewNamedQueue(entities.QueueConfig{
+		Name:              "default",
+		RequestsPerMinute: 6000,
+		Hedge:             entities.HedgeConfig{After: 50 * time.Millisecond, BaseURL: hedgeTarget.URL, Paths: []string{"/v1/chat/completions"}},
+	}, primary.URL, "test-key", 0, nil, m)
+	defer q.Close()
+	q.SetUpstreamHealth(unreachable(hedgeTarget.URL))
+
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{}`)})
+	if string(resp.Body) != "primary" || m.Snapshot()[queue.HedgesMetric] != 0 {
+		t.Errorf("Expected the primary response without a hedge, got %q and %v", resp.Body, m.Snapshot())
+	}
+}
+
+func TestQueue_HedgingWithinResidency(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	hedgeTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hedge"))
+	}))
+	defer hedgeTarget.Close()
+
+	q := queue.NewNamedQueue(entities.QueueConfig{
+		Name:              "default",
+		RequestsPerMinute: 6000,
+		Hedge: entities.HedgeConfig{
+			After:   50 * time.Millisecond,
+			BaseURL: hedgeTarget.URL,
+			Paths:   []string{"/v1/chat/completions"},
+			Region:  "us-east-1",
+		},
+	}, primary.URL, "test-key", 0, nil, nil)
+	defer q.Close()
+
+	for residency, want := range map[string]string{"": "hedge", "us": "hedge", "eu": "primary"} {
+		resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(`{}`), Residency: residency})
+		if string(resp.Body) != want {
+			t.Errorf("response with residency %q from %q, want %s", residency, resp.Body, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// StatsSource reports the state of a queue
+type StatsSource interface {
+	Stats() entities.QueueStats
+}
+
+// minuteAccumulator collects what a queue did during the current minute
+type minuteAccumulator struct {
+	maxDepth  int
+	completed int
+	errors    int
+	waits     []int64
+}
+
+// History keeps per-minute statistics of the queues for the last minutes, so
+// recent behavior can be inspected without external monitoring. Depths are
+// sampled every interval; waits and errors are recorded by the queues
+// wrapped with Observe.
+type History struct {
+	queues   map[string]StatsSource
+	size     int
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	start   time.Time
+	current map[string]*minuteAccumulator
+	// minutes is a ring of the completed minutes, next the slot to overwrite
+	minutes [][]entities.QueueMinute
+	next    int
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewHistory creates a History of the queues, keyed by name, keeping the given
+// number of minutes and sampling depths every interval
+func NewHistory(queues map[string]StatsSource, minutes int, interval time.Duration) *History {
+	h := &History{
+		queues:   queues,
+		size:     minutes,
+		interval: interval,
+		now:      time.Now,
+		current:  make(map[string]*minuteAccumulator, len(queues)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for name := range queues {
+		h.current[name] = &minuteAccumulator{}
+	}
+	h.start = h.now().Truncate(time.Minute)
+	return h
+}
+
+// Start samples the queues in the background until Close is called
+func (h *History) Start() {
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+				h.Sample()
+			}
+		}
+	}()
+}
+
+// Sample records the depth of every queue, first completing the previous
+// minute once a new one has begun
+func (h *History) Sample() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if minute := h.now().Truncate(time.Minute); minute.After(h.start) {
+		h.rotate(minute)
+	}
+	for name, q := range h.queues {
+		acc := h.current[name]
+		acc.maxDepth = max(acc.maxDepth, q.Stats().Depth)
+	}
+}
+
+// rotate stores the current minute in the ring and begins the one starting
+// at minute. Callers must hold h.mu.
+func (h *History) rotate(minute time.Time) {
+	completed := make([]entities.QueueMinute, 0, len(h.queues))
+	for name, q := range h.queues {
+		stats := q.Stats()
+		acc := h.current[name]
+		completed = append(completed, entities.QueueMinute{
+			Queue:      name,
+			Minute:     h.start,
+			Depth:      stats.Depth,
+			MaxDepth:   max(acc.maxDepth, stats.Depth),
+			Dispatched: stats.RequestsLastMinute,
+			Completed:  acc.completed,
+			Errors:     acc.errors,
+			QueueWait:  entities.NewLatencyPercentiles(acc.waits),
+		})
+		h.current[name] = &minuteAccumulator{}
+	}
+	slices.SortFunc(completed, func(a, b entities.QueueMinute) int {
+		return strings.Compare(a.Queue, b.Queue)
+	})
+	if len(h.minutes) < h.size {
+		h.minutes = append(h.minutes, completed)
+	} else {
+		h.minutes[h.next] = completed
+		h.next = (h.next + 1) % h.size
+	}
+	h.start = minute
+}
+
+// Minutes returns the completed minutes, oldest first, of the named queue or
+// of every queue when name is empty
+func (h *History) Minutes(name string) []entities.QueueMinute {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := []entities.QueueMinute{}
+	for i := range h.minutes {
+		for _, m := range h.minutes[(h.next+i)%len(h.minutes)] {
+			if name == "" || m.Queue == name {
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+// Observe wraps the named queue so that the waits and errors of its
+// responses are recorded
+func (h *History) Observe(name string, next Pusher) Pusher {
+	return &observedQueue{Pusher: next, name: name, history: h}
+}
+
+// record counts a response of the named queue towards the current minute
+func (h *History) record(name string, resp entities.ProxyResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	acc, ok := h.current[name]
+	if !ok {
+		return
+	}
+	acc.completed++
+	if resp.Err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		acc.errors++
+	}
+	acc.waits = append(acc.waits, resp.QueueWait.Milliseconds())
+}
+
+// Close stops sampling
+func (h *History) Close() {
+	h.once.Do(func() {
+		close(h.stop)
+	})
+}
+
+// observedQueue records the responses of a queue in the history
+type observedQueue struct {
+	Pusher
+	name    string
+	history *History
+}
+
+// Push forwards the request and records its response
+func (o *observedQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := o.Pusher.Push(r)
+	o.history.record(o.name, resp)
+	return resp
+}
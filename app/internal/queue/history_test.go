@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type fakeStats struct {
+	stats entities.QueueStats
+}
+
+func (f *fakeStats) Stats() entities.QueueStats { return f.stats }
+
+type fixedPusher entities.ProxyResponse
+
+func (f fixedPusher) Push(entities.ProxyRequest) entities.ProxyResponse {
+	return entities.ProxyResponse(f)
+}
+
+func TestHistory(t *testing.T) {
+	defaultQueue := &fakeStats{}
+	batch := &fakeStats{}
+	h := NewHistory(map[string]StatsSource{"default": defaultQueue, "batch": batch}, 2, time.Second)
+	now := time.Date(2026, 1, 1, 12, 0, 30, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	h.start = now.Truncate(time.Minute)
+
+	for _, wait := range []time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 20 * time.Millisecond} {
+		h.Observe("default", fixedPusher{StatusCode: http.StatusOK, QueueWait: wait}).Push(entities.ProxyRequest{})
+	}
+	h.Observe("default", fixedPusher{StatusCode: http.StatusServiceUnavailable}).Push(entities.ProxyRequest{})
+	h.Observe("batch", fixedPusher{Err: errors.New("connection refused")}).Push(entities.ProxyRequest{})
+	defaultQueue.stats.Depth = 7
+	h.Sample()
+	defaultQueue.stats = entities.QueueStats{Depth: 2, RequestsLastMinute: 4}
+
+	if minutes := h.Minutes(""); len(minutes) != 0 {
+		t.Fatalf("Minutes() before the minute ended = %+v", minutes)
+	}
+
+	now = now.Add(time.Minute)
+	h.Sample()
+	minutes := h.Minutes("default")
+	want := entities.QueueMinute{Queue: "default", Minute: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Depth: 2, MaxDepth: 7, Dispatched: 4, Completed: 4, Errors: 1,
+		QueueWait: entities.LatencyPercentiles{P50: 10, P90: 30, P95: 30, P99: 30, Max: 30}}
+	if len(minutes) != 1 || minutes[0] != want {
+		t.Errorf("Minutes(default) = %+v, want %+v", minutes, want)
+	}
+	if minutes := h.Minutes("batch"); len(minutes) != 1 || minutes[0].Completed != 1 || minutes[0].Errors != 1 {
+		t.Errorf("Minutes(batch) = %+v", minutes)
+	}
+
+	// Only the last two minutes are kept, oldest first
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Minute)
+		h.Sample()
+	}
+	minutes = h.Minutes("default")
+	if len(minutes) != 2 || !minutes[0].Minute.Equal(want.Minute.Add(time.Minute)) || !minutes[1].Minute.Equal(want.Minute.Add(2*time.Minute)) {
+		t.Errorf("Minutes(default) after four minutes = %+v", minutes)
+	}
+	if minutes[0].Completed != 0 || minutes[0].MaxDepth != 2 {
+		t.Errorf("an idle minute = %+v", minutes[0])
+	}
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"container/heap"
+	"encoding/json"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// queuedRequest is a request waiting in the queue
+type queuedRequest struct {
+	entities.ProxyRequest
+	// rank orders waiting requests under a priority policy; lower goes first
+	rank time.Time
+	// seq keeps requests of equal rank in the order they were pushed
+	seq uint64
+}
+
+// rank returns when a request counts as enqueued under the priority policy:
+// interactive requests are moved ahead by the policy's boost
+func (q *Queue) rank(r entities.ProxyRequest) time.Time {
+	if q.priority.Boost <= 0 || !q.interactive(r) {
+		return r.EnqueuedAt
+	}
+	return r.EnqueuedAt.Add(-q.priority.Boost)
+}
+
+// interactive reports whether a request is streamed or has a small prompt.
+// Uploads are never interactive.
+func (q *Queue) interactive(r entities.ProxyRequest) bool {
+	if r.BodyStream != nil {
+		return false
+	}
+	if len(r.Body) == 0 {
+		return true
+	}
+	var body struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(r.Body, &body); err == nil && body.Stream {
+		return true
+	}
+	return q.countTokens(r) <= q.priority.SmallPromptTokens
+}
+
+// schedule dispatches the queued requests by rank until the queue is closed
+// and drained. Requests are moved from the channel to a heap, which holds at
+// most as many as the channel so that Push still blocks on a full queue.
+func (q *Queue) schedule() {
+	var waiting requestHeap
+	open := true
+	for open || waiting.Len() > 0 {
+		if waiting.Len() == 0 {
+			req, ok := <-q.ch
+			if !ok {
+				return
+			}
+			heap.Push(&waiting, req)
+		}
+		open = q.takeQueued(&waiting)
+		req := heap.Pop(&waiting).(queuedRequest)
+		q.dispatch(req.ProxyRequest)
+		q.pending.Add(-1)
+	}
+}
+
+// takeQueued moves the requests waiting in the channel to the heap without
+// blocking. It reports false once the channel is closed.
+func (q *Queue) takeQueued(waiting *requestHeap) bool {
+	for waiting.Len() < cap(q.ch) {
+		select {
+		case req, ok := <-q.ch:
+			if !ok {
+				return false
+			}
+			heap.Push(waiting, req)
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+// requestHeap is a min-heap of queued requests by rank
+type requestHeap []queuedRequest
+
+func (h requestHeap) Len() int { return len(h) }
+
+func (h requestHeap) Less(i, j int) bool {
+	if !h[i].rank.Equal(h[j].rank) {
+		return h[i].rank.Before(h[j].rank)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h requestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *requestHeap) Push(x any) { *h = append(*h, x.(queuedRequest)) }
+
+func (h *requestHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
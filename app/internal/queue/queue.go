@@ -3,80 +3,418 @@ package queue
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httpheader"
 )
 
+type TokenCounter interface {
+	CountPromptTokens(requestBody []byte) int
+}
+
+// ExemptDispatchesMetric counts requests dispatched without waiting for the rate limits
+const ExemptDispatchesMetric = "queue_exempt_dispatches_total"
+
+// Counter records named events
+type Counter interface {
+	Inc(name string)
+}
+
 // Queue handles request queueing and rate limiting
 type Queue struct {
-	ch           chan entities.ProxyRequest
-	baseURL      string
-	openAIAPIKey string
-	closed       bool
-	mu           sync.Mutex
+	name    string
+	ch      chan queuedRequest
+	baseURL string
+	// openAIAPIKey is replaced at runtime by SetAPIKey when the key rotates
+	openAIAPIKey atomic.Pointer[string]
+	maxAge       time.Duration
+	// limits holds the queue's RPM, TPM and their schedule
+	limits  entities.QueueConfig
+	pending atomic.Int64
+	// workers limits concurrent upstream requests; nil means unlimited
+	workers chan struct{}
+	// tokens limits estimated prompt tokens per minute; nil means unlimited
+	tokens *tokenLimiter
+	// retries budgets hedges; nil means unlimited
+	retries *RetryBudget
+	// upstreams tells unreachable hedge targets; nil assumes all reachable
+	upstreams UpstreamHealth
+	// streams caps concurrent streams per model; nil means unlimited
+	streams *StreamLimiter
+	counter TokenCounter
+	hedge   entities.HedgeConfig
+	// priority ranks waiting requests; with no boost they are dispatched in order
+	priority entities.PriorityPolicy
+	// pushed numbers the requests pushed, to order those of equal rank
+	pushed  atomic.Uint64
+	metrics Counter
+	// client sends upstream requests; http.DefaultClient unless SetHTTPClient is called
+	client *http.Client
+	// done is closed when Close is called, to release Pushes blocked on a full
+	// queue. closed is set once no Push is sending, under mu, which Pushes
+	// hold for reading while they send, so ch is never closed mid-send.
+	done   chan struct{}
+	closed bool
+	mu     sync.RWMutex
+	once   sync.Once
+
+	// dispatched records the requests of the last minute for Stats
+	dispatched []dispatchRecord
+	statsMu    sync.Mutex
 }
 
-// NewQueue creates a new queue with injected config
-func NewQueue(limitPerMin int, baseURL string, openAIAPIKey string) *Queue {
+// NewQueue creates a new queue with injected config.
+// Requests waiting longer than maxAge are dropped; 0 disables the limit.
+func NewQueue(limitPerMin int, baseURL string, openAIAPIKey string, maxAge time.Duration) *Queue {
+	return NewNamedQueue(entities.QueueConfig{Name: "default", RequestsPerMinute: limitPerMin}, baseURL, openAIAPIKey, maxAge, nil, nil)
+}
+
+// NewNamedQueue creates a queue with its own request, token and concurrency limits.
+// The counter estimates prompt tokens for the TPM limit; when nil, a rough
+// estimate based on body size is used. Metrics is optional.
+func NewNamedQueue(cfg entities.QueueConfig, baseURL string, openAIAPIKey string, maxAge time.Duration, counter TokenCounter, metrics Counter) *Queue {
 	q := &Queue{
-		ch:           make(chan entities.ProxyRequest, 1000),
-		baseURL:      baseURL,
-		openAIAPIKey: openAIAPIKey,
-		closed:       false,
+		name:     cfg.Name,
+		ch:       make(chan queuedRequest, 1000),
+		baseURL:  baseURL,
+		maxAge:   maxAge,
+		counter:  counter,
+		hedge:    cfg.Hedge,
+		priority: cfg.Priority,
+		metrics:  metrics,
+		client:   http.DefaultClient,
+		done:     make(chan struct{}),
 	}
+	q.SetAPIKey(openAIAPIKey)
 
-	if limitPerMin <= 0 {
-		log.Printf("Warning: RateLimitPerMin is %d, which is invalid. Defaulting to 60.", limitPerMin)
-		limitPerMin = 60 // Default to a sensible value
+	if cfg.RequestsPerMinute <= 0 {
+		log.Printf("Warning: RateLimitPerMin is %d, which is invalid. Defaulting to 60.", cfg.RequestsPerMinute)
+		cfg.RequestsPerMinute = 60 // Default to a sensible value
+	}
+	q.limits = cfg
+	if cfg.Workers > 0 {
+		q.workers = make(chan struct{}, cfg.Workers)
+	}
+	limitsTokens := cfg.TokensPerMinute > 0
+	for _, window := range cfg.Schedule {
+		limitsTokens = limitsTokens || window.TokensPerMinute > 0
+	}
+	if limitsTokens {
+		q.tokens = newTokenLimiter(cfg.TokensPerMinute)
 	}
 
-	interval := time.Minute / time.Duration(limitPerMin)
 	go func() {
+		if q.priority.Boost > 0 {
+			q.schedule()
+			return
+		}
 		for req := range q.ch {
-			time.Sleep(interval)
-			go q.handle(req)
+			q.dispatch(req.ProxyRequest)
+			q.pending.Add(-1)
 		}
 	}()
 
 	return q
 }
 
-// Push adds a request to the queue and returns the response
+// SetAPIKey replaces the upstream API key used for requests dispatched from now on
+func (q *Queue) SetAPIKey(key string) {
+	q.openAIAPIKey.Store(&key)
+}
+
+// SetHTTPClient replaces the client used for upstream requests, e.g. one
+// presenting a client certificate. It must be called before requests are pushed.
+func (q *Queue) SetHTTPClient(client *http.Client) {
+	q.client = client
+}
+
+// SetStreamLimiter caps the concurrent streaming requests per model. It must
+// be called before requests are pushed.
+func (q *Queue) SetStreamLimiter(streams *StreamLimiter) {
+	q.streams = streams
+}
+
+// SetRetryBudget limits the hedges of the queue to a budget, usually shared
+// with the other queues. It must be called before requests are pushed.
+func (q *Queue) SetRetryBudget(retries *RetryBudget) {
+	q.retries = retries
+}
+
+// SetUpstreamHealth skips hedges to upstreams reported unreachable. It must
+// be called before requests are pushed.
+func (q *Queue) SetUpstreamHealth(upstreams UpstreamHealth) {
+	q.upstreams = upstreams
+}
+
+// Depth returns the number of requests waiting in the queue or being dispatched
+func (q *Queue) Depth() int {
+	return int(q.pending.Load())
+}
+
+// limitsAt returns the dispatch interval and TPM limit in effect at t
+func (q *Queue) limitsAt(t time.Time) (time.Duration, int) {
+	rpm, tpm := q.limits.LimitsAt(t)
+	return time.Minute / time.Duration(rpm), tpm
+}
+
+// apiKey returns the upstream API key for a request: its own key, such as a
+// tenant's, or the queue's current key
+func (q *Queue) apiKey(p entities.ProxyRequest) string {
+	if p.APIKey != "" {
+		return p.APIKey
+	}
+	return *q.openAIAPIKey.Load()
+}
+
+// dispatch waits for the queue's limits to allow the request, then sends it upstream
+func (q *Queue) dispatch(req entities.ProxyRequest) {
+	// Expired requests are dropped without consuming a rate limit slot
+	if q.expire(req) {
+		return
+	}
+	interval, tpm := q.limitsAt(time.Now())
+	time.Sleep(interval)
+	tokens := 0
+	if q.tokens != nil {
+		q.tokens.setRate(tpm)
+		if tpm > 0 {
+			tokens = q.countTokens(req)
+			q.tokens.wait(tokens)
+		}
+	}
+	q.acquire(req, tokens)
+}
+
+// acquire takes the stream slot of the request's model, if it has one, and
+// starts the request. A request whose model has no free slot waits for one on
+// the side.
+func (q *Queue) acquire(req entities.ProxyRequest, tokens int) {
+	slots := q.streams.slotsFor(req)
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			// The stream waits for its model on the side, so requests for
+			// other models behind it are not held up
+			q.inc(StreamWaitsMetric)
+			q.pending.Add(1)
+			go func() {
+				acquired := q.waitForSlot(req, slots)
+				q.pending.Add(-1)
+				if acquired {
+					q.start(req, tokens, slots)
+				}
+			}()
+			return
+		}
+	}
+	q.start(req, tokens, slots)
+}
+
+// waitForSlot waits for a stream slot of the request's model. It reports
+// false, having replied, if the request expires first.
+func (q *Queue) waitForSlot(req entities.ProxyRequest, slots chan struct{}) bool {
+	if req.Deadline.IsZero() {
+		slots <- struct{}{}
+		return true
+	}
+	timer := time.NewTimer(time.Until(req.Deadline))
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return !q.expire(req)
+	}
+}
+
+// start sends the request upstream once a worker is free. The stream slot
+// of its model, if any, is held until the response is done.
+func (q *Queue) start(req entities.ProxyRequest, tokens int, slots chan struct{}) {
+	freeSlot := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+	if q.workers != nil {
+		q.workers <- struct{}{}
+	}
+	if q.expire(req) {
+		q.release()
+		freeSlot()
+		return
+	}
+	q.recordDispatch(tokens)
+	q.retries.Request()
+	go func() {
+		defer q.release()
+		resp := q.handle(req)
+		if slots != nil && resp.BodyStream != nil {
+			resp.BodyStream = &slotBody{ReadCloser: resp.BodyStream, release: freeSlot}
+		} else {
+			freeSlot()
+		}
+		req.Reply <- resp
+	}()
+}
+
+// release frees the worker slot held by a dispatched request
+func (q *Queue) release() {
+	if q.workers != nil {
+		<-q.workers
+	}
+}
+
+// countTokens estimates the prompt tokens of a request for the TPM limit
+func (q *Queue) countTokens(req entities.ProxyRequest) int {
+	if q.counter != nil {
+		return q.counter.CountPromptTokens(req.Body)
+	}
+	return len(req.Body) / 4
+}
+
+// Push adds a request to the queue and returns the response. Once the queue
+// is closed, it returns entities.ErrQueueClosed instead.
 func (q *Queue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+		return entities.ProxyResponse{Err: entities.ErrQueueClosed}
+	}
+	if q.limits.Exempt.Exempts(r) {
+		q.mu.RUnlock()
+		return q.dispatchExempt(r)
+	}
+	r.Reply = make(chan entities.ProxyResponse, 1)
+	r.EnqueuedAt = time.Now()
+	q.limitAge(&r)
+	position := q.pending.Add(1)
+	if r.OnEnqueue != nil {
+		// Each request ahead, including this one, waits one interval before dispatch
+		interval, _ := q.limitsAt(time.Now())
+		r.OnEnqueue(entities.QueueEstimate{
+			Position:   int(position),
+			DispatchAt: time.Now().Add(time.Duration(position) * interval),
+		})
+	}
+	queued := queuedRequest{ProxyRequest: r, rank: q.rank(r), seq: q.pushed.Add(1)}
+	select {
+	case q.ch <- queued:
+	case <-q.done:
+		q.mu.RUnlock()
+		q.pending.Add(-1)
+		return entities.ProxyResponse{Err: entities.ErrQueueClosed}
+	}
+	q.mu.RUnlock()
+	return <-r.Reply
+}
+
+// limitAge caps the deadline of a request at the queue's maximum age
+func (q *Queue) limitAge(r *entities.ProxyRequest) {
+	if q.maxAge > 0 {
+		if deadline := time.Now().Add(q.maxAge); r.Deadline.IsZero() || deadline.Before(r.Deadline) {
+			r.Deadline = deadline
+		}
+	}
+}
+
+// dispatchExempt dispatches a request exempt from the rate limits without
+// waiting its turn in the queue or for the RPM and TPM limits. It still
+// waits for a worker and its model's stream slot, and expires at its
+// deadline. It counts towards the utilization of the limits in Stats, but
+// does not hold back the requests waiting in the queue.
+func (q *Queue) dispatchExempt(r entities.ProxyRequest) entities.ProxyResponse {
 	r.Reply = make(chan entities.ProxyResponse, 1)
-	q.ch <- r
+	r.EnqueuedAt = time.Now()
+	q.limitAge(&r)
+	tokens := 0
+	if q.tokens != nil {
+		tokens = q.countTokens(r)
+	}
+	q.inc(ExemptDispatchesMetric)
+	q.pending.Add(1)
+	if !q.expire(r) {
+		q.acquire(r, tokens)
+	}
+	q.pending.Add(-1)
 	return <-r.Reply
 }
 
-// Close gracefully shuts down the queue
+// Close gracefully shuts down the queue: requests pushed from now on are
+// rejected, while those already waiting are still dispatched. It is safe to
+// call concurrently with Push and more than once.
 func (q *Queue) Close() {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	if !q.closed {
-		close(q.ch)
+	q.once.Do(func() {
+		close(q.done)
+		q.mu.Lock()
+		defer q.mu.Unlock()
 		q.closed = true
+		close(q.ch)
+	})
+}
+
+// expire replies with 504 Gateway Timeout if the request is past its deadline
+func (q *Queue) expire(p entities.ProxyRequest) bool {
+	if p.Deadline.IsZero() || time.Now().Before(p.Deadline) {
+		return false
+	}
+	log.Printf("Dropping %s %s from queue %s: deadline passed %v ago", p.Method, p.Path, q.name, time.Since(p.Deadline).Round(time.Millisecond))
+	body, _ := json.Marshal(entities.NewErrorResponse(
+		"Request expired while waiting in the queue", "timeout_error", "queue_timeout"))
+	p.Reply <- entities.ProxyResponse{
+		StatusCode: http.StatusGatewayTimeout,
+		Headers:    http.Header{"Content-Type": []string{"application/json"}},
+		Body:       body,
+		QueueWait:  time.Since(p.EnqueuedAt),
+	}
+	return true
+}
+
+// handle sends the request upstream, hedging it when configured, and returns
+// the response with its timing
+func (q *Queue) handle(p entities.ProxyRequest) entities.ProxyResponse {
+	dispatchedAt := time.Now()
+	var resp entities.ProxyResponse
+	if q.hedgeable(p) {
+		resp = q.sendHedged(p)
+	} else {
+		resp = q.send(context.Background(), q.baseURL, q.apiKey(p), p)
 	}
+	resp.QueueWait = dispatchedAt.Sub(p.EnqueuedAt)
+	resp.UpstreamLatency = time.Since(dispatchedAt)
+	return resp
 }
 
-func (q *Queue) handle(p entities.ProxyRequest) {
-	ctx := context.Background()
-	targetURL := q.baseURL + p.Path
+// send performs a single upstream request
+func (q *Queue) send(ctx context.Context, baseURL, apiKey string, p entities.ProxyRequest) entities.ProxyResponse {
+	targetURL := baseURL + p.Path
 
 	log.Printf("Forwarding request to upstream URL: %s", targetURL)
 	log.Printf("Request method: %s", p.Method)
-	log.Printf("Request body length: %d bytes", len(p.Body))
 
-	req, err := http.NewRequestWithContext(ctx, p.Method, targetURL, bytes.NewReader(p.Body))
+	var body io.Reader = bytes.NewReader(p.Body)
+	if p.BodyStream != nil {
+		log.Printf("Request body: streamed (Content-Length: %d)", p.ContentLength)
+		body = p.BodyStream
+	} else {
+		log.Printf("Request body length: %d bytes", len(p.Body))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.Method, targetURL, body)
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
-		p.Reply <- entities.ProxyResponse{Err: err}
-		return
+		return entities.ProxyResponse{Err: err}
+	}
+	if p.BodyStream != nil {
+		req.ContentLength = p.ContentLength
 	}
 
 	// Initialize headers if nil
@@ -84,33 +422,41 @@ func (q *Queue) handle(p entities.ProxyRequest) {
 		p.Headers = make(http.Header)
 	}
 	req.Header = p.Headers.Clone()
-	req.Header.Set("Authorization", "Bearer "+q.openAIAPIKey)
+	httpheader.RemoveHopByHop(req.Header)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 
 	log.Printf("Making request to %s", targetURL)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := q.client.Do(req)
 	if err != nil {
 		log.Printf("Error making request: %v", err)
-		p.Reply <- entities.ProxyResponse{Err: err}
-		return
+		return entities.ProxyResponse{Err: err}
 	}
-	defer resp.Body.Close()
-
 	log.Printf("Received response with status: %d", resp.StatusCode)
 	log.Printf("Response headers: %v", resp.Header)
+	httpheader.RemoveHopByHop(resp.Header)
+
+	if p.StreamResponseAbove > 0 && (resp.ContentLength < 0 || resp.ContentLength > p.StreamResponseAbove) {
+		log.Printf("Streaming response body (Content-Length: %d)", resp.ContentLength)
+		return entities.ProxyResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header.Clone(),
+			BodyStream: resp.Body,
+		}
+	}
+	defer resp.Body.Close()
 
 	respBody, errRead := io.ReadAll(resp.Body)
 	if errRead != nil {
 		log.Printf("Error reading response body: %v", errRead)
-		p.Reply <- entities.ProxyResponse{
+		return entities.ProxyResponse{
 			StatusCode: http.StatusBadGateway, // Or resp.StatusCode if headers are still relevant
 			Headers:    resp.Header.Clone(),
 			Body:       nil,
 			Err:        fmt.Errorf("failed to read upstream response body: %w", errRead),
 		}
-		return
 	}
 
-	p.Reply <- entities.ProxyResponse{
+	return entities.ProxyResponse{
 		StatusCode: resp.StatusCode,
 		Headers:    resp.Header.Clone(),
 		Body:       respBody,
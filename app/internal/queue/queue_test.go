@@ -1,14 +1,20 @@
 package queue_test
 
 import (
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
 )
 
@@ -33,7 +39,7 @@ func TestQueue_PushAndHandle(t *testing.T) {
 	}))
 	defer mockUpstream.Close()
 
-	q := queue.NewQueue(60, mockUpstream.URL, "test-api-key") // 60 requests per minute
+	q := queue.NewQueue(60, mockUpstream.URL, "test-api-key", 0) // 60 requests per minute
 	defer q.Close()
 
 	proxyReq := entities.ProxyRequest{
@@ -81,6 +87,168 @@ func TestQueue_PushAndHandle(t *testing.T) {
 	// but req.Header = p.Headers.Clone() in queue.go should preserve it.
 }
 
+func TestQueue_StreamedBody(t *testing.T) {
+	var requestBody string
+	var contentLength int64
+
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyBytes, _ := io.ReadAll(r.Body)
+		requestBody = string(bodyBytes)
+		contentLength = r.ContentLength
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "test-api-key", 0)
+	defer q.Close()
+
+	payload := "streamed-multipart-payload"
+	resp := q.Push(entities.ProxyRequest{
+		Method:        http.MethodPost,
+		Path:          "/v1/files",
+		BodyStream:    strings.NewReader(payload),
+		ContentLength: int64(len(payload)),
+	})
+
+	if resp.Err != nil {
+		t.Fatalf("Push returned an error: %v", resp.Err)
+	}
+	if requestBody != payload {
+		t.Errorf("Expected streamed body %q, got %q", payload, requestBody)
+	}
+	if contentLength != int64(len(payload)) {
+		t.Errorf("Expected Content-Length %d, got %d", len(payload), contentLength)
+	}
+}
+
+func TestQueue_StreamedBodyTooLarge(t *testing.T) {
+	upstreamErr := make(chan error, 1)
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		upstreamErr <- err
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "test-api-key", 0)
+	defer q.Close()
+
+	// A chunked upload has no Content-Length, so the limit trips mid-stream
+	payload := strings.Repeat("x", 64<<10)
+	resp := q.Push(entities.ProxyRequest{
+		Method:        http.MethodPost,
+		Path:          "/v1/files",
+		BodyStream:    http.MaxBytesReader(httptest.NewRecorder(), io.NopCloser(strings.NewReader(payload)), 1024),
+		ContentLength: -1,
+	})
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(resp.Err, &maxBytesErr) {
+		t.Fatalf("Push() error = %v, want *http.MaxBytesError", resp.Err)
+	}
+	// The connection is dropped before the final chunk, so the upstream never
+	// sees a complete request
+	select {
+	case err := <-upstreamErr:
+		if err == nil {
+			t.Error("upstream read the truncated upload as a complete body")
+		}
+	case <-time.After(2 * time.Second):
+	}
+}
+
+func TestQueue_StreamsLargeResponses(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/small":
+			w.Write([]byte(`{"ok":true}`))
+		case "/v1/large":
+			w.Write([]byte(strings.Repeat("x", 64)))
+		case "/v1/chunked":
+			w.Write([]byte("part"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("part"))
+		}
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "test-api-key", 0)
+	defer q.Close()
+
+	tests := []struct {
+		path         string
+		streamAbove  int64
+		wantStreamed bool
+		wantBody     string
+	}{
+		{"/v1/small", 32, false, `{"ok":true}`},
+		{"/v1/large", 32, true, strings.Repeat("x", 64)},
+		{"/v1/large", 0, false, strings.Repeat("x", 64)},
+		{"/v1/chunked", 32, true, "partpart"},
+	}
+	for _, tt := range tests {
+		resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: tt.path, StreamResponseAbove: tt.streamAbove})
+		if resp.Err != nil {
+			t.Fatalf("Push(%s) returned an error: %v", tt.path, resp.Err)
+		}
+		if (resp.BodyStream != nil) != tt.wantStreamed {
+			t.Errorf("Push(%s) with threshold %d streamed = %v, want %v", tt.path, tt.streamAbove, resp.BodyStream != nil, tt.wantStreamed)
+		}
+		body := resp.Body
+		if resp.BodyStream != nil {
+			if len(resp.Body) != 0 {
+				t.Errorf("Push(%s) buffered %d bytes of a streamed body", tt.path, len(resp.Body))
+			}
+			body, _ = io.ReadAll(resp.BodyStream)
+			resp.BodyStream.Close()
+		}
+		if string(body) != tt.wantBody {
+			t.Errorf("Push(%s) body = %q, want %q", tt.path, body, tt.wantBody)
+		}
+	}
+}
+
+func TestQueue_SetAPIKey(t *testing.T) {
+	var authHeader string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "old-key", 0)
+	defer q.Close()
+
+	q.SetAPIKey("new-key")
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+	if resp.Err != nil {
+		t.Fatalf("Push returned an error: %v", resp.Err)
+	}
+	if authHeader != "Bearer new-key" {
+		t.Errorf("Authorization header = %q, want %q", authHeader, "Bearer new-key")
+	}
+}
+
+func TestQueue_RequestAPIKey(t *testing.T) {
+	var authHeader string
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "proxy-key", 0)
+	defer q.Close()
+
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models", APIKey: "tenant-key"})
+	if resp.Err != nil {
+		t.Fatalf("Push returned an error: %v", resp.Err)
+	}
+	if authHeader != "Bearer tenant-key" {
+		t.Errorf("Authorization header = %q, want %q", authHeader, "Bearer tenant-key")
+	}
+}
+
 func TestQueue_RateLimitingConcept(t *testing.T) {
 	// This test demonstrates sequential processing due to rate limiting,
 	// not precise timing of the rate limit itself.
@@ -97,7 +265,7 @@ func TestQueue_RateLimitingConcept(t *testing.T) {
 	defer mockUpstream.Close()
 
 	// High rate limit for test speed, but interval will still enforce some delay
-	q := queue.NewQueue(1200, mockUpstream.URL, "test-api-key") // 20 reqs/sec
+	q := queue.NewQueue(1200, mockUpstream.URL, "test-api-key", 0) // 20 reqs/sec
 	defer q.Close()
 
 	numRequests := 3
@@ -121,15 +289,502 @@ func TestNewQueue_InvalidRateLimit(t *testing.T) {
 	// This is hard to verify without inspecting internal state or observing behavior.
 	// The log "Warning: RateLimitPerMin is %d..." indicates it.
 	// For this test, we'll just ensure it doesn't panic.
-	q := queue.NewQueue(0, "http://localhost:1234", "test-key")
+	q := queue.NewQueue(0, "http://localhost:1234", "test-key", 0)
 	if q == nil {
 		t.Fatal("NewQueue returned nil for 0 rate limit")
 	}
 	q.Close()
 
-	q = queue.NewQueue(-10, "http://localhost:1234", "test-key")
+	q = queue.NewQueue(-10, "http://localhost:1234", "test-key", 0)
 	if q == nil {
 		t.Fatal("NewQueue returned nil for negative rate limit")
 	}
 	q.Close()
 }
+
+func TestQueue_Close(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(6000, mockUpstream.URL, "test-key", 0)
+	// A request waiting when the queue closes is still dispatched
+	enqueued := make(chan struct{})
+	waiting := make(chan entities.ProxyResponse, 1)
+	go func() {
+		waiting <- q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models", OnEnqueue: func(entities.QueueEstimate) {
+			close(enqueued)
+		}})
+	}()
+	<-enqueued
+	q.Close()
+	q.Close()
+
+	if resp := <-waiting; resp.Err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("waiting request = %d, %v, want 200", resp.StatusCode, resp.Err)
+	}
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+	if !errors.Is(resp.Err, entities.ErrQueueClosed) {
+		t.Errorf("Push() after Close error = %v, want %v", resp.Err, entities.ErrQueueClosed)
+	}
+	if q.Depth() != 0 {
+		t.Errorf("Depth() = %d, want 0", q.Depth())
+	}
+
+	// A new queue serves requests after the old one closed
+	restarted := queue.NewQueue(6000, mockUpstream.URL, "test-key", 0)
+	defer restarted.Close()
+	if resp := restarted.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("restarted queue = %d, %v, want 200", resp.StatusCode, resp.Err)
+	}
+}
+
+func TestQueue_CloseDuringPushes(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(60000, mockUpstream.URL, "test-key", 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+			if resp.Err != nil && !errors.Is(resp.Err, entities.ErrQueueClosed) {
+				t.Errorf("Push() error = %v, want nil or %v", resp.Err, entities.ErrQueueClosed)
+			}
+		}()
+	}
+	q.Close()
+	// Every Push returns, either served or rejected, without panicking
+	wg.Wait()
+}
+
+func TestQueue_DropsExpiredRequests(t *testing.T) {
+	var upstreamCalls int
+	var mu sync.Mutex
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		upstreamCalls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		deadline time.Time
+	}{
+		{"deadline already passed", 0, time.Now().Add(-time.Second)},
+		{"max age exceeded while waiting", 50 * time.Millisecond, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := queue.NewQueue(120, mockUpstream.URL, "test-key", tt.maxAge) // 500ms between dispatches
+			defer q.Close()
+
+			resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/test", Deadline: tt.deadline})
+
+			if resp.StatusCode != http.StatusGatewayTimeout {
+				t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, resp.StatusCode)
+			}
+			if !strings.Contains(string(resp.Body), "queue_timeout") {
+				t.Errorf("Expected queue_timeout error body, got %s", resp.Body)
+			}
+		})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if upstreamCalls != 0 {
+		t.Errorf("Expected expired requests not to reach upstream, got %d calls", upstreamCalls)
+	}
+}
+
+func TestQueue_ReportsPosition(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(1200, mockUpstream.URL, "test-key", 0) // 50ms between dispatches
+	defer q.Close()
+
+	const requests = 3
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	positions := make(map[int]bool)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Push(entities.ProxyRequest{
+				Method: http.MethodPost,
+				Path:   "/v1/test",
+				OnEnqueue: func(estimate entities.QueueEstimate) {
+					mu.Lock()
+					positions[estimate.Position] = true
+					mu.Unlock()
+					wait := time.Until(estimate.DispatchAt)
+					if wait <= 0 || wait > time.Duration(estimate.Position)*50*time.Millisecond {
+						t.Errorf("Estimated wait %v out of range for position %d", wait, estimate.Position)
+					}
+				},
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i := 1; i <= requests; i++ {
+		if !positions[i] {
+			t.Errorf("Expected a request at position %d, got positions %v", i, positions)
+		}
+	}
+}
+
+func TestQueue_WorkerLimit(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewNamedQueue(entities.QueueConfig{Name: "batch", RequestsPerMinute: 6000, Workers: 1}, mockUpstream.URL, "test-key", 0, nil, nil)
+	defer q.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/test"}); resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 1 {
+		t.Errorf("Expected at most 1 concurrent upstream request, got %d", maxInFlight)
+	}
+}
+
+func TestQueue_StreamLimit(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		hits[string(body)]++
+		mu.Unlock()
+		w.Write([]byte("data: [DONE]"))
+	}))
+	defer mockUpstream.Close()
+
+	routes, err := queue.ParseRoutes([]string{"gpt-4o=default:1"})
+	if err != nil {
+		t.Fatalf("ParseRoutes() error = %v", err)
+	}
+	registry := metrics.NewMetrics()
+	q := queue.NewNamedQueue(entities.QueueConfig{Name: "default", RequestsPerMinute: 6000}, mockUpstream.URL, "test-key", 0, nil, registry)
+	q.SetStreamLimiter(queue.NewStreamLimiter(routes))
+	defer q.Close()
+	count := func(body string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[body]
+	}
+	push := func(body string) entities.ProxyResponse {
+		return q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(body), StreamResponseAbove: 1})
+	}
+
+	first := `{"model":"gpt-4o","stream":true}`
+	resp := push(first)
+	if resp.BodyStream == nil {
+		t.Fatal("expected a streamed response")
+	}
+
+	// The second stream waits until the first response is closed
+	second := make(chan entities.ProxyResponse, 1)
+	go func() { second <- push(`{"stream":true,"model":"gpt-4o"}`) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for registry.Snapshot()[queue.StreamWaitsMetric] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("second stream did not wait for a slot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Meanwhile, requests that are not capped streams are not held up
+	for _, body := range []string{`{"model":"gpt-4o"}`, `{"model":"gpt-4o-mini","stream":true}`} {
+		if other := push(body); other.Err != nil || other.StatusCode != http.StatusOK {
+			t.Fatalf("Push(%s) = %d, %v", body, other.StatusCode, other.Err)
+		} else if other.BodyStream != nil {
+			other.BodyStream.Close()
+		}
+	}
+	if n := count(`{"stream":true,"model":"gpt-4o"}`); n != 0 {
+		t.Fatalf("second stream sent while the first was open")
+	}
+	if depth := q.Depth(); depth != 1 {
+		t.Errorf("Depth() = %d while a stream waits, want 1", depth)
+	}
+
+	io.ReadAll(resp.BodyStream)
+	resp.BodyStream.Close()
+	select {
+	case resp := <-second:
+		if resp.Err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("second stream = %d, %v", resp.StatusCode, resp.Err)
+		}
+		resp.BodyStream.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second stream was not sent after the first was closed")
+	}
+	if waits := registry.Snapshot()[queue.StreamWaitsMetric]; waits != 1 {
+		t.Errorf("%s = %d, want 1", queue.StreamWaitsMetric, waits)
+	}
+}
+
+func TestQueue_ReportsTiming(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewQueue(600, mockUpstream.URL, "test-api-key", 0) // one request every 100ms
+	defer q.Close()
+
+	resp := q.Push(entities.ProxyRequest{Method: http.MethodGet, Path: "/v1/models"})
+
+	if resp.QueueWait < 90*time.Millisecond || resp.QueueWait > time.Second {
+		t.Errorf("QueueWait = %v, want about one rate limit interval", resp.QueueWait)
+	}
+	if resp.UpstreamLatency < 50*time.Millisecond || resp.UpstreamLatency > time.Second {
+		t.Errorf("UpstreamLatency = %v, want at least the upstream's delay", resp.UpstreamLatency)
+	}
+}
+
+func TestQueue_Stats(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	q := queue.NewNamedQueue(entities.QueueConfig{Name: "batch", RequestsPerMinute: 6000, TokensPerMinute: 1000, Workers: 2}, mockUpstream.URL, "test-key", 0, nil, nil)
+	defer q.Close()
+
+	for i := 0; i < 3; i++ {
+		// 400 bytes are estimated as 100 prompt tokens without a counter
+		if resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/test", Body: []byte(strings.Repeat("a", 400))}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	stats := q.Stats()
+	// Workers are released after the reply, so the last one may still be busy
+	if stats.BusyWorkers > 1 {
+		t.Errorf("Stats() busy workers = %d, want at most 1", stats.BusyWorkers)
+	}
+	stats.BusyWorkers = 0
+	want := entities.QueueStats{
+		Name:               "batch",
+		RequestsPerMinute:  6000,
+		RequestsLastMinute: 3,
+		TokensPerMinute:    1000,
+		TokensLastMinute:   300,
+		Workers:            2,
+		RequestUtilization: 0.0005,
+		TokenUtilization:   0.3,
+	}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestQueue_ScheduledLimits(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	// A window covering the whole week replaces the queue's 60 RPM
+	schedules, err := queue.ParseSchedules([]string{"batch@*/00:00-24:00=6000"}, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseSchedules() error = %v", err)
+	}
+	cfg := entities.QueueConfig{Name: "batch", RequestsPerMinute: 60, TokensPerMinute: 1000, Schedule: schedules["batch"]}
+	q := queue.NewNamedQueue(cfg, mockUpstream.URL, "test-key", 0, nil, nil)
+	defer q.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if resp := q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/test"}); resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("3 requests took %v, want the scheduled 10ms interval", elapsed)
+	}
+	if stats := q.Stats(); stats.RequestsPerMinute != 6000 || stats.TokensPerMinute != 1000 {
+		t.Errorf("Stats() = %d RPM, %d TPM, want 6000, 1000", stats.RequestsPerMinute, stats.TokensPerMinute)
+	}
+}
+
+func TestQueue_PriorityBoost(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	release := make(chan struct{})
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		order = append(order, string(body))
+		mu.Unlock()
+		if string(body) == "blocker" {
+			<-release
+		}
+	}))
+	defer mockUpstream.Close()
+
+	cfg := entities.QueueConfig{Name: "default", RequestsPerMinute: 6000, Workers: 1,
+		Priority: entities.PriorityPolicy{Boost: 200 * time.Millisecond, SmallPromptTokens: 10}}
+	q := queue.NewNamedQueue(cfg, mockUpstream.URL, "test-key", 0, nil, nil)
+	defer q.Close()
+
+	var wg sync.WaitGroup
+	push := func(body string) {
+		depth := q.Depth()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/v1/chat/completions", Body: []byte(body)})
+		}()
+		for q.Depth() == depth {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	large := `{"model":"gpt-4o","prompt":"` + strings.Repeat("word ", 100) + `"}`
+
+	// While the only worker is busy, the dispatcher holds the filler and the
+	// rest wait to be ranked
+	push("blocker")
+	push("filler")
+	push(large)
+	time.Sleep(300 * time.Millisecond) // the large prompt ages past the boost
+	push(`{"model":"gpt-4o","prompt":"` + strings.Repeat("old ", 100) + `"}`)
+	push(`{"model":"gpt-4o","stream":true}`)
+	push(`{"n":1}`)
+	close(release)
+	wg.Wait()
+
+	// The large prompt that waited longer than the boost is not overtaken
+	old := `{"model":"gpt-4o","prompt":"` + strings.Repeat("old ", 100) + `"}`
+	want := []string{"blocker", "filler", large, `{"model":"gpt-4o","stream":true}`, `{"n":1}`, old}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("dispatch order = %q, want %q", order, want)
+	}
+}
+
+func TestQueue_ExemptRequests(t *testing.T) {
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	registry := metrics.NewMetrics()
+	cfg := entities.QueueConfig{Name: "default", RequestsPerMinute: 1, TokensPerMinute: 1000, Exempt: entities.RateLimitExemptions{
+		Sessions:    []string{"acme/healthcheck"},
+		VirtualKeys: []string{"vk_probe"},
+	}}
+	q := queue.NewNamedQueue(cfg, mockUpstream.URL, "test-key", 0, nil, registry)
+	defer q.Close()
+
+	// At 1 RPM a request waiting for the limit would take a minute
+	start := time.Now()
+	for _, req := range []entities.ProxyRequest{
+		{SessionID: "acme/healthcheck", Method: http.MethodGet, Path: "/v1/models", Body: []byte(strings.Repeat("a", 400))},
+		{SessionID: "acme/healthcheck", Method: http.MethodGet, Path: "/v1/models"},
+		{VirtualKeyID: "vk_probe", Method: http.MethodGet, Path: "/v1/models"},
+	} {
+		if resp := q.Push(req); resp.StatusCode != http.StatusOK {
+			t.Fatalf("Push(%s) status = %d, want %d", req.SessionID+req.VirtualKeyID, resp.StatusCode, http.StatusOK)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("exempt requests took %v, want them dispatched immediately", elapsed)
+	}
+
+	stats := q.Stats()
+	if stats.RequestsLastMinute != 3 || stats.TokensLastMinute != 100 || stats.Depth != 0 {
+		t.Errorf("Stats() = %+v, want the exempt requests counted", stats)
+	}
+	if got := registry.Snapshot()[queue.ExemptDispatchesMetric]; got != 3 {
+		t.Errorf("%s = %d, want 3", queue.ExemptDispatchesMetric, got)
+	}
+
+	// Sessions of other tenants with the same ID wait for the limits
+	if (entities.RateLimitExemptions{Sessions: []string{"acme/healthcheck"}}).Exempts(entities.ProxyRequest{SessionID: "other/healthcheck"}) {
+		t.Error("a session of another tenant is exempt")
+	}
+}
+
+func TestQueue_ExemptRequestsWaitForWorkers(t *testing.T) {
+	release := make(chan struct{})
+	var inFlight, maxInFlight atomic.Int32
+	mockUpstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := inFlight.Add(1); n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		<-release
+		inFlight.Add(-1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockUpstream.Close()
+
+	cfg := entities.QueueConfig{Name: "default", RequestsPerMinute: 1, Workers: 1, Exempt: entities.RateLimitExemptions{
+		Sessions: []string{"healthcheck"},
+	}}
+	q := queue.NewNamedQueue(cfg, mockUpstream.URL, "test-key", 100*time.Millisecond, nil, nil)
+	defer q.Close()
+
+	responses := make(chan entities.ProxyResponse, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			responses <- q.Push(entities.ProxyRequest{SessionID: "healthcheck", Method: http.MethodGet, Path: "/v1/models"})
+		}()
+	}
+	// The second request waits for the only worker past its maximum age
+	time.Sleep(300 * time.Millisecond)
+	close(release)
+
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		statuses = append(statuses, (<-responses).StatusCode)
+	}
+	slices.Sort(statuses)
+	if want := []int{http.StatusOK, http.StatusGatewayTimeout}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if maxInFlight.Load() != 1 {
+		t.Errorf("%d exempt requests were in flight at once, want the worker limit of 1", maxInFlight.Load())
+	}
+}
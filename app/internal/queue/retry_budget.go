@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Metrics of the retry budget
+const (
+	// RetriesMetric counts the retries and hedges the budget allowed
+	RetriesMetric = "retry_budget_retries_total"
+	// RetriesExhaustedMetric counts the retries and hedges skipped because
+	// the budget was exhausted
+	RetriesExhaustedMetric = "retry_budget_exhausted_total"
+)
+
+// retryBuckets is how many slices of the stats window requests are counted in
+const retryBuckets = 12
+
+// retryBucket counts the requests and retries of a slice of the window
+type retryBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// RetryBudget limits the retries the proxy makes itself, such as hedges and
+// content filter fallbacks, to a share of the requests sent over the last
+// minute, so that an upstream outage does not turn into a retry storm. A
+// minimum number of retries per minute is always allowed so that quiet
+// periods do not disable retries. A nil budget allows every retry.
+type RetryBudget struct {
+	percent int
+	min     int
+	metrics Counter
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets [retryBuckets]retryBucket
+}
+
+// NewRetryBudget creates a budget allowing retries up to percent of the
+// requests of the last minute, and at least min retries per minute
+func NewRetryBudget(percent, min int, metrics Counter) *RetryBudget {
+	return &RetryBudget{
+		percent: percent,
+		min:     min,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+// Request counts a request sent upstream
+func (b *RetryBudget) Request() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket(b.now()).requests++
+}
+
+// Retry reports whether the budget allows a retry, and counts it if so
+func (b *RetryBudget) Retry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.available(now) <= 0 {
+		b.metrics.Inc(RetriesExhaustedMetric)
+		log.Printf("Retry budget of %d%% exhausted, failing fast", b.percent)
+		return false
+	}
+	b.bucket(now).retries++
+	b.metrics.Inc(RetriesMetric)
+	return true
+}
+
+// Stats returns the state of the budget
+func (b *RetryBudget) Stats() *entities.RetryBudgetStats {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	requests, retries := b.counts(now)
+	available := b.available(now)
+	return &entities.RetryBudgetStats{
+		Percent:   b.percent,
+		Requests:  requests,
+		Retries:   retries,
+		Available: max(available, 0),
+		Exhausted: available <= 0,
+	}
+}
+
+// available returns how many more retries are allowed at now. Callers must
+// hold b.mu.
+func (b *RetryBudget) available(now time.Time) int {
+	requests, retries := b.counts(now)
+	return max(requests*b.percent/100, b.min) - retries
+}
+
+// counts sums the requests and retries of the last minute. Callers must hold b.mu.
+func (b *RetryBudget) counts(now time.Time) (requests, retries int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < statsWindow {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return requests, retries
+}
+
+// bucket returns the bucket of now, reset if it last held an older slice.
+// Callers must hold b.mu.
+func (b *RetryBudget) bucket(now time.Time) *retryBucket {
+	width := statsWindow / retryBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[start.UnixNano()/int64(width)%retryBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = retryBucket{start: start}
+	}
+	return bucket
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+)
+
+func TestRetryBudget(t *testing.T) {
+	m := metrics.NewMetrics()
+	b := NewRetryBudget(20, 1, m)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	// The minimum is allowed before any request was sent
+	if !b.Retry() {
+		t.Fatal("Retry() = false, want the minimum allowed")
+	}
+	if b.Retry() {
+		t.Fatal("Retry() = true past the minimum")
+	}
+
+	// 20% of 10 requests allows two retries, one of which was used
+	for i := 0; i < 10; i++ {
+		b.Request()
+	}
+	if !b.Retry() || b.Retry() {
+		t.Error("want one more retry allowed by 10 requests")
+	}
+	stats := b.Stats()
+	if stats.Percent != 20 || stats.Requests != 10 || stats.Retries != 2 || stats.Available != 0 || !stats.Exhausted {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	// Retries and requests older than a minute no longer count
+	now = now.Add(statsWindow)
+	if stats := b.Stats(); stats.Requests != 0 || stats.Retries != 0 || stats.Available != 1 || stats.Exhausted {
+		t.Errorf("Stats() a minute later = %+v", stats)
+	}
+
+	counters := m.Snapshot()
+	if counters[RetriesMetric] != 2 || counters[RetriesExhaustedMetric] != 2 {
+		t.Errorf("metrics = %v, want 2 retries and 2 exhausted", counters)
+	}
+}
+
+func TestRetryBudget_Nil(t *testing.T) {
+	var b *RetryBudget
+	b.Request()
+	if !b.Retry() || b.Stats() != nil {
+		t.Error("a nil budget must allow every retry")
+	}
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Pusher interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Router sends each request to the named queue of the first matching route,
+// or to the default queue if no route matches.
+type Router struct {
+	defaultQueue Pusher
+	queues       map[string]Pusher
+	routes       []entities.QueueRoute
+	matchModels  bool
+}
+
+// NewRouter creates a new Router. Every route must reference a queue in queues.
+func NewRouter(defaultQueue Pusher, queues map[string]Pusher, routes []entities.QueueRoute) (*Router, error) {
+	r := &Router{
+		defaultQueue: defaultQueue,
+		queues:       queues,
+		routes:       routes,
+	}
+	for _, route := range routes {
+		if _, ok := queues[route.Queue]; !ok {
+			return nil, fmt.Errorf("queue route references unknown queue %q", route.Queue)
+		}
+		if route.Model != "" {
+			r.matchModels = true
+		}
+	}
+	return r, nil
+}
+
+// Push forwards the request to the queue it is routed to
+func (r *Router) Push(req entities.ProxyRequest) entities.ProxyResponse {
+	return r.queueFor(req).Push(req)
+}
+
+// queueFor returns the queue of the first route matching the request
+func (r *Router) queueFor(req entities.ProxyRequest) Pusher {
+	var model string
+	if r.matchModels && len(req.Body) > 0 {
+		model = entities.BodyModel(req.Body)
+	}
+
+	for _, route := range r.routes {
+		if route.PathPrefix != "" && strings.HasPrefix(req.Path, route.PathPrefix) {
+			return r.queues[route.Queue]
+		}
+		if route.Model != "" && model != "" && matchModel(route.Model, model) {
+			return r.queues[route.Queue]
+		}
+	}
+	return r.defaultQueue
+}
+
+// matchModel reports whether a model matches a pattern with an optional trailing "*"
+func matchModel(pattern, model string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(model, prefix)
+	}
+	return pattern == model
+}
@@ -0,0 +1,179 @@
+package queue_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
+)
+
+type namedPusher string
+
+func (p namedPusher) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(p)}
+}
+
+func TestRouter_Push(t *testing.T) {
+	routes, err := queue.ParseRoutes([]string{"/v1/embeddings=embeddings", "gpt-4o-mini=batch", "ft:gpt-4o*=batch"})
+	if err != nil {
+		t.Fatalf("ParseRoutes() error = %v", err)
+	}
+	router, err := queue.NewRouter(namedPusher("default"), map[string]queue.Pusher{
+		"embeddings": namedPusher("embeddings"),
+		"batch":      namedPusher("batch"),
+	}, routes)
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"path prefix", "/v1/embeddings", `{"model":"gpt-4o-mini"}`, "embeddings"},
+		{"exact model", "/v1/chat/completions", `{"model":"gpt-4o-mini"}`, "batch"},
+		{"model prefix", "/v1/chat/completions", `{"model":"ft:gpt-4o:org:custom"}`, "batch"},
+		{"unmatched model", "/v1/chat/completions", `{"model":"gpt-4o"}`, "default"},
+		{"no body", "/v1/models", ``, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := router.Push(entities.ProxyRequest{Method: http.MethodPost, Path: tt.path, Body: []byte(tt.body)})
+			if string(resp.Body) != tt.want {
+				t.Errorf("routed to %s, want %s", resp.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRouter_UnknownQueue(t *testing.T) {
+	_, err := queue.NewRouter(namedPusher("default"), map[string]queue.Pusher{},
+		[]entities.QueueRoute{{PathPrefix: "/v1/batches", Queue: "batch"}})
+	if err == nil {
+		t.Error("NewRouter() with unknown queue succeeded, want error")
+	}
+}
+
+func TestParseQueueConfigs(t *testing.T) {
+	got, err := queue.ParseQueueConfigs([]string{"chat:500:100000:8", "embeddings:3000", "batch:10::1"})
+	if err != nil {
+		t.Fatalf("ParseQueueConfigs() error = %v", err)
+	}
+	want := []entities.QueueConfig{
+		{Name: "chat", RequestsPerMinute: 500, TokensPerMinute: 100000, Workers: 8},
+		{Name: "embeddings", RequestsPerMinute: 3000},
+		{Name: "batch", RequestsPerMinute: 10, Workers: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseQueueConfigs() = %+v, want %+v", got, want)
+	}
+
+	for _, spec := range []string{"chat", "chat:0", "chat:abc", "chat:10:-1", ":10", "chat:1:2:3:4"} {
+		if _, err := queue.ParseQueueConfigs([]string{spec}); err == nil {
+			t.Errorf("ParseQueueConfigs(%q) succeeded, want error", spec)
+		}
+	}
+	if _, err := queue.ParseQueueConfigs([]string{"chat:10", "chat:20"}); err == nil {
+		t.Error("ParseQueueConfigs() with duplicate names succeeded, want error")
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	got, err := queue.ParseRoutes([]string{"/v1/batches=batch", "gpt-4o*=chat", "o1=chat:2"})
+	if err != nil {
+		t.Fatalf("ParseRoutes() error = %v", err)
+	}
+	want := []entities.QueueRoute{
+		{PathPrefix: "/v1/batches", Queue: "batch"},
+		{Model: "gpt-4o*", Queue: "chat"},
+		{Model: "o1", Queue: "chat", MaxStreams: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRoutes() = %+v, want %+v", got, want)
+	}
+
+	for _, spec := range []string{"batch", "=batch", "/v1/batches=", "o1=chat:0", "o1=chat:x", "o1=:2", "/v1/chat=chat:2"} {
+		if _, err := queue.ParseRoutes([]string{spec}); err == nil {
+			t.Errorf("ParseRoutes(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestParseSchedules(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	got, err := queue.ParseSchedules([]string{"chat@mon-fri/09:00-18:00=500:200000", "batch@fri-sun+wed/22:00-06:30=3000", "batch@*/00:00-24:00=100"}, loc)
+	if err != nil {
+		t.Fatalf("ParseSchedules() error = %v", err)
+	}
+	want := map[string][]entities.RateWindow{
+		"chat": {{Days: [7]bool{false, true, true, true, true, true, false}, Start: 9 * time.Hour, End: 18 * time.Hour,
+			Location: loc, RequestsPerMinute: 500, TokensPerMinute: 200000}},
+		"batch": {
+			{Days: [7]bool{true, false, false, true, false, true, true}, Start: 22 * time.Hour, End: 6*time.Hour + 30*time.Minute,
+				Location: loc, RequestsPerMinute: 3000},
+			{Days: [7]bool{true, true, true, true, true, true, true}, End: 24 * time.Hour, Location: loc, RequestsPerMinute: 100},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSchedules() = %+v, want %+v", got, want)
+	}
+
+	for _, spec := range []string{"chat=500", "@mon/09:00-18:00=5", "chat@mon/09:00-18:00", "chat@xyz/09:00-18:00=5",
+		"chat@mon/9-18=5", "chat@mon/09:00-25:00=5", "chat@mon/24:00-06:00=5", "chat@mon/09:00-18:00=0", "chat@mon/09:00-18:00=5:x"} {
+		if _, err := queue.ParseSchedules([]string{spec}, time.UTC); err == nil {
+			t.Errorf("ParseSchedules(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestQueueConfig_LimitsAt(t *testing.T) {
+	schedules, err := queue.ParseSchedules([]string{"chat@mon-fri/09:00-18:00=500", "chat@fri/22:00-06:00=2000:90000"}, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseSchedules() error = %v", err)
+	}
+	cfg := entities.QueueConfig{Name: "chat", RequestsPerMinute: 100, TokensPerMinute: 50000, Schedule: schedules["chat"]}
+
+	tests := []struct {
+		at       string
+		rpm, tpm int
+	}{
+		{"2024-06-03T09:00:00Z", 500, 50000},      // Monday, business hours keep the queue's TPM
+		{"2024-06-03T18:00:00Z", 100, 50000},      // Monday, after hours
+		{"2024-06-07T23:30:00Z", 2000, 90000},     // Friday night
+		{"2024-06-08T05:59:00Z", 2000, 90000},     // Saturday morning, in the window started on Friday
+		{"2024-06-08T06:00:00Z", 100, 50000},      // Saturday, after the night window
+		{"2024-06-08T23:00:00Z", 100, 50000},      // Saturday night, not in the Friday window
+		{"2024-06-03T07:00:00+02:00", 100, 50000}, // 05:00 UTC on a Monday
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		if rpm, tpm := cfg.LimitsAt(at); rpm != tt.rpm || tpm != tt.tpm {
+			t.Errorf("LimitsAt(%s) = %d RPM, %d TPM, want %d, %d", tt.at, rpm, tpm, tt.rpm, tt.tpm)
+		}
+	}
+}
+
+func TestEndpointQueues(t *testing.T) {
+	configs, routes := queue.EndpointQueues(map[string]int{
+		"/v1/images":             5,
+		"/v1/images/generations": 2,
+		"/v1/embeddings":         3000,
+	})
+
+	wantRoutes := []entities.QueueRoute{
+		{PathPrefix: "/v1/images/generations", Queue: "endpoint:/v1/images/generations"},
+		{PathPrefix: "/v1/embeddings", Queue: "endpoint:/v1/embeddings"},
+		{PathPrefix: "/v1/images", Queue: "endpoint:/v1/images"},
+	}
+	if !reflect.DeepEqual(routes, wantRoutes) {
+		t.Errorf("EndpointQueues() routes = %+v, want %+v", routes, wantRoutes)
+	}
+	if len(configs) != 3 || configs[0].Name != "endpoint:/v1/images/generations" || configs[0].RequestsPerMinute != 2 {
+		t.Errorf("EndpointQueues() configs = %+v, want one queue per endpoint, most specific first", configs)
+	}
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// SessionCapRejectionsMetric counts requests rejected because their session
+// had too many queued
+const SessionCapRejectionsMetric = "session_queue_rejections_total"
+
+// SessionCap wraps a queue and rejects the requests of a session that already
+// has max requests queued, so a runaway client loop cannot take over shared
+// capacity. A request counts as queued until its response is returned.
+// Requests without a session are not counted.
+type SessionCap struct {
+	next    Pusher
+	max     int
+	metrics Counter
+
+	mu     sync.Mutex
+	queued map[string]int
+}
+
+// NewSessionCap creates a new SessionCap in front of next
+func NewSessionCap(next Pusher, max int, metrics Counter) *SessionCap {
+	return &SessionCap{
+		next:    next,
+		max:     max,
+		metrics: metrics,
+		queued:  make(map[string]int),
+	}
+}
+
+// Push forwards the request unless its session has no room left, in which
+// case it fails with an *entities.SessionQueueFullError
+func (c *SessionCap) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.SessionID == "" {
+		return c.next.Push(r)
+	}
+	if queued, ok := c.enter(r.SessionID); !ok {
+		c.metrics.Inc(SessionCapRejectionsMetric)
+		return entities.ProxyResponse{Err: &entities.SessionQueueFullError{SessionID: r.SessionID, Queued: queued, Max: c.max}}
+	}
+	defer c.leave(r.SessionID)
+	return c.next.Push(r)
+}
+
+// enter counts a request of a session if it has room, and returns how many
+// the session had queued before
+func (c *SessionCap) enter(sessionID string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queued := c.queued[sessionID]
+	if queued >= c.max {
+		return queued, false
+	}
+	c.queued[sessionID] = queued + 1
+	return queued, true
+}
+
+// leave uncounts a request of a session, forgetting sessions with none left
+func (c *SessionCap) leave(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queued[sessionID]--; c.queued[sessionID] <= 0 {
+		delete(c.queued, sessionID)
+	}
+}
@@ -0,0 +1,73 @@
+package queue_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/queue"
+)
+
+// heldPusher answers requests once release is closed
+type heldPusher struct {
+	release chan struct{}
+	mu      sync.Mutex
+	pushed  int
+}
+
+func (p *heldPusher) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	p.mu.Lock()
+	p.pushed++
+	p.mu.Unlock()
+	<-p.release
+	return entities.ProxyResponse{StatusCode: http.StatusOK}
+}
+
+func (p *heldPusher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pushed
+}
+
+func TestSessionCap_Push(t *testing.T) {
+	next := &heldPusher{release: make(chan struct{})}
+	registry := metrics.NewMetrics()
+	sessionCap := queue.NewSessionCap(next, 2, registry)
+
+	var wg sync.WaitGroup
+	for _, sessionID := range []string{"s1", "s1", "s2", "", ""} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := sessionCap.Push(entities.ProxyRequest{SessionID: sessionID}); resp.Err != nil {
+				t.Errorf("Push for session %q: %v", sessionID, resp.Err)
+			}
+		}()
+	}
+	for next.count() < 5 {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp := sessionCap.Push(entities.ProxyRequest{SessionID: "s1"})
+	var fullErr *entities.SessionQueueFullError
+	if !errors.As(resp.Err, &fullErr) || !errors.Is(resp.Err, entities.ErrQueueFull) {
+		t.Fatalf("third request of s1: err = %v, want a SessionQueueFullError", resp.Err)
+	}
+	if fullErr.SessionID != "s1" || fullErr.Queued != 2 || fullErr.Max != 2 {
+		t.Errorf("error = %+v, want s1 with 2 of 2 queued", fullErr)
+	}
+	if registry.Snapshot()[queue.SessionCapRejectionsMetric] != 1 {
+		t.Errorf("metrics = %v, want 1 rejection", registry.Snapshot())
+	}
+
+	// Answered requests leave room for new ones
+	close(next.release)
+	wg.Wait()
+	if resp := sessionCap.Push(entities.ProxyRequest{SessionID: "s1"}); resp.Err != nil {
+		t.Errorf("Push after the queued requests were answered: %v", resp.Err)
+	}
+}
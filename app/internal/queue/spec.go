@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// ParseQueueConfigs parses queue definitions of the form name:rpm[:tpm[:workers]].
+// Omitted or empty TPM and worker values are unlimited.
+func ParseQueueConfigs(specs []string) ([]entities.QueueConfig, error) {
+	configs := make([]entities.QueueConfig, 0, len(specs))
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) < 2 || len(parts) > 4 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid queue %q: expected name:rpm[:tpm[:workers]]", spec)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("queue %q is defined twice", parts[0])
+		}
+		seen[parts[0]] = true
+
+		values := make([]int, 3)
+		for i, part := range parts[1:] {
+			if part == "" {
+				continue
+			}
+			value, err := strconv.Atoi(part)
+			if err != nil || value < 0 {
+				return nil, fmt.Errorf("invalid queue %q: limits must be non-negative integers", spec)
+			}
+			values[i] = value
+		}
+		if values[0] == 0 {
+			return nil, fmt.Errorf("invalid queue %q: rpm must be positive", spec)
+		}
+		configs = append(configs, entities.QueueConfig{
+			Name:              parts[0],
+			RequestsPerMinute: values[0],
+			TokensPerMinute:   values[1],
+			Workers:           values[2],
+		})
+	}
+	return configs, nil
+}
+
+// ParseRoutes parses routing rules of the form pattern=queue[:max_streams].
+// Patterns starting with "/" match path prefixes; anything else matches the
+// request's model, whose concurrent streams max_streams optionally caps.
+func ParseRoutes(specs []string) ([]entities.QueueRoute, error) {
+	routes := make([]entities.QueueRoute, 0, len(specs))
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, "=")
+		if idx <= 0 || idx == len(spec)-1 {
+			return nil, fmt.Errorf("invalid queue route %q: expected pattern=queue[:max_streams]", spec)
+		}
+		pattern, target := strings.TrimSpace(spec[:idx]), strings.TrimSpace(spec[idx+1:])
+		name, streams, limited := strings.Cut(target, ":")
+		route := entities.QueueRoute{Queue: name}
+		if limited {
+			maxStreams, err := strconv.Atoi(streams)
+			if err != nil || maxStreams <= 0 || name == "" {
+				return nil, fmt.Errorf("invalid queue route %q: max_streams must be a positive integer", spec)
+			}
+			route.MaxStreams = maxStreams
+		}
+		if strings.HasPrefix(pattern, "/") {
+			if limited {
+				return nil, fmt.Errorf("invalid queue route %q: max_streams only applies to model routes", spec)
+			}
+			route.PathPrefix = pattern
+		} else {
+			route.Model = pattern
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// weekdays maps the day names of schedules to weekdays
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedules parses rate-limit windows of the form
+// queue@days/HH:MM-HH:MM=rpm[:tpm], e.g. chat@mon-fri/09:00-18:00=500:200000,
+// and returns them by queue in order. Days are "*", a day such as "sat", a
+// range such as "mon-fri", or several of those joined by "+". Times are in loc.
+func ParseSchedules(specs []string, loc *time.Location) (map[string][]entities.RateWindow, error) {
+	schedules := make(map[string][]entities.RateWindow)
+	for _, spec := range specs {
+		invalid := func(reason string) error {
+			return fmt.Errorf("invalid queue schedule %q: %s", spec, reason)
+		}
+		name, rest, ok := strings.Cut(strings.TrimSpace(spec), "@")
+		when, limits, ok2 := strings.Cut(rest, "=")
+		days, hours, ok3 := strings.Cut(when, "/")
+		if !ok || !ok2 || !ok3 || name == "" {
+			return nil, invalid("expected queue@days/HH:MM-HH:MM=rpm[:tpm]")
+		}
+
+		window := entities.RateWindow{Location: loc}
+		if !parseDays(days, &window.Days) {
+			return nil, invalid(`days must be "*", names such as mon, ranges such as mon-fri, joined by "+"`)
+		}
+		start, end, ok := strings.Cut(hours, "-")
+		var err error
+		if window.Start, err = parseTimeOfDay(start); ok && err == nil {
+			window.End, err = parseTimeOfDay(end)
+		}
+		if !ok || err != nil || window.Start == 24*time.Hour {
+			return nil, invalid("hours must be HH:MM-HH:MM")
+		}
+
+		rpm, tpm, _ := strings.Cut(limits, ":")
+		if window.RequestsPerMinute, err = strconv.Atoi(rpm); err != nil || window.RequestsPerMinute <= 0 {
+			return nil, invalid("rpm must be a positive integer")
+		}
+		if tpm != "" {
+			if window.TokensPerMinute, err = strconv.Atoi(tpm); err != nil || window.TokensPerMinute <= 0 {
+				return nil, invalid("tpm must be a positive integer")
+			}
+		}
+		schedules[name] = append(schedules[name], window)
+	}
+	return schedules, nil
+}
+
+// parseDays sets the weekdays of a schedule's days field
+func parseDays(spec string, days *[7]bool) bool {
+	for _, part := range strings.Split(strings.ToLower(spec), "+") {
+		if part == "*" {
+			*days = [7]bool{true, true, true, true, true, true, true}
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		from, ok := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok || !ok2 {
+			return false
+		}
+		// Ranges may wrap around the week, e.g. fri-mon
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return true
+}
+
+// parseTimeOfDay parses HH:MM, from 00:00 to 24:00, as an offset from midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || !ok || len(minutes) != 2 {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// EndpointQueues turns per-endpoint rate limits keyed by path prefix into one
+// queue and route per endpoint. Longer prefixes are routed first so the most
+// specific limit applies.
+func EndpointQueues(limits map[string]int) ([]entities.QueueConfig, []entities.QueueRoute) {
+	prefixes := make([]string, 0, len(limits))
+	for prefix := range limits {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	configs := make([]entities.QueueConfig, 0, len(prefixes))
+	routes := make([]entities.QueueRoute, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		name := "endpoint:" + prefix
+		configs = append(configs, entities.QueueConfig{Name: name, RequestsPerMinute: limits[prefix]})
+		routes = append(routes, entities.QueueRoute{PathPrefix: prefix, Queue: name})
+	}
+	return configs, routes
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// statsWindow is the period over which rate-limit utilization is measured
+const statsWindow = time.Minute
+
+// dispatchRecord is a request that passed the queue's limits
+type dispatchRecord struct {
+	at     time.Time
+	tokens int
+}
+
+// recordDispatch counts a dispatched request and its estimated prompt tokens
+// towards the utilization of the queue's limits
+func (q *Queue) recordDispatch(tokens int) {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	now := time.Now()
+	q.dispatched = append(recentDispatches(q.dispatched, now), dispatchRecord{at: now, tokens: tokens})
+}
+
+// recentDispatches drops the records older than the stats window; records
+// are in dispatch order
+func recentDispatches(records []dispatchRecord, now time.Time) []dispatchRecord {
+	i := 0
+	for i < len(records) && now.Sub(records[i].at) >= statsWindow {
+		i++
+	}
+	return records[i:]
+}
+
+// Stats returns the queue's depth and the utilization of its limits over the
+// last minute
+func (q *Queue) Stats() entities.QueueStats {
+	rpm, tpm := q.limits.LimitsAt(time.Now())
+	stats := entities.QueueStats{
+		Name:              q.name,
+		Depth:             q.Depth(),
+		RequestsPerMinute: rpm,
+		TokensPerMinute:   tpm,
+		RetryBudget:       q.retries.Stats(),
+	}
+	if q.workers != nil {
+		stats.Workers = cap(q.workers)
+		stats.BusyWorkers = len(q.workers)
+	}
+
+	q.statsMu.Lock()
+	q.dispatched = recentDispatches(q.dispatched, time.Now())
+	stats.RequestsLastMinute = len(q.dispatched)
+	for _, record := range q.dispatched {
+		stats.TokensLastMinute += record.tokens
+	}
+	q.statsMu.Unlock()
+
+	stats.RequestUtilization = min(float64(stats.RequestsLastMinute)/float64(stats.RequestsPerMinute), 1)
+	if stats.TokensPerMinute > 0 {
+		stats.TokenUtilization = min(float64(stats.TokensLastMinute)/float64(stats.TokensPerMinute), 1)
+	}
+	return stats
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// StreamWaitsMetric counts streaming requests that waited for a slot of their model
+const StreamWaitsMetric = "stream_limit_waits_total"
+
+// StreamLimiter caps the concurrent streaming requests of each model, for
+// providers that limit streaming connections per model. The cap of a model
+// comes from the first model route matching it. One limiter is shared by all
+// queues, so a cap holds whichever queue the model's requests are routed to.
+type StreamLimiter struct {
+	routes []entities.QueueRoute
+
+	mu sync.Mutex
+	// slots holds a semaphore per capped model
+	slots map[string]chan struct{}
+}
+
+// NewStreamLimiter creates a limiter enforcing the MaxStreams of the model
+// routes. It returns nil, which caps nothing, when no route sets one.
+func NewStreamLimiter(routes []entities.QueueRoute) *StreamLimiter {
+	l := &StreamLimiter{slots: make(map[string]chan struct{})}
+	limited := false
+	for _, route := range routes {
+		if route.Model == "" {
+			continue
+		}
+		l.routes = append(l.routes, route)
+		limited = limited || route.MaxStreams > 0
+	}
+	if !limited {
+		return nil
+	}
+	return l
+}
+
+// slotsFor returns the semaphore of a streaming request's model, or nil when
+// the request is not a stream or its model is not capped
+func (l *StreamLimiter) slotsFor(req entities.ProxyRequest) chan struct{} {
+	if l == nil || req.BodyStream != nil || len(req.Body) == 0 {
+		return nil
+	}
+	var body struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(req.Body, &body); err != nil || !body.Stream || body.Model == "" {
+		return nil
+	}
+	for _, route := range l.routes {
+		if !matchModel(route.Model, body.Model) {
+			continue
+		}
+		if route.MaxStreams == 0 {
+			return nil
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		slots, ok := l.slots[body.Model]
+		if !ok {
+			slots = make(chan struct{}, route.MaxStreams)
+			l.slots[body.Model] = slots
+		}
+		return slots
+	}
+	return nil
+}
+
+// slotBody frees a stream slot once the streamed response body is closed,
+// since the upstream connection stays open until then
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
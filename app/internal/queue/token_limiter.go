@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"math"
+	"time"
+)
+
+// tokenLimiter is a token bucket refilled continuously at perMinute tokens per
+// minute; 0 lifts the limit. It is only used by the queue's dispatcher goroutine.
+type tokenLimiter struct {
+	perMinute float64
+	available float64
+	last      time.Time
+}
+
+func newTokenLimiter(perMinute int) *tokenLimiter {
+	return &tokenLimiter{
+		perMinute: float64(perMinute),
+		available: float64(perMinute),
+		last:      time.Now(),
+	}
+}
+
+// setRate changes the refill rate when a scheduled limit starts or ends.
+// Tokens saved at a higher rate are capped to the new budget, and a limit
+// taking effect starts with a full one.
+func (l *tokenLimiter) setRate(perMinute int) {
+	rate := float64(perMinute)
+	if rate == l.perMinute {
+		return
+	}
+	if l.perMinute == 0 {
+		l.available, l.last = rate, time.Now()
+	}
+	l.perMinute = rate
+	l.available = math.Min(l.available, rate)
+}
+
+// wait blocks until n tokens are available and consumes them. Requests larger
+// than the whole per-minute budget wait for a full bucket.
+func (l *tokenLimiter) wait(n int) {
+	if l.perMinute == 0 {
+		return
+	}
+	need := math.Min(float64(n), l.perMinute)
+	for {
+		now := time.Now()
+		l.available = math.Min(l.perMinute, l.available+now.Sub(l.last).Minutes()*l.perMinute)
+		l.last = now
+		if l.available >= need {
+			l.available -= need
+			return
+		}
+		time.Sleep(time.Duration((need - l.available) / l.perMinute * float64(time.Minute)))
+	}
+}
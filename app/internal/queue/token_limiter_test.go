@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenLimiter_Wait(t *testing.T) {
+	l := newTokenLimiter(6000) // 100 tokens per second
+
+	start := time.Now()
+	l.wait(6000)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("wait() on a full bucket took %v, want immediate", elapsed)
+	}
+
+	start = time.Now()
+	l.wait(30)
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > time.Second {
+		t.Errorf("wait(30) on an empty bucket took %v, want about 300ms", elapsed)
+	}
+}
+
+func TestTokenLimiter_SetRate(t *testing.T) {
+	l := newTokenLimiter(0)
+	l.wait(1_000_000)
+
+	// A limit taking effect starts with a full budget
+	l.setRate(6000)
+	start := time.Now()
+	l.wait(6000)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("wait() after the limit started took %v, want immediate", elapsed)
+	}
+
+	// Lowering the limit caps the saved tokens
+	l.setRate(12000)
+	l.available = 12000
+	l.setRate(600)
+	if l.available != 600 {
+		t.Errorf("available = %v after lowering the rate, want 600", l.available)
+	}
+}
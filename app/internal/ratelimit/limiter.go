@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter keeps a token bucket per key, e.g. per tenant or client IP
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled completely
+	full time.Time
+}
+
+// sweepInterval is how often buckets that have refilled are dropped
+const sweepInterval = time.Minute
+
+// NewLimiter creates a new Limiter
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key at time now. The bucket holds up
+// to burst tokens and refills at perMinute tokens per minute. If it is empty,
+// Allow reports how long until the next token.
+func (l *Limiter) Allow(key string, now time.Time, perMinute, burst int) (time.Duration, bool) {
+	if perMinute <= 0 {
+		return 0, true
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	capacity := float64(burst)
+	perSecond := float64(perMinute) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		b.full = now.Add(refillTime(capacity-b.tokens, perSecond))
+		return refillTime(1-b.tokens, perSecond), false
+	}
+	b.tokens--
+	b.full = now.Add(refillTime(capacity-b.tokens, perSecond))
+	return 0, true
+}
+
+// Reserve takes a token from the bucket of key at time now like Allow, but an
+// empty bucket lends it against future refills instead of refusing it. The
+// returned delay is how long until the debt, including this token, is repaid,
+// so that sustained use above perMinute waits longer and longer. If the delay
+// would exceed a positive maxDelay, nothing is borrowed and ok is false.
+func (l *Limiter) Reserve(key string, now time.Time, perMinute, burst int, maxDelay time.Duration) (delay time.Duration, ok bool) {
+	if perMinute <= 0 {
+		return 0, true
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	capacity := float64(burst)
+	perSecond := float64(perMinute) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		delay = refillTime(1-b.tokens, perSecond)
+		if maxDelay > 0 && delay > maxDelay {
+			return delay, false
+		}
+	}
+	b.tokens--
+	b.full = now.Add(refillTime(capacity-b.tokens, perSecond))
+	return delay, true
+}
+
+// refillTime returns how long it takes to refill tokens at perSecond
+func refillTime(tokens, perSecond float64) time.Duration {
+	return time.Duration(tokens / perSecond * float64(time.Second))
+}
+
+// Len returns the number of tracked keys
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep drops full buckets so that memory does not grow with every key ever
+// seen; a dropped bucket is recreated full. Callers must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := NewLimiter()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := l.Allow("a", now, 60, 3); !ok {
+			t.Fatalf("request %d within the burst was rejected", i+1)
+		}
+	}
+	wait, ok := l.Allow("a", now, 60, 3)
+	if ok || wait != time.Second {
+		t.Errorf("Allow() beyond the burst = %v, %v, want rejected with a 1s wait", wait, ok)
+	}
+	if _, ok := l.Allow("b", now, 60, 3); !ok {
+		t.Error("Allow() for another key was rejected")
+	}
+	if _, ok := l.Allow("a", now.Add(time.Second), 60, 3); !ok {
+		t.Error("Allow() after a token refilled was rejected")
+	}
+	if _, ok := l.Allow("a", now, 0, 0); !ok {
+		t.Error("Allow() without a limit was rejected")
+	}
+}
+
+func TestLimiter_SweepsFullBuckets(t *testing.T) {
+	l := NewLimiter()
+	now := time.Unix(1000, 0)
+	l.Allow("a", now, 60, 60)
+	l.Allow("b", now, 60, 60)
+
+	// After a minute "a" has refilled; "b" is used again and stays tracked
+	later := now.Add(time.Minute)
+	for i := 0; i < 10; i++ {
+		l.Allow("b", later.Add(-time.Second), 60, 60)
+	}
+	l.Allow("c", later, 60, 60)
+	if l.Len() != 2 {
+		t.Errorf("Len() = %d, want 2 after the full bucket was swept", l.Len())
+	}
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	l := NewLimiter()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		if delay, ok := l.Reserve("a", now, 60, 2, 0); !ok || delay != 0 {
+			t.Fatalf("request %d within the burst = %v, %v, want no delay", i+1, delay, ok)
+		}
+	}
+	// Beyond the burst each request borrows one more second
+	for i := 1; i <= 3; i++ {
+		if delay, ok := l.Reserve("a", now, 60, 2, 0); !ok || delay != time.Duration(i)*time.Second {
+			t.Errorf("borrowing request %d = %v, %v, want a %ds delay", i, delay, ok, i)
+		}
+	}
+	// A request that would wait longer than the maximum borrows nothing
+	if delay, ok := l.Reserve("a", now, 60, 2, 3*time.Second); ok || delay != 4*time.Second {
+		t.Errorf("Reserve() over the maximum delay = %v, %v, want refused with 4s", delay, ok)
+	}
+	// The debt is repaid over time
+	if delay, ok := l.Reserve("a", now.Add(3*time.Second), 60, 2, 0); !ok || delay != time.Second {
+		t.Errorf("Reserve() after 3s = %v, %v, want a 1s delay", delay, ok)
+	}
+}
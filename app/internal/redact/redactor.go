@@ -0,0 +1,175 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Scrubber removes one kind of sensitive data from text
+type Scrubber interface {
+	// Name identifies the rule in placeholders and statistics
+	Name() string
+	// Scrub returns the text with sensitive data replaced and the number of replacements
+	Scrub(text string) (string, int)
+}
+
+// textFields are the request fields holding prompt text; strings in them (or in
+// arrays of them) are scrubbed, other strings (models, roles, image URLs) are left intact
+var textFields = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"prompt":       true,
+	"input":        true,
+	"instructions": true,
+	"system":       true,
+}
+
+// Redactor scrubs sensitive data from request bodies before they are forwarded
+// and counts the redactions per session.
+type Redactor struct {
+	scrubbers []Scrubber
+	stats     map[string]map[string]int
+	mu        sync.Mutex
+}
+
+// NewRedactor creates a new Redactor applying the scrubbers in order
+func NewRedactor(scrubbers ...Scrubber) *Redactor {
+	return &Redactor{
+		scrubbers: scrubbers,
+		stats:     make(map[string]map[string]int),
+	}
+}
+
+// Filter scrubs the prompt text of a JSON request body
+func (r *Redactor) Filter(sessionID string, req *entities.ProxyRequest) error {
+	if len(req.Body) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(req.Body))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		// Not JSON; nothing to scrub
+		return nil
+	}
+
+	counts := make(map[string]int)
+	body = r.walk(body, false, counts)
+	if len(counts) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode redacted body: %w", err)
+	}
+	req.Body = encoded
+	r.record(sessionID, counts)
+	return nil
+}
+
+// ScrubJSON scrubs a JSON value that is not a request, such as a stored
+// completion: the strings of its text fields, or the value itself if it is a
+// string or an array of strings. Its redactions are not counted. Values that
+// are not JSON are returned unchanged.
+func (r *Redactor) ScrubJSON(value json.RawMessage) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return value
+	}
+	encoded, err := json.Marshal(r.walk(decoded, true, make(map[string]int)))
+	if err != nil {
+		return value
+	}
+	return encoded
+}
+
+// Stats returns the redaction counts of every session with redactions, sorted by session ID
+func (r *Redactor) Stats() []entities.RedactionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]entities.RedactionStats, 0, len(r.stats))
+	for sessionID := range r.stats {
+		result = append(result, r.sessionStats(sessionID))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SessionID < result[j].SessionID
+	})
+	return result
+}
+
+// SessionStats returns the redaction counts of a single session
+func (r *Redactor) SessionStats(sessionID string) entities.RedactionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessionStats(sessionID)
+}
+
+// sessionStats copies a session's counts; callers must hold mu
+func (r *Redactor) sessionStats(sessionID string) entities.RedactionStats {
+	stats := entities.RedactionStats{
+		SessionID:  sessionID,
+		Redactions: make(map[string]int, len(r.stats[sessionID])),
+	}
+	for name, count := range r.stats[sessionID] {
+		stats.Redactions[name] = count
+		stats.Total += count
+	}
+	return stats
+}
+
+// walk scrubs the strings held by text fields, adding the replacements to counts
+func (r *Redactor) walk(value interface{}, inText bool, counts map[string]int) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = r.walk(child, textFields[key], counts)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.walk(child, inText, counts)
+		}
+		return v
+	case string:
+		if !inText {
+			return v
+		}
+		for _, scrubber := range r.scrubbers {
+			var n int
+			v, n = scrubber.Scrub(v)
+			if n > 0 {
+				counts[scrubber.Name()] += n
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// record adds a request's redactions to its session's totals
+func (r *Redactor) record(sessionID string, counts map[string]int) {
+	if sessionID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.stats[sessionID]
+	if !ok {
+		stats = make(map[string]int)
+		r.stats[sessionID] = stats
+	}
+	for name, count := range counts {
+		stats[name] += count
+	}
+}
@@ -0,0 +1,152 @@
+package redact_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/redact"
+)
+
+func newTestRedactor(t *testing.T) *redact.Redactor {
+	t.Helper()
+	email, err := redact.NewBuiltinScrubber("email")
+	if err != nil {
+		t.Fatalf("NewBuiltinScrubber(email) error = %v", err)
+	}
+	phone, err := redact.NewBuiltinScrubber("phone")
+	if err != nil {
+		t.Fatalf("NewBuiltinScrubber(phone) error = %v", err)
+	}
+	terms, err := redact.NewDictionaryScrubber("project", []string{"Bluebird", "Nightjar"})
+	if err != nil {
+		t.Fatalf("NewDictionaryScrubber() error = %v", err)
+	}
+	return redact.NewRedactor(email, phone, terms)
+}
+
+func TestPatternScrubbers(t *testing.T) {
+	r := newTestRedactor(t)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"email", "mail jane.doe+x@example.co.uk now", "mail [REDACTED_EMAIL] now"},
+		{"north american phone", "call (555) 123-4567 or 555.123.4567", "call [REDACTED_PHONE] or [REDACTED_PHONE]"},
+		{"international phone", "call +44 20 7946 0958", "call [REDACTED_PHONE]"},
+		{"dictionary", "the bluebird launch", "the [REDACTED_PROJECT] launch"},
+		{"dates and numbers", "on 2024-01-15 we sold 1500 units", "on 2024-01-15 we sold 1500 units"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"prompt": tt.text})
+			req := &entities.ProxyRequest{Body: body}
+			if err := r.Filter("", req); err != nil {
+				t.Fatalf("Filter() error = %v", err)
+			}
+			var got map[string]string
+			json.Unmarshal(req.Body, &got)
+			if got["prompt"] != tt.want {
+				t.Errorf("Filter() prompt = %q, want %q", got["prompt"], tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	scrubbers, err := redact.ParsePatterns(`{"ticket":"TCK-[0-9]+","account":"ACC[0-9]{6}"}`)
+	if err != nil {
+		t.Fatalf("ParsePatterns() error = %v", err)
+	}
+	if len(scrubbers) != 2 || scrubbers[0].Name() != "account" || scrubbers[1].Name() != "ticket" {
+		t.Fatalf("ParsePatterns() = %d scrubbers, want account and ticket in order", len(scrubbers))
+	}
+	if got, n := scrubbers[1].Scrub("see TCK-42"); got != "see [REDACTED_TICKET]" || n != 1 {
+		t.Errorf("Scrub() = %q, %d, want one ticket redaction", got, n)
+	}
+}
+
+func TestRedactor_OnlyTextFields(t *testing.T) {
+	r := newTestRedactor(t)
+
+	body := `{"model":"bluebird","user":"a@b.io","temperature":0.25,"messages":[
+		{"role":"user","content":"I am a@b.io"},
+		{"role":"user","content":[{"type":"text","text":"phone 555-123-4567"},{"type":"image_url","image_url":{"url":"https://x.io/5551234567.png"}}]}
+	]}`
+	req := &entities.ProxyRequest{Body: []byte(body)}
+	if err := r.Filter("s1", req); err != nil {
+		t.Fatalf("Filter() error = %v", err)
+	}
+
+	got := string(req.Body)
+	for _, want := range []string{`"model":"bluebird"`, `"user":"a@b.io"`, `"temperature":0.25`, `I am [REDACTED_EMAIL]`, `phone [REDACTED_PHONE]`, `5551234567.png`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Filter() body = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestRedactor_ScrubJSON(t *testing.T) {
+	r := newTestRedactor(t)
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"message", `{"role":"assistant","content":"Mail a@b.io","name":"a@b.io"}`, `{"content":"Mail [REDACTED_EMAIL]","name":"a@b.io","role":"assistant"}`},
+		{"text", `"Call 555-123-4567"`, `"Call [REDACTED_PHONE]"`},
+		{"not json", `Mail a@b.io`, `Mail a@b.io`},
+	}
+	for _, tt := range tests {
+		if got := string(r.ScrubJSON(json.RawMessage(tt.value))); got != tt.want {
+			t.Errorf("ScrubJSON(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if stats := r.Stats(); len(stats) != 0 {
+		t.Errorf("Stats() = %+v, want ScrubJSON not counted", stats)
+	}
+}
+
+func TestRedactor_Stats(t *testing.T) {
+	r := newTestRedactor(t)
+
+	for _, sessionID := range []string{"s1", "s1", "s2", ""} {
+		req := &entities.ProxyRequest{Body: []byte(`{"input":["a@b.io","c@d.io, 555-123-4567"]}`)}
+		if err := r.Filter(sessionID, req); err != nil {
+			t.Fatalf("Filter() error = %v", err)
+		}
+	}
+	unchanged := &entities.ProxyRequest{Body: []byte(`{"input":"nothing to see"}`)}
+	r.Filter("s3", unchanged)
+
+	stats := r.SessionStats("s1")
+	if stats.Redactions["email"] != 4 || stats.Redactions["phone"] != 2 || stats.Total != 6 {
+		t.Errorf("SessionStats(s1) = %+v, want 4 emails and 2 phones", stats)
+	}
+	all := r.Stats()
+	if len(all) != 2 || all[0].SessionID != "s1" || all[1].SessionID != "s2" || all[1].Total != 3 {
+		t.Errorf("Stats() = %+v, want s1 and s2 only", all)
+	}
+	if string(unchanged.Body) != `{"input":"nothing to see"}` {
+		t.Errorf("Filter() rewrote body without redactions: %s", unchanged.Body)
+	}
+}
+
+func TestNewScrubber_Errors(t *testing.T) {
+	if _, err := redact.NewBuiltinScrubber("ssn"); err == nil {
+		t.Error("NewBuiltinScrubber(ssn) error = nil, want unknown pattern error")
+	}
+	if _, err := redact.NewPatternScrubber("bad", "("); err == nil {
+		t.Error("NewPatternScrubber() error = nil, want invalid pattern error")
+	}
+	if _, err := redact.ParsePatterns(`{"bad":"("}`); err == nil {
+		t.Error("ParsePatterns() error = nil, want invalid pattern error")
+	}
+	if _, err := redact.NewDictionaryScrubber("empty", []string{" "}); err == nil {
+		t.Error("NewDictionaryScrubber() error = nil, want empty dictionary error")
+	}
+}
@@ -0,0 +1,102 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// builtinPatterns are the patterns available by name through NewBuiltinScrubber
+var builtinPatterns = map[string]string{
+	"email": `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	// North American numbers, or international numbers with a "+" country code
+	"phone": `(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{3}\)|\b\d{3})[\s.\-]?\d{3}[\s.\-]?\d{4}\b|\+\d{1,3}(?:[\s.\-]?\d{2,4}){3,5}\b`,
+}
+
+// PatternScrubber replaces matches of a regular expression
+type PatternScrubber struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewPatternScrubber creates a new PatternScrubber for the given expression
+func NewPatternScrubber(name, expr string) (*PatternScrubber, error) {
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redaction pattern %q: %w", name, err)
+	}
+	return &PatternScrubber{
+		name:    name,
+		pattern: pattern,
+	}, nil
+}
+
+// NewBuiltinScrubber creates a PatternScrubber for a built-in pattern ("email" or "phone")
+func NewBuiltinScrubber(name string) (*PatternScrubber, error) {
+	expr, ok := builtinPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown built-in redaction pattern %q", name)
+	}
+	return NewPatternScrubber(name, expr)
+}
+
+// Name returns the rule name used in placeholders and statistics
+func (s *PatternScrubber) Name() string {
+	return s.name
+}
+
+// Scrub replaces every match with a placeholder and returns the number of matches
+func (s *PatternScrubber) Scrub(text string) (string, int) {
+	count := 0
+	scrubbed := s.pattern.ReplaceAllStringFunc(text, func(string) string {
+		count++
+		return placeholder(s.name)
+	})
+	return scrubbed, count
+}
+
+// ParsePatterns creates scrubbers from a JSON object of rule names to regular
+// expressions, ordered by name
+func ParsePatterns(raw string) ([]Scrubber, error) {
+	var patterns map[string]string
+	if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+		return nil, fmt.Errorf("invalid redaction patterns: %w", err)
+	}
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scrubbers := make([]Scrubber, 0, len(names))
+	for _, name := range names {
+		scrubber, err := NewPatternScrubber(name, patterns[name])
+		if err != nil {
+			return nil, err
+		}
+		scrubbers = append(scrubbers, scrubber)
+	}
+	return scrubbers, nil
+}
+
+// NewDictionaryScrubber creates a PatternScrubber matching the given terms as
+// whole words, case-insensitively
+func NewDictionaryScrubber(name string, terms []string) (*PatternScrubber, error) {
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil, fmt.Errorf("redaction dictionary %q is empty", name)
+	}
+	return NewPatternScrubber(name, `(?i)\b(?:`+strings.Join(quoted, "|")+`)\b`)
+}
+
+// placeholder returns the replacement text for a rule, e.g. [REDACTED_EMAIL]
+func placeholder(name string) string {
+	return "[REDACTED_" + strings.ToUpper(name) + "]"
+}
@@ -0,0 +1,65 @@
+package repository_test
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_BudgetTransfers(t *testing.T) {
+	testBudgetRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_BudgetTransfers(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testBudgetRepository(t, repo)
+}
+
+func testBudgetRepository(t *testing.T, repo repository.BudgetRepository) {
+	t.Helper()
+
+	if adjustments, err := repo.BudgetAdjustments(); err != nil || len(adjustments) != 0 {
+		t.Fatalf("BudgetAdjustments() = %v, %v, want none", adjustments, err)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, transfer := range []entities.BudgetTransfer{
+		{From: "batch", To: "interactive", Tokens: 5000, Reason: "launch", CreatedAt: at},
+		{From: "interactive", To: "agent-1", Tokens: 1200, CreatedAt: at.Add(time.Minute)},
+		// Without a source, as set on a clone
+		{To: "agent-2", Tokens: -300, CreatedAt: at.Add(2 * time.Minute)},
+	} {
+		saved, err := repo.SaveBudgetTransfer(transfer)
+		if err != nil {
+			t.Fatalf("SaveBudgetTransfer() error = %v", err)
+		}
+		if saved.ID == 0 || saved.To != transfer.To {
+			t.Errorf("SaveBudgetTransfer() = %+v, want the transfer with an ID", saved)
+		}
+	}
+
+	transfers, err := repo.ListBudgetTransfers(10)
+	if err != nil {
+		t.Fatalf("ListBudgetTransfers() error = %v", err)
+	}
+	if len(transfers) != 3 || transfers[0].To != "agent-2" || transfers[2].Reason != "launch" ||
+		!transfers[2].CreatedAt.Equal(at) || transfers[0].ID <= transfers[1].ID {
+		t.Errorf("ListBudgetTransfers() = %+v, want all transfers, newest first", transfers)
+	}
+	if transfers, _ := repo.ListBudgetTransfers(1); len(transfers) != 1 {
+		t.Errorf("ListBudgetTransfers(1) = %+v, want one transfer", transfers)
+	}
+
+	adjustments, err := repo.BudgetAdjustments()
+	if err != nil {
+		t.Fatalf("BudgetAdjustments() error = %v", err)
+	}
+	want := map[string]int{"batch": -5000, "interactive": 3800, "agent-1": 1200, "agent-2": -300}
+	if !maps.Equal(adjustments, want) {
+		t.Errorf("BudgetAdjustments() = %v, want %v", adjustments, want)
+	}
+}
@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_FineTuneJobs(t *testing.T) {
+	testFineTuneRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_FineTuneJobs(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testFineTuneRepository(t, repo)
+}
+
+func testFineTuneRepository(t *testing.T, repo repository.FineTuneRepository) {
+	t.Helper()
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"ftjob-2", "ftjob-1"} {
+		job := entities.FineTuneJob{ID: id, SessionID: "trainer", Model: "gpt-4o-mini", Status: "queued", CreatedAt: created.Add(-time.Duration(i) * time.Minute)}
+		if err := repo.SaveFineTuneJob(job); err != nil {
+			t.Fatalf("SaveFineTuneJob(%s) error = %v", id, err)
+		}
+	}
+	finished := created.Add(time.Hour)
+	if err := repo.SaveFineTuneJob(entities.FineTuneJob{ID: "ftjob-2", SessionID: "trainer", Model: "gpt-4o-mini", Status: "succeeded",
+		TrainedTokens: 500, CreatedAt: created, FinishedAt: &finished}); err != nil {
+		t.Fatalf("SaveFineTuneJob() of a finished job error = %v", err)
+	}
+
+	pending, err := repo.ListPendingFineTuneJobs()
+	if err != nil {
+		t.Fatalf("ListPendingFineTuneJobs() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != "ftjob-1" || pending[0].Status != "queued" || pending[0].SessionID != "trainer" {
+		t.Errorf("ListPendingFineTuneJobs() = %+v, want only ftjob-1", pending)
+	}
+}
@@ -0,0 +1,64 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_Leases(t *testing.T) {
+	testLeaseRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_Leases(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testLeaseRepository(t, repo)
+}
+
+func testLeaseRepository(t *testing.T, repo repository.LeaseRepository) {
+	t.Helper()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	lease := func(holder string, at time.Time) entities.Lease {
+		return entities.Lease{Name: "background", Holder: holder, ExpiresAt: at.Add(30 * time.Second)}
+	}
+	steps := []struct {
+		name   string
+		holder string
+		at     time.Time
+		want   bool
+	}{
+		{"free lease", "replica-a", now, true},
+		{"held by another replica", "replica-b", now.Add(10 * time.Second), false},
+		{"renewed by its holder", "replica-a", now.Add(20 * time.Second), true},
+		{"still held after renewal", "replica-b", now.Add(40 * time.Second), false},
+		{"expired", "replica-b", now.Add(time.Minute), true},
+	}
+	for _, step := range steps {
+		got, err := repo.AcquireLease(lease(step.holder, step.at), step.at)
+		if err != nil {
+			t.Fatalf("AcquireLease(%s) error = %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("AcquireLease(%s) = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	// Only the holder can release a lease
+	later := now.Add(70 * time.Second)
+	if err := repo.ReleaseLease("background", "replica-a"); err != nil {
+		t.Fatalf("ReleaseLease() error = %v", err)
+	}
+	if got, _ := repo.AcquireLease(lease("replica-a", later), later); got {
+		t.Error("AcquireLease() after another replica's release = true, want false")
+	}
+	if err := repo.ReleaseLease("background", "replica-b"); err != nil {
+		t.Fatalf("ReleaseLease() error = %v", err)
+	}
+	if got, _ := repo.AcquireLease(lease("replica-a", later), later); !got {
+		t.Error("AcquireLease() after the holder's release = false, want true")
+	}
+}
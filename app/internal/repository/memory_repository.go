@@ -1,7 +1,14 @@
 package repository
 
 import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -9,13 +16,42 @@ import (
 // MemoryRepository is an in-memory implementation of the Repository interface.
 type MemoryRepository struct {
 	sessions map[string]*entities.SessionData
-	mu       sync.RWMutex
+	cache    map[string]entities.CacheEntry
+	jobs     map[string]entities.Job
+	shadow   []entities.ShadowResult
+	history  []entities.RequestRecord
+	tenants  map[string]entities.Tenant
+	keys     map[string]entities.VirtualKey
+	threads  map[string]string
+	runs     map[string]bool
+	fineTune map[string]entities.FineTuneJob
+	// activity holds the time of each session's last request
+	activity map[string]time.Time
+	leases   map[string]entities.Lease
+	// transcripts holds the captured turns of each session, oldest first
+	transcripts map[string][]entities.TranscriptTurn
+	// transfers holds the budget transfers, oldest first
+	transfers []entities.BudgetTransfer
+	// lastRecordID is the ID assigned to the most recent request record
+	lastRecordID int64
+	lastTurnID   int64
+	mu           sync.RWMutex
 }
 
 // NewMemoryRepository creates a new MemoryRepository.
 func NewMemoryRepository() *MemoryRepository {
 	return &MemoryRepository{
-		sessions: make(map[string]*entities.SessionData),
+		sessions:    make(map[string]*entities.SessionData),
+		cache:       make(map[string]entities.CacheEntry),
+		jobs:        make(map[string]entities.Job),
+		tenants:     make(map[string]entities.Tenant),
+		keys:        make(map[string]entities.VirtualKey),
+		threads:     make(map[string]string),
+		runs:        make(map[string]bool),
+		fineTune:    make(map[string]entities.FineTuneJob),
+		activity:    make(map[string]time.Time),
+		leases:      make(map[string]entities.Lease),
+		transcripts: make(map[string][]entities.TranscriptTurn),
 	}
 }
 
@@ -58,6 +94,7 @@ func (r *MemoryRepository) CreateSession(sessionID string) (*entities.SessionDat
 		SessionID: sessionID,
 	}
 	r.sessions[sessionID] = sess
+	r.activity[sessionID] = time.Now()
 	sessCopy := *sess
 	return &sessCopy, nil
 }
@@ -77,12 +114,189 @@ func (r *MemoryRepository) UpdateSessionTokens(sessionID string, usage entities.
 	sess.TotalPromptTokens += usage.PromptTokens
 	sess.TotalCompletionTokens += usage.CompletionTokens
 	sess.TotalTokens += usage.TotalTokens
+	if usage.Estimated {
+		sess.EstimatedTokens += usage.TotalTokens
+	}
+	sess.TotalImages += usage.Images
+	sess.TotalAudioSeconds += usage.AudioSeconds
+	sess.TotalCharacters += usage.Characters
+	sess.TotalTrainedTokens += usage.TrainedTokens
+	sess.TotalCost += usage.Cost
+	if len(usage.ToolCalls) > 0 {
+		// Copies handed out keep the map they were given
+		toolCalls := make(map[string]int, len(sess.ToolCalls)+len(usage.ToolCalls))
+		for name, n := range sess.ToolCalls {
+			toolCalls[name] = n
+		}
+		for name, n := range usage.ToolCalls {
+			toolCalls[name] += n
+			sess.TotalToolCalls += n
+		}
+		sess.ToolCalls = toolCalls
+	}
 	sess.RequestCount++
+	r.activity[sessionID] = time.Now()
 
 	sessCopy := *sess
 	return &sessCopy, nil
 }
 
+// DeleteSession removes a session and its statistics.
+func (r *MemoryRepository) DeleteSession(sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.sessions[sessionID]; !exists {
+		return entities.ErrSessionNotFound
+	}
+	delete(r.sessions, sessionID)
+	delete(r.activity, sessionID)
+	delete(r.transcripts, sessionID)
+	return nil
+}
+
+// MergeSessions adds the source session's usage to the target and moves its history.
+func (r *MemoryRepository) MergeSessions(sourceID, targetID string) (*entities.SessionData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	source, exists := r.sessions[sourceID]
+	if !exists {
+		return nil, entities.ErrSessionNotFound
+	}
+	// The merge works on a copy, as copies handed out share the maps
+	target := entities.SessionData{SessionID: targetID}
+	if sess, exists := r.sessions[targetID]; exists {
+		target = *sess
+		target.Metadata = maps.Clone(sess.Metadata)
+	}
+	mergeSessionData(&target, source)
+	r.sessions[targetID] = &target
+	if r.activity[sourceID].After(r.activity[targetID]) {
+		r.activity[targetID] = r.activity[sourceID]
+	}
+	delete(r.sessions, sourceID)
+	delete(r.activity, sourceID)
+
+	for i := range r.history {
+		if r.history[i].SessionID == sourceID {
+			r.history[i].SessionID = targetID
+		}
+	}
+	if turns := r.transcripts[sourceID]; len(turns) > 0 {
+		for i := range turns {
+			turns[i].SessionID = targetID
+		}
+		merged := append(slices.Clone(r.transcripts[targetID]), turns...)
+		slices.SortFunc(merged, func(a, b entities.TranscriptTurn) int { return cmp.Compare(a.ID, b.ID) })
+		r.transcripts[targetID] = merged[max(len(merged)-maxTranscriptTurns, 0):]
+		delete(r.transcripts, sourceID)
+	}
+	for id, job := range r.jobs {
+		if job.SessionID == sourceID {
+			job.SessionID = targetID
+			r.jobs[id] = job
+		}
+	}
+	for threadID, sessionID := range r.threads {
+		if sessionID == sourceID {
+			r.threads[threadID] = targetID
+		}
+	}
+	for id, job := range r.fineTune {
+		if job.SessionID == sourceID {
+			job.SessionID = targetID
+			r.fineTune[id] = job
+		}
+	}
+
+	sessCopy := target
+	return &sessCopy, nil
+}
+
+// ImportSession stores an exported session.
+func (r *MemoryRepository) ImportSession(sess entities.SessionData, overwrite bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.sessions[sess.SessionID]; exists && !overwrite {
+		return false, nil
+	}
+	sess.Metadata = maps.Clone(sess.Metadata)
+	sess.ErrorTypes = maps.Clone(sess.ErrorTypes)
+	sess.ToolCalls = maps.Clone(sess.ToolCalls)
+	r.sessions[sess.SessionID] = &sess
+	r.activity[sess.SessionID] = time.Now()
+	return true, nil
+}
+
+// RecordSessionResponse counts a response by status class.
+// If the session does not exist, it creates it.
+func (r *MemoryRepository) RecordSessionResponse(sessionID string, response entities.SessionResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sess, exists := r.sessions[sessionID]
+	if !exists {
+		sess = &entities.SessionData{SessionID: sessionID}
+		r.sessions[sessionID] = sess
+	}
+
+	switch {
+	case response.StatusCode >= 500:
+		sess.Responses5xx++
+	case response.StatusCode >= 400:
+		sess.Responses4xx++
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		sess.Responses2xx++
+	}
+	if response.StatusCode >= 400 {
+		at := response.At
+		sess.LastError = response.Error
+		sess.LastErrorAt = &at
+	}
+	if response.ErrorType != "" {
+		// Copies handed out keep the map they were given
+		errorTypes := make(map[string]int, len(sess.ErrorTypes)+1)
+		for errType, n := range sess.ErrorTypes {
+			errorTypes[errType] = n
+		}
+		errorTypes[response.ErrorType]++
+		sess.ErrorTypes = errorTypes
+	}
+	r.activity[sessionID] = time.Now()
+	return nil
+}
+
+// SetSessionMetadata merges metadata into a session's metadata.
+// The map is replaced rather than modified so copies handed out stay unchanged.
+func (r *MemoryRepository) SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sess, exists := r.sessions[sessionID]
+	if !exists {
+		return nil, entities.ErrSessionNotFound
+	}
+	sess.Metadata = mergeMetadata(sess.Metadata, metadata)
+
+	sessCopy := *sess
+	return &sessCopy, nil
+}
+
+// MarkSessionMetered records how many of a session's tokens have been reported for billing.
+func (r *MemoryRepository) MarkSessionMetered(sessionID string, meteredTokens int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sess, exists := r.sessions[sessionID]
+	if !exists {
+		return entities.ErrSessionNotFound
+	}
+	sess.MeteredTokens = meteredTokens
+	return nil
+}
+
 // ListSessions returns all session data.
 func (r *MemoryRepository) ListSessions() (map[string]*entities.SessionData, error) {
 	r.mu.RLock()
@@ -95,3 +309,647 @@ func (r *MemoryRepository) ListSessions() (map[string]*entities.SessionData, err
 	}
 	return result, nil
 }
+
+// GetCacheEntry returns the cached response for key, or nil if there is none.
+func (r *MemoryRepository) GetCacheEntry(key string) (*entities.CacheEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.cache[key]
+	if !exists {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// PutCacheEntry stores a cached response, replacing any existing entry for the key.
+func (r *MemoryRepository) PutCacheEntry(entry entities.CacheEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cache[entry.Key] = entry
+	return nil
+}
+
+// CreateJob stores a new job.
+func (r *MemoryRepository) CreateJob(job entities.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ID]; exists {
+		return fmt.Errorf("job %s already exists", job.ID)
+	}
+	r.jobs[job.ID] = job
+	return nil
+}
+
+// UpdateJob replaces the stored state of an existing job.
+func (r *MemoryRepository) UpdateJob(job entities.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ID]; !exists {
+		return entities.ErrJobNotFound
+	}
+	r.jobs[job.ID] = job
+	return nil
+}
+
+// GetJob retrieves a job by ID.
+func (r *MemoryRepository) GetJob(id string) (*entities.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, exists := r.jobs[id]
+	if !exists {
+		return nil, entities.ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// ListPendingJobs returns queued and running jobs, oldest first.
+func (r *MemoryRepository) ListPendingJobs() ([]entities.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var pending []entities.Job
+	for _, job := range r.jobs {
+		if job.Status == entities.JobStatusQueued || job.Status == entities.JobStatusRunning {
+			pending = append(pending, job)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	return pending, nil
+}
+
+// maxShadowResults bounds the shadow results kept in memory
+const maxShadowResults = 1000
+
+// SaveShadowResult stores a shadow result, discarding the oldest beyond maxShadowResults.
+func (r *MemoryRepository) SaveShadowResult(result entities.ShadowResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.shadow = append(r.shadow, result)
+	if len(r.shadow) > maxShadowResults {
+		r.shadow = r.shadow[len(r.shadow)-maxShadowResults:]
+	}
+	return nil
+}
+
+// ListShadowResults returns up to limit results, newest first.
+func (r *MemoryRepository) ListShadowResults(limit int) ([]entities.ShadowResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]entities.ShadowResult, 0, min(limit, len(r.shadow)))
+	for i := len(r.shadow) - 1; i >= 0 && len(results) < limit; i-- {
+		results = append(results, r.shadow[i])
+	}
+	return results, nil
+}
+
+// maxTranscriptTurns bounds the turns kept in memory per session
+const maxTranscriptTurns = 1000
+
+// SaveTranscriptTurn stores a turn, discarding the session's oldest beyond maxTranscriptTurns.
+func (r *MemoryRepository) SaveTranscriptTurn(turn entities.TranscriptTurn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastTurnID++
+	turn.ID = r.lastTurnID
+	turns := append(r.transcripts[turn.SessionID], turn)
+	if len(turns) > maxTranscriptTurns {
+		turns = slices.Clone(turns[len(turns)-maxTranscriptTurns:])
+	}
+	r.transcripts[turn.SessionID] = turns
+	return nil
+}
+
+// ListTranscript returns up to limit of a session's latest turns, oldest first.
+func (r *MemoryRepository) ListTranscript(sessionID string, limit int) ([]entities.TranscriptTurn, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	turns := r.transcripts[sessionID]
+	return append([]entities.TranscriptTurn{}, turns[max(len(turns)-limit, 0):]...), nil
+}
+
+// SaveBudgetTransfer stores a budget transfer.
+func (r *MemoryRepository) SaveBudgetTransfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transfer.ID = int64(len(r.transfers) + 1)
+	r.transfers = append(r.transfers, transfer)
+	return &transfer, nil
+}
+
+// ListBudgetTransfers returns up to limit transfers, newest first.
+func (r *MemoryRepository) ListBudgetTransfers(limit int) ([]entities.BudgetTransfer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transfers := []entities.BudgetTransfer{}
+	for i := len(r.transfers) - 1; i >= 0 && len(transfers) < limit; i-- {
+		transfers = append(transfers, r.transfers[i])
+	}
+	return transfers, nil
+}
+
+// BudgetAdjustments returns the net amount transferred to each key.
+func (r *MemoryRepository) BudgetAdjustments() (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	adjustments := make(map[string]int)
+	for _, transfer := range r.transfers {
+		if transfer.From != "" {
+			adjustments[transfer.From] -= transfer.Tokens
+		}
+		adjustments[transfer.To] += transfer.Tokens
+	}
+	return adjustments, nil
+}
+
+// maxRequestRecords bounds the request history kept in memory
+const maxRequestRecords = 10000
+
+// SaveRequestRecord stores a request record, discarding the oldest beyond maxRequestRecords.
+func (r *MemoryRepository) SaveRequestRecord(record entities.RequestRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastRecordID++
+	record.ID = r.lastRecordID
+	r.history = append(r.history, record)
+	if len(r.history) > maxRequestRecords {
+		r.history = r.history[len(r.history)-maxRequestRecords:]
+	}
+	return nil
+}
+
+// ListRequestRecords returns up to query.Limit matching records, newest first.
+func (r *MemoryRepository) ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := []entities.RequestRecord{}
+	for i := len(r.history) - 1; i >= 0 && len(records) < query.Limit; i-- {
+		if query.SessionID != "" && r.history[i].SessionID != query.SessionID {
+			continue
+		}
+		if query.ReplayOf != 0 && r.history[i].ReplayOf != query.ReplayOf {
+			continue
+		}
+		records = append(records, r.history[i])
+	}
+	return records, nil
+}
+
+// GetRequestRecord returns the record with the given ID.
+func (r *MemoryRepository) GetRequestRecord(id int64) (*entities.RequestRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// IDs are assigned in order, so the history is sorted by them
+	i, found := slices.BinarySearchFunc(r.history, id, func(record entities.RequestRecord, id int64) int {
+		return cmp.Compare(record.ID, id)
+	})
+	if !found {
+		return nil, entities.ErrRequestRecordNotFound
+	}
+	record := r.history[i]
+	return &record, nil
+}
+
+// DeleteCapturedBodies removes the captured bodies of records created before the given time.
+func (r *MemoryRepository) DeleteCapturedBodies(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cleared := 0
+	for i := range r.history {
+		if r.history[i].Capture != nil && r.history[i].CreatedAt.Before(before) {
+			r.history[i].Capture = nil
+			cleared++
+		}
+	}
+	return cleared, nil
+}
+
+// DeleteRequestRecordsBefore deletes request records created before the given time.
+func (r *MemoryRepository) DeleteRequestRecordsBefore(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.history[:0]
+	for _, record := range r.history {
+		if !record.CreatedAt.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	deleted := len(r.history) - len(kept)
+	clear(r.history[len(kept):])
+	r.history = kept
+	return deleted, nil
+}
+
+// DeleteFinishedJobsBefore deletes completed and failed jobs last updated before the given time.
+func (r *MemoryRepository) DeleteFinishedJobsBefore(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for id, job := range r.jobs {
+		finished := job.Status == entities.JobStatusCompleted || job.Status == entities.JobStatusFailed
+		if finished && job.UpdatedAt.Before(before) {
+			delete(r.jobs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteIdleSessions deletes sessions without requests since the given time.
+func (r *MemoryRepository) DeleteIdleSessions(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for id := range r.sessions {
+		if r.activity[id].Before(before) {
+			delete(r.sessions, id)
+			delete(r.activity, id)
+			delete(r.transcripts, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// AcquireLease grants or renews a lease unless another holder's lease is still valid.
+func (r *MemoryRepository) AcquireLease(lease entities.Lease, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.leases[lease.Name]; exists && current.Holder != lease.Holder && current.ExpiresAt.After(now) {
+		return false, nil
+	}
+	r.leases[lease.Name] = lease
+	return true, nil
+}
+
+// ReleaseLease gives up a lease if it is still held by holder.
+func (r *MemoryRepository) ReleaseLease(name, holder string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, exists := r.leases[name]; exists && current.Holder == holder {
+		delete(r.leases, name)
+	}
+	return nil
+}
+
+// CreateTenant stores a new tenant.
+func (r *MemoryRepository) CreateTenant(tenant entities.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tenants[tenant.ID]; exists {
+		return entities.ErrTenantExists
+	}
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// UpdateTenant replaces the stored state of an existing tenant.
+func (r *MemoryRepository) UpdateTenant(tenant entities.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tenants[tenant.ID]; !exists {
+		return entities.ErrTenantNotFound
+	}
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// GetTenant retrieves a tenant by ID.
+func (r *MemoryRepository) GetTenant(id string) (*entities.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant, exists := r.tenants[id]
+	if !exists {
+		return nil, entities.ErrTenantNotFound
+	}
+	return &tenant, nil
+}
+
+// ListTenants returns all tenants ordered by ID.
+func (r *MemoryRepository) ListTenants() ([]entities.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]entities.Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+	return tenants, nil
+}
+
+// DeleteTenant removes a tenant and its virtual keys.
+func (r *MemoryRepository) DeleteTenant(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tenants[id]; !exists {
+		return entities.ErrTenantNotFound
+	}
+	delete(r.tenants, id)
+	for hash, key := range r.keys {
+		if key.TenantID == id {
+			delete(r.keys, hash)
+		}
+	}
+	return nil
+}
+
+// CreateVirtualKey stores a new virtual key of an existing tenant.
+func (r *MemoryRepository) CreateVirtualKey(key entities.VirtualKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tenants[key.TenantID]; !exists {
+		return entities.ErrTenantNotFound
+	}
+	if _, exists := r.keys[key.Hash]; exists {
+		return fmt.Errorf("virtual key %s already exists", key.ID)
+	}
+	key.UpstreamAPIKeys = slices.Clone(key.UpstreamAPIKeys)
+	r.keys[key.Hash] = key
+	return nil
+}
+
+// UpdateVirtualKey replaces the name and upstream keys of a tenant's key.
+func (r *MemoryRepository) UpdateVirtualKey(key entities.VirtualKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, stored := range r.keys {
+		if stored.TenantID == key.TenantID && stored.ID == key.ID {
+			stored.Name = key.Name
+			stored.UpstreamAPIKeys = slices.Clone(key.UpstreamAPIKeys)
+			r.keys[hash] = stored
+			return nil
+		}
+	}
+	return entities.ErrVirtualKeyNotFound
+}
+
+// GetVirtualKey retrieves a virtual key by ID.
+func (r *MemoryRepository) GetVirtualKey(id string) (*entities.VirtualKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.ID == id {
+			return &key, nil
+		}
+	}
+	return nil, entities.ErrVirtualKeyNotFound
+}
+
+// GetVirtualKeyByHash retrieves a virtual key by the hash of its plaintext.
+func (r *MemoryRepository) GetVirtualKeyByHash(hash string) (*entities.VirtualKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, exists := r.keys[hash]
+	if !exists {
+		return nil, entities.ErrVirtualKeyNotFound
+	}
+	return &key, nil
+}
+
+// ListVirtualKeys returns a tenant's keys, oldest first.
+func (r *MemoryRepository) ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []entities.VirtualKey
+	for _, key := range r.keys {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// DeleteVirtualKey removes a tenant's virtual key.
+func (r *MemoryRepository) DeleteVirtualKey(tenantID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, key := range r.keys {
+		if key.TenantID == tenantID && key.ID == id {
+			delete(r.keys, hash)
+			return nil
+		}
+	}
+	return entities.ErrVirtualKeyNotFound
+}
+
+// SetThreadSession maps a thread to a session.
+func (r *MemoryRepository) SetThreadSession(threadID, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.threads[threadID] = sessionID
+	return nil
+}
+
+// GetThreadSession returns the session a thread is mapped to.
+func (r *MemoryRepository) GetThreadSession(threadID string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessionID, exists := r.threads[threadID]
+	if !exists {
+		return "", entities.ErrThreadNotFound
+	}
+	return sessionID, nil
+}
+
+// DeleteThreadSession removes the mapping of a thread.
+func (r *MemoryRepository) DeleteThreadSession(threadID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.threads[threadID]; !exists {
+		return entities.ErrThreadNotFound
+	}
+	delete(r.threads, threadID)
+	return nil
+}
+
+// MarkRunAccounted records that the usage of a run was counted.
+func (r *MemoryRepository) MarkRunAccounted(runID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.runs[runID] {
+		return false, nil
+	}
+	r.runs[runID] = true
+	return true, nil
+}
+
+// SaveFineTuneJob creates or replaces a fine-tuning job.
+func (r *MemoryRepository) SaveFineTuneJob(job entities.FineTuneJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fineTune[job.ID] = job
+	return nil
+}
+
+// ListPendingFineTuneJobs returns fine-tuning jobs that have not finished, oldest first.
+func (r *MemoryRepository) ListPendingFineTuneJobs() ([]entities.FineTuneJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var jobs []entities.FineTuneJob
+	for _, job := range r.fineTune {
+		if job.FinishedAt == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// FindSessions returns copies of the sessions the filter selects.
+func (r *MemoryRepository) FindSessions(filter entities.SessionFilter) (map[string]*entities.SessionData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string]*entities.SessionData)
+	for id, sess := range r.sessions {
+		// Tags are matched within the tenant, or on the whole ID without one
+		owner, sessionID := entities.SplitTenantSessionID(id)
+		if filter.TenantID == "" {
+			sessionID = id
+		}
+		switch {
+		case filter.TenantID != "" && owner != filter.TenantID,
+			filter.Tag != "" && entities.SessionTag(sessionID) != filter.Tag,
+			sess.TotalTokens < filter.MinTokens,
+			sess.TotalCost < filter.MinCost,
+			!filter.ActiveSince.IsZero() && r.activity[id].Before(filter.ActiveSince):
+			continue
+		}
+		sessCopy := *sess
+		result[id] = &sessCopy
+	}
+	return result, nil
+}
+
+// SummarizeGroup rolls up the usage of the sessions whose metadata key is id.
+func (r *MemoryRepository) SummarizeGroup(tenantID, key, id string) (*entities.SessionGroupUsage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	group := &entities.SessionGroupUsage{GroupKey: key, GroupID: id}
+	var ranks []entities.SessionRank
+	for sessionID, sess := range r.sessions {
+		if owner, _ := entities.SplitTenantSessionID(sessionID); tenantID != "" && owner != tenantID {
+			continue
+		}
+		if sess.Metadata[key] != id {
+			continue
+		}
+		rank := sessionRank(sessionID, sess)
+		group.Sessions++
+		group.PromptTokens += sess.TotalPromptTokens
+		group.CompletionTokens += sess.TotalCompletionTokens
+		group.TotalTokens += sess.TotalTokens
+		group.Requests += sess.RequestCount
+		group.Errors += rank.Errors
+		group.TotalCost += sess.TotalCost
+		ranks = append(ranks, rank)
+	}
+	group.SessionUsage = topSessions(ranks, len(ranks), func(rank entities.SessionRank) float64 { return float64(rank.TotalTokens) })
+	return group, nil
+}
+
+// SummarizeSessions returns the totals and top sessions of the selected sessions.
+func (r *MemoryRepository) SummarizeSessions(query entities.SessionSummaryQuery) (*entities.SessionSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	summary := &entities.SessionSummary{}
+	var ranks, responded []entities.SessionRank
+	for id, sess := range r.sessions {
+		if owner, _ := entities.SplitTenantSessionID(id); query.TenantID != "" && owner != query.TenantID {
+			continue
+		}
+		if !query.ActiveSince.IsZero() && r.activity[id].Before(query.ActiveSince) {
+			continue
+		}
+		rank := sessionRank(id, sess)
+		summary.Sessions++
+		summary.PromptTokens += sess.TotalPromptTokens
+		summary.CompletionTokens += sess.TotalCompletionTokens
+		summary.TotalTokens += sess.TotalTokens
+		summary.Requests += sess.RequestCount
+		summary.Errors += rank.Errors
+		summary.TotalCost += sess.TotalCost
+
+		ranks = append(ranks, rank)
+		if sess.Responses2xx+rank.Errors > 0 {
+			responded = append(responded, rank)
+		}
+	}
+
+	summary.TopByTokens = topSessions(ranks, query.Limit, func(rank entities.SessionRank) float64 { return float64(rank.TotalTokens) })
+	summary.TopByCost = topSessions(ranks, query.Limit, func(rank entities.SessionRank) float64 { return rank.TotalCost })
+	summary.TopByRequests = topSessions(ranks, query.Limit, func(rank entities.SessionRank) float64 { return float64(rank.RequestCount) })
+	summary.TopByErrorRate = topSessions(responded, query.Limit, func(rank entities.SessionRank) float64 { return rank.ErrorRate })
+	return summary, nil
+}
+
+// sessionRank returns the rank entry of a session
+func sessionRank(id string, sess *entities.SessionData) entities.SessionRank {
+	rank := entities.SessionRank{
+		SessionID:    id,
+		TotalTokens:  sess.TotalTokens,
+		TotalCost:    sess.TotalCost,
+		RequestCount: sess.RequestCount,
+		Errors:       sess.Responses4xx + sess.Responses5xx,
+	}
+	if responses := sess.Responses2xx + rank.Errors; responses > 0 {
+		rank.ErrorRate = float64(rank.Errors) / float64(responses)
+	}
+	return rank
+}
+
+// topSessions returns up to limit sessions with the highest values, ties
+// broken by session ID as in the SQL queries
+func topSessions(ranks []entities.SessionRank, limit int, value func(entities.SessionRank) float64) []entities.SessionRank {
+	sorted := slices.Clone(ranks)
+	slices.SortFunc(sorted, func(a, b entities.SessionRank) int {
+		if c := cmp.Compare(value(b), value(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.SessionID, b.SessionID)
+	})
+	if sorted == nil {
+		sorted = []entities.SessionRank{}
+	}
+	return sorted[:min(len(sorted), limit)]
+}
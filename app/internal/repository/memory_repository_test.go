@@ -1,9 +1,13 @@
 package repository_test
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
@@ -125,3 +129,249 @@ func TestMemoryRepository_ListSessions(t *testing.T) {
 		t.Errorf("ListSessions() 'sess2' TotalTokens = %d, want 100", sessions["sess2"].TotalTokens)
 	}
 }
+
+func TestMemoryRepository_EstimatedTokens(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	repo.UpdateSessionTokens("est", entities.TokenUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+	sess, err := repo.UpdateSessionTokens("est", entities.TokenUsage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10, Estimated: true})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	if sess.TotalTokens != 13 || sess.EstimatedTokens != 10 {
+		t.Errorf("UpdateSessionTokens() = (total %d, estimated %d), want (13, 10)", sess.TotalTokens, sess.EstimatedTokens)
+	}
+}
+
+func TestMemoryRepository_MediaUsage(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	repo.UpdateSessionTokens("media", entities.TokenUsage{Images: 2, Cost: 0.08})
+	sess, err := repo.UpdateSessionTokens("media", entities.TokenUsage{AudioSeconds: 12.5, Characters: 40, Cost: 0.02})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	if sess.TotalImages != 2 || sess.TotalAudioSeconds != 12.5 || sess.TotalCharacters != 40 || math.Abs(sess.TotalCost-0.1) > 1e-9 || sess.RequestCount != 2 {
+		t.Errorf("UpdateSessionTokens() = %+v, want 2 images, 12.5s of audio, 40 characters and a cost of 0.1 in 2 requests", sess)
+	}
+}
+
+func TestMemoryRepository_ToolCalls(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	first, _ := repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5, ToolCalls: map[string]int{"search": 2}})
+	repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5})
+	sess, err := repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5, ToolCalls: map[string]int{"search": 1, "get_weather": 1}})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	if want := map[string]int{"search": 3, "get_weather": 1}; sess.TotalToolCalls != 4 || !reflect.DeepEqual(sess.ToolCalls, want) {
+		t.Errorf("UpdateSessionTokens() tool calls = %d %v, want 4 %v", sess.TotalToolCalls, sess.ToolCalls, want)
+	}
+	if first.ToolCalls["search"] != 2 || len(first.ToolCalls) != 1 {
+		t.Errorf("earlier copy of the session changed to %v", first.ToolCalls)
+	}
+}
+
+func TestMemoryRepository_Transcripts(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.CreateSession("agent")
+	for _, text := range []string{"one", "two", "three"} {
+		err := repo.SaveTranscriptTurn(entities.TranscriptTurn{
+			SessionID:  "agent",
+			Path:       "/v1/chat/completions",
+			Model:      "gpt-4o",
+			Prompt:     json.RawMessage(`[{"role":"user","content":"` + text + `"}]`),
+			Completion: []json.RawMessage{json.RawMessage(`{"role":"assistant","content":"` + text + `"}`)},
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("SaveTranscriptTurn() error = %v", err)
+		}
+	}
+
+	turns, err := repo.ListTranscript("agent", 2)
+	if err != nil {
+		t.Fatalf("ListTranscript() error = %v", err)
+	}
+	if len(turns) != 2 || turns[0].ID >= turns[1].ID || turns[0].Model != "gpt-4o" ||
+		string(turns[0].Prompt) != `[{"role":"user","content":"two"}]` ||
+		len(turns[1].Completion) != 1 || string(turns[1].Completion[0]) != `{"role":"assistant","content":"three"}` {
+		t.Errorf("ListTranscript() = %+v, want the last two turns, oldest first", turns)
+	}
+	if turns, _ := repo.ListTranscript("other", 10); turns == nil || len(turns) != 0 {
+		t.Errorf("ListTranscript(other) = %v, want no turns", turns)
+	}
+
+	// The transcript is deleted with its session
+	if err := repo.DeleteSession("agent"); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if turns, _ := repo.ListTranscript("agent", 10); len(turns) != 0 {
+		t.Errorf("ListTranscript() after DeleteSession = %+v, want none", turns)
+	}
+}
+
+func TestMemoryRepository_DeleteSession(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	repo.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 5})
+	if err := repo.DeleteSession("s1"); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := repo.GetSession("s1"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("GetSession() after delete error = %v, want ErrSessionNotFound", err)
+	}
+	if err := repo.DeleteSession("s1"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("DeleteSession() twice error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestMemoryRepository_SessionMetadata(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	if _, err := repo.SetSessionMetadata("s1", map[string]string{"team": "a"}); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("SetSessionMetadata() for a missing session error = %v, want ErrSessionNotFound", err)
+	}
+
+	repo.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 5})
+	if _, err := repo.SetSessionMetadata("s1", map[string]string{"stripe_customer_id": "cus_1", "team": "a"}); err != nil {
+		t.Fatalf("SetSessionMetadata() error = %v", err)
+	}
+	sess, err := repo.SetSessionMetadata("s1", map[string]string{"team": ""})
+	if err != nil {
+		t.Fatalf("SetSessionMetadata() error = %v", err)
+	}
+	if len(sess.Metadata) != 1 || sess.Metadata["stripe_customer_id"] != "cus_1" {
+		t.Errorf("SetSessionMetadata() metadata = %v, want only stripe_customer_id", sess.Metadata)
+	}
+
+	if err := repo.MarkSessionMetered("s1", 5); err != nil {
+		t.Fatalf("MarkSessionMetered() error = %v", err)
+	}
+	sess, err = repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.Metadata["stripe_customer_id"] != "cus_1" || sess.MeteredTokens != 5 {
+		t.Errorf("GetSession() = %+v, want the stored metadata and 5 metered tokens", sess)
+	}
+	if err := repo.MarkSessionMetered("missing", 1); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("MarkSessionMetered() for a missing session error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestMemoryRepository_RecordSessionResponse(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	failedAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	repo.RecordSessionResponse("s1", entities.SessionResponse{StatusCode: http.StatusOK})
+	repo.RecordSessionResponse("s1", entities.SessionResponse{StatusCode: http.StatusTooManyRequests, Error: "rate limited", ErrorType: entities.RateLimitErrorType, At: failedAt})
+	repo.RecordSessionResponse("s1", entities.SessionResponse{StatusCode: http.StatusOK, At: failedAt.Add(time.Minute)})
+
+	sess, err := repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.Responses2xx != 2 || sess.Responses4xx != 1 || sess.Responses5xx != 0 {
+		t.Errorf("GetSession() counts = (%d, %d, %d), want (2, 1, 0)", sess.Responses2xx, sess.Responses4xx, sess.Responses5xx)
+	}
+	if sess.LastError != "rate limited" || sess.LastErrorAt == nil || !sess.LastErrorAt.Equal(failedAt) {
+		t.Errorf("GetSession() last error = (%q, %v), want (%q, %v)", sess.LastError, sess.LastErrorAt, "rate limited", failedAt)
+	}
+	if sess.ErrorTypes[entities.RateLimitErrorType] != 1 || len(sess.ErrorTypes) != 1 {
+		t.Errorf("GetSession() ErrorTypes = %v, want one rate_limit_error", sess.ErrorTypes)
+	}
+}
+
+func TestMemoryRepository_Jobs(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	if _, err := repo.GetJob("missing"); !errors.Is(err, entities.ErrJobNotFound) {
+		t.Fatalf("GetJob(missing) error = %v, want %v", err, entities.ErrJobNotFound)
+	}
+
+	job := entities.Job{ID: "job_1", Status: entities.JobStatusQueued, Path: "/v1/embeddings"}
+	if err := repo.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	if err := repo.CreateJob(job); err == nil {
+		t.Error("CreateJob() with duplicate ID succeeded, want error")
+	}
+
+	job.Status = entities.JobStatusFailed
+	job.Error = "upstream unreachable"
+	if err := repo.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob() error = %v", err)
+	}
+	got, err := repo.GetJob("job_1")
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, job) {
+		t.Errorf("GetJob() = %+v, want %+v", got, job)
+	}
+
+	if err := repo.UpdateJob(entities.Job{ID: "missing"}); !errors.Is(err, entities.ErrJobNotFound) {
+		t.Errorf("UpdateJob(missing) error = %v, want %v", err, entities.ErrJobNotFound)
+	}
+}
+
+func TestMemoryRepository_ShadowResults(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	for _, path := range []string{"/v1/a", "/v1/b", "/v1/c"} {
+		if err := repo.SaveShadowResult(entities.ShadowResult{Path: path}); err != nil {
+			t.Fatalf("SaveShadowResult() error = %v", err)
+		}
+	}
+
+	got, err := repo.ListShadowResults(2)
+	if err != nil {
+		t.Fatalf("ListShadowResults() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/v1/c" || got[1].Path != "/v1/b" {
+		t.Errorf("ListShadowResults(2) = %+v, want the two newest results", got)
+	}
+}
+
+func TestMemoryRepository_RequestHistory(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+
+	for _, sessionID := range []string{"s1", "s2", "s1"} {
+		if err := repo.SaveRequestRecord(entities.RequestRecord{SessionID: sessionID, Path: "/v1/chat/completions"}); err != nil {
+			t.Fatalf("SaveRequestRecord() error = %v", err)
+		}
+	}
+
+	got, err := repo.ListRequestRecords(entities.HistoryQuery{SessionID: "s1", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRequestRecords() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != 3 || got[1].ID != 1 {
+		t.Errorf("ListRequestRecords(s1) = %+v, want records 3 and 1", got)
+	}
+	all, _ := repo.ListRequestRecords(entities.HistoryQuery{Limit: 2})
+	if len(all) != 2 || all[0].ID != 3 || all[1].ID != 2 {
+		t.Errorf("ListRequestRecords(limit 2) = %+v, want records 3 and 2", all)
+	}
+}
+
+func TestMemoryRepository_GetRequestRecord(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, replayOf := range []int64{0, 1, 0, 1} {
+		repo.SaveRequestRecord(entities.RequestRecord{Path: "/v1/chat/completions", ReplayOf: replayOf})
+	}
+
+	got, err := repo.GetRequestRecord(2)
+	if err != nil || got.ID != 2 || got.ReplayOf != 1 {
+		t.Errorf("GetRequestRecord(2) = %+v, %v, want the first replay", got, err)
+	}
+	if _, err := repo.GetRequestRecord(5); !errors.Is(err, entities.ErrRequestRecordNotFound) {
+		t.Errorf("GetRequestRecord(5) error = %v, want ErrRequestRecordNotFound", err)
+	}
+	replays, _ := repo.ListRequestRecords(entities.HistoryQuery{ReplayOf: 1, Limit: 10})
+	if len(replays) != 2 || replays[0].ID != 4 || replays[1].ID != 2 {
+		t.Errorf("ListRequestRecords(replay_of 1) = %+v, want records 4 and 2", replays)
+	}
+}
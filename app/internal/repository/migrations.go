@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationName matches migration files such as 0002_add_cost.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// migration is a versioned schema change. Each SQL backend keeps its
+// migrations in migrations/<dialect>/ as NNNN_name.sql files.
+type migration struct {
+	version int
+	name    string
+	sql     string
+	// after runs in the migration's transaction once its SQL has been applied
+	after func(tx *sql.Tx) error
+}
+
+// loadMigrations reads the migrations in dir, ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, want NNNN_name.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version == 0 {
+			return nil, fmt.Errorf("invalid migration file name %q, versions start at 1", entry.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %q and %q have the same version", other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, migration{version: version, name: match[2], sql: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// applyMigrations applies the migrations not yet recorded in schema_migrations,
+// each in its own transaction. Placeholder returns the dialect's bind
+// parameter for the nth argument ("?" for SQLite, "$n" for Postgres).
+func applyMigrations(db *sql.DB, migrations []migration, placeholder func(n int) string) error {
+	_, err := db.Exec(`
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TIMESTAMP NOT NULL
+    );`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	insert := fmt.Sprintf(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s);`,
+		placeholder(1), placeholder(2), placeholder(3))
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m, insert); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.version, m.name)
+	}
+	return nil
+}
+
+// applyMigration runs a single migration and records it
+func applyMigration(db *sql.DB, m migration, insert string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+	if m.after != nil {
+		if err := m.after(tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(insert, m.version, m.name, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest applied migration version, or 0
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations;`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,72 @@
+-- Schema as of the introduction of versioned migrations. Databases created
+-- before then are upgraded to it by the SQLite repository when this runs.
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id TEXT PRIMARY KEY,
+    total_prompt_tokens INTEGER DEFAULT 0,
+    total_completion_tokens INTEGER DEFAULT 0,
+    total_tokens INTEGER DEFAULT 0,
+    request_count INTEGER DEFAULT 0,
+    estimated_tokens INTEGER DEFAULT 0,
+    responses_2xx INTEGER DEFAULT 0,
+    responses_4xx INTEGER DEFAULT 0,
+    responses_5xx INTEGER DEFAULT 0,
+    last_error TEXT DEFAULT '',
+    last_error_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS response_cache (
+    cache_key TEXT PRIMARY KEY,
+    body BLOB NOT NULL,
+    content_type TEXT DEFAULT '',
+    content_encoding TEXT DEFAULT '',
+    prompt_tokens INTEGER DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    session_id TEXT DEFAULT '',
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    request_headers TEXT DEFAULT '{}',
+    request_body BLOB,
+    response_status INTEGER DEFAULT 0,
+    response_body BLOB,
+    response_content_type TEXT DEFAULT '',
+    error TEXT DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS shadow_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    path TEXT NOT NULL,
+    primary_model TEXT DEFAULT '',
+    shadow_model TEXT DEFAULT '',
+    primary_status INTEGER DEFAULT 0,
+    shadow_status INTEGER DEFAULT 0,
+    primary_latency_ms INTEGER DEFAULT 0,
+    shadow_latency_ms INTEGER DEFAULT 0,
+    primary_body TEXT DEFAULT '',
+    shadow_body TEXT DEFAULT '',
+    shadow_error TEXT DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS request_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT DEFAULT '',
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    model TEXT DEFAULT '',
+    status_code INTEGER DEFAULT 0,
+    error TEXT DEFAULT '',
+    moderation TEXT DEFAULT '',
+    queue_wait_ms INTEGER DEFAULT 0,
+    upstream_latency_ms INTEGER DEFAULT 0,
+    total_ms INTEGER DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_request_history_session ON request_history (session_id, id);
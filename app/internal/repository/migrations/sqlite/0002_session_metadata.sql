@@ -0,0 +1,4 @@
+-- Free-form session metadata (a JSON object of strings), e.g. the billing
+-- customer, and the session's total tokens already reported for billing.
+ALTER TABLE sessions ADD COLUMN metadata TEXT DEFAULT '';
+ALTER TABLE sessions ADD COLUMN metered_tokens INTEGER DEFAULT 0;
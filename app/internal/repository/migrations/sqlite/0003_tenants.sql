@@ -0,0 +1,20 @@
+-- Tenants, the hashes of their virtual keys, and the tenant of each job.
+CREATE TABLE IF NOT EXISTS tenants (
+    id TEXT PRIMARY KEY,
+    name TEXT DEFAULT '',
+    upstream_api_key TEXT DEFAULT '',
+    requests_per_minute INTEGER DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS virtual_keys (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT DEFAULT '',
+    key_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_virtual_keys_tenant_id ON virtual_keys (tenant_id);
+
+ALTER TABLE jobs ADD COLUMN tenant_id TEXT DEFAULT '';
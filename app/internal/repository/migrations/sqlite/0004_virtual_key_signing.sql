@@ -0,0 +1,2 @@
+-- HMAC secret shared with clients that sign their requests with a virtual key.
+ALTER TABLE virtual_keys ADD COLUMN signing_secret TEXT DEFAULT '';
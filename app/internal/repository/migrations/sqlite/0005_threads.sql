@@ -0,0 +1,11 @@
+-- Assistants API threads mapped to sessions, and the runs whose usage was counted.
+CREATE TABLE IF NOT EXISTS thread_sessions (
+    thread_id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS accounted_runs (
+    run_id TEXT PRIMARY KEY,
+    accounted_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Usage of endpoints that are not billed in tokens (images, transcription
+-- seconds, speech characters) and the priced cost of a session's usage.
+ALTER TABLE sessions ADD COLUMN total_images INTEGER DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN total_audio_seconds REAL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN total_characters INTEGER DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN total_cost REAL DEFAULT 0;
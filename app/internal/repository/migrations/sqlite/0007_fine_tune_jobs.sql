@@ -0,0 +1,13 @@
+-- Fine-tuning jobs polled until they finish, and the trained tokens of the
+-- finished jobs of each session.
+CREATE TABLE IF NOT EXISTS fine_tune_jobs (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    model TEXT NOT NULL,
+    status TEXT NOT NULL,
+    trained_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+ALTER TABLE sessions ADD COLUMN total_trained_tokens INTEGER DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Request and response bodies captured in the request history (a JSON object).
+ALTER TABLE request_history ADD COLUMN capture TEXT DEFAULT '';
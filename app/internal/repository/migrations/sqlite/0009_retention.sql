@@ -0,0 +1,6 @@
+-- The time of each session's last request, for expiring idle sessions.
+-- Existing sessions count as active when the migration runs.
+ALTER TABLE sessions ADD COLUMN last_active_at TIMESTAMP;
+UPDATE sessions SET last_active_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_request_history_created ON request_history (created_at);
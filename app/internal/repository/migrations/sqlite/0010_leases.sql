@@ -0,0 +1,7 @@
+-- Leases electing the instance that runs background tasks when several
+-- instances share the database.
+CREATE TABLE IF NOT EXISTS leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
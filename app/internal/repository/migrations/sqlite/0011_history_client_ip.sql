@@ -0,0 +1,2 @@
+-- The address of the client that sent each recorded request
+ALTER TABLE request_history ADD COLUMN client_ip TEXT DEFAULT '';
@@ -0,0 +1,5 @@
+-- Upstream API keys of a virtual key, as a JSON array; empty for keys using
+-- their tenant's upstream key
+ALTER TABLE virtual_keys ADD COLUMN upstream_api_keys TEXT DEFAULT '';
+-- The virtual key a job was submitted with
+ALTER TABLE jobs ADD COLUMN virtual_key_id TEXT DEFAULT '';
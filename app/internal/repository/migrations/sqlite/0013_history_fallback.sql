@@ -0,0 +1,2 @@
+-- The retry of a request blocked by the upstream's content filter, as JSON
+ALTER TABLE request_history ADD COLUMN fallback TEXT DEFAULT '';
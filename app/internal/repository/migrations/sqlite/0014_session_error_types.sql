@@ -0,0 +1,2 @@
+-- Upstream error counts of a session by error type, as a JSON object
+ALTER TABLE sessions ADD COLUMN error_types TEXT DEFAULT '';
@@ -0,0 +1,4 @@
+-- Tool calls requested by the model in a session's responses, and their
+-- counts by function name as a JSON object
+ALTER TABLE sessions ADD COLUMN total_tool_calls INTEGER DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN tool_calls TEXT DEFAULT '';
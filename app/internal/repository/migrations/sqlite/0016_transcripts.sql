@@ -0,0 +1,13 @@
+-- Conversation turns of the sessions that opted into capture. The prompt is a
+-- JSON value and the completion a JSON array.
+CREATE TABLE IF NOT EXISTS transcripts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL,
+    path TEXT NOT NULL,
+    model TEXT DEFAULT '',
+    prompt TEXT NOT NULL,
+    completion TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transcripts_session ON transcripts (session_id, id);
@@ -0,0 +1,3 @@
+-- ID of the request record a replayed request was re-sent from
+ALTER TABLE request_history ADD COLUMN replay_of INTEGER DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_request_history_replay ON request_history (replay_of);
@@ -0,0 +1,10 @@
+-- Token budget moved between session IDs or tags; the net amount per key is
+-- added to its configured budget
+CREATE TABLE IF NOT EXISTS budget_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_key TEXT NOT NULL,
+    to_key TEXT NOT NULL,
+    tokens INTEGER NOT NULL,
+    reason TEXT DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
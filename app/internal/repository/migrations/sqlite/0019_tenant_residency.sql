@@ -0,0 +1,2 @@
+-- Region a tenant's requests must be processed in; empty allows any
+ALTER TABLE tenants ADD COLUMN residency TEXT DEFAULT '';
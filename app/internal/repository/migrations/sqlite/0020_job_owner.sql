@@ -0,0 +1,2 @@
+-- Instance that runs a job, so a restarting instance recovers only its own jobs
+ALTER TABLE jobs ADD COLUMN owner TEXT DEFAULT '';
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_cost.sql": {Data: []byte("ALTER TABLE t ADD COLUMN cost REAL;")},
+		"m/0001_initial.sql":  {Data: []byte("CREATE TABLE t (id INTEGER);")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations() error = %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].version != 1 || migrations[1].version != 2 || migrations[1].name != "add_cost" {
+		t.Errorf("loadMigrations() = %+v, want versions 1 and 2 in order", migrations)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":          {"m/initial.sql": {}},
+		"version zero":      {"m/0000_initial.sql": {}},
+		"duplicate version": {"m/0001_a.sql": {}, "m/1_b.sql": {}},
+	}
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadMigrations(fsys, "m"); err == nil {
+				t.Error("loadMigrations() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestApplyMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close()
+	placeholder := func(int) string { return "?" }
+
+	first := []migration{{version: 1, name: "initial", sql: "CREATE TABLE t (id INTEGER);"}}
+	if err := applyMigrations(db, first, placeholder); err != nil {
+		t.Fatalf("applyMigrations() error = %v", err)
+	}
+
+	// Applied migrations are skipped; a failing migration is rolled back and not recorded
+	failing := append(first,
+		migration{version: 2, name: "add_cost", sql: "ALTER TABLE t ADD COLUMN cost REAL;"},
+		migration{version: 3, name: "broken", sql: "ALTER TABLE missing ADD COLUMN x INTEGER;"},
+	)
+	if err := applyMigrations(db, failing, placeholder); err == nil {
+		t.Fatal("applyMigrations() error = nil, want the broken migration to fail")
+	}
+	version, err := schemaVersion(db)
+	if err != nil || version != 2 {
+		t.Errorf("schemaVersion() = (%d, %v), want (2, nil)", version, err)
+	}
+	if _, err := db.Exec("INSERT INTO t (id, cost) VALUES (1, 0.5);"); err != nil {
+		t.Errorf("migration 2 not applied: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
 
@@ -16,4 +18,259 @@ type Repository interface {
 	CreateSession(sessionID string) (*entities.SessionData, error)
 	UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
 	ListSessions() (map[string]*entities.SessionData, error)
+	// DeleteSession returns entities.ErrSessionNotFound if the session does not exist
+	DeleteSession(sessionID string) error
+	// RecordSessionResponse counts a response by status class, creating the session if needed
+	RecordSessionResponse(sessionID string, response entities.SessionResponse) error
+	// SetSessionMetadata merges metadata into a session's metadata; keys with
+	// empty values are removed. It returns entities.ErrSessionNotFound if the
+	// session does not exist.
+	SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error)
+	// MarkSessionMetered records how many of a session's tokens have been reported for billing
+	MarkSessionMetered(sessionID string, meteredTokens int) error
+}
+
+// CacheRepository stores cached upstream responses.
+type CacheRepository interface {
+	// GetCacheEntry returns the entry for key, or nil if there is none.
+	GetCacheEntry(key string) (*entities.CacheEntry, error)
+	PutCacheEntry(entry entities.CacheEntry) error
+}
+
+// JobRepository stores asynchronous jobs.
+type JobRepository interface {
+	CreateJob(job entities.Job) error
+	// UpdateJob replaces the stored state of an existing job.
+	UpdateJob(job entities.Job) error
+	// GetJob returns entities.ErrJobNotFound if the job does not exist.
+	GetJob(id string) (*entities.Job, error)
+	// ListPendingJobs returns queued and running jobs, oldest first.
+	ListPendingJobs() ([]entities.Job, error)
+}
+
+// ShadowRepository stores the results of shadow traffic for comparison.
+type ShadowRepository interface {
+	SaveShadowResult(result entities.ShadowResult) error
+	// ListShadowResults returns up to limit results, newest first.
+	ListShadowResults(limit int) ([]entities.ShadowResult, error)
+}
+
+// HistoryRepository stores the request history.
+type HistoryRepository interface {
+	// SaveRequestRecord stores a record, assigning its ID.
+	SaveRequestRecord(record entities.RequestRecord) error
+	// ListRequestRecords returns up to query.Limit matching records, newest first.
+	ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error)
+	// GetRequestRecord returns the record with the given ID, or
+	// entities.ErrRequestRecordNotFound.
+	GetRequestRecord(id int64) (*entities.RequestRecord, error)
+	// DeleteCapturedBodies removes the captured bodies of records created
+	// before the given time, keeping the records, and returns how many it cleared.
+	DeleteCapturedBodies(before time.Time) (int, error)
+}
+
+// SessionMergeRepository moves the usage and history of one session to another.
+type SessionMergeRepository interface {
+	// MergeSessions adds the source session's usage to the target, creating it
+	// if needed, reassigns the source's request history, transcripts, jobs,
+	// threads and fine-tuning jobs to the target, and deletes the source. It
+	// returns the merged target, or entities.ErrSessionNotFound if the source
+	// does not exist.
+	MergeSessions(sourceID, targetID string) (*entities.SessionData, error)
+}
+
+// SessionImportRepository stores sessions exported from another deployment.
+type SessionImportRepository interface {
+	// ImportSession stores a session with its usage and metadata as they are.
+	// An existing session is replaced if overwrite is set and left alone
+	// otherwise; it reports whether the session was stored. Imported sessions
+	// count as active at the time of the import.
+	ImportSession(sess entities.SessionData, overwrite bool) (bool, error)
+}
+
+// BudgetRepository stores the transfers of token budget between sessions and tags.
+type BudgetRepository interface {
+	// SaveBudgetTransfer stores a transfer and returns it with its ID.
+	SaveBudgetTransfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error)
+	// ListBudgetTransfers returns up to limit transfers, newest first.
+	ListBudgetTransfers(limit int) ([]entities.BudgetTransfer, error)
+	// BudgetAdjustments returns the net amount transferred to each key.
+	BudgetAdjustments() (map[string]int, error)
+}
+
+// TranscriptRepository stores the conversations of sessions that opted into
+// capture. A session's turns are deleted with the session.
+type TranscriptRepository interface {
+	// SaveTranscriptTurn stores a turn, assigning its ID.
+	SaveTranscriptTurn(turn entities.TranscriptTurn) error
+	// ListTranscript returns up to limit of a session's latest turns, oldest first.
+	ListTranscript(sessionID string, limit int) ([]entities.TranscriptTurn, error)
+}
+
+// TenantRepository stores tenants and their virtual keys.
+type TenantRepository interface {
+	// CreateTenant returns entities.ErrTenantExists if the ID is taken.
+	CreateTenant(tenant entities.Tenant) error
+	// UpdateTenant replaces a tenant; it returns entities.ErrTenantNotFound if it does not exist.
+	UpdateTenant(tenant entities.Tenant) error
+	GetTenant(id string) (*entities.Tenant, error)
+	// ListTenants returns all tenants ordered by ID.
+	ListTenants() ([]entities.Tenant, error)
+	// DeleteTenant removes a tenant and its virtual keys.
+	DeleteTenant(id string) error
+
+	CreateVirtualKey(key entities.VirtualKey) error
+	// UpdateVirtualKey replaces the name and upstream keys of a tenant's key;
+	// it returns entities.ErrVirtualKeyNotFound if it does not exist.
+	UpdateVirtualKey(key entities.VirtualKey) error
+	// GetVirtualKey returns entities.ErrVirtualKeyNotFound for unknown IDs.
+	GetVirtualKey(id string) (*entities.VirtualKey, error)
+	// GetVirtualKeyByHash returns entities.ErrVirtualKeyNotFound for unknown keys.
+	GetVirtualKeyByHash(hash string) (*entities.VirtualKey, error)
+	// ListVirtualKeys returns a tenant's keys, oldest first.
+	ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error)
+	DeleteVirtualKey(tenantID, id string) error
+}
+
+// ThreadRepository maps Assistants API threads to the sessions their runs are
+// accounted to.
+type ThreadRepository interface {
+	// SetThreadSession maps a thread to a session, replacing any previous mapping.
+	SetThreadSession(threadID, sessionID string) error
+	// GetThreadSession returns entities.ErrThreadNotFound for unmapped threads.
+	GetThreadSession(threadID string) (string, error)
+	// DeleteThreadSession returns entities.ErrThreadNotFound for unmapped threads.
+	DeleteThreadSession(threadID string) error
+	// MarkRunAccounted records that the usage of a run was counted. It reports
+	// false if the run was already marked.
+	MarkRunAccounted(runID string) (bool, error)
+}
+
+// FineTuneRepository stores the fine-tuning jobs polled for their trained tokens.
+type FineTuneRepository interface {
+	// SaveFineTuneJob creates or replaces a job.
+	SaveFineTuneJob(job entities.FineTuneJob) error
+	// ListPendingFineTuneJobs returns jobs that have not finished, oldest first.
+	ListPendingFineTuneJobs() ([]entities.FineTuneJob, error)
+}
+
+// RetentionRepository deletes stored data once it expires. Each method returns
+// how many rows it deleted.
+type RetentionRepository interface {
+	// DeleteRequestRecordsBefore deletes request records created before the given time.
+	DeleteRequestRecordsBefore(before time.Time) (int, error)
+	// DeleteFinishedJobsBefore deletes completed and failed jobs last updated
+	// before the given time; queued and running jobs are kept.
+	DeleteFinishedJobsBefore(before time.Time) (int, error)
+	// DeleteIdleSessions deletes sessions without requests since the given time.
+	DeleteIdleSessions(before time.Time) (int, error)
+}
+
+// SummaryRepository aggregates and searches session statistics in the backend.
+type SummaryRepository interface {
+	// FindSessions returns the sessions the filter selects, keyed by session ID.
+	FindSessions(filter entities.SessionFilter) (map[string]*entities.SessionData, error)
+	// SummarizeGroup rolls up the usage of a tenant's sessions whose metadata
+	// key is set to id; an empty tenant covers all sessions.
+	SummarizeGroup(tenantID, key, id string) (*entities.SessionGroupUsage, error)
+	// SummarizeSessions returns the totals and top sessions of the sessions
+	// the query selects. Only sessions with responses are ranked by error rate.
+	SummarizeSessions(query entities.SessionSummaryQuery) (*entities.SessionSummary, error)
+}
+
+// LeaseRepository stores the leases that coordinate instances sharing the repository.
+type LeaseRepository interface {
+	// AcquireLease grants or renews a lease unless another holder's lease on the
+	// name is still valid at now. It reports whether the lease is held.
+	AcquireLease(lease entities.Lease, now time.Time) (bool, error)
+	// ReleaseLease gives up a lease if it is still held by holder.
+	ReleaseLease(name, holder string) error
+}
+
+// Storage is implemented by each backend and combines all repository interfaces.
+type Storage interface {
+	Repository
+	CacheRepository
+	JobRepository
+	ShadowRepository
+	HistoryRepository
+	TranscriptRepository
+	BudgetRepository
+	SessionMergeRepository
+	SessionImportRepository
+	TenantRepository
+	ThreadRepository
+	FineTuneRepository
+	RetentionRepository
+	LeaseRepository
+	SummaryRepository
+}
+
+// mergeSessionData adds the usage and statistics of source to target. The
+// most recent error wins, and the target's metadata wins over the source's.
+func mergeSessionData(target, source *entities.SessionData) {
+	target.TotalPromptTokens += source.TotalPromptTokens
+	target.TotalCompletionTokens += source.TotalCompletionTokens
+	target.TotalTokens += source.TotalTokens
+	target.RequestCount += source.RequestCount
+	target.EstimatedTokens += source.EstimatedTokens
+	target.Responses2xx += source.Responses2xx
+	target.Responses4xx += source.Responses4xx
+	target.Responses5xx += source.Responses5xx
+	if source.LastErrorAt != nil && (target.LastErrorAt == nil || source.LastErrorAt.After(*target.LastErrorAt)) {
+		target.LastError, target.LastErrorAt = source.LastError, source.LastErrorAt
+	}
+	target.ErrorTypes = addCounts(target.ErrorTypes, source.ErrorTypes)
+	for key, value := range source.Metadata {
+		if _, ok := target.Metadata[key]; !ok {
+			if target.Metadata == nil {
+				target.Metadata = make(map[string]string)
+			}
+			target.Metadata[key] = value
+		}
+	}
+	target.MeteredTokens += source.MeteredTokens
+	target.TotalImages += source.TotalImages
+	target.TotalAudioSeconds += source.TotalAudioSeconds
+	target.TotalCharacters += source.TotalCharacters
+	target.TotalTrainedTokens += source.TotalTrainedTokens
+	target.TotalToolCalls += source.TotalToolCalls
+	target.ToolCalls = addCounts(target.ToolCalls, source.ToolCalls)
+	target.TotalCost += source.TotalCost
+}
+
+// addCounts returns a new map with the counts of b added to those of a, or
+// nil if both are empty
+func addCounts(a, b map[string]int) map[string]int {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	sum := make(map[string]int, len(a)+len(b))
+	for key, n := range a {
+		sum[key] += n
+	}
+	for key, n := range b {
+		sum[key] += n
+	}
+	return sum
+}
+
+// mergeMetadata returns a new map with updates applied to current; keys with
+// empty values are removed. It returns nil if no keys remain.
+func mergeMetadata(current, updates map[string]string) map[string]string {
+	merged := make(map[string]string, len(current)+len(updates))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range updates {
+		if value == "" {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
 }
@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_ImportSession(t *testing.T) {
+	testSessionImportRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_ImportSession(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testSessionImportRepository(t, repo)
+}
+
+func testSessionImportRepository(t *testing.T, repo repository.Storage) {
+	t.Helper()
+
+	lastErrorAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	exported := entities.SessionData{
+		SessionID: "agent-1", TotalPromptTokens: 100, TotalCompletionTokens: 50, TotalTokens: 150, RequestCount: 4,
+		EstimatedTokens: 20, Responses2xx: 3, Responses5xx: 1, LastError: "bad gateway", LastErrorAt: &lastErrorAt,
+		ErrorTypes: map[string]int{"server_error": 1}, Metadata: map[string]string{"default_model": "gpt-4o"},
+		MeteredTokens: 100, TotalImages: 2, TotalAudioSeconds: 1.5, TotalCharacters: 30, TotalTrainedTokens: 7,
+		TotalToolCalls: 2, ToolCalls: map[string]int{"search": 2}, TotalCost: 0.25,
+	}
+	if imported, err := repo.ImportSession(exported, false); err != nil || !imported {
+		t.Fatalf("ImportSession() = %v, %v, want the session imported", imported, err)
+	}
+	stored, err := repo.GetSession("agent-1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if !stored.LastErrorAt.Equal(lastErrorAt) {
+		t.Errorf("LastErrorAt = %v, want %v", stored.LastErrorAt, lastErrorAt)
+	}
+	stored.LastErrorAt = exported.LastErrorAt
+	if !reflect.DeepEqual(*stored, exported) {
+		t.Errorf("GetSession() = %+v, want %+v", *stored, exported)
+	}
+
+	// Existing sessions are only replaced with overwrite
+	replacement := entities.SessionData{SessionID: "agent-1", TotalTokens: 1}
+	if imported, err := repo.ImportSession(replacement, false); err != nil || imported {
+		t.Errorf("ImportSession() of an existing session = %v, %v, want it skipped", imported, err)
+	}
+	if stored, _ := repo.GetSession("agent-1"); stored.TotalTokens != 150 {
+		t.Errorf("TotalTokens = %d after a skipped import, want 150", stored.TotalTokens)
+	}
+	if imported, err := repo.ImportSession(replacement, true); err != nil || !imported {
+		t.Errorf("ImportSession() with overwrite = %v, %v, want it replaced", imported, err)
+	}
+	if stored, _ := repo.GetSession("agent-1"); stored.TotalTokens != 1 || stored.Metadata != nil {
+		t.Errorf("GetSession() after overwrite = %+v, want the replacement", stored)
+	}
+}
@@ -0,0 +1,84 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_MergeSessions(t *testing.T) {
+	testSessionMergeRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_MergeSessions(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testSessionMergeRepository(t, repo)
+}
+
+func testSessionMergeRepository(t *testing.T, repo repository.Storage) {
+	t.Helper()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo.UpdateSessionTokens("old", entities.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: 0.5,
+		ToolCalls: map[string]int{"search": 1}})
+	repo.RecordSessionResponse("old", entities.SessionResponse{StatusCode: http.StatusTooManyRequests, Error: "slow down", ErrorType: "rate_limit", At: now})
+	repo.SetSessionMetadata("old", map[string]string{"default_model": "gpt-4o-mini", "user_id": "u1"})
+	repo.UpdateSessionTokens("new", entities.TokenUsage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, Cost: 1,
+		ToolCalls: map[string]int{"search": 2, "fetch": 1}})
+	repo.SetSessionMetadata("new", map[string]string{"default_model": "gpt-4o"})
+
+	repo.SaveRequestRecord(entities.RequestRecord{SessionID: "old", Method: http.MethodPost, Path: "/v1/chat/completions", CreatedAt: now})
+	repo.SaveTranscriptTurn(entities.TranscriptTurn{SessionID: "old", Path: "/v1/chat/completions", Prompt: json.RawMessage(`[]`),
+		Completion: []json.RawMessage{json.RawMessage(`"hi"`)}, CreatedAt: now})
+	repo.CreateJob(entities.Job{ID: "job-1", Status: entities.JobStatusQueued, SessionID: "old", Method: http.MethodPost,
+		Path: "/v1/chat/completions", CreatedAt: now, UpdatedAt: now})
+	repo.SetThreadSession("thread_1", "old")
+	repo.SaveFineTuneJob(entities.FineTuneJob{ID: "ftjob-1", SessionID: "old", Model: "gpt-4o-mini", Status: "running", CreatedAt: now})
+
+	merged, err := repo.MergeSessions("old", "new")
+	if err != nil {
+		t.Fatalf("MergeSessions() error = %v", err)
+	}
+	if merged.TotalTokens != 45 || merged.TotalPromptTokens != 30 || merged.RequestCount != 2 || merged.TotalCost != 1.5 ||
+		merged.Responses4xx != 1 || merged.LastError != "slow down" || merged.ErrorTypes["rate_limit"] != 1 ||
+		merged.TotalToolCalls != 4 || merged.ToolCalls["search"] != 3 || merged.ToolCalls["fetch"] != 1 ||
+		merged.Metadata["default_model"] != "gpt-4o" || merged.Metadata["user_id"] != "u1" {
+		t.Errorf("MergeSessions() = %+v", merged)
+	}
+	if stored, err := repo.GetSession("new"); err != nil || stored.TotalTokens != 45 || stored.Metadata["user_id"] != "u1" {
+		t.Errorf("GetSession(new) = %+v, %v, want the merged session", stored, err)
+	}
+	if _, err := repo.GetSession("old"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("GetSession(old) error = %v, want ErrSessionNotFound", err)
+	}
+
+	if records, _ := repo.ListRequestRecords(entities.HistoryQuery{SessionID: "new", Limit: 10}); len(records) != 1 {
+		t.Errorf("history of the target = %+v, want the source's record", records)
+	}
+	if turns, _ := repo.ListTranscript("new", 10); len(turns) != 1 || turns[0].SessionID != "new" {
+		t.Errorf("transcript of the target = %+v, want the source's turn", turns)
+	}
+	if job, _ := repo.GetJob("job-1"); job == nil || job.SessionID != "new" {
+		t.Errorf("GetJob() = %+v, want it in the target", job)
+	}
+	if sessionID, _ := repo.GetThreadSession("thread_1"); sessionID != "new" {
+		t.Errorf("GetThreadSession() = %q, want new", sessionID)
+	}
+	if jobs, _ := repo.ListPendingFineTuneJobs(); len(jobs) != 1 || jobs[0].SessionID != "new" {
+		t.Errorf("ListPendingFineTuneJobs() = %+v, want the job in the target", jobs)
+	}
+
+	// Merging into a new ID renames the session
+	if merged, err := repo.MergeSessions("new", "renamed"); err != nil || merged.TotalTokens != 45 {
+		t.Errorf("MergeSessions(renamed) = %+v, %v", merged, err)
+	}
+	if _, err := repo.MergeSessions("missing", "renamed"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("MergeSessions(missing) error = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent snapshot of the database to path with the SQLite
+// online backup API. An existing file at path is overwritten; writes made
+// while the backup runs are not included.
+func (r *SQLiteRepository) Backup(path string) error {
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer dst.Close()
+
+	if err := copyDatabase(dst, r.db); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the database with the snapshot at path
+// and applies the migrations the snapshot predates. The proxy must not be
+// serving from the database while it is restored.
+func (r *SQLiteRepository) Restore(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer src.Close()
+
+	// Snapshots of other databases would replace the sessions with unrelated tables
+	if _, err := schemaVersion(src); err != nil {
+		return fmt.Errorf("%s is not a backup of the proxy's database: %w", path, err)
+	}
+	if err := copyDatabase(r.db, src); err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	return r.Init()
+}
+
+// copyDatabase copies the main database of src over the main database of dst
+func copyDatabase(dst, src *sql.DB) error {
+	ctx := context.Background()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dstSQLite, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backups require the go-sqlite3 driver")
+			}
+			backup, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			// A step of -1 copies every page under a single read lock
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
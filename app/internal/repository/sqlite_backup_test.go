@@ -0,0 +1,54 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestSQLiteRepository_BackupAndRestore(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := repo.UpdateSessionTokens("agent-1", entities.TokenUsage{TotalTokens: 15}); err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := repo.Backup(path); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	// Changes after the backup are undone by restoring it
+	repo.UpdateSessionTokens("agent-2", entities.TokenUsage{TotalTokens: 2})
+	repo.DeleteSession("agent-1")
+	if err := repo.Restore(path); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	sessions, err := repo.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions["agent-1"] == nil || sessions["agent-1"].TotalTokens != 15 {
+		t.Errorf("sessions after Restore() = %v, want only agent-1 with 15 tokens", sessions)
+	}
+}
+
+func TestSQLiteRepository_RestoreRejectsOtherFiles(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo.UpdateSessionTokens("agent-1", entities.TokenUsage{TotalTokens: 15})
+
+	dir := t.TempDir()
+	notADatabase := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notADatabase, []byte("not a database"), 0o600)
+	for _, path := range []string{filepath.Join(dir, "missing.db"), notADatabase} {
+		if err := repo.Restore(path); err == nil {
+			t.Errorf("Restore(%s) error = nil, want an error", path)
+		}
+	}
+	if _, err := repo.GetSession("agent-1"); err != nil {
+		t.Errorf("GetSession() after rejected restores error = %v", err)
+	}
+}
@@ -3,8 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -32,25 +35,155 @@ func NewSQLiteRepository(dsn string) (*SQLiteRepository, error) {
 	return &SQLiteRepository{db: db, dsn: dsn}, nil
 }
 
-// Init initializes the SQLite repository, creating the necessary tables if they don't exist.
-func (r *SQLiteRepository) Init() error {
-	query := `
-    CREATE TABLE IF NOT EXISTS sessions (
-        session_id TEXT PRIMARY KEY,
-        total_prompt_tokens INTEGER DEFAULT 0,
-        total_completion_tokens INTEGER DEFAULT 0,
-        total_tokens INTEGER DEFAULT 0,
-        request_count INTEGER DEFAULT 0
-    );`
+// sessionColumns lists the sessions table columns in the order scanned by scanSession
+const sessionColumns = `session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count, estimated_tokens,
+    responses_2xx, responses_4xx, responses_5xx, last_error, last_error_at, metadata, metered_tokens,
+    total_images, total_audio_seconds, total_characters, total_cost, total_trained_tokens, error_types,
+    total_tool_calls, tool_calls`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row rowScanner) (*entities.SessionData, error) {
+	var (
+		sess        entities.SessionData
+		lastErrorAt sql.NullTime
+		metadata    sql.NullString
+		errorTypes  sql.NullString
+		toolCalls   sql.NullString
+	)
+	err := row.Scan(
+		&sess.SessionID,
+		&sess.TotalPromptTokens,
+		&sess.TotalCompletionTokens,
+		&sess.TotalTokens,
+		&sess.RequestCount,
+		&sess.EstimatedTokens,
+		&sess.Responses2xx,
+		&sess.Responses4xx,
+		&sess.Responses5xx,
+		&sess.LastError,
+		&lastErrorAt,
+		&metadata,
+		&sess.MeteredTokens,
+		&sess.TotalImages,
+		&sess.TotalAudioSeconds,
+		&sess.TotalCharacters,
+		&sess.TotalCost,
+		&sess.TotalTrainedTokens,
+		&errorTypes,
+		&sess.TotalToolCalls,
+		&toolCalls,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastErrorAt.Valid {
+		sess.LastErrorAt = &lastErrorAt.Time
+	}
+	if metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &sess.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata of session %s: %w", sess.SessionID, err)
+		}
+	}
+	if errorTypes.String != "" {
+		if err := json.Unmarshal([]byte(errorTypes.String), &sess.ErrorTypes); err != nil {
+			return nil, fmt.Errorf("failed to decode error types of session %s: %w", sess.SessionID, err)
+		}
+	}
+	if toolCalls.String != "" {
+		if err := json.Unmarshal([]byte(toolCalls.String), &sess.ToolCalls); err != nil {
+			return nil, fmt.Errorf("failed to decode tool calls of session %s: %w", sess.SessionID, err)
+		}
+	}
+	return &sess, nil
+}
 
-	_, err := r.db.Exec(query)
+// Init initializes the SQLite repository, applying pending schema migrations.
+func (r *SQLiteRepository) Init() error {
+	migrations, err := loadMigrations(migrationFiles, "migrations/sqlite")
 	if err != nil {
-		return fmt.Errorf("failed to create sessions table: %w", err)
+		return err
+	}
+	for i := range migrations {
+		if migrations[i].version == 1 {
+			migrations[i].after = upgradeLegacySchema
+		}
+	}
+
+	if err := applyMigrations(r.db, migrations, func(int) string { return "?" }); err != nil {
+		return err
 	}
+
 	log.Println("SQLite sessions table initialized successfully.")
 	return nil
 }
 
+// SchemaVersion returns the version of the last applied migration.
+func (r *SQLiteRepository) SchemaVersion() (int, error) {
+	return schemaVersion(r.db)
+}
+
+// upgradeLegacySchema adds the columns introduced before versioned migrations
+// to tables created by earlier releases, which the initial migration's
+// CREATE TABLE IF NOT EXISTS statements leave untouched.
+func upgradeLegacySchema(tx *sql.Tx) error {
+	for _, column := range []struct{ table, name, definition string }{
+		{"sessions", "estimated_tokens", "INTEGER DEFAULT 0"},
+		{"sessions", "responses_2xx", "INTEGER DEFAULT 0"},
+		{"sessions", "responses_4xx", "INTEGER DEFAULT 0"},
+		{"sessions", "responses_5xx", "INTEGER DEFAULT 0"},
+		{"sessions", "last_error", "TEXT DEFAULT ''"},
+		{"sessions", "last_error_at", "TIMESTAMP"},
+		{"request_history", "queue_wait_ms", "INTEGER DEFAULT 0"},
+		{"request_history", "upstream_latency_ms", "INTEGER DEFAULT 0"},
+		{"request_history", "total_ms", "INTEGER DEFAULT 0"},
+	} {
+		if err := ensureColumn(tx, column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureColumn adds a column to an existing table if it is missing
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info for %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating table info for %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // Close closes the database connection.
 func (r *SQLiteRepository) Close() error {
 	if r.db != nil {
@@ -61,25 +194,17 @@ func (r *SQLiteRepository) Close() error {
 
 // GetSession retrieves session data for a given session ID.
 func (r *SQLiteRepository) GetSession(sessionID string) (*entities.SessionData, error) {
-	query := `SELECT session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count
-              FROM sessions WHERE session_id = ?;`
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?;`
 	row := r.db.QueryRow(query, sessionID)
 
-	var sess entities.SessionData
-	err := row.Scan(
-		&sess.SessionID,
-		&sess.TotalPromptTokens,
-		&sess.TotalCompletionTokens,
-		&sess.TotalTokens,
-		&sess.RequestCount,
-	)
+	sess, err := scanSession(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, entities.ErrSessionNotFound
 		}
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
-	return &sess, nil
+	return sess, nil
 }
 
 // CreateSession creates a new session with the given ID.
@@ -94,22 +219,20 @@ func (r *SQLiteRepository) CreateSession(sessionID string) (*entities.SessionDat
 
 	// Insert with default zero values, or do nothing if it already exists.
 	queryInsert := `
-    INSERT INTO sessions (session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count)
-    VALUES (?, 0, 0, 0, 0)
+    INSERT INTO sessions (session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count, last_active_at)
+    VALUES (?, 0, 0, 0, 0, ?)
     ON CONFLICT(session_id) DO NOTHING;`
 
-	_, err = tx.ExecContext(ctx, queryInsert, sessionID)
+	_, err = tx.ExecContext(ctx, queryInsert, sessionID, time.Now().UTC())
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert or ignore session: %w", err)
 	}
 
 	// Select the session (either existing or newly created with zeros).
-	querySelect := `SELECT session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count
-                     FROM sessions WHERE session_id = ?;`
+	querySelect := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?;`
 	row := tx.QueryRowContext(ctx, querySelect, sessionID)
 
-	var sess entities.SessionData
-	err = row.Scan(&sess.SessionID, &sess.TotalPromptTokens, &sess.TotalCompletionTokens, &sess.TotalTokens, &sess.RequestCount)
+	sess, err := scanSession(row)
 	if err != nil {
 		// This should not happen if INSERT OR IGNORE worked, unless DB is corrupted.
 		return nil, fmt.Errorf("failed to select session after create: %w", err)
@@ -119,7 +242,7 @@ func (r *SQLiteRepository) CreateSession(sessionID string) (*entities.SessionDat
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return &sess, nil
+	return sess, nil
 }
 
 // UpdateSessionTokens adds token usage to an existing session.
@@ -133,38 +256,300 @@ func (r *SQLiteRepository) UpdateSessionTokens(sessionID string, usage entities.
 	defer tx.Rollback()
 
 	queryUpsert := `
-    INSERT INTO sessions (session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count)
-    VALUES (?, ?, ?, ?, 1)
+    INSERT INTO sessions (session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count, estimated_tokens,
+        total_images, total_audio_seconds, total_characters, total_cost, total_trained_tokens, last_active_at)
+    VALUES (?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?, ?)
     ON CONFLICT(session_id) DO UPDATE SET
         total_prompt_tokens = sessions.total_prompt_tokens + excluded.total_prompt_tokens,
         total_completion_tokens = sessions.total_completion_tokens + excluded.total_completion_tokens,
         total_tokens = sessions.total_tokens + excluded.total_tokens,
-        request_count = sessions.request_count + 1;`
+        request_count = sessions.request_count + 1,
+        estimated_tokens = sessions.estimated_tokens + excluded.estimated_tokens,
+        total_images = sessions.total_images + excluded.total_images,
+        total_audio_seconds = sessions.total_audio_seconds + excluded.total_audio_seconds,
+        total_characters = sessions.total_characters + excluded.total_characters,
+        total_cost = sessions.total_cost + excluded.total_cost,
+        total_trained_tokens = sessions.total_trained_tokens + excluded.total_trained_tokens,
+        last_active_at = excluded.last_active_at;`
 
-	_, err = tx.ExecContext(ctx, queryUpsert, sessionID, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+	estimatedTokens := 0
+	if usage.Estimated {
+		estimatedTokens = usage.TotalTokens
+	}
+	_, err = tx.ExecContext(ctx, queryUpsert, sessionID, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, estimatedTokens,
+		usage.Images, usage.AudioSeconds, usage.Characters, usage.Cost, usage.TrainedTokens, time.Now().UTC())
 	if err != nil {
 		return nil, fmt.Errorf("failed to upsert session tokens: %w", err)
 	}
 
+	// Each function's calls are added under its key of the tool_calls JSON object
+	names := make([]string, 0, len(usage.ToolCalls))
+	for name := range usage.ToolCalls {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		path := `$."` + name + `"`
+		n := usage.ToolCalls[name]
+		_, err = tx.ExecContext(ctx, `
+    UPDATE sessions SET
+        total_tool_calls = total_tool_calls + ?,
+        tool_calls = json_set(COALESCE(NULLIF(tool_calls, ''), '{}'), ?, COALESCE(json_extract(NULLIF(tool_calls, ''), ?), 0) + ?)
+    WHERE session_id = ?;`, n, path, path, n, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add session tool calls: %w", err)
+		}
+	}
+
 	// After upserting, retrieve the updated session data
 	// This is similar to GetSession but within the same transaction
-	querySelect := `SELECT session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count
-                     FROM sessions WHERE session_id = ?;`
+	querySelect := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?;`
 	row := tx.QueryRowContext(ctx, querySelect, sessionID)
-	var sess entities.SessionData
-	if errScan := row.Scan(&sess.SessionID, &sess.TotalPromptTokens, &sess.TotalCompletionTokens, &sess.TotalTokens, &sess.RequestCount); errScan != nil {
+	sess, errScan := scanSession(row)
+	if errScan != nil {
 		return nil, fmt.Errorf("failed to select session after update: %w", errScan)
 	}
 
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
-	return &sess, nil
+	return sess, nil
+}
+
+// DeleteSession removes a session and its statistics.
+func (r *SQLiteRepository) DeleteSession(sessionID string) error {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE session_id = ?;`, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if deleted == 0 {
+		return entities.ErrSessionNotFound
+	}
+	if _, err := r.db.Exec(`DELETE FROM transcripts WHERE session_id = ?;`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session transcript: %w", err)
+	}
+	return nil
+}
+
+// MergeSessions adds the source session's usage to the target and moves its history.
+func (r *SQLiteRepository) MergeSessions(sourceID, targetID string) (*entities.SessionData, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	querySelect := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?;`
+	source, err := scanSession(tx.QueryRowContext(ctx, querySelect, sourceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get source session: %w", err)
+	}
+	target, err := scanSession(tx.QueryRowContext(ctx, querySelect, targetID))
+	if err == sql.ErrNoRows {
+		target, err = &entities.SessionData{SessionID: targetID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target session: %w", err)
+	}
+	mergeSessionData(target, source)
+
+	var lastActiveAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+    SELECT last_active_at FROM sessions WHERE session_id IN (?, ?)
+    ORDER BY last_active_at DESC LIMIT 1;`, sourceID, targetID).Scan(&lastActiveAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session activity: %w", err)
+	}
+	if _, err := writeSession(ctx, tx, "INSERT OR REPLACE", target, lastActiveAt); err != nil {
+		return nil, fmt.Errorf("failed to save merged session: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE session_id = ?;`, sourceID); err != nil {
+		return nil, fmt.Errorf("failed to delete merged session: %w", err)
+	}
+	for _, table := range []string{"request_history", "transcripts", "jobs", "thread_sessions", "fine_tune_jobs"} {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET session_id = ? WHERE session_id = ?;`, targetID, sourceID); err != nil {
+			return nil, fmt.Errorf("failed to reassign %s: %w", table, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return target, nil
+}
+
+// ImportSession stores an exported session.
+func (r *SQLiteRepository) ImportSession(sess entities.SessionData, overwrite bool) (bool, error) {
+	ctx := context.Background()
+	verb := "INSERT OR IGNORE"
+	if overwrite {
+		verb = "INSERT OR REPLACE"
+	}
+	imported, err := writeSession(ctx, r.db, verb, &sess, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+	if err != nil {
+		return false, fmt.Errorf("failed to import session: %w", err)
+	}
+	return imported, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// writeSession stores all the columns of a session with an INSERT OR REPLACE
+// or INSERT OR IGNORE statement, and reports whether a row was written
+func writeSession(ctx context.Context, db execer, verb string, sess *entities.SessionData, lastActiveAt sql.NullTime) (bool, error) {
+	var lastErrorAt sql.NullTime
+	if sess.LastErrorAt != nil {
+		lastErrorAt = sql.NullTime{Time: *sess.LastErrorAt, Valid: true}
+	}
+	metadata, err := encodeMap(sess.Metadata)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode session metadata: %w", err)
+	}
+	errorTypes, err := encodeMap(sess.ErrorTypes)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode error types: %w", err)
+	}
+	toolCalls, err := encodeMap(sess.ToolCalls)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode tool calls: %w", err)
+	}
+	query := verb + ` INTO sessions (` + sessionColumns + `, last_active_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	result, err := db.ExecContext(ctx, query, sess.SessionID, sess.TotalPromptTokens, sess.TotalCompletionTokens,
+		sess.TotalTokens, sess.RequestCount, sess.EstimatedTokens, sess.Responses2xx, sess.Responses4xx,
+		sess.Responses5xx, sess.LastError, lastErrorAt, metadata, sess.MeteredTokens, sess.TotalImages,
+		sess.TotalAudioSeconds, sess.TotalCharacters, sess.TotalCost, sess.TotalTrainedTokens, errorTypes,
+		sess.TotalToolCalls, toolCalls, lastActiveAt)
+	if err != nil {
+		return false, err
+	}
+	written, err := result.RowsAffected()
+	return written > 0, err
+}
+
+// encodeMap encodes a JSON object column, which is empty for an empty map
+func encodeMap[V any](m map[string]V) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(m)
+	return string(encoded), err
+}
+
+// RecordSessionResponse counts a response by status class.
+// If the session does not exist, it creates it.
+func (r *SQLiteRepository) RecordSessionResponse(sessionID string, response entities.SessionResponse) error {
+	var ok, clientErr, serverErr int
+	switch {
+	case response.StatusCode >= 500:
+		serverErr = 1
+	case response.StatusCode >= 400:
+		clientErr = 1
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		ok = 1
+	}
+	var lastErrorAt sql.NullTime
+	if response.StatusCode >= 400 {
+		lastErrorAt = sql.NullTime{Time: response.At, Valid: true}
+	}
+	// The error type is counted under its key of the error_types JSON object
+	var errorTypes, errorTypePath string
+	if response.ErrorType != "" {
+		encoded, err := json.Marshal(map[string]int{response.ErrorType: 1})
+		if err != nil {
+			return fmt.Errorf("failed to encode error type: %w", err)
+		}
+		errorTypes = string(encoded)
+		errorTypePath = `$."` + response.ErrorType + `"`
+	}
+
+	query := `
+    INSERT INTO sessions (session_id, responses_2xx, responses_4xx, responses_5xx, last_error, last_error_at, error_types, last_active_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT(session_id) DO UPDATE SET
+        responses_2xx = sessions.responses_2xx + excluded.responses_2xx,
+        responses_4xx = sessions.responses_4xx + excluded.responses_4xx,
+        responses_5xx = sessions.responses_5xx + excluded.responses_5xx,
+        last_error = CASE WHEN excluded.last_error_at IS NULL THEN sessions.last_error ELSE excluded.last_error END,
+        last_error_at = COALESCE(excluded.last_error_at, sessions.last_error_at),
+        error_types = CASE WHEN ? = '' THEN sessions.error_types
+            ELSE json_set(COALESCE(NULLIF(sessions.error_types, ''), '{}'), ?,
+                COALESCE(json_extract(NULLIF(sessions.error_types, ''), ?), 0) + 1) END,
+        last_active_at = excluded.last_active_at;`
+
+	_, err := r.db.Exec(query, sessionID, ok, clientErr, serverErr, response.Error, lastErrorAt, errorTypes, time.Now().UTC(),
+		errorTypePath, errorTypePath, errorTypePath)
+	if err != nil {
+		return fmt.Errorf("failed to record session response: %w", err)
+	}
+	return nil
+}
+
+// SetSessionMetadata merges metadata into a session's metadata.
+func (r *SQLiteRepository) SetSessionMetadata(sessionID string, metadata map[string]string) (*entities.SessionData, error) {
+	ctx := context.Background()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	querySelect := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?;`
+	sess, err := scanSession(tx.QueryRowContext(ctx, querySelect, sessionID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	sess.Metadata = mergeMetadata(sess.Metadata, metadata)
+	var encoded []byte
+	if sess.Metadata != nil {
+		if encoded, err = json.Marshal(sess.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to encode session metadata: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET metadata = ? WHERE session_id = ?;`, string(encoded), sessionID); err != nil {
+		return nil, fmt.Errorf("failed to update session metadata: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sess, nil
+}
+
+// MarkSessionMetered records how many of a session's tokens have been reported for billing.
+func (r *SQLiteRepository) MarkSessionMetered(sessionID string, meteredTokens int) error {
+	result, err := r.db.Exec(`UPDATE sessions SET metered_tokens = ? WHERE session_id = ?;`, meteredTokens, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to mark session metered: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to mark session metered: %w", err)
+	}
+	if updated == 0 {
+		return entities.ErrSessionNotFound
+	}
+	return nil
 }
 
 // ListSessions returns all session data.
 func (r *SQLiteRepository) ListSessions() (map[string]*entities.SessionData, error) {
-	query := `SELECT session_id, total_prompt_tokens, total_completion_tokens, total_tokens, request_count FROM sessions;`
+	query := `SELECT ` + sessionColumns + ` FROM sessions;`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
@@ -173,14 +558,850 @@ func (r *SQLiteRepository) ListSessions() (map[string]*entities.SessionData, err
 
 	sessionsMap := make(map[string]*entities.SessionData)
 	for rows.Next() {
-		var sess entities.SessionData
-		if err := rows.Scan(&sess.SessionID, &sess.TotalPromptTokens, &sess.TotalCompletionTokens, &sess.TotalTokens, &sess.RequestCount); err != nil {
+		sess, err := scanSession(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan session row: %w", err)
 		}
-		sessionsMap[sess.SessionID] = &sess
+		sessionsMap[sess.SessionID] = sess
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating session rows: %w", err)
 	}
 	return sessionsMap, nil
 }
+
+// GetCacheEntry returns the cached response for key, or nil if there is none.
+func (r *SQLiteRepository) GetCacheEntry(key string) (*entities.CacheEntry, error) {
+	query := `SELECT cache_key, body, content_type, content_encoding, prompt_tokens, created_at
+              FROM response_cache WHERE cache_key = ?;`
+	row := r.db.QueryRow(query, key)
+
+	var entry entities.CacheEntry
+	err := row.Scan(&entry.Key, &entry.Body, &entry.ContentType, &entry.ContentEncoding, &entry.PromptTokens, &entry.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get cache entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// PutCacheEntry stores a cached response, replacing any existing entry for the key.
+func (r *SQLiteRepository) PutCacheEntry(entry entities.CacheEntry) error {
+	query := `
+    INSERT INTO response_cache (cache_key, body, content_type, content_encoding, prompt_tokens, created_at)
+    VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT(cache_key) DO UPDATE SET
+        body = excluded.body,
+        content_type = excluded.content_type,
+        content_encoding = excluded.content_encoding,
+        prompt_tokens = excluded.prompt_tokens,
+        created_at = excluded.created_at;`
+
+	_, err := r.db.Exec(query, entry.Key, entry.Body, entry.ContentType, entry.ContentEncoding, entry.PromptTokens, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store cache entry: %w", err)
+	}
+	return nil
+}
+
+// CreateJob stores a new job.
+func (r *SQLiteRepository) CreateJob(job entities.Job) error {
+	headers, err := json.Marshal(job.RequestHeaders)
+	if err != nil {
+		return fmt.Errorf("failed to encode job headers: %w", err)
+	}
+
+	query := `
+    INSERT INTO jobs (id, status, session_id, method, path, request_headers, request_body,
+        response_status, response_body, response_content_type, error, created_at, updated_at, tenant_id, virtual_key_id, owner)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err = r.db.Exec(query, job.ID, job.Status, job.SessionID, job.Method, job.Path, string(headers), job.RequestBody,
+		job.ResponseStatus, job.ResponseBody, job.ResponseContentType, job.Error, job.CreatedAt, job.UpdatedAt, job.TenantID, job.VirtualKeyID, job.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+// UpdateJob replaces the stored state of an existing job.
+func (r *SQLiteRepository) UpdateJob(job entities.Job) error {
+	query := `
+    UPDATE jobs SET status = ?, response_status = ?, response_body = ?, response_content_type = ?,
+        error = ?, updated_at = ?
+    WHERE id = ?;`
+	res, err := r.db.Exec(query, job.Status, job.ResponseStatus, job.ResponseBody, job.ResponseContentType,
+		job.Error, job.UpdatedAt, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check updated job: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrJobNotFound
+	}
+	return nil
+}
+
+// GetJob retrieves a job by ID.
+func (r *SQLiteRepository) GetJob(id string) (*entities.Job, error) {
+	row := r.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?;`, id)
+	job, err := scanJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// ListPendingJobs returns queued and running jobs, oldest first.
+func (r *SQLiteRepository) ListPendingJobs() ([]entities.Job, error) {
+	rows, err := r.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE status IN (?, ?) ORDER BY created_at;`,
+		entities.JobStatusQueued, entities.JobStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []entities.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during jobs iteration: %w", err)
+	}
+	return jobs, nil
+}
+
+// jobColumns lists the jobs columns in the order scanJob expects
+const jobColumns = `id, status, session_id, method, path, request_headers, request_body,
+        response_status, response_body, response_content_type, error, created_at, updated_at, tenant_id, virtual_key_id, owner`
+
+// scanJob reads a job selected with jobColumns
+func scanJob(row rowScanner) (*entities.Job, error) {
+	var job entities.Job
+	var headers string
+	var tenantID, virtualKeyID, owner sql.NullString
+	err := row.Scan(&job.ID, &job.Status, &job.SessionID, &job.Method, &job.Path, &headers, &job.RequestBody,
+		&job.ResponseStatus, &job.ResponseBody, &job.ResponseContentType, &job.Error, &job.CreatedAt, &job.UpdatedAt, &tenantID, &virtualKeyID, &owner)
+	if err != nil {
+		return nil, err
+	}
+	job.TenantID = tenantID.String
+	job.VirtualKeyID = virtualKeyID.String
+	job.Owner = owner.String
+	if err := json.Unmarshal([]byte(headers), &job.RequestHeaders); err != nil {
+		return nil, fmt.Errorf("failed to decode job headers: %w", err)
+	}
+	return &job, nil
+}
+
+// SaveShadowResult stores a shadow result.
+func (r *SQLiteRepository) SaveShadowResult(result entities.ShadowResult) error {
+	query := `
+    INSERT INTO shadow_results (path, primary_model, shadow_model, primary_status, shadow_status,
+        primary_latency_ms, shadow_latency_ms, primary_body, shadow_body, shadow_error, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := r.db.Exec(query, result.Path, result.PrimaryModel, result.ShadowModel, result.PrimaryStatus,
+		result.ShadowStatus, result.PrimaryLatencyMs, result.ShadowLatencyMs, result.PrimaryBody,
+		result.ShadowBody, result.ShadowError, result.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save shadow result: %w", err)
+	}
+	return nil
+}
+
+// ListShadowResults returns up to limit results, newest first.
+func (r *SQLiteRepository) ListShadowResults(limit int) ([]entities.ShadowResult, error) {
+	query := `
+    SELECT path, primary_model, shadow_model, primary_status, shadow_status, primary_latency_ms,
+        shadow_latency_ms, primary_body, shadow_body, shadow_error, created_at
+    FROM shadow_results ORDER BY id DESC LIMIT ?;`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shadow results: %w", err)
+	}
+	defer rows.Close()
+
+	results := []entities.ShadowResult{}
+	for rows.Next() {
+		var result entities.ShadowResult
+		err := rows.Scan(&result.Path, &result.PrimaryModel, &result.ShadowModel, &result.PrimaryStatus,
+			&result.ShadowStatus, &result.PrimaryLatencyMs, &result.ShadowLatencyMs, &result.PrimaryBody,
+			&result.ShadowBody, &result.ShadowError, &result.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan shadow result row: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during shadow results iteration: %w", err)
+	}
+	return results, nil
+}
+
+// SaveTranscriptTurn stores a conversation turn.
+func (r *SQLiteRepository) SaveTranscriptTurn(turn entities.TranscriptTurn) error {
+	completion, err := json.Marshal(turn.Completion)
+	if err != nil {
+		return fmt.Errorf("failed to encode transcript completion: %w", err)
+	}
+	query := `
+    INSERT INTO transcripts (session_id, path, model, prompt, completion, created_at)
+    VALUES (?, ?, ?, ?, ?, ?);`
+	_, err = r.db.Exec(query, turn.SessionID, turn.Path, turn.Model, string(turn.Prompt), string(completion), turn.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save transcript turn: %w", err)
+	}
+	return nil
+}
+
+// ListTranscript returns up to limit of a session's latest turns, oldest first.
+func (r *SQLiteRepository) ListTranscript(sessionID string, limit int) ([]entities.TranscriptTurn, error) {
+	query := `
+    SELECT id, session_id, path, model, prompt, completion, created_at FROM (
+        SELECT * FROM transcripts WHERE session_id = ? ORDER BY id DESC LIMIT ?
+    ) ORDER BY id;`
+	rows, err := r.db.Query(query, sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transcript: %w", err)
+	}
+	defer rows.Close()
+
+	turns := []entities.TranscriptTurn{}
+	for rows.Next() {
+		var (
+			turn       entities.TranscriptTurn
+			prompt     string
+			completion string
+		)
+		err := rows.Scan(&turn.ID, &turn.SessionID, &turn.Path, &turn.Model, &prompt, &completion, &turn.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transcript row: %w", err)
+		}
+		turn.Prompt = json.RawMessage(prompt)
+		if err := json.Unmarshal([]byte(completion), &turn.Completion); err != nil {
+			return nil, fmt.Errorf("failed to decode transcript completion: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during transcript iteration: %w", err)
+	}
+	return turns, nil
+}
+
+// SaveBudgetTransfer stores a budget transfer.
+func (r *SQLiteRepository) SaveBudgetTransfer(transfer entities.BudgetTransfer) (*entities.BudgetTransfer, error) {
+	query := `
+    INSERT INTO budget_transfers (from_key, to_key, tokens, reason, created_at)
+    VALUES (?, ?, ?, ?, ?);`
+	res, err := r.db.Exec(query, transfer.From, transfer.To, transfer.Tokens, transfer.Reason, transfer.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save budget transfer: %w", err)
+	}
+	if transfer.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to get budget transfer id: %w", err)
+	}
+	return &transfer, nil
+}
+
+// ListBudgetTransfers returns up to limit transfers, newest first.
+func (r *SQLiteRepository) ListBudgetTransfers(limit int) ([]entities.BudgetTransfer, error) {
+	query := `
+    SELECT id, from_key, to_key, tokens, reason, created_at
+    FROM budget_transfers ORDER BY id DESC LIMIT ?;`
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list budget transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []entities.BudgetTransfer{}
+	for rows.Next() {
+		var transfer entities.BudgetTransfer
+		err := rows.Scan(&transfer.ID, &transfer.From, &transfer.To, &transfer.Tokens, &transfer.Reason, &transfer.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan budget transfer row: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during budget transfer iteration: %w", err)
+	}
+	return transfers, nil
+}
+
+// BudgetAdjustments returns the net amount transferred to each key.
+func (r *SQLiteRepository) BudgetAdjustments() (map[string]int, error) {
+	query := `
+    SELECT key, SUM(tokens) FROM (
+        SELECT to_key AS key, tokens FROM budget_transfers
+        UNION ALL
+        SELECT from_key AS key, -tokens FROM budget_transfers WHERE from_key != ''
+    ) GROUP BY key;`
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum budget transfers: %w", err)
+	}
+	defer rows.Close()
+
+	adjustments := make(map[string]int)
+	for rows.Next() {
+		var (
+			key    string
+			tokens int
+		)
+		if err := rows.Scan(&key, &tokens); err != nil {
+			return nil, fmt.Errorf("failed to scan budget adjustment row: %w", err)
+		}
+		adjustments[key] = tokens
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during budget adjustment iteration: %w", err)
+	}
+	return adjustments, nil
+}
+
+// SaveRequestRecord stores a request record.
+func (r *SQLiteRepository) SaveRequestRecord(record entities.RequestRecord) error {
+	var moderation string
+	if record.Moderation != nil {
+		encoded, err := json.Marshal(record.Moderation)
+		if err != nil {
+			return fmt.Errorf("failed to encode moderation result: %w", err)
+		}
+		moderation = string(encoded)
+	}
+	var capture string
+	if record.Capture != nil {
+		encoded, err := json.Marshal(record.Capture)
+		if err != nil {
+			return fmt.Errorf("failed to encode captured bodies: %w", err)
+		}
+		capture = string(encoded)
+	}
+	var fallback string
+	if record.Fallback != nil {
+		encoded, err := json.Marshal(record.Fallback)
+		if err != nil {
+			return fmt.Errorf("failed to encode content fallback: %w", err)
+		}
+		fallback = string(encoded)
+	}
+
+	query := `
+    INSERT INTO request_history (session_id, method, path, model, status_code, client_ip, error, moderation,
+        queue_wait_ms, upstream_latency_ms, total_ms, capture, fallback, replay_of, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+	_, err := r.db.Exec(query, record.SessionID, record.Method, record.Path, record.Model, record.StatusCode, record.ClientIP,
+		record.Error, moderation, record.QueueWaitMs, record.UpstreamLatencyMs, record.TotalMs, capture, fallback,
+		record.ReplayOf, record.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save request record: %w", err)
+	}
+	return nil
+}
+
+// ListRequestRecords returns up to query.Limit matching records, newest first.
+func (r *SQLiteRepository) ListRequestRecords(query entities.HistoryQuery) ([]entities.RequestRecord, error) {
+	sqlQuery := `SELECT ` + requestRecordColumns + ` FROM request_history
+    WHERE (? = '' OR session_id = ?) AND (? = 0 OR replay_of = ?) ORDER BY id DESC LIMIT ?;`
+	rows, err := r.db.Query(sqlQuery, query.SessionID, query.SessionID, query.ReplayOf, query.ReplayOf, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list request records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []entities.RequestRecord{}
+	for rows.Next() {
+		record, err := scanRequestRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan request record row: %w", err)
+		}
+		records = append(records, *record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during request records iteration: %w", err)
+	}
+	return records, nil
+}
+
+// GetRequestRecord returns the record with the given ID.
+func (r *SQLiteRepository) GetRequestRecord(id int64) (*entities.RequestRecord, error) {
+	row := r.db.QueryRow(`SELECT `+requestRecordColumns+` FROM request_history WHERE id = ?;`, id)
+	record, err := scanRequestRecord(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrRequestRecordNotFound
+		}
+		return nil, fmt.Errorf("failed to get request record: %w", err)
+	}
+	return record, nil
+}
+
+const requestRecordColumns = `id, session_id, method, path, model, status_code, client_ip, error, moderation, queue_wait_ms,
+        upstream_latency_ms, total_ms, capture, fallback, replay_of, created_at`
+
+// scanRequestRecord reads a record selected with requestRecordColumns
+func scanRequestRecord(row rowScanner) (*entities.RequestRecord, error) {
+	var record entities.RequestRecord
+	var moderation, capture, fallback string
+	err := row.Scan(&record.ID, &record.SessionID, &record.Method, &record.Path, &record.Model,
+		&record.StatusCode, &record.ClientIP, &record.Error, &moderation, &record.QueueWaitMs, &record.UpstreamLatencyMs,
+		&record.TotalMs, &capture, &fallback, &record.ReplayOf, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if moderation != "" {
+		record.Moderation = &entities.ModerationResult{}
+		if err := json.Unmarshal([]byte(moderation), record.Moderation); err != nil {
+			return nil, fmt.Errorf("failed to decode moderation result: %w", err)
+		}
+	}
+	if capture != "" {
+		record.Capture = &entities.BodyCapture{}
+		if err := json.Unmarshal([]byte(capture), record.Capture); err != nil {
+			return nil, fmt.Errorf("failed to decode captured bodies: %w", err)
+		}
+	}
+	if fallback != "" {
+		record.Fallback = &entities.ContentFallback{}
+		if err := json.Unmarshal([]byte(fallback), record.Fallback); err != nil {
+			return nil, fmt.Errorf("failed to decode content fallback: %w", err)
+		}
+	}
+	return &record, nil
+}
+
+// DeleteCapturedBodies removes the captured bodies of records created before the given time.
+func (r *SQLiteRepository) DeleteCapturedBodies(before time.Time) (int, error) {
+	res, err := r.db.Exec(`UPDATE request_history SET capture = '' WHERE capture != '' AND created_at < ?;`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete captured bodies: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check deleted captured bodies: %w", err)
+	}
+	return int(affected), nil
+}
+
+// DeleteRequestRecordsBefore deletes request records created before the given time.
+func (r *SQLiteRepository) DeleteRequestRecordsBefore(before time.Time) (int, error) {
+	return r.deleteRows(`DELETE FROM request_history WHERE created_at < ?;`, "request records", before)
+}
+
+// DeleteFinishedJobsBefore deletes completed and failed jobs last updated before the given time.
+func (r *SQLiteRepository) DeleteFinishedJobsBefore(before time.Time) (int, error) {
+	return r.deleteRows(`DELETE FROM jobs WHERE status IN (?, ?) AND updated_at < ?;`, "finished jobs",
+		entities.JobStatusCompleted, entities.JobStatusFailed, before)
+}
+
+// DeleteIdleSessions deletes sessions without requests since the given time.
+func (r *SQLiteRepository) DeleteIdleSessions(before time.Time) (int, error) {
+	_, err := r.deleteRows(`DELETE FROM transcripts WHERE session_id IN (SELECT session_id FROM sessions WHERE last_active_at < ?);`,
+		"transcripts of idle sessions", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return r.deleteRows(`DELETE FROM sessions WHERE last_active_at < ?;`, "idle sessions", before.UTC())
+}
+
+// deleteRows runs a DELETE statement and returns how many rows it deleted
+func (r *SQLiteRepository) deleteRows(query, what string, args ...any) (int, error) {
+	res, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete %s: %w", what, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check deleted %s: %w", what, err)
+	}
+	return int(affected), nil
+}
+
+// AcquireLease grants or renews a lease unless another holder's lease is still valid.
+// The check and the write are a single statement, so concurrent instances
+// cannot both acquire the lease.
+func (r *SQLiteRepository) AcquireLease(lease entities.Lease, now time.Time) (bool, error) {
+	query := `
+    INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+    ON CONFLICT(name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+    WHERE leases.holder = excluded.holder OR leases.expires_at <= ?;`
+	res, err := r.db.Exec(query, lease.Name, lease.Holder, lease.ExpiresAt.UTC(), now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check acquired lease: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ReleaseLease gives up a lease if it is still held by holder.
+func (r *SQLiteRepository) ReleaseLease(name, holder string) error {
+	if _, err := r.db.Exec(`DELETE FROM leases WHERE name = ? AND holder = ?;`, name, holder); err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+// CreateTenant stores a new tenant.
+func (r *SQLiteRepository) CreateTenant(tenant entities.Tenant) error {
+	query := `
+    INSERT INTO tenants (id, name, upstream_api_key, requests_per_minute, residency, created_at)
+    VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT(id) DO NOTHING;`
+	res, err := r.db.Exec(query, tenant.ID, tenant.Name, tenant.UpstreamAPIKey, tenant.RequestsPerMinute, tenant.Residency, tenant.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check created tenant: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrTenantExists
+	}
+	return nil
+}
+
+// UpdateTenant replaces the stored state of an existing tenant.
+func (r *SQLiteRepository) UpdateTenant(tenant entities.Tenant) error {
+	res, err := r.db.Exec(`UPDATE tenants SET name = ?, upstream_api_key = ?, requests_per_minute = ?, residency = ? WHERE id = ?;`,
+		tenant.Name, tenant.UpstreamAPIKey, tenant.RequestsPerMinute, tenant.Residency, tenant.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check updated tenant: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrTenantNotFound
+	}
+	return nil
+}
+
+// GetTenant retrieves a tenant by ID.
+func (r *SQLiteRepository) GetTenant(id string) (*entities.Tenant, error) {
+	row := r.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE id = ?;`, id)
+	tenant, err := scanTenant(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrTenantNotFound
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// ListTenants returns all tenants ordered by ID.
+func (r *SQLiteRepository) ListTenants() ([]entities.Tenant, error) {
+	rows, err := r.db.Query(`SELECT ` + tenantColumns + ` FROM tenants ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	tenants := []entities.Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tenant row: %w", err)
+		}
+		tenants = append(tenants, *tenant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during tenants iteration: %w", err)
+	}
+	return tenants, nil
+}
+
+// DeleteTenant removes a tenant and its virtual keys.
+func (r *SQLiteRepository) DeleteTenant(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM tenants WHERE id = ?;`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrTenantNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM virtual_keys WHERE tenant_id = ?;`, id); err != nil {
+		return fmt.Errorf("failed to delete tenant keys: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CreateVirtualKey stores a new virtual key of an existing tenant.
+func (r *SQLiteRepository) CreateVirtualKey(key entities.VirtualKey) error {
+	upstreamKeys, err := encodeUpstreamKeys(key.UpstreamAPIKeys)
+	if err != nil {
+		return err
+	}
+	query := `
+    INSERT INTO virtual_keys (id, tenant_id, name, key_hash, signing_secret, upstream_api_keys, created_at)
+    SELECT ?, ?, ?, ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM tenants WHERE id = ?);`
+	res, err := r.db.Exec(query, key.ID, key.TenantID, key.Name, key.Hash, key.SigningSecret, upstreamKeys, key.CreatedAt, key.TenantID)
+	if err != nil {
+		return fmt.Errorf("failed to create virtual key: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check created virtual key: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrTenantNotFound
+	}
+	return nil
+}
+
+// UpdateVirtualKey replaces the name and upstream keys of a tenant's key.
+func (r *SQLiteRepository) UpdateVirtualKey(key entities.VirtualKey) error {
+	upstreamKeys, err := encodeUpstreamKeys(key.UpstreamAPIKeys)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE virtual_keys SET name = ?, upstream_api_keys = ? WHERE tenant_id = ? AND id = ?;`,
+		key.Name, upstreamKeys, key.TenantID, key.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update virtual key: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update virtual key: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrVirtualKeyNotFound
+	}
+	return nil
+}
+
+// GetVirtualKey retrieves a virtual key by ID.
+func (r *SQLiteRepository) GetVirtualKey(id string) (*entities.VirtualKey, error) {
+	row := r.db.QueryRow(`SELECT `+virtualKeyColumns+` FROM virtual_keys WHERE id = ?;`, id)
+	key, err := scanVirtualKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrVirtualKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get virtual key: %w", err)
+	}
+	return key, nil
+}
+
+// GetVirtualKeyByHash retrieves a virtual key by the hash of its plaintext.
+func (r *SQLiteRepository) GetVirtualKeyByHash(hash string) (*entities.VirtualKey, error) {
+	row := r.db.QueryRow(`SELECT `+virtualKeyColumns+` FROM virtual_keys WHERE key_hash = ?;`, hash)
+	key, err := scanVirtualKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, entities.ErrVirtualKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get virtual key: %w", err)
+	}
+	return key, nil
+}
+
+// ListVirtualKeys returns a tenant's keys, oldest first.
+func (r *SQLiteRepository) ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error) {
+	rows, err := r.db.Query(`SELECT `+virtualKeyColumns+` FROM virtual_keys WHERE tenant_id = ? ORDER BY created_at;`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list virtual keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []entities.VirtualKey
+	for rows.Next() {
+		key, err := scanVirtualKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan virtual key row: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during virtual keys iteration: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteVirtualKey removes a tenant's virtual key.
+func (r *SQLiteRepository) DeleteVirtualKey(tenantID, id string) error {
+	res, err := r.db.Exec(`DELETE FROM virtual_keys WHERE tenant_id = ? AND id = ?;`, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete virtual key: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete virtual key: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrVirtualKeyNotFound
+	}
+	return nil
+}
+
+// tenantColumns lists the tenants columns in the order scanTenant expects
+const tenantColumns = `id, name, upstream_api_key, requests_per_minute, residency, created_at`
+
+// scanTenant reads a tenant selected with tenantColumns
+func scanTenant(row rowScanner) (*entities.Tenant, error) {
+	var tenant entities.Tenant
+	var residency sql.NullString
+	if err := row.Scan(&tenant.ID, &tenant.Name, &tenant.UpstreamAPIKey, &tenant.RequestsPerMinute, &residency, &tenant.CreatedAt); err != nil {
+		return nil, err
+	}
+	tenant.Residency = residency.String
+	return &tenant, nil
+}
+
+// virtualKeyColumns lists the virtual_keys columns in the order scanVirtualKey expects
+const virtualKeyColumns = `id, tenant_id, name, key_hash, created_at, signing_secret, upstream_api_keys`
+
+// scanVirtualKey reads a virtual key selected with virtualKeyColumns
+func scanVirtualKey(row rowScanner) (*entities.VirtualKey, error) {
+	var key entities.VirtualKey
+	var signingSecret, upstreamKeys sql.NullString
+	if err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.Hash, &key.CreatedAt, &signingSecret, &upstreamKeys); err != nil {
+		return nil, err
+	}
+	key.SigningSecret = signingSecret.String
+	if upstreamKeys.String != "" {
+		if err := json.Unmarshal([]byte(upstreamKeys.String), &key.UpstreamAPIKeys); err != nil {
+			return nil, fmt.Errorf("failed to decode upstream keys of virtual key %s: %w", key.ID, err)
+		}
+	}
+	return &key, nil
+}
+
+// encodeUpstreamKeys stores a virtual key's upstream keys as a JSON array, or
+// as an empty string when it has none
+func encodeUpstreamKeys(keys []string) (string, error) {
+	if len(keys) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(keys)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upstream keys: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// SetThreadSession maps a thread to a session, replacing any previous mapping.
+func (r *SQLiteRepository) SetThreadSession(threadID, sessionID string) error {
+	query := `
+    INSERT INTO thread_sessions (thread_id, session_id, created_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+    ON CONFLICT(thread_id) DO UPDATE SET session_id = excluded.session_id;`
+	if _, err := r.db.Exec(query, threadID, sessionID); err != nil {
+		return fmt.Errorf("failed to map thread: %w", err)
+	}
+	return nil
+}
+
+// GetThreadSession returns the session a thread is mapped to.
+func (r *SQLiteRepository) GetThreadSession(threadID string) (string, error) {
+	var sessionID string
+	err := r.db.QueryRow(`SELECT session_id FROM thread_sessions WHERE thread_id = ?;`, threadID).Scan(&sessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", entities.ErrThreadNotFound
+		}
+		return "", fmt.Errorf("failed to get thread: %w", err)
+	}
+	return sessionID, nil
+}
+
+// DeleteThreadSession removes the mapping of a thread.
+func (r *SQLiteRepository) DeleteThreadSession(threadID string) error {
+	res, err := r.db.Exec(`DELETE FROM thread_sessions WHERE thread_id = ?;`, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to delete thread: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check deleted thread: %w", err)
+	}
+	if affected == 0 {
+		return entities.ErrThreadNotFound
+	}
+	return nil
+}
+
+// MarkRunAccounted records that the usage of a run was counted.
+func (r *SQLiteRepository) MarkRunAccounted(runID string) (bool, error) {
+	res, err := r.db.Exec(`INSERT INTO accounted_runs (run_id, accounted_at) VALUES (?, CURRENT_TIMESTAMP) ON CONFLICT(run_id) DO NOTHING;`, runID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark run: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check marked run: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SaveFineTuneJob creates or replaces a fine-tuning job.
+func (r *SQLiteRepository) SaveFineTuneJob(job entities.FineTuneJob) error {
+	query := `
+    INSERT INTO fine_tune_jobs (id, session_id, model, status, trained_tokens, created_at, finished_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT(id) DO UPDATE SET
+        status = excluded.status,
+        trained_tokens = excluded.trained_tokens,
+        finished_at = excluded.finished_at;`
+	var finishedAt sql.NullTime
+	if job.FinishedAt != nil {
+		finishedAt = sql.NullTime{Time: *job.FinishedAt, Valid: true}
+	}
+	if _, err := r.db.Exec(query, job.ID, job.SessionID, job.Model, job.Status, job.TrainedTokens, job.CreatedAt, finishedAt); err != nil {
+		return fmt.Errorf("failed to save fine-tuning job: %w", err)
+	}
+	return nil
+}
+
+// ListPendingFineTuneJobs returns fine-tuning jobs that have not finished, oldest first.
+func (r *SQLiteRepository) ListPendingFineTuneJobs() ([]entities.FineTuneJob, error) {
+	rows, err := r.db.Query(`SELECT id, session_id, model, status, trained_tokens, created_at
+    FROM fine_tune_jobs WHERE finished_at IS NULL ORDER BY created_at;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending fine-tuning jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []entities.FineTuneJob
+	for rows.Next() {
+		var job entities.FineTuneJob
+		if err := rows.Scan(&job.ID, &job.SessionID, &job.Model, &job.Status, &job.TrainedTokens, &job.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan fine-tuning job row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during fine-tuning jobs iteration: %w", err)
+	}
+	return jobs, nil
+}
@@ -1,10 +1,15 @@
 package repository_test
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"math"
+	"net/http"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
@@ -145,3 +150,513 @@ func TestSQLiteRepository_ListSessions(t *testing.T) {
 		t.Errorf("ListSessions() s2.TotalTokens = %d, want 50", sessions["s2"].TotalTokens)
 	}
 }
+
+func TestSQLiteRepository_EstimatedTokens(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo.UpdateSessionTokens("est", entities.TokenUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+	sess, err := repo.UpdateSessionTokens("est", entities.TokenUsage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10, Estimated: true})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	if sess.TotalTokens != 13 || sess.EstimatedTokens != 10 {
+		t.Errorf("UpdateSessionTokens() = (total %d, estimated %d), want (13, 10)", sess.TotalTokens, sess.EstimatedTokens)
+	}
+}
+
+func TestSQLiteRepository_MediaUsage(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo.UpdateSessionTokens("media", entities.TokenUsage{Images: 2, Cost: 0.08})
+	sess, err := repo.UpdateSessionTokens("media", entities.TokenUsage{AudioSeconds: 12.5, Characters: 40, Cost: 0.02})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	if sess.TotalImages != 2 || sess.TotalAudioSeconds != 12.5 || sess.TotalCharacters != 40 || math.Abs(sess.TotalCost-0.1) > 1e-9 || sess.RequestCount != 2 {
+		t.Errorf("UpdateSessionTokens() = %+v, want 2 images, 12.5s of audio, 40 characters and a cost of 0.1 in 2 requests", sess)
+	}
+}
+
+func TestSQLiteRepository_ToolCalls(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5, ToolCalls: map[string]int{"search": 2}})
+	repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5})
+	sess, err := repo.UpdateSessionTokens("agent", entities.TokenUsage{TotalTokens: 5, ToolCalls: map[string]int{"search": 1, "get_weather": 1}})
+	if err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+	want := map[string]int{"search": 3, "get_weather": 1}
+	if sess.TotalToolCalls != 4 || !reflect.DeepEqual(sess.ToolCalls, want) {
+		t.Errorf("UpdateSessionTokens() tool calls = %d %v, want 4 %v", sess.TotalToolCalls, sess.ToolCalls, want)
+	}
+
+	sessions, err := repo.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if got := sessions["agent"]; got == nil || !reflect.DeepEqual(got.ToolCalls, want) {
+		t.Errorf("ListSessions() session = %+v, want tool calls %v", got, want)
+	}
+}
+
+func TestSQLiteRepository_Transcripts(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	repo.CreateSession("agent")
+	for _, text := range []string{"one", "two", "three"} {
+		err := repo.SaveTranscriptTurn(entities.TranscriptTurn{
+			SessionID:  "agent",
+			Path:       "/v1/chat/completions",
+			Model:      "gpt-4o",
+			Prompt:     json.RawMessage(`[{"role":"user","content":"` + text + `"}]`),
+			Completion: []json.RawMessage{json.RawMessage(`{"role":"assistant","content":"` + text + `"}`)},
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("SaveTranscriptTurn() error = %v", err)
+		}
+	}
+
+	turns, err := repo.ListTranscript("agent", 2)
+	if err != nil {
+		t.Fatalf("ListTranscript() error = %v", err)
+	}
+	if len(turns) != 2 || turns[0].ID >= turns[1].ID || turns[0].Model != "gpt-4o" ||
+		string(turns[0].Prompt) != `[{"role":"user","content":"two"}]` ||
+		len(turns[1].Completion) != 1 || string(turns[1].Completion[0]) != `{"role":"assistant","content":"three"}` {
+		t.Errorf("ListTranscript() = %+v, want the last two turns, oldest first", turns)
+	}
+	if turns, _ := repo.ListTranscript("other", 10); turns == nil || len(turns) != 0 {
+		t.Errorf("ListTranscript(other) = %v, want no turns", turns)
+	}
+
+	// The transcript is deleted with its session
+	if err := repo.DeleteSession("agent"); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if turns, _ := repo.ListTranscript("agent", 10); len(turns) != 0 {
+		t.Errorf("ListTranscript() after DeleteSession = %+v, want none", turns)
+	}
+}
+
+func TestSQLiteRepository_DeleteSession(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 5})
+	if err := repo.DeleteSession("s1"); err != nil {
+		t.Fatalf("DeleteSession() error = %v", err)
+	}
+	if _, err := repo.GetSession("s1"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("GetSession() after delete error = %v, want ErrSessionNotFound", err)
+	}
+	if err := repo.DeleteSession("s1"); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("DeleteSession() twice error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSQLiteRepository_SessionMetadata(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := repo.SetSessionMetadata("s1", map[string]string{"team": "a"}); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("SetSessionMetadata() for a missing session error = %v, want ErrSessionNotFound", err)
+	}
+
+	repo.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 5})
+	if _, err := repo.SetSessionMetadata("s1", map[string]string{"stripe_customer_id": "cus_1", "team": "a"}); err != nil {
+		t.Fatalf("SetSessionMetadata() error = %v", err)
+	}
+	sess, err := repo.SetSessionMetadata("s1", map[string]string{"team": ""})
+	if err != nil {
+		t.Fatalf("SetSessionMetadata() error = %v", err)
+	}
+	if len(sess.Metadata) != 1 || sess.Metadata["stripe_customer_id"] != "cus_1" {
+		t.Errorf("SetSessionMetadata() metadata = %v, want only stripe_customer_id", sess.Metadata)
+	}
+
+	if err := repo.MarkSessionMetered("s1", 5); err != nil {
+		t.Fatalf("MarkSessionMetered() error = %v", err)
+	}
+	sess, err = repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.Metadata["stripe_customer_id"] != "cus_1" || sess.MeteredTokens != 5 {
+		t.Errorf("GetSession() = %+v, want the stored metadata and 5 metered tokens", sess)
+	}
+	if err := repo.MarkSessionMetered("missing", 1); !errors.Is(err, entities.ErrSessionNotFound) {
+		t.Errorf("MarkSessionMetered() for a missing session error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestSQLiteRepository_RecordSessionResponse(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	failedAt := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	responses := []entities.SessionResponse{
+		{StatusCode: http.StatusOK, At: failedAt.Add(-time.Minute)},
+		{StatusCode: http.StatusBadRequest, Error: "bad request", ErrorType: entities.InvalidRequestErrorType, At: failedAt.Add(-time.Minute)},
+		{StatusCode: http.StatusBadRequest, Error: "bad request", ErrorType: entities.InvalidRequestErrorType, At: failedAt.Add(-time.Second)},
+		{StatusCode: http.StatusBadGateway, Error: "connection refused", At: failedAt},
+		{StatusCode: http.StatusCreated, At: failedAt.Add(time.Minute)},
+	}
+	for _, response := range responses {
+		if err := repo.RecordSessionResponse("s1", response); err != nil {
+			t.Fatalf("RecordSessionResponse() error = %v", err)
+		}
+	}
+
+	sess, err := repo.GetSession("s1")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.Responses2xx != 2 || sess.Responses4xx != 2 || sess.Responses5xx != 1 {
+		t.Errorf("GetSession() counts = (%d, %d, %d), want (2, 2, 1)", sess.Responses2xx, sess.Responses4xx, sess.Responses5xx)
+	}
+	if want := map[string]int{entities.InvalidRequestErrorType: 2}; !reflect.DeepEqual(sess.ErrorTypes, want) {
+		t.Errorf("GetSession() ErrorTypes = %v, want %v", sess.ErrorTypes, want)
+	}
+	if sess.LastError != "connection refused" {
+		t.Errorf("GetSession() LastError = %q, want %q", sess.LastError, "connection refused")
+	}
+	if sess.LastErrorAt == nil || !sess.LastErrorAt.Equal(failedAt) {
+		t.Errorf("GetSession() LastErrorAt = %v, want %v", sess.LastErrorAt, failedAt)
+	}
+	if sess.RequestCount != 0 {
+		t.Errorf("GetSession() RequestCount = %d, want 0", sess.RequestCount)
+	}
+}
+
+func TestSQLiteRepository_InitUpgradesExistingSchema(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "legacy.db")
+	repo, err := repository.NewSQLiteRepository(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository() error = %v", err)
+	}
+	defer repo.Close()
+
+	// Create the original schema first, then let Init add newer columns
+	legacy, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE sessions (
+        session_id TEXT PRIMARY KEY,
+        total_prompt_tokens INTEGER DEFAULT 0,
+        total_completion_tokens INTEGER DEFAULT 0,
+        total_tokens INTEGER DEFAULT 0,
+        request_count INTEGER DEFAULT 0
+    ); INSERT INTO sessions (session_id, total_tokens, request_count) VALUES ('old', 7, 1);`)
+	legacy.Close()
+	if err != nil {
+		t.Fatalf("creating legacy schema error = %v", err)
+	}
+
+	if err := repo.Init(); err != nil {
+		t.Fatalf("Init() on legacy schema error = %v", err)
+	}
+	sess, err := repo.GetSession("old")
+	if err != nil {
+		t.Fatalf("GetSession() error = %v", err)
+	}
+	if sess.TotalTokens != 7 || sess.EstimatedTokens != 0 {
+		t.Errorf("GetSession() = %+v, want total 7 and estimated 0", sess)
+	}
+	if sess.Responses5xx != 0 || sess.LastError != "" || sess.LastErrorAt != nil {
+		t.Errorf("GetSession() = %+v, want no response statistics", sess)
+	}
+}
+
+func TestSQLiteRepository_InitIsIdempotent(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 5})
+	version, err := repo.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version < 1 {
+		t.Fatalf("SchemaVersion() = %d, want at least 1 after Init", version)
+	}
+
+	if err := repo.Init(); err != nil {
+		t.Fatalf("second Init() error = %v", err)
+	}
+	again, err := repo.SchemaVersion()
+	if err != nil || again != version {
+		t.Errorf("SchemaVersion() after second Init = (%d, %v), want (%d, nil)", again, err, version)
+	}
+	if sess, err := repo.GetSession("s1"); err != nil || sess.TotalTokens != 5 {
+		t.Errorf("GetSession() after second Init = (%+v, %v), want the existing session", sess, err)
+	}
+}
+
+func TestSQLiteRepository_CacheEntries(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	entry, err := repo.GetCacheEntry("missing")
+	if err != nil || entry != nil {
+		t.Fatalf("GetCacheEntry(missing) = (%v, %v), want (nil, nil)", entry, err)
+	}
+
+	want := entities.CacheEntry{
+		Key:          "k1",
+		Body:         []byte(`{"data":[]}`),
+		ContentType:  "application/json",
+		PromptTokens: 7,
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	if err := repo.PutCacheEntry(want); err != nil {
+		t.Fatalf("PutCacheEntry() error = %v", err)
+	}
+	got, err := repo.GetCacheEntry("k1")
+	if err != nil {
+		t.Fatalf("GetCacheEntry() error = %v", err)
+	}
+	if got == nil || string(got.Body) != string(want.Body) || got.PromptTokens != 7 || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("GetCacheEntry() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSQLiteRepository_Jobs(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := repo.GetJob("missing"); !errors.Is(err, entities.ErrJobNotFound) {
+		t.Fatalf("GetJob(missing) error = %v, want %v", err, entities.ErrJobNotFound)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	job := entities.Job{
+		ID:             "job_1",
+		Status:         entities.JobStatusQueued,
+		SessionID:      "s1",
+		TenantID:       "acme",
+		VirtualKeyID:   "k1",
+		Owner:          "replica-a",
+		Method:         "POST",
+		Path:           "/v1/chat/completions",
+		RequestHeaders: http.Header{"Content-Type": []string{"application/json"}},
+		RequestBody:    []byte(`{"model":"gpt-4o"}`),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := repo.CreateJob(job); err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+
+	job.Status = entities.JobStatusCompleted
+	job.ResponseStatus = 200
+	job.ResponseBody = []byte(`{"id":"chatcmpl-1"}`)
+	job.ResponseContentType = "application/json"
+	if err := repo.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob() error = %v", err)
+	}
+
+	got, err := repo.GetJob("job_1")
+	if err != nil {
+		t.Fatalf("GetJob() error = %v", err)
+	}
+	if got.Status != entities.JobStatusCompleted || got.SessionID != "s1" || got.TenantID != "acme" || got.VirtualKeyID != "k1" || got.Owner != "replica-a" || got.ResponseStatus != 200 ||
+		string(got.ResponseBody) != string(job.ResponseBody) || string(got.RequestBody) != string(job.RequestBody) {
+		t.Errorf("GetJob() = %+v, want %+v", got, job)
+	}
+	if got.RequestHeaders.Get("Content-Type") != "application/json" {
+		t.Errorf("GetJob() headers = %v, want Content-Type preserved", got.RequestHeaders)
+	}
+
+	if err := repo.UpdateJob(entities.Job{ID: "missing"}); !errors.Is(err, entities.ErrJobNotFound) {
+		t.Errorf("UpdateJob(missing) error = %v, want %v", err, entities.ErrJobNotFound)
+	}
+
+	pendingJob := entities.Job{ID: "job_2", Status: entities.JobStatusRunning, Method: "POST", Path: "/v1/embeddings", CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateJob(pendingJob); err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	pending, err := repo.ListPendingJobs()
+	if err != nil {
+		t.Fatalf("ListPendingJobs() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != "job_2" {
+		t.Errorf("ListPendingJobs() = %+v, want only job_2", pending)
+	}
+}
+
+func TestSQLiteRepository_ShadowResults(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, path := range []string{"/v1/a", "/v1/b", "/v1/c"} {
+		result := entities.ShadowResult{
+			Path:          path,
+			PrimaryModel:  "gpt-4o",
+			ShadowModel:   "gpt-4o-mini",
+			PrimaryStatus: 200,
+			ShadowStatus:  200,
+			PrimaryBody:   `{"a":1}`,
+			ShadowBody:    `{"a":2}`,
+			CreatedAt:     now,
+		}
+		if err := repo.SaveShadowResult(result); err != nil {
+			t.Fatalf("SaveShadowResult() error = %v", err)
+		}
+	}
+
+	got, err := repo.ListShadowResults(2)
+	if err != nil {
+		t.Fatalf("ListShadowResults() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/v1/c" || got[1].Path != "/v1/b" {
+		t.Fatalf("ListShadowResults(2) = %+v, want the two newest results", got)
+	}
+	if got[0].ShadowModel != "gpt-4o-mini" || got[0].ShadowBody != `{"a":2}` || !got[0].CreatedAt.Equal(now) {
+		t.Errorf("ListShadowResults()[0] = %+v, want stored fields", got[0])
+	}
+}
+
+func TestSQLiteRepository_RequestHistory(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	records := []entities.RequestRecord{
+		{SessionID: "s1", Method: "POST", Path: "/v1/chat/completions", Model: "gpt-4o", StatusCode: 200, ClientIP: "203.0.113.7",
+			QueueWaitMs: 120, UpstreamLatencyMs: 800, TotalMs: 925, CreatedAt: now,
+			Fallback: &entities.ContentFallback{Reason: "content_filter", StatusCode: 400, Model: "gpt-4o-mini"}},
+		{SessionID: "s2", Method: "POST", Path: "/v1/embeddings", StatusCode: 502, Error: "connection refused", CreatedAt: now},
+		{SessionID: "s1", Method: "POST", Path: "/v1/chat/completions", StatusCode: 400, CreatedAt: now,
+			Moderation: &entities.ModerationResult{Flagged: true, Blocked: true, Categories: []string{"violence"}}},
+	}
+	for _, record := range records {
+		if err := repo.SaveRequestRecord(record); err != nil {
+			t.Fatalf("SaveRequestRecord() error = %v", err)
+		}
+	}
+
+	got, err := repo.ListRequestRecords(entities.HistoryQuery{SessionID: "s1", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRequestRecords() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != 3 || got[1].ID != 1 {
+		t.Fatalf("ListRequestRecords(s1) = %+v, want records 3 and 1", got)
+	}
+	if got[0].Moderation == nil || !got[0].Moderation.Blocked || got[0].Moderation.Categories[0] != "violence" {
+		t.Errorf("ListRequestRecords()[0].Moderation = %+v, want stored result", got[0].Moderation)
+	}
+	if got[1].Fallback == nil || got[1].Fallback.Model != "gpt-4o-mini" || got[0].Fallback != nil {
+		t.Errorf("ListRequestRecords() fallbacks = %+v, %+v, want only the first record's", got[0].Fallback, got[1].Fallback)
+	}
+	if got[1].Moderation != nil || got[1].Model != "gpt-4o" || got[1].ClientIP != "203.0.113.7" || got[1].UpstreamLatencyMs != 800 || got[1].TotalMs != 925 || !got[1].CreatedAt.Equal(now) {
+		t.Errorf("ListRequestRecords()[1] = %+v, want stored fields", got[1])
+	}
+
+	all, err := repo.ListRequestRecords(entities.HistoryQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRequestRecords() error = %v", err)
+	}
+	if len(all) != 3 || all[1].Error != "connection refused" {
+		t.Errorf("ListRequestRecords(all) = %+v, want all three records", all)
+	}
+}
+
+func TestSQLiteRepository_GetRequestRecord(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	capture := &entities.BodyCapture{RequestBody: `{"model":"gpt-4o"}`}
+	for _, replayOf := range []int64{0, 1, 0, 1} {
+		if err := repo.SaveRequestRecord(entities.RequestRecord{Method: "POST", Path: "/v1/chat/completions",
+			Capture: capture, ReplayOf: replayOf, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("SaveRequestRecord() error = %v", err)
+		}
+	}
+
+	got, err := repo.GetRequestRecord(2)
+	if err != nil {
+		t.Fatalf("GetRequestRecord() error = %v", err)
+	}
+	if got.ID != 2 || got.ReplayOf != 1 || got.Capture == nil || got.Capture.RequestBody != capture.RequestBody {
+		t.Errorf("GetRequestRecord(2) = %+v, want the first replay with its capture", got)
+	}
+	if _, err := repo.GetRequestRecord(5); !errors.Is(err, entities.ErrRequestRecordNotFound) {
+		t.Errorf("GetRequestRecord(5) error = %v, want ErrRequestRecordNotFound", err)
+	}
+	replays, err := repo.ListRequestRecords(entities.HistoryQuery{ReplayOf: 1, Limit: 10})
+	if err != nil || len(replays) != 2 || replays[0].ID != 4 || replays[1].ID != 2 {
+		t.Errorf("ListRequestRecords(replay_of 1) = %+v, %v, want records 4 and 2", replays, err)
+	}
+}
+
+func TestSQLiteRepository_CapturedBodies(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	capture := &entities.BodyCapture{RequestBody: `{"model":"gpt-4o"}`, ResponseBody: `{"id":"chatcmpl-1"}`, Truncated: true}
+	for _, createdAt := range []time.Time{now.Add(-48 * time.Hour), now} {
+		if err := repo.SaveRequestRecord(entities.RequestRecord{Path: "/v1/chat/completions", Capture: capture, CreatedAt: createdAt}); err != nil {
+			t.Fatalf("SaveRequestRecord() error = %v", err)
+		}
+	}
+
+	cleared, err := repo.DeleteCapturedBodies(now.Add(-24 * time.Hour))
+	if err != nil || cleared != 1 {
+		t.Fatalf("DeleteCapturedBodies() = %d, %v, want 1", cleared, err)
+	}
+	got, err := repo.ListRequestRecords(entities.HistoryQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListRequestRecords() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Capture == nil || *got[0].Capture != *capture || got[1].Capture != nil {
+		t.Errorf("ListRequestRecords() = %+v, want the recent capture kept and the old one deleted", got)
+	}
+}
+
+func TestSQLiteRepository_Retention(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for _, createdAt := range []time.Time{now.Add(-48 * time.Hour), now} {
+		if err := repo.SaveRequestRecord(entities.RequestRecord{Path: "/v1/chat/completions", CreatedAt: createdAt}); err != nil {
+			t.Fatalf("SaveRequestRecord() error = %v", err)
+		}
+	}
+	for _, job := range []entities.Job{
+		{ID: "old-completed", Status: entities.JobStatusCompleted, Method: "POST", Path: "/v1/chat/completions", CreatedAt: now, UpdatedAt: now.Add(-48 * time.Hour)},
+		{ID: "old-running", Status: entities.JobStatusRunning, Method: "POST", Path: "/v1/chat/completions", CreatedAt: now, UpdatedAt: now.Add(-48 * time.Hour)},
+	} {
+		if err := repo.CreateJob(job); err != nil {
+			t.Fatalf("CreateJob() error = %v", err)
+		}
+	}
+	if _, err := repo.UpdateSessionTokens("active", entities.TokenUsage{TotalTokens: 10}); err != nil {
+		t.Fatalf("UpdateSessionTokens() error = %v", err)
+	}
+
+	before := now.Add(-24 * time.Hour)
+	if deleted, err := repo.DeleteRequestRecordsBefore(before); err != nil || deleted != 1 {
+		t.Errorf("DeleteRequestRecordsBefore() = %d, %v, want 1", deleted, err)
+	}
+	if deleted, err := repo.DeleteFinishedJobsBefore(before); err != nil || deleted != 1 {
+		t.Errorf("DeleteFinishedJobsBefore() = %d, %v, want 1", deleted, err)
+	}
+	if _, err := repo.GetJob("old-running"); err != nil {
+		t.Errorf("GetJob(old-running) error = %v, want the running job kept", err)
+	}
+	if deleted, err := repo.DeleteIdleSessions(before); err != nil || deleted != 0 {
+		t.Errorf("DeleteIdleSessions(before) = %d, %v, want the active session kept", deleted, err)
+	}
+	if deleted, err := repo.DeleteIdleSessions(now.Add(time.Minute)); err != nil || deleted != 1 {
+		t.Errorf("DeleteIdleSessions(later) = %d, %v, want 1", deleted, err)
+	}
+}
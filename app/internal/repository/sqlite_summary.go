@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// summaryFilter selects the sessions of a tenant that were active since a
+// time; its arguments come from summaryArgs
+const summaryFilter = `(? = '' OR substr(session_id, 1, length(?)) = ?) AND (? = 0 OR last_active_at >= ?)`
+
+// FindSessions returns the sessions the filter selects, filtered by SQLite.
+func (r *SQLiteRepository) FindSessions(filter entities.SessionFilter) (map[string]*entities.SessionData, error) {
+	prefix := ""
+	if filter.TenantID != "" {
+		prefix = filter.TenantID + "/"
+	}
+	var conditions []string
+	var args []any
+	if filter.TenantID != "" || filter.Tag != "" {
+		idPrefix := prefix
+		if filter.Tag != "" {
+			idPrefix += filter.Tag + ":"
+		}
+		conditions = append(conditions, "substr(session_id, 1, length(?)) = ?")
+		args = append(args, idPrefix, idPrefix)
+	}
+	if filter.MinTokens > 0 {
+		conditions = append(conditions, "total_tokens >= ?")
+		args = append(args, filter.MinTokens)
+	}
+	if filter.MinCost > 0 {
+		conditions = append(conditions, "total_cost >= ?")
+		args = append(args, filter.MinCost)
+	}
+	if !filter.ActiveSince.IsZero() {
+		conditions = append(conditions, "last_active_at >= ?")
+		args = append(args, filter.ActiveSince.UTC())
+	}
+	query := `SELECT ` + sessionColumns + ` FROM sessions`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := r.db.Query(query+`;`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make(map[string]*entities.SessionData)
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session row: %w", err)
+		}
+		sessions[sess.SessionID] = sess
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session rows: %w", err)
+	}
+	return sessions, nil
+}
+
+// SummarizeGroup rolls up the usage of the sessions whose metadata key is id.
+// The metadata is matched by SQLite, and the totals are added up from the
+// matching sessions, which are listed anyway.
+func (r *SQLiteRepository) SummarizeGroup(tenantID, key, id string) (*entities.SessionGroupUsage, error) {
+	prefix := ""
+	if tenantID != "" {
+		prefix = tenantID + "/"
+	}
+	rows, err := r.db.Query(`
+    SELECT session_id, COALESCE(total_prompt_tokens, 0), COALESCE(total_completion_tokens, 0),
+        COALESCE(total_tokens, 0), COALESCE(total_cost, 0), COALESCE(request_count, 0),
+        responses_2xx, responses_4xx + responses_5xx
+    FROM sessions
+    WHERE substr(session_id, 1, length(?)) = ? AND json_extract(NULLIF(metadata, ''), ?) = ?
+    ORDER BY total_tokens DESC, session_id;`, prefix, prefix, `$."`+key+`"`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize sessions of %s %s: %w", key, id, err)
+	}
+	defer rows.Close()
+
+	group := &entities.SessionGroupUsage{GroupKey: key, GroupID: id, SessionUsage: []entities.SessionRank{}}
+	for rows.Next() {
+		var rank entities.SessionRank
+		var promptTokens, completionTokens, succeeded int
+		if err := rows.Scan(&rank.SessionID, &promptTokens, &completionTokens, &rank.TotalTokens, &rank.TotalCost,
+			&rank.RequestCount, &succeeded, &rank.Errors); err != nil {
+			return nil, fmt.Errorf("failed to scan session group row: %w", err)
+		}
+		if responses := succeeded + rank.Errors; responses > 0 {
+			rank.ErrorRate = float64(rank.Errors) / float64(responses)
+		}
+		group.Sessions++
+		group.PromptTokens += promptTokens
+		group.CompletionTokens += completionTokens
+		group.TotalTokens += rank.TotalTokens
+		group.Requests += rank.RequestCount
+		group.Errors += rank.Errors
+		group.TotalCost += rank.TotalCost
+		group.SessionUsage = append(group.SessionUsage, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating session group rows: %w", err)
+	}
+	return group, nil
+}
+
+// SummarizeSessions returns the totals and top sessions of the selected
+// sessions, aggregated and ranked by SQLite.
+func (r *SQLiteRepository) SummarizeSessions(query entities.SessionSummaryQuery) (*entities.SessionSummary, error) {
+	summary := &entities.SessionSummary{}
+	row := r.db.QueryRow(`
+    SELECT COUNT(*), COALESCE(SUM(total_prompt_tokens), 0), COALESCE(SUM(total_completion_tokens), 0),
+        COALESCE(SUM(total_tokens), 0), COALESCE(SUM(request_count), 0),
+        COALESCE(SUM(responses_4xx + responses_5xx), 0), COALESCE(SUM(total_cost), 0)
+    FROM sessions WHERE `+summaryFilter+`;`, summaryArgs(query)...)
+	err := row.Scan(&summary.Sessions, &summary.PromptTokens, &summary.CompletionTokens, &summary.TotalTokens,
+		&summary.Requests, &summary.Errors, &summary.TotalCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize sessions: %w", err)
+	}
+
+	for _, top := range []struct {
+		list    *[]entities.SessionRank
+		where   string
+		orderBy string
+	}{
+		{&summary.TopByTokens, "", "total_tokens"},
+		{&summary.TopByCost, "", "total_cost"},
+		{&summary.TopByRequests, "", "request_count"},
+		{&summary.TopByErrorRate, " AND responses_2xx + responses_4xx + responses_5xx > 0", "error_rate"},
+	} {
+		*top.list, err = r.rankSessions(query, top.where, top.orderBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// rankSessions returns the selected sessions with the highest values of orderBy
+func (r *SQLiteRepository) rankSessions(query entities.SessionSummaryQuery, where, orderBy string) ([]entities.SessionRank, error) {
+	rows, err := r.db.Query(`
+    SELECT session_id, total_tokens, total_cost, request_count, errors,
+        CASE WHEN responses > 0 THEN CAST(errors AS REAL) / responses ELSE 0 END AS error_rate
+    FROM (
+        SELECT session_id, COALESCE(total_tokens, 0) AS total_tokens, COALESCE(total_cost, 0) AS total_cost,
+            COALESCE(request_count, 0) AS request_count, responses_4xx + responses_5xx AS errors,
+            responses_2xx + responses_4xx + responses_5xx AS responses
+        FROM sessions WHERE `+summaryFilter+where+`
+    )
+    ORDER BY `+orderBy+` DESC, session_id LIMIT ?;`, append(summaryArgs(query), query.Limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank sessions by %s: %w", orderBy, err)
+	}
+	defer rows.Close()
+
+	ranks := []entities.SessionRank{}
+	for rows.Next() {
+		var rank entities.SessionRank
+		if err := rows.Scan(&rank.SessionID, &rank.TotalTokens, &rank.TotalCost, &rank.RequestCount, &rank.Errors, &rank.ErrorRate); err != nil {
+			return nil, fmt.Errorf("failed to scan session rank row: %w", err)
+		}
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during session rank iteration: %w", err)
+	}
+	return ranks, nil
+}
+
+// summaryArgs returns the arguments of summaryFilter
+func summaryArgs(query entities.SessionSummaryQuery) []any {
+	prefix := ""
+	if query.TenantID != "" {
+		prefix = query.TenantID + "/"
+	}
+	windowed := 0
+	if !query.ActiveSince.IsZero() {
+		windowed = 1
+	}
+	return []any{query.TenantID, prefix, prefix, windowed, query.ActiveSince.UTC()}
+}
@@ -0,0 +1,258 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_SummarizeSessions(t *testing.T) {
+	testSummaryRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_SummarizeSessions(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testSummaryRepository(t, repo)
+}
+
+func testSummaryRepository(t *testing.T, repo interface {
+	repository.Repository
+	repository.SummaryRepository
+}) {
+	t.Helper()
+
+	sessions := []struct {
+		id          string
+		usage       entities.TokenUsage
+		ok, errored int
+	}{
+		{"heavy", entities.TokenUsage{PromptTokens: 700, CompletionTokens: 300, TotalTokens: 1000, Cost: 0.5}, 4, 0},
+		{"pricey", entities.TokenUsage{PromptTokens: 100, CompletionTokens: 100, TotalTokens: 200, Cost: 2}, 1, 1},
+		{"flaky", entities.TokenUsage{TotalTokens: 10}, 0, 3},
+		{"idle", entities.TokenUsage{}, 0, 0},
+		{"acme/s1", entities.TokenUsage{TotalTokens: 50}, 1, 0},
+	}
+	for _, s := range sessions {
+		if _, err := repo.CreateSession(s.id); err != nil {
+			t.Fatalf("CreateSession(%s) error = %v", s.id, err)
+		}
+		if s.usage.TotalTokens > 0 {
+			if _, err := repo.UpdateSessionTokens(s.id, s.usage); err != nil {
+				t.Fatalf("UpdateSessionTokens(%s) error = %v", s.id, err)
+			}
+		}
+		for i := 0; i < s.ok+s.errored; i++ {
+			status := 200
+			if i >= s.ok {
+				status = 500
+			}
+			if err := repo.RecordSessionResponse(s.id, entities.SessionResponse{StatusCode: status, At: time.Now()}); err != nil {
+				t.Fatalf("RecordSessionResponse(%s) error = %v", s.id, err)
+			}
+		}
+	}
+
+	summary, err := repo.SummarizeSessions(entities.SessionSummaryQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("SummarizeSessions() error = %v", err)
+	}
+	if summary.Sessions != 5 || summary.TotalTokens != 1260 || summary.PromptTokens != 800 || summary.Requests != 4 || summary.Errors != 4 || summary.TotalCost != 2.5 {
+		t.Errorf("SummarizeSessions() totals = %+v", summary)
+	}
+	ids := func(ranks []entities.SessionRank) []string {
+		var out []string
+		for _, rank := range ranks {
+			out = append(out, rank.SessionID)
+		}
+		return out
+	}
+	checks := []struct {
+		name string
+		got  []entities.SessionRank
+		want []string
+	}{
+		{"tokens", summary.TopByTokens, []string{"heavy", "pricey"}},
+		{"cost", summary.TopByCost, []string{"pricey", "heavy"}},
+		{"requests", summary.TopByRequests, []string{"acme/s1", "flaky"}},
+		{"error rate", summary.TopByErrorRate, []string{"flaky", "pricey"}},
+	}
+	for _, check := range checks {
+		if got := ids(check.got); len(got) != len(check.want) || got[0] != check.want[0] || got[1] != check.want[1] {
+			t.Errorf("top by %s = %v, want %v", check.name, got, check.want)
+		}
+	}
+	if rank := summary.TopByErrorRate[1]; rank.Errors != 1 || rank.ErrorRate != 0.5 {
+		t.Errorf("error rate rank = %+v, want 1 error at 0.5", rank)
+	}
+
+	tenant, err := repo.SummarizeSessions(entities.SessionSummaryQuery{TenantID: "acme", Limit: 10})
+	if err != nil {
+		t.Fatalf("SummarizeSessions(acme) error = %v", err)
+	}
+	if tenant.Sessions != 1 || len(tenant.TopByTokens) != 1 || tenant.TopByTokens[0].SessionID != "acme/s1" {
+		t.Errorf("SummarizeSessions(acme) = %+v, want only acme/s1", tenant)
+	}
+
+	future, err := repo.SummarizeSessions(entities.SessionSummaryQuery{ActiveSince: time.Now().Add(time.Hour), Limit: 10})
+	if err != nil {
+		t.Fatalf("SummarizeSessions(future) error = %v", err)
+	}
+	if future.Sessions != 0 || len(future.TopByTokens) != 0 || future.TopByTokens == nil {
+		t.Errorf("SummarizeSessions(future) = %+v, want no sessions and empty lists", future)
+	}
+}
+
+func TestMemoryRepository_FindSessions(t *testing.T) {
+	testFindSessions(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_FindSessions(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testFindSessions(t, repo)
+}
+
+func testFindSessions(t *testing.T, repo interface {
+	repository.Repository
+	repository.SummaryRepository
+}) {
+	t.Helper()
+
+	sessions := map[string]entities.TokenUsage{
+		"batch:1":      {TotalTokens: 1000, Cost: 0.5},
+		"batch:2":      {TotalTokens: 10, Cost: 0.01},
+		"chat":         {TotalTokens: 500, Cost: 2},
+		"acme/batch:3": {TotalTokens: 2000, Cost: 1},
+		"acme/chat":    {TotalTokens: 5},
+	}
+	for id, usage := range sessions {
+		if _, err := repo.CreateSession(id); err != nil {
+			t.Fatalf("CreateSession(%s) error = %v", id, err)
+		}
+		if _, err := repo.UpdateSessionTokens(id, usage); err != nil {
+			t.Fatalf("UpdateSessionTokens(%s) error = %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter entities.SessionFilter
+		want   []string
+	}{
+		{"no filter", entities.SessionFilter{}, []string{"batch:1", "batch:2", "chat", "acme/batch:3", "acme/chat"}},
+		{"min tokens", entities.SessionFilter{MinTokens: 500}, []string{"batch:1", "chat", "acme/batch:3"}},
+		{"min cost", entities.SessionFilter{MinCost: 1}, []string{"chat", "acme/batch:3"}},
+		{"tag", entities.SessionFilter{Tag: "batch"}, []string{"batch:1", "batch:2"}},
+		{"tenant", entities.SessionFilter{TenantID: "acme"}, []string{"acme/batch:3", "acme/chat"}},
+		{"tenant tag and tokens", entities.SessionFilter{TenantID: "acme", Tag: "batch", MinTokens: 100}, []string{"acme/batch:3"}},
+		{"recently active", entities.SessionFilter{ActiveSince: time.Now().Add(-time.Hour)}, []string{"batch:1", "batch:2", "chat", "acme/batch:3", "acme/chat"}},
+		{"inactive", entities.SessionFilter{ActiveSince: time.Now().Add(time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := repo.FindSessions(tt.filter)
+			if err != nil {
+				t.Fatalf("FindSessions() error = %v", err)
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("FindSessions() returned %d sessions, want %v", len(found), tt.want)
+			}
+			for _, id := range tt.want {
+				if sess, ok := found[id]; !ok || sess.SessionID != id || sess.TotalTokens != sessions[id].TotalTokens {
+					t.Errorf("FindSessions()[%s] = %+v, want the session", id, sess)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRepository_SummarizeGroup(t *testing.T) {
+	testSummarizeGroup(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_SummarizeGroup(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testSummarizeGroup(t, repo)
+}
+
+func testSummarizeGroup(t *testing.T, repo interface {
+	repository.Repository
+	repository.SummaryRepository
+}) {
+	t.Helper()
+
+	sessions := []struct {
+		id       string
+		metadata map[string]string
+		usage    entities.TokenUsage
+	}{
+		{"chat-1", map[string]string{entities.UserIDMetadataKey: "u1", entities.ProjectIDMetadataKey: "p1"}, entities.TokenUsage{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100, Cost: 0.25}},
+		{"chat-2", map[string]string{entities.UserIDMetadataKey: "u1"}, entities.TokenUsage{PromptTokens: 200, CompletionTokens: 100, TotalTokens: 300, Cost: 0.5}},
+		{"chat-3", map[string]string{entities.UserIDMetadataKey: "u2", entities.ProjectIDMetadataKey: "p1"}, entities.TokenUsage{TotalTokens: 7}},
+		{"chat-4", nil, entities.TokenUsage{TotalTokens: 1000}},
+		{"acme/chat-1", map[string]string{entities.UserIDMetadataKey: "u1"}, entities.TokenUsage{TotalTokens: 50}},
+	}
+	for _, s := range sessions {
+		if _, err := repo.CreateSession(s.id); err != nil {
+			t.Fatalf("CreateSession(%s) error = %v", s.id, err)
+		}
+		if _, err := repo.UpdateSessionTokens(s.id, s.usage); err != nil {
+			t.Fatalf("UpdateSessionTokens(%s) error = %v", s.id, err)
+		}
+		if s.metadata != nil {
+			if _, err := repo.SetSessionMetadata(s.id, s.metadata); err != nil {
+				t.Fatalf("SetSessionMetadata(%s) error = %v", s.id, err)
+			}
+		}
+	}
+	if err := repo.RecordSessionResponse("chat-2", entities.SessionResponse{StatusCode: 500, At: time.Now()}); err != nil {
+		t.Fatalf("RecordSessionResponse() error = %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		tenantID, key, id string
+		wantSessions      []string
+		wantTokens        int
+		wantPromptTokens  int
+		wantCost          float64
+	}{
+		{"user across sessions", "", entities.UserIDMetadataKey, "u1", []string{"chat-2", "chat-1", "acme/chat-1"}, 450, 260, 0.75},
+		{"project", "", entities.ProjectIDMetadataKey, "p1", []string{"chat-1", "chat-3"}, 107, 60, 0.25},
+		{"tenant", "acme", entities.UserIDMetadataKey, "u1", []string{"acme/chat-1"}, 50, 0, 0},
+		{"unknown user", "", entities.UserIDMetadataKey, "u3", nil, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, err := repo.SummarizeGroup(tt.tenantID, tt.key, tt.id)
+			if err != nil {
+				t.Fatalf("SummarizeGroup() error = %v", err)
+			}
+			if group.GroupKey != tt.key || group.GroupID != tt.id || group.Sessions != len(tt.wantSessions) ||
+				group.TotalTokens != tt.wantTokens || group.PromptTokens != tt.wantPromptTokens || group.TotalCost != tt.wantCost {
+				t.Errorf("SummarizeGroup() = %+v, want %d sessions with %d tokens, %d prompt tokens and cost %v",
+					group, len(tt.wantSessions), tt.wantTokens, tt.wantPromptTokens, tt.wantCost)
+			}
+			if group.SessionUsage == nil || len(group.SessionUsage) != len(tt.wantSessions) {
+				t.Fatalf("SummarizeGroup() sessions = %+v, want %v", group.SessionUsage, tt.wantSessions)
+			}
+			for i, id := range tt.wantSessions {
+				if group.SessionUsage[i].SessionID != id {
+					t.Errorf("SummarizeGroup() session %d = %s, want %s", i, group.SessionUsage[i].SessionID, id)
+				}
+			}
+		})
+	}
+
+	group, err := repo.SummarizeGroup("", entities.UserIDMetadataKey, "u1")
+	if err != nil {
+		t.Fatalf("SummarizeGroup() error = %v", err)
+	}
+	if group.Errors != 1 || group.SessionUsage[0].ErrorRate != 1 {
+		t.Errorf("SummarizeGroup() errors = %d, rate of chat-2 = %v, want 1 and 1", group.Errors, group.SessionUsage[0].ErrorRate)
+	}
+}
@@ -0,0 +1,105 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_Tenants(t *testing.T) {
+	testTenantRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_Tenants(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testTenantRepository(t, repo)
+}
+
+func testTenantRepository(t *testing.T, repo repository.TenantRepository) {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	acme := entities.Tenant{ID: "acme", Name: "Acme", UpstreamAPIKey: "sk-acme", RequestsPerMinute: 60, CreatedAt: now}
+	if err := repo.CreateTenant(acme); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	if err := repo.CreateTenant(acme); !errors.Is(err, entities.ErrTenantExists) {
+		t.Errorf("CreateTenant() for a taken ID error = %v, want ErrTenantExists", err)
+	}
+	if err := repo.CreateTenant(entities.Tenant{ID: "beta", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+
+	acme.Name = "Acme Corp"
+	acme.Residency = "eu"
+	if err := repo.UpdateTenant(acme); err != nil {
+		t.Fatalf("UpdateTenant() error = %v", err)
+	}
+	if err := repo.UpdateTenant(entities.Tenant{ID: "missing"}); !errors.Is(err, entities.ErrTenantNotFound) {
+		t.Errorf("UpdateTenant() for a missing tenant error = %v, want ErrTenantNotFound", err)
+	}
+	got, err := repo.GetTenant("acme")
+	if err != nil {
+		t.Fatalf("GetTenant() error = %v", err)
+	}
+	if got.Name != "Acme Corp" || got.UpstreamAPIKey != "sk-acme" || got.RequestsPerMinute != 60 || got.Residency != "eu" ||
+		!got.CreatedAt.Equal(now) {
+		t.Errorf("GetTenant() = %+v, want the updated tenant", got)
+	}
+	tenants, err := repo.ListTenants()
+	if err != nil || len(tenants) != 2 || tenants[0].ID != "acme" || tenants[1].ID != "beta" {
+		t.Errorf("ListTenants() = %+v, %v, want acme and beta", tenants, err)
+	}
+
+	key := entities.VirtualKey{ID: "k1", TenantID: "acme", Name: "ci", Hash: "hash-1", SigningSecret: "secret", CreatedAt: now}
+	if err := repo.CreateVirtualKey(key); err != nil {
+		t.Fatalf("CreateVirtualKey() error = %v", err)
+	}
+	if err := repo.CreateVirtualKey(entities.VirtualKey{ID: "k2", TenantID: "missing", Hash: "hash-2", CreatedAt: now}); !errors.Is(err, entities.ErrTenantNotFound) {
+		t.Errorf("CreateVirtualKey() for a missing tenant error = %v, want ErrTenantNotFound", err)
+	}
+	gotKey, err := repo.GetVirtualKeyByHash("hash-1")
+	if err != nil || gotKey.ID != "k1" || gotKey.TenantID != "acme" || gotKey.Name != "ci" {
+		t.Errorf("GetVirtualKeyByHash() = %+v, %v, want key k1 of acme", gotKey, err)
+	}
+	if gotKey, err := repo.GetVirtualKey("k1"); err != nil || gotKey.Hash != "hash-1" || gotKey.SigningSecret != "secret" {
+		t.Errorf("GetVirtualKey() = %+v, %v, want key k1 with its signing secret", gotKey, err)
+	}
+	if _, err := repo.GetVirtualKey("missing"); !errors.Is(err, entities.ErrVirtualKeyNotFound) {
+		t.Errorf("GetVirtualKey() of a missing key error = %v, want ErrVirtualKeyNotFound", err)
+	}
+	if keys, err := repo.ListVirtualKeys("acme"); err != nil || len(keys) != 1 {
+		t.Errorf("ListVirtualKeys() = %+v, %v, want one key", keys, err)
+	}
+	key.Name = "ci-eu"
+	key.UpstreamAPIKeys = []string{"sk-eu-1", "sk-eu-2"}
+	if err := repo.UpdateVirtualKey(key); err != nil {
+		t.Fatalf("UpdateVirtualKey() error = %v", err)
+	}
+	if gotKey, err := repo.GetVirtualKeyByHash("hash-1"); err != nil || gotKey.Name != "ci-eu" || len(gotKey.UpstreamAPIKeys) != 2 || gotKey.UpstreamAPIKeys[1] != "sk-eu-2" || gotKey.SigningSecret != "secret" {
+		t.Errorf("GetVirtualKeyByHash() after update = %+v, %v, want the new name and upstream keys", gotKey, err)
+	}
+	if err := repo.UpdateVirtualKey(entities.VirtualKey{ID: "k1", TenantID: "beta"}); !errors.Is(err, entities.ErrVirtualKeyNotFound) {
+		t.Errorf("UpdateVirtualKey() of another tenant's key error = %v, want ErrVirtualKeyNotFound", err)
+	}
+	if err := repo.DeleteVirtualKey("beta", "k1"); !errors.Is(err, entities.ErrVirtualKeyNotFound) {
+		t.Errorf("DeleteVirtualKey() of another tenant's key error = %v, want ErrVirtualKeyNotFound", err)
+	}
+
+	if err := repo.DeleteTenant("acme"); err != nil {
+		t.Fatalf("DeleteTenant() error = %v", err)
+	}
+	if _, err := repo.GetTenant("acme"); !errors.Is(err, entities.ErrTenantNotFound) {
+		t.Errorf("GetTenant() after delete error = %v, want ErrTenantNotFound", err)
+	}
+	if _, err := repo.GetVirtualKeyByHash("hash-1"); !errors.Is(err, entities.ErrVirtualKeyNotFound) {
+		t.Errorf("GetVirtualKeyByHash() after deleting the tenant error = %v, want ErrVirtualKeyNotFound", err)
+	}
+	if err := repo.DeleteTenant("acme"); !errors.Is(err, entities.ErrTenantNotFound) {
+		t.Errorf("DeleteTenant() twice error = %v, want ErrTenantNotFound", err)
+	}
+}
@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestMemoryRepository_Threads(t *testing.T) {
+	testThreadRepository(t, repository.NewMemoryRepository())
+}
+
+func TestSQLiteRepository_Threads(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+	testThreadRepository(t, repo)
+}
+
+func testThreadRepository(t *testing.T, repo repository.ThreadRepository) {
+	t.Helper()
+
+	if _, err := repo.GetThreadSession("thread_1"); !errors.Is(err, entities.ErrThreadNotFound) {
+		t.Errorf("GetThreadSession() of an unmapped thread error = %v, want ErrThreadNotFound", err)
+	}
+	if err := repo.SetThreadSession("thread_1", "agent-1"); err != nil {
+		t.Fatalf("SetThreadSession() error = %v", err)
+	}
+	if err := repo.SetThreadSession("thread_1", "agent-2"); err != nil {
+		t.Fatalf("SetThreadSession() again error = %v", err)
+	}
+	if sessionID, err := repo.GetThreadSession("thread_1"); err != nil || sessionID != "agent-2" {
+		t.Errorf("GetThreadSession() = %q, %v, want the latest mapping agent-2", sessionID, err)
+	}
+	if err := repo.DeleteThreadSession("thread_1"); err != nil {
+		t.Errorf("DeleteThreadSession() error = %v", err)
+	}
+	if err := repo.DeleteThreadSession("thread_1"); !errors.Is(err, entities.ErrThreadNotFound) {
+		t.Errorf("DeleteThreadSession() twice error = %v, want ErrThreadNotFound", err)
+	}
+
+	if first, err := repo.MarkRunAccounted("run_1"); err != nil || !first {
+		t.Errorf("MarkRunAccounted() = %v, %v, want true", first, err)
+	}
+	if first, err := repo.MarkRunAccounted("run_1"); err != nil || first {
+		t.Errorf("MarkRunAccounted() twice = %v, %v, want false", first, err)
+	}
+}
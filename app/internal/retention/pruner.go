@@ -0,0 +1,132 @@
+// Package retention deletes stored data once it is older than its configured
+// retention, so the database stays bounded.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Store interface {
+	DeleteRequestRecordsBefore(before time.Time) (int, error)
+	DeleteFinishedJobsBefore(before time.Time) (int, error)
+	DeleteIdleSessions(before time.Time) (int, error)
+}
+
+// Counter records named counts
+type Counter interface {
+	Add(name string, delta int64)
+}
+
+// Metric names of the pruner's counters
+const (
+	PrunedRequestRecordsMetric = "pruned_request_records_total"
+	PrunedJobsMetric           = "pruned_jobs_total"
+	PrunedSessionsMetric       = "pruned_sessions_total"
+	PruneErrorsMetric          = "prune_errors_total"
+)
+
+// Leader reports whether this instance runs the background tasks of its replicas
+type Leader interface {
+	IsLeader() bool
+}
+
+// Pruner deletes request records, finished jobs and idle sessions once they
+// are older than the retention policy allows
+type Pruner struct {
+	store    Store
+	policy   entities.RetentionPolicy
+	metrics  Counter
+	interval time.Duration
+	now      func() time.Time
+	leader   Leader
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPruner creates a new Pruner enforcing policy every interval
+func NewPruner(store Store, policy entities.RetentionPolicy, metrics Counter, interval time.Duration) *Pruner {
+	return &Pruner{
+		store:    store,
+		policy:   policy,
+		metrics:  metrics,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// SetLeader limits background pruning to the instance leader elects; Prune
+// itself runs on any instance
+func (p *Pruner) SetLeader(leader Leader) {
+	p.leader = leader
+}
+
+// Start prunes in the background until Close is called
+func (p *Pruner) Start() {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				if p.leader != nil && !p.leader.IsLeader() {
+					continue
+				}
+				if _, err := p.Prune(); err != nil {
+					log.Printf("Error pruning stored data: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Prune deletes the data that outlived its retention and returns how many
+// rows of each kind it deleted. Kinds without a retention are kept; a failure
+// to prune one kind does not stop the others.
+func (p *Pruner) Prune() (entities.PruneResult, error) {
+	var result entities.PruneResult
+	var errs []error
+	now := p.now()
+	prune := func(retention time.Duration, deleteBefore func(time.Time) (int, error), deleted *int, metric, what string) {
+		if retention <= 0 {
+			return
+		}
+		n, err := deleteBefore(now.Add(-retention))
+		*deleted = n
+		if n > 0 {
+			p.metrics.Add(metric, int64(n))
+			log.Printf("Deleted %d %s older than %v", n, what, retention)
+		}
+		if err != nil {
+			p.metrics.Add(PruneErrorsMetric, 1)
+			errs = append(errs, err)
+		}
+	}
+	prune(p.policy.RequestHistory, p.store.DeleteRequestRecordsBefore, &result.RequestRecords, PrunedRequestRecordsMetric, "request records")
+	prune(p.policy.Jobs, p.store.DeleteFinishedJobsBefore, &result.Jobs, PrunedJobsMetric, "finished jobs")
+	prune(p.policy.Sessions, p.store.DeleteIdleSessions, &result.Sessions, PrunedSessionsMetric, "idle sessions")
+	if len(errs) > 0 {
+		return result, fmt.Errorf("failed to prune stored data: %w", errors.Join(errs...))
+	}
+	return result, nil
+}
+
+// Close stops background pruning
+func (p *Pruner) Close() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.stop = nil
+}
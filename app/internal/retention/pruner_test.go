@@ -0,0 +1,66 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func TestPruner_Prune(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, time.Hour} {
+		repo.SaveRequestRecord(entities.RequestRecord{Path: "/v1/chat/completions", CreatedAt: now.Add(-age)})
+	}
+	for id, job := range map[string]entities.Job{
+		"old-completed": {Status: entities.JobStatusCompleted, UpdatedAt: now.Add(-48 * time.Hour)},
+		"old-queued":    {Status: entities.JobStatusQueued, UpdatedAt: now.Add(-48 * time.Hour)},
+		"new-failed":    {Status: entities.JobStatusFailed, UpdatedAt: now},
+	} {
+		job.ID = id
+		repo.CreateJob(job)
+	}
+	repo.CreateSession("idle")
+	registry := metrics.NewMetrics()
+
+	pruner := NewPruner(repo, entities.RetentionPolicy{RequestHistory: 24 * time.Hour, Jobs: 24 * time.Hour}, registry, time.Hour)
+	got, err := pruner.Prune()
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if want := (entities.PruneResult{RequestRecords: 1, Jobs: 1}); got != want {
+		t.Errorf("Prune() = %+v, want %+v", got, want)
+	}
+	records, _ := repo.ListRequestRecords(entities.HistoryQuery{Limit: 10})
+	if len(records) != 1 {
+		t.Errorf("records after Prune() = %d, want 1", len(records))
+	}
+	for id, wantErr := range map[string]error{"old-completed": entities.ErrJobNotFound, "old-queued": nil, "new-failed": nil} {
+		if _, err := repo.GetJob(id); err != wantErr {
+			t.Errorf("GetJob(%s) error = %v, want %v", id, err, wantErr)
+		}
+	}
+	if _, err := repo.GetSession("idle"); err != nil {
+		t.Errorf("session without a retention was deleted: %v", err)
+	}
+
+	// Sessions expire once they have been idle for the retention period
+	pruner = NewPruner(repo, entities.RetentionPolicy{Sessions: 24 * time.Hour}, registry, time.Hour)
+	pruner.now = func() time.Time { return now.Add(25 * time.Hour) }
+	if got, err := pruner.Prune(); err != nil || got.Sessions != 1 {
+		t.Errorf("Prune() = %+v, %v, want 1 session", got, err)
+	}
+	if _, err := repo.GetSession("idle"); err != entities.ErrSessionNotFound {
+		t.Errorf("GetSession(idle) error = %v, want ErrSessionNotFound", err)
+	}
+
+	snapshot := registry.Snapshot()
+	for metric, want := range map[string]int64{PrunedRequestRecordsMetric: 1, PrunedJobsMetric: 1, PrunedSessionsMetric: 1} {
+		if snapshot[metric] != want {
+			t.Errorf("%s = %d, want %d", metric, snapshot[metric], want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileSource reads a secret from a file, such as a Docker or Kubernetes
+// secret mount. Surrounding whitespace is ignored.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource creates a new FileSource for the file at path
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Fetch reads the file
+func (s *FileSource) Fetch(ctx context.Context) (string, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", s.path)
+	}
+	return secret, nil
+}
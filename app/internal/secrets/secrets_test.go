@@ -0,0 +1,190 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestFileSource_Fetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openai_api_key")
+	if err := os.WriteFile(path, []byte("sk-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := NewFileSource(path).Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if secret != "sk-file" {
+		t.Errorf("Fetch() = %q, want %q", secret, "sk-file")
+	}
+
+	if err := os.WriteFile(path, []byte("  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileSource(path).Fetch(context.Background()); err == nil {
+		t.Error("Fetch() error = nil, want an error for an empty file")
+	}
+}
+
+func TestVaultSource_Fetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{"kv v2", `{"data":{"data":{"api_key":"sk-vault"},"metadata":{"version":3}}}`, "sk-vault", false},
+		{"kv v1", `{"data":{"api_key":"sk-vault-v1"}}`, "sk-vault-v1", false},
+		{"missing field", `{"data":{"data":{"other":"x"}}}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/secret/data/proxy" || r.Header.Get("X-Vault-Token") != "vault-token" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			source := NewVaultSource(server.URL+"/", "vault-token", "/secret/data/proxy", "api_key", server.Client())
+			secret, err := source.Fetch(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if secret != tt.want {
+				t.Errorf("Fetch() = %q, want %q", secret, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSSource_Fetch(t *testing.T) {
+	var authorization, target, token, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		target = r.Header.Get("X-Amz-Target")
+		token = r.Header.Get("X-Amz-Security-Token")
+		payload, _ := io.ReadAll(r.Body)
+		body = string(payload)
+		w.Write([]byte(`{"Name":"proxy","SecretString":"{\"api_key\":\"sk-aws\"}"}`))
+	}))
+	defer server.Close()
+
+	source := NewAWSSource("eu-west-1", server.URL, "proxy", "api_key", entities.AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+	}, server.Client())
+	source.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	secret, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if secret != "sk-aws" {
+		t.Errorf("Fetch() = %q, want %q", secret, "sk-aws")
+	}
+	if target != "secretsmanager.GetSecretValue" || body != `{"SecretId":"proxy"}` || token != "session" {
+		t.Errorf("request = (%q, %q, %q), want a GetSecretValue call for proxy", target, body, token)
+	}
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-west-1/secretsmanager/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="
+	if !strings.HasPrefix(authorization, wantPrefix) || len(authorization) != len(wantPrefix)+64 {
+		t.Errorf("Authorization = %q, want a SigV4 signature with prefix %q", authorization, wantPrefix)
+	}
+}
+
+func TestAWSSource_FetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+	}))
+	defer server.Close()
+
+	source := NewAWSSource("eu-west-1", server.URL, "missing", "", entities.AWSCredentials{AccessKeyID: "id", SecretAccessKey: "secret"}, server.Client())
+	if _, err := source.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Fetch() error = %v, want the Secrets Manager error", err)
+	}
+}
+
+type stubSource struct {
+	mu     sync.Mutex
+	secret string
+	err    error
+}
+
+func (s *stubSource) Fetch(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.secret, s.err
+}
+
+type recordingConsumer struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (c *recordingConsumer) SetAPIKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = append(c.keys, key)
+}
+
+func TestWatcher_Refresh(t *testing.T) {
+	source := &stubSource{secret: "key-1"}
+	consumer := &recordingConsumer{}
+	watcher := NewWatcher(source, "key-1", time.Minute, time.Second, consumer)
+
+	if changed, err := watcher.Refresh(); changed || err != nil {
+		t.Errorf("Refresh() = (%v, %v), want (false, nil) for an unchanged key", changed, err)
+	}
+
+	source.secret = "key-2"
+	if changed, err := watcher.Refresh(); !changed || err != nil {
+		t.Errorf("Refresh() = (%v, %v), want (true, nil) for a rotated key", changed, err)
+	}
+
+	source.err = errors.New("vault sealed")
+	if changed, err := watcher.Refresh(); changed || err == nil {
+		t.Errorf("Refresh() = (%v, %v), want an error when the source fails", changed, err)
+	}
+
+	if len(consumer.keys) != 1 || consumer.keys[0] != "key-2" {
+		t.Errorf("consumer keys = %v, want [key-2]", consumer.keys)
+	}
+}
+
+func TestWatcher_Start(t *testing.T) {
+	source := &stubSource{secret: "key-2"}
+	consumer := &recordingConsumer{}
+	watcher := NewWatcher(source, "key-1", 10*time.Millisecond, time.Second, consumer)
+	watcher.Start()
+	defer watcher.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		consumer.mu.Lock()
+		rotated := len(consumer.keys) > 0
+		consumer.mu.Unlock()
+		if rotated {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("watcher did not rotate the key")
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// VaultSource reads a field of a HashiCorp Vault KV secret over the HTTP API.
+// Both KV version 2 (paths like secret/data/name) and version 1 are supported.
+type VaultSource struct {
+	addr   string
+	token  string
+	path   string
+	field  string
+	client *http.Client
+}
+
+// NewVaultSource creates a new VaultSource for the secret at path on the Vault
+// server at addr, authenticating with token
+func NewVaultSource(addr, token, path, field string, client *http.Client) *VaultSource {
+	return &VaultSource{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		path:   strings.Trim(path, "/"),
+		field:  field,
+		client: client,
+	}
+}
+
+// Fetch reads the secret from Vault
+func (s *VaultSource) Fetch(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.addr+"/v1/"+s.path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	data := secret.Data
+	// KV version 2 nests the secret's fields under data.data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	value, ok := data[s.field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("vault secret %s has no field %q", s.path, s.field)
+	}
+	return value, nil
+}
@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Source fetches the current value of a secret
+type Source interface {
+	Fetch(ctx context.Context) (string, error)
+}
+
+// KeyConsumer uses an API key that can be replaced at runtime
+type KeyConsumer interface {
+	SetAPIKey(key string)
+}
+
+// Watcher polls a secret source and hands rotated values to its consumers,
+// so keys can be rotated without a restart.
+type Watcher struct {
+	source    Source
+	interval  time.Duration
+	timeout   time.Duration
+	consumers []KeyConsumer
+
+	mu      sync.Mutex
+	current string
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWatcher creates a new Watcher for a secret whose current value is
+// initial. Each poll is bounded by timeout.
+func NewWatcher(source Source, initial string, interval, timeout time.Duration, consumers ...KeyConsumer) *Watcher {
+	return &Watcher{
+		source:    source,
+		interval:  interval,
+		timeout:   timeout,
+		consumers: consumers,
+		current:   initial,
+	}
+}
+
+// Start polls the source in the background until Close is called
+func (w *Watcher) Start() {
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if _, err := w.Refresh(); err != nil {
+					log.Printf("Error refreshing API key, keeping the current key: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh fetches the secret once and reports whether it changed. On error
+// the consumers keep their current key.
+func (w *Watcher) Refresh() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	secret, err := w.source.Fetch(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if secret == w.current {
+		return false, nil
+	}
+	w.current = secret
+	for _, consumer := range w.consumers {
+		consumer.SetAPIKey(secret)
+	}
+	log.Printf("API key rotated")
+	return true, nil
+}
+
+// Close stops background polling
+func (w *Watcher) Close() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+}
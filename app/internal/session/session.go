@@ -1,7 +1,13 @@
 package session
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
 )
@@ -13,16 +19,24 @@ type Repository interface {
 	CreateSession(sessionID string) (*entities.SessionData, error)
 	UpdateSessionTokens(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
 	ListSessions() (map[string]*entities.SessionData, error)
+	RecordSessionResponse(sessionID string, response entities.SessionResponse) error
+}
+
+type TokenEstimator interface {
+	EstimateUsage(requestBody, responseBody []byte) *entities.TokenUsage
 }
 
 type SessionManager struct {
 	repository Repository
+	estimator  TokenEstimator
 }
 
-// NewSessionManager creates a new SessionManager with the provided repository
-func NewSessionManager(repo Repository) *SessionManager {
+// NewSessionManager creates a new SessionManager with the provided repository.
+// The estimator is optional; when nil, usage is never estimated locally.
+func NewSessionManager(repo Repository, estimator TokenEstimator) *SessionManager {
 	return &SessionManager{
 		repository: repo,
+		estimator:  estimator,
 	}
 }
 
@@ -49,26 +63,298 @@ func (sm *SessionManager) UpdateSessionTokens(sessionID string, tokenUsage entit
 	return sm.repository.UpdateSessionTokens(sessionID, tokenUsage)
 }
 
-// ParseTokenUsageFromResponse extracts token usage from OpenAI API response body
-func (sm *SessionManager) ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error) {
-	var response struct {
-		Usage entities.TokenUsage `json:"usage"`
+// RecordResponse counts a response to a session request by status class.
+// The message is kept as the session's last error for 4xx and 5xx responses,
+// which are also counted by error type when it is known.
+func (sm *SessionManager) RecordResponse(sessionID string, statusCode int, message, errorType string) error {
+	response := entities.SessionResponse{
+		StatusCode: statusCode,
+		At:         time.Now(),
 	}
+	if statusCode >= 400 {
+		response.Error = message
+		response.ErrorType = errorType
+		if response.Error == "" {
+			response.Error = http.StatusText(statusCode)
+		}
+	}
+	return sm.repository.RecordSessionResponse(sessionID, response)
+}
 
-	err := json.Unmarshal(responseBody, &response)
+// ParseTokenUsageFromResponse extracts token usage from OpenAI API response body.
+// It understands chat and legacy completions, embeddings (prompt tokens only),
+// the Responses API (input/output tokens), batch output files (JSONL, one
+// result per line), whose usage is summed, and server-sent event streams,
+// where the last event that reports usage wins.
+func (sm *SessionManager) ParseTokenUsageFromResponse(responseBody []byte) (*entities.TokenUsage, error) {
+	usage, err := parseUsageObject(responseBody)
 	if err != nil {
-		return nil, err
+		// Batch output files are JSON Lines rather than a single object
+		batchUsage, ok := parseBatchUsage(responseBody)
+		if !ok {
+			batchUsage, ok = parseStreamUsage(responseBody)
+		}
+		if !ok {
+			return nil, err
+		}
+		usage = batchUsage
 	}
 
 	// Return nil if no usage data found (some endpoints might not include usage)
-	if response.Usage.TotalTokens == 0 {
+	if usage.TotalTokens == 0 {
 		return nil, nil
 	}
 
-	return &response.Usage, nil
+	return &usage, nil
+}
+
+// parseUsageObject extracts usage from a single JSON response, including a
+// Responses API stream event where the usage is nested under response and a
+// batch result line where it is nested under response.body.
+func parseUsageObject(body []byte) (entities.TokenUsage, error) {
+	type rawUsage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		InputTokens      int `json:"input_tokens"`
+		OutputTokens     int `json:"output_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	}
+	var response struct {
+		Usage    rawUsage `json:"usage"`
+		Response struct {
+			Usage rawUsage `json:"usage"`
+			Body  struct {
+				Usage rawUsage `json:"usage"`
+			} `json:"body"`
+		} `json:"response"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return entities.TokenUsage{}, err
+	}
+
+	raw := response.Usage
+	if raw == (rawUsage{}) {
+		raw = response.Response.Usage
+	}
+	if raw == (rawUsage{}) {
+		raw = response.Response.Body.Usage
+	}
+
+	usage := entities.TokenUsage{
+		PromptTokens:     raw.PromptTokens + raw.InputTokens,
+		CompletionTokens: raw.CompletionTokens + raw.OutputTokens,
+		TotalTokens:      raw.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage, nil
+}
+
+// parseBatchUsage sums usage over a JSONL batch output. It reports false if
+// any non-empty line is not valid JSON.
+func parseBatchUsage(body []byte) (entities.TokenUsage, bool) {
+	var total entities.TokenUsage
+	lines := 0
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		usage, err := parseUsageObject(line)
+		if err != nil {
+			return entities.TokenUsage{}, false
+		}
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+		lines++
+	}
+	return total, lines > 0
+}
+
+// parseStreamUsage extracts usage from a server-sent event stream. Chat
+// completions report it in the last chunk when stream_options.include_usage is
+// set and the Responses API in the response.completed event, so the last event
+// that reports usage is taken. It reports false if no event carries usage.
+func parseStreamUsage(body []byte) (entities.TokenUsage, bool) {
+	var last entities.TokenUsage
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		usage, err := parseUsageObject([]byte(data))
+		if err != nil || usage.TotalTokens == 0 {
+			continue
+		}
+		last = usage
+		found = true
+	}
+	return last, found
+}
+
+// ParseToolCalls counts the tool and function calls the model requested in a
+// response by function name: those of chat completions, including legacy
+// function calls, and the function_call output items of the Responses API. It
+// understands the same batch outputs and event streams as the usage parser;
+// a streamed call is counted by the delta that names it, and a streamed
+// response by its response.completed event. It returns nil if there are none.
+func (sm *SessionManager) ParseToolCalls(responseBody []byte) map[string]int {
+	counts := make(map[string]int)
+	if countToolCalls(responseBody, counts) != nil {
+		for _, line := range bytes.Split(responseBody, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				line = bytes.TrimSpace(data)
+			}
+			if len(line) == 0 || line[0] != '{' {
+				continue
+			}
+			countToolCalls(line, counts)
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+	return counts
+}
+
+// countToolCalls adds the tool calls of a single JSON response, stream chunk
+// or batch result line to counts
+func countToolCalls(body []byte, counts map[string]int) error {
+	type rawMessage struct {
+		ToolCalls []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+		FunctionCall struct {
+			Name string `json:"name"`
+		} `json:"function_call"`
+	}
+	type rawChoices []struct {
+		Message rawMessage `json:"message"`
+		Delta   rawMessage `json:"delta"`
+	}
+	type rawOutput []struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	var response struct {
+		Choices  rawChoices `json:"choices"`
+		Output   rawOutput  `json:"output"`
+		Response struct {
+			Output rawOutput `json:"output"`
+			Body   struct {
+				Choices rawChoices `json:"choices"`
+				Output  rawOutput  `json:"output"`
+			} `json:"body"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+
+	add := func(name string) {
+		if name != "" {
+			counts[name]++
+		}
+	}
+	for _, choices := range []rawChoices{response.Choices, response.Response.Body.Choices} {
+		for _, choice := range choices {
+			for _, message := range []rawMessage{choice.Message, choice.Delta} {
+				for _, call := range message.ToolCalls {
+					add(call.Function.Name)
+				}
+				add(message.FunctionCall.Name)
+			}
+		}
+	}
+	for _, output := range []rawOutput{response.Output, response.Response.Output, response.Response.Body.Output} {
+		for _, item := range output {
+			if item.Type == "function_call" {
+				add(item.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// EstimateTokenUsage estimates token usage locally for responses that don't report it.
+// The returned usage is marked as estimated; nil means nothing could be estimated.
+func (sm *SessionManager) EstimateTokenUsage(requestBody, responseBody []byte) *entities.TokenUsage {
+	if sm.estimator == nil {
+		return nil
+	}
+	return sm.estimator.EstimateUsage(requestBody, responseBody)
 }
 
 // ListSessions returns all session data (for debugging/monitoring)
 func (sm *SessionManager) ListSessions() (map[string]*entities.SessionData, error) {
 	return sm.repository.ListSessions()
 }
+
+// ParseMediaUsage extracts the usage of endpoints that are not billed in
+// tokens: the images returned by image generation, edits and variations, the
+// seconds of audio transcribed or translated, and the characters of input
+// converted to speech. Token usage reported alongside (e.g. by gpt-image-1) is
+// kept. It returns nil for other paths or if nothing was measured.
+func (sm *SessionManager) ParseMediaUsage(path string, requestBody, responseBody []byte) *entities.TokenUsage {
+	var usage entities.TokenUsage
+	switch {
+	case strings.HasPrefix(path, "/v1/images/"):
+		var response struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(responseBody, &response) != nil {
+			return nil
+		}
+		usage, _ = parseUsageObject(responseBody)
+		usage.Images = len(response.Data)
+	case path == "/v1/audio/transcriptions" || path == "/v1/audio/translations":
+		var response struct {
+			// Duration is reported by the verbose_json format
+			Duration float64 `json:"duration"`
+			Usage    struct {
+				Type    string  `json:"type"`
+				Seconds float64 `json:"seconds"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal(responseBody, &response) != nil {
+			// Streamed transcriptions report token usage in their last event;
+			// the text, srt and vtt formats report no usage
+			usage, _ = parseStreamUsage(responseBody)
+			break
+		}
+		if response.Usage.Type == "duration" {
+			usage.AudioSeconds = response.Usage.Seconds
+		} else {
+			usage, _ = parseUsageObject(responseBody)
+			usage.AudioSeconds = response.Duration
+		}
+	case path == "/v1/audio/speech":
+		var request struct {
+			Input string `json:"input"`
+		}
+		if json.Unmarshal(requestBody, &request) != nil {
+			return nil
+		}
+		usage.Characters = utf8.RuneCountInString(request.Input)
+	default:
+		return nil
+	}
+
+	if usage.TotalTokens == 0 && usage.Images == 0 && usage.AudioSeconds == 0 && usage.Characters == 0 {
+		return nil
+	}
+	return &usage
+}
@@ -14,6 +14,7 @@ type mockRepository struct {
 	CreateSessionFunc       func(sessionID string) (*entities.SessionData, error)
 	UpdateSessionTokensFunc func(sessionID string, usage entities.TokenUsage) (*entities.SessionData, error)
 	ListSessionsFunc        func() (map[string]*entities.SessionData, error)
+	RecordResponseFunc      func(sessionID string, response entities.SessionResponse) error
 	InitFunc                func() error
 	CloseFunc               func() error
 }
@@ -54,10 +55,16 @@ func (m *mockRepository) ListSessions() (map[string]*entities.SessionData, error
 	}
 	return nil, errors.New("ListSessionsFunc not implemented")
 }
+func (m *mockRepository) RecordSessionResponse(sessionID string, response entities.SessionResponse) error {
+	if m.RecordResponseFunc != nil {
+		return m.RecordResponseFunc(sessionID, response)
+	}
+	return errors.New("RecordResponseFunc not implemented")
+}
 
 func TestSessionManager_PassthroughMethods(t *testing.T) {
 	mockRepo := &mockRepository{}
-	sm := session.NewSessionManager(mockRepo)
+	sm := session.NewSessionManager(mockRepo, nil)
 
 	// Test GetSession
 	expectedSession := &entities.SessionData{SessionID: "s1"}
@@ -119,8 +126,44 @@ func TestSessionManager_PassthroughMethods(t *testing.T) {
 	}
 }
 
+func TestSessionManager_RecordResponse(t *testing.T) {
+	mockRepo := &mockRepository{}
+	sm := session.NewSessionManager(mockRepo, nil)
+
+	var got []entities.SessionResponse
+	mockRepo.RecordResponseFunc = func(sessionID string, response entities.SessionResponse) error {
+		if sessionID != "s1" {
+			t.Errorf("RecordSessionResponse: session = %q, want s1", sessionID)
+		}
+		got = append(got, response)
+		return nil
+	}
+
+	sm.RecordResponse("s1", 200, "ignored", "")
+	sm.RecordResponse("s1", 429, "Rate limit reached", entities.RateLimitErrorType)
+	sm.RecordResponse("s1", 503, "", "")
+
+	if len(got) != 3 {
+		t.Fatalf("RecordSessionResponse called %d times, want 3", len(got))
+	}
+	if got[0].Error != "" {
+		t.Errorf("successful response error = %q, want empty", got[0].Error)
+	}
+	if got[1].Error != "Rate limit reached" || got[1].ErrorType != entities.RateLimitErrorType {
+		t.Errorf("429 error = %q (%q), want the given message and type", got[1].Error, got[1].ErrorType)
+	}
+	if got[2].Error != "Service Unavailable" {
+		t.Errorf("503 error = %q, want the status text", got[2].Error)
+	}
+	for _, response := range got {
+		if response.At.IsZero() {
+			t.Error("response time not set")
+		}
+	}
+}
+
 func TestSessionManager_ParseTokenUsageFromResponse(t *testing.T) {
-	sm := session.NewSessionManager(nil) // Repository not needed for this method
+	sm := session.NewSessionManager(nil, nil) // Repository not needed for this method
 
 	validBody := []byte(`{"usage": {"prompt_tokens": 10, "completion_tokens": 20, "total_tokens": 30}}`)
 	expectedUsage := &entities.TokenUsage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30}
@@ -140,4 +183,209 @@ func TestSessionManager_ParseTokenUsageFromResponse(t *testing.T) {
 	if err == nil {
 		t.Errorf("ParseTokenUsageFromResponse(invalid json): got err nil, want error. Usage: %+v", usage)
 	}
+
+	tests := []struct {
+		name string
+		body string
+		want *entities.TokenUsage
+	}{
+		{
+			name: "embeddings",
+			body: `{"object":"list","data":[],"usage":{"prompt_tokens":8,"total_tokens":8}}`,
+			want: &entities.TokenUsage{PromptTokens: 8, TotalTokens: 8},
+		},
+		{
+			name: "embeddings without total",
+			body: `{"usage":{"prompt_tokens":8}}`,
+			want: &entities.TokenUsage{PromptTokens: 8, TotalTokens: 8},
+		},
+		{
+			name: "responses api",
+			body: `{"object":"response","usage":{"input_tokens":12,"output_tokens":30,"total_tokens":42}}`,
+			want: &entities.TokenUsage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+		},
+		{
+			name: "legacy completions",
+			body: `{"object":"text_completion","usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+			want: &entities.TokenUsage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12},
+		},
+		{
+			name: "batch output",
+			body: `{"custom_id":"a","response":{"status_code":200,"body":{"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}}}
+{"custom_id":"b","response":{"status_code":200,"body":{"usage":{"prompt_tokens":4,"completion_tokens":5,"total_tokens":9}}}}
+`,
+			want: &entities.TokenUsage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12},
+		},
+		{
+			name: "responses api stream",
+			body: "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"status\":\"in_progress\",\"usage\":null}}\n\n" +
+				"event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n" +
+				"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"status\":\"completed\",\"usage\":{\"input_tokens\":9,\"output_tokens\":2,\"total_tokens\":11}}}\n\n",
+			want: &entities.TokenUsage{PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11},
+		},
+		{
+			name: "chat completions stream with usage",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":6,\"completion_tokens\":1,\"total_tokens\":7}}\n\ndata: [DONE]\n\n",
+			want: &entities.TokenUsage{PromptTokens: 6, CompletionTokens: 1, TotalTokens: 7},
+		},
+	}
+	for _, tt := range tests {
+		usage, err := sm.ParseTokenUsageFromResponse([]byte(tt.body))
+		if err != nil || !reflect.DeepEqual(usage, tt.want) {
+			t.Errorf("ParseTokenUsageFromResponse(%s): got (%+v, %v), want (%+v, nil)", tt.name, usage, err, tt.want)
+		}
+	}
+}
+
+func TestSessionManager_ParseToolCalls(t *testing.T) {
+	sm := session.NewSessionManager(nil, nil)
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]int
+	}{
+		{
+			name: "chat completion",
+			body: `{"choices":[{"message":{"role":"assistant","tool_calls":[` +
+				`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}},` +
+				`{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{}"}},` +
+				`{"id":"call_3","type":"function","function":{"name":"search","arguments":"{}"}}]}}]}`,
+			want: map[string]int{"get_weather": 2, "search": 1},
+		},
+		{
+			name: "legacy function call",
+			body: `{"choices":[{"message":{"role":"assistant","function_call":{"name":"search","arguments":"{}"}}}]}`,
+			want: map[string]int{"search": 1},
+		},
+		{
+			name: "responses api",
+			body: `{"object":"response","output":[{"type":"message","content":[]},{"type":"function_call","name":"search","arguments":"{}"}]}`,
+			want: map[string]int{"search": 1},
+		},
+		{
+			name: "chat completions stream",
+			body: "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"name\":\"search\",\"arguments\":\"\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"function\":{\"name\":\"get_weather\",\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			want: map[string]int{"search": 1, "get_weather": 1},
+		},
+		{
+			name: "responses api stream",
+			body: "event: response.output_item.done\ndata: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"name\":\"search\"}}\n\n" +
+				"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"output\":[{\"type\":\"function_call\",\"name\":\"search\"}]}}\n\n",
+			want: map[string]int{"search": 1},
+		},
+		{
+			name: "batch output",
+			body: `{"custom_id":"a","response":{"status_code":200,"body":{"choices":[{"message":{"tool_calls":[{"function":{"name":"search"}}]}}]}}}
+{"custom_id":"b","response":{"status_code":200,"body":{"choices":[{"message":{"content":"Hi"}}]}}}
+`,
+			want: map[string]int{"search": 1},
+		},
+		{
+			name: "no tool calls",
+			body: `{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`,
+		},
+		{
+			name: "not json",
+			body: `{invalid`,
+		},
+	}
+	for _, tt := range tests {
+		if got := sm.ParseToolCalls([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseToolCalls(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+type mockEstimator struct {
+	usage *entities.TokenUsage
+}
+
+func (m *mockEstimator) EstimateUsage(requestBody, responseBody []byte) *entities.TokenUsage {
+	return m.usage
+}
+
+func TestSessionManager_EstimateTokenUsage(t *testing.T) {
+	sm := session.NewSessionManager(nil, nil)
+	if usage := sm.EstimateTokenUsage([]byte(`{}`), []byte(`{}`)); usage != nil {
+		t.Errorf("EstimateTokenUsage without estimator = %+v, want nil", usage)
+	}
+
+	expected := &entities.TokenUsage{TotalTokens: 5, Estimated: true}
+	sm = session.NewSessionManager(nil, &mockEstimator{usage: expected})
+	if usage := sm.EstimateTokenUsage([]byte(`{}`), []byte(`{}`)); usage != expected {
+		t.Errorf("EstimateTokenUsage = %+v, want %+v", usage, expected)
+	}
+}
+
+func TestSessionManager_ParseMediaUsage(t *testing.T) {
+	sm := session.NewSessionManager(nil, nil)
+
+	tests := []struct {
+		name         string
+		path         string
+		requestBody  string
+		responseBody string
+		want         *entities.TokenUsage
+	}{
+		{
+			name:         "image generation",
+			path:         "/v1/images/generations",
+			requestBody:  `{"model":"dall-e-3","prompt":"a cat","n":1}`,
+			responseBody: `{"created":1,"data":[{"url":"https://example.com/1.png"},{"url":"https://example.com/2.png"}]}`,
+			want:         &entities.TokenUsage{Images: 2},
+		},
+		{
+			name:         "image generation with token usage",
+			path:         "/v1/images/edits",
+			responseBody: `{"data":[{"b64_json":"..."}],"usage":{"input_tokens":50,"output_tokens":1056,"total_tokens":1106}}`,
+			want:         &entities.TokenUsage{PromptTokens: 50, CompletionTokens: 1056, TotalTokens: 1106, Images: 1},
+		},
+		{
+			name:         "verbose transcription",
+			path:         "/v1/audio/transcriptions",
+			responseBody: `{"task":"transcribe","duration":8.47,"text":"Hello"}`,
+			want:         &entities.TokenUsage{AudioSeconds: 8.47},
+		},
+		{
+			name:         "transcription billed by duration",
+			path:         "/v1/audio/translations",
+			responseBody: `{"text":"Hello","usage":{"type":"duration","seconds":9}}`,
+			want:         &entities.TokenUsage{AudioSeconds: 9},
+		},
+		{
+			name:         "transcription billed by tokens",
+			path:         "/v1/audio/transcriptions",
+			responseBody: `{"text":"Hello","usage":{"type":"tokens","input_tokens":14,"output_tokens":45,"total_tokens":59}}`,
+			want:         &entities.TokenUsage{PromptTokens: 14, CompletionTokens: 45, TotalTokens: 59},
+		},
+		{
+			name:         "text transcription",
+			path:         "/v1/audio/transcriptions",
+			responseBody: "Hello\n",
+			want:         nil,
+		},
+		{
+			name:        "speech",
+			path:        "/v1/audio/speech",
+			requestBody: `{"model":"tts-1","input":"Grüße!","voice":"alloy"}`,
+			want:        &entities.TokenUsage{Characters: 6},
+		},
+		{
+			name:         "chat completions",
+			path:         "/v1/chat/completions",
+			responseBody: `{"usage":{"total_tokens":3}}`,
+			want:         nil,
+		},
+	}
+	for _, tt := range tests {
+		usage := sm.ParseMediaUsage(tt.path, []byte(tt.requestBody), []byte(tt.responseBody))
+		if !reflect.DeepEqual(usage, tt.want) {
+			t.Errorf("ParseMediaUsage(%s) = %+v, want %+v", tt.name, usage, tt.want)
+		}
+	}
 }
@@ -0,0 +1,141 @@
+package shadow
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	SaveShadowResult(result entities.ShadowResult) error
+}
+
+// Mirror wraps a queue and asynchronously sends a sample of requests to a
+// secondary target, so another model or provider can be evaluated against
+// production traffic. Clients only ever receive the primary response.
+type Mirror struct {
+	next     Queue
+	target   Queue
+	store    Store
+	settings entities.ShadowSettings
+}
+
+// NewMirror creates a new Mirror in front of next, sending shadow requests to
+// target. When store is nil, shadow responses are discarded.
+func NewMirror(next Queue, target Queue, store Store, settings entities.ShadowSettings) *Mirror {
+	return &Mirror{
+		next:     next,
+		target:   target,
+		store:    store,
+		settings: settings,
+	}
+}
+
+// Push forwards the request and, if it is sampled, mirrors it in the background
+func (m *Mirror) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if !m.sampled(r) {
+		return m.next.Push(r)
+	}
+
+	// The primary body is stored for comparison
+	r.StreamResponseAbove = 0
+	primaryDone := make(chan entities.ProxyResponse, 1)
+	start := time.Now()
+	go m.mirror(r, start, primaryDone)
+
+	resp := m.next.Push(r)
+	primaryDone <- resp
+	return resp
+}
+
+// sampled reports whether the request is eligible and selected for mirroring.
+// Streamed bodies cannot be replayed, and requests are not mirrored out of
+// their residency region.
+func (m *Mirror) sampled(r entities.ProxyRequest) bool {
+	if m.settings.Percent <= 0 || r.BodyStream != nil || !entities.RegionSatisfies(m.settings.Region, r.Residency) {
+		return false
+	}
+	eligible := false
+	for _, prefix := range m.settings.Paths {
+		if strings.HasPrefix(r.Path, prefix) {
+			eligible = true
+			break
+		}
+	}
+	return eligible && rand.Float64()*100 < m.settings.Percent
+}
+
+// mirror sends the shadow request and records it alongside the primary response
+func (m *Mirror) mirror(r entities.ProxyRequest, start time.Time, primaryDone <-chan entities.ProxyResponse) {
+	primaryModel := entities.BodyModel(r.Body)
+	body := r.Body
+	if m.settings.Model != "" {
+		body = withModel(r.Body, m.settings.Model)
+	}
+	headers := r.Headers.Clone()
+	if headers != nil {
+		// Shadow bodies are stored for comparison, so request them uncompressed
+		headers.Del("Accept-Encoding")
+	}
+
+	shadowStart := time.Now()
+	shadowResp := m.target.Push(entities.ProxyRequest{
+		Method:  r.Method,
+		Path:    r.Path,
+		Headers: headers,
+		Body:    body,
+	})
+	shadowLatency := time.Since(shadowStart)
+
+	primaryResp := <-primaryDone
+	primaryLatency := time.Since(start)
+	if m.store == nil {
+		return
+	}
+
+	result := entities.ShadowResult{
+		Path:             r.Path,
+		PrimaryModel:     primaryModel,
+		ShadowModel:      entities.BodyModel(body),
+		PrimaryStatus:    primaryResp.StatusCode,
+		ShadowStatus:     shadowResp.StatusCode,
+		PrimaryLatencyMs: primaryLatency.Milliseconds(),
+		ShadowLatencyMs:  shadowLatency.Milliseconds(),
+		PrimaryBody:      string(primaryResp.DecodedBody()),
+		ShadowBody:       string(shadowResp.Body),
+		CreatedAt:        time.Now(),
+	}
+	if shadowResp.Err != nil {
+		result.ShadowError = shadowResp.Err.Error()
+	}
+	if err := m.store.SaveShadowResult(result); err != nil {
+		log.Printf("Error saving shadow result: %v", err)
+	}
+}
+
+// withModel returns the body with its model field replaced. Bodies that are
+// not JSON objects are returned unchanged.
+func withModel(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	encodedModel, err := json.Marshal(model)
+	if err != nil {
+		return body
+	}
+	fields["model"] = encodedModel
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
@@ -0,0 +1,109 @@
+package shadow_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/shadow"
+)
+
+type echoQueue struct {
+	body string
+	mu   sync.Mutex
+	got  []entities.ProxyRequest
+}
+
+func (q *echoQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.mu.Lock()
+	q.got = append(q.got, r)
+	q.mu.Unlock()
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Headers: http.Header{}, Body: []byte(q.body)}
+}
+
+func (q *echoQueue) requests() []entities.ProxyRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]entities.ProxyRequest(nil), q.got...)
+}
+
+type resultStore struct {
+	saved chan entities.ShadowResult
+}
+
+func (s *resultStore) SaveShadowResult(result entities.ShadowResult) error {
+	s.saved <- result
+	return nil
+}
+
+func TestMirror_MirrorsSampledRequests(t *testing.T) {
+	primary := &echoQueue{body: `{"answer":"primary"}`}
+	target := &echoQueue{body: `{"answer":"shadow"}`}
+	store := &resultStore{saved: make(chan entities.ShadowResult, 1)}
+	m := shadow.NewMirror(primary, target, store, entities.ShadowSettings{
+		Percent: 100,
+		Model:   "gpt-4o-mini",
+		Paths:   []string{"/v1/chat/completions"},
+	})
+
+	resp := m.Push(entities.ProxyRequest{
+		Method:  http.MethodPost,
+		Path:    "/v1/chat/completions",
+		Headers: http.Header{"Accept-Encoding": []string{"gzip"}},
+		Body:    []byte(`{"model":"gpt-4o","messages":[]}`),
+	})
+	if string(resp.Body) != `{"answer":"primary"}` {
+		t.Errorf("Push() body = %s, want the primary response", resp.Body)
+	}
+
+	var result entities.ShadowResult
+	select {
+	case result = <-store.saved:
+	case <-time.After(time.Second):
+		t.Fatal("shadow result was not saved")
+	}
+	if result.PrimaryModel != "gpt-4o" || result.ShadowModel != "gpt-4o-mini" {
+		t.Errorf("result models = %s/%s, want gpt-4o/gpt-4o-mini", result.PrimaryModel, result.ShadowModel)
+	}
+	if result.PrimaryBody != `{"answer":"primary"}` || result.ShadowBody != `{"answer":"shadow"}` {
+		t.Errorf("result bodies = %s/%s, want both responses", result.PrimaryBody, result.ShadowBody)
+	}
+
+	shadowReqs := target.requests()
+	if len(shadowReqs) != 1 {
+		t.Fatalf("shadow target received %d requests, want 1", len(shadowReqs))
+	}
+	if shadowReqs[0].Headers.Get("Accept-Encoding") != "" {
+		t.Error("shadow request kept Accept-Encoding, want it removed")
+	}
+}
+
+func TestMirror_SkipsIneligibleRequests(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  entities.ShadowSettings
+		path      string
+		residency string
+	}{
+		{"disabled", entities.ShadowSettings{Percent: 0, Paths: []string{"/v1/"}}, "/v1/chat/completions", ""},
+		{"path not eligible", entities.ShadowSettings{Percent: 100, Paths: []string{"/v1/chat/completions"}}, "/v1/files", ""},
+		{"target outside the residency", entities.ShadowSettings{Percent: 100, Paths: []string{"/v1/"}, Region: "us"}, "/v1/chat/completions", "eu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &echoQueue{body: `{}`}
+			target := &echoQueue{body: `{}`}
+			m := shadow.NewMirror(primary, target, nil, tt.settings)
+
+			m.Push(entities.ProxyRequest{Method: http.MethodPost, Path: tt.path, Body: []byte(`{}`), Residency: tt.residency})
+			time.Sleep(20 * time.Millisecond)
+
+			if got := len(target.requests()); got != 0 {
+				t.Errorf("shadow target received %d requests, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package tenant
+
+import (
+	"fmt"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Residency is a queue decorator that keeps the requests of tenants in the
+// region they require. Requests of a tenant whose residency the primary
+// upstream's region does not satisfy are refused; the others carry the
+// residency, so they are not hedged or mirrored to upstreams elsewhere.
+type Residency struct {
+	next    Queue
+	tenants TenantGetter
+	// region is the primary upstream's; empty when it is not configured
+	region string
+}
+
+// NewResidency creates a new Residency in front of next. Region is the
+// primary upstream's region.
+func NewResidency(next Queue, tenants TenantGetter, region string) *Residency {
+	return &Residency{
+		next:    next,
+		tenants: tenants,
+		region:  region,
+	}
+}
+
+// Push refuses the request if the upstream is outside its tenant's region,
+// and forwards it with the residency otherwise. Requests checked when their
+// tenant was resolved are forwarded as they are; the tenant of the others,
+// such as async jobs, is looked up when they run, so a changed residency
+// applies to queued jobs too.
+func (rs *Residency) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if r.TenantID == "" || r.ResidencyChecked {
+		return rs.next.Push(r)
+	}
+	tenant, err := rs.tenants.GetTenant(r.TenantID)
+	if err != nil {
+		return entities.ProxyResponse{Err: fmt.Errorf("failed to get tenant %s: %w", r.TenantID, err)}
+	}
+	if err := entities.CheckResidency(tenant, rs.region); err != nil {
+		return entities.ProxyResponse{Err: err}
+	}
+	r.Residency = tenant.Residency
+	return rs.next.Push(r)
+}
@@ -0,0 +1,204 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/httperr"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/ratelimit"
+)
+
+type Store interface {
+	GetTenant(id string) (*entities.Tenant, error)
+	GetVirtualKey(id string) (*entities.VirtualKey, error)
+	GetVirtualKeyByHash(hash string) (*entities.VirtualKey, error)
+}
+
+// exemptPaths are served without a tenant
+var exemptPaths = map[string]bool{
+	"/version": true,
+}
+
+// Resolver identifies the tenant of each public request, enforces the
+// tenant's rate limit and stores the tenant ID in the request context
+type Resolver struct {
+	store    Store
+	settings entities.TenantSettings
+	now      func() time.Time
+	limiter  *ratelimit.Limiter
+	seen     *replayCache
+	// checkResidency refuses tenants whose residency region does not satisfy
+	checkResidency bool
+	region         string
+}
+
+// NewResolver creates a new Resolver identifying tenants as configured by settings
+func NewResolver(store Store, settings entities.TenantSettings) *Resolver {
+	return &Resolver{
+		store:    store,
+		settings: settings,
+		now:      time.Now,
+		limiter:  ratelimit.NewLimiter(),
+		seen:     newReplayCache(),
+	}
+}
+
+// WithResidency makes the resolver refuse the requests of tenants whose
+// residency the primary upstream's region does not satisfy, before they
+// reach authorization, request filters or any other upstream
+func (tr *Resolver) WithResidency(region string) *Resolver {
+	tr.checkResidency = true
+	tr.region = region
+	return tr
+}
+
+// Middleware rejects requests without a known tenant and passes the others on
+// with the tenant ID, and the ID of the virtual key they were made with, in
+// their context
+func (tr *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenant, keyID, reqErr := tr.Resolve(r)
+		if reqErr != nil {
+			writeError(w, reqErr)
+			return
+		}
+		if wait, ok := tr.allow(tenant); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, &entities.RequestError{
+				StatusCode: http.StatusTooManyRequests,
+				Message:    fmt.Sprintf("Tenant %s exceeded its limit of %d requests per minute", tenant.ID, tenant.RequestsPerMinute),
+				Type:       "rate_limit_error",
+				Code:       "tenant_rate_limit_exceeded",
+			})
+			return
+		}
+		ctx := entities.ContextWithTenant(r.Context(), tenant.ID)
+		if tr.checkResidency {
+			ctx = entities.ContextWithResidency(ctx, tenant.Residency)
+		}
+		if keyID != "" {
+			ctx = entities.ContextWithVirtualKey(ctx, keyID)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Resolve finds the tenant of a request and, in key mode, the virtual key it
+// was made with. Credentials identifying the tenant are removed so that they
+// are not sent upstream. With WithResidency, tenants the primary upstream may
+// not serve are refused. The tenant's rate limit is left to the caller.
+func (tr *Resolver) Resolve(r *http.Request) (*entities.Tenant, string, *entities.RequestError) {
+	var tenantID, keyID string
+	switch tr.settings.Mode {
+	case entities.TenantModeHeader:
+		tenantID = r.Header.Get(tr.settings.Header)
+		r.Header.Del(tr.settings.Header)
+		if tenantID == "" {
+			return nil, "", unauthorized("Missing tenant header "+tr.settings.Header, "missing_tenant")
+		}
+	case entities.TenantModeKey:
+		if isSigned(r) {
+			r.Header.Del("Authorization")
+			virtualKey, reqErr := tr.verifySignature(r)
+			if reqErr != nil {
+				return nil, "", reqErr
+			}
+			tenantID, keyID = virtualKey.TenantID, virtualKey.ID
+			break
+		}
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		r.Header.Del("Authorization")
+		if !ok || key == "" {
+			return nil, "", unauthorized("Missing API key", "invalid_api_key")
+		}
+		virtualKey, err := tr.store.GetVirtualKeyByHash(HashKey(key))
+		if err != nil {
+			if errors.Is(err, entities.ErrVirtualKeyNotFound) {
+				return nil, "", unauthorized("Incorrect API key provided", "invalid_api_key")
+			}
+			return nil, "", storeError(err)
+		}
+		if virtualKey.SigningSecret != "" {
+			return nil, "", unauthorized("Key "+virtualKey.ID+" only accepts signed requests", "signature_required")
+		}
+		tenantID, keyID = virtualKey.TenantID, virtualKey.ID
+	case entities.TenantModePath:
+		rest, ok := strings.CutPrefix(r.URL.Path, "/t/")
+		id, path, found := strings.Cut(rest, "/")
+		if !ok || !found || id == "" {
+			return nil, "", &entities.RequestError{
+				StatusCode: http.StatusNotFound,
+				Message:    "Requests must be prefixed with /t/{tenant}",
+				Type:       "invalid_request_error",
+				Code:       "missing_tenant",
+			}
+		}
+		tenantID = id
+		r.URL.Path = "/" + path
+		r.URL.RawPath = ""
+	}
+
+	tenant, err := tr.store.GetTenant(tenantID)
+	if err != nil {
+		if errors.Is(err, entities.ErrTenantNotFound) {
+			return nil, "", unauthorized("Unknown tenant "+tenantID, "invalid_tenant")
+		}
+		return nil, "", storeError(err)
+	}
+	if tr.checkResidency {
+		if err := entities.CheckResidency(tenant, tr.region); err != nil {
+			return nil, "", &entities.RequestError{
+				StatusCode: http.StatusForbidden,
+				Message:    "Request refused by the data residency policy: " + err.Error(),
+				Type:       "permission_error",
+				Code:       "residency_violation",
+			}
+		}
+	}
+	return tenant, keyID, nil
+}
+
+// allow takes a token from the tenant's bucket, which holds a minute's worth
+// of requests. If the bucket is empty it reports how long until the next token.
+func (tr *Resolver) allow(tenant *entities.Tenant) (time.Duration, bool) {
+	return tr.limiter.Allow(tenant.ID, tr.now(), tenant.RequestsPerMinute, tenant.RequestsPerMinute)
+}
+
+func unauthorized(message, code string) *entities.RequestError {
+	return &entities.RequestError{
+		StatusCode: http.StatusUnauthorized,
+		Message:    message,
+		Type:       "invalid_request_error",
+		Code:       code,
+	}
+}
+
+func storeError(err error) *entities.RequestError {
+	log.Printf("Error resolving tenant: %v", err)
+	return &entities.RequestError{
+		StatusCode: http.StatusInternalServerError,
+		Message:    "Failed to resolve tenant",
+		Type:       "server_error",
+		Code:       "internal_error",
+	}
+}
+
+// writeError writes a rejection, challenging clients that sent no credentials
+func writeError(w http.ResponseWriter, reqErr *entities.RequestError) {
+	if reqErr.StatusCode == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="llm-queue-proxy"`)
+	}
+	httperr.Write(w, reqErr)
+}
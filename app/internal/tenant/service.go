@@ -0,0 +1,157 @@
+package tenant
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// keyPrefix starts every virtual key so they are easy to recognise in logs and configs
+const keyPrefix = "sk-llmqp-"
+
+type ServiceStore interface {
+	CreateTenant(tenant entities.Tenant) error
+	UpdateTenant(tenant entities.Tenant) error
+	GetTenant(id string) (*entities.Tenant, error)
+	ListTenants() ([]entities.Tenant, error)
+	DeleteTenant(id string) error
+	CreateVirtualKey(key entities.VirtualKey) error
+	UpdateVirtualKey(key entities.VirtualKey) error
+	GetVirtualKey(id string) (*entities.VirtualKey, error)
+	ListVirtualKeys(tenantID string) ([]entities.VirtualKey, error)
+	DeleteVirtualKey(tenantID, id string) error
+	ListSessions() (map[string]*entities.SessionData, error)
+}
+
+// Service manages tenants and their virtual keys for the admin API
+type Service struct {
+	ServiceStore
+	now func() time.Time
+}
+
+// NewService creates a new Service backed by store
+func NewService(store ServiceStore) *Service {
+	return &Service{
+		ServiceStore: store,
+		now:          time.Now,
+	}
+}
+
+// CreateTenant stores a new tenant. It returns entities.ErrTenantExists if the ID is taken.
+func (s *Service) CreateTenant(tenant entities.Tenant) (*entities.Tenant, error) {
+	tenant.CreatedAt = s.now().UTC()
+	if err := s.ServiceStore.CreateTenant(tenant); err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// UpdateTenant applies a partial update to an existing tenant
+func (s *Service) UpdateTenant(id string, update entities.TenantUpdate) (*entities.Tenant, error) {
+	tenant, err := s.GetTenant(id)
+	if err != nil {
+		return nil, err
+	}
+	updated := update.Apply(*tenant)
+	if err := s.ServiceStore.UpdateTenant(updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// IssueKey creates a virtual key for a tenant. The plaintext key is only
+// available in the result; the store keeps its hash. A signing key also gets
+// a secret to sign requests with and only accepts signed requests.
+func (s *Service) IssueKey(tenantID string, req entities.VirtualKeyRequest) (*entities.IssuedKey, error) {
+	id, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+	key := keyPrefix + id + "-" + secret
+
+	issued := &entities.IssuedKey{
+		VirtualKey: entities.VirtualKey{
+			ID:              id,
+			TenantID:        tenantID,
+			Name:            req.Name,
+			Hash:            HashKey(key),
+			UpstreamAPIKeys: req.UpstreamAPIKeys,
+			CreatedAt:       s.now().UTC(),
+		},
+		Key: key,
+	}
+	if req.Signing {
+		signingSecret, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		issued.VirtualKey.SigningSecret = signingSecret
+		issued.SigningSecret = signingSecret
+	}
+	if err := s.CreateVirtualKey(issued.VirtualKey); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// UpdateKey applies a partial update to a tenant's virtual key
+func (s *Service) UpdateKey(tenantID, id string, update entities.VirtualKeyUpdate) (*entities.VirtualKey, error) {
+	key, err := s.GetVirtualKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.TenantID != tenantID {
+		return nil, entities.ErrVirtualKeyNotFound
+	}
+	updated := update.Apply(*key)
+	if err := s.UpdateVirtualKey(updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Usage aggregates the token usage of a tenant's sessions
+func (s *Service) Usage(tenantID string) (*entities.TenantUsage, error) {
+	if _, err := s.GetTenant(tenantID); err != nil {
+		return nil, err
+	}
+	sessions, err := s.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &entities.TenantUsage{TenantID: tenantID}
+	for id, sess := range sessions {
+		if owner, _ := entities.SplitTenantSessionID(id); owner != tenantID {
+			continue
+		}
+		usage.Sessions++
+		usage.RequestCount += sess.RequestCount
+		usage.TotalPromptTokens += sess.TotalPromptTokens
+		usage.TotalCompletionTokens += sess.TotalCompletionTokens
+		usage.TotalTokens += sess.TotalTokens
+	}
+	return usage, nil
+}
+
+// HashKey returns the hash a virtual key is stored and looked up by
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
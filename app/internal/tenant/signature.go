@@ -0,0 +1,179 @@
+package tenant
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Headers of a request signed with a virtual key's signing secret
+const (
+	KeyIDHeader         = "X-Key-ID"
+	TimestampHeader     = "X-Signature-Timestamp"
+	ContentDigestHeader = "X-Content-SHA256"
+	SignatureHeader     = "X-Signature"
+)
+
+// DefaultSignatureMaxSkew is used when no maximum clock skew is configured
+const DefaultSignatureMaxSkew = 5 * time.Minute
+
+// Sign computes the signature of a request: the hex HMAC-SHA256 under secret
+// of the timestamp, method, request URI and body digest, one per line
+func Sign(secret, timestamp, method, requestURI, contentDigest string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", timestamp, method, requestURI, contentDigest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the signature headers of a request whose body is body
+func SignRequest(r *http.Request, keyID, secret string, body []byte, now time.Time) {
+	digest := sha256.Sum256(body)
+	contentDigest := hex.EncodeToString(digest[:])
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(KeyIDHeader, keyID)
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(ContentDigestHeader, contentDigest)
+	r.Header.Set(SignatureHeader, Sign(secret, timestamp, r.Method, r.URL.RequestURI(), contentDigest))
+}
+
+// isSigned reports whether a request carries a signature
+func isSigned(r *http.Request) bool {
+	return r.Header.Get(SignatureHeader) != ""
+}
+
+// verifySignature authenticates a signed request and returns its virtual key.
+// The body is read to check its digest and replaced with a buffered copy.
+func (tr *Resolver) verifySignature(r *http.Request) (*entities.VirtualKey, *entities.RequestError) {
+	keyID := r.Header.Get(KeyIDHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	contentDigest := r.Header.Get(ContentDigestHeader)
+	signature := r.Header.Get(SignatureHeader)
+	for _, header := range []string{KeyIDHeader, TimestampHeader, ContentDigestHeader, SignatureHeader} {
+		r.Header.Del(header)
+	}
+	if keyID == "" || timestamp == "" || contentDigest == "" {
+		return nil, unauthorized(fmt.Sprintf("Signed requests need the %s, %s and %s headers", KeyIDHeader, TimestampHeader, ContentDigestHeader), "invalid_signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, unauthorized("Invalid signature timestamp", "invalid_signature")
+	}
+	now := tr.now()
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tr.maxSkew() {
+		return nil, unauthorized(fmt.Sprintf("Signature timestamp is more than %s from the server time", tr.maxSkew()), "signature_expired")
+	}
+
+	virtualKey, err := tr.store.GetVirtualKey(keyID)
+	if err != nil {
+		if errors.Is(err, entities.ErrVirtualKeyNotFound) {
+			return nil, unauthorized("Unknown key ID "+keyID, "invalid_api_key")
+		}
+		return nil, storeError(err)
+	}
+	if virtualKey.SigningSecret == "" {
+		return nil, unauthorized("Key "+keyID+" has no signing secret", "invalid_signature")
+	}
+
+	body, reqErr := tr.readBody(r)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+	digest := sha256.Sum256(body)
+	if !hmac.Equal([]byte(hex.EncodeToString(digest[:])), []byte(contentDigest)) {
+		return nil, unauthorized("Request body does not match "+ContentDigestHeader, "invalid_signature")
+	}
+	expected := Sign(virtualKey.SigningSecret, timestamp, r.Method, r.URL.RequestURI(), contentDigest)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, unauthorized("Invalid request signature", "invalid_signature")
+	}
+	if !tr.seen.add(keyID+":"+signature, now, 2*tr.maxSkew()) {
+		return nil, unauthorized("Request signature was already used", "signature_replayed")
+	}
+	return virtualKey, nil
+}
+
+// readBody buffers the request body, up to the configured limit
+func (tr *Resolver) readBody(r *http.Request) ([]byte, *entities.RequestError) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := io.Reader(r.Body)
+	if tr.settings.MaxBodyBytes > 0 {
+		reader = io.LimitReader(r.Body, tr.settings.MaxBodyBytes+1)
+	}
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		return nil, &entities.RequestError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Failed to read request body",
+			Type:       "invalid_request_error",
+			Code:       "invalid_body",
+		}
+	}
+	if tr.settings.MaxBodyBytes > 0 && int64(len(body)) > tr.settings.MaxBodyBytes {
+		return nil, &entities.RequestError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Message:    fmt.Sprintf("Request body exceeds %d bytes", tr.settings.MaxBodyBytes),
+			Type:       "invalid_request_error",
+			Code:       "request_too_large",
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return body, nil
+}
+
+func (tr *Resolver) maxSkew() time.Duration {
+	if tr.settings.SignatureMaxSkew > 0 {
+		return tr.settings.SignatureMaxSkew
+	}
+	return DefaultSignatureMaxSkew
+}
+
+// replayCache remembers signatures until their timestamps can no longer be
+// accepted, so that each signed request is only served once
+type replayCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{expires: make(map[string]time.Time)}
+}
+
+// add records key for ttl and reports whether it was not already recorded
+func (c *replayCache) add(key string, now time.Time, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) >= time.Minute {
+		c.lastSweep = now
+		for k, expires := range c.expires {
+			if !now.Before(expires) {
+				delete(c.expires, k)
+			}
+		}
+	}
+	if expires, ok := c.expires[key]; ok && now.Before(expires) {
+		return false
+	}
+	c.expires[key] = now.Add(ttl)
+	return true
+}
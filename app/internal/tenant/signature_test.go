@@ -0,0 +1,111 @@
+package tenant
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestResolver_Signature(t *testing.T) {
+	store := newTestStore(t)
+	issued, err := NewService(store).IssueKey("acme", entities.VirtualKeyRequest{Name: "batch", Signing: true})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+	if issued.SigningSecret == "" {
+		t.Fatal("IssueKey() with signing returned no signing secret")
+	}
+	resolver := NewResolver(store, entities.TenantSettings{Mode: entities.TenantModeKey, MaxBodyBytes: 1 << 10})
+	now := time.Unix(1000, 0)
+	resolver.now = func() time.Time { return now }
+
+	const body = `{"model":"gpt-4o"}`
+	signed := func(signedBody, sentBody string, at time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?stream=false", strings.NewReader(sentBody))
+		SignRequest(req, issued.ID, issued.SigningSecret, []byte(signedBody), at)
+		return req
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		var gotBody string
+		rr := httptest.NewRecorder()
+		resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			if r.Header.Get(SignatureHeader) != "" || r.Header.Get(KeyIDHeader) != "" {
+				t.Error("signature headers were passed on")
+			}
+			if tenantID := entities.TenantFromContext(r.Context()); tenantID != "acme" {
+				t.Errorf("tenant = %q, want acme", tenantID)
+			}
+			if keyID := entities.VirtualKeyFromContext(r.Context()); keyID != issued.ID {
+				t.Errorf("virtual key = %q, want %s", keyID, issued.ID)
+			}
+		})).ServeHTTP(rr, signed(body, body, now.Add(-time.Minute)))
+		if rr.Code != http.StatusOK || gotBody != body {
+			t.Errorf("signed request = %d with body %q, want 200 with %q (response %s)", rr.Code, gotBody, body, rr.Body.String())
+		}
+	})
+
+	replayed := signed(body, body, now)
+	if rr, _, _ := serve(resolver, replayed); rr.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		wantCode string
+	}{
+		{"replayed", signed(body, body, now), "signature_replayed"},
+		{"tampered body", signed(body, `{"model":"o1"}`, now.Add(time.Second)), "invalid_signature"},
+		{"stale timestamp", signed(body, body, now.Add(-10*time.Minute)), "signature_expired"},
+		{"too large", signed(strings.Repeat("x", 2<<10), strings.Repeat("x", 2<<10), now), "request_too_large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, tenantID, _ := serve(resolver, tt.req)
+			if rr.Code == http.StatusOK || tenantID != "" || !strings.Contains(rr.Body.String(), tt.wantCode) {
+				t.Errorf("status = %d, body %s, want a %s rejection", rr.Code, rr.Body.String(), tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("wrong secret", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		SignRequest(req, issued.ID, "not-the-secret", []byte(body), now.Add(2*time.Second))
+		if rr, _, _ := serve(resolver, req); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "invalid_signature") {
+			t.Errorf("status = %d, body %s, want 401 invalid_signature", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("bearer with a signing key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+issued.Key)
+		if rr, _, _ := serve(resolver, req); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "signature_required") {
+			t.Errorf("status = %d, body %s, want 401 signature_required", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestReplayCache(t *testing.T) {
+	cache := newReplayCache()
+	now := time.Unix(1000, 0)
+	if !cache.add("a", now, time.Minute) {
+		t.Fatal("add() of a new key = false")
+	}
+	if cache.add("a", now.Add(30*time.Second), time.Minute) {
+		t.Error("add() of a remembered key = true")
+	}
+	if !cache.add("a", now.Add(2*time.Minute), time.Minute) {
+		t.Error("add() of an expired key = false")
+	}
+	if len(cache.expires) != 1 {
+		t.Errorf("cache holds %d keys, want 1 after the sweep", len(cache.expires))
+	}
+}
@@ -0,0 +1,289 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+func newTestStore(t *testing.T) *repository.MemoryRepository {
+	t.Helper()
+	store := repository.NewMemoryRepository()
+	if err := store.CreateTenant(entities.Tenant{ID: "acme", UpstreamAPIKey: "sk-acme"}); err != nil {
+		t.Fatalf("CreateTenant() error = %v", err)
+	}
+	return store
+}
+
+// serve passes a request through the resolver and reports the tenant and path
+// the next handler saw
+func serve(resolver *Resolver, req *http.Request) (rr *httptest.ResponseRecorder, tenantID, path string) {
+	rr = httptest.NewRecorder()
+	resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID = entities.TenantFromContext(r.Context())
+		path = r.URL.Path
+		if keyID := entities.VirtualKeyFromContext(r.Context()); keyID != "" {
+			tenantID += " with key " + keyID
+		}
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Tenant-ID") != "" {
+			path = "credentials leaked"
+		}
+	})).ServeHTTP(rr, req)
+	return rr, tenantID, path
+}
+
+func TestResolver_Modes(t *testing.T) {
+	store := newTestStore(t)
+	issued, err := NewService(store).IssueKey("acme", entities.VirtualKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantTenant string
+		wantPath   string
+	}{
+		{"header", entities.TenantModeHeader, "/v1/models", map[string]string{"X-Tenant-ID": "acme"}, http.StatusOK, "acme", "/v1/models"},
+		{"missing header", entities.TenantModeHeader, "/v1/models", nil, http.StatusUnauthorized, "", ""},
+		{"unknown tenant", entities.TenantModeHeader, "/v1/models", map[string]string{"X-Tenant-ID": "other"}, http.StatusUnauthorized, "", ""},
+		{"virtual key", entities.TenantModeKey, "/v1/models", map[string]string{"Authorization": "Bearer " + issued.Key}, http.StatusOK, "acme with key " + issued.ID, "/v1/models"},
+		{"wrong key", entities.TenantModeKey, "/v1/models", map[string]string{"Authorization": "Bearer sk-llmqp-wrong"}, http.StatusUnauthorized, "", ""},
+		{"path prefix", entities.TenantModePath, "/t/acme/v1/session/s1/chat/completions", nil, http.StatusOK, "acme", "/v1/session/s1/chat/completions"},
+		{"missing path prefix", entities.TenantModePath, "/v1/models", nil, http.StatusNotFound, "", ""},
+		{"exempt path", entities.TenantModeKey, "/version", nil, http.StatusOK, "", "/version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewResolver(store, entities.TenantSettings{Mode: tt.mode, Header: "X-Tenant-ID"})
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rr, tenantID, path := serve(resolver, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tenantID != tt.wantTenant || path != tt.wantPath {
+				t.Errorf("next handler saw tenant %q and path %q, want %q and %q", tenantID, path, tt.wantTenant, tt.wantPath)
+			}
+			if rr.Code != http.StatusOK && !strings.Contains(rr.Body.String(), `"error"`) {
+				t.Errorf("body = %s, want an OpenAI error envelope", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestResolver_RateLimit(t *testing.T) {
+	store := newTestStore(t)
+	store.UpdateTenant(entities.Tenant{ID: "acme", RequestsPerMinute: 2})
+	resolver := NewResolver(store, entities.TenantSettings{Mode: entities.TenantModeHeader, Header: "X-Tenant-ID"})
+	now := time.Unix(1000, 0)
+	resolver.now = func() time.Time { return now }
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("X-Tenant-ID", "acme")
+		rr, _, _ := serve(resolver, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := request(); rr.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i+1, rr.Code, http.StatusOK)
+		}
+	}
+	rr := request()
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request status = %d, Retry-After = %q, want 429 and 30", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	now = now.Add(30 * time.Second)
+	if rr := request(); rr.Code != http.StatusOK {
+		t.Errorf("status after refill = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+type recordingQueue struct {
+	requests []entities.ProxyRequest
+}
+
+func (q *recordingQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.requests = append(q.requests, r)
+	return entities.ProxyResponse{StatusCode: http.StatusOK}
+}
+
+func TestUpstreamKeys(t *testing.T) {
+	store := newTestStore(t)
+	next := &recordingQueue{}
+	keys := NewUpstreamKeys(next, store)
+
+	keys.Push(entities.ProxyRequest{TenantID: "acme"})
+	keys.Push(entities.ProxyRequest{})
+	if next.requests[0].APIKey != "sk-acme" || next.requests[1].APIKey != "" {
+		t.Errorf("forwarded API keys = %q, %q, want the tenant's key and none", next.requests[0].APIKey, next.requests[1].APIKey)
+	}
+
+	resp := keys.Push(entities.ProxyRequest{TenantID: "deleted"})
+	if !errors.Is(resp.Err, entities.ErrTenantNotFound) || len(next.requests) != 2 {
+		t.Errorf("Push() for a deleted tenant error = %v, want ErrTenantNotFound without forwarding", resp.Err)
+	}
+}
+
+func TestUpstreamKeys_VirtualKeys(t *testing.T) {
+	store := newTestStore(t)
+	service := NewService(store)
+	pooled, err := service.IssueKey("acme", entities.VirtualKeyRequest{UpstreamAPIKeys: []string{"sk-eu-1", "sk-eu-2"}})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+	plain, err := service.IssueKey("acme", entities.VirtualKeyRequest{})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+	next := &recordingQueue{}
+	keys := NewUpstreamKeys(next, store)
+
+	for i := 0; i < 3; i++ {
+		keys.Push(entities.ProxyRequest{TenantID: "acme", VirtualKeyID: pooled.ID})
+	}
+	keys.Push(entities.ProxyRequest{TenantID: "acme", VirtualKeyID: plain.ID})
+	var got []string
+	for _, r := range next.requests {
+		got = append(got, r.APIKey)
+	}
+	if strings.Join(got, ",") != "sk-eu-1,sk-eu-2,sk-eu-1,sk-acme" {
+		t.Errorf("forwarded API keys = %v, want the pool in turn, then the tenant's key", got)
+	}
+
+	store.DeleteVirtualKey("acme", pooled.ID)
+	resp := keys.Push(entities.ProxyRequest{TenantID: "acme", VirtualKeyID: pooled.ID})
+	if !errors.Is(resp.Err, entities.ErrVirtualKeyNotFound) || len(next.requests) != 4 {
+		t.Errorf("Push() for a revoked key error = %v, want ErrVirtualKeyNotFound without forwarding", resp.Err)
+	}
+}
+
+func TestService(t *testing.T) {
+	store := newTestStore(t)
+	service := NewService(store)
+
+	issued, err := service.IssueKey("acme", entities.VirtualKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatalf("IssueKey() error = %v", err)
+	}
+	if !strings.HasPrefix(issued.Key, keyPrefix+issued.ID+"-") || issued.Hash != HashKey(issued.Key) {
+		t.Errorf("IssueKey() = %+v, want a prefixed key stored by its hash", issued)
+	}
+	if _, err := service.IssueKey("missing", entities.VirtualKeyRequest{}); !errors.Is(err, entities.ErrTenantNotFound) {
+		t.Errorf("IssueKey() for a missing tenant error = %v, want ErrTenantNotFound", err)
+	}
+
+	upstream := []string{"sk-ci"}
+	key, err := service.UpdateKey("acme", issued.ID, entities.VirtualKeyUpdate{UpstreamAPIKeys: &upstream})
+	if err != nil || key.Name != "ci" || len(key.UpstreamAPIKeys) != 1 {
+		t.Errorf("UpdateKey() = %+v, %v, want only the upstream keys changed", key, err)
+	}
+	if _, err := service.UpdateKey("beta", issued.ID, entities.VirtualKeyUpdate{}); !errors.Is(err, entities.ErrVirtualKeyNotFound) {
+		t.Errorf("UpdateKey() through another tenant error = %v, want ErrVirtualKeyNotFound", err)
+	}
+
+	rpm := 30
+	updated, err := service.UpdateTenant("acme", entities.TenantUpdate{RequestsPerMinute: &rpm})
+	if err != nil || updated.RequestsPerMinute != 30 || updated.UpstreamAPIKey != "sk-acme" {
+		t.Errorf("UpdateTenant() = %+v, %v, want only the rate limit changed", updated, err)
+	}
+
+	store.UpdateSessionTokens("acme/s1", entities.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	store.UpdateSessionTokens("acme/s2", entities.TokenUsage{TotalTokens: 5})
+	store.UpdateSessionTokens("beta/s1", entities.TokenUsage{TotalTokens: 100})
+	store.UpdateSessionTokens("s1", entities.TokenUsage{TotalTokens: 100})
+	usage, err := service.Usage("acme")
+	if err != nil {
+		t.Fatalf("Usage() error = %v", err)
+	}
+	want := entities.TenantUsage{TenantID: "acme", Sessions: 2, RequestCount: 2, TotalPromptTokens: 10, TotalCompletionTokens: 5, TotalTokens: 20}
+	if *usage != want {
+		t.Errorf("Usage() = %+v, want %+v", *usage, want)
+	}
+}
+
+func TestResidency(t *testing.T) {
+	store := newTestStore(t)
+	store.CreateTenant(entities.Tenant{ID: "eu-bank", Residency: "eu"})
+	store.CreateTenant(entities.Tenant{ID: "us-shop", Residency: "us"})
+	next := &recordingQueue{}
+	residency := NewResidency(next, store, "eu-west-1")
+
+	for _, tenantID := range []string{"acme", "eu-bank", ""} {
+		if resp := residency.Push(entities.ProxyRequest{TenantID: tenantID}); resp.Err != nil {
+			t.Errorf("Push() for tenant %q error = %v", tenantID, resp.Err)
+		}
+	}
+	if len(next.requests) != 3 || next.requests[0].Residency != "" || next.requests[1].Residency != "eu" {
+		t.Errorf("forwarded requests = %+v, want the residency of eu-bank set", next.requests)
+	}
+
+	resp := residency.Push(entities.ProxyRequest{TenantID: "us-shop"})
+	if !errors.Is(resp.Err, entities.ErrResidencyViolation) || len(next.requests) != 3 {
+		t.Errorf("Push() for a tenant outside the upstream's region error = %v, want ErrResidencyViolation without forwarding", resp.Err)
+	}
+	// An upstream without a region satisfies no residency
+	resp = NewResidency(next, store, "").Push(entities.ProxyRequest{TenantID: "eu-bank"})
+	if !errors.Is(resp.Err, entities.ErrResidencyViolation) {
+		t.Errorf("Push() to an upstream without a region error = %v, want ErrResidencyViolation", resp.Err)
+	}
+}
+
+func TestResolver_RefusesTenantsOutsideResidency(t *testing.T) {
+	store := newTestStore(t)
+	store.CreateTenant(entities.Tenant{ID: "eu-bank", Residency: "eu"})
+	store.CreateTenant(entities.Tenant{ID: "us-shop", Residency: "us"})
+	resolver := NewResolver(store, entities.TenantSettings{Mode: entities.TenantModeHeader, Header: "X-Tenant-ID"}).
+		WithResidency("eu-west-1")
+
+	var residency string
+	var checked bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		residency, checked = entities.ResidencyFromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("X-Tenant-ID", "eu-bank")
+	rr := httptest.NewRecorder()
+	resolver.Middleware(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !checked || residency != "eu" {
+		t.Errorf("eu-bank status = %d, residency = %q (checked %v), want 200 with eu", rr.Code, residency, checked)
+	}
+
+	// The next handlers, which run request filters and authorization, never
+	// see the request of a tenant the upstream may not serve
+	checked = false
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("X-Tenant-ID", "us-shop")
+	rr = httptest.NewRecorder()
+	resolver.Middleware(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"code":"residency_violation"`) || checked {
+		t.Errorf("us-shop status = %d, body = %s, want 403 residency_violation before the next handler", rr.Code, rr.Body)
+	}
+}
+
+func TestResidency_SkipsCheckedRequests(t *testing.T) {
+	next := &recordingQueue{}
+	// The tenant is not in the store, so a lookup would fail
+	residency := NewResidency(next, repository.NewMemoryRepository(), "eu-west-1")
+	resp := residency.Push(entities.ProxyRequest{TenantID: "eu-bank", Residency: "eu", ResidencyChecked: true})
+	if resp.Err != nil || len(next.requests) != 1 || next.requests[0].Residency != "eu" {
+		t.Errorf("Push() of a checked request error = %v, forwarded %+v", resp.Err, next.requests)
+	}
+}
@@ -0,0 +1,85 @@
+package tenant
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type TenantGetter interface {
+	GetTenant(id string) (*entities.Tenant, error)
+	GetVirtualKey(id string) (*entities.VirtualKey, error)
+}
+
+// UpstreamKeys wraps a queue and sends each request with the upstream API
+// key of the virtual key it was made with, or else of its tenant. Requests
+// without either use the proxy's key.
+type UpstreamKeys struct {
+	next    Queue
+	tenants TenantGetter
+
+	mu sync.Mutex
+	// turns counts the requests sent with each virtual key's pool of
+	// upstream keys, to take them in turn
+	turns map[string]int
+}
+
+// NewUpstreamKeys creates a new UpstreamKeys in front of next
+func NewUpstreamKeys(next Queue, tenants TenantGetter) *UpstreamKeys {
+	return &UpstreamKeys{
+		next:    next,
+		tenants: tenants,
+		turns:   make(map[string]int),
+	}
+}
+
+// Push looks up the key of the request's virtual key or tenant when it is
+// sent, so key changes apply to queued jobs too. A request made with a key
+// revoked since is not sent, rather than sent on another account.
+func (u *UpstreamKeys) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	if err := u.SetKey(&r); err != nil {
+		return entities.ProxyResponse{Err: err}
+	}
+	return u.next.Push(r)
+}
+
+// SetKey sets the upstream API key of a request without one from its virtual
+// key or tenant, for queues that dispatch requests away from Push
+func (u *UpstreamKeys) SetKey(r *entities.ProxyRequest) error {
+	if r.VirtualKeyID != "" && r.APIKey == "" {
+		key, err := u.tenants.GetVirtualKey(r.VirtualKeyID)
+		if err != nil {
+			return fmt.Errorf("failed to get virtual key %s: %w", r.VirtualKeyID, err)
+		}
+		r.APIKey = u.pick(key)
+	}
+	if r.TenantID != "" && r.APIKey == "" {
+		tenant, err := u.tenants.GetTenant(r.TenantID)
+		if err != nil {
+			return fmt.Errorf("failed to get tenant %s: %w", r.TenantID, err)
+		}
+		r.APIKey = tenant.UpstreamAPIKey
+	}
+	return nil
+}
+
+// pick returns the virtual key's next upstream key, or an empty string if it
+// has none
+func (u *UpstreamKeys) pick(key *entities.VirtualKey) string {
+	switch len(key.UpstreamAPIKeys) {
+	case 0:
+		return ""
+	case 1:
+		return key.UpstreamAPIKeys[0]
+	}
+	u.mu.Lock()
+	turn := u.turns[key.ID]
+	u.turns[key.ID] = turn + 1
+	u.mu.Unlock()
+	return key.UpstreamAPIKeys[turn%len(key.UpstreamAPIKeys)]
+}
@@ -0,0 +1,141 @@
+// Package throttle paces the requests of each session according to its tier
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/ratelimit"
+)
+
+// DefaultTier is the key of the tier of sessions whose tag has none
+const DefaultTier = "*"
+
+// Metrics of the throttle
+const (
+	// DelayedMetric counts requests delayed to repay their session's debt
+	DelayedMetric = "session_throttle_delayed_total"
+	// RejectedMetric counts requests rejected because they would wait too long
+	RejectedMetric = "session_throttle_rejected_total"
+)
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// SessionThrottle wraps a queue and delays the requests of sessions that
+// exceed the rate of their tier. The tier of a session is the one keyed by
+// its tag, or the default tier; requests without a session are not throttled.
+type SessionThrottle struct {
+	next    Queue
+	tiers   map[string]entities.ThrottleTier
+	limiter *ratelimit.Limiter
+	metrics Counter
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+// NewSessionThrottle creates a new SessionThrottle in front of next
+func NewSessionThrottle(next Queue, tiers map[string]entities.ThrottleTier, metrics Counter) *SessionThrottle {
+	return &SessionThrottle{
+		next:    next,
+		tiers:   tiers,
+		limiter: ratelimit.NewLimiter(),
+		metrics: metrics,
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}
+}
+
+// Push waits until the request's session has repaid what it borrowed, then
+// forwards the request. The wait is included in the response's QueueWait.
+func (t *SessionThrottle) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	tier, ok := t.tierOf(r.SessionID)
+	if !ok {
+		return t.next.Push(r)
+	}
+	delay, ok := t.limiter.Reserve(r.SessionID, t.now(), tier.RequestsPerMinute, tier.Burst, tier.MaxDelay)
+	if !ok {
+		t.metrics.Inc(RejectedMetric)
+		return rejection(r.SessionID, delay-tier.MaxDelay)
+	}
+	if delay > 0 {
+		t.metrics.Inc(DelayedMetric)
+		log.Printf("Delaying request of session %s by %v to repay its burst", r.SessionID, delay.Round(time.Millisecond))
+		t.sleep(delay)
+	}
+	resp := t.next.Push(r)
+	resp.QueueWait += delay
+	return resp
+}
+
+// tierOf returns the tier of a session
+func (t *SessionThrottle) tierOf(sessionID string) (entities.ThrottleTier, bool) {
+	if sessionID == "" {
+		return entities.ThrottleTier{}, false
+	}
+	if tag := entities.SessionTag(sessionID); tag != "" {
+		if tier, ok := t.tiers[tag]; ok {
+			return tier, true
+		}
+	}
+	tier, ok := t.tiers[DefaultTier]
+	return tier, ok
+}
+
+// rejection is the 429 response to a request that would wait too long
+func rejection(sessionID string, retryAfter time.Duration) entities.ProxyResponse {
+	body, _ := json.Marshal(entities.NewErrorResponse(
+		fmt.Sprintf("Session %s is sending requests faster than its tier allows", sessionID), "rate_limit_error", "session_throttled"))
+	return entities.ProxyResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Headers: http.Header{
+			"Content-Type": {"application/json"},
+			"Retry-After":  {strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))},
+		},
+		Body: body,
+	}
+}
+
+// ParseTiers parses tiers keyed by session tag, or "*" for the default, with
+// values of the form rpm[:burst[:max_delay]], e.g. "60:20:30s". The burst
+// defaults to one request and the maximum delay to none.
+func ParseTiers(specs map[string]string) (map[string]entities.ThrottleTier, error) {
+	tiers := make(map[string]entities.ThrottleTier, len(specs))
+	for tag, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid throttle tier %s=%q: expected rpm[:burst[:max_delay]]", tag, spec)
+		}
+		var tier entities.ThrottleTier
+		var err error
+		if tier.RequestsPerMinute, err = strconv.Atoi(parts[0]); err != nil || tier.RequestsPerMinute <= 0 {
+			return nil, fmt.Errorf("invalid throttle tier %s=%q: rpm must be a positive integer", tag, spec)
+		}
+		tier.Burst = 1
+		if len(parts) > 1 && parts[1] != "" {
+			if tier.Burst, err = strconv.Atoi(parts[1]); err != nil || tier.Burst <= 0 {
+				return nil, fmt.Errorf("invalid throttle tier %s=%q: burst must be a positive integer", tag, spec)
+			}
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			if tier.MaxDelay, err = time.ParseDuration(parts[2]); err != nil || tier.MaxDelay < 0 {
+				return nil, fmt.Errorf("invalid throttle tier %s=%q: max_delay must be a duration such as 30s", tag, spec)
+			}
+		}
+		tiers[tag] = tier
+	}
+	return tiers, nil
+}
@@ -0,0 +1,108 @@
+package throttle
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+)
+
+type okQueue struct {
+	pushed int
+}
+
+func (q *okQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	q.pushed++
+	return entities.ProxyResponse{StatusCode: http.StatusOK, QueueWait: 10 * time.Millisecond}
+}
+
+func TestSessionThrottle_Push(t *testing.T) {
+	tiers, err := ParseTiers(map[string]string{"*": "60:2", "free": "6:1:15s"})
+	if err != nil {
+		t.Fatalf("ParseTiers() error = %v", err)
+	}
+	next := &okQueue{}
+	registry := metrics.NewMetrics()
+	throttle := NewSessionThrottle(next, tiers, registry)
+	now := time.Unix(1000, 0)
+	throttle.now = func() time.Time { return now }
+	var slept []time.Duration
+	throttle.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	push := func(sessionID string) entities.ProxyResponse {
+		return throttle.Push(entities.ProxyRequest{SessionID: sessionID, Method: http.MethodPost, Path: "/v1/chat/completions"})
+	}
+
+	// The default tier bursts two requests, then delays each by one more second
+	for i := 0; i < 4; i++ {
+		push("s1")
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("delays = %v, want %v", slept, want)
+	}
+	if resp := push("s2"); resp.QueueWait != 10*time.Millisecond {
+		t.Errorf("another session was delayed: QueueWait = %v", resp.QueueWait)
+	}
+	if resp := push("s1"); resp.QueueWait != 3*time.Second+10*time.Millisecond {
+		t.Errorf("QueueWait = %v, want the delay added to the queue's", resp.QueueWait)
+	}
+
+	// Tagged sessions use their tier, which rejects delays over 15s
+	slept = nil
+	push("free:a")
+	if resp := push("free:a"); resp.StatusCode != http.StatusOK || !reflect.DeepEqual(slept, []time.Duration{10 * time.Second}) {
+		t.Errorf("second request of the free tier = %d after %v, want a 10s delay", resp.StatusCode, slept)
+	}
+	resp := push("free:a")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Headers.Get("Retry-After") != "5" {
+		t.Errorf("third request of the free tier = %d, Retry-After %q, want 429 after 5s", resp.StatusCode, resp.Headers.Get("Retry-After"))
+	}
+
+	// Requests without a session are not throttled
+	slept = nil
+	for i := 0; i < 5; i++ {
+		push("")
+	}
+	if len(slept) != 0 {
+		t.Errorf("requests without a session were delayed by %v", slept)
+	}
+
+	if next.pushed != 13 {
+		t.Errorf("forwarded %d requests, want 13", next.pushed)
+	}
+	counters := registry.Snapshot()
+	if counters[DelayedMetric] != 4 || counters[RejectedMetric] != 1 {
+		t.Errorf("metrics = %v, want 4 delayed and 1 rejected", counters)
+	}
+}
+
+func TestSessionThrottle_WithoutDefaultTier(t *testing.T) {
+	next := &okQueue{}
+	throttle := NewSessionThrottle(next, map[string]entities.ThrottleTier{"free": {RequestsPerMinute: 1, Burst: 1}}, metrics.NewMetrics())
+	throttle.sleep = func(d time.Duration) { t.Errorf("untiered session delayed by %v", d) }
+	for i := 0; i < 3; i++ {
+		throttle.Push(entities.ProxyRequest{SessionID: "pro:a"})
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	got, err := ParseTiers(map[string]string{"*": "60", "batch": "600:100:1m"})
+	if err != nil {
+		t.Fatalf("ParseTiers() error = %v", err)
+	}
+	want := map[string]entities.ThrottleTier{
+		"*":     {RequestsPerMinute: 60, Burst: 1},
+		"batch": {RequestsPerMinute: 600, Burst: 100, MaxDelay: time.Minute},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTiers() = %+v, want %+v", got, want)
+	}
+	for _, spec := range []string{"", "0", "x", "60:0", "60:x", "60:10:soon", "60:10:1s:2"} {
+		if _, err := ParseTiers(map[string]string{"*": spec}); err == nil {
+			t.Errorf("ParseTiers(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package tlsconfig builds the TLS settings for mutual TLS with the upstream
+// and on the public listener.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Client returns TLS settings presenting the certificate in certFile and
+// keyFile, if set, and trusting the CAs in caFile in addition to the system
+// roots. It returns nil when nothing is configured.
+func Client(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if err := appendCAs(pool, caFile); err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// HTTPClient returns a client for upstream requests using tlsCfg, with the
+// default transport's proxy and timeout settings
+func HTTPClient(tlsCfg *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return &http.Client{Transport: transport}
+}
+
+// RequireClientCerts makes a server verify client certificates against the
+// CAs in caFile. When optional, clients without a certificate are accepted,
+// but certificates that are presented must still verify.
+func RequireClientCerts(cfg *tls.Config, caFile string, optional bool) error {
+	pool := x509.NewCertPool()
+	if err := appendCAs(pool, caFile); err != nil {
+		return err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if optional {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
+}
+
+func appendCAs(pool *x509.CertPool, caFile string) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tlsconfig"
+)
+
+// issue creates a certificate signed by parent (self-signed when nil) and
+// writes it and its key as PEM files to dir
+func issue(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return cert, key, certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := issue(t, dir, "ca", nil, nil, true)
+	_, _, serverCert, serverKey := issue(t, dir, "server", ca, caKey, false)
+	_, _, clientCert, clientKey := issue(t, dir, "client", ca, caKey, false)
+
+	newServer := func(optional bool) *httptest.Server {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) > 0 {
+				w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			}
+		}))
+		cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+		if err != nil {
+			t.Fatalf("LoadX509KeyPair() error = %v", err)
+		}
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if err := tlsconfig.RequireClientCerts(server.TLS, caFile, optional); err != nil {
+			t.Fatalf("RequireClientCerts() error = %v", err)
+		}
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	get := func(server *httptest.Server, certFile, keyFile string) (*http.Response, error) {
+		cfg, err := tlsconfig.Client(certFile, keyFile, caFile)
+		if err != nil {
+			t.Fatalf("Client() error = %v", err)
+		}
+		return tlsconfig.HTTPClient(cfg).Get(server.URL)
+	}
+
+	required := newServer(false)
+	resp, err := get(required, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("request with a client certificate error = %v", err)
+	}
+	resp.Body.Close()
+	if _, err := get(required, "", ""); err == nil {
+		t.Error("request without a client certificate error = nil, want a handshake error")
+	}
+
+	optional := newServer(true)
+	resp, err = get(optional, "", "")
+	if err != nil {
+		t.Fatalf("request without a client certificate to an optional server error = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClient(t *testing.T) {
+	if cfg, err := tlsconfig.Client("", "", ""); cfg != nil || err != nil {
+		t.Errorf("Client() without files = %v, %v, want nil", cfg, err)
+	}
+	dir := t.TempDir()
+	if _, err := tlsconfig.Client(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"), ""); err == nil {
+		t.Error("Client() with missing certificate files error = nil, want an error")
+	}
+	empty := filepath.Join(dir, "empty.pem")
+	os.WriteFile(empty, nil, 0o600)
+	if _, err := tlsconfig.Client("", "", empty); err == nil {
+		t.Error("Client() with a CA file without certificates error = nil, want an error")
+	}
+}
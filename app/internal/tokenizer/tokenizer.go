@@ -0,0 +1,256 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	tiktoken "github.com/tiktoken-go/tokenizer"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Per-message overhead of the chat format, as documented by OpenAI
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// Estimator counts tokens locally with tiktoken-compatible BPE encodings.
+// It is used when an upstream response does not report usage.
+type Estimator struct {
+	codecs map[tiktoken.Encoding]tiktoken.Codec
+	mu     sync.Mutex
+}
+
+// NewEstimator creates a new Estimator. Encodings are loaded lazily on first use.
+func NewEstimator() *Estimator {
+	return &Estimator{
+		codecs: make(map[tiktoken.Encoding]tiktoken.Codec),
+	}
+}
+
+// CountTokens returns the number of tokens in text for the given model
+func (e *Estimator) CountTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	codec, err := e.codecFor(model)
+	if err != nil {
+		log.Printf("Error loading tokenizer for model %q: %v", model, err)
+		return approximateTokens(text)
+	}
+	count, err := codec.Count(text)
+	if err != nil {
+		return approximateTokens(text)
+	}
+	return count
+}
+
+// EstimateUsage estimates token usage of an exchange from the request and
+// response bodies. It returns nil if neither contains any countable text.
+// The result is marked as estimated.
+func (e *Estimator) EstimateUsage(requestBody, responseBody []byte) *entities.TokenUsage {
+	model, promptParts, _ := extractPrompt(requestBody)
+	completionParts := extractCompletion(responseBody)
+	if len(promptParts) == 0 && len(completionParts) == 0 {
+		return nil
+	}
+
+	usage := &entities.TokenUsage{Estimated: true}
+	usage.PromptTokens = e.CountPromptTokens(requestBody)
+	for _, part := range completionParts {
+		usage.CompletionTokens += e.CountTokens(model, part)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// CountPromptTokens estimates the prompt tokens of a request body,
+// including the chat format overhead
+func (e *Estimator) CountPromptTokens(requestBody []byte) int {
+	model, promptParts, messageCount := extractPrompt(requestBody)
+	tokens := 0
+	for _, part := range promptParts {
+		tokens += e.CountTokens(model, part)
+	}
+	if messageCount > 0 {
+		tokens += messageCount*tokensPerMessage + tokensPerReply
+	}
+	return tokens
+}
+
+// PromptText returns the prompt text parts of a request body
+func (e *Estimator) PromptText(requestBody []byte) []string {
+	_, promptParts, _ := extractPrompt(requestBody)
+	return promptParts
+}
+
+// codecFor returns the encoding used by the model, defaulting to cl100k_base
+func (e *Estimator) codecFor(model string) (tiktoken.Codec, error) {
+	encoding := tiktoken.Cl100kBase
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			encoding = tiktoken.O200kBase
+			break
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if codec, ok := e.codecs[encoding]; ok {
+		return codec, nil
+	}
+	codec, err := tiktoken.Get(encoding)
+	if err != nil {
+		return nil, err
+	}
+	e.codecs[encoding] = codec
+	return codec, nil
+}
+
+// approximateTokens is a last-resort estimate of roughly four characters per token
+func approximateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// extractPrompt returns the model, the prompt text parts and the number of chat
+// messages from a request body (chat, completions, embeddings or Responses API).
+func extractPrompt(body []byte) (string, []string, int) {
+	var req struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Prompt       json.RawMessage `json:"prompt"`
+		Input        json.RawMessage `json:"input"`
+		Instructions string          `json:"instructions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", nil, 0
+	}
+
+	var parts []string
+	for _, msg := range req.Messages {
+		parts = append(parts, textFromContent(msg.Content)...)
+	}
+	parts = append(parts, textFromContent(req.Prompt)...)
+	parts = append(parts, textFromContent(req.Input)...)
+	if req.Instructions != "" {
+		parts = append(parts, req.Instructions)
+	}
+	return req.Model, parts, len(req.Messages)
+}
+
+// extractCompletion returns the generated text parts of a response body,
+// which may be a JSON document or a server-sent event stream.
+func extractCompletion(body []byte) []string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	if trimmed[0] == '{' {
+		return completionFromJSON(trimmed)
+	}
+
+	var parts []string
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(trimmed)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		parts = append(parts, completionFromJSON([]byte(data))...)
+	}
+	return parts
+}
+
+// completionFromJSON extracts generated text from a single response object or stream chunk
+func completionFromJSON(body []byte) []string {
+	var resp struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		OutputText string `json:"output_text"`
+		Delta      string `json:"delta"`
+		Output     []struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"output"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+
+	var parts []string
+	for _, choice := range resp.Choices {
+		parts = appendNonEmpty(parts, choice.Text, choice.Delta.Content)
+		parts = append(parts, textFromContent(choice.Message.Content)...)
+	}
+	if resp.OutputText != "" {
+		parts = append(parts, resp.OutputText)
+	} else {
+		for _, item := range resp.Output {
+			for _, c := range item.Content {
+				parts = appendNonEmpty(parts, c.Text)
+			}
+		}
+	}
+	return appendNonEmpty(parts, resp.Delta)
+}
+
+// textFromContent extracts text from a content value that is either a string,
+// an array of strings, or an array of content parts with a "text" field.
+func textFromContent(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return appendNonEmpty(nil, s)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+	var parts []string
+	for _, item := range items {
+		if err := json.Unmarshal(item, &s); err == nil {
+			parts = appendNonEmpty(parts, s)
+			continue
+		}
+		var part struct {
+			Text    string          `json:"text"`
+			Content json.RawMessage `json:"content"`
+		}
+		if err := json.Unmarshal(item, &part); err == nil {
+			parts = appendNonEmpty(parts, part.Text)
+			parts = append(parts, textFromContent(part.Content)...)
+		}
+	}
+	return parts
+}
+
+func appendNonEmpty(parts []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,86 @@
+package tokenizer_test
+
+import (
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/internal/tokenizer"
+)
+
+func TestEstimator_CountTokens(t *testing.T) {
+	e := tokenizer.NewEstimator()
+
+	if got := e.CountTokens("gpt-4", ""); got != 0 {
+		t.Errorf("CountTokens(empty) = %d, want 0", got)
+	}
+	// "hello world" is two tokens in both cl100k_base and o200k_base
+	if got := e.CountTokens("gpt-4", "hello world"); got != 2 {
+		t.Errorf("CountTokens(gpt-4) = %d, want 2", got)
+	}
+	if got := e.CountTokens("gpt-4o-mini", "hello world"); got != 2 {
+		t.Errorf("CountTokens(gpt-4o-mini) = %d, want 2", got)
+	}
+}
+
+func TestEstimator_EstimateUsage(t *testing.T) {
+	e := tokenizer.NewEstimator()
+
+	tests := []struct {
+		name           string
+		request        string
+		response       string
+		wantPrompt     int
+		wantCompletion int
+		wantNil        bool
+	}{
+		{
+			name:           "chat completion",
+			request:        `{"model":"gpt-4","messages":[{"role":"user","content":"hello world"}]}`,
+			response:       `{"choices":[{"message":{"role":"assistant","content":"hello world"}}]}`,
+			wantPrompt:     2 + 3 + 3, // content + per-message + reply priming
+			wantCompletion: 2,
+		},
+		{
+			name:           "streamed chat completion",
+			request:        `{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"text","text":"hello world"}]}]}`,
+			response:       "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\ndata: [DONE]\n\n",
+			wantPrompt:     2 + 3 + 3,
+			wantCompletion: 2,
+		},
+		{
+			name:       "embeddings",
+			request:    `{"model":"text-embedding-3-small","input":["hello world","hello world"]}`,
+			response:   `{"object":"list","data":[]}`,
+			wantPrompt: 4,
+		},
+		{
+			name:     "nothing to count",
+			request:  ``,
+			response: `{"object":"list","data":[]}`,
+			wantNil:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := e.EstimateUsage([]byte(tt.request), []byte(tt.response))
+			if tt.wantNil {
+				if usage != nil {
+					t.Errorf("EstimateUsage() = %+v, want nil", usage)
+				}
+				return
+			}
+			if usage == nil {
+				t.Fatal("EstimateUsage() = nil")
+			}
+			if !usage.Estimated {
+				t.Error("EstimateUsage() result is not marked as estimated")
+			}
+			if usage.PromptTokens != tt.wantPrompt || usage.CompletionTokens != tt.wantCompletion {
+				t.Errorf("EstimateUsage() = (%d, %d), want (%d, %d)", usage.PromptTokens, usage.CompletionTokens, tt.wantPrompt, tt.wantCompletion)
+			}
+			if usage.TotalTokens != usage.PromptTokens+usage.CompletionTokens {
+				t.Errorf("EstimateUsage() total = %d, want %d", usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+			}
+		})
+	}
+}
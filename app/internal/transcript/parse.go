@@ -0,0 +1,214 @@
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// Paths of the endpoints whose exchanges are captured
+const (
+	chatPath        = "/v1/chat/completions"
+	completionsPath = "/v1/completions"
+	responsesPath   = "/v1/responses"
+)
+
+// conversationPaths are the endpoints whose exchanges are captured
+var conversationPaths = map[string]bool{
+	chatPath:        true,
+	completionsPath: true,
+	responsesPath:   true,
+}
+
+// parseTurn extracts the prompt from a request body and the completion from
+// its response, which is either a JSON object or a server-sent event stream.
+// It reports false if either is missing.
+func parseTurn(path string, requestBody, responseBody []byte) (entities.TranscriptTurn, bool) {
+	var request struct {
+		Model    string          `json:"model"`
+		Messages json.RawMessage `json:"messages"`
+		Prompt   json.RawMessage `json:"prompt"`
+		Input    json.RawMessage `json:"input"`
+	}
+	if json.Unmarshal(requestBody, &request) != nil {
+		return entities.TranscriptTurn{}, false
+	}
+	turn := entities.TranscriptTurn{Model: request.Model}
+	switch path {
+	case chatPath:
+		turn.Prompt = request.Messages
+	case completionsPath:
+		turn.Prompt = request.Prompt
+	case responsesPath:
+		turn.Prompt = request.Input
+	}
+	if len(turn.Prompt) == 0 {
+		return entities.TranscriptTurn{}, false
+	}
+
+	var response completionResponse
+	if json.Unmarshal(responseBody, &response) == nil {
+		turn.Completion = response.completion(path)
+	} else {
+		turn.Completion = streamCompletion(path, responseBody)
+	}
+	if response.Model != "" {
+		turn.Model = response.Model
+	}
+	if len(turn.Completion) == 0 {
+		return entities.TranscriptTurn{}, false
+	}
+	return turn, true
+}
+
+// completionResponse is a chat completion, completion or Responses API response
+type completionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message json.RawMessage `json:"message"`
+		Text    *string         `json:"text"`
+	} `json:"choices"`
+	Output []json.RawMessage `json:"output"`
+}
+
+// completion returns the completion entries of the response
+func (c completionResponse) completion(path string) []json.RawMessage {
+	if path == responsesPath {
+		return c.Output
+	}
+	var entries []json.RawMessage
+	for _, choice := range c.Choices {
+		switch {
+		case len(choice.Message) > 0:
+			entries = append(entries, choice.Message)
+		case choice.Text != nil:
+			entries = append(entries, encode(*choice.Text))
+		}
+	}
+	return entries
+}
+
+// streamedMessage is a chat completion message assembled from stream deltas
+type streamedMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	ToolCalls []streamedCall `json:"tool_calls,omitempty"`
+	// calls maps the indexes of the streamed tool calls to ToolCalls
+	calls map[int]int
+	text  *strings.Builder
+}
+
+// streamedCall is a tool call assembled from stream deltas
+type streamedCall struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// streamCompletion assembles the completion of a server-sent event stream:
+// the chat message or text of each choice from their deltas, or the output
+// of the Responses API's response.completed event
+func streamCompletion(path string, body []byte) []json.RawMessage {
+	var (
+		order    []int
+		messages = make(map[int]*streamedMessage)
+		output   []json.RawMessage
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		var event struct {
+			Type     string             `json:"type"`
+			Response completionResponse `json:"response"`
+			Choices  []struct {
+				Index int    `json:"index"`
+				Text  string `json:"text"`
+				Delta struct {
+					Role      string `json:"role"`
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Type     string `json:"type"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if json.Unmarshal([]byte(data), &event) != nil {
+			continue
+		}
+		if event.Type == "response.completed" {
+			output = event.Response.Output
+			continue
+		}
+		for _, choice := range event.Choices {
+			message, ok := messages[choice.Index]
+			if !ok {
+				message = &streamedMessage{Role: "assistant", calls: make(map[int]int), text: &strings.Builder{}}
+				messages[choice.Index] = message
+				order = append(order, choice.Index)
+			}
+			if choice.Delta.Role != "" {
+				message.Role = choice.Delta.Role
+			}
+			message.text.WriteString(choice.Delta.Content)
+			message.text.WriteString(choice.Text)
+			for _, delta := range choice.Delta.ToolCalls {
+				i, ok := message.calls[delta.Index]
+				if !ok {
+					i = len(message.ToolCalls)
+					message.calls[delta.Index] = i
+					message.ToolCalls = append(message.ToolCalls, streamedCall{Type: "function"})
+				}
+				call := &message.ToolCalls[i]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Type != "" {
+					call.Type = delta.Type
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+		}
+	}
+
+	if path == responsesPath {
+		return output
+	}
+	entries := make([]json.RawMessage, 0, len(order))
+	for _, index := range order {
+		message := messages[index]
+		message.Content = message.text.String()
+		if path == completionsPath {
+			entries = append(entries, encode(message.Content))
+		} else {
+			entries = append(entries, encode(message))
+		}
+	}
+	return entries
+}
+
+// encode returns the JSON of a value that always encodes
+func encode(value any) json.RawMessage {
+	encoded, _ := json.Marshal(value)
+	return encoded
+}
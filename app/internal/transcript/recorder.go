@@ -0,0 +1,159 @@
+// Package transcript captures the conversations of the sessions that opted in:
+// the prompt of every chat completion, completion and Responses API request,
+// and what the model answered, for debugging agents and building eval datasets
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// redactedValue replaces the values of redacted fields
+const redactedValue = "[REDACTED]"
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+type Store interface {
+	SaveTranscriptTurn(turn entities.TranscriptTurn) error
+}
+
+// Sessions looks up the metadata sessions opt in with
+type Sessions interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+}
+
+// Scrubber removes sensitive data from the text of a JSON value
+type Scrubber interface {
+	ScrubJSON(value json.RawMessage) json.RawMessage
+}
+
+// Recorder is a queue decorator that stores a turn of the session's
+// transcript for every successful conversation request of an opted-in session.
+// Prompts are stored as they were sent upstream, after request redaction;
+// completions go through the scrubber. The values of the redacted fields are
+// replaced in both.
+type Recorder struct {
+	next         Queue
+	store        Store
+	sessions     Sessions
+	scrubber     Scrubber
+	tags         map[string]bool
+	redactFields map[string]bool
+	now          func() time.Time
+}
+
+// NewRecorder creates a new Recorder with injected dependencies
+func NewRecorder(next Queue, store Store, sessions Sessions, settings entities.TranscriptSettings) *Recorder {
+	rec := &Recorder{
+		next:         next,
+		store:        store,
+		sessions:     sessions,
+		tags:         make(map[string]bool, len(settings.SessionTags)),
+		redactFields: make(map[string]bool, len(settings.RedactFields)),
+		now:          time.Now,
+	}
+	for _, tag := range settings.SessionTags {
+		rec.tags[tag] = true
+	}
+	for _, field := range settings.RedactFields {
+		rec.redactFields[strings.ToLower(field)] = true
+	}
+	return rec
+}
+
+// WithScrubber makes the recorder scrub completions with the scrubber, so
+// they are held to the same redaction rules as prompts
+func (rec *Recorder) WithScrubber(scrubber Scrubber) *Recorder {
+	rec.scrubber = scrubber
+	return rec
+}
+
+// Push forwards the request and records the exchange if its session opted in
+func (rec *Recorder) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := rec.next.Push(r)
+	if resp.Err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.BodyStream != nil ||
+		r.Method != http.MethodPost || !conversationPaths[r.Path] || !rec.capturing(r.SessionID) {
+		return resp
+	}
+
+	turn, ok := parseTurn(r.Path, r.Body, resp.DecodedBody())
+	if !ok {
+		return resp
+	}
+	turn.SessionID = r.SessionID
+	turn.Path = r.Path
+	turn.CreatedAt = rec.now()
+	turn.Prompt = rec.redact(turn.Prompt)
+	for i, entry := range turn.Completion {
+		if rec.scrubber != nil {
+			entry = rec.scrubber.ScrubJSON(entry)
+		}
+		turn.Completion[i] = rec.redact(entry)
+	}
+	if err := rec.store.SaveTranscriptTurn(turn); err != nil {
+		log.Printf("Error saving transcript turn of session %s: %v", r.SessionID, err)
+	}
+	return resp
+}
+
+// capturing reports whether a session opted into capture, by its tag or
+// through its metadata
+func (rec *Recorder) capturing(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	_, id := entities.SplitTenantSessionID(sessionID)
+	if tag := entities.SessionTag(id); tag != "" && rec.tags[tag] {
+		return true
+	}
+	sess, err := rec.sessions.GetSession(sessionID)
+	if err != nil {
+		return false
+	}
+	return sess.Metadata[entities.TranscriptMetadataKey] == "true"
+}
+
+// redact replaces the values of redacted fields at any depth of a JSON value
+func (rec *Recorder) redact(value json.RawMessage) json.RawMessage {
+	if len(rec.redactFields) == 0 {
+		return value
+	}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return value
+	}
+	encoded, err := json.Marshal(rec.walk(decoded))
+	if err != nil {
+		return value
+	}
+	return encoded
+}
+
+// walk replaces the values of redacted fields
+func (rec *Recorder) walk(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if rec.redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = rec.walk(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = rec.walk(child)
+		}
+	}
+	return value
+}
@@ -0,0 +1,166 @@
+package transcript_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/transcript"
+)
+
+type fixedQueue struct {
+	resp entities.ProxyResponse
+}
+
+func (q *fixedQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return q.resp
+}
+
+// upperScrubber stands in for the redactor, upper-casing completions
+type upperScrubber struct{}
+
+func (upperScrubber) ScrubJSON(value json.RawMessage) json.RawMessage {
+	return json.RawMessage(strings.ToUpper(string(value)))
+}
+
+func ok(body string) entities.ProxyResponse {
+	return entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(body)}
+}
+
+func completion(turn entities.TranscriptTurn) string {
+	parts := make([]string, len(turn.Completion))
+	for i, entry := range turn.Completion {
+		parts[i] = string(entry)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestRecorder_OptIn(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	repo.CreateSession("opted-in")
+	repo.SetSessionMetadata("opted-in", map[string]string{entities.TranscriptMetadataKey: "true"})
+	repo.CreateSession("other")
+
+	queue := &fixedQueue{resp: ok(`{"model":"gpt-4o-2024-08-06","choices":[{"message":{"role":"assistant","content":"Hi"}}]}`)}
+	rec := transcript.NewRecorder(queue, repo, repo, entities.TranscriptSettings{SessionTags: []string{"eval"}})
+
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"Hello"}]}`)
+	for _, sessionID := range []string{"opted-in", "other", "eval:run-1", ""} {
+		rec.Push(entities.ProxyRequest{SessionID: sessionID, Method: http.MethodPost, Path: "/v1/chat/completions", Body: body})
+	}
+	// Failed requests and other endpoints are not captured
+	queue.resp = entities.ProxyResponse{StatusCode: http.StatusTooManyRequests, Body: []byte(`{"error":{}}`)}
+	rec.Push(entities.ProxyRequest{SessionID: "opted-in", Method: http.MethodPost, Path: "/v1/chat/completions", Body: body})
+	queue.resp = ok(`{"data":[]}`)
+	rec.Push(entities.ProxyRequest{SessionID: "opted-in", Method: http.MethodPost, Path: "/v1/embeddings", Body: []byte(`{"input":"x"}`)})
+
+	for sessionID, want := range map[string]int{"opted-in": 1, "other": 0, "eval:run-1": 1} {
+		turns, _ := repo.ListTranscript(sessionID, 10)
+		if len(turns) != want {
+			t.Errorf("session %s has %d turns, want %d", sessionID, len(turns), want)
+		}
+	}
+	turns, _ := repo.ListTranscript("opted-in", 10)
+	if len(turns) != 1 {
+		t.Fatalf("ListTranscript() = %+v, want one turn", turns)
+	}
+	turn := turns[0]
+	if turn.Path != "/v1/chat/completions" || turn.Model != "gpt-4o-2024-08-06" || turn.CreatedAt.IsZero() ||
+		string(turn.Prompt) != `[{"role":"user","content":"Hello"}]` || completion(turn) != `{"role":"assistant","content":"Hi"}` {
+		t.Errorf("turn = %+v", turn)
+	}
+}
+
+func TestRecorder_Completions(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		request  string
+		response string
+		want     string
+	}{
+		{
+			name:     "legacy completion",
+			path:     "/v1/completions",
+			request:  `{"model":"gpt-3.5-turbo-instruct","prompt":"Say hi"}`,
+			response: `{"choices":[{"text":"Hi"},{"text":"Hello"}]}`,
+			want:     `"Hi","Hello"`,
+		},
+		{
+			name:     "responses api",
+			path:     "/v1/responses",
+			request:  `{"model":"gpt-4o","input":"Say hi"}`,
+			response: `{"object":"response","output":[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Hi"}]}]}`,
+			want:     `{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Hi"}]}`,
+		},
+		{
+			name:    "chat completions stream",
+			path:    "/v1/chat/completions",
+			request: `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Weather?"}]}`,
+			response: "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Let me \"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"check.\"}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\"\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\":\\\"Oslo\\\"}\"}}]}}]}\n\n" +
+				"data: [DONE]\n\n",
+			want: `{"role":"assistant","content":"Let me check.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Oslo\"}"}}]}`,
+		},
+		{
+			name:    "completions stream",
+			path:    "/v1/completions",
+			request: `{"model":"gpt-3.5-turbo-instruct","stream":true,"prompt":"Say hi"}`,
+			response: "data: {\"choices\":[{\"index\":0,\"text\":\"H\"}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"text\":\"i\"}]}\n\ndata: [DONE]\n\n",
+			want: `"Hi"`,
+		},
+		{
+			name:    "responses api stream",
+			path:    "/v1/responses",
+			request: `{"model":"gpt-4o","stream":true,"input":[{"role":"user","content":"Say hi"}]}`,
+			response: "event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n" +
+				"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"output\":[{\"type\":\"message\",\"content\":[{\"type\":\"output_text\",\"text\":\"Hi\"}]}]}}\n\n",
+			want: `{"type":"message","content":[{"type":"output_text","text":"Hi"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemoryRepository()
+			rec := transcript.NewRecorder(&fixedQueue{resp: ok(tt.response)}, repo, repo, entities.TranscriptSettings{SessionTags: []string{"eval"}})
+			rec.Push(entities.ProxyRequest{SessionID: "eval:1", Method: http.MethodPost, Path: tt.path, Body: []byte(tt.request)})
+
+			turns, _ := repo.ListTranscript("eval:1", 10)
+			if len(turns) != 1 {
+				t.Fatalf("ListTranscript() = %+v, want one turn", turns)
+			}
+			if got := completion(turns[0]); got != tt.want {
+				t.Errorf("completion = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorder_Redaction(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	queue := &fixedQueue{resp: ok(`{"choices":[{"message":{"role":"assistant","content":"done","tool_calls":[{"function":{"name":"login","arguments":"{}"}}],"api_key":"sk-1"}}]}`)}
+	rec := transcript.NewRecorder(queue, repo, repo, entities.TranscriptSettings{
+		SessionTags:  []string{"eval"},
+		RedactFields: []string{"API_KEY"},
+	}).WithScrubber(upperScrubber{})
+
+	rec.Push(entities.ProxyRequest{SessionID: "acme/eval:1", Method: http.MethodPost, Path: "/v1/chat/completions",
+		Body: []byte(`{"messages":[{"role":"user","content":"hi","api_key":"sk-2"}]}`)})
+
+	turns, _ := repo.ListTranscript("acme/eval:1", 10)
+	if len(turns) != 1 {
+		t.Fatalf("ListTranscript() = %+v, want one turn of the tenant's tagged session", turns)
+	}
+	if got, want := string(turns[0].Prompt), `[{"api_key":"[REDACTED]","content":"hi","role":"user"}]`; got != want {
+		t.Errorf("prompt = %s, want %s", got, want)
+	}
+	// Completions are scrubbed before the fields are redacted
+	if got, want := completion(turns[0]), `{"API_KEY":"[REDACTED]","CONTENT":"DONE","ROLE":"ASSISTANT","TOOL_CALLS":[{"FUNCTION":{"ARGUMENTS":"{}","NAME":"LOGIN"}}]}`; got != want {
+		t.Errorf("completion = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package upstreamerr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// UpstreamErrorsMetric counts upstream error responses. It is also counted
+// per type, and per type and model, under names with the labels appended,
+// e.g. upstream_errors_total{type="rate_limit_error"}.
+const UpstreamErrorsMetric = "upstream_errors_total"
+
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// Counter counts named events
+type Counter interface {
+	Inc(name string)
+}
+
+// Classifier is a queue decorator that classifies upstream error responses
+// into ProxyResponse.UpstreamError and counts them. When normalizing, it
+// rewrites error bodies that are not in the OpenAI error envelope, or whose
+// type is not one of the upstream error types, into the envelope.
+type Classifier struct {
+	next      Queue
+	metrics   Counter
+	normalize bool
+}
+
+// NewClassifier creates a new Classifier in front of next
+func NewClassifier(next Queue, metrics Counter, normalize bool) *Classifier {
+	return &Classifier{
+		next:      next,
+		metrics:   metrics,
+		normalize: normalize,
+	}
+}
+
+// Push forwards the request and classifies its response if it failed
+func (c *Classifier) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	resp := c.next.Push(r)
+	if resp.Err != nil || resp.StatusCode < http.StatusBadRequest || resp.BodyStream != nil {
+		return resp
+	}
+
+	body := resp.DecodedBody()
+	resp.UpstreamError = Classify(resp.StatusCode, body)
+	// Responses shared with an identical request were counted with it
+	if !resp.Cached {
+		c.count(resp.UpstreamError.Type, entities.BodyModel(r.Body))
+	}
+	if c.normalize && !isEnvelope(body, resp.UpstreamError.Type) {
+		c.rewrite(&resp)
+	}
+	return resp
+}
+
+// count increments the error counters of the type and model
+func (c *Classifier) count(errType, model string) {
+	c.metrics.Inc(UpstreamErrorsMetric)
+	c.metrics.Inc(fmt.Sprintf("%s{type=%q}", UpstreamErrorsMetric, errType))
+	if model != "" {
+		c.metrics.Inc(fmt.Sprintf("%s{model=%q,type=%q}", UpstreamErrorsMetric, model, errType))
+	}
+}
+
+// rewrite replaces the response body with the OpenAI error envelope of its
+// classification
+func (c *Classifier) rewrite(resp *entities.ProxyResponse) {
+	classified := resp.UpstreamError
+	body, err := json.Marshal(entities.NewErrorResponse(classified.Message, classified.Type, classified.Code))
+	if err != nil {
+		log.Printf("Error encoding normalized upstream error: %v", err)
+		return
+	}
+	headers := resp.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Del("Content-Encoding")
+	headers.Set("Content-Type", "application/json")
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Headers = headers
+	resp.Body = body
+}
+
+// isEnvelope reports whether the body is an OpenAI error envelope of the
+// type. Envelopes with other top-level fields, such as Anthropic's "type",
+// are not.
+func isEnvelope(body []byte, errType string) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil || len(fields) != 1 {
+		return false
+	}
+	var apiErr entities.APIError
+	if json.Unmarshal(fields["error"], &apiErr) != nil {
+		return false
+	}
+	return apiErr.Type == errType && apiErr.Message != ""
+}
@@ -0,0 +1,112 @@
+package upstreamerr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/metrics"
+)
+
+type staticQueue struct {
+	resp entities.ProxyResponse
+}
+
+func (q staticQueue) Push(r entities.ProxyRequest) entities.ProxyResponse {
+	return q.resp
+}
+
+func TestClassifier_Counts(t *testing.T) {
+	registry := metrics.NewMetrics()
+	limited := entities.ProxyResponse{StatusCode: http.StatusTooManyRequests,
+		Body: []byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`)}
+	req := entities.ProxyRequest{Path: "/v1/chat/completions", Body: []byte(`{"model":"gpt-4o"}`)}
+
+	resp := NewClassifier(staticQueue{limited}, registry, false).Push(req)
+	if resp.UpstreamError == nil || resp.UpstreamError.Type != entities.RateLimitErrorType {
+		t.Fatalf("UpstreamError = %+v, want a rate_limit_error", resp.UpstreamError)
+	}
+	if !bytes.Equal(resp.Body, limited.Body) {
+		t.Errorf("body = %s, want it unchanged without normalization", resp.Body)
+	}
+	// A response shared with the request above is not counted again
+	shared := limited
+	shared.Cached = true
+	NewClassifier(staticQueue{shared}, registry, false).Push(req)
+	NewClassifier(staticQueue{entities.ProxyResponse{StatusCode: http.StatusOK, Body: []byte(`{}`)}}, registry, false).Push(req)
+
+	want := map[string]int64{
+		"upstream_errors_total":                                         1,
+		`upstream_errors_total{type="rate_limit_error"}`:                1,
+		`upstream_errors_total{model="gpt-4o",type="rate_limit_error"}`: 1,
+	}
+	got := registry.Snapshot()
+	if len(got) != len(want) {
+		t.Errorf("counters = %v, want %v", got, want)
+	}
+	for name, n := range want {
+		if got[name] != n {
+			t.Errorf("counter %s = %d, want %d", name, got[name], n)
+		}
+	}
+}
+
+func TestClassifier_Normalizes(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`))
+	zw.Close()
+
+	tests := []struct {
+		name      string
+		resp      entities.ProxyResponse
+		rewritten bool
+		wantType  string
+		wantCode  string
+	}{
+		{"anthropic", entities.ProxyResponse{StatusCode: 529,
+			Headers: http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"99"}}, Body: gzipped.Bytes()},
+			true, entities.OverloadedErrorType, ""},
+		{"google", entities.ProxyResponse{StatusCode: http.StatusForbidden,
+			Body: []byte(`{"error":{"code":403,"message":"denied","status":"PERMISSION_DENIED"}}`)},
+			true, entities.PermissionErrorType, "permission_denied"},
+		{"openai type not classified", entities.ProxyResponse{StatusCode: http.StatusTooManyRequests,
+			Body: []byte(`{"error":{"message":"Rate limit reached","type":"tokens","code":"rate_limit_exceeded"}}`)},
+			true, entities.RateLimitErrorType, "rate_limit_exceeded"},
+		{"openai", entities.ProxyResponse{StatusCode: http.StatusBadRequest,
+			Body: []byte(`{"error":{"message":"bad","type":"invalid_request_error","param":"messages","code":null}}`)},
+			false, entities.InvalidRequestErrorType, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := NewClassifier(staticQueue{tt.resp}, metrics.NewMetrics(), true).Push(entities.ProxyRequest{})
+
+			if rewritten := !bytes.Equal(resp.Body, tt.resp.Body); rewritten != tt.rewritten {
+				t.Fatalf("body = %s, rewritten = %v, want %v", resp.Body, rewritten, tt.rewritten)
+			}
+			if !tt.rewritten {
+				return
+			}
+			var envelope entities.ErrorResponse
+			if err := json.Unmarshal(resp.Body, &envelope); err != nil {
+				t.Fatalf("body is not an error envelope: %s", resp.Body)
+			}
+			var code string
+			if envelope.Error.Code != nil {
+				code = *envelope.Error.Code
+			}
+			if envelope.Error.Type != tt.wantType || code != tt.wantCode || envelope.Error.Message == "" {
+				t.Errorf("envelope = %s, want type %s and code %q", resp.Body, tt.wantType, tt.wantCode)
+			}
+			if resp.Headers.Get("Content-Encoding") != "" || resp.Headers.Get("Content-Type") != "application/json" {
+				t.Errorf("headers = %v, want uncompressed JSON", resp.Headers)
+			}
+			if resp.StatusCode != tt.resp.StatusCode {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.resp.StatusCode)
+			}
+		})
+	}
+}
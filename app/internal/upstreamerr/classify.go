@@ -0,0 +1,170 @@
+// Package upstreamerr classifies upstream error responses, counts them by
+// type and model, and optionally rewrites the errors of other providers into
+// the OpenAI error envelope.
+package upstreamerr
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+// maxTextMessage bounds the message taken from an error body that is not JSON
+const maxTextMessage = 200
+
+// knownTypes maps the error types, codes and statuses of the providers to
+// the upstream error types. Keys are lowercase.
+var knownTypes = map[string]string{
+	// OpenAI and Anthropic
+	"invalid_request_error": entities.InvalidRequestErrorType,
+	"request_too_large":     entities.InvalidRequestErrorType,
+	"authentication_error":  entities.AuthenticationErrorType,
+	"invalid_api_key":       entities.AuthenticationErrorType,
+	"permission_error":      entities.PermissionErrorType,
+	"not_found_error":       entities.NotFoundErrorType,
+	"model_not_found":       entities.NotFoundErrorType,
+	"rate_limit_error":      entities.RateLimitErrorType,
+	"rate_limit_exceeded":   entities.RateLimitErrorType,
+	"insufficient_quota":    entities.InsufficientQuotaType,
+	"overloaded_error":      entities.OverloadedErrorType,
+	"timeout_error":         entities.TimeoutErrorType,
+	"api_error":             entities.ServerErrorType,
+	"server_error":          entities.ServerErrorType,
+	// Google API statuses
+	"invalid_argument":    entities.InvalidRequestErrorType,
+	"failed_precondition": entities.InvalidRequestErrorType,
+	"out_of_range":        entities.InvalidRequestErrorType,
+	"unauthenticated":     entities.AuthenticationErrorType,
+	"permission_denied":   entities.PermissionErrorType,
+	"not_found":           entities.NotFoundErrorType,
+	"resource_exhausted":  entities.RateLimitErrorType,
+	"deadline_exceeded":   entities.TimeoutErrorType,
+	"unavailable":         entities.OverloadedErrorType,
+	"internal":            entities.ServerErrorType,
+}
+
+// providerError holds the fields providers report errors in
+type providerError struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"`
+	// Status is the status name of Google APIs, e.g. RESOURCE_EXHAUSTED
+	Status string `json:"status"`
+}
+
+// Classify returns the classification of an error response, or nil for
+// successful responses. It understands the error envelopes of OpenAI
+// ({"error": {"type", "code", "message"}}), Anthropic ({"type": "error",
+// "error": {"type", "message"}}) and Google ({"error": {"code", "status",
+// "message"}}), bodies with a top-level "error", "message" or "detail"
+// string, and plain text. Errors of unknown types are classified by status.
+func Classify(statusCode int, body []byte) *entities.UpstreamError {
+	if statusCode < http.StatusBadRequest {
+		return nil
+	}
+	perr, ok := parse(body)
+	if !ok {
+		perr.Message = textMessage(body)
+	}
+
+	classified := &entities.UpstreamError{Message: perr.Message}
+	var numericCode bool
+	if code, err := strconv.Unquote(string(perr.Code)); err == nil {
+		classified.Code = code
+	} else if len(perr.Code) > 0 && string(perr.Code) != "null" {
+		// Google reports the HTTP status as the code
+		numericCode = true
+	}
+	if classified.Code == "" && perr.Status != "" {
+		classified.Code = strings.ToLower(perr.Status)
+	}
+
+	// The type is tried before the code. OpenAI reports some rate limits
+	// with the "tokens" or "requests" type, which only the code classifies.
+	candidates := []string{perr.Type, classified.Code}
+	if numericCode {
+		candidates = candidates[:1]
+	}
+	for _, candidate := range candidates {
+		if errType, ok := knownTypes[strings.ToLower(candidate)]; ok {
+			classified.Type = errType
+			break
+		}
+	}
+	if classified.Type == "" {
+		classified.Type = statusType(statusCode)
+	}
+	if classified.Message == "" {
+		classified.Message = http.StatusText(statusCode)
+	}
+	return classified
+}
+
+// parse extracts the error fields of a JSON error body. It returns false for
+// bodies that are not JSON objects.
+func parse(body []byte) (providerError, bool) {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Detail  json.RawMessage `json:"detail"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return providerError{}, false
+	}
+	var perr providerError
+	switch field := bytes.TrimSpace(payload.Error); {
+	case bytes.HasPrefix(field, []byte("{")):
+		json.Unmarshal(field, &perr)
+		return perr, true
+	case bytes.HasPrefix(field, []byte(`"`)):
+		json.Unmarshal(field, &perr.Message)
+		return perr, true
+	}
+	perr.Message = payload.Message
+	if perr.Message == "" {
+		// FastAPI servers report errors as a "detail" string
+		json.Unmarshal(payload.Detail, &perr.Message)
+	}
+	return perr, true
+}
+
+// textMessage returns the start of a plain text error body
+func textMessage(body []byte) string {
+	text := strings.TrimSpace(string(bytes.ToValidUTF8(body, nil)))
+	if strings.HasPrefix(text, "<") {
+		// HTML error pages of load balancers carry no useful message
+		return ""
+	}
+	if len(text) > maxTextMessage {
+		text = strings.ToValidUTF8(text[:maxTextMessage], "")
+	}
+	return text
+}
+
+// statusType returns the error type of a status whose error is of no known type
+func statusType(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return entities.AuthenticationErrorType
+	case http.StatusPaymentRequired:
+		return entities.InsufficientQuotaType
+	case http.StatusForbidden:
+		return entities.PermissionErrorType
+	case http.StatusNotFound:
+		return entities.NotFoundErrorType
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return entities.TimeoutErrorType
+	case http.StatusTooManyRequests:
+		return entities.RateLimitErrorType
+	case http.StatusServiceUnavailable, 529:
+		return entities.OverloadedErrorType
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return entities.ServerErrorType
+	}
+	return entities.InvalidRequestErrorType
+}
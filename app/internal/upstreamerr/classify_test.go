@@ -0,0 +1,51 @@
+package upstreamerr
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       *entities.UpstreamError
+	}{
+		{"success", http.StatusOK, `{"id":"chatcmpl-1"}`, nil},
+		{"openai", http.StatusBadRequest, `{"error":{"message":"Invalid model","type":"invalid_request_error","param":"model","code":"model_not_found"}}`,
+			&entities.UpstreamError{Type: entities.InvalidRequestErrorType, Code: "model_not_found", Message: "Invalid model"}},
+		{"openai rate limit of type tokens", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"tokens","code":"rate_limit_exceeded"}}`,
+			&entities.UpstreamError{Type: entities.RateLimitErrorType, Code: "rate_limit_exceeded", Message: "Rate limit reached"}},
+		{"openai quota", http.StatusTooManyRequests, `{"error":{"message":"Quota exceeded","type":"insufficient_quota","code":"insufficient_quota"}}`,
+			&entities.UpstreamError{Type: entities.InsufficientQuotaType, Code: "insufficient_quota", Message: "Quota exceeded"}},
+		{"anthropic", 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			&entities.UpstreamError{Type: entities.OverloadedErrorType, Message: "Overloaded"}},
+		{"anthropic api error", http.StatusInternalServerError, `{"type":"error","error":{"type":"api_error","message":"Internal error"}}`,
+			&entities.UpstreamError{Type: entities.ServerErrorType, Message: "Internal error"}},
+		{"google", http.StatusTooManyRequests, `{"error":{"code":429,"message":"Quota exceeded for model","status":"RESOURCE_EXHAUSTED"}}`,
+			&entities.UpstreamError{Type: entities.RateLimitErrorType, Code: "resource_exhausted", Message: "Quota exceeded for model"}},
+		{"error string", http.StatusUnauthorized, `{"error":"invalid token"}`,
+			&entities.UpstreamError{Type: entities.AuthenticationErrorType, Message: "invalid token"}},
+		{"detail string", http.StatusNotFound, `{"detail":"Model not loaded"}`,
+			&entities.UpstreamError{Type: entities.NotFoundErrorType, Message: "Model not loaded"}},
+		{"plain text", http.StatusGatewayTimeout, "upstream request timeout\n",
+			&entities.UpstreamError{Type: entities.TimeoutErrorType, Message: "upstream request timeout"}},
+		{"html page", http.StatusBadGateway, "<html><body>Bad Gateway</body></html>",
+			&entities.UpstreamError{Type: entities.ServerErrorType, Message: "Bad Gateway"}},
+		{"unknown type", http.StatusServiceUnavailable, `{"error":{"message":"try later","type":"busy"}}`,
+			&entities.UpstreamError{Type: entities.OverloadedErrorType, Message: "try later"}},
+		{"null error", http.StatusUnprocessableEntity, `{"error":null,"message":"bad input"}`,
+			&entities.UpstreamError{Type: entities.InvalidRequestErrorType, Message: "bad input"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.statusCode, []byte(tt.body))
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("Classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package proxy embeds llm-queue-proxy in another Go service: requests served
+// by Handler go through the same queues, sessions and filters as in the
+// standalone binary, without running a separate process.
+//
+//	cfg, err := proxy.LoadConfig()
+//	...
+//	p, err := proxy.New(cfg)
+//	...
+//	defer p.Close()
+//	mux.Handle("/llm/", http.StripPrefix("/llm", p.Handler()))
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/marketconnect/llm-queue-proxy/app/app"
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/config"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/handlers"
+	"github.com/marketconnect/llm-queue-proxy/app/internal/repository"
+)
+
+// Config is the proxy configuration, the same as read by the binary
+type Config = config.Config
+
+// Storage persists sessions, jobs, cached responses, request history and
+// tenants. Embedding services may provide their own implementation.
+type Storage = repository.Storage
+
+// Queue sends requests upstream within the configured rate limits
+type Queue interface {
+	Push(r entities.ProxyRequest) entities.ProxyResponse
+}
+
+// RequestFilter inspects or rewrites a request before it is enqueued
+type RequestFilter = handlers.RequestFilter
+
+// ResponseFilter inspects or rewrites a buffered response before it is returned
+type ResponseFilter = handlers.ResponseFilter
+
+// SessionManager tracks the token usage of sessions
+type SessionManager interface {
+	GetSession(sessionID string) (*entities.SessionData, error)
+	ListSessions() (map[string]*entities.SessionData, error)
+}
+
+// LoadConfig reads the configuration like the binary does: from the file
+// named by CONFIG_FILE, if set, and the environment
+func LoadConfig() (*Config, error) {
+	return config.NewConfig()
+}
+
+// LoadConfigFile reads the configuration from a YAML, TOML or JSON file
+// overridden by the environment
+func LoadConfigFile(path string) (*Config, error) {
+	return config.NewConfigFromFile(path)
+}
+
+// NewMemoryStorage returns a storage that keeps everything in memory
+func NewMemoryStorage() Storage {
+	return repository.NewMemoryRepository()
+}
+
+// Proxy is an embedded llm-queue-proxy
+type Proxy struct {
+	app *app.App
+}
+
+// New creates a proxy using the repository configured in cfg
+func New(cfg *Config) (*Proxy, error) {
+	a, err := app.NewApp(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{app: a}, nil
+}
+
+// NewWithStorage creates a proxy around an initialized storage; the
+// repository settings of cfg are ignored
+func NewWithStorage(cfg *Config, storage Storage) (*Proxy, error) {
+	a, err := app.NewAppWithStorage(cfg, storage)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{app: a}, nil
+}
+
+// AddRequestFilters adds filters run after the configured ones, such as a
+// transformation hook, for custom policies in Go. Returning an
+// *entities.RequestError rejects the request with that error. It must be
+// called before Handler.
+func (p *Proxy) AddRequestFilters(filters ...RequestFilter) {
+	p.app.RequestFilters = append(p.app.RequestFilters, filters...)
+}
+
+// AddResponseFilters adds filters run on buffered responses after the
+// configured ones. It must be called before Handler.
+func (p *Proxy) AddResponseFilters(filters ...ResponseFilter) {
+	p.app.ResponseFilters = append(p.app.ResponseFilters, filters...)
+}
+
+// Handler serves the public API: /v1/..., /v1/session/{id}/..., /v1/jobs,
+// /sessions/status and /version
+func (p *Proxy) Handler() http.Handler {
+	return p.app.Handler()
+}
+
+// AdminHandler serves the administrative API, protected by the admin token
+func (p *Proxy) AdminHandler() http.Handler {
+	return p.app.AdminHandler()
+}
+
+// Queue returns the queue behind Handler, including routing, caching and the
+// other configured decorators, for sending requests without HTTP
+func (p *Proxy) Queue() Queue {
+	return p.app.ProxyQueue
+}
+
+// Sessions returns the session manager recording token usage
+func (p *Proxy) Sessions() SessionManager {
+	return p.app.SessionManager
+}
+
+// Close stops the queues and background workers and closes the storage
+func (p *Proxy) Close() error {
+	return p.app.Close()
+}
@@ -0,0 +1,100 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marketconnect/llm-queue-proxy/app/domain/entities"
+	"github.com/marketconnect/llm-queue-proxy/app/proxy"
+)
+
+func TestProxy_Embedded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`))
+	}))
+	defer upstream.Close()
+
+	t.Setenv("OPENAI_API_KEY", "test_api_key")
+	t.Setenv("OPENAI_BASE_URL", upstream.URL)
+	t.Setenv("RATE_LIMIT_PER_MIN", "6000")
+	cfg, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	p, err := proxy.NewWithStorage(cfg, proxy.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewWithStorage() error = %v", err)
+	}
+	defer p.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/llm/", http.StripPrefix("/llm", p.Handler()))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/llm/v1/session/embedded/chat/completions", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST through the embedded handler status = %d, want %d (body %s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	session, err := p.Sessions().GetSession("embedded")
+	if err != nil || session.TotalTokens != 7 || session.RequestCount != 1 {
+		t.Errorf("GetSession() = %+v, %v, want 7 tokens in one request", session, err)
+	}
+
+	resp := p.Queue().Push(entities.ProxyRequest{Method: http.MethodPost, Path: "/chat/completions", Body: []byte(`{}`)})
+	if resp.Err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Queue().Push() = %d, %v, want %d", resp.StatusCode, resp.Err, http.StatusOK)
+	}
+
+	rr = httptest.NewRecorder()
+	p.AdminHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET /metrics on the admin handler status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+type appendFilter struct{}
+
+func (appendFilter) Filter(sessionID string, req *entities.ProxyRequest) error {
+	req.Headers.Set("X-Policy", "embedded")
+	return nil
+}
+
+func (appendFilter) FilterResponse(sessionID string, req *entities.ProxyRequest, resp *entities.ProxyResponse) error {
+	resp.Headers.Set("X-Filtered", sessionID)
+	return nil
+}
+
+func TestProxy_Filters(t *testing.T) {
+	var policy string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy = r.Header.Get("X-Policy")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	t.Setenv("OPENAI_API_KEY", "test_api_key")
+	t.Setenv("OPENAI_BASE_URL", upstream.URL)
+	t.Setenv("RATE_LIMIT_PER_MIN", "6000")
+	cfg, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	p, err := proxy.NewWithStorage(cfg, proxy.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewWithStorage() error = %v", err)
+	}
+	defer p.Close()
+	p.AddRequestFilters(appendFilter{})
+	p.AddResponseFilters(appendFilter{})
+
+	rr := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/session/embedded/chat/completions", strings.NewReader(`{}`)))
+
+	if rr.Code != http.StatusOK || policy != "embedded" || rr.Header().Get("X-Filtered") != "embedded" {
+		t.Errorf("response %d with X-Filtered %q, upstream X-Policy %q, want both filters applied", rr.Code, rr.Header().Get("X-Filtered"), policy)
+	}
+}
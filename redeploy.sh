@@ -5,7 +5,9 @@ echo "=== GIT PULL ==="
 git pull
 
 echo "=== BUILD ==="
-go build -o /usr/local/bin/llm-queue-proxy ./app/cmd/main.go
+BUILDINFO_PKG=github.com/marketconnect/llm-queue-proxy/app/internal/buildinfo
+go build -ldflags "-X $BUILDINFO_PKG.Version=$(git describe --tags --always --dirty) -X $BUILDINFO_PKG.Commit=$(git rev-parse --short HEAD) -X $BUILDINFO_PKG.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+    -o /usr/local/bin/llm-queue-proxy ./app/cmd
 
 echo "=== SYSTEMD RESTART ==="
 sudo systemctl restart llm-queue-proxy.service